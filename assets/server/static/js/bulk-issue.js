@@ -11,6 +11,10 @@
   // retryCodeCookieName is the name of cookie where the retry code is saved.
   const retryCodeCookieName = 'retryCode';
 
+  // lettersPerPDF is the maximum number of letters to render into a single PDF.
+  // This number is defined in letters.go.
+  const lettersPerPDF = 500;
+
   // Attempt to load the bulk-issue UI and uploader if the components exist.
   window.addEventListener('DOMContentLoaded', () => {
     if (document.querySelector('body#bulk-issue') === null) {
@@ -19,6 +23,7 @@
 
     let total = 0;
     let totalErrs = 0;
+    let letterCodes = [];
 
     let now = new Date();
     let tzOffset = now.getTimezoneOffset();
@@ -35,10 +40,14 @@
     let $rememberCode = $('#remember-code');
     let $inputSMSTemplate = $('select#sms-template');
     let $newCode = $('#new-code');
+    let $letters = $('#letters');
+    let $letterLocaleDiv = $('#letter-locale-div');
+    let $letterLocale = $('select#letter-locale');
     let $startAt = $('#start-at');
 
     let $receiptDiv = $('#receipt-div');
     let $save = $('#save');
+    let $downloadLetters = $('#download-letters');
     let $receiptSuccess = $('#receipt-success');
     let $receiptFailure = $('#receipt-failure');
 
@@ -77,6 +86,32 @@
       flash.error('Canceled batch upload.');
     });
 
+    $letters.on('change', function () {
+      $letterLocaleDiv.toggleClass('d-none', !$letters.is(':checked'));
+    });
+
+    $downloadLetters.on('click', async function (event) {
+      event.preventDefault();
+      $downloadLetters.prop('disabled', true);
+
+      try {
+        let date = now.toISOString().split('T')[0];
+        for (let i = 0; i * lettersPerPDF < letterCodes.length; i++) {
+          let codes = letterCodes.slice(i * lettersPerPDF, (i + 1) * lettersPerPDF);
+          let blob = await downloadLetters(codes);
+          let $link = $('<a/>')
+            .attr('href', URL.createObjectURL(blob))
+            .attr('download', `${date}-bulk-issue-letters-${i + 1}.pdf`);
+          $link[0].click();
+          URL.revokeObjectURL($link.attr('href'));
+        }
+      } catch (err) {
+        flash.error(err.message);
+      }
+
+      $downloadLetters.prop('disabled', false);
+    });
+
     $newCode.on('click', function (event) {
       event.preventDefault();
       $retryCode.val(genRandomString(12));
@@ -108,6 +143,9 @@
       $receiptSuccess.text(0);
       $receiptFailure.text(0);
 
+      letterCodes = [];
+      $downloadLetters.addClass('d-none');
+
       $errorTooMany.addClass('d-none');
       $errorDiv.addClass('d-none');
       $errorTableBody.empty();
@@ -127,6 +165,7 @@
       let start = async function (e) {
         let retryCode = $retryCode.val();
         let template = $inputSMSTemplate.val();
+        let letters = $letters.is(':checked');
         let rows = e.target.result.split('\n');
         let batch = [];
         let batchLines = [];
@@ -142,7 +181,7 @@
           }
 
           // Add to batch if the next row is valid.
-          let request = buildBatchIssueRequest(rows[i], retryCode, template, i + 1);
+          let request = buildBatchIssueRequest(rows[i], retryCode, template, letters, i + 1);
           if (request != '') {
             batch.push(request);
             batchLines.push(i + 1);
@@ -158,7 +197,7 @@
               $tableBody.append($row);
             }
 
-            cancelUpload = await uploadWithRetries(() => uploadBatchIssue(batch, batchLines));
+            cancelUpload = await uploadWithRetries(() => uploadBatchIssue(batch, batchLines, letters));
 
             if (cancelUpload) {
               if (total > 0) {
@@ -195,7 +234,7 @@
       return { start, cancel };
     }
 
-    function buildBatchIssueRequest(thisRow, retryCode, template, line) {
+    function buildBatchIssueRequest(thisRow, retryCode, template, letters, line) {
       thisRow = thisRow.trim();
       if (thisRow == '') {
         return '';
@@ -213,8 +252,8 @@
         request['testType'] = 'confirmed';
       }
 
-      // Skip missing phone number
-      if (request['phone'] == '' || cols.Length < 2) {
+      // Skip missing phone number, unless the code is printed in a letter.
+      if ((request['phone'] == '' && !letters) || cols.Length < 2) {
         let code = {
           errorCode: 'invalid_client',
           error: 'phone number missing',
@@ -228,8 +267,10 @@
         uuid = $('<div>').text(cols[6].trim()).html();
       }
       if (uuid.length != 36) {
-        // Generate a UUID by hashing phone
-        let hs = String(CryptoJS.HmacSHA256(request['phone'], retryCode)).substr(0, 36);
+        // Generate a UUID by hashing phone, or the line number for letters without
+        // a phone number.
+        let key = request['phone'] != '' ? request['phone'] : `line-${line}`;
+        let hs = String(CryptoJS.HmacSHA256(key, retryCode)).substr(0, 36);
         uuid =
           hs.substr(0, 8) +
           '-' +
@@ -272,9 +313,11 @@
       return request;
     }
 
-    function uploadBatchIssue(data, lines) {
+    function uploadBatchIssue(data, lines, letters) {
       let req = {
         codes: data,
+        letters: letters,
+        letterLocale: letters ? $letterLocale.val() || '' : '',
         // Request is padded with 5-15 random chars. These are ignored but vary the size of the request
         // to prevent network traffic observation.
         padding: btoa(genRandomString(5 + Math.floor(Math.random() * 15))),
@@ -311,6 +354,30 @@
       });
     }
 
+    // downloadLetters requests a PDF with a printable letter for each code.
+    async function downloadLetters(codes) {
+      let response = await fetch('/codes/letters', {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: {
+          'Content-Type': 'application/json',
+          'X-CSRF-Token': getCSRFToken(),
+        },
+        body: JSON.stringify({
+          codes: codes,
+          letterLocale: $letterLocale.val() || '',
+          tzOffset: tzOffset,
+          padding: btoa(genRandomString(5 + Math.floor(Math.random() * 15))),
+        }),
+      });
+
+      if (!response.ok) {
+        let result = await response.json();
+        throw new Error(result.error || response.statusText);
+      }
+      return response.blob();
+    }
+
     function readCodesBatch(data, lines, codes) {
       for (let i = 0; i < codes.length; i++) {
         let code = codes[i];
@@ -368,6 +435,10 @@
         $successTooMany.removeClass('d-none');
       }
       $receiptSuccess.text(total);
+      if (code.longCode) {
+        letterCodes.push({ uuid: code.uuid, longCode: code.longCode });
+        $downloadLetters.removeClass('d-none');
+      }
       $save.attr(
         'href',
         `${$save.attr('href')}${request['phone']},${request['testDate']},${request['symptomDate']},${
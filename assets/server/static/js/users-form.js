@@ -1,6 +1,6 @@
 (() => {
   window.addEventListener('load', () => {
-    let form = document.querySelector('form#users-form');
+    let form = document.querySelector('form#users-form, form#roles-form');
 
     if (form === null) {
       return;
@@ -8,6 +8,15 @@
 
     let permissionImpliedWarning = document.querySelector('span#permission-implied-warning');
 
+    // Individual permissions only apply when no role is selected.
+    let selectRole = form.querySelector('select#role-id');
+    let permissionsCustom = form.querySelector('div#permissions-custom');
+    if (selectRole !== null && permissionsCustom !== null) {
+      selectRole.addEventListener('change', (event) => {
+        permissionsCustom.classList.toggle('d-none', event.target.value !== '0');
+      });
+    }
+
     let inputPermissions = form.querySelectorAll('input[name=permissions]');
 
     inputPermissions.forEach((input) => {
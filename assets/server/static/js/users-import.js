@@ -1,7 +1,8 @@
 (() => {
   // batchSize is the number of individual requests to bundle into a single
-  // upstream API request.
-  const batchSize = 10;
+  // upstream API request. Each request creates a background job which imports
+  // its users.
+  const batchSize = 1000;
 
   window.addEventListener('DOMContentLoaded', () => {
     if (document.querySelector('body#users-import') === null) {
@@ -19,7 +20,7 @@
     let $progress = $('#progress');
     let $sendInvites = $('#sendInvites');
 
-    let totalUsersAdded = 0;
+    let totalUsersQueued = 0;
     let upload = readFile();
 
     $table.hide();
@@ -65,7 +66,7 @@
         let checked = $sendInvites.is(':checked');
         let rows = e.target.result.split('\n');
         let batch = [];
-        totalUsersAdded = 0;
+        totalUsersQueued = 0;
         $tableBody.empty();
         let i = 0;
         for (; i < rows.length && !cancelUpload; i++) {
@@ -81,8 +82,10 @@
             let cols = rows[i].split(',');
             user['email'] = cols[0].trim();
             user['name'] = cols.length > 1 ? cols[1].trim() : '';
+            user['expiresOn'] = cols.length > 2 ? cols[2].trim() : '';
 
-            let row = '<tr><td>' + user['email'] + '</td><td>' + user['name'] + '</td></tr>';
+            let row =
+              '<tr><td>' + user['email'] + '</td><td>' + user['name'] + '</td><td>' + user['expiresOn'] + '</td></tr>';
             $tableBody.append(row);
 
             batch.push(user);
@@ -93,7 +96,7 @@
             cancelUpload = await uploadWithRetries(() => uploadBatch(batch, checked));
             if (cancelUpload) {
               flash.warning(
-                'Successfully added ' + totalUsersAdded + ' users to realm.' + (rows.length - i) + ' remaining.'
+                'Queued ' + totalUsersQueued + ' users for import. ' + (rows.length - i) + ' remaining.'
               );
               break;
             }
@@ -105,7 +108,7 @@
         }
 
         if (!cancelUpload) {
-          flash.alert('Successfully added ' + totalUsersAdded + ' users to realm.');
+          flash.alert('Queued ' + totalUsersQueued + ' users for import. Follow the progress on the jobs page.');
         }
         $table.fadeOut(400);
         $import.prop('disabled', false);
@@ -127,13 +130,17 @@
       headers: { 'X-CSRF-Token': getCSRFToken() },
       contentType: 'application/json',
       success: function (result) {
-        totalUsersAdded += result.newUsers.length;
+        totalUsersQueued += result.queuedUsers;
         if (result.error) {
           flash.error(result.error);
         }
       },
       error: function (xhr, status, e) {
-        flash.error(e);
+        if (xhr.responseJSON && xhr.responseJSON.error) {
+          flash.error(xhr.responseJSON.error);
+        } else {
+          flash.error(e);
+        }
       },
     });
   }
@@ -0,0 +1,119 @@
+(() => {
+  window.addEventListener('load', () => {
+    const btnSignIn = document.querySelector('button[data-webauthn-sign-in]');
+    const formRegister = document.querySelector('form#webauthn-register-form');
+
+    if (btnSignIn === null && formRegister === null) {
+      return;
+    }
+
+    if (!window.PublicKeyCredential) {
+      if (btnSignIn !== null) {
+        btnSignIn.disabled = true;
+      }
+      if (formRegister !== null) {
+        formRegister.querySelector('button#webauthn-register').disabled = true;
+      }
+      flash.warning('This browser does not support security keys.');
+      return;
+    }
+
+    // Sign in with a registered security key.
+    if (btnSignIn !== null) {
+      const base = btnSignIn.getAttribute('data-webauthn-sign-in');
+
+      btnSignIn.addEventListener('click', async (event) => {
+        event.preventDefault();
+        btnSignIn.disabled = true;
+
+        try {
+          const options = await postJSON(`${base}/begin`, {});
+          options.challenge = decode(options.challenge);
+          options.allowCredentials.forEach((c) => c.id = decode(c.id));
+
+          const credential = await navigator.credentials.get({ publicKey: options });
+          await postJSON(`${base}/finish`, {
+            id: encode(credential.rawId),
+            clientDataJSON: encode(credential.response.clientDataJSON),
+            authenticatorData: encode(credential.response.authenticatorData),
+            signature: encode(credential.response.signature),
+          });
+
+          window.location.assign('/login/post-authenticate');
+        } catch (err) {
+          flash.clear();
+          flash.error(err.message);
+          btnSignIn.disabled = false;
+        }
+      });
+    }
+
+    // Register a new security key.
+    if (formRegister !== null) {
+      const base = formRegister.getAttribute('action');
+      const inputName = formRegister.querySelector('input#webauthn-name');
+      const btnRegister = formRegister.querySelector('button#webauthn-register');
+
+      formRegister.addEventListener('submit', async (event) => {
+        event.preventDefault();
+        btnRegister.disabled = true;
+
+        try {
+          const options = await postJSON(`${base}/begin`, {});
+          options.challenge = decode(options.challenge);
+          options.user.id = decode(options.user.id);
+          options.excludeCredentials.forEach((c) => c.id = decode(c.id));
+
+          const credential = await navigator.credentials.create({ publicKey: options });
+          await postJSON(`${base}/finish`, {
+            name: inputName.value,
+            response: {
+              id: encode(credential.rawId),
+              clientDataJSON: encode(credential.response.clientDataJSON),
+              attestationObject: encode(credential.response.attestationObject),
+            },
+          });
+
+          window.location.assign('/login/mfa/settings');
+        } catch (err) {
+          flash.clear();
+          flash.error(err.message);
+          btnRegister.disabled = false;
+        }
+      });
+    }
+
+    // postJSON posts the data and returns the parsed response. It throws the
+    // server's error message if the request fails.
+    async function postJSON(url, data) {
+      const response = await fetch(url, {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: {
+          'Content-Type': 'application/json',
+          'X-CSRF-Token': getCSRFToken(),
+        },
+        body: JSON.stringify(data),
+      });
+
+      const result = await response.json();
+      if (!response.ok) {
+        throw new Error(result.error || response.statusText);
+      }
+      return result;
+    }
+
+    // decode converts a base64url string to an ArrayBuffer.
+    function decode(s) {
+      const b64 = s.replace(/-/g, '+').replace(/_/g, '/');
+      const raw = atob(b64.padEnd(b64.length + (4 - b64.length % 4) % 4, '='));
+      return Uint8Array.from(raw, (c) => c.charCodeAt(0)).buffer;
+    }
+
+    // encode converts an ArrayBuffer to an unpadded base64url string.
+    function encode(buf) {
+      const raw = String.fromCharCode(...new Uint8Array(buf));
+      return btoa(raw).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+  });
+})();
@@ -0,0 +1,165 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This server processes background jobs, such as user imports, bulk
+// permission changes, and codes bulk issued through the admin API. The server
+// itself is unauthenticated and should not be deployed as a public service.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/exposure-notifications-verification-server/assets"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/internal/buildinfo"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/jobworker"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-server/pkg/server"
+
+	"github.com/gorilla/mux"
+)
+
+func main() {
+	ctx, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	logger := logging.NewLoggerFromEnv().
+		With("build_id", buildinfo.BuildID).
+		With("build_tag", buildinfo.BuildTag)
+	ctx = logging.WithLogger(ctx, logger)
+
+	defer func() {
+		done()
+		if r := recover(); r != nil {
+			logger.Fatalw("application panic", "panic", r)
+		}
+	}()
+
+	err := realMain(ctx)
+	done()
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Info("successful shutdown")
+}
+
+func realMain(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+
+	cfg, err := config.NewJobWorkerConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to process config: %w", err)
+	}
+
+	// Setup monitoring
+	logger.Info("configuring observability exporter")
+	oeConfig := cfg.ObservabilityExporterConfig()
+	oe, err := observability.NewFromEnv(ctx, oeConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create ObservabilityExporter provider: %w", err)
+	}
+	if err := oe.StartExporter(); err != nil {
+		return fmt.Errorf("error initializing observability exporter: %w", err)
+	}
+	defer oe.Close()
+	ctx, obs := middleware.WithObservability(ctx)
+	logger.Infow("observability exporter", "config", oeConfig)
+
+	// Setup database
+	db, err := cfg.Database.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load database config: %w", err)
+	}
+	if err := db.Open(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	// Setup signers
+	smsSigner, err := keys.KeyManagerFor(ctx, &cfg.SMSSigning.Keys)
+	if err != nil {
+		return fmt.Errorf("failed to create sms key manager: %w", err)
+	}
+
+	// Setup rate limiter, which enforces realm quotas
+	limiterStore, err := ratelimit.RateLimiterFor(ctx, &cfg.RateLimit)
+	if err != nil {
+		return fmt.Errorf("failed to create limiter: %w", err)
+	}
+	defer limiterStore.Close(ctx)
+
+	// Setup auth provider, which creates imported users
+	var authProvider auth.Provider
+	if cfg.Auth.PasswordAuth() {
+		authProvider, err = auth.NewPassword(ctx, db, cfg.PasswordAuthConfig())
+		if err != nil {
+			return fmt.Errorf("failed to create password auth provider: %w", err)
+		}
+	} else {
+		authProvider, err = auth.NewFirebase(ctx, cfg.FirebaseConfig())
+		if err != nil {
+			return fmt.Errorf("failed to create firebase auth provider: %w", err)
+		}
+	}
+
+	// Create the renderer. This includes the server templates, which are used to
+	// send invitations to imported users.
+	h, err := render.New(ctx, assets.ServerFS(), cfg.DevMode)
+	if err != nil {
+		return fmt.Errorf("failed to create renderer: %w", err)
+	}
+
+	// Create the router
+	r := mux.NewRouter()
+
+	// Common observability context
+	r.Use(obs)
+
+	// Request ID injection
+	populateRequestID := middleware.PopulateRequestID(h)
+	r.Use(populateRequestID)
+
+	// Logger injection
+	populateLogger := middleware.PopulateLogger(logger)
+	r.Use(populateLogger)
+
+	// Recovery injection
+	recovery := middleware.Recovery(h)
+	r.Use(recovery)
+
+	issueapiController := issueapi.New(cfg, db, limiterStore, smsSigner, h)
+	importer := user.NewImporter(authProvider, db, h)
+	jobWorkerController := jobworker.New(cfg, db, issueapiController, importer, h)
+	r.Handle("/", jobWorkerController.HandleProcess()).Methods(http.MethodPost)
+
+	srv, err := server.New(cfg.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	logger.Infow("server listening", "port", cfg.Port)
+	return srv.ServeHTTPHandler(ctx, r)
+}
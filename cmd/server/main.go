@@ -116,9 +116,21 @@ func realMain(ctx context.Context) error {
 	defer limiterStore.Close(ctx)
 
 	// Setup auth provider
-	authProvider, err := auth.NewFirebase(ctx, cfg.FirebaseConfig())
+	var authProvider auth.Provider
+	if cfg.Auth.PasswordAuth() {
+		authProvider, err = auth.NewPassword(ctx, db, cfg.PasswordAuthConfig())
+		if err != nil {
+			return fmt.Errorf("failed to create password auth provider: %w", err)
+		}
+	} else {
+		authProvider, err = auth.NewFirebase(ctx, cfg.FirebaseConfig())
+		if err != nil {
+			return fmt.Errorf("failed to create firebase auth provider: %w", err)
+		}
+	}
+	authProvider, err = auth.NewOIDC(ctx, authProvider)
 	if err != nil {
-		return fmt.Errorf("failed to create firebase auth provider: %w", err)
+		return fmt.Errorf("failed to create oidc auth provider: %w", err)
 	}
 
 	// Setup routes
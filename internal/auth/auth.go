@@ -88,6 +88,34 @@ type Provider interface {
 	MFAEnabled(context.Context, *sessions.Session) (bool, error)
 }
 
+// NativeMFAProvider is implemented by providers which do not have their own
+// second factor. For these providers, the server challenges the user for a
+// second factor it stores itself, and records the result in the session.
+type NativeMFAProvider interface {
+	// NativeMFA returns true if the second factor for this session is verified
+	// by the server instead of the upstream identity provider.
+	NativeMFA(context.Context, *sessions.Session) bool
+
+	// StoreMFAVerified records that the user completed a second factor
+	// challenge. Afterwards, MFAEnabled returns true for the session.
+	StoreMFAVerified(context.Context, *sessions.Session) error
+}
+
+// NativeMFA returns true if the provider implements NativeMFAProvider and the
+// session's second factor is verified by the server.
+func NativeMFA(ctx context.Context, p Provider, session *sessions.Session) bool {
+	n, ok := p.(NativeMFAProvider)
+	return ok && n.NativeMFA(ctx, session)
+}
+
+// EmailVerifier is implemented by providers which verify email addresses on
+// the server. For other providers, the browser applies the verification code.
+type EmailVerifier interface {
+	// VerifyEmail uses the email verification code. It returns the email address
+	// which was verified.
+	VerifyEmail(ctx context.Context, code string) (string, error)
+}
+
 // SessionInfo is a generic struct used to store session information. Not all
 // providers use all fields.
 type SessionInfo struct {
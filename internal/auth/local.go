@@ -164,6 +164,28 @@ func (a *localAuth) MFAEnabled(ctx context.Context, session *sessions.Session) (
 	return data.MFAEnabled, nil
 }
 
+// NativeMFA returns true if the session was created by this provider. Local
+// auth has no second factor of its own.
+func (a *localAuth) NativeMFA(ctx context.Context, session *sessions.Session) bool {
+	_, err := sessionGet(session, sessionKeyLocalCookie)
+	return err == nil
+}
+
+// StoreMFAVerified marks the session as having completed a second factor.
+func (a *localAuth) StoreMFAVerified(ctx context.Context, session *sessions.Session) error {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return err
+	}
+	data.MFAEnabled = true
+
+	cookie, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return sessionSet(session, sessionKeyLocalCookie, string(cookie))
+}
+
 // ChangePassword changes the users password. The data is not used. Since local
 // auth does not use passwords, this is a noop.
 func (a *localAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
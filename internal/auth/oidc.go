@@ -0,0 +1,268 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	sessionKeyOIDCCookie = sessionKey("oidcCookie")
+
+	// OIDCIdentityKey is the SessionInfo data key of an *OIDCIdentity.
+	OIDCIdentityKey = "oidc_identity"
+)
+
+// OIDCIdentity is a user identity which was verified by an OpenID Connect
+// identity provider.
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	MFAEnabled    bool
+}
+
+type oidcAuth struct {
+	next Provider
+}
+
+// NewOIDC returns an auth provider which stores sessions for users who signed
+// in with an OpenID Connect identity provider. The identity must already be
+// verified, and is passed to StoreSession under OIDCIdentityKey. All other
+// sessions, and all password and invitation operations, are handled by next.
+func NewOIDC(ctx context.Context, next Provider) (Provider, error) {
+	if next == nil {
+		return nil, fmt.Errorf("missing auth provider")
+	}
+	return &oidcAuth{next: next}, nil
+}
+
+// StoreSession stores information about the session. If the session info does
+// not contain an OIDC identity, it is passed to the next provider.
+func (a *oidcAuth) StoreSession(ctx context.Context, session *sessions.Session, i *SessionInfo) error {
+	var identity *OIDCIdentity
+	if i != nil && i.Data != nil {
+		identity, _ = i.Data[OIDCIdentityKey].(*OIDCIdentity)
+	}
+
+	if identity == nil {
+		sessionClear(session, sessionKeyOIDCCookie)
+		return a.next.StoreSession(ctx, session, i)
+	}
+
+	a.next.ClearSession(ctx, session)
+
+	if identity.Email == "" {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing email: %w", ErrSessionInfoMissing)
+	}
+
+	cookie, err := json.Marshal(&oidcCookieData{
+		Issuer:        identity.Issuer,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		MFAEnabled:    identity.MFAEnabled,
+		ExpiresAt:     time.Now().Add(i.TTL).Unix(),
+	})
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	if err := sessionSet(session, sessionKeyOIDCCookie, string(cookie)); err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+	return nil
+}
+
+// CheckRevoked checks if the session has expired. Identity providers do not
+// offer a standard way to check for revocation, so sessions last until their
+// TTL.
+func (a *oidcAuth) CheckRevoked(ctx context.Context, session *sessions.Session) error {
+	if !a.hasCookie(session) {
+		return a.next.CheckRevoked(ctx, session)
+	}
+
+	if _, err := a.loadCookie(ctx, session); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearSession removes any session information for this auth and the next
+// provider.
+func (a *oidcAuth) ClearSession(ctx context.Context, session *sessions.Session) {
+	sessionClear(session, sessionKeyOIDCCookie)
+	a.next.ClearSession(ctx, session)
+}
+
+// RevokeSession clears the session. Signing out of the identity provider is
+// left to the user.
+func (a *oidcAuth) RevokeSession(ctx context.Context, session *sessions.Session) error {
+	if !a.hasCookie(session) {
+		return a.next.RevokeSession(ctx, session)
+	}
+
+	a.ClearSession(ctx, session)
+	return nil
+}
+
+// CreateUser creates the user in the next provider.
+func (a *oidcAuth) CreateUser(ctx context.Context, name, email, pass string, sendInvite bool, emailer InviteUserEmailFunc) (bool, error) {
+	return a.next.CreateUser(ctx, name, email, pass, sendInvite, emailer)
+}
+
+// SendResetPasswordEmail sends the password reset from the next provider.
+func (a *oidcAuth) SendResetPasswordEmail(ctx context.Context, email string, emailer ResetPasswordEmailFunc) error {
+	return a.next.SendResetPasswordEmail(ctx, email, emailer)
+}
+
+// ChangePassword changes the password in the next provider.
+func (a *oidcAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
+	return a.next.ChangePassword(ctx, newPassword, data)
+}
+
+// VerifyPasswordResetCode verifies the code with the next provider.
+func (a *oidcAuth) VerifyPasswordResetCode(ctx context.Context, code string) (string, error) {
+	return a.next.VerifyPasswordResetCode(ctx, code)
+}
+
+// SendEmailVerificationEmail sends the email verification from the next
+// provider.
+func (a *oidcAuth) SendEmailVerificationEmail(ctx context.Context, email string, data interface{}, emailer EmailVerificationEmailFunc) error {
+	return a.next.SendEmailVerificationEmail(ctx, email, data, emailer)
+}
+
+// EmailAddress extracts the users email from the session.
+func (a *oidcAuth) EmailAddress(ctx context.Context, session *sessions.Session) (string, error) {
+	if !a.hasCookie(session) {
+		return a.next.EmailAddress(ctx, session)
+	}
+
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.Email, nil
+}
+
+// EmailVerified returns true if the identity provider reported the email
+// address as verified.
+func (a *oidcAuth) EmailVerified(ctx context.Context, session *sessions.Session) (bool, error) {
+	if !a.hasCookie(session) {
+		return a.next.EmailVerified(ctx, session)
+	}
+
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	return data.EmailVerified, nil
+}
+
+// MFAEnabled returns true if the user signed in to the identity provider with
+// a second factor.
+func (a *oidcAuth) MFAEnabled(ctx context.Context, session *sessions.Session) (bool, error) {
+	if !a.hasCookie(session) {
+		return a.next.MFAEnabled(ctx, session)
+	}
+
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	return data.MFAEnabled, nil
+}
+
+// NativeMFA returns false for sessions from an identity provider, which
+// enforces its own second factor. Other sessions are passed to the next
+// provider.
+func (a *oidcAuth) NativeMFA(ctx context.Context, session *sessions.Session) bool {
+	if a.hasCookie(session) {
+		return false
+	}
+	return NativeMFA(ctx, a.next, session)
+}
+
+// StoreMFAVerified passes the session to the next provider. It returns an
+// error for sessions from an identity provider.
+func (a *oidcAuth) StoreMFAVerified(ctx context.Context, session *sessions.Session) error {
+	n, ok := a.next.(NativeMFAProvider)
+	if a.hasCookie(session) || !ok {
+		return fmt.Errorf("provider does not support native mfa")
+	}
+	return n.StoreMFAVerified(ctx, session)
+}
+
+// VerifyEmail passes the code to the next provider, if it verifies email
+// addresses on the server.
+func (a *oidcAuth) VerifyEmail(ctx context.Context, code string) (string, error) {
+	v, ok := a.next.(EmailVerifier)
+	if !ok {
+		return "", fmt.Errorf("provider does not support email verification")
+	}
+	return v.VerifyEmail(ctx, code)
+}
+
+type oidcCookieData struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	ExpiresAt     int64  `json:"exp"`
+}
+
+// hasCookie returns true if the session was created by this provider.
+func (a *oidcAuth) hasCookie(session *sessions.Session) bool {
+	_, err := sessionGet(session, sessionKeyOIDCCookie)
+	return err == nil
+}
+
+// loadCookie loads and parses the cookie from the session. Expired cookies are
+// cleared.
+func (a *oidcAuth) loadCookie(ctx context.Context, session *sessions.Session) (*oidcCookieData, error) {
+	raw, err := sessionGet(session, sessionKeyOIDCCookie)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+
+	cookie, ok := raw.(string)
+	if !ok || cookie == "" {
+		a.ClearSession(ctx, session)
+		return nil, ErrSessionMissing
+	}
+
+	var data oidcCookieData
+	if err := json.Unmarshal([]byte(cookie), &data); err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+
+	if time.Now().Unix() > data.ExpiresAt {
+		a.ClearSession(ctx, session)
+		return nil, fmt.Errorf("session expired")
+	}
+	return &data, nil
+}
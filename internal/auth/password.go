@@ -0,0 +1,567 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/sessions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionKeyPasswordCookie = sessionKey("passwordCookie")
+
+	// MinPasswordHashCost and MaxPasswordHashCost are the bounds of the bcrypt
+	// cost of password hashes.
+	MinPasswordHashCost = bcrypt.MinCost
+	MaxPasswordHashCost = bcrypt.MaxCost
+
+	// maxPasswordBytes is the longest password bcrypt can hash. Longer passwords
+	// would be silently truncated.
+	maxPasswordBytes = 72
+)
+
+var (
+	// ErrInvalidCredentials is returned when the email address or password is
+	// incorrect. It does not reveal which one.
+	ErrInvalidCredentials = errors.New("invalid email address or password")
+
+	// ErrAccountLocked is returned when sign-in is refused because of too many
+	// failed attempts.
+	ErrAccountLocked = errors.New("account is temporarily locked because of too many failed sign-in attempts")
+)
+
+// PasswordConfig is the configuration for the password auth provider.
+type PasswordConfig struct {
+	// Endpoint is the server endpoint (scheme + host [+ port]) for the links in
+	// emails.
+	Endpoint string
+
+	// HashCost is the bcrypt cost of new password hashes.
+	HashCost int
+
+	// MaxFailedLogins is the number of consecutive failed sign-in attempts after
+	// which the account is locked for LockoutDuration. 0 disables lockout.
+	MaxFailedLogins uint
+	LockoutDuration time.Duration
+
+	// PasswordResetTTL, InvitationTTL, and EmailVerificationTTL are how long the
+	// links in the respective emails are valid.
+	PasswordResetTTL     time.Duration
+	InvitationTTL        time.Duration
+	EmailVerificationTTL time.Duration
+}
+
+// CurrentPassword is the ChangePassword data for a signed-in user, who
+// confirms the change with their current password instead of a reset code. If
+// Session is given, it remains valid after the change; all other sessions of
+// the user are revoked.
+type CurrentPassword struct {
+	Session  *sessions.Session
+	Email    string
+	Password string
+}
+
+type passwordAuth struct {
+	db     *database.Database
+	config *PasswordConfig
+
+	// dummyHash is compared against when the account does not exist or has no
+	// password, so that failed sign-ins take the same time either way.
+	dummyHash []byte
+}
+
+// NewPassword creates a new auth provider which stores password hashes in the
+// database. Password reset, invitation, and email verification links are sent
+// with the email composers from the caller, so it does not depend on any
+// external identity service.
+func NewPassword(ctx context.Context, db *database.Database, config *PasswordConfig) (Provider, error) {
+	if db == nil {
+		return nil, fmt.Errorf("missing database")
+	}
+	if config == nil {
+		return nil, fmt.Errorf("missing config")
+	}
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("missing endpoint")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate dummy password: %w", err)
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword(b[:24], config.HashCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+
+	return &passwordAuth{
+		db:        db,
+		config:    config,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// CheckRevoked checks if the session has expired or was revoked, for example
+// by a password change or by signing out elsewhere.
+func (a *passwordAuth) CheckRevoked(ctx context.Context, session *sessions.Session) error {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(data.ExpiresAt) {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("session expired")
+	}
+
+	credential, err := a.db.FindUserCredential(data.UserID)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if credential.SessionRevoked(data.IssuedAt) || credential.Email != data.Email {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("session is revoked")
+	}
+	return nil
+}
+
+// StoreSession verifies the email address and password in the session info
+// and stores the session. Failed attempts count towards the account lockout.
+func (a *passwordAuth) StoreSession(ctx context.Context, session *sessions.Session, i *SessionInfo) error {
+	if i == nil || i.Data == nil {
+		a.ClearSession(ctx, session)
+		return ErrSessionInfoMissing
+	}
+
+	email, ok := i.Data["email"].(string)
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing email: %w", ErrSessionInfoMissing)
+	}
+
+	password, ok := i.Data["password"].(string)
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing password: %w", ErrSessionInfoMissing)
+	}
+
+	credential, err := a.authenticate(ctx, email, password)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	now := time.Now().UTC()
+	return a.storeCookie(ctx, session, &passwordCookieData{
+		UserID:    credential.UserID,
+		Email:     credential.Email,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(i.TTL),
+	})
+}
+
+// ClearSession removes any session information for this auth.
+func (a *passwordAuth) ClearSession(ctx context.Context, session *sessions.Session) {
+	sessionClear(session, sessionKeyPasswordCookie)
+}
+
+// RevokeSession revokes all of the user's sessions, on all devices.
+func (a *passwordAuth) RevokeSession(ctx context.Context, session *sessions.Session) error {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	if err := a.db.RevokeUserSessions(data.UserID, revocationTime(time.Now())); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	a.ClearSession(ctx, session)
+	return nil
+}
+
+// CreateUser sets up the password credential of the user, who must already
+// exist in the database. It returns true if the user did not have a password
+// yet, or false if the user already has one. If pass is "", the user selects a
+// password with the link in the invitation.
+func (a *passwordAuth) CreateUser(ctx context.Context, name, email, pass string, sendInvite bool, emailer InviteUserEmailFunc) (bool, error) {
+	user, err := a.db.FindUserByEmail(email)
+	if err != nil {
+		return false, fmt.Errorf("failed to find user %s: %w", email, err)
+	}
+
+	credential, err := a.db.FindUserCredential(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to find user credential: %w", err)
+	}
+
+	if credential.PasswordHash != "" {
+		return false, nil
+	}
+
+	if pass != "" {
+		if err := a.setPassword(user, pass, time.Now()); err != nil {
+			return false, err
+		}
+	}
+
+	if !sendInvite {
+		return true, nil
+	}
+
+	if emailer == nil {
+		return true, fmt.Errorf("failed to send new user invitation email: no email provider is configured")
+	}
+
+	inviteLink, err := a.passwordResetLink(user, a.config.InvitationTTL)
+	if err != nil {
+		return true, err
+	}
+
+	if err := emailer(ctx, inviteLink); err != nil {
+		return true, fmt.Errorf("failed to send new user invitation email: %w", err)
+	}
+
+	return true, nil
+}
+
+// EmailAddress extracts the users email from the session.
+func (a *passwordAuth) EmailAddress(ctx context.Context, session *sessions.Session) (string, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.Email, nil
+}
+
+// EmailVerified returns true if the current user is verified, false otherwise.
+func (a *passwordAuth) EmailVerified(ctx context.Context, session *sessions.Session) (bool, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+
+	credential, err := a.db.FindUserCredential(data.UserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to find user credential: %w", err)
+	}
+	return credential.EmailVerified, nil
+}
+
+// MFAEnabled returns true if the session completed a second factor challenge.
+func (a *passwordAuth) MFAEnabled(ctx context.Context, session *sessions.Session) (bool, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	return data.MFAVerified, nil
+}
+
+// NativeMFA returns true if the session was created by this provider. Password
+// auth has no second factor of its own.
+func (a *passwordAuth) NativeMFA(ctx context.Context, session *sessions.Session) bool {
+	_, err := sessionGet(session, sessionKeyPasswordCookie)
+	return err == nil
+}
+
+// StoreMFAVerified marks the session as having completed a second factor.
+func (a *passwordAuth) StoreMFAVerified(ctx context.Context, session *sessions.Session) error {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return err
+	}
+	data.MFAVerified = true
+	return a.storeCookie(ctx, session, data)
+}
+
+// ChangePassword changes the users password. The data must be a password
+// reset code as a string, or a *CurrentPassword. Either way, all other
+// sessions of the user are revoked.
+func (a *passwordAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
+	now := time.Now()
+
+	switch t := data.(type) {
+	case string:
+		user, err := a.db.UseUserToken(database.UserTokenPurposePasswordReset, t)
+		if err != nil {
+			return err
+		}
+
+		if err := a.setPassword(user, newPassword, now); err != nil {
+			return err
+		}
+
+		// The reset link was delivered to the email address, which proves
+		// ownership.
+		credential, err := a.db.FindUserCredential(user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to find user credential: %w", err)
+		}
+		if !credential.EmailVerified {
+			if err := a.db.MarkUserEmailVerified(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *CurrentPassword:
+		if t == nil {
+			return fmt.Errorf("missing current password")
+		}
+
+		credential, err := a.authenticate(ctx, t.Email, t.Password)
+		if err != nil {
+			return err
+		}
+
+		user, err := a.db.FindUser(credential.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		if err := a.setPassword(user, newPassword, now); err != nil {
+			return err
+		}
+
+		// Keep the current session, which would otherwise be revoked with all
+		// the others.
+		if t.Session != nil {
+			cookie, err := a.loadCookie(ctx, t.Session)
+			if err != nil {
+				return err
+			}
+			cookie.IssuedAt = revocationTime(now)
+			if err := a.storeCookie(ctx, t.Session, cookie); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("missing or invalid password change data")
+	}
+}
+
+// SendResetPasswordEmail sends a password reset link to the given user. If the
+// user does not exist, an error is returned.
+func (a *passwordAuth) SendResetPasswordEmail(ctx context.Context, email string, emailer ResetPasswordEmailFunc) error {
+	if emailer == nil {
+		return fmt.Errorf("failed to send password reset email: no email provider is configured")
+	}
+
+	user, err := a.db.FindUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("failed to find user %s: %w", email, err)
+	}
+
+	resetLink, err := a.passwordResetLink(user, a.config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := emailer(ctx, resetLink); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyPasswordResetCode verifies the code is valid, without using it. It
+// returns the email of the user for which the code belongs.
+func (a *passwordAuth) VerifyPasswordResetCode(ctx context.Context, code string) (string, error) {
+	user, err := a.db.FindUserByToken(database.UserTokenPurposePasswordReset, code)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// SendEmailVerificationEmail sends a message to the user, asking them to
+// verify ownership of the email address. The data is not used.
+func (a *passwordAuth) SendEmailVerificationEmail(ctx context.Context, email string, data interface{}, emailer EmailVerificationEmailFunc) error {
+	if emailer == nil {
+		return fmt.Errorf("failed to send email verification email: no email provider is configured")
+	}
+
+	user, err := a.db.FindUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("failed to find user %s: %w", email, err)
+	}
+
+	token, err := a.db.CreateUserToken(user, database.UserTokenPurposeEmailVerification, a.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := emailer(ctx, a.manageAccountLink("verifyEmail", token)); err != nil {
+		return fmt.Errorf("failed to send email verification email: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail uses the email verification code and marks the user's email
+// address as verified.
+func (a *passwordAuth) VerifyEmail(ctx context.Context, code string) (string, error) {
+	user, err := a.db.UseUserToken(database.UserTokenPurposeEmailVerification, code)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.db.MarkUserEmailVerified(user); err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// authenticate verifies the password of the user with the given email
+// address. Failed attempts count towards the account lockout.
+func (a *passwordAuth) authenticate(ctx context.Context, email, password string) (*database.UserCredential, error) {
+	credential, err := a.db.FindUserCredentialByEmail(email)
+	if err != nil {
+		if !database.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to find user credential: %w", err)
+		}
+
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if credential.Locked(now) {
+		return nil, ErrAccountLocked
+	}
+
+	if credential.PasswordHash == "" {
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(credential.PasswordHash), []byte(password)); err != nil {
+		lockedUntil, err := a.db.RecordFailedLogin(credential.UserID, a.config.MaxFailedLogins, a.config.LockoutDuration, now)
+		if err != nil {
+			return nil, err
+		}
+		if lockedUntil != nil {
+			return nil, ErrAccountLocked
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if credential.FailedLoginAttempts > 0 {
+		if err := a.db.RecordSuccessfulLogin(credential.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return credential, nil
+}
+
+// setPassword hashes and saves the password, which revokes all existing
+// sessions as of now.
+func (a *passwordAuth) setPassword(user *database.User, password string, now time.Time) error {
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.config.HashCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := a.db.SetUserPassword(user, string(hash), revocationTime(now)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// passwordResetLink creates a password reset code which expires after ttl and
+// returns the link to select a new password.
+func (a *passwordAuth) passwordResetLink(user *database.User, ttl time.Duration) (string, error) {
+	token, err := a.db.CreateUserToken(user, database.UserTokenPurposePasswordReset, ttl)
+	if err != nil {
+		return "", err
+	}
+	return a.manageAccountLink("resetPassword", token), nil
+}
+
+// manageAccountLink builds the account management link for the mode and code.
+// The format is the same as for firebase, so the same routes handle both.
+func (a *passwordAuth) manageAccountLink(mode, code string) string {
+	q := url.Values{}
+	q.Set("mode", mode)
+	q.Set("oobCode", code)
+	return strings.TrimSuffix(a.config.Endpoint, "/") + "/login/manage-account?" + q.Encode()
+}
+
+// revocationTime is the given time at the precision stored in the database, so
+// that sessions issued at the time of a revocation compare equal to it.
+func revocationTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+type passwordCookieData struct {
+	UserID      uint      `json:"user_id"`
+	Email       string    `json:"email"`
+	IssuedAt    time.Time `json:"issued_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	MFAVerified bool      `json:"mfa_verified"`
+}
+
+// storeCookie encodes the cookie data in the session.
+func (a *passwordAuth) storeCookie(ctx context.Context, session *sessions.Session, data *passwordCookieData) error {
+	cookie, err := json.Marshal(data)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	if err := sessionSet(session, sessionKeyPasswordCookie, string(cookie)); err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+	return nil
+}
+
+// loadCookie loads and parses the password cookie from the session.
+func (a *passwordAuth) loadCookie(ctx context.Context, session *sessions.Session) (*passwordCookieData, error) {
+	raw, err := sessionGet(session, sessionKeyPasswordCookie)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+
+	cookie, ok := raw.(string)
+	if !ok || cookie == "" {
+		a.ClearSession(ctx, session)
+		return nil, ErrSessionMissing
+	}
+
+	var data passwordCookieData
+	if err := json.Unmarshal([]byte(cookie), &data); err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+	return &data, nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/sessions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testDatabaseInstance *database.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = database.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+// newTestPassword creates a password provider and a user with the given
+// password.
+func newTestPassword(tb testing.TB, password string) (Provider, *database.Database, *database.User) {
+	tb.Helper()
+
+	ctx := project.TestContext(tb)
+	db, _ := testDatabaseInstance.NewDatabase(tb, nil)
+
+	provider, err := NewPassword(ctx, db, &PasswordConfig{
+		Endpoint:             "https://example.com",
+		HashCost:             bcrypt.MinCost,
+		MaxFailedLogins:      3,
+		LockoutDuration:      time.Hour,
+		PasswordResetTTL:     time.Hour,
+		InvitationTTL:        time.Hour,
+		EmailVerificationTTL: time.Hour,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	user := &database.User{Email: "user@example.com", Name: "User"}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	if _, err := provider.CreateUser(ctx, user.Name, user.Email, password, false, nil); err != nil {
+		tb.Fatal(err)
+	}
+	return provider, db, user
+}
+
+// signIn stores a new session with the email address and password.
+func signIn(ctx context.Context, provider Provider, email, password string) (*sessions.Session, error) {
+	session := &sessions.Session{}
+	err := provider.StoreSession(ctx, session, &SessionInfo{
+		Data: map[string]interface{}{
+			"email":    email,
+			"password": password,
+		},
+		TTL: time.Hour,
+	})
+	return session, err
+}
+
+// codeFromLink extracts the oobCode from an account management link.
+func codeFromLink(tb testing.TB, link string) string {
+	tb.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	code := u.Query().Get("oobCode")
+	if code == "" {
+		tb.Fatalf("missing code in %q", link)
+	}
+	return code
+}
+
+func TestPasswordAuth_StoreSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	provider, _, user := newTestPassword(t, "Passw0rd!")
+
+	t.Run("unknown_user", func(t *testing.T) {
+		if _, err := signIn(ctx, provider, "nobody@example.com", "Passw0rd!"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("expected %v to be %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		session, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := provider.CheckRevoked(ctx, session); err != nil {
+			t.Errorf("expected session to be valid: %v", err)
+		}
+
+		email, err := provider.EmailAddress(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := email, user.Email; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		if !NativeMFA(ctx, provider, session) {
+			t.Errorf("expected native mfa")
+		}
+	})
+
+	// Runs last, since it locks the account.
+	t.Run("lockout", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := signIn(ctx, provider, user.Email, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected %v to be %v", err, ErrInvalidCredentials)
+			}
+		}
+
+		if _, err := signIn(ctx, provider, user.Email, "wrong"); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("expected %v to be %v", err, ErrAccountLocked)
+		}
+
+		// The correct password is refused while the account is locked.
+		if _, err := signIn(ctx, provider, user.Email, "Passw0rd!"); !errors.Is(err, ErrAccountLocked) {
+			t.Errorf("expected %v to be %v", err, ErrAccountLocked)
+		}
+	})
+}
+
+func TestPasswordAuth_RevokeSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	provider, _, user := newTestPassword(t, "Passw0rd!")
+
+	session, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.RevokeSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing out revokes the sessions on all devices.
+	if err := provider.CheckRevoked(ctx, other); err == nil {
+		t.Errorf("expected session to be revoked")
+	}
+
+	// New sessions are still valid.
+	session, err = signIn(ctx, provider, user.Email, "Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CheckRevoked(ctx, session); err != nil {
+		t.Errorf("expected session to be valid: %v", err)
+	}
+}
+
+func TestPasswordAuth_ChangePassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	t.Run("current_password", func(t *testing.T) {
+		t.Parallel()
+
+		provider, _, user := newTestPassword(t, "Passw0rd!")
+
+		session, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := provider.ChangePassword(ctx, "N3wPassw0rd!", &CurrentPassword{
+			Session:  session,
+			Email:    user.Email,
+			Password: "wrong",
+		}); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected %v to be %v", err, ErrInvalidCredentials)
+		}
+
+		if err := provider.ChangePassword(ctx, "N3wPassw0rd!", &CurrentPassword{
+			Session:  session,
+			Email:    user.Email,
+			Password: "Passw0rd!",
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := provider.CheckRevoked(ctx, session); err != nil {
+			t.Errorf("expected current session to be valid: %v", err)
+		}
+		if err := provider.CheckRevoked(ctx, other); err == nil {
+			t.Errorf("expected other session to be revoked")
+		}
+
+		if _, err := signIn(ctx, provider, user.Email, "N3wPassw0rd!"); err != nil {
+			t.Errorf("expected new password to work: %v", err)
+		}
+	})
+
+	t.Run("reset_code", func(t *testing.T) {
+		t.Parallel()
+
+		provider, db, user := newTestPassword(t, "")
+
+		var link string
+		if err := provider.SendResetPasswordEmail(ctx, user.Email, func(ctx context.Context, resetLink string) error {
+			link = resetLink
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		code := codeFromLink(t, link)
+
+		email, err := provider.VerifyPasswordResetCode(ctx, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := email, user.Email; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		if err := provider.ChangePassword(ctx, "N3wPassw0rd!", code); err != nil {
+			t.Fatal(err)
+		}
+
+		// Codes are single use.
+		if err := provider.ChangePassword(ctx, "Anoth3rPassw0rd!", code); !errors.Is(err, database.ErrInvalidUserToken) {
+			t.Errorf("expected %v to be %v", err, database.ErrInvalidUserToken)
+		}
+
+		session, err := signIn(ctx, provider, user.Email, "N3wPassw0rd!")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The reset link proves ownership of the email address.
+		verified, err := provider.EmailVerified(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verified {
+			t.Errorf("expected email to be verified")
+		}
+
+		credential, err := db.FindUserCredential(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credential.PasswordHash == "N3wPassw0rd!" {
+			t.Errorf("expected password to be hashed")
+		}
+	})
+}
+
+func TestPasswordAuth_VerifyEmail(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	provider, _, user := newTestPassword(t, "Passw0rd!")
+
+	session, err := signIn(ctx, provider, user.Email, "Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var link string
+	if err := provider.SendEmailVerificationEmail(ctx, user.Email, nil, func(ctx context.Context, verifyLink string) error {
+		link = verifyLink
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, ok := provider.(EmailVerifier)
+	if !ok {
+		t.Fatal("expected provider to verify email addresses")
+	}
+	if _, err := verifier.VerifyEmail(ctx, codeFromLink(t, link)); err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := provider.EmailVerified(ctx, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Errorf("expected email to be verified")
+	}
+}
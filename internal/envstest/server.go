@@ -206,6 +206,10 @@ func NewServerConfig(tb testing.TB, testDatabaseInstance *database.TestInstance)
 	if err != nil {
 		tb.Fatal(err)
 	}
+	authProvider, err = auth.NewOIDC(ctx, authProvider)
+	if err != nil {
+		tb.Fatal(err)
+	}
 
 	signingKeyManager, ok := harness.KeyManager.(keys.SigningKeyManager)
 	if !ok {
@@ -24,10 +24,15 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/apikey"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/codes"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/jobs"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/mobileapps"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/scim"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/stats"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
@@ -78,6 +83,17 @@ func AdminAPI(
 	}
 	rateLimit := httplimiter.Handle
 
+	// API keys with a configured rate limit are also limited individually. This
+	// must come after the API key is loaded.
+	apiKeyLimiter, err := limitware.NewMiddleware(ctx, limiterStore,
+		limitware.AuthorizedAppKeyFunc(ctx, "adminapi:ratelimit:", cfg.RateLimit.HMACKey),
+		limitware.AuthorizedAppLimit(db),
+		limitware.AllowOnError(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key limiter middleware: %w", err)
+	}
+	apiKeyRateLimit := apiKeyLimiter.Handle
+
 	// Install common security headers
 	r.Use(middleware.SecureHeaders(cfg.DevMode, "json"))
 
@@ -102,15 +118,85 @@ func AdminAPI(
 		sub := r.PathPrefix("/api").Subrouter()
 		sub.Use(requireAdminAPIKey)
 		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
 		sub.Use(processFirewall)
 
+		// Scoped API keys can only use the endpoints of their scopes.
+		issueScope := middleware.RequireAPIKeyScope(h, database.APIKeyScopeIssue)
+		batchIssueScope := middleware.RequireAPIKeyScope(h, database.APIKeyScopeBatchIssue)
+		checkCodeStatusScope := middleware.RequireAPIKeyScope(h, database.APIKeyScopeCheckCodeStatus)
+		expireCodeScope := middleware.RequireAPIKeyScope(h, database.APIKeyScopeExpireCode)
+
 		issueapiController := issueapi.New(cfg, db, limiterStore, smsSigner, h)
-		sub.Handle("/issue", issueapiController.HandleIssueAPI()).Methods(http.MethodPost)
-		sub.Handle("/batch-issue", issueapiController.HandleBatchIssueAPI()).Methods(http.MethodPost)
+		sub.Handle("/issue", issueScope(issueapiController.HandleIssueAPI())).Methods(http.MethodPost)
+		sub.Handle("/batch-issue", batchIssueScope(issueapiController.HandleBatchIssueAPI())).Methods(http.MethodPost)
+		sub.Handle("/batch-issue/jobs", batchIssueScope(issueapiController.HandleBatchIssueJobCreate())).Methods(http.MethodPost)
+
+		jobsController := jobs.New(db, h)
+		sub.Handle("/jobs/{id}", batchIssueScope(jobsController.HandleShowAPI())).Methods(http.MethodGet)
+		sub.Handle("/jobs/{id}/results.csv", batchIssueScope(jobsController.HandleResultsAPI())).Methods(http.MethodGet)
+
+		codesController := codes.NewAPI(cfg, db, h)
+		sub.Handle("/checkcodestatus", checkCodeStatusScope(codesController.HandleCheckCodeStatus())).Methods(http.MethodPost)
+		sub.Handle("/expirecode", expireCodeScope(codesController.HandleExpireAPI())).Methods(http.MethodPost)
+	}
+
+	// Realm management routes
+	{
+		sub := r.PathPrefix("/api/v1").Subrouter()
+		sub.Use(requireAdminAPIKey)
+		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
+		sub.Use(processFirewall)
+
+		userController := user.New(nil, cacher, db, h)
+		sub.Handle("/users", userController.HandleListAPI()).Methods(http.MethodGet)
+		sub.Handle("/users", userController.HandleCreateAPI()).Methods(http.MethodPost)
+		sub.Handle("/users/{id:[0-9]+}", userController.HandleShowAPI()).Methods(http.MethodGet)
+		sub.Handle("/users/{id:[0-9]+}", userController.HandleUpdateAPI()).Methods(http.MethodPatch)
+		sub.Handle("/users/{id:[0-9]+}", userController.HandleDeleteAPI()).Methods(http.MethodDelete)
+
+		apikeyController := apikey.New(cacher, db, h)
+		sub.Handle("/api-keys", apikeyController.HandleListAPI()).Methods(http.MethodGet)
+		sub.Handle("/api-keys", apikeyController.HandleCreateAPI()).Methods(http.MethodPost)
+		sub.Handle("/api-keys/{id:[0-9]+}", apikeyController.HandleShowAPI()).Methods(http.MethodGet)
+		sub.Handle("/api-keys/{id:[0-9]+}", apikeyController.HandleUpdateAPI()).Methods(http.MethodPatch)
+		sub.Handle("/api-keys/{id:[0-9]+}/rotate", apikeyController.HandleRotateAPI()).Methods(http.MethodPost)
+
+		mobileappsController := mobileapps.New(db, h)
+		sub.Handle("/mobile-apps", mobileappsController.HandleListAPI()).Methods(http.MethodGet)
+		sub.Handle("/mobile-apps", mobileappsController.HandleCreateAPI()).Methods(http.MethodPost)
+		sub.Handle("/mobile-apps/{id:[0-9]+}", mobileappsController.HandleShowAPI()).Methods(http.MethodGet)
+		sub.Handle("/mobile-apps/{id:[0-9]+}", mobileappsController.HandleUpdateAPI()).Methods(http.MethodPatch)
 
 		codesController := codes.NewAPI(cfg, db, h)
-		sub.Handle("/checkcodestatus", codesController.HandleCheckCodeStatus()).Methods(http.MethodPost)
-		sub.Handle("/expirecode", codesController.HandleExpireAPI()).Methods(http.MethodPost)
+		sub.Handle("/codes", codesController.HandleSearchAPI()).Methods(http.MethodGet)
+		sub.Handle("/codes.csv", codesController.HandleSearchExportAPI()).Methods(http.MethodGet)
+	}
+
+	// SCIM routes
+	{
+		sub := r.PathPrefix(scim.BasePath).Subrouter()
+		sub.Use(middleware.BearerAPIKey())
+		sub.Use(requireAdminAPIKey)
+		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
+		sub.Use(processFirewall)
+
+		scimController := scim.New(db, h)
+		sub.Handle("/ServiceProviderConfig", scimController.HandleServiceProviderConfig()).Methods(http.MethodGet)
+
+		sub.Handle("/Users", scimController.HandleListUsers()).Methods(http.MethodGet)
+		sub.Handle("/Users", scimController.HandleCreateUser()).Methods(http.MethodPost)
+		sub.Handle("/Users/{id}", scimController.HandleShowUser()).Methods(http.MethodGet)
+		sub.Handle("/Users/{id}", scimController.HandleReplaceUser()).Methods(http.MethodPut)
+		sub.Handle("/Users/{id}", scimController.HandlePatchUser()).Methods(http.MethodPatch)
+		sub.Handle("/Users/{id}", scimController.HandleDeleteUser()).Methods(http.MethodDelete)
+
+		sub.Handle("/Groups", scimController.HandleListGroups()).Methods(http.MethodGet)
+		sub.Handle("/Groups/{id}", scimController.HandleShowGroup()).Methods(http.MethodGet)
+		sub.Handle("/Groups/{id}", scimController.HandleReplaceGroup()).Methods(http.MethodPut)
+		sub.Handle("/Groups/{id}", scimController.HandlePatchGroup()).Methods(http.MethodPatch)
 	}
 
 	// Stats routes
@@ -118,6 +204,7 @@ func AdminAPI(
 		sub := r.PathPrefix("/api/stats").Subrouter()
 		sub.Use(requireStatsAPIKey)
 		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
 		sub.Use(processFirewall)
 
 		statsController := stats.New(cacher, db, h)
@@ -85,6 +85,17 @@ func APIServer(
 	}
 	rateLimit := httplimiter.Handle
 
+	// API keys with a configured rate limit are also limited individually. This
+	// must come after the API key is loaded.
+	apiKeyLimiter, err := limitware.NewMiddleware(ctx, limiterStore,
+		limitware.AuthorizedAppKeyFunc(ctx, "apiserver:ratelimit:", cfg.RateLimit.HMACKey),
+		limitware.AuthorizedAppLimit(db),
+		limitware.AllowOnError(false))
+	if err != nil {
+		return nil, closer, fmt.Errorf("failed to create api key limiter middleware: %w", err)
+	}
+	apiKeyRateLimit := apiKeyLimiter.Handle
+
 	// Install common security headers
 	r.Use(middleware.SecureHeaders(cfg.DevMode, "json"))
 
@@ -126,6 +137,7 @@ func APIServer(
 		sub.Use(processFirewall)
 		sub.Use(middleware.ProcessChaff(db, verifyChaffTracker, middleware.ChaffHeaderDetector()))
 		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
 
 		// POST /api/user-report
 		issueController := issueapi.New(cfg, db, limiterStore, certificateSigner, h)
@@ -138,6 +150,7 @@ func APIServer(
 		sub.Use(processFirewall)
 		sub.Use(middleware.ProcessChaff(db, verifyChaffTracker, middleware.ChaffHeaderDetector()))
 		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
 		sub.Use(middleware.AddOperatingSystemFromUserAgent())
 
 		// POST /api/verify
@@ -151,6 +164,7 @@ func APIServer(
 		sub.Use(processFirewall)
 		sub.Use(middleware.ProcessChaff(db, certChaffTracker, middleware.ChaffHeaderDetector()))
 		sub.Use(rateLimit)
+		sub.Use(apiKeyRateLimit)
 
 		// POST /api/certificate
 		certapiController, err := certapi.New(ctx, cfg, db, cacher, certificateSigner, h)
@@ -28,13 +28,16 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/admin"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/apikey"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/codes"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/codewebhooks"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/jobs"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/jwks"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/mobileapps"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmadmin"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmkeys"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/roles"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/smskeys"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/stats"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
@@ -167,7 +170,8 @@ func Server(
 	loadCurrentMembership := middleware.LoadCurrentMembership(h)
 	requireMembership := middleware.RequireMembership(h)
 	requireSystemAdmin := middleware.RequireSystemAdmin(h)
-	requireMFA := middleware.RequireMFA(authProvider, h)
+	requireMFA := middleware.RequireMFA(authProvider, db, h)
+	requireMFAChallenge := middleware.RequireMFAChallenge(authProvider, db, h)
 	processFirewall := middleware.ProcessFirewall(h, "server")
 	rateLimit := httplimiter.Handle
 
@@ -185,6 +189,21 @@ func Server(
 
 	{
 		loginController := login.New(authProvider, cacher, cfg, db, h)
+		{
+			// The identity provider redirects here cross-site, so session cookies
+			// are not sent. Fork from r so the session middleware does not replace
+			// the user's session.
+			sub := r.PathPrefix("").Subrouter()
+			sub.Use(populateRequestID)
+			sub.Use(populateLogger)
+			sub.Use(recovery)
+			sub.Use(obs)
+			sub.Use(populateTemplateVariables)
+			sub.Use(processLocale)
+			sub.Use(middleware.SecureHeaders(cfg.DevMode, "html"))
+			sub.Use(rateLimit)
+			sub.Handle(login.SSOCallbackPath, loginController.HandleSSOCallback()).Methods(http.MethodGet)
+		}
 		{
 			sub := sub.PathPrefix("").Subrouter()
 			sub.Use(rateLimit)
@@ -196,6 +215,8 @@ func Server(
 			sub.Use(checkIdleNoAuth)
 
 			sub.Handle("/", loginController.HandleLogin()).Methods(http.MethodGet)
+			sub.Handle("/login/sso/{id:[0-9]+}", loginController.HandleSSOStart()).Methods(http.MethodGet)
+			sub.Handle("/login/sso/complete", loginController.HandleSSOComplete()).Methods(http.MethodGet)
 			sub.Handle("/login/reset-password", loginController.HandleShowResetPassword()).Methods(http.MethodGet)
 			sub.Handle("/login/reset-password", loginController.HandleSubmitResetPassword()).Methods(http.MethodPost)
 			sub.Handle("/login/manage-account", loginController.HandleShowSelectNewPassword()).
@@ -205,11 +226,19 @@ func Server(
 			sub.Handle("/login/manage-account", loginController.HandleReceiveVerifyEmail()).
 				Queries("oobCode", "{oobCode:.+}", "mode", "{mode:(?:verifyEmail|recoverEmail)}").Methods(http.MethodGet)
 
-			// Realm selection & account settings
+			// Second factor challenge
 			sub = sub.PathPrefix("").Subrouter()
 			sub.Use(requireAuth)
 			sub.Use(rateLimit)
 			sub.Use(loadCurrentMembership)
+			sub.Handle("/login/mfa", loginController.HandleShowMFA()).Methods(http.MethodGet)
+			sub.Handle("/login/mfa", loginController.HandleSubmitMFA()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/webauthn/begin", loginController.HandleBeginMFAWebAuthn()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/webauthn/finish", loginController.HandleFinishMFAWebAuthn()).Methods(http.MethodPost)
+
+			// Realm selection & account settings
+			sub = sub.PathPrefix("").Subrouter()
+			sub.Use(requireMFAChallenge)
 			sub.Handle("/login", loginController.HandleReauth()).Methods(http.MethodGet)
 			sub.Handle("/login", loginController.HandleReauth()).Queries("redir", "").Methods(http.MethodGet)
 			sub.Handle("/login/post-authenticate", loginController.HandlePostAuthenticate()).Methods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch)
@@ -222,6 +251,13 @@ func Server(
 			sub.Handle("/login/manage-account", loginController.HandleSubmitVerifyEmail()).
 				Queries("mode", "verifyEmail").Methods(http.MethodPost)
 			sub.Handle("/login/register-phone", loginController.HandleRegisterPhone()).Methods(http.MethodGet)
+			sub.Handle("/login/mfa/settings", loginController.HandleMFASettings()).Methods(http.MethodGet)
+			sub.Handle("/login/mfa/totp", loginController.HandleShowNewTOTP()).Methods(http.MethodGet)
+			sub.Handle("/login/mfa/totp", loginController.HandleCreateTOTP()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/webauthn/register/begin", loginController.HandleBeginRegisterWebAuthn()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/webauthn/register/finish", loginController.HandleFinishRegisterWebAuthn()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/recovery-codes", loginController.HandleRegenerateMFARecoveryCodes()).Methods(http.MethodPost)
+			sub.Handle("/login/mfa/factors/{id:[0-9]+}", loginController.HandleDeleteMFAFactor()).Methods(http.MethodDelete)
 		}
 	}
 
@@ -243,6 +279,7 @@ func Server(
 		issueapiController := issueapi.New(cfg, db, limiterStore, smsSigner, h)
 		sub.Handle("/issue", issueapiController.HandleIssueUI()).Methods(http.MethodPost)
 		sub.Handle("/batch-issue", issueapiController.HandleBatchIssueUI()).Methods(http.MethodPost)
+		sub.Handle("/letters", issueapiController.HandleLettersUI()).Methods(http.MethodPost)
 
 		codesController := codes.NewServer(cfg, db, h)
 		codesRoutes(sub, codesController)
@@ -263,6 +300,36 @@ func Server(
 		mobileappsRoutes(sub, mobileappsController)
 	}
 
+	// code webhooks
+	if cfg.Features.EnableCodeWebhooks {
+		sub := sub.PathPrefix("/realm/webhooks").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(loadCurrentMembership)
+		sub.Use(requireMembership)
+		sub.Use(processFirewall)
+		sub.Use(requireEmailVerified)
+		sub.Use(requireMFA)
+		sub.Use(rateLimit)
+
+		codewebhooksController := codewebhooks.New(db, h)
+		codewebhooksRoutes(sub, codewebhooksController)
+	}
+
+	// jobs
+	{
+		sub := sub.PathPrefix("/realm/jobs").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(loadCurrentMembership)
+		sub.Use(requireMembership)
+		sub.Use(processFirewall)
+		sub.Use(requireEmailVerified)
+		sub.Use(requireMFA)
+		sub.Use(rateLimit)
+
+		jobsController := jobs.New(db, h)
+		jobsRoutes(sub, jobsController)
+	}
+
 	// apikeys
 	{
 		sub := sub.PathPrefix("/realm/apikeys").Subrouter()
@@ -293,6 +360,21 @@ func Server(
 		userRoutes(sub, userController)
 	}
 
+	// roles
+	{
+		sub := sub.PathPrefix("/realm/roles").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(loadCurrentMembership)
+		sub.Use(requireMembership)
+		sub.Use(processFirewall)
+		sub.Use(requireEmailVerified)
+		sub.Use(requireMFA)
+		sub.Use(rateLimit)
+
+		rolesController := roles.New(db, h)
+		rolesRoutes(sub, rolesController)
+	}
+
 	// stats
 	{
 		sub := sub.PathPrefix("/stats").Subrouter()
@@ -366,6 +448,7 @@ func Server(
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireSystemAdmin)
+		sub.Use(requireMFAChallenge)
 		sub.Use(rateLimit)
 
 		adminController := admin.New(cfg, cacher, db, authProvider, limiterStore, h)
@@ -391,6 +474,8 @@ func codesRoutes(r *mux.Router, c *codes.Controller) {
 	r.Handle("/issue", c.HandleIssue()).Methods(http.MethodGet)
 	r.Handle("/bulk-issue", c.HandleBulkIssue()).Methods(http.MethodGet)
 	r.Handle("/status", c.HandleIndex()).Methods(http.MethodGet)
+	r.Handle("/search", c.HandleSearch()).Methods(http.MethodGet)
+	r.Handle("/search.csv", c.HandleSearchExport()).Methods(http.MethodGet)
 	r.Handle("/{uuid}", c.HandleShow()).Methods(http.MethodGet)
 	r.Handle("/{uuid}/expire", c.HandleExpirePage()).Methods(http.MethodPatch)
 }
@@ -407,6 +492,22 @@ func mobileappsRoutes(r *mux.Router, c *mobileapps.Controller) {
 	r.Handle("/{id:[0-9]+}/enable", c.HandleEnable()).Methods(http.MethodPatch)
 }
 
+// codewebhooksRoutes are the code event webhook subscription routes.
+func codewebhooksRoutes(r *mux.Router, c *codewebhooks.Controller) {
+	r.Handle("", c.HandleIndex()).Methods(http.MethodGet)
+	r.Handle("", c.HandleCreate()).Methods(http.MethodPost)
+	r.Handle("/new", c.HandleCreate()).Methods(http.MethodGet)
+	r.Handle("/{id:[0-9]+}", c.HandleShow()).Methods(http.MethodGet)
+	r.Handle("/{id:[0-9]+}", c.HandleDelete()).Methods(http.MethodDelete)
+}
+
+// jobsRoutes are the background job routes.
+func jobsRoutes(r *mux.Router, c *jobs.Controller) {
+	r.Handle("", c.HandleIndex()).Methods(http.MethodGet)
+	r.Handle("/{id}", c.HandleShow()).Methods(http.MethodGet)
+	r.Handle("/{id}/results.csv", c.HandleResults()).Methods(http.MethodGet)
+}
+
 // apikeyRoutes are the API key routes.
 func apikeyRoutes(r *mux.Router, c *apikey.Controller) {
 	r.Handle("", c.HandleIndex()).Methods(http.MethodGet)
@@ -417,6 +518,8 @@ func apikeyRoutes(r *mux.Router, c *apikey.Controller) {
 	r.Handle("/{id:[0-9]+}", c.HandleUpdate()).Methods(http.MethodPatch)
 	r.Handle("/{id:[0-9]+}/disable", c.HandleDisable()).Methods(http.MethodPatch)
 	r.Handle("/{id:[0-9]+}/enable", c.HandleEnable()).Methods(http.MethodPatch)
+	r.Handle("/{id:[0-9]+}/rotate", c.HandleRotate()).Methods(http.MethodPost)
+	r.Handle("/{id:[0-9]+}/revoke-previous", c.HandleRevokePrevious()).Methods(http.MethodPatch)
 }
 
 // userRoutes are the user routes.
@@ -436,6 +539,16 @@ func userRoutes(r *mux.Router, c *user.Controller) {
 	r.Handle("/{id:[0-9]+}/reset-password", c.HandleResetPassword()).Methods(http.MethodPost)
 }
 
+// rolesRoutes are the realm role routes.
+func rolesRoutes(r *mux.Router, c *roles.Controller) {
+	r.Handle("", c.HandleIndex()).Methods(http.MethodGet)
+	r.Handle("", c.HandleCreate()).Methods(http.MethodPost)
+	r.Handle("/new", c.HandleCreate()).Methods(http.MethodGet)
+	r.Handle("/{id:[0-9]+}/edit", c.HandleUpdate()).Methods(http.MethodGet)
+	r.Handle("/{id:[0-9]+}", c.HandleUpdate()).Methods(http.MethodPatch)
+	r.Handle("/{id:[0-9]+}", c.HandleDelete()).Methods(http.MethodDelete)
+}
+
 // realmkeysRoutes are the realm key routes.
 func realmkeysRoutes(r *mux.Router, c *realmkeys.Controller) {
 	r.Handle("/keys", c.HandleIndex()).Methods(http.MethodGet)
@@ -488,6 +601,7 @@ func statsRoutes(r *mux.Router, c *stats.Controller) {
 // webhooksRoutes are the webhook routes.
 func webhooksRoutes(r *mux.Router, c *webhooks.Controller) {
 	r.Handle("/{realm_id:[0-9]+}/twilio", c.HandleTwilio()).Methods(http.MethodPost)
+	r.Handle("/{realm_id:[0-9]+}/twilio/status/{uuid}", c.HandleTwilioStatus()).Methods(http.MethodPost)
 }
 
 // realmadminRoutes are the realm admin routes.
@@ -495,6 +609,10 @@ func realmadminRoutes(r *mux.Router, c *realmadmin.Controller) {
 	r.Handle("/settings", c.HandleSettings()).Methods(http.MethodGet, http.MethodPost)
 	r.Handle("/settings/enable-express", c.HandleEnableExpress()).Methods(http.MethodPost)
 	r.Handle("/settings/disable-express", c.HandleDisableExpress()).Methods(http.MethodPost)
+	r.Handle("/settings/sms-failover", c.HandleCreateSMSFailover()).Methods(http.MethodPost)
+	r.Handle("/settings/sms-failover/{id:[0-9]+}", c.HandleDeleteSMSFailover()).Methods(http.MethodDelete)
+	r.Handle("/settings/sso", c.HandleSaveSSO()).Methods(http.MethodPost)
+	r.Handle("/settings/sso", c.HandleDeleteSSO()).Methods(http.MethodDelete)
 	r.Handle("/stats", c.HandleStats()).Methods(http.MethodGet)
 	r.Handle("/events", c.HandleEvents()).Methods(http.MethodGet)
 }
@@ -159,6 +159,12 @@ func TestRoutes_apikeyRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest(http.MethodPatch, "/12345/enable", nil),
 		},
+		{
+			req: httptest.NewRequest(http.MethodPost, "/12345/rotate", nil),
+		},
+		{
+			req: httptest.NewRequest(http.MethodPatch, "/12345/revoke-previous", nil),
+		},
 	}
 
 	for _, tc := range cases {
@@ -207,6 +213,38 @@ func TestRoutes_userRoutes(t *testing.T) {
 	}
 }
 
+func TestRoutes_rolesRoutes(t *testing.T) {
+	t.Parallel()
+
+	m := mux.NewRouter()
+	rolesRoutes(m, nil)
+
+	cases := []struct {
+		req  *http.Request
+		vars map[string]string
+	}{
+		{
+			req: httptest.NewRequest(http.MethodGet, "/new", nil),
+		},
+		{
+			req:  httptest.NewRequest(http.MethodGet, "/12345/edit", nil),
+			vars: map[string]string{"id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest(http.MethodPatch, "/12345", nil),
+			vars: map[string]string{"id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest(http.MethodDelete, "/12345", nil),
+			vars: map[string]string{"id": "12345"},
+		},
+	}
+
+	for _, tc := range cases {
+		testRoute(t, m, tc.req, tc.vars)
+	}
+}
+
 func TestRoutes_realmkeysRoutes(t *testing.T) {
 	t.Parallel()
 
@@ -326,6 +364,31 @@ func TestRoutes_statsRoutes(t *testing.T) {
 	}
 }
 
+func TestRoutes_jobsRoutes(t *testing.T) {
+	t.Parallel()
+
+	m := mux.NewRouter()
+	jobsRoutes(m, nil)
+
+	cases := []struct {
+		req  *http.Request
+		vars map[string]string
+	}{
+		{
+			req:  httptest.NewRequest(http.MethodGet, "/0d6d4b4c-4a24-4fb3-bbd7-3ab4a2f1bd5d", nil),
+			vars: map[string]string{"id": "0d6d4b4c-4a24-4fb3-bbd7-3ab4a2f1bd5d"},
+		},
+		{
+			req:  httptest.NewRequest(http.MethodGet, "/0d6d4b4c-4a24-4fb3-bbd7-3ab4a2f1bd5d/results.csv", nil),
+			vars: map[string]string{"id": "0d6d4b4c-4a24-4fb3-bbd7-3ab4a2f1bd5d"},
+		},
+	}
+
+	for _, tc := range cases {
+		testRoute(t, m, tc.req, tc.vars)
+	}
+}
+
 func TestRoutes_webhooksRoutes(t *testing.T) {
 	t.Parallel()
 
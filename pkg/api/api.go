@@ -54,6 +54,9 @@ const (
 	ErrVerifyCodeNotFound = "code_not_found"
 	// ErrVerifyCodeUserUnauth indicates the code does not belong to the requesting user.
 	ErrVerifyCodeUserUnauth = "code_user_unauthorized"
+	// ErrVerifyCodeTypo indicates the check digit of the code does not match,
+	// which usually means the code was mistyped.
+	ErrVerifyCodeTypo = "code_typo"
 	// ErrUnsupportedTestType indicates the client is unable to process the appropriate test type
 	// in this case, the user should be directed to upgrade their app / operating system.
 	// Accompanied by an HTTP status of StatusPreconditionFailed (412).
@@ -70,7 +73,8 @@ const (
 	ErrUUIDAlreadyExists = "uuid_already_exists"
 	// ErrMaintenanceMode indicates that the server is read-only for maintenance.
 	ErrMaintenanceMode = "maintenance_mode"
-	// ErrQuotaExceeded indicates the realm has exceeded its daily allotment of codes.
+	// ErrQuotaExceeded indicates the realm or API key has exceeded its daily
+	// allotment of codes.
 	ErrQuotaExceeded = "quota_exceeded"
 	// ErrSMSQueueFull indicates that Twilio's SMS queue is full and may not accept more SMS messages to send.
 	ErrSMSQueueFull = "sms_queue_full"
@@ -82,6 +86,10 @@ const (
 	ErrMissingNonce = "missing_nonce"
 	// ErrMissingPhone indicates a UserReport request is missing the phone number.
 	ErrMissingPhone = "missing_phone"
+	// ErrEmailInvalid indicates the email address could not be parsed, details in the error message.
+	ErrEmailInvalid = "email_invalid"
+	// ErrEmailFailure indicates that the email provider responded with a failure.
+	ErrEmailFailure = "email_failure"
 
 	// User report specific responses
 	// ErrUserReportTryLater indicates that user report is not allowed right now, which could be for several
@@ -186,11 +194,23 @@ type UserBatchRequest struct {
 type BatchUser struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
+
+	// ExpiresOn is the optional last day of the user's access to the realm,
+	// formatted as YYYY-MM-DD (UTC). If empty, the access does not expire.
+	ExpiresOn string `json:"expiresOn,omitempty"`
 }
 
-// UserBatchResponse defines the response type for UserBatchRequest.
+// UserBatchResponse defines the response type for UserBatchRequest. The users
+// are imported in the background; QueuedUsers is the number of users queued for
+// import and JobID is the ID of the job which imports them.
 type UserBatchResponse struct {
-	NewUsers []*BatchUser `json:"newUsers"`
+	// NewUsers is always empty. Users are added by the import job, which reports
+	// them in its results.
+	//
+	// Deprecated: use QueuedUsers and the job's results.
+	NewUsers    []*BatchUser `json:"newUsers"`
+	QueuedUsers int          `json:"queuedUsers"`
+	JobID       string       `json:"jobID,omitempty"`
 
 	Error     string `json:"error"`
 	ErrorCode string `json:"errorCode,omitempty"`
@@ -211,6 +231,10 @@ type IssueCodeRequest struct {
 	Phone            string  `json:"phone"`
 	SMSTemplateLabel string  `json:"smsTemplateLabel"`
 
+	// Email is an optional email address. If provided, the code (or ENX link)
+	// is sent to this address using the realm's email provider.
+	Email string `json:"email,omitempty"`
+
 	// Optional: UUID is a handle which allows the issuer to track status
 	// of the issued verification code. If omitted the server will generate the UUID.
 	UUID string `json:"uuid"`
@@ -242,6 +266,14 @@ type IssueCodeRequest struct {
 	// This field can only be set to true if the realm is configured to allow
 	// generated SMS messages.
 	OnlyGenerateSMS bool `json:"onlyGenerateSMS"`
+
+	// QRCode is a boolean field which indicates whether the response should
+	// include a QR code encoding the EN Express link for the issued code. The QR
+	// code is rendered by the server, so the code is not shared with any third
+	// party.
+	//
+	// This field can only be set to true if the realm has EN Express enabled.
+	QRCode bool `json:"qrCode,omitempty"`
 }
 
 // IssueCodeResponse defines the response type for IssueCodeRequest.
@@ -277,6 +309,18 @@ type IssueCodeResponse struct {
 	// onlyGenerateSMS was specified on the request.
 	Phone string `json:"phone,omitempty"`
 
+	// QRCodePNG is a base64-encoded PNG data URL of a QR code encoding the EN
+	// Express link for the code. QRCodeSVG is the same QR code as an SVG
+	// document. These fields will only be present if qrCode was specified on the
+	// request.
+	QRCodePNG string `json:"qrCodePNG,omitempty"`
+	QRCodeSVG string `json:"qrCodeSVG,omitempty"`
+
+	// LongCode is the long code. This field will only be present in a batch
+	// response if letters was specified on the request, so that printable
+	// letters can be regenerated later.
+	LongCode string `json:"longCode,omitempty"`
+
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"errorCode,omitempty"`
 }
@@ -285,6 +329,15 @@ type IssueCodeResponse struct {
 type BatchIssueCodeRequest struct {
 	Padding Padding             `json:"padding"`
 	Codes   []*IssueCodeRequest `json:"codes"`
+
+	// Letters requests a PDF with one printable patient letter for each
+	// successfully issued code. Codes issued with letters keep the realm's long
+	// code expiration even if they are not sent via SMS or email.
+	Letters bool `json:"letters,omitempty"`
+
+	// LetterLocale selects the realm's localized letter template (e.g. "es"). If
+	// empty or not configured, the realm's default letter template is used.
+	LetterLocale string `json:"letterLocale,omitempty"`
 }
 
 // BatchIssueCodeResponse defines the response for BatchIssueCodeRequest.
@@ -292,6 +345,56 @@ type BatchIssueCodeResponse struct {
 	Padding Padding              `json:"padding"`
 	Codes   []*IssueCodeResponse `json:"codes,omitempty"`
 
+	// LettersPDF is a PDF document with one printable letter per successfully
+	// issued code, in the order of the codes array. It is only present if letters
+	// was specified on the request. In JSON, it is base64-encoded.
+	LettersPDF []byte `json:"lettersPDF,omitempty"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// LetterCode identifies a previously issued code for which to print a letter.
+type LetterCode struct {
+	UUID     string `json:"uuid"`
+	LongCode string `json:"longCode"`
+}
+
+// LettersRequest is the request for regenerating printable patient letters
+// for codes that were issued in bulk and have not been claimed.
+type LettersRequest struct {
+	Padding Padding `json:"padding"`
+
+	Codes []*LetterCode `json:"codes"`
+
+	// LetterLocale selects the realm's localized letter template (e.g. "es").
+	LetterLocale string `json:"letterLocale,omitempty"`
+
+	// TZOffset is the offset of the user's timezone from UTC, in minutes, as
+	// reported by JavaScript's getTimezoneOffset. It is used to print the
+	// expiration time.
+	TZOffset float32 `json:"tzOffset,omitempty"`
+}
+
+// JobResponse is the status of a background job, such as a CSV bulk issue.
+// It is returned when a bulk issue job is created and from /api/jobs/{jobID}.
+// The per-item results are served as a CSV from /api/jobs/{jobID}/results.csv.
+type JobResponse struct {
+	Padding Padding `json:"padding"`
+
+	JobID          string `json:"jobID,omitempty"`
+	Kind           string `json:"kind,omitempty"`
+	Status         string `json:"status,omitempty"`
+	TotalItems     uint   `json:"totalItems"`
+	ProcessedItems uint   `json:"processedItems"`
+	SucceededItems uint   `json:"succeededItems"`
+	FailedItems    uint   `json:"failedItems"`
+
+	// CreatedAtTimestamp and CompletedAtTimestamp are UTC unix timestamps.
+	// CompletedAtTimestamp is omitted until the job has finished.
+	CreatedAtTimestamp   int64 `json:"createdAtTimestamp,omitempty"`
+	CompletedAtTimestamp int64 `json:"completedAtTimestamp,omitempty"`
+
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"errorCode,omitempty"`
 }
@@ -321,6 +424,13 @@ type CheckCodeStatusResponse struct {
 	// UTC seconds since epoch.
 	LongExpiresAtTimestamp int64 `json:"longExpiresAtTimestamp,omitempty"`
 
+	// DeliveryStatus is the delivery state of the SMS message containing the
+	// code. It is one of "queued", "sent", "failed", "delivered", or
+	// "undelivered". The "delivered" and "undelivered" states are reported by
+	// the carrier and are only present if the realm's SMS provider sends
+	// delivery status callbacks. The field is omitted if the status is unknown.
+	DeliveryStatus string `json:"deliveryStatus,omitempty"`
+
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"errorCode,omitempty"`
 }
@@ -351,6 +461,33 @@ type ExpireCodeResponse struct {
 	ErrorCode string `json:"errorCode,omitempty"`
 }
 
+// CodeEventWebhook is the body of the request sent to a realm's webhook
+// subscriptions when a verification code is claimed, expires unclaimed, or is
+// manually expired. It never contains the code or the patient's phone number.
+type CodeEventWebhook struct {
+	// Event is the type of event: "code.claimed", "code.expired", or
+	// "code.manually_expired".
+	Event string `json:"event"`
+
+	// UUID is the handle of the verification code, as returned by the issue API.
+	UUID string `json:"uuid"`
+
+	// ExternalIssuerID is the value supplied by the API caller when the code was
+	// issued, if any.
+	ExternalIssuerID string `json:"externalIssuerID,omitempty"`
+
+	// TestType is the test type of the verification code.
+	TestType string `json:"testType"`
+
+	// IssuedAtTimestamp is the time the code was issued, in UTC seconds since
+	// epoch.
+	IssuedAtTimestamp int64 `json:"issuedAtTimestamp"`
+
+	// OccurredAtTimestamp is the time the event occurred, in UTC seconds since
+	// epoch.
+	OccurredAtTimestamp int64 `json:"occurredAtTimestamp"`
+}
+
 // UserReportRequest defines the structure for a user initiated report.
 // This is a device API hosted on the apiserver.
 //
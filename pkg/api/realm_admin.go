@@ -0,0 +1,277 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// The types in this file are used by the realm management endpoints of the
+// admin API, served under /api/v1. The realm is always the realm of the API
+// key. Permissions are referenced by name, such as "CodeIssue", and membership
+// expiry dates are formatted as YYYY-MM-DD.
+
+// UserResponse is a member of the realm.
+// API is served at /api/v1/users and /api/v1/users/{id}
+type UserResponse struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+
+	// RoleID is the ID of the member's role in the realm, if any. Members with
+	// a role have the role's permissions.
+	RoleID uint `json:"roleID,omitempty"`
+
+	// Permissions are the names of the member's permissions in the realm.
+	Permissions []string `json:"permissions"`
+
+	// ExpiresOn is the last day of the membership. It is omitted if the
+	// membership does not expire.
+	ExpiresOn string `json:"expiresOn,omitempty"`
+
+	// CreatedAtTimestamp is the time the user joined the realm, in UTC seconds
+	// since epoch.
+	CreatedAtTimestamp int64 `json:"createdAtTimestamp"`
+}
+
+// ListUsersResponse is a page of the realm's members.
+type ListUsersResponse struct {
+	Users []*UserResponse `json:"users"`
+
+	// NextPage is the page number of the next page, if there is one.
+	NextPage uint64 `json:"nextPage,omitempty"`
+}
+
+// CreateUserRequest adds a user to the realm, creating the user if no user
+// with the email address exists. If RoleID is set, Permissions must be empty.
+type CreateUserRequest struct {
+	Email       string   `json:"email"`
+	Name        string   `json:"name"`
+	RoleID      uint     `json:"roleID,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ExpiresOn   string   `json:"expiresOn,omitempty"`
+}
+
+// UpdateUserRequest updates a member of the realm. Omitted (or null) fields are
+// unchanged. Setting either RoleID or Permissions replaces both the member's
+// role and permissions, as in CreateUserRequest. An empty ExpiresOn removes
+// the membership's expiry.
+type UpdateUserRequest struct {
+	Name        *string  `json:"name,omitempty"`
+	RoleID      *uint    `json:"roleID,omitempty"`
+	Permissions []string `json:"permissions"`
+	ExpiresOn   *string  `json:"expiresOn,omitempty"`
+}
+
+// APIKeyResponse is an API key in the realm. The API key itself is only
+// returned when the key is created.
+// API is served at /api/v1/api-keys and /api/v1/api-keys/{id}
+type APIKeyResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+
+	// Type is one of "device", "admin", or "stats".
+	Type string `json:"type"`
+
+	// Preview is the first few characters of the API key.
+	Preview string `json:"preview"`
+
+	// Permissions are the names of an admin API key's permissions.
+	Permissions []string `json:"permissions"`
+
+	// Scopes restrict an admin API key to the named code APIs ("issue",
+	// "batch-issue", "checkcodestatus", and "expirecode"). If empty, the API key
+	// can use all of them.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// AllowedTestTypes restrict the test types an admin API key can issue. If
+	// empty, the API key can issue all of the realm's test types.
+	AllowedTestTypes []string `json:"allowedTestTypes,omitempty"`
+
+	// AllowedCIDRs restrict the IPs from which the API key can be used.
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+
+	// ExpiresOn is the last day (UTC) on which the API key works, omitted if
+	// the API key does not expire.
+	ExpiresOn string `json:"expiresOn,omitempty"`
+
+	// RequestsPerMinute is the API key's rate limit, and DailyIssueLimit is the
+	// maximum number of codes an admin API key can issue per day. They are
+	// omitted if the API key has no limit of its own.
+	RequestsPerMinute uint `json:"requestsPerMinute,omitempty"`
+	DailyIssueLimit   uint `json:"dailyIssueLimit,omitempty"`
+
+	Disabled bool `json:"disabled"`
+
+	// CreatedAtTimestamp and LastUsedAtTimestamp are in UTC seconds since
+	// epoch. LastUsedAtTimestamp is omitted if the key has never been used.
+	CreatedAtTimestamp  int64 `json:"createdAtTimestamp"`
+	LastUsedAtTimestamp int64 `json:"lastUsedAtTimestamp,omitempty"`
+
+	// RotatedAtTimestamp is the time of the most recent rotation in UTC seconds
+	// since epoch, omitted if the API key has never been rotated.
+	RotatedAtTimestamp int64 `json:"rotatedAtTimestamp,omitempty"`
+
+	// PreviousPreview is the first few characters of the API key replaced by
+	// the most recent rotation. The previous fields are omitted once the grace
+	// period ends or the previous API key is revoked.
+	PreviousPreview             string `json:"previousPreview,omitempty"`
+	PreviousExpiresAtTimestamp  int64  `json:"previousExpiresAtTimestamp,omitempty"`
+	PreviousLastUsedAtTimestamp int64  `json:"previousLastUsedAtTimestamp,omitempty"`
+}
+
+// ListAPIKeysResponse is a page of the realm's API keys.
+type ListAPIKeysResponse struct {
+	APIKeys []*APIKeyResponse `json:"apiKeys"`
+
+	// NextPage is the page number of the next page, if there is one.
+	NextPage uint64 `json:"nextPage,omitempty"`
+}
+
+// CreateAPIKeyRequest creates an API key. Only admin API keys can have
+// permissions, scopes, and allowed test types.
+type CreateAPIKeyRequest struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Permissions      []string `json:"permissions,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	AllowedTestTypes []string `json:"allowedTestTypes,omitempty"`
+	AllowedCIDRs     []string `json:"allowedCIDRs,omitempty"`
+	ExpiresOn        string   `json:"expiresOn,omitempty"`
+
+	RequestsPerMinute uint `json:"requestsPerMinute,omitempty"`
+	DailyIssueLimit   uint `json:"dailyIssueLimit,omitempty"`
+}
+
+// CreateAPIKeyResponse is the created API key.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+
+	// APIKey is the API key. It cannot be retrieved again.
+	APIKey string `json:"apiKey"`
+}
+
+// UpdateAPIKeyRequest updates an API key. Omitted (or null) fields are
+// unchanged.
+// Disabled API keys cannot be used.
+type UpdateAPIKeyRequest struct {
+	Name             *string  `json:"name,omitempty"`
+	Permissions      []string `json:"permissions"`
+	Scopes           []string `json:"scopes"`
+	AllowedTestTypes []string `json:"allowedTestTypes"`
+	AllowedCIDRs     []string `json:"allowedCIDRs"`
+	ExpiresOn        *string  `json:"expiresOn,omitempty"`
+	Disabled         *bool    `json:"disabled,omitempty"`
+
+	// RequestsPerMinute and DailyIssueLimit are removed by setting them to 0.
+	RequestsPerMinute *uint `json:"requestsPerMinute,omitempty"`
+	DailyIssueLimit   *uint `json:"dailyIssueLimit,omitempty"`
+}
+
+// RotateAPIKeyRequest issues a new API key for an existing API key. The
+// current API key continues to work for the grace period, up to 720 hours (30
+// days). A zero grace period revokes the current API key immediately.
+// API is served at /api/v1/api-keys/{id}/rotate
+// The response is a CreateAPIKeyResponse.
+type RotateAPIKeyRequest struct {
+	GracePeriodHours int `json:"gracePeriodHours"`
+}
+
+// MobileAppResponse is a mobile app in the realm.
+// API is served at /api/v1/mobile-apps and /api/v1/mobile-apps/{id}
+type MobileAppResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+
+	// OS is one of "ios" or "android".
+	OS string `json:"os"`
+
+	// AppID is the iOS app ID (including the team ID) or the Android package
+	// name.
+	AppID string `json:"appID"`
+
+	// SHA is the Android signing certificate fingerprint.
+	SHA string `json:"sha,omitempty"`
+
+	// URL is the link to the app in its app store.
+	URL string `json:"url,omitempty"`
+
+	EnableRedirect bool `json:"enableRedirect"`
+	Disabled       bool `json:"disabled"`
+
+	CreatedAtTimestamp int64 `json:"createdAtTimestamp"`
+}
+
+// ListMobileAppsResponse is a page of the realm's mobile apps.
+type ListMobileAppsResponse struct {
+	MobileApps []*MobileAppResponse `json:"mobileApps"`
+
+	// NextPage is the page number of the next page, if there is one.
+	NextPage uint64 `json:"nextPage,omitempty"`
+}
+
+// CreateMobileAppRequest creates a mobile app.
+type CreateMobileAppRequest struct {
+	Name           string `json:"name"`
+	OS             string `json:"os"`
+	AppID          string `json:"appID"`
+	SHA            string `json:"sha,omitempty"`
+	URL            string `json:"url,omitempty"`
+	EnableRedirect bool   `json:"enableRedirect"`
+}
+
+// UpdateMobileAppRequest updates a mobile app. Omitted fields are unchanged.
+// Disabled mobile apps are not used for redirects or app links.
+type UpdateMobileAppRequest struct {
+	Name           *string `json:"name,omitempty"`
+	OS             *string `json:"os,omitempty"`
+	AppID          *string `json:"appID,omitempty"`
+	SHA            *string `json:"sha,omitempty"`
+	URL            *string `json:"url,omitempty"`
+	EnableRedirect *bool   `json:"enableRedirect,omitempty"`
+	Disabled       *bool   `json:"disabled,omitempty"`
+}
+
+// CodeResponse is a verification code issued in the realm. The code itself is
+// never returned. Either IssuingUserID or IssuingAppID is set, depending on
+// whether the code was issued from the web interface or the API.
+// API is served at /api/v1/codes and /api/v1/codes.csv
+type CodeResponse struct {
+	UUID     string `json:"uuid"`
+	TestType string `json:"testType"`
+
+	// Status is one of "active", "claimed", or "expired".
+	Status string `json:"status"`
+
+	IssuingUserID     uint   `json:"issuingUserID,omitempty"`
+	IssuingAppID      uint   `json:"issuingAppID,omitempty"`
+	IssuerName        string `json:"issuerName,omitempty"`
+	IssuingExternalID string `json:"issuingExternalID,omitempty"`
+
+	// SymptomDate and TestDate are formatted as YYYY-MM-DD.
+	SymptomDate string `json:"symptomDate,omitempty"`
+	TestDate    string `json:"testDate,omitempty"`
+
+	// CreatedAtTimestamp, ExpiresAtTimestamp, and LongExpiresAtTimestamp are in
+	// UTC seconds since epoch.
+	CreatedAtTimestamp     int64 `json:"createdAtTimestamp"`
+	ExpiresAtTimestamp     int64 `json:"expiresAtTimestamp"`
+	LongExpiresAtTimestamp int64 `json:"longExpiresAtTimestamp"`
+}
+
+// ListCodesResponse is a page of the realm's verification codes which match
+// the search filters.
+type ListCodesResponse struct {
+	Codes []*CodeResponse `json:"codes"`
+
+	// NextPage is the page number of the next page, if there is one.
+	NextPage uint64 `json:"nextPage,omitempty"`
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package checkdigit implements check digit algorithms which detect common
+// typing errors in verification codes before they are looked up.
+package checkdigit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dammTable is the order 10 totally anti-symmetric quasigroup used by the Damm
+// algorithm.
+var dammTable = [10][10]byte{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+// Damm returns the Damm check digit for the given string of decimal digits.
+// The Damm algorithm detects all single digit errors and all adjacent
+// transpositions.
+func Damm(s string) (byte, error) {
+	interim, err := damm(s)
+	if err != nil {
+		return 0, err
+	}
+	return '0' + interim, nil
+}
+
+// ValidDamm returns true if the last digit of s is the Damm check digit of the
+// preceding digits.
+func ValidDamm(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	interim, err := damm(s)
+	return err == nil && interim == 0
+}
+
+func damm(s string) (byte, error) {
+	var interim byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid digit %q at position %d", c, i)
+		}
+		interim = dammTable[interim][c-'0']
+	}
+	return interim, nil
+}
+
+// LuhnModN returns the Luhn mod N check character for s, where N is the length
+// of the alphabet. It detects all single character errors and most adjacent
+// transpositions.
+func LuhnModN(s, alphabet string) (byte, error) {
+	sum, err := luhnModN(s, alphabet, 2)
+	if err != nil {
+		return 0, err
+	}
+	n := len(alphabet)
+	return alphabet[(n-sum%n)%n], nil
+}
+
+// ValidLuhnModN returns true if the last character of s is the Luhn mod N check
+// character of the preceding characters.
+func ValidLuhnModN(s, alphabet string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	sum, err := luhnModN(s, alphabet, 1)
+	return err == nil && sum%len(alphabet) == 0
+}
+
+// luhnModN computes the Luhn sum of s from right to left, doubling every other
+// code point starting with the given factor.
+func luhnModN(s, alphabet string, factor int) (int, error) {
+	n := len(alphabet)
+	if n < 2 {
+		return 0, fmt.Errorf("alphabet must have at least 2 characters")
+	}
+
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(alphabet, s[i])
+		if codePoint < 0 {
+			return 0, fmt.Errorf("invalid character %q at position %d", s[i], i)
+		}
+
+		addend := factor * codePoint
+		sum += addend/n + addend%n
+
+		factor = 3 - factor
+	}
+	return sum, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkdigit
+
+import (
+	"testing"
+)
+
+const (
+	digits   = "0123456789"
+	alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+func TestDamm(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in  string
+		exp byte
+		err bool
+	}{
+		{in: "572", exp: '4'},
+		{in: "0", exp: '0'},
+		{in: "5724", exp: '0'},
+		{in: "12a4", err: true},
+	}
+
+	for _, tc := range cases {
+		got, err := Damm(tc.in)
+		if (err != nil) != tc.err {
+			t.Fatalf("%q: expected error %t, got %v", tc.in, tc.err, err)
+		}
+		if got != tc.exp {
+			t.Errorf("%q: expected %q to be %q", tc.in, got, tc.exp)
+		}
+	}
+}
+
+func TestValidDamm(t *testing.T) {
+	t.Parallel()
+
+	code := "5724"
+	if !ValidDamm(code) {
+		t.Fatalf("expected %q to be valid", code)
+	}
+
+	// Every single digit substitution is detected.
+	for i := 0; i < len(code); i++ {
+		for _, c := range []byte(digits) {
+			if c == code[i] {
+				continue
+			}
+			typo := code[:i] + string(c) + code[i+1:]
+			if ValidDamm(typo) {
+				t.Errorf("expected substitution %q to be invalid", typo)
+			}
+		}
+	}
+
+	// Every adjacent transposition is detected.
+	for i := 0; i < len(code)-1; i++ {
+		if code[i] == code[i+1] {
+			continue
+		}
+		typo := code[:i] + string(code[i+1]) + string(code[i]) + code[i+2:]
+		if ValidDamm(typo) {
+			t.Errorf("expected transposition %q to be invalid", typo)
+		}
+	}
+
+	for _, in := range []string{"", "5", "57a4"} {
+		if ValidDamm(in) {
+			t.Errorf("expected %q to be invalid", in)
+		}
+	}
+}
+
+func TestLuhnModN(t *testing.T) {
+	t.Parallel()
+
+	// With a decimal alphabet, Luhn mod N is the standard Luhn algorithm.
+	got, err := LuhnModN("7992739871", digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != '3' {
+		t.Errorf("expected %q to be %q", got, '3')
+	}
+
+	if _, err := LuhnModN("abc", "a"); err == nil {
+		t.Errorf("expected error for short alphabet")
+	}
+	if _, err := LuhnModN("ABC", alphabet); err == nil {
+		t.Errorf("expected error for characters outside the alphabet")
+	}
+}
+
+func TestValidLuhnModN(t *testing.T) {
+	t.Parallel()
+
+	payload := "9xk2m4qz7ab"
+	check, err := LuhnModN(payload, alphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := payload + string(check)
+	if !ValidLuhnModN(code, alphabet) {
+		t.Fatalf("expected %q to be valid", code)
+	}
+
+	// Every single character substitution is detected.
+	for i := 0; i < len(code); i++ {
+		for _, c := range []byte(alphabet) {
+			if c == code[i] {
+				continue
+			}
+			typo := code[:i] + string(c) + code[i+1:]
+			if ValidLuhnModN(typo, alphabet) {
+				t.Errorf("expected substitution %q to be invalid", typo)
+			}
+		}
+	}
+
+	for _, in := range []string{"", "a", code + "!"} {
+		if ValidLuhnModN(in, alphabet) {
+			t.Errorf("expected %q to be invalid", in)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+)
+
+const (
+	// AuthProviderFirebase authenticates users with Firebase Authentication.
+	AuthProviderFirebase = "firebase"
+
+	// AuthProviderPassword stores password hashes in the database and sends
+	// account emails through the realm or system email configuration. It does
+	// not depend on any external identity service.
+	AuthProviderPassword = "password"
+)
+
+// AuthConfig represents the configuration for user authentication.
+type AuthConfig struct {
+	// Provider selects the identity provider, AuthProviderFirebase or
+	// AuthProviderPassword.
+	Provider string `env:"AUTH_PROVIDER, default=firebase"`
+
+	// The remaining options only apply to the password provider.
+
+	// PasswordHashCost is the bcrypt cost of new password hashes.
+	PasswordHashCost int `env:"AUTH_PASSWORD_HASH_COST, default=12"`
+
+	// MaxFailedLogins is the number of consecutive failed sign-in attempts after
+	// which the account is locked. 0 disables lockout.
+	MaxFailedLogins uint `env:"AUTH_MAX_FAILED_LOGINS, default=5"`
+
+	// LockoutDuration is how long an account stays locked.
+	LockoutDuration time.Duration `env:"AUTH_LOCKOUT_DURATION, default=15m"`
+
+	// PasswordResetTTL is how long password reset links are valid.
+	PasswordResetTTL time.Duration `env:"AUTH_PASSWORD_RESET_TTL, default=1h"`
+
+	// InvitationTTL is how long the links in new user invitations are valid.
+	InvitationTTL time.Duration `env:"AUTH_INVITATION_TTL, default=72h"`
+
+	// EmailVerificationTTL is how long email verification links are valid.
+	EmailVerificationTTL time.Duration `env:"AUTH_EMAIL_VERIFICATION_TTL, default=24h"`
+}
+
+// PasswordAuth returns true if the password provider is selected.
+func (c *AuthConfig) PasswordAuth() bool {
+	return c.Provider == AuthProviderPassword
+}
+
+// Validate validates the auth configuration. The endpoint is the server
+// endpoint, which the password provider requires to build links in emails.
+func (c *AuthConfig) Validate(endpoint string) error {
+	switch c.Provider {
+	case AuthProviderFirebase:
+		return nil
+	case AuthProviderPassword:
+	default:
+		return fmt.Errorf("AUTH_PROVIDER must be %q or %q, got %q", AuthProviderFirebase, AuthProviderPassword, c.Provider)
+	}
+
+	if endpoint == "" {
+		return fmt.Errorf("SERVER_ENDPOINT is required when AUTH_PROVIDER is %q", AuthProviderPassword)
+	}
+
+	if c.PasswordHashCost < auth.MinPasswordHashCost || c.PasswordHashCost > auth.MaxPasswordHashCost {
+		return fmt.Errorf("AUTH_PASSWORD_HASH_COST must be between %d and %d", auth.MinPasswordHashCost, auth.MaxPasswordHashCost)
+	}
+
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.LockoutDuration, "AUTH_LOCKOUT_DURATION"},
+		{c.PasswordResetTTL, "AUTH_PASSWORD_RESET_TTL"},
+		{c.InvitationTTL, "AUTH_INVITATION_TTL"},
+		{c.EmailVerificationTTL, "AUTH_EMAIL_VERIFICATION_TTL"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PasswordConfig returns the password provider config. The endpoint is the
+// server endpoint for links in emails.
+func (c *AuthConfig) PasswordConfig(endpoint string) *auth.PasswordConfig {
+	return &auth.PasswordConfig{
+		Endpoint:             endpoint,
+		HashCost:             c.PasswordHashCost,
+		MaxFailedLogins:      c.MaxFailedLogins,
+		LockoutDuration:      c.LockoutDuration,
+		PasswordResetTTL:     c.PasswordResetTTL,
+		InvitationTTL:        c.InvitationTTL,
+		EmailVerificationTTL: c.EmailVerificationTTL,
+	}
+}
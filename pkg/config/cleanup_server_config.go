@@ -80,6 +80,22 @@ type CleanupConfig struct {
 	UserReportUnclaimedMaxAge time.Duration `env:"USER_REPORT_UNCLAIMED_MAX_AGE, default=30m"`
 	// UserReportMaxAge is how long a claimed user report phone hash will be kept.
 	UserReportMaxAge time.Duration `env:"USER_REPORT_MAX_AGE, default=2160h"` // 2160h = 90 days
+
+	// WebhookDeliveryMaxAge is how long webhook deliveries are kept in the
+	// delivery log.
+	WebhookDeliveryMaxAge time.Duration `env:"WEBHOOK_DELIVERY_MAX_AGE, default=336h"` // 14 days
+
+	// JobMaxAge is how long finished background jobs, and their results, are
+	// kept.
+	JobMaxAge time.Duration `env:"JOB_MAX_AGE, default=336h"` // 14 days
+
+	// UserTokenMaxAge is how long password reset and email verification tokens
+	// are kept after they expire.
+	UserTokenMaxAge time.Duration `env:"USER_TOKEN_MAX_AGE, default=24h"`
+
+	// MembershipExpiryWarning is how long before a realm membership expires that
+	// the user and realm admins are warned by email.
+	MembershipExpiryWarning time.Duration `env:"MEMBERSHIP_EXPIRY_WARNING, default=72h"` // 3 days
 }
 
 // NewCleanupConfig returns the environment config for the cleanup server.
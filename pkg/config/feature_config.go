@@ -26,6 +26,16 @@ type FeatureConfig struct {
 	// EnableSMSErrorWebhook enables the configuration for Twilio webhooks.
 	// TODO(sethvargo): remove in 1.0.4+
 	EnableSMSErrorWebhook bool `env:"ENABLE_SMS_ERROR_WEBHOOK, default=true"`
+
+	// EnableSMSOutbox queues SMS messages in the database at issuance instead of
+	// sending them during the request. The messages are delivered by the
+	// sms-outbox service, which must be deployed when this is enabled.
+	EnableSMSOutbox bool `env:"ENABLE_SMS_OUTBOX"`
+
+	// EnableCodeWebhooks allows realm admins to subscribe to verification code
+	// events. The events are delivered by the webhook-dispatcher service, which
+	// must be deployed when this is enabled.
+	EnableCodeWebhooks bool `env:"ENABLE_CODE_WEBHOOKS"`
 }
 
 // AddToTemplate takes TemplateMap and writes the status of all known
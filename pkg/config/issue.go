@@ -15,9 +15,11 @@
 package config
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/letter"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 )
 
@@ -32,6 +34,21 @@ type IssueAPIVars struct {
 	// https://[realm-region].[ENX_REDIRECT_DOMAIN]/v?c=[longcode]
 	// This repository contains a redirect service that can be used for this purpose.
 	ENExpressRedirectDomain string `env:"ENX_REDIRECT_DOMAIN"`
+
+	// SMSStatusCallbackEndpoint is the public endpoint (scheme + host) of the
+	// server which hosts the webhooks. If set, SMS providers which support
+	// delivery status callbacks report the status of each message to it.
+	SMSStatusCallbackEndpoint string `env:"SMS_STATUS_CALLBACK_ENDPOINT"`
+
+	// LetterPageSize is the paper size of printable patient code letters, either
+	// "Letter" or "A4".
+	LetterPageSize string `env:"LETTER_PAGE_SIZE, default=Letter"`
+
+	// LetterFontPath is an optional path to a TrueType font for printable
+	// patient code letters. The built-in font only covers Western European
+	// characters, so letter templates in other scripts require a font which
+	// covers them.
+	LetterFontPath string `env:"LETTER_FONT_PATH"`
 }
 
 func (c *IssueAPIVars) Validate() error {
@@ -50,6 +67,15 @@ func (c *IssueAPIVars) Validate() error {
 
 	c.ENExpressRedirectDomain = strings.ToLower(c.ENExpressRedirectDomain)
 
+	switch {
+	case c.LetterPageSize == "", strings.EqualFold(c.LetterPageSize, letter.PageSizeLetter):
+		c.LetterPageSize = letter.PageSizeLetter
+	case strings.EqualFold(c.LetterPageSize, letter.PageSizeA4):
+		c.LetterPageSize = letter.PageSizeA4
+	default:
+		return fmt.Errorf("LETTER_PAGE_SIZE must be %q or %q", letter.PageSizeLetter, letter.PageSizeA4)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,178 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+
+	"github.com/google/exposure-notifications-server/pkg/observability"
+
+	firebase "firebase.google.com/go"
+	"github.com/sethvargo/go-envconfig"
+)
+
+var _ IssueAPIConfig = (*JobWorkerConfig)(nil)
+
+// JobWorkerConfig represents the environment based configuration for the
+// job worker.
+type JobWorkerConfig struct {
+	Auth          AuthConfig
+	Firebase      FirebaseConfig
+	Database      database.Config
+	Observability observability.Config
+	Features      FeatureConfig
+
+	// SMSSigning defines the SMS signing configuration.
+	SMSSigning SMSSigningConfig
+
+	// DevMode produces additional debugging information. Do not enable in
+	// production environments.
+	DevMode bool `env:"DEV_MODE"`
+
+	// If MaintenanceMode is true, the server is temporarily read-only and will
+	// not issue codes.
+	MaintenanceMode bool `env:"MAINTENANCE_MODE"`
+
+	// Rate limiting configuration. This is used to enforce realm quotas.
+	RateLimit ratelimit.Config
+
+	// Port is the port on which to bind.
+	Port string `env:"PORT,default=8080"`
+
+	// ServerEndpoint is the endpoint of the UI server (scheme + host [+ port]).
+	// It is required by the password auth provider to build the links in
+	// invitation emails.
+	ServerEndpoint string `env:"SERVER_ENDPOINT"`
+
+	Issue IssueAPIVars
+
+	// MinPeriod is the minimum amount of time between processing runs.
+	MinPeriod time.Duration `env:"JOB_WORKER_MIN_PERIOD, default=30s"`
+
+	// BatchSize is the number of items processed at a time. Progress is saved
+	// after each batch.
+	BatchSize uint `env:"JOB_WORKER_BATCH_SIZE, default=10"`
+
+	// MaxRunDuration is the maximum amount of time spent processing jobs per
+	// run. Jobs which are not finished are resumed on the next run.
+	MaxRunDuration time.Duration `env:"JOB_WORKER_MAX_RUN_DURATION, default=4m"`
+
+	// LeaseDuration is how long a job is held by a worker before it becomes
+	// eligible to be claimed again. This must be longer than the max run
+	// duration.
+	LeaseDuration time.Duration `env:"JOB_WORKER_LEASE_DURATION, default=15m"`
+
+	// MaxAttempts is the maximum number of consecutive attempts which make no
+	// progress before a job is marked as failed.
+	MaxAttempts uint `env:"JOB_WORKER_MAX_ATTEMPTS, default=5"`
+}
+
+// NewJobWorkerConfig returns the environment config for the bulk issue
+// worker. Only needs to be called once per instance, but may be called
+// multiple times.
+func NewJobWorkerConfig(ctx context.Context) (*JobWorkerConfig, error) {
+	var config JobWorkerConfig
+	if err := ProcessWith(ctx, &config, envconfig.OsLookuper()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *JobWorkerConfig) Validate() error {
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.MinPeriod, "JOB_WORKER_MIN_PERIOD"},
+		{c.MaxRunDuration, "JOB_WORKER_MAX_RUN_DURATION"},
+		{c.LeaseDuration, "JOB_WORKER_LEASE_DURATION"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	if c.BatchSize == 0 {
+		return fmt.Errorf("JOB_WORKER_BATCH_SIZE must be greater than 0")
+	}
+	if c.MaxAttempts == 0 {
+		return fmt.Errorf("JOB_WORKER_MAX_ATTEMPTS must be greater than 0")
+	}
+	if c.LeaseDuration <= c.MaxRunDuration {
+		return fmt.Errorf("JOB_WORKER_LEASE_DURATION must be greater than JOB_WORKER_MAX_RUN_DURATION")
+	}
+
+	if err := c.Issue.Validate(); err != nil {
+		return fmt.Errorf("failed to validate issue API configuration: %w", err)
+	}
+
+	if err := c.Auth.Validate(c.ServerEndpoint); err != nil {
+		return fmt.Errorf("failed to validate auth configuration: %w", err)
+	}
+	if !c.Auth.PasswordAuth() {
+		if err := c.Firebase.Validate(); err != nil {
+			return fmt.Errorf("failed to validate firebase configuration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// FirebaseConfig returns the firebase SDK config based on the local env config.
+func (c *JobWorkerConfig) FirebaseConfig() *firebase.Config {
+	return &firebase.Config{
+		DatabaseURL:   c.Firebase.DatabaseURL,
+		ProjectID:     c.Firebase.ProjectID,
+		StorageBucket: c.Firebase.StorageBucket,
+	}
+}
+
+// PasswordAuthConfig returns the password auth provider config based on the
+// local env config.
+func (c *JobWorkerConfig) PasswordAuthConfig() *auth.PasswordConfig {
+	return c.Auth.PasswordConfig(c.ServerEndpoint)
+}
+
+func (c *JobWorkerConfig) IssueConfig() *IssueAPIVars {
+	return &c.Issue
+}
+
+func (c *JobWorkerConfig) GetRateLimitConfig() *ratelimit.Config {
+	return &c.RateLimit
+}
+
+func (c *JobWorkerConfig) GetFeatureConfig() *FeatureConfig {
+	return &c.Features
+}
+
+func (c *JobWorkerConfig) ObservabilityExporterConfig() *observability.Config {
+	return &c.Observability
+}
+
+func (c *JobWorkerConfig) IsMaintenanceMode() bool {
+	return c.MaintenanceMode
+}
+
+func (c *JobWorkerConfig) GetAuthenticatedSMSFailClosed() bool {
+	return c.SMSSigning.FailClosed
+}
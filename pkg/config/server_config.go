@@ -21,6 +21,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -53,6 +54,7 @@ func (c *PasswordRequirementsConfig) HasRequirements() bool {
 
 // ServerConfig represents the environment based config for the server.
 type ServerConfig struct {
+	Auth          AuthConfig
 	Firebase      FirebaseConfig
 	Database      database.Config
 	Observability observability.Config
@@ -165,6 +167,15 @@ func (c *ServerConfig) Validate() error {
 		return fmt.Errorf("failed to validate issue API configuration: %w", err)
 	}
 
+	if err := c.Auth.Validate(c.ServerEndpoint); err != nil {
+		return fmt.Errorf("failed to validate auth configuration: %w", err)
+	}
+	if !c.Auth.PasswordAuth() {
+		if err := c.Firebase.Validate(); err != nil {
+			return fmt.Errorf("failed to validate firebase configuration: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -201,21 +212,46 @@ func (c *ServerConfig) ParsedSystemNotice() string {
 	return c.systemNotice
 }
 
-// FirebaseConfig represents configuration specific to firebase auth.
+// FirebaseConfig represents configuration specific to firebase auth. The
+// values are required unless another auth provider is selected.
 type FirebaseConfig struct {
-	APIKey          string `env:"FIREBASE_API_KEY,required"`
-	AuthDomain      string `env:"FIREBASE_AUTH_DOMAIN,required"`
-	DatabaseURL     string `env:"FIREBASE_DATABASE_URL,required"`
-	ProjectID       string `env:"FIREBASE_PROJECT_ID,required"`
-	StorageBucket   string `env:"FIREBASE_STORAGE_BUCKET,required"`
-	MessageSenderID string `env:"FIREBASE_MESSAGE_SENDER_ID,required"`
-	AppID           string `env:"FIREBASE_APP_ID,required"`
-	MeasurementID   string `env:"FIREBASE_MEASUREMENT_ID,required"`
+	APIKey          string `env:"FIREBASE_API_KEY"`
+	AuthDomain      string `env:"FIREBASE_AUTH_DOMAIN"`
+	DatabaseURL     string `env:"FIREBASE_DATABASE_URL"`
+	ProjectID       string `env:"FIREBASE_PROJECT_ID"`
+	StorageBucket   string `env:"FIREBASE_STORAGE_BUCKET"`
+	MessageSenderID string `env:"FIREBASE_MESSAGE_SENDER_ID"`
+	AppID           string `env:"FIREBASE_APP_ID"`
+	MeasurementID   string `env:"FIREBASE_MEASUREMENT_ID"`
 
 	TermsOfServiceURL string `env:"FIREBASE_TERMS_OF_SERVICE_URL"`
 	PrivacyPolicyURL  string `env:"FIREBASE_PRIVACY_POLICY_URL"`
 }
 
+// Validate ensures the required firebase values are present.
+func (c *FirebaseConfig) Validate() error {
+	fields := []struct {
+		Var  string
+		Name string
+	}{
+		{c.APIKey, "FIREBASE_API_KEY"},
+		{c.AuthDomain, "FIREBASE_AUTH_DOMAIN"},
+		{c.DatabaseURL, "FIREBASE_DATABASE_URL"},
+		{c.ProjectID, "FIREBASE_PROJECT_ID"},
+		{c.StorageBucket, "FIREBASE_STORAGE_BUCKET"},
+		{c.MessageSenderID, "FIREBASE_MESSAGE_SENDER_ID"},
+		{c.AppID, "FIREBASE_APP_ID"},
+		{c.MeasurementID, "FIREBASE_MEASUREMENT_ID"},
+	}
+
+	for _, f := range fields {
+		if f.Var == "" {
+			return fmt.Errorf("%s is required", f.Name)
+		}
+	}
+	return nil
+}
+
 // FirebaseConfig returns the firebase SDK config based on the local env config.
 func (c *ServerConfig) FirebaseConfig() *firebase.Config {
 	return &firebase.Config{
@@ -224,3 +260,9 @@ func (c *ServerConfig) FirebaseConfig() *firebase.Config {
 		StorageBucket: c.Firebase.StorageBucket,
 	}
 }
+
+// PasswordAuthConfig returns the password auth provider config based on the
+// local env config.
+func (c *ServerConfig) PasswordAuthConfig() *auth.PasswordConfig {
+	return c.Auth.PasswordConfig(c.ServerEndpoint)
+}
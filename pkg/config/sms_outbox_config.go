@@ -0,0 +1,118 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/observability"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// SMSOutboxConfig represents the environment based configuration for the SMS
+// outbox worker.
+type SMSOutboxConfig struct {
+	Database      database.Config
+	Observability observability.Config
+
+	// DevMode produces additional debugging information. Do not enable in
+	// production environments.
+	DevMode bool `env:"DEV_MODE"`
+
+	// Port is the port on which to bind.
+	Port string `env:"PORT,default=8080"`
+
+	// MinPeriod is the minimum amount of time between delivery runs.
+	MinPeriod time.Duration `env:"SMS_OUTBOX_MIN_PERIOD, default=30s"`
+
+	// BatchSize is the maximum number of messages delivered per run.
+	BatchSize uint `env:"SMS_OUTBOX_BATCH_SIZE, default=500"`
+
+	// Concurrency is the maximum number of messages sent in parallel.
+	Concurrency uint `env:"SMS_OUTBOX_CONCURRENCY, default=10"`
+
+	// LeaseDuration is how long a message is held by a worker before it becomes
+	// eligible to be claimed again. This must be longer than the time it takes
+	// to send a batch.
+	LeaseDuration time.Duration `env:"SMS_OUTBOX_LEASE_DURATION, default=10m"`
+
+	// MaxAttempts is the maximum number of delivery attempts before a message is
+	// marked as failed.
+	MaxAttempts uint `env:"SMS_OUTBOX_MAX_ATTEMPTS, default=8"`
+
+	// RetryBaseDelay and RetryMaxDelay control the exponential backoff between
+	// delivery attempts. The delay doubles after each attempt, starting at the
+	// base delay, up to the max delay.
+	RetryBaseDelay time.Duration `env:"SMS_OUTBOX_RETRY_BASE_DELAY, default=30s"`
+	RetryMaxDelay  time.Duration `env:"SMS_OUTBOX_RETRY_MAX_DELAY, default=30m"`
+
+	// SMSStatusCallbackEndpoint is the public endpoint (scheme + host) of the
+	// server which hosts the webhooks. If set, SMS providers which support
+	// delivery status callbacks report the status of each message to it.
+	SMSStatusCallbackEndpoint string `env:"SMS_STATUS_CALLBACK_ENDPOINT"`
+}
+
+// NewSMSOutboxConfig returns the environment config for the SMS outbox
+// worker. Only needs to be called once per instance, but may be called
+// multiple times.
+func NewSMSOutboxConfig(ctx context.Context) (*SMSOutboxConfig, error) {
+	var config SMSOutboxConfig
+	if err := ProcessWith(ctx, &config, envconfig.OsLookuper()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *SMSOutboxConfig) Validate() error {
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.MinPeriod, "SMS_OUTBOX_MIN_PERIOD"},
+		{c.LeaseDuration, "SMS_OUTBOX_LEASE_DURATION"},
+		{c.RetryBaseDelay, "SMS_OUTBOX_RETRY_BASE_DELAY"},
+		{c.RetryMaxDelay, "SMS_OUTBOX_RETRY_MAX_DELAY"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	if c.BatchSize == 0 {
+		return fmt.Errorf("SMS_OUTBOX_BATCH_SIZE must be greater than 0")
+	}
+	if c.Concurrency == 0 {
+		return fmt.Errorf("SMS_OUTBOX_CONCURRENCY must be greater than 0")
+	}
+	if c.MaxAttempts == 0 {
+		return fmt.Errorf("SMS_OUTBOX_MAX_ATTEMPTS must be greater than 0")
+	}
+	if c.RetryMaxDelay < c.RetryBaseDelay {
+		return fmt.Errorf("SMS_OUTBOX_RETRY_MAX_DELAY must be at least SMS_OUTBOX_RETRY_BASE_DELAY")
+	}
+
+	return nil
+}
+
+func (c *SMSOutboxConfig) ObservabilityExporterConfig() *observability.Config {
+	return &c.Observability
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/observability"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// WebhookDispatcherConfig represents the environment based configuration for
+// the webhook dispatcher worker.
+type WebhookDispatcherConfig struct {
+	Database      database.Config
+	Observability observability.Config
+
+	// DevMode produces additional debugging information. Do not enable in
+	// production environments.
+	DevMode bool `env:"DEV_MODE"`
+
+	// Port is the port on which to bind.
+	Port string `env:"PORT,default=8080"`
+
+	// MinPeriod is the minimum amount of time between dispatch runs.
+	MinPeriod time.Duration `env:"WEBHOOK_DISPATCHER_MIN_PERIOD, default=30s"`
+
+	// BatchSize is the maximum number of deliveries attempted per run. It is
+	// also the maximum number of expired codes for which events are queued per
+	// run.
+	BatchSize uint `env:"WEBHOOK_DISPATCHER_BATCH_SIZE, default=500"`
+
+	// Concurrency is the maximum number of requests sent in parallel.
+	Concurrency uint `env:"WEBHOOK_DISPATCHER_CONCURRENCY, default=10"`
+
+	// RequestTimeout is the maximum amount of time to wait for a webhook
+	// endpoint to respond.
+	RequestTimeout time.Duration `env:"WEBHOOK_DISPATCHER_REQUEST_TIMEOUT, default=10s"`
+
+	// LeaseDuration is how long a delivery is held by a worker before it becomes
+	// eligible to be claimed again. This must be longer than the time it takes
+	// to send a batch.
+	LeaseDuration time.Duration `env:"WEBHOOK_DISPATCHER_LEASE_DURATION, default=10m"`
+
+	// MaxAttempts is the maximum number of delivery attempts before a delivery
+	// is marked as failed.
+	MaxAttempts uint `env:"WEBHOOK_DISPATCHER_MAX_ATTEMPTS, default=10"`
+
+	// RetryBaseDelay and RetryMaxDelay control the exponential backoff between
+	// delivery attempts. The delay doubles after each attempt, starting at the
+	// base delay, up to the max delay.
+	RetryBaseDelay time.Duration `env:"WEBHOOK_DISPATCHER_RETRY_BASE_DELAY, default=1m"`
+	RetryMaxDelay  time.Duration `env:"WEBHOOK_DISPATCHER_RETRY_MAX_DELAY, default=1h"`
+}
+
+// NewWebhookDispatcherConfig returns the environment config for the webhook
+// dispatcher worker. Only needs to be called once per instance, but may be
+// called multiple times.
+func NewWebhookDispatcherConfig(ctx context.Context) (*WebhookDispatcherConfig, error) {
+	var config WebhookDispatcherConfig
+	if err := ProcessWith(ctx, &config, envconfig.OsLookuper()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *WebhookDispatcherConfig) Validate() error {
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.MinPeriod, "WEBHOOK_DISPATCHER_MIN_PERIOD"},
+		{c.RequestTimeout, "WEBHOOK_DISPATCHER_REQUEST_TIMEOUT"},
+		{c.LeaseDuration, "WEBHOOK_DISPATCHER_LEASE_DURATION"},
+		{c.RetryBaseDelay, "WEBHOOK_DISPATCHER_RETRY_BASE_DELAY"},
+		{c.RetryMaxDelay, "WEBHOOK_DISPATCHER_RETRY_MAX_DELAY"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	if c.BatchSize == 0 {
+		return fmt.Errorf("WEBHOOK_DISPATCHER_BATCH_SIZE must be greater than 0")
+	}
+	if c.Concurrency == 0 {
+		return fmt.Errorf("WEBHOOK_DISPATCHER_CONCURRENCY must be greater than 0")
+	}
+	if c.MaxAttempts == 0 {
+		return fmt.Errorf("WEBHOOK_DISPATCHER_MAX_ATTEMPTS must be greater than 0")
+	}
+	if c.RetryMaxDelay < c.RetryBaseDelay {
+		return fmt.Errorf("WEBHOOK_DISPATCHER_RETRY_MAX_DELAY must be at least WEBHOOK_DISPATCHER_RETRY_BASE_DELAY")
+	}
+	if c.LeaseDuration <= c.RequestTimeout {
+		return fmt.Errorf("WEBHOOK_DISPATCHER_LEASE_DURATION must be greater than WEBHOOK_DISPATCHER_REQUEST_TIMEOUT")
+	}
+
+	return nil
+}
+
+func (c *WebhookDispatcherConfig) ObservabilityExporterConfig() *observability.Config {
+	return &c.Observability
+}
@@ -27,10 +27,14 @@ import (
 // HandleEmailUpdate creates or updates the Email config.
 func (c *Controller) HandleEmailUpdate() http.Handler {
 	type FormData struct {
-		SMTPAccount  string `form:"smtp_account"`
-		SMTPPassword string `form:"smtp_password"`
-		SMTPHost     string `form:"smtp_host"`
-		SMTPPort     string `form:"smtp_port"`
+		ProviderType    email.ProviderType `form:"email_provider_type"`
+		SMTPAccount     string             `form:"smtp_account"`
+		SMTPPassword    string             `form:"smtp_password"`
+		SMTPHost        string             `form:"smtp_host"`
+		SMTPPort        string             `form:"smtp_port"`
+		HTTPEndpoint    string             `form:"email_http_endpoint"`
+		HTTPAPIKey      string             `form:"email_http_api_key"`
+		HTTPFromAddress string             `form:"email_http_from_address"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -69,13 +73,30 @@ func (c *Controller) HandleEmailUpdate() http.Handler {
 		}
 
 		// Update
-		emailConfig.ProviderType = email.ProviderTypeSMTP
-		emailConfig.SMTPAccount = form.SMTPAccount
-		if form.SMTPPassword != project.PasswordSentinel {
-			emailConfig.SMTPPassword = form.SMTPPassword
+		emailConfig.ProviderType = form.ProviderType
+		if emailConfig.ProviderType == "" {
+			emailConfig.ProviderType = email.ProviderTypeSMTP
+		}
+
+		switch emailConfig.ProviderType {
+		case email.ProviderTypeSMTP:
+			emailConfig.SMTPAccount = form.SMTPAccount
+			if form.SMTPPassword != project.PasswordSentinel {
+				emailConfig.SMTPPassword = form.SMTPPassword
+			}
+			emailConfig.SMTPHost = form.SMTPHost
+			emailConfig.SMTPPort = form.SMTPPort
+		case email.ProviderTypeHTTP:
+			emailConfig.HTTPEndpoint = form.HTTPEndpoint
+			if form.HTTPAPIKey != project.PasswordSentinel {
+				emailConfig.HTTPAPIKey = form.HTTPAPIKey
+			}
+			emailConfig.HTTPFromAddress = form.HTTPFromAddress
+		default:
+			flash.Error("Unsupported email provider %q", emailConfig.ProviderType)
+			c.renderShowEmail(ctx, w, emailConfig)
+			return
 		}
-		emailConfig.SMTPHost = form.SMTPHost
-		emailConfig.SMTPPort = form.SMTPPort
 		if err := c.db.SaveEmailConfig(emailConfig); err != nil {
 			flash.Error("Failed to save system email config: %v", err)
 			c.renderShowEmail(ctx, w, emailConfig)
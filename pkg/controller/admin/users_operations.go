@@ -22,6 +22,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/gorilla/mux"
 )
 
@@ -220,7 +221,7 @@ func (c *Controller) HandleUserDelete() http.Handler {
 
 // inviteComposer returns an email composer function that invites a user using
 // the system email config.
-func (c *Controller) inviteComposer(ctx context.Context, email string) (auth.InviteUserEmailFunc, error) {
+func (c *Controller) inviteComposer(ctx context.Context, toEmail string) (auth.InviteUserEmailFunc, error) {
 	// Figure out email sending - since this is a system admin, only the system
 	// credentials can be used.
 	emailConfig, err := c.db.SystemEmailConfig()
@@ -240,18 +241,21 @@ func (c *Controller) inviteComposer(ctx context.Context, email string) (auth.Inv
 	// Return a function that does the actual sending.
 	return func(ctx context.Context, inviteLink string) error {
 		// Render the message invitation.
-		message, err := c.h.RenderEmail("email/invite", map[string]interface{}{
-			"ToEmail":    email,
-			"FromEmail":  emailer.From(),
+		msg := &email.Message{
+			From:    emailer.From(),
+			To:      toEmail,
+			Subject: controller.AccountEmailSubject,
+		}
+		message, err := controller.ComposeEmail(c.h, msg, "email/invite", "email/invite_html", map[string]interface{}{
 			"InviteLink": inviteLink,
 			"RealmName":  "System Admin",
 		})
 		if err != nil {
-			return fmt.Errorf("failed to render invite template: %w", err)
+			return fmt.Errorf("failed to compose invite email: %w", err)
 		}
 
 		// Send the message.
-		if err := emailer.SendEmail(ctx, email, message); err != nil {
+		if err := emailer.SendEmail(ctx, toEmail, message); err != nil {
 			return fmt.Errorf("failed to send email: %w", err)
 		}
 		return nil
@@ -0,0 +1,398 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleListAPI lists the API keys of the API key's realm, including disabled
+// API keys.
+func (c *Controller) HandleListAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("apikey.HandleListAPI")
+
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.APIKeyRead)
+		if !ok {
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		q := r.FormValue(QueryKeySearch)
+		apps, paginator, err := currentRealm.ListAuthorizedApps(c.db, pageParams, database.WithAuthorizedAppSearch(q))
+		if err != nil {
+			logger.Errorw("failed to list api keys", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		resp := &api.ListAPIKeysResponse{
+			APIKeys: make([]*api.APIKeyResponse, 0, len(apps)),
+		}
+		for _, app := range apps {
+			resp.APIKeys = append(resp.APIKeys, apiKeyResponse(app))
+		}
+		if paginator != nil && paginator.NextPage != nil {
+			resp.NextPage = paginator.NextPage.Number
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// HandleShowAPI shows an API key in the API key's realm.
+func (c *Controller) HandleShowAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.APIKeyRead)
+		if !ok {
+			return
+		}
+
+		app, ok := c.findAPIAuthorizedApp(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, apiKeyResponse(app))
+	})
+}
+
+// HandleCreateAPI creates an API key in the API key's realm. The new API key
+// can only be granted permissions the requesting API key has.
+func (c *Controller) HandleCreateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("apikey.HandleCreateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.APIKeyWrite)
+		if !ok {
+			return
+		}
+
+		var request api.CreateAPIKeyRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		permissions, err := compilePermissions(authApp, request.Permissions)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		testTypes, err := parseTestTypes(request.AllowedTestTypes)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		newApp := &database.AuthorizedApp{
+			Name:             request.Name,
+			APIKeyType:       parseAPIKeyType(request.Type),
+			Permissions:      permissions,
+			AllowedTestTypes: testTypes,
+
+			RequestsPerMinute: request.RequestsPerMinute,
+			DailyIssueLimit:   request.DailyIssueLimit,
+		}
+		setScopes(newApp, request.Scopes)
+		if err := setAllowedCIDRs(newApp, strings.Join(request.AllowedCIDRs, ",")); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+		if err := setExpiresOn(newApp, request.ExpiresOn); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+		apiKey, err := currentRealm.CreateAuthorizedApp(c.db, newApp, authApp)
+		if err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(newApp.ErrorMessages(), ", ")))
+				return
+			}
+
+			logger.Errorw("failed to create api key", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &api.CreateAPIKeyResponse{
+			APIKeyResponse: *apiKeyResponse(newApp),
+			APIKey:         apiKey,
+		})
+	})
+}
+
+// HandleUpdateAPI updates an API key in the API key's realm. The API key can
+// only be granted permissions the requesting API key has.
+func (c *Controller) HandleUpdateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("apikey.HandleUpdateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.APIKeyWrite)
+		if !ok {
+			return
+		}
+
+		app, ok := c.findAPIAuthorizedApp(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		var request api.UpdateAPIKeyRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		if request.Name != nil {
+			app.Name = *request.Name
+		}
+
+		if request.Permissions != nil {
+			permissions, err := compilePermissions(authApp, request.Permissions)
+			if err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+			app.Permissions = permissions
+		}
+
+		if request.Scopes != nil {
+			setScopes(app, request.Scopes)
+		}
+
+		if request.AllowedTestTypes != nil {
+			testTypes, err := parseTestTypes(request.AllowedTestTypes)
+			if err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+			app.AllowedTestTypes = testTypes
+		}
+
+		if request.AllowedCIDRs != nil {
+			if err := setAllowedCIDRs(app, strings.Join(request.AllowedCIDRs, ",")); err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+		}
+
+		if request.ExpiresOn != nil {
+			if err := setExpiresOn(app, *request.ExpiresOn); err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+		}
+
+		if request.RequestsPerMinute != nil {
+			app.RequestsPerMinute = *request.RequestsPerMinute
+		}
+
+		if request.DailyIssueLimit != nil {
+			app.DailyIssueLimit = *request.DailyIssueLimit
+		}
+
+		if request.Disabled != nil {
+			switch {
+			case *request.Disabled && app.DeletedAt == nil:
+				now := time.Now().UTC()
+				app.DeletedAt = &now
+			case !*request.Disabled:
+				app.DeletedAt = nil
+			}
+		}
+
+		if err := c.db.SaveAuthorizedApp(app, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(app.ErrorMessages(), ", ")))
+				return
+			}
+
+			logger.Errorw("failed to update api key", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, apiKeyResponse(app))
+	})
+}
+
+// HandleRotateAPI issues a new API key for an API key in the API key's realm.
+// The requesting API key must have all of the rotated API key's permissions.
+func (c *Controller) HandleRotateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("apikey.HandleRotateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.APIKeyWrite)
+		if !ok {
+			return
+		}
+
+		app, ok := c.findAPIAuthorizedApp(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		if _, err := rbac.CompileAndAuthorize(authApp.Permissions, rbac.Permissions(app.Permissions)); err != nil {
+			c.h.RenderJSON(w, http.StatusUnauthorized, api.Error(err))
+			return
+		}
+
+		var request api.RotateAPIKeyRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		gracePeriod := time.Duration(request.GracePeriodHours) * time.Hour
+		if gracePeriod < 0 || gracePeriod > database.MaxAPIKeyRotationGracePeriod {
+			c.h.RenderJSON(w, http.StatusBadRequest,
+				api.Errorf("gracePeriodHours must be between 0 and %d", int(database.MaxAPIKeyRotationGracePeriod.Hours())))
+			return
+		}
+
+		apiKey, err := currentRealm.RotateAuthorizedApp(c.db, app, gracePeriod, authApp)
+		if err != nil {
+			logger.Errorw("failed to rotate api key", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &api.CreateAPIKeyResponse{
+			APIKeyResponse: *apiKeyResponse(app),
+			APIKey:         apiKey,
+		})
+	})
+}
+
+// findAPIAuthorizedApp finds the API key in the request path, rendering the
+// appropriate error and returning false if it does not exist in the realm.
+func (c *Controller) findAPIAuthorizedApp(w http.ResponseWriter, r *http.Request, realm *database.Realm) (*database.AuthorizedApp, bool) {
+	logger := logging.FromContext(r.Context()).Named("apikey.findAPIAuthorizedApp")
+
+	app, err := realm.FindAuthorizedApp(c.db, mux.Vars(r)["id"])
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("api key not found"))
+			return nil, false
+		}
+
+		logger.Errorw("failed to find api key", "error", err)
+		c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+		return nil, false
+	}
+	return app, true
+}
+
+// compilePermissions compiles the named permissions. The requesting API key
+// must have all of the permissions being granted.
+func compilePermissions(authApp *database.AuthorizedApp, names []string) (rbac.Permission, error) {
+	permissions, err := rbac.PermissionsFromNames(names)
+	if err != nil {
+		return 0, err
+	}
+	return rbac.CompileAndAuthorize(authApp.Permissions, permissions)
+}
+
+// parseAPIKeyType parses the display name of an API key type, returning
+// APIKeyTypeInvalid if it is unknown.
+func parseAPIKeyType(s string) database.APIKeyType {
+	for _, t := range []database.APIKeyType{
+		database.APIKeyTypeDevice,
+		database.APIKeyTypeAdmin,
+		database.APIKeyTypeStats,
+	} {
+		if strings.EqualFold(s, t.Display()) {
+			return t
+		}
+	}
+	return database.APIKeyTypeInvalid
+}
+
+// parseTestTypes parses the names of test types.
+func parseTestTypes(names []string) (database.TestType, error) {
+	var result database.TestType
+	for _, name := range names {
+		found := false
+		for _, t := range testTypes {
+			if strings.EqualFold(name, t.Display()) {
+				result |= t
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown test type %q", name)
+		}
+	}
+	return result, nil
+}
+
+// apiKeyResponse builds the API representation of the API key.
+func apiKeyResponse(app *database.AuthorizedApp) *api.APIKeyResponse {
+	resp := &api.APIKeyResponse{
+		ID:                 app.ID,
+		Name:               app.Name,
+		Type:               app.APIKeyType.Display(),
+		Preview:            app.APIKeyPreview,
+		Permissions:        app.PermissionNames(),
+		Scopes:             app.Scopes,
+		AllowedTestTypes:   app.AllowedTestTypes.Names(),
+		AllowedCIDRs:       app.AllowedCIDRs,
+		ExpiresOn:          app.ExpiresOn(),
+		RequestsPerMinute:  app.RequestsPerMinute,
+		DailyIssueLimit:    app.DailyIssueLimit,
+		Disabled:           app.DeletedAt != nil,
+		CreatedAtTimestamp: app.CreatedAt.UTC().Unix(),
+	}
+	if app.LastUsedAt != nil {
+		resp.LastUsedAtTimestamp = app.LastUsedAt.UTC().Unix()
+	}
+	if app.RotatedAt != nil {
+		resp.RotatedAtTimestamp = app.RotatedAt.UTC().Unix()
+	}
+	if app.HasPreviousAPIKey() {
+		resp.PreviousPreview = app.PreviousAPIKeyPreview
+		resp.PreviousExpiresAtTimestamp = app.PreviousAPIKeyExpiresAt.UTC().Unix()
+		if app.PreviousAPIKeyLastUsedAt != nil {
+			resp.PreviousLastUsedAtTimestamp = app.PreviousAPIKeyLastUsedAt.UTC().Unix()
+		}
+	}
+	return resp
+}
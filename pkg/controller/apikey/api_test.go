@@ -0,0 +1,271 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/apikey"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleAPIKeysAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	realm := database.NewRealmWithDefaults("API keys API")
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := apikey.New(harness.Cacher, db, harness.Renderer)
+
+	// serve serves the request as an admin API key with the given permissions.
+	serve := func(tb testing.TB, permissions rbac.Permission, handler http.Handler, meth, id string, body interface{}) *httptest.ResponseRecorder {
+		tb.Helper()
+
+		ctx := ctx
+		ctx = controller.WithAuthorizedApp(ctx, &database.AuthorizedApp{
+			RealmID:     realm.ID,
+			Name:        "Terraform",
+			APIKeyType:  database.APIKeyTypeAdmin,
+			Permissions: permissions,
+		})
+		ctx = controller.WithRealm(ctx, realm)
+
+		w, r := envstest.BuildJSONRequest(ctx, tb, meth, "/", body)
+		if id != "" {
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+		}
+		harness.WithCommonMiddlewares(handler).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("permission_missing", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, 0, c.HandleListAPI(), http.MethodGet, "", nil)
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.APIKeyWrite|rbac.APIKeyRead, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateAPIKeyRequest{
+			Name:        "Escalation",
+			Type:        "admin",
+			Permissions: []string{"UserWrite"},
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.LegacyRealmAdmin, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateAPIKeyRequest{
+			Name:        "Device with permissions",
+			Type:        "device",
+			Permissions: []string{"CodeIssue"},
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("restrictions", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.LegacyRealmAdmin, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateAPIKeyRequest{
+			Name:             "Status checker",
+			Type:             "admin",
+			Scopes:           []string{"checkcodestatus"},
+			AllowedTestTypes: []string{"likely"},
+			AllowedCIDRs:     []string{"10.0.0.1"},
+			ExpiresOn:        "2999-01-31",
+
+			RequestsPerMinute: 60,
+			DailyIssueLimit:   500,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var created api.CreateAPIKeyResponse
+		decodeJSON(t, w, &created)
+		if got, want := created.Scopes, []string{"checkcodestatus"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := created.AllowedTestTypes, []string{"likely"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := created.AllowedCIDRs, []string{"10.0.0.1/32"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := created.ExpiresOn, "2999-01-31"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := created.RequestsPerMinute, uint(60); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := created.DailyIssueLimit, uint(500); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		w = serve(t, rbac.LegacyRealmAdmin, c.HandleUpdateAPI(), http.MethodPatch, fmt.Sprint(created.ID), &api.UpdateAPIKeyRequest{
+			Scopes: []string{},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var updated api.APIKeyResponse
+		decodeJSON(t, w, &updated)
+		if got := updated.Scopes; len(got) != 0 {
+			t.Errorf("expected no scopes, got %v", got)
+		}
+		if got, want := updated.AllowedCIDRs, []string{"10.0.0.1/32"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.LegacyRealmAdmin, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateAPIKeyRequest{
+			Name: "Rotated",
+			Type: "device",
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var created api.CreateAPIKeyResponse
+		decodeJSON(t, w, &created)
+		id := fmt.Sprint(created.ID)
+
+		// Grace period is too long.
+		w = serve(t, rbac.LegacyRealmAdmin, c.HandleRotateAPI(), http.MethodPost, id, &api.RotateAPIKeyRequest{
+			GracePeriodHours: 24 * 31,
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w = serve(t, rbac.LegacyRealmAdmin, c.HandleRotateAPI(), http.MethodPost, id, &api.RotateAPIKeyRequest{
+			GracePeriodHours: 24,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var rotated api.CreateAPIKeyResponse
+		decodeJSON(t, w, &rotated)
+		if got, want := rotated.ID, created.ID; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := rotated.PreviousPreview, created.Preview; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if rotated.RotatedAtTimestamp == 0 {
+			t.Errorf("expected rotatedAtTimestamp")
+		}
+
+		for _, key := range []string{created.APIKey, rotated.APIKey} {
+			app, err := db.FindAuthorizedAppByAPIKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := app.ID, created.ID; got != want {
+				t.Errorf("expected %v to be %v", got, want)
+			}
+		}
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		permissions := rbac.LegacyRealmAdmin
+
+		w := serve(t, permissions, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateAPIKeyRequest{
+			Name:        "Lab",
+			Type:        "admin",
+			Permissions: []string{"CodeIssue"},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var created api.CreateAPIKeyResponse
+		decodeJSON(t, w, &created)
+		if created.APIKey == "" {
+			t.Errorf("expected api key")
+		}
+		if got, want := created.Permissions, []string{"CodeIssue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+
+		app, err := db.FindAuthorizedAppByAPIKey(created.APIKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := app.ID, created.ID; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		disabled := true
+		w = serve(t, permissions, c.HandleUpdateAPI(), http.MethodPatch, fmt.Sprint(created.ID), &api.UpdateAPIKeyRequest{
+			Permissions: []string{"CodeIssue", "CodeRead"},
+			Disabled:    &disabled,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var updated api.APIKeyResponse
+		decodeJSON(t, w, &updated)
+		if got, want := updated.Permissions, []string{"CodeIssue", "CodeRead"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if !updated.Disabled {
+			t.Errorf("expected api key to be disabled")
+		}
+	})
+}
+
+func decodeJSON(tb testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	tb.Helper()
+
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		tb.Fatal(err)
+	}
+}
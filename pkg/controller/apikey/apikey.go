@@ -16,11 +16,23 @@
 package apikey
 
 import (
+	"fmt"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 )
 
+// testTypes are the test types to which an admin API key can be restricted, in
+// display order.
+var testTypes = []database.TestType{
+	database.TestTypeConfirmed,
+	database.TestTypeLikely,
+	database.TestTypeNegative,
+	database.TestTypeUserReport,
+}
+
 type Controller struct {
 	cacher cache.Cacher
 	db     *database.Database
@@ -34,3 +46,48 @@ func New(cacher cache.Cacher, db *database.Database, h *render.Renderer) *Contro
 		h:      h,
 	}
 }
+
+// setScopes restricts the API key to the given scopes. No scopes removes the
+// restriction.
+func setScopes(app *database.AuthorizedApp, scopes []string) {
+	app.Scopes = nil
+	if len(scopes) > 0 {
+		app.Scopes = scopes
+	}
+}
+
+// setAllowedCIDRs restricts the API key to the given newline or
+// comma-separated CIDR blocks. No CIDR blocks removes the restriction.
+func setAllowedCIDRs(app *database.AuthorizedApp, cidrs string) error {
+	allowedCIDRs, err := database.ToCIDRList(cidrs)
+	if err != nil {
+		return fmt.Errorf("allowed CIDRs are invalid: %w", err)
+	}
+	app.AllowedCIDRs = allowedCIDRs
+	return nil
+}
+
+// setExpiresOn sets the last day (YYYY-MM-DD) on which the API key works. An
+// empty date removes the expiry. An unchanged date is not validated again, so
+// an expired API key can still be edited.
+func setExpiresOn(app *database.AuthorizedApp, expiresOn string) error {
+	if project.TrimSpace(expiresOn) == app.ExpiresOn() {
+		return nil
+	}
+
+	expiresAt, err := database.ParseExpiresOn(expiresOn)
+	if err != nil {
+		return err
+	}
+	app.ExpiresAt = expiresAt
+	return nil
+}
+
+// joinTestTypes combines the test types selected in a form.
+func joinTestTypes(testTypes []database.TestType) database.TestType {
+	var t database.TestType
+	for _, v := range testTypes {
+		t |= v
+	}
+	return t
+}
@@ -56,7 +56,7 @@ func (c *Controller) HandleCreate() http.Handler {
 		}
 
 		var authApp database.AuthorizedApp
-		if err := bindCreateForm(r, &authApp); err != nil {
+		if err := bindCreateForm(r, membership, &authApp); err != nil {
 			authApp.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			c.renderNew(ctx, w, &authApp)
@@ -84,17 +84,44 @@ func (c *Controller) HandleCreate() http.Handler {
 	})
 }
 
-func bindCreateForm(r *http.Request, app *database.AuthorizedApp) error {
+// bindCreateForm binds the API key form. The current membership must have all
+// of the permissions being granted to the API key.
+func bindCreateForm(r *http.Request, currentMembership *database.Membership, app *database.AuthorizedApp) error {
 	type FormData struct {
-		Name string              `form:"name"`
-		Type database.APIKeyType `form:"type"`
+		Name             string              `form:"name"`
+		Type             database.APIKeyType `form:"type"`
+		Permissions      []rbac.Permission   `form:"permissions"`
+		Scopes           []string            `form:"scopes"`
+		AllowedTestTypes []database.TestType `form:"allowed_test_types"`
+		AllowedCIDRs     string              `form:"allowed_cidrs"`
+		ExpiresOn        string              `form:"expires_on"`
+
+		RequestsPerMinute uint `form:"requests_per_minute"`
+		DailyIssueLimit   uint `form:"daily_issue_limit"`
 	}
 
 	var form FormData
-	err := controller.BindForm(nil, r, &form)
+	formErr := controller.BindForm(nil, r, &form)
 	app.Name = form.Name
 	app.APIKeyType = form.Type
-	return err
+	app.RequestsPerMinute = form.RequestsPerMinute
+	app.DailyIssueLimit = form.DailyIssueLimit
+	setScopes(app, form.Scopes)
+	app.AllowedTestTypes = joinTestTypes(form.AllowedTestTypes)
+
+	permissions, rbacErr := rbac.CompileAndAuthorize(currentMembership.Permissions, form.Permissions)
+	app.Permissions = permissions
+
+	if formErr != nil {
+		return formErr
+	}
+	if rbacErr != nil {
+		return rbacErr
+	}
+	if err := setAllowedCIDRs(app, form.AllowedCIDRs); err != nil {
+		return err
+	}
+	return setExpiresOn(app, form.ExpiresOn)
 }
 
 // renderNew renders the edit page.
@@ -105,5 +132,8 @@ func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, authA
 	m["typeAdmin"] = database.APIKeyTypeAdmin
 	m["typeDevice"] = database.APIKeyTypeDevice
 	m["typeStats"] = database.APIKeyTypeStats
+	m["permissions"] = rbac.NamePermissionMap
+	m["scopes"] = database.APIKeyScopes
+	m["testTypes"] = testTypes
 	c.h.RenderHTML(w, "apikeys/new", m)
 }
@@ -0,0 +1,170 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// rotateGracePeriods are the grace periods offered when rotating an API key
+// from the UI.
+var rotateGracePeriods = []struct {
+	Hours int
+	Name  string
+}{
+	{0, "None (revoke the current API key immediately)"},
+	{1, "1 hour"},
+	{24, "24 hours"},
+	{7 * 24, "7 days"},
+	{30 * 24, "30 days"},
+}
+
+// HandleRotate issues a new API key for the authorized app. The previous API
+// key continues to work for the selected grace period.
+func (c *Controller) HandleRotate() http.Handler {
+	type FormData struct {
+		GracePeriodHours int `form:"grace_period_hours"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.APIKeyWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		authApp, err := currentRealm.FindAuthorizedApp(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		showPath := fmt.Sprintf("/realm/apikeys/%d", authApp.ID)
+
+		// Rotating reveals a new API key, so the user must have all of the API
+		// key's permissions to prevent privilege escalation.
+		if _, err := rbac.CompileAndAuthorize(membership.Permissions, rbac.Permissions(authApp.Permissions)); err != nil {
+			flash.Error("Failed to rotate API key: you do not have all of the API key's permissions")
+			http.Redirect(w, r, showPath, http.StatusSeeOther)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			http.Redirect(w, r, showPath, http.StatusSeeOther)
+			return
+		}
+
+		gracePeriod := time.Duration(form.GracePeriodHours) * time.Hour
+		apiKey, err := currentRealm.RotateAuthorizedApp(c.db, authApp, gracePeriod, currentUser)
+		if err != nil {
+			flash.Error("Failed to rotate API key: %v", err)
+			http.Redirect(w, r, showPath, http.StatusSeeOther)
+			return
+		}
+
+		// Store the API key on the session temporarily so it can be displayed on
+		// the next page.
+		session.Values["apiKey"] = apiKey
+
+		if authApp.HasPreviousAPIKey() {
+			flash.Alert("Successfully rotated API key %q, the previous API key works until %s",
+				authApp.Name, authApp.PreviousAPIKeyExpiresAt.UTC().Format(time.RFC1123))
+		} else {
+			flash.Alert("Successfully rotated API key %q", authApp.Name)
+		}
+		http.Redirect(w, r, showPath, http.StatusSeeOther)
+	})
+}
+
+// HandleRevokePrevious revokes the API key replaced by the most recent
+// rotation before its grace period ends.
+func (c *Controller) HandleRevokePrevious() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.APIKeyWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		authApp, err := currentRealm.FindAuthorizedApp(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		showPath := fmt.Sprintf("/realm/apikeys/%d", authApp.ID)
+
+		authApp.ClearPreviousAPIKey()
+		if err := c.db.SaveAuthorizedApp(authApp, currentUser); err != nil {
+			flash.Error("Failed to revoke previous API key: %v", err)
+			http.Redirect(w, r, showPath, http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Successfully revoked the previous API key for %q", authApp.Name)
+		http.Redirect(w, r, showPath, http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/apikey"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleRotate(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := apikey.New(harness.Cacher, harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleRotate())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+		envstest.ExerciseIDNotFound(t, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		}, handler)
+	})
+
+	t.Run("internal_error", func(t *testing.T) {
+		t.Parallel()
+
+		realm, err := harness.Database.FindRealm(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authApp := &database.AuthorizedApp{
+			RealmID: realm.ID,
+			Name:    "Rotate1",
+		}
+		if _, err := realm.CreateAuthorizedApp(harness.Database, authApp, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		c := apikey.New(harness.Cacher, harness.BadDatabase, harness.Renderer)
+		handler := c.HandleRotate()
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", authApp.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusInternalServerError; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		t.Parallel()
+
+		realm, err := harness.Database.FindRealm(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authApp := &database.AuthorizedApp{
+			RealmID:     realm.ID,
+			Name:        "Rotate2",
+			APIKeyType:  database.APIKeyTypeAdmin,
+			Permissions: rbac.UserWrite,
+		}
+		if _, err := realm.CreateAuthorizedApp(harness.Database, authApp, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		session := &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, session)
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", &url.Values{
+			"grace_period_hours": []string{"24"},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", authApp.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+		if _, ok := session.Values["apiKey"]; ok {
+			t.Errorf("expected no apiKey in session")
+		}
+
+		record, err := harness.Database.FindAuthorizedApp(authApp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := record.APIKey, authApp.APIKey; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		realm, err := harness.Database.FindRealm(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authApp := &database.AuthorizedApp{
+			RealmID: realm.ID,
+			Name:    "Rotate3",
+		}
+		oldAPIKey, err := realm.CreateAuthorizedApp(harness.Database, authApp, database.SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session := &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, session)
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", &url.Values{
+			"grace_period_hours": []string{"24"},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", authApp.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+
+		apiKey, ok := session.Values["apiKey"].(string)
+		if !ok {
+			t.Fatalf("expected apiKey in session: %#v", session.Values)
+		}
+
+		// Ensure both API keys are valid for the same app.
+		for _, key := range []string{apiKey, oldAPIKey} {
+			record, err := harness.Database.FindAuthorizedAppByAPIKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := record.ID, authApp.ID; got != want {
+				t.Errorf("expected %v to be %v", got, want)
+			}
+		}
+	})
+}
+
+func TestHandleRevokePrevious(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := apikey.New(harness.Cacher, harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleRevokePrevious())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+		envstest.ExerciseIDNotFound(t, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		}, handler)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		realm, err := harness.Database.FindRealm(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authApp := &database.AuthorizedApp{
+			RealmID: realm.ID,
+			Name:    "Revoke1",
+		}
+		oldAPIKey, err := realm.CreateAuthorizedApp(harness.Database, authApp, database.SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := realm.RotateAuthorizedApp(harness.Database, authApp, time.Hour, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.APIKeyWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPatch, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", authApp.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+
+		// Ensure the previous API key no longer works.
+		if _, err := harness.Database.FindAuthorizedAppByAPIKey(oldAPIKey); !database.IsNotFound(err) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+}
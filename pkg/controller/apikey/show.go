@@ -82,5 +82,6 @@ func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, auth
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("API key: %s", authApp.Name)
 	m["authApp"] = authApp
+	m["gracePeriods"] = rotateGracePeriods
 	c.h.RenderHTML(w, "apikeys/show", m)
 }
@@ -68,7 +68,7 @@ func (c *Controller) HandleUpdate() http.Handler {
 			return
 		}
 
-		if err := bindUpdateForm(r, authApp); err != nil {
+		if err := bindUpdateForm(r, membership, authApp); err != nil {
 			authApp.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			c.renderNew(ctx, w, authApp)
@@ -91,15 +91,44 @@ func (c *Controller) HandleUpdate() http.Handler {
 	})
 }
 
-func bindUpdateForm(r *http.Request, app *database.AuthorizedApp) error {
+// bindUpdateForm binds the API key form. Only admin API keys have permissions,
+// and the current membership must have all of the permissions being granted.
+func bindUpdateForm(r *http.Request, currentMembership *database.Membership, app *database.AuthorizedApp) error {
 	type FormData struct {
-		Name string `form:"name"`
+		Name             string              `form:"name"`
+		Permissions      []rbac.Permission   `form:"permissions"`
+		Scopes           []string            `form:"scopes"`
+		AllowedTestTypes []database.TestType `form:"allowed_test_types"`
+		AllowedCIDRs     string              `form:"allowed_cidrs"`
+		ExpiresOn        string              `form:"expires_on"`
+
+		RequestsPerMinute uint `form:"requests_per_minute"`
+		DailyIssueLimit   uint `form:"daily_issue_limit"`
 	}
 
 	var form FormData
-	err := controller.BindForm(nil, r, &form)
+	formErr := controller.BindForm(nil, r, &form)
 	app.Name = form.Name
-	return err
+	app.RequestsPerMinute = form.RequestsPerMinute
+
+	var rbacErr error
+	if app.IsAdminType() {
+		app.Permissions, rbacErr = rbac.CompileAndAuthorize(currentMembership.Permissions, form.Permissions)
+		setScopes(app, form.Scopes)
+		app.AllowedTestTypes = joinTestTypes(form.AllowedTestTypes)
+		app.DailyIssueLimit = form.DailyIssueLimit
+	}
+
+	if formErr != nil {
+		return formErr
+	}
+	if rbacErr != nil {
+		return rbacErr
+	}
+	if err := setAllowedCIDRs(app, form.AllowedCIDRs); err != nil {
+		return err
+	}
+	return setExpiresOn(app, form.ExpiresOn)
 }
 
 // renderEdit renders the edit page.
@@ -107,5 +136,8 @@ func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, auth
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Edit API key: %s", authApp.Name)
 	m["authApp"] = authApp
+	m["permissions"] = rbac.NamePermissionMap
+	m["scopes"] = database.APIKeyScopes
+	m["testTypes"] = testTypes
 	c.h.RenderHTML(w, "apikeys/edit", m)
 }
@@ -119,6 +119,32 @@ func (c *Controller) HandleCleanup() http.Handler {
 			}
 		}()
 
+		// Membership expiry warnings
+		func() {
+			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "MEMBERSHIP_EXPIRY_WARNING")
+			if count, err := c.warnExpiringMemberships(ctx); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to warn expiring memberships: %w", err))
+				result = enobs.ResultError("FAILED")
+			} else {
+				logger.Infow("warned expiring memberships", "count", count)
+				result = enobs.ResultOK
+			}
+		}()
+
+		// Expired memberships
+		func() {
+			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "MEMBERSHIP_EXPIRED")
+			if count, err := c.db.RevokeExpiredMemberships(); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to revoke expired memberships: %w", err))
+				result = enobs.ResultError("FAILED")
+			} else {
+				logger.Infow("revoked expired memberships", "count", count)
+				result = enobs.ResultOK
+			}
+		}()
+
 		// Mobile apps
 		func() {
 			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
@@ -301,6 +327,45 @@ func (c *Controller) HandleCleanup() http.Handler {
 			}
 		}()
 
+		// Webhook deliveries
+		func() {
+			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "WEBHOOK_DELIVERY")
+			if count, err := c.db.PurgeWebhookDeliveries(c.config.WebhookDeliveryMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge webhook deliveries: %w", err))
+				result = enobs.ResultError("FAILED")
+			} else {
+				logger.Infow("purged webhook deliveries", "count", count)
+				result = enobs.ResultOK
+			}
+		}()
+
+		// Jobs
+		func() {
+			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "JOB")
+			if count, err := c.db.PurgeJobs(c.config.JobMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge jobs: %w", err))
+				result = enobs.ResultError("FAILED")
+			} else {
+				logger.Infow("purged jobs", "count", count)
+				result = enobs.ResultOK
+			}
+		}()
+
+		// User tokens
+		func() {
+			defer enobs.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "USER_TOKEN")
+			if count, err := c.db.PurgeUserTokens(c.config.UserTokenMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge user tokens: %w", err))
+				result = enobs.ResultError("FAILED")
+			} else {
+				logger.Infow("purged user tokens", "count", count)
+				result = enobs.ResultOK
+			}
+		}()
+
 		// If there are any errors, return them
 		if errs := merr.WrappedErrors(); len(errs) > 0 {
 			logger.Errorw("failed to cleanup", "errors", errs)
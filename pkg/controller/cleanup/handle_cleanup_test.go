@@ -238,6 +238,64 @@ func TestHandleCleanup(t *testing.T) {
 		}
 	})
 
+	t.Run("expired_memberships", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		realm, err := db.FindRealm(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := New(config, db, keyManagerSigner, h)
+
+		expired := &database.User{
+			Email: "expired@example.com",
+			Name:  "expired",
+		}
+		if err := db.SaveUser(expired, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		if err := expired.AddToRealm(db, realm, rbac.CodeIssue, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		past := time.Now().UTC().Add(-1 * time.Hour)
+		if err := expired.UpdateMembershipExpiry(db, realm, &past, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		current := &database.User{
+			Email: "current@example.com",
+			Name:  "current",
+		}
+		if err := db.SaveUser(current, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		if err := current.AddToRealm(db, realm, rbac.CodeIssue, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		future := time.Now().UTC().Add(24 * time.Hour)
+		if err := current.UpdateMembershipExpiry(db, realm, &future, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		w, r := envstest.BuildJSONRequest(ctx, t, http.MethodGet, "/", nil)
+		c.HandleCleanup().ServeHTTP(w, r)
+
+		memberships, _, err := realm.ListMemberships(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the expired membership should be deleted.
+		if got, want := len(memberships), 1; got != want {
+			t.Fatalf("got %d memberships, expected %d: %#v", got, want, memberships)
+		}
+		if got, want := memberships[0].UserID, current.ID; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
 	t.Run("mobile_apps", func(t *testing.T) {
 		t.Parallel()
 
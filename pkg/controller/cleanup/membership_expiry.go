@@ -0,0 +1,143 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/hashicorp/go-multierror"
+)
+
+// membershipExpiringSubject is the subject of membership expiry warnings.
+const membershipExpiringSubject = "Your Exposure Notifications Verification Server access is expiring"
+
+// warnExpiringMemberships emails the user and the realm's user administrators
+// for each membership that expires within the configured warning period. It
+// returns the number of memberships for which a warning was sent.
+func (c *Controller) warnExpiringMemberships(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx).Named("cleanup.warnExpiringMemberships")
+
+	memberships, err := c.db.ListExpiringMemberships(c.config.MembershipExpiryWarning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expiring memberships: %w", err)
+	}
+
+	var merr *multierror.Error
+	var count int
+
+	// Memberships are ordered by realm, so the email provider and admins are
+	// only looked up once per realm.
+	var realmID uint
+	var emailer email.Provider
+	var admins []string
+
+	for _, membership := range memberships {
+		realm := membership.Realm
+
+		if realm.ID != realmID {
+			realmID = realm.ID
+
+			emailer, err = realm.EmailProvider(c.db)
+			if err != nil {
+				if !database.IsNotFound(err) {
+					merr = multierror.Append(merr, fmt.Errorf("failed to create email provider for realm %d: %w", realm.ID, err))
+				}
+				emailer = nil
+			}
+
+			admins, err = realm.ListMemberEmails(c.db, rbac.UserWrite)
+			if err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to list admins for realm %d: %w", realm.ID, err))
+				admins = nil
+			}
+		}
+
+		// Without an email provider there is no way to warn anyone. Mark the
+		// membership so it is not retried every run.
+		if emailer == nil {
+			logger.Debugw("realm has no email provider, skipping expiry warning",
+				"realm_id", realm.ID, "user_id", membership.UserID)
+			if err := c.db.MarkMembershipExpiryNotified(membership); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to mark membership expiry notified: %w", err))
+			}
+			continue
+		}
+
+		if err := c.sendMembershipExpiring(ctx, emailer, membership, admins); err != nil {
+			merr = multierror.Append(merr, err)
+			continue
+		}
+
+		if err := c.db.MarkMembershipExpiryNotified(membership); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to mark membership expiry notified: %w", err))
+			continue
+		}
+		count++
+	}
+
+	return count, merr.ErrorOrNil()
+}
+
+// sendMembershipExpiring sends the expiry warning for the membership to the
+// user and to each of the given admins.
+func (c *Controller) sendMembershipExpiring(ctx context.Context, emailer email.Provider, membership *database.Membership, admins []string) error {
+	user := membership.User
+
+	send := func(to string, admin bool) error {
+		msg := &email.Message{
+			From:    emailer.From(),
+			To:      to,
+			Subject: membershipExpiringSubject,
+		}
+
+		message, err := controller.ComposeEmail(c.h, msg, "email/membership_expiring", "email/membership_expiring_html", map[string]interface{}{
+			"Admin":     admin,
+			"RealmName": membership.Realm.Name,
+			"UserName":  user.Name,
+			"UserEmail": user.Email,
+			"ExpiresOn": membership.ExpiresOn(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to compose membership expiry email: %w", err)
+		}
+
+		if err := emailer.SendEmail(ctx, to, message); err != nil {
+			return fmt.Errorf("failed to send membership expiry email: %w", err)
+		}
+		return nil
+	}
+
+	if err := send(user.Email, false); err != nil {
+		return err
+	}
+
+	var merr *multierror.Error
+	for _, admin := range admins {
+		// Admins whose own membership is expiring get the member warning.
+		if admin == user.Email {
+			continue
+		}
+		if err := send(admin, true); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr.ErrorOrNil()
+}
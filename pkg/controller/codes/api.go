@@ -16,13 +16,22 @@ package codes
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
 
 func (c *Controller) HandleCheckCodeStatus() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("codes.HandleCheckCodeStatus")
+
 		var request api.CheckCodeStatusRequest
 		if err := controller.BindJSON(w, r, &request); err != nil {
 			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
@@ -35,11 +44,126 @@ func (c *Controller) HandleCheckCodeStatus() http.Handler {
 			return
 		}
 
+		deliveryStatus, dErr := c.smsDeliveryStatus(code)
+		if dErr != nil {
+			logger.Errorw("failed to lookup sms delivery status", "error", dErr)
+			c.h.RenderJSON(w, http.StatusInternalServerError,
+				api.Errorf("failed to check otp code status, please try again").WithCode(api.ErrInternal))
+			return
+		}
+
 		c.h.RenderJSON(w, http.StatusOK,
 			&api.CheckCodeStatusResponse{
 				Claimed:                code.Claimed,
 				ExpiresAtTimestamp:     code.ExpiresAt.UTC().Unix(),
 				LongExpiresAtTimestamp: code.LongExpiresAt.UTC().Unix(),
+				DeliveryStatus:         deliveryStatus,
 			})
 	})
 }
+
+// smsDeliveryStatus returns the delivery status of the SMS message for the
+// code. The status reported by the carrier takes precedence over the status of
+// the SMS outbox message. It returns the empty string if neither is known.
+func (c *Controller) smsDeliveryStatus(code *database.VerificationCode) (string, error) {
+	if code.SMSDeliveryStatus != "" {
+		return string(code.SMSDeliveryStatus), nil
+	}
+
+	status, err := c.db.SMSDeliveryStatusForCode(code.ID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(status), nil
+}
+
+// HandleSearchAPI lists the codes issued in the API key's realm which match the
+// search filters.
+func (c *Controller) HandleSearchAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("codes.HandleSearchAPI")
+
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.CodeRead)
+		if !ok {
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		_, codes, paginator, err := c.searchCodes(r, currentRealm, pageParams)
+		if err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.TrimPrefix(err.Error(), "validation failed: ")))
+				return
+			}
+
+			logger.Errorw("failed to search codes", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		issuers, err := c.loadCodeIssuers(currentRealm)
+		if err != nil {
+			logger.Errorw("failed to load code issuers", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		resp := &api.ListCodesResponse{
+			Codes: codeResponses(codes, issuers),
+		}
+		if paginator != nil && paginator.NextPage != nil {
+			resp.NextPage = paginator.NextPage.Number
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// HandleSearchExportAPI exports the codes issued in the API key's realm which
+// match the search filters as CSV.
+func (c *Controller) HandleSearchExportAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("codes.HandleSearchExportAPI")
+
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.CodeRead)
+		if !ok {
+			return
+		}
+
+		pageParams := &pagination.PageParams{
+			Page:  0,
+			Limit: maxExportCodes,
+		}
+		_, codes, _, err := c.searchCodes(r, currentRealm, pageParams)
+		if err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.TrimPrefix(err.Error(), "validation failed: ")))
+				return
+			}
+
+			logger.Errorw("failed to search codes", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		issuers, err := c.loadCodeIssuers(currentRealm)
+		if err != nil {
+			logger.Errorw("failed to load code issuers", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderCSV(w, http.StatusOK, codesCSVFilename(), codesCSV(codeResponses(codes, issuers)))
+	})
+}
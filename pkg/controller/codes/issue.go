@@ -53,6 +53,12 @@ func (c *Controller) HandleIssue() http.Handler {
 			return
 		}
 
+		hasEmailConfig, err := currentRealm.HasEmailConfig(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Issue code")
 
@@ -65,6 +71,7 @@ func (c *Controller) HandleIssue() http.Handler {
 		m["maxSymptomDays"] = displayAllowedDays
 		m["duration"] = currentRealm.CodeDuration.Duration.String()
 		m["hasSMSConfig"] = hasSMSConfig
+		m["hasEmailConfig"] = hasEmailConfig
 
 		// If the realm has a welcome message and it has not been displayed this
 		// session, display it.
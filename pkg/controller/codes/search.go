@@ -0,0 +1,423 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+const (
+	// QueryKeyExternalID is the query key for the issuing external ID.
+	QueryKeyExternalID = "external_id"
+
+	// QueryKeyUserID is the query key for the ID of the issuing user.
+	QueryKeyUserID = "user_id"
+
+	// QueryKeyAppID is the query key for the ID of the issuing API key.
+	QueryKeyAppID = "app_id"
+
+	// QueryKeyTestType is the query key for the test type.
+	QueryKeyTestType = "test_type"
+
+	// QueryKeyStatus is the query key for the code status.
+	QueryKeyStatus = "status"
+
+	// QueryKeyFrom and QueryKeyTo are the query keys for the first and last
+	// (inclusive) days on which the code was issued, in YYYY-MM-DD format (UTC).
+	QueryKeyFrom = "from"
+	QueryKeyTo   = "to"
+
+	// maxExportCodes is the maximum number of codes in a CSV export.
+	maxExportCodes = 10000
+)
+
+// codeSearch is the set of filters for a code search, as provided in the
+// request.
+type codeSearch struct {
+	ExternalID string
+	UserID     string
+	AppID      string
+	TestType   string
+	Status     string
+	From       string
+	To         string
+}
+
+// parseCodeSearch parses the search filters from the request into database
+// scopes. Invalid test types and statuses are reported by the scopes as
+// validation errors when the query runs.
+func parseCodeSearch(r *http.Request) (*codeSearch, []database.Scope, error) {
+	search := &codeSearch{
+		ExternalID: strings.TrimSpace(r.FormValue(QueryKeyExternalID)),
+		UserID:     strings.TrimSpace(r.FormValue(QueryKeyUserID)),
+		AppID:      strings.TrimSpace(r.FormValue(QueryKeyAppID)),
+		TestType:   strings.TrimSpace(r.FormValue(QueryKeyTestType)),
+		Status:     strings.TrimSpace(r.FormValue(QueryKeyStatus)),
+		From:       strings.TrimSpace(r.FormValue(QueryKeyFrom)),
+		To:         strings.TrimSpace(r.FormValue(QueryKeyTo)),
+	}
+
+	scopes := []database.Scope{
+		database.WithVerificationCodeExternalID(search.ExternalID),
+		database.WithVerificationCodeTestType(search.TestType),
+		database.WithVerificationCodeStatus(database.VerificationCodeStatus(search.Status)),
+	}
+
+	if search.UserID != "" {
+		id, err := strconv.ParseUint(search.UserID, 10, 64)
+		if err != nil {
+			return search, nil, fmt.Errorf("%s must be a number", QueryKeyUserID)
+		}
+		scopes = append(scopes, database.WithVerificationCodeIssuingUserID(uint(id)))
+	}
+
+	if search.AppID != "" {
+		id, err := strconv.ParseUint(search.AppID, 10, 64)
+		if err != nil {
+			return search, nil, fmt.Errorf("%s must be a number", QueryKeyAppID)
+		}
+		scopes = append(scopes, database.WithVerificationCodeIssuingAppID(uint(id)))
+	}
+
+	var from, to time.Time
+	if search.From != "" {
+		t, err := time.Parse(project.RFC3339Date, search.From)
+		if err != nil {
+			return search, nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", QueryKeyFrom)
+		}
+		from = t
+	}
+	if search.To != "" {
+		t, err := time.Parse(project.RFC3339Date, search.To)
+		if err != nil {
+			return search, nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", QueryKeyTo)
+		}
+		// The end date is inclusive.
+		to = t.Add(24 * time.Hour)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return search, nil, fmt.Errorf("%s must be on or before %s", QueryKeyFrom, QueryKeyTo)
+	}
+	scopes = append(scopes, database.WithVerificationCodeCreatedAt(from, to))
+
+	return search, scopes, nil
+}
+
+// codeIssuers are the users and API keys in a realm which may have issued
+// codes, used to display issuer names and search filters.
+type codeIssuers struct {
+	Memberships []*database.Membership
+	Apps        []*database.AuthorizedApp
+
+	userNames map[uint]string
+	appNames  map[uint]string
+}
+
+// loadCodeIssuers loads the members and API keys of the realm. API keys are
+// included even if they have been deleted, since they may still be the issuer
+// of codes.
+func (c *Controller) loadCodeIssuers(realm *database.Realm) (*codeIssuers, error) {
+	memberships, _, err := realm.ListMemberships(c.db, pagination.UnlimitedResults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	apps, _, err := realm.ListAuthorizedApps(c.db, pagination.UnlimitedResults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list authorized apps: %w", err)
+	}
+
+	issuers := &codeIssuers{
+		Memberships: memberships,
+		Apps:        apps,
+		userNames:   make(map[uint]string, len(memberships)),
+		appNames:    make(map[uint]string, len(apps)),
+	}
+	for _, m := range memberships {
+		if m.User != nil {
+			issuers.userNames[m.UserID] = m.User.Name
+		}
+	}
+	for _, app := range apps {
+		issuers.appNames[app.ID] = app.Name
+	}
+	return issuers, nil
+}
+
+// Name returns the display name of the user or API key which issued the code.
+func (i *codeIssuers) Name(code *database.VerificationCode) string {
+	switch {
+	case code.IssuingUserID != 0:
+		if name, ok := i.userNames[code.IssuingUserID]; ok {
+			return name
+		}
+		return "Unknown user"
+	case code.IssuingAppID != 0:
+		if name, ok := i.appNames[code.IssuingAppID]; ok {
+			return name
+		}
+		return "Unknown app"
+	default:
+		return ""
+	}
+}
+
+// codeResponse converts the verification code into its API representation.
+func codeResponse(code *database.VerificationCode, issuers *codeIssuers) *api.CodeResponse {
+	resp := &api.CodeResponse{
+		UUID:                   code.UUID,
+		TestType:               code.TestType,
+		Status:                 string(code.Status()),
+		IssuingUserID:          code.IssuingUserID,
+		IssuingAppID:           code.IssuingAppID,
+		IssuerName:             issuers.Name(code),
+		IssuingExternalID:      code.IssuingExternalID,
+		CreatedAtTimestamp:     code.CreatedAt.UTC().Unix(),
+		ExpiresAtTimestamp:     code.ExpiresAt.UTC().Unix(),
+		LongExpiresAtTimestamp: code.LongExpiresAt.UTC().Unix(),
+	}
+	if code.SymptomDate != nil {
+		resp.SymptomDate = code.SymptomDate.UTC().Format(project.RFC3339Date)
+	}
+	if code.TestDate != nil {
+		resp.TestDate = code.TestDate.UTC().Format(project.RFC3339Date)
+	}
+	return resp
+}
+
+// codeResponses converts the verification codes into their API
+// representation.
+func codeResponses(codes []*database.VerificationCode, issuers *codeIssuers) []*api.CodeResponse {
+	resps := make([]*api.CodeResponse, 0, len(codes))
+	for _, code := range codes {
+		resps = append(resps, codeResponse(code, issuers))
+	}
+	return resps
+}
+
+// searchCodes runs the code search in the request against the realm. Errors
+// in the search filters are returned as validation errors.
+func (c *Controller) searchCodes(r *http.Request, realm *database.Realm, p *pagination.PageParams) (*codeSearch, []*database.VerificationCode, *pagination.Paginator, error) {
+	search, scopes, err := parseCodeSearch(r)
+	if err != nil {
+		return search, nil, nil, fmt.Errorf("%w: %s", database.ErrValidationFailed, err)
+	}
+
+	codes, paginator, err := realm.ListVerificationCodes(c.db, p, scopes...)
+	if err != nil {
+		return search, nil, nil, err
+	}
+	return search, codes, paginator, nil
+}
+
+// HandleSearch renders the paginated, filterable list of codes issued in the
+// realm.
+func (c *Controller) HandleSearch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.CodeRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		search, codes, paginator, err := c.searchCodes(r, currentRealm, pageParams)
+		if err != nil {
+			if !database.IsValidationError(err) {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+
+			// Render the form with the error so the filters can be corrected.
+			flash.Error("Invalid search: %s", strings.TrimPrefix(err.Error(), "validation failed: "))
+		}
+
+		issuers, err := c.loadCodeIssuers(currentRealm)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Search codes")
+		m["search"] = search
+		m["issuers"] = issuers
+		m["codes"] = codes
+		m["paginator"] = paginator
+		m["testTypes"] = []string{"confirmed", "likely", "negative", "user-report"}
+		m["statuses"] = database.ValidVerificationCodeStatuses
+		m["exportURL"] = exportURL(r)
+		c.h.RenderHTML(w, "codes/search", m)
+	})
+}
+
+// HandleSearchExport exports the codes which match the search filters as CSV.
+func (c *Controller) HandleSearchExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.CodeRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams := &pagination.PageParams{
+			Page:  0,
+			Limit: maxExportCodes,
+		}
+		_, codes, _, err := c.searchCodes(r, currentRealm, pageParams)
+		if err != nil {
+			if database.IsValidationError(err) {
+				flash.Error("Invalid search: %s", strings.TrimPrefix(err.Error(), "validation failed: "))
+				controller.Back(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		issuers, err := c.loadCodeIssuers(currentRealm)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.h.RenderCSV(w, http.StatusOK, codesCSVFilename(), codesCSV(codeResponses(codes, issuers)))
+	})
+}
+
+// exportURL returns the link to export the codes which match the search filters
+// in the request. Pagination parameters are dropped, since the export is not
+// paginated.
+func exportURL(r *http.Request) string {
+	q := r.URL.Query()
+	q.Del(pagination.QueryKeyPage)
+	q.Del(pagination.QueryKeyLimit)
+
+	u := &url.URL{Path: "/codes/search.csv", RawQuery: q.Encode()}
+	return u.String()
+}
+
+// codesCSVFilename is the name of the CSV export file.
+func codesCSVFilename() string {
+	return fmt.Sprintf("%s-codes.csv", time.Now().Format(project.RFC3339Squish))
+}
+
+// codesCSV is a CSV writer.
+type codesCSV []*api.CodeResponse
+
+// MarshalCSV returns bytes in CSV format.
+func (s codesCSV) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{
+		"uuid", "test_type", "status", "issuer", "issuing_user_id", "issuing_app_id",
+		"external_id", "symptom_date", "test_date", "created_at", "expires_at", "long_expires_at",
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, code := range s {
+		if err := w.Write([]string{
+			code.UUID,
+			code.TestType,
+			code.Status,
+			code.IssuerName,
+			formatID(code.IssuingUserID),
+			formatID(code.IssuingAppID),
+			code.IssuingExternalID,
+			code.SymptomDate,
+			code.TestDate,
+			formatTimestamp(code.CreatedAtTimestamp),
+			formatTimestamp(code.ExpiresAtTimestamp),
+			formatTimestamp(code.LongExpiresAtTimestamp),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// formatID formats the database ID, or returns "" if it is unset.
+func formatID(id uint) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// formatTimestamp formats the UTC seconds since epoch as RFC3339.
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,383 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/codes"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/sessions"
+)
+
+// provisionSearchCodes creates a realm with a claimed code issued by an API
+// key and an active code issued by a user.
+func provisionSearchCodes(tb testing.TB, db *database.Database, name string) (*database.Realm, *database.AuthorizedApp, *database.User) {
+	tb.Helper()
+
+	realm := database.NewRealmWithDefaults(name)
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	app := &database.AuthorizedApp{
+		RealmID:    realm.ID,
+		Name:       name + " key",
+		APIKeyType: database.APIKeyTypeDevice,
+	}
+	if _, err := realm.CreateAuthorizedApp(db, app, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	user := &database.User{
+		Email: strings.ToLower(strings.ReplaceAll(name, " ", "")) + "@example.com",
+		Name:  name + " user",
+	}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+	if err := user.AddToRealm(db, realm, rbac.CodeRead, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, code := range []*database.VerificationCode{
+		{
+			RealmID:           realm.ID,
+			Code:              "10000001",
+			LongCode:          "10000001ABC",
+			Claimed:           true,
+			TestType:          "confirmed",
+			IssuingAppID:      app.ID,
+			IssuingExternalID: "case-1",
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(time.Hour),
+		},
+		{
+			RealmID:           realm.ID,
+			Code:              "10000002",
+			LongCode:          "10000002ABC",
+			TestType:          "likely",
+			IssuingUserID:     user.ID,
+			IssuingExternalID: "case-2",
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(time.Hour),
+		},
+	} {
+		if err := db.SaveVerificationCode(code, realm); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return realm, app, user
+}
+
+func TestHandleSearch(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := codes.NewServer(harness.Config, harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleSearch())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+	})
+
+	t.Run("internal_error", func(t *testing.T) {
+		t.Parallel()
+
+		c := codes.NewServer(harness.Config, harness.BadDatabase, harness.Renderer)
+		handler := harness.WithCommonMiddlewares(c.HandleSearch())
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.CodeRead,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusInternalServerError; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+	})
+
+	realm, _, user := provisionSearchCodes(t, harness.Database, "Search UI")
+
+	cases := []struct {
+		name    string
+		query   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "all",
+			query: "",
+			want:  []string{"case-1", "case-2", "Search UI key", "Search UI user"},
+		},
+		{
+			name:    "external_id",
+			query:   "external_id=case-1",
+			want:    []string{"case-1"},
+			notWant: []string{"case-2"},
+		},
+		{
+			name:    "status",
+			query:   "status=active",
+			want:    []string{"case-2"},
+			notWant: []string{"case-1"},
+		},
+		{
+			name:    "test_type",
+			query:   "test_type=confirmed",
+			want:    []string{"case-1"},
+			notWant: []string{"case-2"},
+		},
+		{
+			name:    "future",
+			query:   "from=2999-01-01",
+			want:    []string{"There are no codes that match the search"},
+			notWant: []string{"case-1", "case-2"},
+		},
+		{
+			name:    "invalid",
+			query:   "from=yesterday",
+			want:    []string{"There are no codes that match the search"},
+			notWant: []string{"case-1", "case-2"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := ctx
+			ctx = controller.WithSession(ctx, &sessions.Session{})
+			ctx = controller.WithMembership(ctx, &database.Membership{
+				Realm:       realm,
+				User:        user,
+				Permissions: rbac.CodeRead,
+			})
+
+			w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/?"+tc.query, nil)
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("Expected %d to be %d", got, want)
+			}
+
+			body := w.Body.String()
+			for _, want := range tc.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected %q to contain %q", body, want)
+				}
+			}
+			for _, notWant := range tc.notWant {
+				if strings.Contains(body, notWant) {
+					t.Errorf("Expected %q to not contain %q", body, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSearchExport(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := codes.NewServer(harness.Config, harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleSearchExport())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		t.Parallel()
+
+		realm, app, user := provisionSearchCodes(t, harness.Database, "Search export")
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        user,
+			Permissions: rbac.CodeRead,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/?status=claimed", nil)
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("Expected %d to be %d", got, want)
+		}
+
+		body := w.Body.String()
+		for _, want := range []string{
+			"uuid,test_type,status,issuer,issuing_user_id,issuing_app_id,external_id",
+			",confirmed,claimed," + app.Name + ",,",
+			"case-1",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected %q to contain %q", body, want)
+			}
+		}
+		if got := body; strings.Contains(got, "case-2") {
+			t.Errorf("Expected %q to not contain active code", got)
+		}
+	})
+}
+
+func TestHandleSearchAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewAdminAPIServerConfig(t, testDatabaseInstance)
+
+	c := codes.NewAPI(harness.Config, harness.Database, harness.Renderer)
+
+	realm, app, user := provisionSearchCodes(t, harness.Database, "Search API")
+
+	// serve serves the request as an admin API key with the given permissions.
+	serve := func(tb testing.TB, permissions rbac.Permission, handler http.Handler, query string) *httptest.ResponseRecorder {
+		tb.Helper()
+
+		ctx := ctx
+		ctx = controller.WithAuthorizedApp(ctx, &database.AuthorizedApp{
+			RealmID:     realm.ID,
+			Name:        "Terraform",
+			APIKeyType:  database.APIKeyTypeAdmin,
+			Permissions: permissions,
+		})
+		ctx = controller.WithRealm(ctx, realm)
+
+		w, r := envstest.BuildJSONRequest(ctx, tb, http.MethodGet, "/?"+query, nil)
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("permission_missing", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.CodeIssue, c.HandleSearchAPI(), "")
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.CodeRead, c.HandleSearchAPI(), "status=pending")
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.CodeRead, c.HandleSearchAPI(), "limit=1")
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var resp api.ListCodesResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(resp.Codes), 1; got != want {
+			t.Fatalf("expected %d codes, got %d", want, got)
+		}
+		if got, want := resp.NextPage, uint64(2); got != want {
+			t.Errorf("expected next page %d to be %d", got, want)
+		}
+
+		// Codes are newest first.
+		code := resp.Codes[0]
+		if got, want := code.IssuingUserID, user.ID; got != want {
+			t.Errorf("expected issuing user %d to be %d", got, want)
+		}
+		if got, want := code.IssuerName, user.Name; got != want {
+			t.Errorf("expected issuer %q to be %q", got, want)
+		}
+		if got, want := code.Status, "active"; got != want {
+			t.Errorf("expected status %q to be %q", got, want)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.CodeRead, c.HandleSearchAPI(), "app_id=abc")
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w = serve(t, rbac.CodeRead, c.HandleSearchAPI(), "external_id=case-1&status=claimed")
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var resp api.ListCodesResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(resp.Codes), 1; got != want {
+			t.Fatalf("expected %d codes, got %d", want, got)
+		}
+		if got, want := resp.Codes[0].IssuingAppID, app.ID; got != want {
+			t.Errorf("expected issuing app %d to be %d", got, want)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.CodeRead, c.HandleSearchExportAPI(), "test_type=likely")
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Body.String(), "case-2"; !strings.Contains(got, want) {
+			t.Errorf("expected %q to contain %q", got, want)
+		}
+	})
+}
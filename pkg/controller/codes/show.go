@@ -16,12 +16,15 @@ package codes
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strings"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/qrcode"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/gorilla/mux"
 )
@@ -78,10 +81,40 @@ func (c *Controller) HandleShow() http.Handler {
 			return
 		}
 
+		// The QR code can only be rendered in the session that issued the code,
+		// since the server does not store the long code.
+		if currentRealm.EnableENExpress && retCode.LongExpires > 0 {
+			if longCode := controller.IssuedCodeFromSession(session, code.UUID); longCode != "" {
+				if err := c.addQRCode(currentRealm, retCode, longCode); err != nil {
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+			}
+		}
+
 		c.renderShow(ctx, w, retCode)
 	})
 }
 
+// addQRCode renders the EN Express link for the long code as a QR code on the
+// response code.
+func (c *Controller) addQRCode(realm *database.Realm, code *Code, longCode string) error {
+	link := realm.BuildENXLink(longCode, c.serverconfig.IssueConfig().ENExpressRedirectDomain)
+
+	png, err := qrcode.PNGDataURL(link, qrcode.DefaultSize)
+	if err != nil {
+		return err
+	}
+	svg, err := qrcode.SVG(link)
+	if err != nil {
+		return err
+	}
+
+	code.QRCodePNG = png
+	code.QRCodeSVG = template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(svg))
+	return nil
+}
+
 func (c *Controller) responseCode(ctx context.Context, code *database.VerificationCode) (*Code, error) {
 	if code == nil {
 		return nil, fmt.Errorf("code is nil")
@@ -153,6 +186,11 @@ type Code struct {
 	Expires        int64  `json:"expires"`
 	LongExpires    int64  `json:"longExpires"`
 	HasLongExpires bool   `json:"hasLongExpires"`
+
+	// QRCodePNG and QRCodeSVG are data URLs of the EN Express link QR code. They
+	// are only set when the code was issued with a QR code in this session.
+	QRCodePNG template.URL `json:"-"`
+	QRCodeSVG template.URL `json:"-"`
 }
 
 func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, code *Code) {
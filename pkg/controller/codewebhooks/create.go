@@ -0,0 +1,155 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codewebhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// HandleCreate renders the new webhook subscription form and creates the
+// subscription.
+func (c *Controller) HandleCreate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		apps, err := c.listAdminApps(currentRealm)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		// Requested form, stop processing.
+		var subscription database.WebhookSubscription
+		if r.Method == http.MethodGet {
+			subscription.Events = []string{
+				string(database.CodeEventClaimed),
+				string(database.CodeEventExpired),
+				string(database.CodeEventManuallyExpired),
+			}
+			c.renderNew(ctx, w, &subscription, apps)
+			return
+		}
+
+		if err := bindCreateForm(r, &subscription); err != nil {
+			subscription.AddError("", err.Error())
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderNew(ctx, w, &subscription, apps)
+			return
+		}
+
+		// Only allow admin API keys which belong to this realm.
+		if id := subscription.AuthorizedAppID; id != nil {
+			app, err := currentRealm.FindAuthorizedApp(c.db, *id)
+			if err != nil && !database.IsNotFound(err) {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			if app == nil || !app.IsAdminType() {
+				subscription.AddError("authorizedAppID", "is not an admin API key in this realm")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderNew(ctx, w, &subscription, apps)
+				return
+			}
+		}
+
+		subscription.RealmID = currentRealm.ID
+		if err := c.db.SaveWebhookSubscription(&subscription, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderNew(ctx, w, &subscription, apps)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully created webhook for %q", subscription.URL)
+		http.Redirect(w, r, fmt.Sprintf("/realm/webhooks/%d", subscription.ID), http.StatusSeeOther)
+	})
+}
+
+func bindCreateForm(r *http.Request, subscription *database.WebhookSubscription) error {
+	type FormData struct {
+		URL             string   `form:"url"`
+		Secret          string   `form:"secret"`
+		Events          []string `form:"events"`
+		AuthorizedAppID uint     `form:"authorized_app_id"`
+	}
+
+	var form FormData
+	err := controller.BindForm(nil, r, &form)
+	subscription.URL = form.URL
+	subscription.Secret = form.Secret
+	subscription.Events = form.Events
+	subscription.AuthorizedAppID = nil
+	if form.AuthorizedAppID != 0 {
+		id := form.AuthorizedAppID
+		subscription.AuthorizedAppID = &id
+	}
+	return err
+}
+
+// listAdminApps lists the realm's admin API keys, which are the only keys that
+// can issue codes.
+func (c *Controller) listAdminApps(realm *database.Realm) ([]*database.AuthorizedApp, error) {
+	apps, _, err := realm.ListAuthorizedApps(c.db, &pagination.PageParams{Limit: pagination.MaxLimit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	result := make([]*database.AuthorizedApp, 0, len(apps))
+	for _, app := range apps {
+		if app.IsAdminType() {
+			result = append(result, app)
+		}
+	}
+	return result, nil
+}
+
+// renderNew renders the new page.
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, subscription *database.WebhookSubscription, apps []*database.AuthorizedApp) {
+	m := templateMap(ctx)
+	m.Title("New webhook")
+	m["subscription"] = subscription
+	m["apps"] = apps
+	c.h.RenderHTML(w, "codewebhooks/new", m)
+}
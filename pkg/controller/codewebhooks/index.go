@@ -0,0 +1,88 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codewebhooks
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// HandleIndex lists the realm's webhook subscriptions.
+func (c *Controller) HandleIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		subscriptions, err := currentRealm.ListWebhookSubscriptions(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		appNames, err := c.appNamesBySubscription(currentRealm, subscriptions)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderIndex(ctx, w, subscriptions, appNames)
+	})
+}
+
+// appNamesBySubscription returns a map of subscription IDs to the name of the
+// API key to which each subscription is restricted. Subscriptions for all
+// codes in the realm are omitted.
+func (c *Controller) appNamesBySubscription(realm *database.Realm, subscriptions []*database.WebhookSubscription) (map[uint]string, error) {
+	apps, err := c.listAdminApps(realm)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint]string, len(apps))
+	for _, app := range apps {
+		names[app.ID] = app.Name
+	}
+
+	result := make(map[uint]string, len(subscriptions))
+	for _, s := range subscriptions {
+		if s.AuthorizedAppID != nil {
+			result[s.ID] = names[*s.AuthorizedAppID]
+		}
+	}
+	return result, nil
+}
+
+// renderIndex renders the index page.
+func (c *Controller) renderIndex(ctx context.Context, w http.ResponseWriter, subscriptions []*database.WebhookSubscription, appNames map[uint]string) {
+	m := templateMap(ctx)
+	m.Title("Webhooks")
+	m["subscriptions"] = subscriptions
+	m["appNames"] = appNames
+	c.h.RenderHTML(w, "codewebhooks/index", m)
+}
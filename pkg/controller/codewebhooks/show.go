@@ -0,0 +1,92 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codewebhooks
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleShow displays the webhook subscription and its delivery log.
+func (c *Controller) HandleShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		subscription, err := currentRealm.FindWebhookSubscription(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var appName string
+		if id := subscription.AuthorizedAppID; id != nil {
+			app, err := currentRealm.FindAuthorizedApp(c.db, *id)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			appName = app.Name
+		}
+
+		deliveries, paginator, err := subscription.ListWebhookDeliveries(c.db, pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderShow(ctx, w, subscription, appName, deliveries, paginator)
+	})
+}
+
+// renderShow renders the show page.
+func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, subscription *database.WebhookSubscription, appName string, deliveries []*database.WebhookDelivery, paginator *pagination.Paginator) {
+	m := templateMap(ctx)
+	m.Title("Webhook: %s", subscription.URL)
+	m["subscription"] = subscription
+	m["appName"] = appName
+	m["deliveries"] = deliveries
+	m["paginator"] = paginator
+	c.h.RenderHTML(w, "codewebhooks/show", m)
+}
@@ -24,6 +24,8 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 )
 
@@ -40,6 +42,7 @@ var (
 
 func init() {
 	gob.Register(sessionKey(""))
+	gob.Register(map[string]issuedCode{})
 }
 
 // Back goes back to the referrer. If the referrer is missing, or if the
@@ -180,6 +183,25 @@ func MissingAuthorizedApp(w http.ResponseWriter, r *http.Request, h *render.Rend
 	return
 }
 
+// AuthorizeAPIKey returns the API key and realm of the request. If the API key
+// does not have the given permission, it renders an error and returns false.
+func AuthorizeAPIKey(w http.ResponseWriter, r *http.Request, h *render.Renderer, p rbac.Permission) (*database.AuthorizedApp, *database.Realm, bool) {
+	ctx := r.Context()
+
+	authApp := AuthorizedAppFromContext(ctx)
+	realm := RealmFromContext(ctx)
+	if authApp == nil || realm == nil {
+		MissingAuthorizedApp(w, r, h)
+		return nil, nil, false
+	}
+
+	if !authApp.Can(p) {
+		h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("API key does not have the %s permission", p))
+		return nil, nil, false
+	}
+	return authApp, realm, true
+}
+
 // MissingLocale returns an internal error when the locale does not exist.
 func MissingLocale(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	InternalError(w, r, h, errMissingLocale)
@@ -204,6 +226,12 @@ func RedirectToMFA(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	return
 }
 
+// RedirectToMFAChallenge redirects to the second factor challenge.
+func RedirectToMFAChallenge(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
+	http.Redirect(w, r, "/login/mfa", http.StatusSeeOther)
+	return
+}
+
 // RedirectToChangePassword redirects to the password reset page.
 func RedirectToChangePassword(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	http.Redirect(w, r, "/login/change-password", http.StatusSeeOther)
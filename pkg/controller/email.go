@@ -17,17 +17,95 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 )
 
-// SendInviteEmailFunc returns a function capable of sending a new user invitation.
-func SendInviteEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, email string,
+// AccountEmailSubject is the subject for account-related emails such as
+// invitations, password resets, and email verification.
+const AccountEmailSubject = "Your Exposure Notifications Verification Server Account"
+
+// ComposeEmail renders the plain text and HTML templates into the message and
+// returns the complete multipart email. The message subject is available to
+// the templates as .Subject.
+func ComposeEmail(h *render.Renderer, m *email.Message, textTmpl, htmlTmpl string, data map[string]interface{}) ([]byte, error) {
+	if _, ok := data["Subject"]; !ok {
+		data["Subject"] = m.Subject
+	}
+
+	text, err := h.RenderEmail(textTmpl, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s template: %w", textTmpl, err)
+	}
+
+	html, err := h.RenderEmailHTML(htmlTmpl, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s template: %w", htmlTmpl, err)
+	}
+
+	m.Text = string(text)
+	m.HTML = string(html)
+	return m.Bytes()
+}
+
+// ComposeCustomEmail builds a multipart email from plain text, such as a
+// realm-provided template. The HTML alternative is generated from the text,
+// treating blank lines as paragraph breaks.
+func ComposeCustomEmail(h *render.Renderer, m *email.Message, text string) ([]byte, error) {
+	var paragraphs [][]string
+	for _, p := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, strings.Split(p, "\n"))
+		}
+	}
+
+	html, err := h.RenderEmailHTML("email/custom_html", map[string]interface{}{
+		"Subject":    m.Subject,
+		"Paragraphs": paragraphs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email/custom_html template: %w", err)
+	}
+
+	m.Text = text
+	m.HTML = string(html)
+	return m.Bytes()
+}
+
+// accountEmailProvider returns the email provider for account emails. Emails on
+// behalf of a realm use the realm's email configuration. Emails to users who
+// are not a member of any realm, such as system admins, use the system email
+// configuration.
+func accountEmailProvider(db *database.Database, realm *database.Realm) (email.Provider, error) {
+	if realm != nil {
+		return realm.EmailProvider(db)
+	}
+
+	emailConfig, err := db.SystemEmailConfig()
+	if err != nil {
+		return nil, err
+	}
+	return emailConfig.Provider()
+}
+
+// realmName returns the name of the realm, or "" if realm is nil.
+func realmName(realm *database.Realm) string {
+	if realm == nil {
+		return ""
+	}
+	return realm.Name
+}
+
+// SendInviteEmailFunc returns a function capable of sending a new user
+// invitation. If realm is nil, the system email configuration is used.
+func SendInviteEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, toEmail string,
 	realm *database.Realm) (auth.InviteUserEmailFunc, error) {
 	// Lookup the email provider
-	emailer, err := realm.EmailProvider(db)
+	emailer, err := accountEmailProvider(db, realm)
 	if err != nil {
 		if database.IsNotFound(err) {
 			return nil, nil
@@ -37,33 +115,29 @@ func SendInviteEmailFunc(ctx context.Context, db *database.Database, h *render.R
 
 	// Return a function that does the actual sending.
 	return func(ctx context.Context, inviteLink string) error {
+		msg := &email.Message{
+			From:    emailer.From(),
+			To:      toEmail,
+			Subject: AccountEmailSubject,
+		}
+
 		var message []byte
-		if realm.EmailInviteTemplate != "" {
-			// Render from the realm template with the plain header.
-			header, err := h.RenderEmail("email/plainheader", map[string]interface{}{
-				"ToEmail":   email,
-				"FromEmail": emailer.From(),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to render email header template: %w", err)
-			}
-			body := []byte(realm.BuildInviteEmail(inviteLink))
-			message = append(header, body...)
+		if realm != nil && realm.EmailInviteTemplate != "" {
+			// Render from the realm template.
+			message, err = ComposeCustomEmail(h, msg, realm.BuildInviteEmail(inviteLink))
 		} else {
 			// Render the message invitation from the default template.
-			message, err = h.RenderEmail("email/invite", map[string]interface{}{
-				"ToEmail":    email,
-				"FromEmail":  emailer.From(),
+			message, err = ComposeEmail(h, msg, "email/invite", "email/invite_html", map[string]interface{}{
 				"InviteLink": inviteLink,
-				"RealmName":  realm.Name,
+				"RealmName":  realmName(realm),
 			})
-			if err != nil {
-				return fmt.Errorf("failed to render invite template: %w", err)
-			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to compose invite email: %w", err)
 		}
 
 		// Send the message.
-		if err := emailer.SendEmail(ctx, email, message); err != nil {
+		if err := emailer.SendEmail(ctx, toEmail, message); err != nil {
 			return fmt.Errorf("failed to send email: %w", err)
 		}
 		return nil
@@ -71,11 +145,12 @@ func SendInviteEmailFunc(ctx context.Context, db *database.Database, h *render.R
 }
 
 // SendPasswordResetEmailFunc returns a function capable of sending a password
-// reset for the given user.
-func SendPasswordResetEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, email string,
+// reset for the given user. If realm is nil, the system email configuration is
+// used.
+func SendPasswordResetEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, toEmail string,
 	realm *database.Realm) (auth.ResetPasswordEmailFunc, error) {
 	// Lookup the email provider
-	emailer, err := realm.EmailProvider(db)
+	emailer, err := accountEmailProvider(db, realm)
 	if err != nil {
 		if database.IsNotFound(err) {
 			return nil, nil
@@ -84,33 +159,29 @@ func SendPasswordResetEmailFunc(ctx context.Context, db *database.Database, h *r
 	}
 
 	return func(ctx context.Context, resetLink string) error {
+		msg := &email.Message{
+			From:    emailer.From(),
+			To:      toEmail,
+			Subject: AccountEmailSubject,
+		}
+
 		var message []byte
-		if realm.EmailPasswordResetTemplate != "" {
-			// Render from the realm template with the plain header.
-			header, err := h.RenderEmail("email/plainheader", map[string]interface{}{
-				"ToEmail":   email,
-				"FromEmail": emailer.From(),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to render email header template: %w", err)
-			}
-			body := []byte(realm.BuildPasswordResetEmail(resetLink))
-			message = append(header, body...)
+		if realm != nil && realm.EmailPasswordResetTemplate != "" {
+			// Render from the realm template.
+			message, err = ComposeCustomEmail(h, msg, realm.BuildPasswordResetEmail(resetLink))
 		} else {
 			// Render the reset email.
-			message, err = h.RenderEmail("email/passwordresetemail", map[string]interface{}{
-				"ToEmail":   email,
-				"FromEmail": emailer.From(),
+			message, err = ComposeEmail(h, msg, "email/passwordresetemail", "email/passwordresetemail_html", map[string]interface{}{
 				"ResetLink": resetLink,
-				"RealmName": realm.Name,
+				"RealmName": realmName(realm),
 			})
-			if err != nil {
-				return fmt.Errorf("failed to render password reset template: %w", err)
-			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to compose password reset email: %w", err)
 		}
 
 		// Send the message.
-		if err := emailer.SendEmail(ctx, email, message); err != nil {
+		if err := emailer.SendEmail(ctx, toEmail, message); err != nil {
 			return fmt.Errorf("failed to send email: %w", err)
 		}
 		return nil
@@ -118,11 +189,11 @@ func SendPasswordResetEmailFunc(ctx context.Context, db *database.Database, h *r
 }
 
 // SendEmailVerificationEmailFunc returns a function capable of sending an email
-// verification email.
-func SendEmailVerificationEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, email string,
+// verification email. If realm is nil, the system email configuration is used.
+func SendEmailVerificationEmailFunc(ctx context.Context, db *database.Database, h *render.Renderer, toEmail string,
 	realm *database.Realm) (auth.EmailVerificationEmailFunc, error) {
 	// Lookup the email provider
-	emailer, err := realm.EmailProvider(db)
+	emailer, err := accountEmailProvider(db, realm)
 	if err != nil {
 		if database.IsNotFound(err) {
 			return nil, nil
@@ -131,33 +202,29 @@ func SendEmailVerificationEmailFunc(ctx context.Context, db *database.Database,
 	}
 
 	return func(ctx context.Context, verifyLink string) error {
+		msg := &email.Message{
+			From:    emailer.From(),
+			To:      toEmail,
+			Subject: AccountEmailSubject,
+		}
+
 		var message []byte
-		if realm.EmailVerifyTemplate != "" {
-			// Render from the realm template with the plain header.
-			header, err := h.RenderEmail("email/plainheader", map[string]interface{}{
-				"ToEmail":   email,
-				"FromEmail": emailer.From(),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to render email header template: %w", err)
-			}
-			body := []byte(realm.BuildVerifyEmail(verifyLink))
-			message = append(header, body...)
+		if realm != nil && realm.EmailVerifyTemplate != "" {
+			// Render from the realm template.
+			message, err = ComposeCustomEmail(h, msg, realm.BuildVerifyEmail(verifyLink))
 		} else {
-			// Render the reset email.
-			message, err = h.RenderEmail("email/verifyemail", map[string]interface{}{
-				"ToEmail":    email,
-				"FromEmail":  emailer.From(),
+			// Render the verification email.
+			message, err = ComposeEmail(h, msg, "email/verifyemail", "email/verifyemail_html", map[string]interface{}{
 				"VerifyLink": verifyLink,
-				"RealmName":  realm.Name,
+				"RealmName":  realmName(realm),
 			})
-			if err != nil {
-				return fmt.Errorf("failed to render password reset template: %w", err)
-			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to compose email verification email: %w", err)
 		}
 
 		// Send the message.
-		if err := emailer.SendEmail(ctx, email, message); err != nil {
+		if err := emailer.SendEmail(ctx, toEmail, message); err != nil {
 			return fmt.Errorf("failed to send email: %w", err)
 		}
 		return nil
@@ -0,0 +1,134 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/assets"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+func TestComposeEmail(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	h, err := render.New(ctx, assets.ServerFS(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		textTmpl string
+		htmlTmpl string
+		data     map[string]interface{}
+		link     string
+	}{
+		{
+			name:     "invite",
+			textTmpl: "email/invite",
+			htmlTmpl: "email/invite_html",
+			data:     map[string]interface{}{"InviteLink": "https://example.com/invite?a=b", "RealmName": "Wonder"},
+			link:     "https://example.com/invite?a=b",
+		},
+		{
+			name:     "password_reset",
+			textTmpl: "email/passwordresetemail",
+			htmlTmpl: "email/passwordresetemail_html",
+			data:     map[string]interface{}{"ResetLink": "https://example.com/reset", "RealmName": "Wonder"},
+			link:     "https://example.com/reset",
+		},
+		{
+			name:     "verify",
+			textTmpl: "email/verifyemail",
+			htmlTmpl: "email/verifyemail_html",
+			data:     map[string]interface{}{"VerifyLink": "https://example.com/verify", "RealmName": "Wonder"},
+			link:     "https://example.com/verify",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := &email.Message{
+				From:    "noreply@example.com",
+				To:      "user@example.com",
+				Subject: AccountEmailSubject,
+			}
+			b, err := ComposeEmail(h, msg, tc.textTmpl, tc.htmlTmpl, tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := email.ParseMessage(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := parsed.Subject, AccountEmailSubject; got != want {
+				t.Errorf("expected subject %q to be %q", got, want)
+			}
+			if !strings.Contains(parsed.Text, tc.link) {
+				t.Errorf("expected text %q to contain %q", parsed.Text, tc.link)
+			}
+			if !strings.Contains(parsed.HTML, `href="`+tc.link) {
+				t.Errorf("expected html %q to link to %q", parsed.HTML, tc.link)
+			}
+		})
+	}
+}
+
+func TestComposeCustomEmail(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	h, err := render.New(ctx, assets.ServerFS(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &email.Message{
+		From:    "noreply@example.com",
+		To:      "user@example.com",
+		Subject: AccountEmailSubject,
+	}
+	text := "Welcome <friend>,\nJoin here: https://example.com\n\nThanks!"
+	b, err := ComposeCustomEmail(h, msg, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := email.ParseMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := parsed.Text, text; got != want {
+		t.Errorf("expected text %q to be %q", got, want)
+	}
+	for _, want := range []string{
+		"<p>Welcome &lt;friend&gt;,<br>Join here: https://example.com</p>",
+		"<p>Thanks!</p>",
+	} {
+		if !strings.Contains(parsed.HTML, want) {
+			t.Errorf("expected html %q to contain %q", parsed.HTML, want)
+		}
+	}
+}
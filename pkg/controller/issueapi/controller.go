@@ -37,6 +37,7 @@ type Controller struct {
 	config     config.IssueAPIConfig
 	db         *database.Database
 	localCache *cache.Cache
+	logoCache  *cache.Cache
 	limiter    limiter.Store
 	smsSigner  keys.KeyManager
 	h          *render.Renderer
@@ -45,11 +46,13 @@ type Controller struct {
 // New creates a new IssueAPI controller.
 func New(cfg config.IssueAPIConfig, db *database.Database, limiter limiter.Store, smsSigner keys.KeyManager, h *render.Renderer) *Controller {
 	localCache, _ := cache.New(30 * time.Second)
+	logoCache, _ := cache.New(logoCacheTTL)
 
 	return &Controller{
 		config:     cfg,
 		db:         db,
 		localCache: localCache,
+		logoCache:  logoCache,
 		limiter:    limiter,
 		smsSigner:  smsSigner,
 		h:          h,
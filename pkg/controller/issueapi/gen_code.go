@@ -26,7 +26,10 @@ import (
 
 	enobs "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/checkdigit"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/sethvargo/go-retry"
 	"go.opencensus.io/stats"
 
@@ -35,12 +38,20 @@ import (
 
 const (
 	// all lowercase characters plus 0-9
-	charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	charset = database.DefaultLongCodeAlphabet
 )
 
 func (c *Controller) IssueCode(ctx context.Context, vCode *database.VerificationCode, realm *database.Realm) *IssueResult {
 	logger := logging.FromContext(ctx).Named("issueapi.IssueCode")
 
+	// Take from the API key's daily issue limit before the realm's quota, so
+	// codes rejected by the API key's limit do not consume the realm's quota.
+	if authApp := controller.AuthorizedAppFromContext(ctx); authApp != nil && authApp.DailyIssueLimit > 0 {
+		if result := c.takeAuthorizedAppQuota(ctx, authApp); result != nil {
+			return result
+		}
+	}
+
 	// If we got this far, we're about to issue a code - take from the limiter
 	// to ensure this is permitted.
 	if realm.AbusePreventionEnabled {
@@ -109,6 +120,58 @@ func (c *Controller) IssueCode(ctx context.Context, vCode *database.Verification
 	}
 }
 
+// takeAuthorizedAppQuota takes from the API key's daily issue limit. It
+// returns nil if the code can be issued.
+func (c *Controller) takeAuthorizedAppQuota(ctx context.Context, authApp *database.AuthorizedApp) *IssueResult {
+	logger := logging.FromContext(ctx).Named("issueapi.takeAuthorizedAppQuota")
+
+	key, err := authApp.QuotaKey(c.config.GetRateLimitConfig().HMACKey)
+	if err != nil {
+		return &IssueResult{
+			obsResult:   enobs.ResultError("FAILED_TO_GENERATE_HMAC"),
+			HTTPCode:    http.StatusInternalServerError,
+			ErrorReturn: api.Error(err).WithCode(api.ErrInternal),
+		}
+	}
+
+	if err := limitware.ConfigureLimit(ctx, c.limiter, key, uint64(authApp.DailyIssueLimit), 24*time.Hour); err != nil {
+		logger.Errorw("failed to configure api key quota", "error", err)
+		return &IssueResult{
+			obsResult:   enobs.ResultError("FAILED_TO_CONFIGURE_LIMITER"),
+			HTTPCode:    http.StatusInternalServerError,
+			ErrorReturn: api.Errorf("failed to issue code, please try again in a few seconds").WithCode(api.ErrInternal),
+		}
+	}
+
+	limit, _, reset, ok, err := c.limiter.Take(ctx, key)
+	if err != nil {
+		logger.Errorw("failed to take from limiter", "error", err)
+		return &IssueResult{
+			obsResult:   enobs.ResultError("FAILED_TO_TAKE_FROM_LIMITER"),
+			HTTPCode:    http.StatusInternalServerError,
+			ErrorReturn: api.Errorf("failed to issue code, please try again in a few seconds").WithCode(api.ErrInternal),
+		}
+	}
+	if ok {
+		return nil
+	}
+
+	logger.Warnw("api key has exceeded daily issue limit",
+		"authorized_app", authApp.ID,
+		"limit", limit,
+		"reset", reset)
+
+	if err := authApp.RecordQuotaExceeded(c.db, time.Now()); err != nil {
+		logger.Errorw("failed to record quota exceeded", "error", err)
+	}
+
+	return &IssueResult{
+		obsResult:   enobs.ResultError("API_KEY_QUOTA_EXCEEDED"),
+		HTTPCode:    http.StatusTooManyRequests,
+		ErrorReturn: api.Errorf("exceeded daily issue limit for this API key, please contact a realm administrator").WithCode(api.ErrQuotaExceeded),
+	}
+}
+
 // CommitCode will generate a verification code and save it to the database, based on
 // the paremters provided. It returns the short code, long code, a UUID for
 // accessing the code, and any errors.
@@ -119,13 +182,18 @@ func (c *Controller) CommitCode(ctx context.Context, vCode *database.Verificatio
 	}
 
 	if err := retry.Do(ctx, retry.WithMaxRetries(uint64(retryCount), b), func(ctx context.Context) error {
-		code, err := GenerateCode(realm.CodeLength)
+		generateCode, generateLongCode := GenerateCode, GenerateCodeFromAlphabet
+		if realm.UseCheckDigits {
+			generateCode, generateLongCode = GenerateCodeWithCheckDigit, GenerateCodeFromAlphabetWithCheckDigit
+		}
+
+		code, err := generateCode(realm.CodeLength)
 		if err != nil {
 			return err
 		}
 		longCode := code
 		if realm.LongCodeLength > 0 {
-			longCode, err = GenerateAlphanumericCode(realm.LongCodeLength)
+			longCode, err = generateLongCode(realm.LongCodeLength, realm.GetLongCodeAlphabet())
 			if err != nil {
 				return err
 			}
@@ -175,9 +243,15 @@ func GenerateCode(length uint) (string, error) {
 // base64 encode to that length string.
 // For example 16 character string requires 12 bytes.
 func GenerateAlphanumericCode(length uint) (string, error) {
+	return GenerateCodeFromAlphabet(length, charset)
+}
+
+// GenerateCodeFromAlphabet will generate a code of the given length whose
+// characters are drawn uniformly from the alphabet.
+func GenerateCodeFromAlphabet(length uint, alphabet string) (string, error) {
 	var result string
 	for i := uint(0); i < length; i++ {
-		ch, err := randomFromCharset()
+		ch, err := randomFromAlphabet(alphabet)
 		if err != nil {
 			return "", err
 		}
@@ -186,10 +260,47 @@ func GenerateAlphanumericCode(length uint) (string, error) {
 	return result, nil
 }
 
-func randomFromCharset() (string, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+// GenerateCodeWithCheckDigit creates a new OTP code whose last digit is a Damm
+// check digit. The length includes the check digit.
+func GenerateCodeWithCheckDigit(length uint) (string, error) {
+	if length < 2 {
+		return "", fmt.Errorf("length must be at least 2")
+	}
+
+	code, err := GenerateCode(length - 1)
+	if err != nil {
+		return "", err
+	}
+	check, err := checkdigit.Damm(code)
+	if err != nil {
+		return "", err
+	}
+	return code + string(check), nil
+}
+
+// GenerateCodeFromAlphabetWithCheckDigit will generate a code from the alphabet
+// whose last character is a Luhn mod N check character. The length includes
+// the check character.
+func GenerateCodeFromAlphabetWithCheckDigit(length uint, alphabet string) (string, error) {
+	if length < 2 {
+		return "", fmt.Errorf("length must be at least 2")
+	}
+
+	code, err := GenerateCodeFromAlphabet(length-1, alphabet)
+	if err != nil {
+		return "", err
+	}
+	check, err := checkdigit.LuhnModN(code, alphabet)
+	if err != nil {
+		return "", err
+	}
+	return code + string(check), nil
+}
+
+func randomFromAlphabet(alphabet string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
 	if err != nil {
 		return "", err
 	}
-	return string(charset[n.Int64()]), nil
+	return string(alphabet[n.Int64()]), nil
 }
@@ -16,12 +16,14 @@ package issueapi_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/checkdigit"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -71,6 +73,63 @@ func TestGenerateAlphanumericCode(t *testing.T) {
 	}
 }
 
+func TestGenerateCodeWithCheckDigit(t *testing.T) {
+	t.Parallel()
+
+	for j := 0; j < 1000; j++ {
+		code, err := issueapi.GenerateCodeWithCheckDigit(8)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(code); got != 8 {
+			t.Fatalf("code is wrong length want 8, got %v", got)
+		}
+		if !checkdigit.ValidDamm(code) {
+			t.Errorf("expected %q to have a valid check digit", code)
+		}
+	}
+}
+
+func TestGenerateCodeFromAlphabet(t *testing.T) {
+	t.Parallel()
+
+	for j := 0; j < 1000; j++ {
+		code, err := issueapi.GenerateCodeFromAlphabet(16, database.CrockfordLongCodeAlphabet)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(code); got != 16 {
+			t.Fatalf("code is wrong length want 16, got %v", got)
+		}
+
+		for i, c := range code {
+			if !strings.ContainsRune(database.CrockfordLongCodeAlphabet, c) {
+				t.Errorf("code[%v]: %q outside expected alphabet", i, c)
+			}
+		}
+	}
+}
+
+func TestGenerateCodeFromAlphabetWithCheckDigit(t *testing.T) {
+	t.Parallel()
+
+	for j := 0; j < 1000; j++ {
+		code, err := issueapi.GenerateCodeFromAlphabetWithCheckDigit(16, database.DefaultLongCodeAlphabet)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(code); got != 16 {
+			t.Fatalf("code is wrong length want 16, got %v", got)
+		}
+		if !checkdigit.ValidLuhnModN(code, database.DefaultLongCodeAlphabet) {
+			t.Errorf("expected %q to have a valid check character", code)
+		}
+	}
+}
+
 func TestCommitCode(t *testing.T) {
 	t.Parallel()
 
@@ -243,3 +302,60 @@ func TestIssueCode(t *testing.T) {
 		})
 	}
 }
+
+func TestIssueCode_APIKeyDailyIssueLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authApp := &database.AuthorizedApp{
+		Name:            "Lab partner",
+		APIKeyType:      database.APIKeyTypeAdmin,
+		DailyIssueLimit: 1,
+	}
+	if _, err := realm.CreateAuthorizedApp(db, authApp, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	ctx = controller.WithAuthorizedApp(ctx, authApp)
+
+	c := issueapi.New(harness.Config, db, harness.RateLimiter, harness.KeyManager, harness.Renderer)
+
+	newCode := func() *database.VerificationCode {
+		expires := time.Now().UTC().Add(48 * time.Hour)
+		return &database.VerificationCode{
+			TestType:      "confirmed",
+			ExpiresAt:     expires,
+			LongExpiresAt: expires,
+		}
+	}
+
+	if result := c.IssueCode(ctx, newCode(), realm); result.HTTPCode != http.StatusOK {
+		t.Fatalf("expected %d to be %d: %#v", result.HTTPCode, http.StatusOK, result.ErrorReturn)
+	}
+
+	result := c.IssueCode(ctx, newCode(), realm)
+	if got, want := result.HTTPCode, http.StatusTooManyRequests; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := result.ErrorReturn.ErrorCode, api.ErrQuotaExceeded; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	stats, err := authApp.Stats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) == 0 {
+		t.Fatal("expected stats")
+	}
+	if got, want := stats[0].CodesQuotaExceeded, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
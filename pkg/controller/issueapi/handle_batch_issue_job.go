@@ -0,0 +1,271 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxBatchIssueCSVBytes is the maximum size of an uploaded CSV.
+	maxBatchIssueCSVBytes = 5 << 20
+
+	// maxBatchIssueCSVRows is the maximum number of rows in an uploaded CSV.
+	maxBatchIssueCSVRows = 25000
+
+	// maxBatchIssueCSVErrors is the maximum number of invalid rows reported
+	// when an uploaded CSV is rejected.
+	maxBatchIssueCSVErrors = 10
+)
+
+// HandleBatchIssueJobCreate accepts a CSV of codes to issue and creates a job
+// which issues them asynchronously. The job's status and results are served by
+// the jobs API. The CSV is either the request body or the "file" field of a
+// multipart form. Each row is:
+//
+//	phone,testDate,[optional]symptomDate,[optional]testType,[optional]uuid
+//
+// The whole file is validated before the job is created.
+func (c *Controller) HandleBatchIssueJobCreate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("issueapi.HandleBatchIssueJobCreate")
+
+		if c.config.IsMaintenanceMode() {
+			c.h.RenderJSON(w, http.StatusTooManyRequests,
+				api.Errorf("server is read-only for maintenance").WithCode(api.ErrMaintenanceMode))
+			return
+		}
+
+		authorizedApp := controller.AuthorizedAppFromContext(ctx)
+		if authorizedApp == nil {
+			controller.MissingAuthorizedApp(w, r, c.h)
+			return
+		}
+
+		currentRealm := controller.RealmFromContext(ctx)
+		if currentRealm == nil || !currentRealm.AllowBulkUpload {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("bulk issuing is not enabled on this realm"))
+			return
+		}
+
+		smsTemplateLabel := r.URL.Query().Get("smsTemplateLabel")
+		if smsTemplateLabel != "" && smsTemplateLabel != database.DefaultTemplateLabel {
+			if _, ok := currentRealm.SMSTextAlternateTemplates[smsTemplateLabel]; !ok {
+				c.h.RenderJSON(w, http.StatusBadRequest,
+					api.Errorf("no sms template with label %q", smsTemplateLabel).WithCode(api.ErrUnparsableRequest))
+				return
+			}
+		}
+
+		var tzOffset float64
+		if v := r.URL.Query().Get("tzOffset"); v != "" {
+			var err error
+			tzOffset, err = strconv.ParseFloat(v, 32)
+			if err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest,
+					api.Errorf("invalid tzOffset %q", v).WithCode(api.ErrUnparsableRequest))
+				return
+			}
+		}
+
+		body, err := batchIssueCSVBody(w, r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrUnparsableRequest))
+			return
+		}
+		defer body.Close()
+
+		rows, err := parseBatchIssueCSV(body)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrUnparsableRequest))
+			return
+		}
+
+		job, err := database.NewBulkIssueJob(currentRealm.ID, authorizedApp.ID, &database.BulkIssueParams{
+			SMSTemplateLabel: smsTemplateLabel,
+			TZOffset:         float32(tzOffset),
+		}, rows)
+		if err != nil {
+			logger.Errorw("failed to build bulk issue job", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+		if err := c.db.SaveJob(job); err != nil {
+			logger.Errorw("failed to create bulk issue job", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, job.JobResponse())
+	})
+}
+
+// batchIssueCSVBody returns the uploaded CSV, limited to the maximum size.
+func batchIssueCSVBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchIssueCSVBytes)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %w", err)
+	}
+
+	switch mediaType {
+	case "text/csv", "text/plain":
+		return r.Body, nil
+	case "multipart/form-data":
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("content type must be text/csv or multipart/form-data")
+	}
+}
+
+// parseBatchIssueCSV parses and validates the uploaded CSV. Blank lines and an
+// optional header row are skipped. If any rows are invalid, the returned error
+// describes up to maxBatchIssueCSVErrors of them.
+func parseBatchIssueCSV(in io.Reader) ([]*database.BulkIssueRow, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows := make([]*database.BulkIssueRow, 0, 64)
+	uuids := make(map[string]uint)
+	var problems []string
+	invalid := func(line int, msg string, vars ...interface{}) {
+		problems = append(problems, fmt.Sprintf("line %d: %s", line, fmt.Sprintf(msg, vars...)))
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, fmt.Errorf("failed to parse CSV: %w", perr)
+			}
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if first && strings.EqualFold(record[0], "phone") {
+			continue
+		}
+
+		if len(record) < 2 || len(record) > 5 {
+			invalid(line, "expected between 2 and 5 columns, got %d", len(record))
+			continue
+		}
+
+		row := &database.BulkIssueRow{
+			Line:     uint(line),
+			Phone:    record[0],
+			TestDate: record[1],
+			TestType: api.TestTypeConfirmed,
+		}
+		if len(record) > 2 {
+			row.SymptomDate = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			row.TestType = strings.ToLower(record[3])
+		}
+		if len(record) > 4 {
+			row.UUID = strings.ToLower(record[4])
+		}
+
+		if row.Phone == "" {
+			invalid(line, "phone number is missing")
+			continue
+		}
+		if err := validateBatchIssueDate(row.TestDate); err != nil {
+			invalid(line, "invalid test date: %s", err)
+			continue
+		}
+		if err := validateBatchIssueDate(row.SymptomDate); err != nil {
+			invalid(line, "invalid symptom date: %s", err)
+			continue
+		}
+		switch row.TestType {
+		case api.TestTypeConfirmed, api.TestTypeLikely, api.TestTypeNegative:
+		default:
+			invalid(line, "invalid test type %q", row.TestType)
+			continue
+		}
+		if row.UUID != "" {
+			if _, err := uuid.Parse(row.UUID); err != nil {
+				invalid(line, "invalid uuid %q", row.UUID)
+				continue
+			}
+			if prev, ok := uuids[row.UUID]; ok {
+				invalid(line, "uuid %q is also used on line %d", row.UUID, prev)
+				continue
+			}
+			uuids[row.UUID] = row.Line
+		}
+
+		rows = append(rows, row)
+		if l := len(rows); l > maxBatchIssueCSVRows {
+			return nil, fmt.Errorf("CSV cannot contain more than %d rows", maxBatchIssueCSVRows)
+		}
+	}
+
+	if l := len(problems); l > 0 {
+		if l > maxBatchIssueCSVErrors {
+			problems = append(problems[:maxBatchIssueCSVErrors], fmt.Sprintf("and %d more", l-maxBatchIssueCSVErrors))
+		}
+		return nil, fmt.Errorf("CSV contains %d invalid rows: %s", l, strings.Join(problems, "; "))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("CSV does not contain any rows")
+	}
+	return rows, nil
+}
+
+// validateBatchIssueDate validates that the date is blank or an ISO 8601
+// date. Whether the date is in the allowed range is checked when the code is
+// issued.
+func validateBatchIssueDate(s string) error {
+	if s == "" {
+		return nil
+	}
+	if _, err := time.Parse(project.RFC3339Date, s); err != nil {
+		return fmt.Errorf("must be YYYY-MM-DD")
+	}
+	return nil
+}
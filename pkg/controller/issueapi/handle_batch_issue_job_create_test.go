@@ -0,0 +1,142 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestHandleBatchIssueJobCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	realm, err := harness.Database.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	realm.AllowBulkUpload = true
+	if err := harness.Database.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	authApp := &database.AuthorizedApp{
+		Name:       "Appy",
+		APIKeyType: database.APIKeyTypeAdmin,
+	}
+	if _, err := realm.CreateAuthorizedApp(harness.Database, authApp, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := issueapi.New(harness.Config, harness.Database, harness.RateLimiter, harness.KeyManager, harness.Renderer)
+	handler := c.HandleBatchIssueJobCreate()
+
+	testDate := time.Now().UTC().Add(-24 * time.Hour).Format(project.RFC3339Date)
+
+	cases := []struct {
+		name     string
+		realm    *database.Realm
+		body     string
+		code     int
+		errorMsg string
+		items    uint
+	}{
+		{
+			name:  "success",
+			realm: realm,
+			body:  fmt.Sprintf("phone,testDate\n+15005550006,%s\n+15005550007,%s\n", testDate, testDate),
+			code:  http.StatusOK,
+			items: 2,
+		},
+		{
+			name:     "invalid_rows",
+			realm:    realm,
+			body:     "+15005550006\n",
+			code:     http.StatusBadRequest,
+			errorMsg: "line 1",
+		},
+		{
+			name:     "bulk_disabled",
+			realm:    &database.Realm{},
+			body:     fmt.Sprintf("+15005550006,%s\n", testDate),
+			code:     http.StatusBadRequest,
+			errorMsg: "bulk issuing is not enabled",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := ctx
+			ctx = controller.WithRealm(ctx, tc.realm)
+			ctx = controller.WithAuthorizedApp(ctx, authApp)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/batch-issue/jobs", strings.NewReader(tc.body))
+			r = r.Clone(ctx)
+			r.Header.Set("Content-Type", "text/csv")
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, tc.code; got != want {
+				t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+			}
+
+			var resp api.JobResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.errorMsg != "" {
+				if !strings.Contains(resp.Error, tc.errorMsg) {
+					t.Errorf("expected %q to contain %q", resp.Error, tc.errorMsg)
+				}
+				return
+			}
+
+			if got, want := resp.TotalItems, tc.items; got != want {
+				t.Errorf("expected %d items to be %d", got, want)
+			}
+
+			job, err := realm.FindJob(harness.Database, resp.JobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := job.Kind, database.JobKindBulkIssue; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got, want := job.Status, database.JobStatusPending; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
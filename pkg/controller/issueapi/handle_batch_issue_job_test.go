@@ -0,0 +1,127 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseBatchIssueCSV(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		csv  string
+		want []*database.BulkIssueRow
+		err  string
+	}{
+		{
+			name: "valid",
+			csv: strings.Join([]string{
+				"phone,testDate,symptomDate,testType,uuid",
+				"+12065551234,2021-10-01",
+				"",
+				"+12065551235, 2021-10-01, 2021-09-30, LIKELY",
+				"+12065551236,2021-10-02,,negative,6CF5C1E8-96EE-45BB-AE7E-C6CF52B5C9F4",
+			}, "\n"),
+			want: []*database.BulkIssueRow{
+				{Line: 2, Phone: "+12065551234", TestDate: "2021-10-01", TestType: "confirmed"},
+				{Line: 4, Phone: "+12065551235", TestDate: "2021-10-01", SymptomDate: "2021-09-30", TestType: "likely"},
+				{Line: 5, Phone: "+12065551236", TestDate: "2021-10-02", TestType: "negative", UUID: "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4"},
+			},
+		},
+		{
+			name: "empty",
+			csv:  "phone,testDate\n",
+			err:  "does not contain any rows",
+		},
+		{
+			name: "columns",
+			csv:  "+12065551234\n",
+			err:  "line 1: expected between 2 and 5 columns, got 1",
+		},
+		{
+			name: "missing_phone",
+			csv:  ",2021-10-01\n",
+			err:  "line 1: phone number is missing",
+		},
+		{
+			name: "bad_date",
+			csv:  "+12065551234,10/01/2021\n",
+			err:  "line 1: invalid test date",
+		},
+		{
+			name: "bad_test_type",
+			csv:  "+12065551234,2021-10-01,,user-report\n",
+			err:  `line 1: invalid test type "user-report"`,
+		},
+		{
+			name: "bad_uuid",
+			csv:  "+12065551234,2021-10-01,,,banana\n",
+			err:  `line 1: invalid uuid "banana"`,
+		},
+		{
+			name: "duplicate_uuid",
+			csv: strings.Join([]string{
+				"+12065551234,2021-10-01,,,6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				"+12065551235,2021-10-01,,,6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+			}, "\n"),
+			err: "line 2: uuid \"6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4\" is also used on line 1",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rows, err := parseBatchIssueCSV(strings.NewReader(tc.csv))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, rows); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("too_many_errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := parseBatchIssueCSV(strings.NewReader(strings.Repeat(",2021-10-01\n", 12)))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if got, want := strings.Count(err.Error(), "phone number is missing"), maxBatchIssueCSVErrors; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if want := fmt.Sprintf("and %d more", 12-maxBatchIssueCSVErrors); !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q to contain %q", err, want)
+		}
+	})
+}
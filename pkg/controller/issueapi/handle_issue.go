@@ -121,6 +121,12 @@ func (c *Controller) decodeAndIssue(ctx context.Context, w http.ResponseWriter,
 		controller.InternalError(w, r, c.h, errors.New(res.ErrorReturn.Error))
 		return
 	case http.StatusOK:
+		// Remember QR codes issued from the UI so they can be shown again on the
+		// code status page. API requests do not have a session.
+		if res.QRCodePNG != "" {
+			session := controller.SessionFromContext(ctx)
+			controller.StoreSessionIssuedCode(session, res.VerCode.UUID, res.VerCode.LongCode, res.VerCode.LongExpiresAt)
+		}
 		c.h.RenderJSON(w, http.StatusOK, res.IssueCodeResponse())
 		return
 	case http.StatusConflict:
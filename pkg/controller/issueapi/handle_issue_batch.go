@@ -21,6 +21,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-server/pkg/logging"
 	enobs "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -74,7 +75,7 @@ func (c *Controller) BatchIssueWithAPIAuth(w http.ResponseWriter, r *http.Reques
 		return result
 	}
 
-	c.decodeAndBulkIssue(ctx, w, r, result)
+	c.decodeAndBulkIssue(ctx, w, r, result, true)
 	return result
 }
 
@@ -93,13 +94,20 @@ func (c *Controller) BatchIssueWithUIAuth(w http.ResponseWriter, r *http.Request
 	}
 	ctx = controller.WithRealm(ctx, membership.Realm)
 
-	c.decodeAndBulkIssue(ctx, w, r, result)
+	// The UI renders a single PDF for the whole upload via /codes/letters, so the
+	// letters are not rendered for each batch.
+	c.decodeAndBulkIssue(ctx, w, r, result, false)
 	return result
 }
 
-func (c *Controller) decodeAndBulkIssue(ctx context.Context, w http.ResponseWriter, r *http.Request, result *IssueResult) {
+// decodeAndBulkIssue issues the codes in the batch request. If renderLetters is
+// true and letters were requested, the response includes a PDF of the letters.
+func (c *Controller) decodeAndBulkIssue(ctx context.Context, w http.ResponseWriter, r *http.Request, result *IssueResult, renderLetters bool) {
+	logger := logging.FromContext(ctx).Named("issueapi.decodeAndBulkIssue")
+
 	// Ensure bulk upload is enabled on this realm.
-	if currentRealm := controller.RealmFromContext(ctx); currentRealm == nil || !currentRealm.AllowBulkUpload {
+	currentRealm := controller.RealmFromContext(ctx)
+	if currentRealm == nil || !currentRealm.AllowBulkUpload {
 		result.obsResult = enobs.ResultError("BULK_ISSUE_NOT_ENABLED")
 		c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("bulk issuing is not enabled on this realm"))
 		return
@@ -123,6 +131,7 @@ func (c *Controller) decodeAndBulkIssue(ctx context.Context, w http.ResponseWrit
 		internalRequests = append(internalRequests,
 			&IssueRequestInternal{
 				IssueRequest: c,
+				Letter:       request.Letters,
 			})
 	}
 
@@ -133,11 +142,20 @@ func (c *Controller) decodeAndBulkIssue(ctx context.Context, w http.ResponseWrit
 	batchResp.Codes = make([]*api.IssueCodeResponse, len(results))
 	errCount := 0
 
+	var letterCodes []*letterCode
 	for i, result := range results {
 		singleResponse := result.IssueCodeResponse()
 		batchResp.Codes[i] = singleResponse
 		singleResponse.Padding = []byte{} // prevent inner padding of each response
 		if singleResponse.Error == "" {
+			if request.Letters {
+				singleResponse.LongCode = result.VerCode.LongCode
+				letterCodes = append(letterCodes, &letterCode{
+					LongCode:  result.VerCode.LongCode,
+					ExpiresAt: result.VerCode.LongExpiresAt,
+					TZOffset:  request.Codes[i].TZOffset,
+				})
+			}
 			continue
 		}
 
@@ -160,5 +178,20 @@ func (c *Controller) decodeAndBulkIssue(ctx context.Context, w http.ResponseWrit
 		batchResp.Error = sb.String()
 	}
 
+	// The codes have already been issued, so a failure to render the letters is
+	// reported alongside the codes rather than discarding them.
+	if renderLetters && len(letterCodes) > 0 {
+		pdf, err := c.RenderLetters(ctx, currentRealm, request.LetterLocale, letterCodes)
+		if err != nil {
+			logger.Errorw("failed to render letters", "error", err)
+			result.obsResult = enobs.ResultError("FAILED_TO_RENDER_LETTERS")
+			HTTPCode = http.StatusInternalServerError
+			batchResp.Error = "Codes were issued, but printable letters could not be generated. See the codes array."
+			batchResp.ErrorCode = api.ErrInternal
+		} else {
+			batchResp.LettersPDF = pdf
+		}
+	}
+
 	c.h.RenderJSON(w, HTTPCode, batchResp)
 }
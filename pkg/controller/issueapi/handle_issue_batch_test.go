@@ -15,6 +15,7 @@
 package issueapi_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -93,6 +94,28 @@ func TestIssueBatch(t *testing.T) {
 			},
 			httpStatusCode: http.StatusOK,
 		},
+		{
+			name: "letters",
+			request: &api.BatchIssueCodeRequest{
+				Codes: []*api.IssueCodeRequest{
+					{
+						TestType:    "confirmed",
+						SymptomDate: symptomDate,
+						TZOffset:    float32(tzMinOffset),
+					},
+				},
+				Letters:      true,
+				LetterLocale: "es",
+			},
+			response: &api.BatchIssueCodeResponse{
+				Codes: []*api.IssueCodeResponse{
+					{
+						// success
+					},
+				},
+			},
+			httpStatusCode: http.StatusOK,
+		},
 		{
 			name: "all_failure",
 			request: &api.BatchIssueCodeRequest{
@@ -204,6 +227,22 @@ func TestIssueBatch(t *testing.T) {
 					t.Errorf("bad inner error code, expected %#v to be %#v", got, want)
 				}
 			}
+
+			if tc.request.Letters {
+				if !bytes.HasPrefix(apiResp.LettersPDF, []byte("%PDF")) {
+					t.Errorf("expected letters pdf, got %q", apiResp.LettersPDF)
+				}
+				for _, issuedCode := range apiResp.Codes {
+					if issuedCode.LongCode == "" {
+						t.Errorf("expected long code for letter")
+					}
+					if issuedCode.LongExpiresAtTimestamp <= issuedCode.ExpiresAtTimestamp {
+						t.Errorf("expected long code to outlive short code for letter")
+					}
+				}
+			} else if len(apiResp.LettersPDF) > 0 {
+				t.Errorf("expected no letters pdf")
+			}
 		})
 	}
 }
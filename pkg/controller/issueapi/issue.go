@@ -39,12 +39,17 @@ type IssueRequestInternal struct {
 	UserRequested bool
 	// These files are for user initiated report
 	Nonce []byte
+	// Letter indicates the code will be printed in a patient letter, so the long
+	// code must not expire with the short code.
+	Letter bool
 }
 
 // IssueResult is the response returned from IssueLogic.IssueOne or IssueMany.
 type IssueResult struct {
 	VerCode      *database.VerificationCode
 	GeneratedSMS string
+	QRCodePNG    string
+	QRCodeSVG    string
 	ErrorReturn  *api.ErrorReturn
 	HTTPCode     int
 	obsResult    tag.Mutator
@@ -73,6 +78,8 @@ func (result *IssueResult) IssueCodeResponse() *api.IssueCodeResponse {
 		resp.GeneratedSMS = result.GeneratedSMS
 		resp.Phone = v.PhoneNumber
 	}
+	resp.QRCodePNG = result.QRCodePNG
+	resp.QRCodeSVG = result.QRCodeSVG
 	return resp
 }
 
@@ -82,7 +89,9 @@ func (c *Controller) IssueOne(ctx context.Context, request *IssueRequestInternal
 	return results[0]
 }
 
-// IssueMany handles validating a list of IssueCodeRequest, issuing new codes, and sending SMS messages.
+// IssueMany handles validating a list of IssueCodeRequest, issuing new codes, and sending SMS and email messages.
+// If the SMS outbox is enabled, messages are queued for delivery instead of
+// being sent during the request.
 func (c *Controller) IssueMany(ctx context.Context, requests []*IssueRequestInternal) []*IssueResult {
 	realm := controller.RealmFromContext(ctx)
 
@@ -121,6 +130,14 @@ func (c *Controller) IssueMany(ctx context.Context, requests []*IssueRequestInte
 		return results
 	}
 
+	// Send emails if there's an email provider.
+	emailProvider, err := c.emailProviderFor(ctx, realm)
+	if err != nil {
+		logger.Errorw("failed to get email provider", "error", err)
+		errorAll(results, api.InternalError())
+		return results
+	}
+
 	var wg sync.WaitGroup
 	for i, result := range results {
 		// Do not attempt to process things that have already errored.
@@ -131,33 +148,60 @@ func (c *Controller) IssueMany(ctx context.Context, requests []*IssueRequestInte
 		// Get the associated request for this result.
 		issueReq := requests[i].IssueRequest
 
-		// Do not attempt to process requests that do not have a phone number.
-		if issueReq.Phone == "" {
+		// The QR code only depends on the issued code, so it is rendered before
+		// any messages are sent.
+		if issueReq.QRCode {
+			c.BuildQRCode(ctx, realm, result)
+			if result.ErrorReturn != nil {
+				continue
+			}
+		}
+
+		// Do not attempt to process requests that do not have a phone number or
+		// email address.
+		if issueReq.Phone == "" && issueReq.Email == "" {
 			continue
 		}
 
-		// If the request was only to generate the SMS, generate and sign the SMS
-		// and attach the message to the response.
-		if issueReq.OnlyGenerateSMS {
-			message, err := c.BuildSMS(ctx, realm, smsSigner, keyID, issueReq, result.VerCode)
-			if err != nil {
-				result.obsResult = enobs.ResultError("FAILED_TO_BUILD_SMS")
-				result.HTTPCode = http.StatusInternalServerError
-				result.ErrorReturn = api.Errorf("failed to build sms: %s", err).WithCode(api.ErrSMSFailure)
+		sendSMS := false
+		if issueReq.Phone != "" {
+			switch {
+			case issueReq.OnlyGenerateSMS:
+				// If the request was only to generate the SMS, generate and sign the
+				// SMS and attach the message to the response. Do not attempt to send.
+				message, err := c.BuildSMS(ctx, realm, smsSigner, keyID, issueReq, result.VerCode)
+				if err != nil {
+					result.obsResult = enobs.ResultError("FAILED_TO_BUILD_SMS")
+					result.HTTPCode = http.StatusInternalServerError
+					result.ErrorReturn = api.Errorf("failed to build sms: %s", err).WithCode(api.ErrSMSFailure)
+				}
+				result.GeneratedSMS = message
+			case smsProvider != nil && c.config.GetFeatureConfig().EnableSMSOutbox:
+				// If the outbox is enabled, the message is delivered asynchronously by
+				// the sms-outbox service.
+				c.QueueSMS(ctx, realm, smsSigner, keyID, issueReq, result)
+			case smsProvider != nil:
+				sendSMS = true
 			}
-			result.GeneratedSMS = message
+		}
 
-			// Do not attempt to send if OnlyGenerateSMS was true.
+		sendEmail := issueReq.Email != "" && emailProvider != nil
+		if result.ErrorReturn != nil || (!sendSMS && !sendEmail) {
 			continue
 		}
 
-		if smsProvider != nil {
-			wg.Add(1)
-			go func(request *api.IssueCodeRequest, r *IssueResult) {
-				defer wg.Done()
+		// SMS and email are sent sequentially for a single result, since a
+		// failure on either deletes the code and updates the result.
+		wg.Add(1)
+		go func(request *api.IssueCodeRequest, r *IssueResult) {
+			defer wg.Done()
+			if sendSMS {
 				c.SendSMS(ctx, realm, smsProvider, smsSigner, keyID, request, r)
-			}(issueReq, result)
-		}
+			}
+			if sendEmail && r.ErrorReturn == nil {
+				c.SendEmail(ctx, realm, emailProvider, request, r)
+			}
+		}(issueReq, result)
 	}
 	wg.Wait()
 
@@ -172,6 +172,42 @@ func TestIssue(t *testing.T) {
 			},
 			code: http.StatusOK,
 		},
+		{
+			name: "qr_code_realm_not_allowed",
+			membership: &database.Membership{
+				Realm: &database.Realm{
+					EnableENExpress: false,
+				},
+				Permissions: rbac.CodeIssue,
+			},
+			fn: c.IssueWithUIAuth,
+			req: api.IssueCodeRequest{
+				QRCode: true,
+			},
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "qr_code_realm_allowed",
+			membership: &database.Membership{
+				Realm: &database.Realm{
+					CodeDuration:     database.FromDuration(5 * time.Minute),
+					CodeLength:       8,
+					LongCodeDuration: database.FromDuration(15 * time.Minute),
+					LongCodeLength:   16,
+					AllowedTestTypes: database.TestTypeConfirmed,
+					EnableENExpress:  true,
+					RegionCode:       "US-AA",
+				},
+				Permissions: rbac.CodeIssue,
+			},
+			fn: c.IssueWithUIAuth,
+			req: api.IssueCodeRequest{
+				SymptomDate: time.Now().UTC().Format(project.RFC3339Date),
+				TestType:    "confirmed",
+				QRCode:      true,
+			},
+			code: http.StatusOK,
+		},
 	}
 
 	for _, tc := range cases {
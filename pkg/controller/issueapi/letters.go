@@ -0,0 +1,206 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/letter"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+const (
+	// maxLettersPerRequest is the maximum number of letters which can be
+	// rendered into a single PDF.
+	maxLettersPerRequest = 500
+
+	// logoCacheTTL is how long a realm's converted logo is cached, including
+	// the absence of a logo which could not be fetched.
+	logoCacheTTL = 15 * time.Minute
+)
+
+// letterCode is an issued code to print in a patient letter.
+type letterCode struct {
+	LongCode  string
+	ExpiresAt time.Time
+	TZOffset  float32
+}
+
+// HandleLettersUI responds to the /letters API for rendering printable patient
+// letters for previously issued codes. It is called via AJAX from the bulk
+// issue page and responds with a PDF document.
+func (c *Controller) HandleLettersUI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("issueapi.HandleLettersUI")
+
+		membership := controller.MembershipFromContext(ctx)
+		if !membership.Can(rbac.CodeBulkIssue) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		realm := membership.Realm
+
+		if !realm.AllowBulkUpload {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("bulk issuing is not enabled on this realm"))
+			return
+		}
+
+		var request api.LettersRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrUnparsableRequest))
+			return
+		}
+
+		if len(request.Codes) == 0 {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("no codes provided"))
+			return
+		}
+		if l := len(request.Codes); l > maxLettersPerRequest {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("letter limit [%d] exceeded", maxLettersPerRequest))
+			return
+		}
+
+		// Only print letters for codes which belong to this realm and can still be
+		// claimed. The long code is required since only its HMAC is stored.
+		now := time.Now().UTC()
+		codes := make([]*letterCode, 0, len(request.Codes))
+		for _, lc := range request.Codes {
+			longCode := realm.NormalizeCode(lc.LongCode)
+			vc, err := realm.FindVerificationCodeByLongCode(c.db, lc.UUID, longCode)
+			if err != nil {
+				if database.IsNotFound(err) {
+					c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("code %s does not exist", lc.UUID))
+					return
+				}
+				logger.Errorw("failed to lookup verification code", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+
+			if vc.Claimed || !vc.LongExpiresAt.After(now) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("code %s has already been used or has expired", lc.UUID))
+				return
+			}
+
+			codes = append(codes, &letterCode{
+				LongCode:  longCode,
+				ExpiresAt: vc.LongExpiresAt,
+				TZOffset:  request.TZOffset,
+			})
+		}
+
+		pdf, err := c.RenderLetters(ctx, realm, request.LetterLocale, codes)
+		if err != nil {
+			logger.Errorw("failed to render letters", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="letters.pdf"`)
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(pdf); err != nil {
+			logger.Errorw("failed to write letters", "error", err)
+		}
+	})
+}
+
+// RenderLetters renders a PDF with one printable patient letter for each code,
+// using the realm's letter template for the locale. The realm's logo is
+// included on a best-effort basis.
+func (c *Controller) RenderLetters(ctx context.Context, realm *database.Realm, locale string, codes []*letterCode) ([]byte, error) {
+	cfg := c.config.IssueConfig()
+	opts := &letter.Options{
+		Title:    realm.Name,
+		PageSize: cfg.LetterPageSize,
+		FontPath: cfg.LetterFontPath,
+		Logo:     c.logoFor(ctx, realm),
+	}
+
+	letters := make([]*letter.Letter, 0, len(codes))
+	for _, code := range codes {
+		expiresAt := code.ExpiresAt.In(letterLocation(code.TZOffset))
+
+		l := &letter.Letter{
+			Text: realm.BuildLetterText(locale, code.LongCode, cfg.ENExpressRedirectDomain, expiresAt),
+			Code: realm.FormatCode(code.LongCode),
+		}
+		if realm.EnableENExpress {
+			l.Link = realm.BuildENXLink(code.LongCode, cfg.ENExpressRedirectDomain)
+		}
+		letters = append(letters, l)
+	}
+
+	var b bytes.Buffer
+	if err := letter.Render(&b, letters, opts); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// logoFor returns the realm's logo converted for letters, or nil if the realm
+// has no logo or it could not be fetched. It pulls the value from a local
+// in-memory cache, keyed by the logo URL so changes take effect immediately.
+func (c *Controller) logoFor(ctx context.Context, realm *database.Realm) []byte {
+	if realm.AgencyImage == "" {
+		return nil
+	}
+
+	key := fmt.Sprintf("realm:%d:logo:%s", realm.ID, realm.AgencyImage)
+	result, _ := c.logoCache.WriteThruLookup(key, func() (interface{}, error) {
+		logo, err := letter.FetchLogo(ctx, realm.AgencyImage)
+		if err != nil {
+			// Do not cache the failure if the request was canceled.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+
+			logger := logging.FromContext(ctx).Named("issueapi.logoFor")
+			logger.Warnw("failed to fetch realm logo, printing letters without it", "error", err)
+			return []byte(nil), nil
+		}
+		return logo, nil
+	})
+
+	logo, _ := result.([]byte)
+	return logo
+}
+
+// letterLocation returns a fixed time zone for the given offset in minutes, as
+// reported by JavaScript's getTimezoneOffset (positive values are behind UTC).
+func letterLocation(tzOffset float32) *time.Location {
+	offset := -int(tzOffset) * 60
+	if offset == 0 {
+		return time.UTC
+	}
+
+	sign := '+'
+	abs := offset
+	if abs < 0 {
+		sign = '-'
+		abs = -abs
+	}
+	name := fmt.Sprintf("UTC%c%02d:%02d", sign, abs/3600, (abs%3600)/60)
+	return time.FixedZone(name, offset)
+}
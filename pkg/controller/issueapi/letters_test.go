@@ -0,0 +1,75 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestController_LogoFor(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	var fetches int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		png.Encode(w, image.NewGray(image.Rect(0, 0, 4, 4)))
+	})
+	mux.HandleFunc("/missing.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		http.NotFound(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c := New(nil, nil, nil, nil, nil)
+
+	if got := c.logoFor(ctx, &database.Realm{}); got != nil {
+		t.Errorf("expected no logo for realm without an image, got %x", got)
+	}
+
+	realm := &database.Realm{AgencyImage: srv.URL + "/logo.png"}
+	realm.ID = 1
+	for i := 0; i < 2; i++ {
+		if got := c.logoFor(ctx, realm); len(got) == 0 {
+			t.Errorf("expected logo")
+		}
+	}
+	if got, want := atomic.LoadInt32(&fetches), int32(1); got != want {
+		t.Errorf("expected %d fetches to be %d", got, want)
+	}
+
+	// Failures are cached too, so a broken logo is not fetched for every
+	// request.
+	realm.AgencyImage = srv.URL + "/missing.png"
+	for i := 0; i < 2; i++ {
+		if got := c.logoFor(ctx, realm); got != nil {
+			t.Errorf("expected no logo, got %x", got)
+		}
+	}
+	if got, want := atomic.LoadInt32(&fetches), int32(2); got != want {
+		t.Errorf("expected %d fetches to be %d", got, want)
+	}
+}
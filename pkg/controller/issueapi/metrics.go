@@ -34,6 +34,8 @@ var (
 
 	mSMSLatencyMs = stats.Float64(metricPrefix+"/sms_request", "# of sms requests", stats.UnitMilliseconds)
 
+	mEmailLatencyMs = stats.Float64(metricPrefix+"/email_request", "# of email requests", stats.UnitMilliseconds)
+
 	mRealmTokenUsed = stats.Int64(metricPrefix+"/realm_token_used", "# of realm token used.", stats.UnitDimensionless)
 
 	// separate metrics related to user report API.
@@ -79,6 +81,20 @@ func init() {
 			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
 			Aggregation: ochttp.DefaultLatencyDistribution,
 		},
+		{
+			Name:        metricPrefix + "/email_request_count",
+			Measure:     mEmailLatencyMs,
+			Description: "The # of email requests",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/email_request_latency",
+			Measure:     mEmailLatencyMs,
+			Description: "The latency distribution of email requests",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Aggregation: ochttp.DefaultLatencyDistribution,
+		},
 		{
 			Name:        metricPrefix + "/realm_token_used_count",
 			Description: "The count of # of realm token used.",
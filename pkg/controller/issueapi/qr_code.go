@@ -0,0 +1,57 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/qrcode"
+)
+
+// BuildQRCode renders the EN Express link for the issued code as a QR code and
+// attaches the PNG and SVG to the IssueResult. The QR code is generated
+// in-process so the code is never sent to a third party.
+func (c *Controller) BuildQRCode(ctx context.Context, realm *database.Realm, result *IssueResult) {
+	logger := logging.FromContext(ctx).Named("issueapi.BuildQRCode")
+
+	redirectDomain := c.config.IssueConfig().ENExpressRedirectDomain
+	link := realm.BuildENXLink(result.VerCode.LongCode, redirectDomain)
+
+	png, err := qrcode.PNGDataURL(link, qrcode.DefaultSize)
+	if err != nil {
+		logger.Errorw("failed to build qr code png", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_BUILD_QR_CODE")
+		result.HTTPCode = http.StatusInternalServerError
+		result.ErrorReturn = api.Errorf("failed to build qr code: %s", err).WithCode(api.ErrInternal)
+		return
+	}
+
+	svg, err := qrcode.SVG(link)
+	if err != nil {
+		logger.Errorw("failed to build qr code svg", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_BUILD_QR_CODE")
+		result.HTTPCode = http.StatusInternalServerError
+		result.ErrorReturn = api.Errorf("failed to build qr code: %s", err).WithCode(api.ErrInternal)
+		return
+	}
+
+	result.QRCodePNG = string(png)
+	result.QRCodeSVG = string(svg)
+}
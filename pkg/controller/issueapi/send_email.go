@@ -0,0 +1,114 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
+)
+
+// SendEmail sends the verification code email with the given provider and
+// wraps any seen errors into the IssueResult.
+func (c *Controller) SendEmail(ctx context.Context, realm *database.Realm, emailProvider email.Provider, request *api.IssueCodeRequest, result *IssueResult) {
+	if request.Email == "" {
+		return
+	}
+
+	if err := c.doSendEmail(ctx, realm, emailProvider, request, result); err != nil {
+		result.HTTPCode = http.StatusBadRequest
+		result.ErrorReturn = api.Errorf("failed to send email: %s", err).WithCode(api.ErrEmailFailure)
+	}
+}
+
+// CodeEmailSubject is the subject of emails containing verification codes.
+const CodeEmailSubject = "Your Exposure Notifications verification code"
+
+// BuildEmail builds the complete email message, including headers, for the
+// verification code.
+func (c *Controller) BuildEmail(ctx context.Context, realm *database.Realm, emailProvider email.Provider, request *api.IssueCodeRequest, vercode *database.VerificationCode) ([]byte, error) {
+	redirectDomain := c.config.IssueConfig().ENExpressRedirectDomain
+
+	msg := &email.Message{
+		From:    emailProvider.From(),
+		To:      request.Email,
+		Subject: CodeEmailSubject,
+	}
+	text := realm.BuildEmailCodeText(vercode.Code, vercode.LongCode, redirectDomain)
+	return controller.ComposeCustomEmail(c.h, msg, text)
+}
+
+func (c *Controller) doSendEmail(ctx context.Context, realm *database.Realm, emailProvider email.Provider, request *api.IssueCodeRequest, result *IssueResult) error {
+	defer enobs.RecordLatency(ctx, time.Now(), mEmailLatencyMs, &result.obsResult)
+
+	logger := logging.FromContext(ctx).Named("issueapi.sendEmail")
+
+	// Build the message
+	message, err := c.BuildEmail(ctx, realm, emailProvider, request, result.VerCode)
+	if err != nil {
+		logger.Errorw("failed to build email", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_BUILD_EMAIL")
+		return err
+	}
+
+	// Send the message
+	if err := emailProvider.SendEmail(ctx, request.Email, message); err != nil {
+		c.deleteIssuedCode(ctx, request, result)
+
+		logger.Infow("failed to send email", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_SEND_EMAIL")
+		return err
+	}
+
+	return nil
+}
+
+// emailProviderFor returns the email provider for the given realm. It pulls
+// the value from a local in-memory cache. If the realm has no email
+// configuration, it returns nil.
+func (c *Controller) emailProviderFor(ctx context.Context, realm *database.Realm) (email.Provider, error) {
+	key := fmt.Sprintf("realm:%d:email_provider", realm.ID)
+	result, err := c.localCache.WriteThruLookup(key, func() (interface{}, error) {
+		provider, err := realm.EmailProvider(c.db)
+		if err != nil {
+			if database.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return provider, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, nil
+	}
+	typ, ok := result.(email.Provider)
+	if !ok {
+		return nil, fmt.Errorf("invalid type %T", result)
+	}
+
+	return typ, nil
+}
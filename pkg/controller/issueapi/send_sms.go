@@ -25,6 +25,8 @@ import (
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	enobs "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/webhooks"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/signatures"
 	"github.com/google/exposure-notifications-verification-server/pkg/sms"
@@ -83,8 +85,6 @@ func (c *Controller) SendSMS(ctx context.Context, realm *database.Realm, smsProv
 // BuildSMS builds and signs (if configured) the SMS message. It returns the
 // complete and compiled message.
 func (c *Controller) BuildSMS(ctx context.Context, realm *database.Realm, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, vercode *database.VerificationCode) (string, error) {
-	now := time.Now()
-
 	logger := logging.FromContext(ctx).Named("issueapi.BuildSMS")
 	redirectDomain := c.config.IssueConfig().ENExpressRedirectDomain
 
@@ -95,6 +95,31 @@ func (c *Controller) BuildSMS(ctx context.Context, realm *database.Realm, signer
 			"error", err)
 		return "", fmt.Errorf("failed to build sms message: %w", err)
 	}
+	return c.signSMS(ctx, signer, keyID, request, message)
+}
+
+// BuildSMSReminder builds and signs (if configured) the reminder message for
+// an unclaimed code, using the realm's reminder template.
+func (c *Controller) BuildSMSReminder(ctx context.Context, realm *database.Realm, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, vercode *database.VerificationCode) (string, error) {
+	logger := logging.FromContext(ctx).Named("issueapi.BuildSMSReminder")
+	redirectDomain := c.config.IssueConfig().ENExpressRedirectDomain
+
+	message, err := realm.BuildSMSReminderText(vercode.Code, vercode.LongCode, redirectDomain)
+	if err != nil {
+		logger.Errorw("failed to build sms reminder text for realm",
+			"template", realm.SMSReminderTemplateLabel,
+			"error", err)
+		return "", fmt.Errorf("failed to build sms reminder: %w", err)
+	}
+	return c.signSMS(ctx, signer, keyID, request, message)
+}
+
+// signSMS signs the message if the realm has configured and enabled SMS
+// signing.
+func (c *Controller) signSMS(ctx context.Context, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, message string) (string, error) {
+	now := time.Now()
+
+	logger := logging.FromContext(ctx).Named("issueapi.signSMS")
 
 	// A signer will only be provided if the realm has configured and enabled
 	// SMS signing.
@@ -107,7 +132,7 @@ func (c *Controller) BuildSMS(ctx context.Context, realm *database.Realm, signer
 		purpose = signatures.SMSPurposeUserReport
 	}
 
-	message, err = signatures.SignSMS(signer, keyID, now, purpose, request.Phone, message)
+	message, err := signatures.SignSMS(signer, keyID, now, purpose, request.Phone, message)
 	if err != nil {
 		logger.Errorw("failed to sign sms", "error", err)
 		if c.config.GetAuthenticatedSMSFailClosed() {
@@ -130,20 +155,15 @@ func (c *Controller) doSend(ctx context.Context, realm *database.Realm, smsProvi
 		return err
 	}
 
-	// Send the message
-	if err := smsProvider.SendSMS(ctx, request.Phone, message); err != nil {
-		// Delete the user report record.
-		if result.VerCode.UserReportID != nil {
-			if err := c.db.DeleteUserReport(request.Phone); err != nil {
-				logger.Errorw("failed to delete the user report record", "error", err)
-			}
-		}
+	// Ask the provider to report the delivery status, if supported.
+	endpoint := c.config.IssueConfig().SMSStatusCallbackEndpoint
+	if u := webhooks.TwilioStatusCallbackURL(endpoint, realm.ID, result.VerCode.UUID); u != "" {
+		ctx = sms.WithStatusCallback(ctx, u)
+	}
 
-		// Delete the token
-		if err := c.db.DeleteVerificationCode(result.VerCode.ID); err != nil {
-			logger.Errorw("failed to delete verification code", "error", err)
-			// fallthrough to the error
-		}
+	// Send the message
+	if err := controller.SendSMS(ctx, c.db, realm.ID, smsProvider, request.Phone, message); err != nil {
+		c.deleteIssuedCode(ctx, request, result)
 
 		logger.Infow("failed to send sms", "error", ScrubPhoneNumbers(err.Error()))
 		result.obsResult = enobs.ResultError("FAILED_TO_SEND_SMS")
@@ -152,3 +172,109 @@ func (c *Controller) doSend(ctx context.Context, realm *database.Realm, smsProvi
 
 	return nil
 }
+
+// QueueSMS builds the sms message and saves it to the outbox, from which it is
+// delivered by the sms-outbox service. Any seen errors are wrapped into the
+// IssueResult.
+func (c *Controller) QueueSMS(ctx context.Context, realm *database.Realm, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, result *IssueResult) {
+	if request.Phone == "" {
+		return
+	}
+
+	if err := c.doQueue(ctx, realm, signer, keyID, request, result); err != nil {
+		result.HTTPCode = http.StatusInternalServerError
+		result.ErrorReturn = api.Errorf("failed to queue sms: %s", err).WithCode(api.ErrSMSFailure)
+	}
+}
+
+func (c *Controller) doQueue(ctx context.Context, realm *database.Realm, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, result *IssueResult) error {
+	logger := logging.FromContext(ctx).Named("issueapi.doQueue")
+
+	// Build the message
+	message, err := c.BuildSMS(ctx, realm, signer, keyID, request, result.VerCode)
+	if err != nil {
+		logger.Errorw("failed to build sms", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_BUILD_SMS")
+		return err
+	}
+
+	// The message contains both the short code and the long code link, so it is
+	// useful until the later of the two expires.
+	expiresAt := result.VerCode.ExpiresAt
+	if result.VerCode.LongExpiresAt.After(expiresAt) {
+		expiresAt = result.VerCode.LongExpiresAt
+	}
+
+	outboxMessage := &database.SMSOutboxMessage{
+		RealmID:            realm.ID,
+		VerificationCodeID: result.VerCode.ID,
+		PhoneNumber:        request.Phone,
+		Message:            message,
+		ExpiresAt:          expiresAt,
+	}
+	if err := c.db.SaveSMSOutboxMessage(outboxMessage); err != nil {
+		c.deleteIssuedCode(ctx, request, result)
+
+		logger.Errorw("failed to queue sms", "error", err)
+		result.obsResult = enobs.ResultError("FAILED_TO_QUEUE_SMS")
+		return err
+	}
+
+	c.queueReminder(ctx, realm, signer, keyID, request, result)
+	return nil
+}
+
+// queueReminder schedules a reminder for the code if the realm has reminders
+// enabled. The reminder is canceled if the code is claimed or expired before
+// it is sent. Failing to schedule a reminder does not fail the issue request.
+func (c *Controller) queueReminder(ctx context.Context, realm *database.Realm, signer crypto.Signer, keyID string, request *api.IssueCodeRequest, result *IssueResult) {
+	if !realm.SMSRemindersEnabled() || request.TestType == api.TestTypeUserReport {
+		return
+	}
+
+	// Codes issued with a shortened expiration may not live long enough for a
+	// reminder.
+	remindAt := realm.SMSReminderTime(result.VerCode)
+	if !remindAt.After(time.Now()) {
+		return
+	}
+
+	logger := logging.FromContext(ctx).Named("issueapi.queueReminder")
+
+	message, err := c.BuildSMSReminder(ctx, realm, signer, keyID, request, result.VerCode)
+	if err != nil {
+		logger.Errorw("failed to build sms reminder", "error", err)
+		return
+	}
+
+	reminder := &database.SMSOutboxMessage{
+		RealmID:            realm.ID,
+		VerificationCodeID: result.VerCode.ID,
+		Kind:               database.SMSOutboxKindReminder,
+		PhoneNumber:        request.Phone,
+		Message:            message,
+		NextAttemptAt:      remindAt,
+		ExpiresAt:          result.VerCode.LongExpiresAt,
+	}
+	if err := c.db.QueueSMSReminder(reminder); err != nil {
+		logger.Errorw("failed to queue sms reminder", "error", err)
+	}
+}
+
+// deleteIssuedCode deletes the verification code (and user report, if any)
+// for a result whose message could not be delivered.
+func (c *Controller) deleteIssuedCode(ctx context.Context, request *api.IssueCodeRequest, result *IssueResult) {
+	logger := logging.FromContext(ctx).Named("issueapi.deleteIssuedCode")
+
+	// Delete the user report record.
+	if result.VerCode.UserReportID != nil {
+		if err := c.db.DeleteUserReport(request.Phone); err != nil {
+			logger.Errorw("failed to delete the user report record", "error", err)
+		}
+	}
+
+	// Delete the token
+	if err := c.db.DeleteVerificationCode(result.VerCode.ID); err != nil {
+		logger.Errorw("failed to delete verification code", "error", err)
+	}
+}
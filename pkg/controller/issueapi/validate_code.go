@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
@@ -86,6 +87,19 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, internalRequest
 		request.Phone = canonicalPhone
 	}
 
+	// Parse and canonicalize email addresses.
+	if request.Email != "" {
+		addr, err := mail.ParseAddress(request.Email)
+		if err != nil {
+			return nil, &IssueResult{
+				obsResult:   enobs.ResultError("INVALID_EMAIL"),
+				HTTPCode:    http.StatusBadRequest,
+				ErrorReturn: api.Errorf("invalid email address: %s", err).WithCode(api.ErrEmailInvalid),
+			}
+		}
+		request.Email = addr.Address
+	}
+
 	if request.OnlyGenerateSMS {
 		if !realm.AllowGeneratedSMS {
 			return nil, &IssueResult{
@@ -105,6 +119,14 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, internalRequest
 		}
 	}
 
+	if request.QRCode && !realm.EnableENExpress {
+		return nil, &IssueResult{
+			obsResult:   enobs.ResultError("QR_CODE_NOT_ALLOWED"),
+			HTTPCode:    http.StatusBadRequest,
+			ErrorReturn: api.Errorf("realm is not permitted to use qrCode").WithCode(api.ErrUnparsableRequest),
+		}
+	}
+
 	// Verify SMS configuration if phone was provided
 	var smsProvider sms.Provider
 	if !request.OnlyGenerateSMS && request.Phone != "" {
@@ -128,9 +150,32 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, internalRequest
 		}
 	}
 
-	if request.Phone == "" || (smsProvider == nil && !request.OnlyGenerateSMS) {
-		// If this isn't going to be send via SMS, make the long code expiration time same as short.
-		// This is because the long code will never be shown or sent.
+	// Verify email configuration if email was provided
+	if request.Email != "" {
+		hasEmailConfig, err := realm.HasEmailConfig(c.db)
+		if err != nil {
+			logger.Errorw("failed to get email provider", "error", err)
+			return nil, &IssueResult{
+				obsResult:   enobs.ResultError("FAILED_TO_GET_EMAIL_PROVIDER"),
+				HTTPCode:    http.StatusInternalServerError,
+				ErrorReturn: api.Errorf("failed to get email provider").WithCode(api.ErrInternal),
+			}
+		}
+		if !hasEmailConfig {
+			err := fmt.Errorf("email provided, but no email provider is configured")
+			return nil, &IssueResult{
+				obsResult:   enobs.ResultError("FAILED_TO_GET_EMAIL_PROVIDER"),
+				HTTPCode:    http.StatusBadRequest,
+				ErrorReturn: api.Error(err),
+			}
+		}
+	}
+
+	sendsSMS := request.Phone != "" && (smsProvider != nil || request.OnlyGenerateSMS)
+	if !sendsSMS && request.Email == "" && !request.QRCode && !internalRequest.Letter {
+		// If this isn't going to be send via SMS, email, QR code, or letter, make
+		// the long code expiration time same as short. This is because the long code will
+		// never be shown or sent.
 		vCode.LongExpiresAt = vCode.ExpiresAt
 	}
 
@@ -194,5 +239,14 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, internalRequest
 		}
 	}
 
+	// The API key may be restricted to a subset of the realm's test types.
+	if authApp := controller.AuthorizedAppFromContext(ctx); authApp != nil && !authApp.ValidTestType(vCode.TestType) {
+		return nil, &IssueResult{
+			obsResult:   enobs.ResultError("UNSUPPORTED_TEST_TYPE"),
+			HTTPCode:    http.StatusBadRequest,
+			ErrorReturn: api.Errorf("API key is not permitted to issue test type: %v", request.TestType).WithCode(api.ErrUnsupportedTestType),
+		}
+	}
+
 	return vCode, nil
 }
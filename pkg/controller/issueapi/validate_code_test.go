@@ -76,6 +76,7 @@ func TestValidate(t *testing.T) {
 
 	cases := []struct {
 		name           string
+		authApp        *database.AuthorizedApp
 		request        api.IssueCodeRequest
 		responseErr    string
 		httpStatusCode int
@@ -108,6 +109,20 @@ func TestValidate(t *testing.T) {
 			responseErr:    api.ErrUnsupportedTestType,
 			httpStatusCode: http.StatusBadRequest,
 		},
+		{
+			name: "api_key_unsupported_test_type",
+			authApp: &database.AuthorizedApp{
+				Model:            gorm.Model{ID: 124},
+				APIKeyType:       database.APIKeyTypeAdmin,
+				AllowedTestTypes: database.TestTypeLikely,
+			},
+			request: api.IssueCodeRequest{
+				TestType:    "confirmed", // this api key only supports likely
+				SymptomDate: symptomDate,
+			},
+			responseErr:    api.ErrUnsupportedTestType,
+			httpStatusCode: http.StatusBadRequest,
+		},
 		{
 			name: "invalid_test_type",
 			request: api.IssueCodeRequest{
@@ -197,8 +212,13 @@ func TestValidate(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
+			app := authApp
+			if tc.authApp != nil {
+				app = tc.authApp
+			}
+
 			ctx := ctx
-			ctx = controller.WithAuthorizedApp(ctx, authApp)
+			ctx = controller.WithAuthorizedApp(ctx, app)
 			ctx = controller.WithMembership(ctx, &database.Membership{UserID: 456})
 
 			verCode, result := c.BuildVerificationCode(ctx, &issueapi.IssueRequestInternal{IssueRequest: &tc.request}, realm)
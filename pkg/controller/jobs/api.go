@@ -0,0 +1,88 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleShowAPI returns the job's progress. API keys may only view jobs which
+// were created through the API.
+func (c *Controller) HandleShowAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, ok := c.findAPIJob(w, r)
+		if !ok {
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, job.JobResponse())
+	})
+}
+
+// HandleResultsAPI downloads the job's per-item results as a CSV. API keys may
+// only view jobs which were created through the API.
+func (c *Controller) HandleResultsAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, ok := c.findAPIJob(w, r)
+		if !ok {
+			return
+		}
+
+		filename := fmt.Sprintf("job-%s-results.csv", job.UUID)
+		c.h.RenderCSV(w, http.StatusOK, filename, job)
+	})
+}
+
+// findAPIJob finds the job in the request path, rendering the appropriate
+// error and returning false if the job does not exist or was not created
+// through the API.
+func (c *Controller) findAPIJob(w http.ResponseWriter, r *http.Request) (*database.Job, bool) {
+	ctx := r.Context()
+
+	logger := logging.FromContext(ctx).Named("jobs.findAPIJob")
+
+	authorizedApp := controller.AuthorizedAppFromContext(ctx)
+	currentRealm := controller.RealmFromContext(ctx)
+	if authorizedApp == nil || currentRealm == nil {
+		controller.MissingAuthorizedApp(w, r, c.h)
+		return nil, false
+	}
+
+	job, err := currentRealm.FindJob(c.db, mux.Vars(r)["id"])
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("job not found"))
+			return nil, false
+		}
+
+		logger.Errorw("failed to find job", "error", err)
+		c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+		return nil, false
+	}
+
+	if job.AuthorizedAppID == nil {
+		c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("job not found"))
+		return nil, false
+	}
+	return job, true
+}
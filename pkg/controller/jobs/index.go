@@ -0,0 +1,66 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+)
+
+// HandleIndex lists the realm's jobs which the user is permitted to view.
+func (c *Controller) HandleIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		kinds := visibleKinds(membership)
+		if len(kinds) == 0 {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		jobs, paginator, err := currentRealm.ListJobs(c.db, kinds, pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderIndex(ctx, w, jobs, paginator)
+	})
+}
+
+// renderIndex renders the index page.
+func (c *Controller) renderIndex(ctx context.Context, w http.ResponseWriter, jobs []*database.Job, paginator *pagination.Paginator) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Jobs")
+	m["jobs"] = jobs
+	m["paginator"] = paginator
+	c.h.RenderHTML(w, "jobs/index", m)
+}
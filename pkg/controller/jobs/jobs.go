@@ -0,0 +1,50 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jobs contains controllers for viewing the status and results of a
+// realm's background jobs.
+package jobs
+
+import (
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+type Controller struct {
+	db *database.Database
+	h  *render.Renderer
+}
+
+func New(db *database.Database, h *render.Renderer) *Controller {
+	return &Controller{
+		db: db,
+		h:  h,
+	}
+}
+
+// visibleKinds returns the job kinds the membership is permitted to view.
+func visibleKinds(membership *database.Membership) []database.JobKind {
+	kinds := make([]database.JobKind, 0, len(database.JobKinds))
+	for _, k := range database.JobKinds {
+		if membership.Can(k.Permission()) {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+// canView returns true if the membership is permitted to view the job.
+func canView(membership *database.Membership, job *database.Job) bool {
+	return membership.Can(job.Kind.Permission())
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleShow displays the job's progress.
+func (c *Controller) HandleShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		job, ok := c.findJob(w, r)
+		if !ok {
+			return
+		}
+
+		c.renderShow(ctx, w, job)
+	})
+}
+
+// HandleResults downloads the job's per-item results as a CSV.
+func (c *Controller) HandleResults() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, ok := c.findJob(w, r)
+		if !ok {
+			return
+		}
+
+		filename := fmt.Sprintf("job-%s-results.csv", job.UUID)
+		c.h.RenderCSV(w, http.StatusOK, filename, job)
+	})
+}
+
+// findJob finds the job in the request path, rendering the appropriate error
+// and returning false if the job does not exist or the user is not permitted
+// to view it.
+func (c *Controller) findJob(w http.ResponseWriter, r *http.Request) (*database.Job, bool) {
+	ctx := r.Context()
+
+	membership := controller.MembershipFromContext(ctx)
+	if membership == nil {
+		controller.MissingMembership(w, r, c.h)
+		return nil, false
+	}
+	if len(visibleKinds(membership)) == 0 {
+		controller.Unauthorized(w, r, c.h)
+		return nil, false
+	}
+	currentRealm := membership.Realm
+
+	job, err := currentRealm.FindJob(c.db, mux.Vars(r)["id"])
+	if err != nil {
+		if database.IsNotFound(err) {
+			controller.Unauthorized(w, r, c.h)
+			return nil, false
+		}
+
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+
+	if !canView(membership, job) {
+		controller.Unauthorized(w, r, c.h)
+		return nil, false
+	}
+	return job, true
+}
+
+// renderShow renders the show page.
+func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, job *database.Job) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Job: %s", job.Kind.Display())
+	m["job"] = job
+	c.h.RenderHTML(w, "jobs/show", m)
+}
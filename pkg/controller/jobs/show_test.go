@@ -0,0 +1,189 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/jobs"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleShow(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := jobs.New(harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleShow())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		t.Parallel()
+
+		realm, user := provisionRealm(t, harness.Database)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        user,
+			Permissions: rbac.UserRead,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "not-a-uuid"})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("wrong_kind", func(t *testing.T) {
+		t.Parallel()
+
+		realm, user := provisionRealm(t, harness.Database)
+		job := createUserImportJob(t, harness.Database, realm, user)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        user,
+			Permissions: rbac.CodeBulkIssue,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": job.UUID})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		realm, user := provisionRealm(t, harness.Database)
+		job := createUserImportJob(t, harness.Database, realm, user)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        user,
+			Permissions: rbac.UserRead,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": job.UUID})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Body.String(), "Import users"; !strings.Contains(got, want) {
+			t.Errorf("expected %q to contain %q", got, want)
+		}
+	})
+}
+
+func TestHandleResults(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := jobs.New(harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleResults())
+
+	realm, user := provisionRealm(t, harness.Database)
+	job := createUserImportJob(t, harness.Database, realm, user)
+	if err := job.RecordResults([]*database.JobResult{
+		{Line: 1, ID: "imported@example.com", Status: database.UserImportResultImported},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.Database.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = controller.WithSession(ctx, &sessions.Session{})
+	ctx = controller.WithMembership(ctx, &database.Membership{
+		Realm:       realm,
+		User:        user,
+		Permissions: rbac.UserRead,
+	})
+
+	w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+	r = mux.SetURLVars(r, map[string]string{"id": job.UUID})
+	handler.ServeHTTP(w, r)
+
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+	if got, want := w.Body.String(), "line,email,status,error\n1,imported@example.com,imported,\n"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+// provisionRealm returns the default realm and admin user.
+func provisionRealm(tb testing.TB, db *database.Database) (*database.Realm, *database.User) {
+	tb.Helper()
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	user, err := db.FindUser(1)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return realm, user
+}
+
+// createUserImportJob creates a pending user import job in the realm.
+func createUserImportJob(tb testing.TB, db *database.Database, realm *database.Realm, user *database.User) *database.Job {
+	tb.Helper()
+
+	job, err := database.NewUserImportJob(realm.ID, user.ID, &database.UserImportParams{}, []*database.UserImportRow{
+		{Line: 1, Email: "imported@example.com", Name: "Imported"},
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.SaveJob(job); err != nil {
+		tb.Fatal(err)
+	}
+	return job
+}
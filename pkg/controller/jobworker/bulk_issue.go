@@ -0,0 +1,115 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobworker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/uuid"
+)
+
+// bulkIssue returns the batch function for a bulk issue job. Codes are issued
+// on behalf of the API key which uploaded them.
+func (c *Controller) bulkIssue(ctx context.Context, job *database.Job, realm *database.Realm) (batchFunc, string, error) {
+	if !realm.AllowBulkUpload {
+		return nil, "bulk issuing is not enabled on this realm", nil
+	}
+
+	jobUUID, err := uuid.Parse(job.UUID)
+	if err != nil {
+		return nil, "job has an invalid uuid", nil
+	}
+
+	params, err := job.BulkIssueParams()
+	if err != nil {
+		return nil, "failed to decode job options", nil
+	}
+
+	if job.AuthorizedAppID == nil {
+		return nil, "API key no longer exists", nil
+	}
+	authApp, err := c.db.FindAuthorizedApp(*job.AuthorizedAppID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, "API key no longer exists", nil
+		}
+		return nil, "", fmt.Errorf("failed to find authorized app: %w", err)
+	}
+	if authApp.DeletedAt != nil {
+		return nil, "API key was disabled", nil
+	}
+
+	ctx = controller.WithRealm(ctx, realm)
+	ctx = controller.WithAuthorizedApp(ctx, authApp)
+
+	return func(_ context.Context, limit uint) ([]*database.JobResult, error) {
+		rows, err := job.PendingBulkIssueRows(limit)
+		if err != nil {
+			return nil, err
+		}
+
+		requests := make([]*issueapi.IssueRequestInternal, 0, len(rows))
+		for _, row := range rows {
+			// Rows without a UUID are given one derived from the job, so the same
+			// row is never issued twice if a batch is retried.
+			rowUUID := row.UUID
+			if rowUUID == "" {
+				rowUUID = uuid.NewSHA1(jobUUID, []byte(strconv.FormatUint(uint64(row.Line), 10))).String()
+			}
+
+			requests = append(requests, &issueapi.IssueRequestInternal{
+				IssueRequest: &api.IssueCodeRequest{
+					Phone:            row.Phone,
+					TestDate:         row.TestDate,
+					SymptomDate:      row.SymptomDate,
+					TestType:         row.TestType,
+					TZOffset:         params.TZOffset,
+					SMSTemplateLabel: params.SMSTemplateLabel,
+					UUID:             rowUUID,
+				},
+			})
+		}
+		if len(requests) == 0 {
+			return nil, nil
+		}
+
+		issued := c.issueapi.IssueMany(ctx, requests)
+
+		results := make([]*database.JobResult, len(issued))
+		for i, result := range issued {
+			// Only the error code is recorded. Error messages can include the
+			// phone number.
+			results[i] = &database.JobResult{
+				Line:   rows[i].Line,
+				ID:     requests[i].IssueRequest.UUID,
+				Status: database.BulkIssueResultIssued,
+			}
+			if result.ErrorReturn != nil {
+				results[i].Status = database.JobResultFailed
+				results[i].Error = result.ErrorReturn.ErrorCode
+				if results[i].Error == "" {
+					results[i].Error = api.ErrInternal
+				}
+			}
+		}
+		return results, nil
+	}, "", nil
+}
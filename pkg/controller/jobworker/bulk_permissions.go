@@ -0,0 +1,63 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobworker
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// bulkPermissions returns the batch function for a bulk permissions job. Each
+// batch is applied in a single transaction, so every user in the batch shares
+// the same result.
+func (c *Controller) bulkPermissions(job *database.Job) (batchFunc, string, error) {
+	actor, reason, err := c.creator(job)
+	if actor == nil {
+		return nil, reason, err
+	}
+
+	return func(_ context.Context, limit uint) ([]*database.JobResult, error) {
+		bulkPermission, lines, err := job.PendingBulkPermission(limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			return nil, nil
+		}
+
+		status, msg := database.BulkPermissionResultApplied, ""
+		if err := bulkPermission.Apply(c.db, actor); err != nil {
+			// Validation errors will fail every time, so they are recorded
+			// against the users instead of retrying the batch.
+			if !database.IsValidationError(err) {
+				return nil, err
+			}
+			status, msg = database.JobResultFailed, err.Error()
+		}
+
+		results := make([]*database.JobResult, 0, len(lines))
+		for i, line := range lines {
+			results = append(results, &database.JobResult{
+				Line:   line,
+				ID:     strconv.FormatUint(uint64(bulkPermission.UserIDs[i]), 10),
+				Status: status,
+				Error:  msg,
+			})
+		}
+		return results, nil
+	}, "", nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobworker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// batchFunc processes up to limit of the job's pending items and returns their
+// results. It returns no results once every item has been processed. Errors
+// are treated as transient and the batch is retried on a later run.
+type batchFunc func(ctx context.Context, limit uint) ([]*database.JobResult, error)
+
+// HandleProcess accepts an HTTP trigger and processes pending jobs until there
+// are none left or the maximum run duration is reached. Progress is saved
+// after each batch of items, so unfinished jobs are resumed on a later run.
+func (c *Controller) HandleProcess() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("jobworker.HandleProcess")
+		logger.Debugw("starting")
+		defer logger.Debugw("finishing")
+
+		if c.config.IsMaintenanceMode() {
+			logger.Debugw("skipping (maintenance mode)")
+			c.h.RenderJSON(w, http.StatusOK, fmt.Errorf("maintenance mode"))
+			return
+		}
+
+		ok, err := c.db.TryLock(ctx, jobWorkerLock, c.config.MinPeriod)
+		if err != nil {
+			logger.Errorw("failed to acquire lock", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			logger.Debugw("skipping (too early)")
+			c.h.RenderJSON(w, http.StatusOK, fmt.Errorf("too early"))
+			return
+		}
+
+		deadline := time.Now().Add(c.config.MaxRunDuration)
+		for time.Now().Before(deadline) {
+			job, err := c.db.ClaimJob(c.config.LeaseDuration)
+			if err != nil {
+				if database.IsNotFound(err) {
+					break
+				}
+
+				logger.Errorw("failed to claim job", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			// Jobs which fail to save are retried once their lease expires.
+			if err := c.process(ctx, job, deadline); err != nil {
+				logger.Errorw("failed to process job", "id", job.ID, "kind", job.Kind, "error", err)
+			}
+		}
+
+		stats.Record(ctx, mSuccess.M(1))
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// process processes the job's pending items in batches until every item has
+// been processed or the deadline is reached. The returned error is only
+// non-nil if the job could not be saved or a batch could not be processed.
+func (c *Controller) process(ctx context.Context, job *database.Job, deadline time.Time) error {
+	logger := logging.FromContext(ctx).Named("jobworker.process").
+		With("id", job.ID).
+		With("kind", job.Kind).
+		With("realm", job.RealmID)
+
+	// Attempts are reset whenever a batch is saved, so this only trips when a
+	// job repeatedly fails without making any progress.
+	if job.Attempts > c.config.MaxAttempts {
+		return c.fail(ctx, job, fmt.Sprintf("job made no progress after %d attempts", job.Attempts-1))
+	}
+
+	realm, err := c.db.FindRealm(job.RealmID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return c.fail(ctx, job, "realm no longer exists")
+		}
+		return fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	var next batchFunc
+	var reason string
+	switch job.Kind {
+	case database.JobKindBulkIssue:
+		next, reason, err = c.bulkIssue(ctx, job, realm)
+	case database.JobKindUserImport:
+		next, reason, err = c.userImport(job, realm)
+	case database.JobKindBulkPermissions:
+		next, reason, err = c.bulkPermissions(job)
+	default:
+		reason = fmt.Sprintf("unknown job kind %q", job.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return c.fail(ctx, job, reason)
+	}
+
+	for time.Now().Before(deadline) {
+		results, err := next(ctx, c.config.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to process batch: %w", err)
+		}
+
+		if len(results) == 0 {
+			logger.Debugw("finished job", "succeeded", job.SucceededItems, "failed", job.FailedItems)
+			job.MarkSucceeded()
+			defer recordJob(ctx, enobs.ResultOK)
+			return c.db.SaveJob(job)
+		}
+
+		if err := job.RecordResults(results); err != nil {
+			return c.fail(ctx, job, "failed to record results")
+		}
+		if err := c.db.SaveJob(job); err != nil {
+			return fmt.Errorf("failed to save progress: %w", err)
+		}
+
+		var failed int64
+		for _, result := range results {
+			if result.Status == database.JobResultFailed {
+				failed++
+			}
+		}
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{enobs.ResultOK}, mItems.M(int64(len(results))-failed))
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{enobs.ResultError("FAILED")}, mItems.M(failed))
+	}
+
+	// Out of time, make the job available to the next run immediately instead
+	// of waiting for the lease to expire.
+	logger.Debugw("pausing job", "processed", job.ProcessedItems, "total", job.TotalItems)
+	job.NextAttemptAt = time.Now().UTC()
+	return c.db.SaveJob(job)
+}
+
+// creator returns the user who created the job, or a reason the job cannot be
+// processed if they no longer exist. Jobs created in the UI are processed on
+// behalf of the user who created them.
+func (c *Controller) creator(job *database.Job) (*database.User, string, error) {
+	if job.UserID == nil {
+		return nil, "user who created the job no longer exists", nil
+	}
+
+	user, err := c.db.FindUser(*job.UserID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, "user who created the job no longer exists", nil
+		}
+		return nil, "", fmt.Errorf("failed to find user: %w", err)
+	}
+	return user, "", nil
+}
+
+// fail marks the job as failed and saves it.
+func (c *Controller) fail(ctx context.Context, job *database.Job, reason string) error {
+	logging.FromContext(ctx).Named("jobworker.fail").
+		Infow("job failed", "id", job.ID, "kind", job.Kind, "reason", reason)
+
+	defer recordJob(ctx, enobs.ResultError("FAILED"))
+	job.MarkFailed(reason)
+	return c.db.SaveJob(job)
+}
+
+func recordJob(ctx context.Context, result tag.Mutator) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{result}, mJobs.M(1))
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jobworker processes background jobs, such as user imports and
+// codes bulk issued through the admin API.
+package jobworker
+
+import (
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+const jobWorkerLock = "jobWorkerLock"
+
+// Controller is a controller for the job worker.
+type Controller struct {
+	config   *config.JobWorkerConfig
+	db       *database.Database
+	issueapi *issueapi.Controller
+	importer *user.Importer
+	h        *render.Renderer
+}
+
+// New creates a new job worker controller.
+func New(config *config.JobWorkerConfig, db *database.Database, issueapi *issueapi.Controller, importer *user.Importer, h *render.Renderer) *Controller {
+	return &Controller{
+		config:   config,
+		db:       db,
+		issueapi: issueapi,
+		importer: importer,
+		h:        h,
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobworker
+
+import (
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+const metricPrefix = observability.MetricRoot + "/job_worker"
+
+var (
+	mSuccess = stats.Int64(metricPrefix+"/success", "successful execution", stats.UnitDimensionless)
+	mItems   = stats.Int64(metricPrefix+"/items", "The number of items processed.", stats.UnitDimensionless)
+	mJobs    = stats.Int64(metricPrefix+"/jobs", "The number of jobs finished.", stats.UnitDimensionless)
+)
+
+func init() {
+	enobs.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/success",
+			Description: "Number of successes",
+			TagKeys:     observability.CommonTagKeys(),
+			Measure:     mSuccess,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/items_count",
+			Description: "The count of processed items, by result",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Measure:     mItems,
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        metricPrefix + "/jobs_count",
+			Description: "The count of finished jobs, by result",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Measure:     mJobs,
+			Aggregation: view.Count(),
+		},
+	}...)
+}
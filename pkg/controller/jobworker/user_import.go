@@ -0,0 +1,46 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobworker
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// userImport returns the batch function for a user import job.
+func (c *Controller) userImport(job *database.Job, realm *database.Realm) (batchFunc, string, error) {
+	params, err := job.UserImportParams()
+	if err != nil {
+		return nil, "failed to decode job options", nil
+	}
+
+	actor, reason, err := c.creator(job)
+	if actor == nil {
+		return nil, reason, err
+	}
+
+	return func(ctx context.Context, limit uint) ([]*database.JobResult, error) {
+		rows, err := job.PendingUserImportRows(limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+
+		return c.importer.Import(ctx, realm, actor, rows, params.SendInvites)
+	}, "", nil
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
@@ -36,6 +37,11 @@ func (c *Controller) HandleShowChangePassword() http.Handler {
 }
 
 func (c *Controller) HandleSubmitChangePassword() http.Handler {
+	type FormData struct {
+		Password    string `form:"password"`
+		NewPassword string `form:"new_password"`
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -54,6 +60,33 @@ func (c *Controller) HandleSubmitChangePassword() http.Handler {
 			return
 		}
 
+		// With password auth, the password is changed on the server. Otherwise the
+		// browser already changed it with the auth provider.
+		if c.config.Auth.PasswordAuth() {
+			var form FormData
+			if err := controller.BindForm(w, r, &form); err != nil {
+				flash.Error("Failed to change password: %v", err)
+				http.Redirect(w, r, "/login/change-password", http.StatusSeeOther)
+				return
+			}
+
+			if err := c.validateComplexity(form.NewPassword); err != nil {
+				flash.Error("Failed to change password: %v", err)
+				http.Redirect(w, r, "/login/change-password", http.StatusSeeOther)
+				return
+			}
+
+			if err := c.authProvider.ChangePassword(ctx, form.NewPassword, &auth.CurrentPassword{
+				Session:  session,
+				Email:    currentUser.Email,
+				Password: form.Password,
+			}); err != nil {
+				flash.Error("Failed to change password: %v", err)
+				http.Redirect(w, r, "/login/change-password", http.StatusSeeOther)
+				return
+			}
+		}
+
 		if err := c.db.PasswordChanged(currentUser.Email, time.Now()); err != nil {
 			logger.Errorw("failed to mark password change time", "error", err)
 			controller.InternalError(w, r, c.h, err)
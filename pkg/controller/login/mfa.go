@@ -0,0 +1,340 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+)
+
+// totpCodeRe matches codes from an authenticator app. Anything else entered
+// on the challenge page is treated as a recovery code.
+var totpCodeRe = regexp.MustCompile(`^[0-9]{6}$`)
+
+// HandleShowMFA renders the second factor challenge for users who enrolled a
+// factor with the server.
+func (c *Controller) HandleShowMFA() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		factors, ok := c.pendingMFAFactors(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		c.renderMFA(ctx, w, http.StatusOK, factors)
+	})
+}
+
+// HandleSubmitMFA verifies a code from an authenticator app or a recovery code.
+func (c *Controller) HandleSubmitMFA() http.Handler {
+	type FormData struct {
+		Code string `form:"code"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		factors, ok := c.pendingMFAFactors(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to verify code: %v", err)
+			c.renderMFA(ctx, w, http.StatusUnprocessableEntity, factors)
+			return
+		}
+		code := strings.TrimSpace(form.Code)
+
+		usedRecoveryCode := false
+		var err error
+		if totpCodeRe.MatchString(code) {
+			_, err = c.db.UseTOTPCode(currentUser, code, time.Now())
+		} else {
+			err = c.db.UseMFARecoveryCode(currentUser, code)
+			usedRecoveryCode = true
+		}
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidMFACode) {
+				flash.Error("Invalid code. Please try again.")
+				c.renderMFA(ctx, w, http.StatusUnauthorized, factors)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.storeMFAVerified(r); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if usedRecoveryCode {
+			remaining, err := currentUser.CountMFARecoveryCodes(c.db)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			flash.Warning("You signed in with a recovery code. You have %d recovery codes left.", remaining)
+		}
+
+		http.Redirect(w, r, "/login/post-authenticate", http.StatusSeeOther)
+	})
+}
+
+// HandleBeginMFAWebAuthn returns the options to sign in with one of the
+// user's security keys. It is called via AJAX.
+func (c *Controller) HandleBeginMFAWebAuthn() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		factors, err := currentUser.ListMFAFactors(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		allowed := webAuthnCredentialIDs(factors)
+		if len(allowed) == 0 {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("no security keys are registered"))
+			return
+		}
+
+		challenge, err := webauthn.NewChallenge()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		controller.StoreSessionMFAWebAuthnChallenge(session, challenge)
+
+		c.h.RenderJSON(w, http.StatusOK, c.relyingParty(r).RequestOptions(challenge, allowed))
+	})
+}
+
+// HandleFinishMFAWebAuthn verifies the security key's response to the
+// challenge from HandleBeginMFAWebAuthn. It is called via AJAX.
+func (c *Controller) HandleFinishMFAWebAuthn() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		challenge := controller.PopMFAWebAuthnChallenge(session)
+		if challenge == nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("security key challenge has expired"))
+			return
+		}
+
+		var resp webauthn.AssertionResponse
+		if err := controller.BindJSON(w, r, &resp); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		credentialID, err := base64.RawURLEncoding.DecodeString(resp.ID)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("invalid credential id"))
+			return
+		}
+
+		factor, err := currentUser.FindMFAFactorByCredentialID(c.db, credentialID)
+		if err != nil {
+			if database.IsNotFound(err) {
+				c.h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("security key is not registered"))
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		signCount, err := c.relyingParty(r).VerifyAssertion(challenge, &webauthn.Credential{
+			ID:        factor.CredentialID,
+			PublicKey: factor.PublicKey,
+			SignCount: uint32(factor.SignCount),
+		}, &resp)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("failed to verify security key: %s", err))
+			return
+		}
+
+		if err := c.db.RecordWebAuthnUse(factor, signCount); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.storeMFAVerified(r); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// pendingMFAFactors returns the user's factors if the user still needs to
+// complete the second factor challenge. Otherwise it redirects and returns
+// false.
+func (c *Controller) pendingMFAFactors(w http.ResponseWriter, r *http.Request, u *database.User) ([]*database.MFAFactor, bool) {
+	ctx := r.Context()
+	session := controller.SessionFromContext(ctx)
+
+	if !auth.NativeMFA(ctx, c.authProvider, session) {
+		http.Redirect(w, r, "/login/post-authenticate", http.StatusSeeOther)
+		return nil, false
+	}
+
+	mfaEnabled, err := c.authProvider.MFAEnabled(ctx, session)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+
+	factors, err := u.ListMFAFactors(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+
+	if mfaEnabled || len(factors) == 0 {
+		http.Redirect(w, r, "/login/post-authenticate", http.StatusSeeOther)
+		return nil, false
+	}
+	return factors, true
+}
+
+// storeMFAVerified records that the current session completed a second factor.
+func (c *Controller) storeMFAVerified(r *http.Request) error {
+	ctx := r.Context()
+	session := controller.SessionFromContext(ctx)
+
+	n, ok := c.authProvider.(auth.NativeMFAProvider)
+	if !ok {
+		return errors.New("auth provider does not support native mfa")
+	}
+	if err := n.StoreMFAVerified(ctx, session); err != nil {
+		return err
+	}
+	controller.StoreSessionMFAPrompted(session, true)
+	return nil
+}
+
+// relyingParty returns the server's WebAuthn identity for the request.
+func (c *Controller) relyingParty(r *http.Request) *webauthn.RelyingParty {
+	origin := strings.TrimSuffix(c.config.ServerEndpoint, "/")
+	if origin == "" {
+		origin = controller.RealHostFromRequest(r)
+	}
+
+	var id string
+	if u, err := url.Parse(origin); err == nil {
+		id = u.Hostname()
+	}
+
+	return &webauthn.RelyingParty{
+		ID:     id,
+		Name:   c.config.ServerName,
+		Origin: origin,
+	}
+}
+
+// webAuthnCredentialIDs returns the credential IDs of the security keys among
+// the factors.
+func webAuthnCredentialIDs(factors []*database.MFAFactor) [][]byte {
+	ids := make([][]byte, 0, len(factors))
+	for _, f := range factors {
+		if f.Type == database.MFAFactorWebAuthn {
+			ids = append(ids, f.CredentialID)
+		}
+	}
+	return ids
+}
+
+func (c *Controller) renderMFA(ctx context.Context, w http.ResponseWriter, code int, factors []*database.MFAFactor) {
+	hasTOTP := false
+	for _, f := range factors {
+		if f.Type == database.MFAFactorTOTP {
+			hasTOTP = true
+		}
+	}
+
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Multi-factor authentication")
+	m["hasTOTP"] = hasTOTP
+	m["hasWebAuthn"] = len(webAuthnCredentialIDs(factors)) > 0
+	c.h.RenderHTMLStatus(w, code, "login/mfa", m)
+}
@@ -0,0 +1,457 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/qrcode"
+	"github.com/google/exposure-notifications-verification-server/pkg/totp"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+	"github.com/gorilla/mux"
+)
+
+// qrCodeSize is the width and height of the authenticator app QR code.
+const qrCodeSize = 200
+
+// HandleMFASettings lists the second factors the user enrolled with the server.
+func (c *Controller) HandleMFASettings() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		locale := controller.LocaleFromContext(ctx)
+		if locale == nil {
+			controller.MissingLocale(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !auth.NativeMFA(ctx, c.authProvider, session) {
+			controller.RedirectToMFA(w, r, c.h)
+			return
+		}
+
+		// Mark that the user was prompted.
+		controller.StoreSessionMFAPrompted(session, true)
+
+		factors, err := currentUser.ListMFAFactors(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		recoveryCodes, err := currentUser.CountMFARecoveryCodes(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var mode *database.AuthRequirement
+		if membership := controller.MembershipFromContext(ctx); membership != nil {
+			currentRealm := membership.Realm
+			m := currentRealm.EffectiveMFAMode(membership.CreatedAt)
+			mode = &m
+
+			if len(factors) == 0 {
+				switch m {
+				case database.MFARequired:
+					flash.Error(locale.Get("mfa.notice-required", currentRealm.Name))
+				case database.MFAOptionalPrompt:
+					flash.Warning(locale.Get("mfa.notice-prompt", currentRealm.Name))
+				case database.MFAOptional:
+					flash.Warning(locale.Get("mfa.notice-optional", currentRealm.Name))
+				}
+			}
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Multi-factor authentication")
+		m["mfaMode"] = mode
+		m["factors"] = factors
+		m["recoveryCodes"] = recoveryCodes
+		c.h.RenderHTML(w, "login/mfa-settings", m)
+	})
+}
+
+// HandleShowNewTOTP shows the secret for a new authenticator app. The secret
+// is kept in the session until the user enters a code from the app.
+func (c *Controller) HandleShowNewTOTP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !auth.NativeMFA(ctx, c.authProvider, session) {
+			controller.RedirectToMFA(w, r, c.h)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		controller.StoreSessionMFAEnrollment(session, secret)
+
+		if err := c.renderNewTOTP(ctx, w, http.StatusOK, currentUser, secret, ""); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+	})
+}
+
+// HandleCreateTOTP saves the authenticator app once the user proves it works by
+// entering a code.
+func (c *Controller) HandleCreateTOTP() http.Handler {
+	type FormData struct {
+		Name string `form:"name"`
+		Code string `form:"code"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !auth.NativeMFA(ctx, c.authProvider, session) {
+			controller.RedirectToMFA(w, r, c.h)
+			return
+		}
+
+		secret := controller.MFAEnrollmentFromSession(session)
+		if secret == "" {
+			flash.Error("Authenticator app setup has expired. Please try again.")
+			http.Redirect(w, r, "/login/mfa/totp", http.StatusSeeOther)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to add authenticator app: %v", err)
+			if err := c.renderNewTOTP(ctx, w, http.StatusUnprocessableEntity, currentUser, secret, ""); err != nil {
+				controller.InternalError(w, r, c.h, err)
+			}
+			return
+		}
+
+		step, ok, err := totp.Validate(secret, strings.TrimSpace(form.Code), time.Now(), 0)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		if !ok {
+			flash.Error("Invalid code. Make sure the time on your device is correct and try again.")
+			if err := c.renderNewTOTP(ctx, w, http.StatusUnprocessableEntity, currentUser, secret, form.Name); err != nil {
+				controller.InternalError(w, r, c.h, err)
+			}
+			return
+		}
+
+		factor := &database.MFAFactor{
+			UserID:   currentUser.ID,
+			Type:     database.MFAFactorTOTP,
+			Name:     form.Name,
+			Secret:   secret,
+			LastStep: step,
+		}
+		if err := c.db.SaveMFAFactor(factor, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				flash.Error("Failed to add authenticator app: %v", err)
+				if err := c.renderNewTOTP(ctx, w, http.StatusUnprocessableEntity, currentUser, secret, form.Name); err != nil {
+					controller.InternalError(w, r, c.h, err)
+				}
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		controller.ClearSessionMFAEnrollment(session)
+
+		if err := c.storeMFAVerified(r); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully added authenticator app %q.", factor.Name)
+		http.Redirect(w, r, "/login/mfa/settings", http.StatusSeeOther)
+	})
+}
+
+// HandleBeginRegisterWebAuthn returns the options to register a new security
+// key. It is called via AJAX.
+func (c *Controller) HandleBeginRegisterWebAuthn() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !auth.NativeMFA(ctx, c.authProvider, session) {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("security keys are not supported for this account"))
+			return
+		}
+
+		factors, err := currentUser.ListMFAFactors(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		challenge, err := webauthn.NewChallenge()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		controller.StoreSessionMFAWebAuthnChallenge(session, challenge)
+
+		// The user handle must not contain personal information, so use the
+		// database ID.
+		userID := make([]byte, 8)
+		binary.BigEndian.PutUint64(userID, uint64(currentUser.ID))
+
+		opts := c.relyingParty(r).CreationOptions(challenge, userID,
+			currentUser.Email, currentUser.Name, webAuthnCredentialIDs(factors))
+		c.h.RenderJSON(w, http.StatusOK, opts)
+	})
+}
+
+// HandleFinishRegisterWebAuthn verifies and saves the new security key. It is
+// called via AJAX.
+func (c *Controller) HandleFinishRegisterWebAuthn() http.Handler {
+	type Request struct {
+		Name     string                        `json:"name"`
+		Response *webauthn.AttestationResponse `json:"response"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !auth.NativeMFA(ctx, c.authProvider, session) {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("security keys are not supported for this account"))
+			return
+		}
+
+		challenge := controller.PopMFAWebAuthnChallenge(session)
+		if challenge == nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("security key registration has expired"))
+			return
+		}
+
+		var request Request
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		credential, err := c.relyingParty(r).VerifyRegistration(challenge, request.Response)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("failed to verify security key: %s", err))
+			return
+		}
+
+		factor := &database.MFAFactor{
+			UserID:       currentUser.ID,
+			Type:         database.MFAFactorWebAuthn,
+			Name:         request.Name,
+			CredentialID: credential.ID,
+			PublicKey:    credential.PublicKey,
+			SignCount:    int64(credential.SignCount),
+		}
+		if err := c.db.SaveMFAFactor(factor, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(factor.ErrorMessages(), ", ")))
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.storeMFAVerified(r); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully added security key %q.", factor.Name)
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// HandleDeleteMFAFactor removes one of the user's factors.
+func (c *Controller) HandleDeleteMFAFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		factor, err := currentUser.FindMFAFactor(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteMFAFactor(factor, currentUser); err != nil {
+			flash.Error("Failed to remove %q: %v", factor.Name, err)
+			http.Redirect(w, r, "/login/mfa/settings", http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Successfully removed %q.", factor.Name)
+		http.Redirect(w, r, "/login/mfa/settings", http.StatusSeeOther)
+	})
+}
+
+// HandleRegenerateMFARecoveryCodes replaces the user's recovery codes and shows
+// the new codes. The codes are only shown once.
+func (c *Controller) HandleRegenerateMFARecoveryCodes() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		hasFactors, err := currentUser.HasMFAFactors(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		if !hasFactors {
+			flash.Error("Add an authenticator app or security key before generating recovery codes.")
+			http.Redirect(w, r, "/login/mfa/settings", http.StatusSeeOther)
+			return
+		}
+
+		codes, err := c.db.RegenerateMFARecoveryCodes(currentUser, currentUser)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Recovery codes")
+		m["codes"] = codes
+		c.h.RenderHTML(w, "login/mfa-recovery-codes", m)
+	})
+}
+
+func (c *Controller) renderNewTOTP(ctx context.Context, w http.ResponseWriter, code int, u *database.User, secret, name string) error {
+	uri, err := totp.URI(c.config.ServerName, u.Email, secret)
+	if err != nil {
+		return err
+	}
+	qrCode, err := qrcode.PNGDataURL(uri, qrCodeSize)
+	if err != nil {
+		return err
+	}
+
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Add authenticator app")
+	m["secret"] = secret
+	m["qrCode"] = qrCode
+	m["name"] = name
+	c.h.RenderHTMLStatus(w, code, "login/mfa-totp", m)
+	return nil
+}
@@ -0,0 +1,342 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/totp"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn/webauthntest"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleMFA(t *testing.T) {
+	t.Parallel()
+
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	c := login.New(harness.AuthProvider, harness.Cacher, harness.Config, db, harness.Renderer)
+
+	// The origin must be absolute so the WebAuthn relying party is stable.
+	const origin = "https://verification.example.com"
+
+	// newSession signs in the user with a session which has not completed the
+	// second factor challenge.
+	newSession := func(tb testing.TB, user *database.User) (context.Context, *sessions.Session) {
+		tb.Helper()
+
+		session := &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		}
+		if err := harness.AuthProvider.StoreSession(context.Background(), session, &auth.SessionInfo{
+			Data: map[string]interface{}{
+				"email":          user.Email,
+				"email_verified": true,
+				"mfa_enabled":    false,
+				"revoked":        false,
+			},
+		}); err != nil {
+			tb.Fatal(err)
+		}
+
+		ctx := project.TestContext(tb)
+		ctx = controller.WithSession(ctx, session)
+		ctx = controller.WithUser(ctx, user)
+		return ctx, session
+	}
+
+	// newUser creates a user and a signed-in session which has not completed
+	// the second factor challenge.
+	newUser := func(tb testing.TB, email string) (context.Context, *database.User, *sessions.Session) {
+		tb.Helper()
+
+		user := &database.User{Email: email, Name: email}
+		if err := db.SaveUser(user, database.SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		ctx, session := newSession(tb, user)
+		return ctx, user, session
+	}
+
+	// addTOTP enrolls an authenticator app for the user and returns its secret.
+	addTOTP := func(tb testing.TB, user *database.User) string {
+		tb.Helper()
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := db.SaveMFAFactor(&database.MFAFactor{
+			UserID: user.ID,
+			Type:   database.MFAFactorTOTP,
+			Name:   "Phone",
+			Secret: secret,
+		}, database.SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		return secret
+	}
+
+	mfaEnabled := func(tb testing.TB, ctx context.Context, session *sessions.Session) bool {
+		tb.Helper()
+
+		enabled, err := harness.AuthProvider.MFAEnabled(ctx, session)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return enabled
+	}
+
+	t.Run("no_factors", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, _, _ := newUser(t, "mfa-none@example.com")
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/mfa", nil)
+		harness.WithCommonMiddlewares(c.HandleShowMFA()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Header().Get("Location"), "/login/post-authenticate"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("totp", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, user, session := newUser(t, "mfa-totp@example.com")
+		secret := addTOTP(t, user)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/mfa", nil)
+		harness.WithCommonMiddlewares(c.HandleShowMFA()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w, r = envstest.BuildFormRequest(ctx, t, http.MethodPost, "/login/mfa", &url.Values{
+			"code": []string{"not-a-code"},
+		})
+		harness.WithCommonMiddlewares(c.HandleSubmitMFA()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if mfaEnabled(t, ctx, session) {
+			t.Errorf("expected mfa to not be verified")
+		}
+
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, r = envstest.BuildFormRequest(ctx, t, http.MethodPost, "/login/mfa", &url.Values{
+			"code": []string{code},
+		})
+		harness.WithCommonMiddlewares(c.HandleSubmitMFA()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Header().Get("Location"), "/login/post-authenticate"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if !mfaEnabled(t, ctx, session) {
+			t.Errorf("expected mfa to be verified")
+		}
+	})
+
+	t.Run("recovery_code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, user, session := newUser(t, "mfa-recovery@example.com")
+		addTOTP(t, user)
+
+		codes, err := db.RegenerateMFARecoveryCodes(user, database.SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/login/mfa", &url.Values{
+			"code": []string{codes[0]},
+		})
+		harness.WithCommonMiddlewares(c.HandleSubmitMFA()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if !mfaEnabled(t, ctx, session) {
+			t.Errorf("expected mfa to be verified")
+		}
+	})
+
+	t.Run("enroll_totp", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, user, session := newUser(t, "mfa-enroll@example.com")
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/mfa/totp", nil)
+		harness.WithCommonMiddlewares(c.HandleShowNewTOTP()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		secret := controller.MFAEnrollmentFromSession(session)
+		if secret == "" {
+			t.Fatal("expected secret in session")
+		}
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, r = envstest.BuildFormRequest(ctx, t, http.MethodPost, "/login/mfa/totp", &url.Values{
+			"name": []string{"Work phone"},
+			"code": []string{code},
+		})
+		harness.WithCommonMiddlewares(c.HandleCreateTOTP()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Header().Get("Location"), "/login/mfa/settings"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		factors, err := user.ListMFAFactors(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(factors), 1; got != want {
+			t.Fatalf("expected %d factors, got %d", want, got)
+		}
+		if got, want := factors[0].Name, "Work phone"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if !mfaEnabled(t, ctx, session) {
+			t.Errorf("expected mfa to be verified")
+		}
+	})
+
+	t.Run("webauthn_invalid", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, user, _ := newUser(t, "mfa-webauthn-invalid@example.com")
+		authenticator := webauthntest.NewAuthenticator(t)
+
+		w, r := envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/register/begin", nil)
+		harness.WithCommonMiddlewares(c.HandleBeginRegisterWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var creation webauthn.CreationOptions
+		if err := json.Unmarshal(w.Body.Bytes(), &creation); err != nil {
+			t.Fatal(err)
+		}
+
+		// The security key is valid, but the factor is not.
+		w, r = envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/register/finish", map[string]interface{}{
+			"name":     "",
+			"response": authenticator.Register(t, origin, &creation),
+		})
+		harness.WithCommonMiddlewares(c.HandleFinishRegisterWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var resp api.ErrorReturn
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.Error, "name cannot be blank"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		factors, err := user.ListMFAFactors(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(factors), 0; got != want {
+			t.Errorf("expected %d factors, got %d", want, got)
+		}
+	})
+
+	t.Run("webauthn", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, user, _ := newUser(t, "mfa-webauthn@example.com")
+		authenticator := webauthntest.NewAuthenticator(t)
+
+		// Register the security key.
+		w, r := envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/register/begin", nil)
+		harness.WithCommonMiddlewares(c.HandleBeginRegisterWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var creation webauthn.CreationOptions
+		if err := json.Unmarshal(w.Body.Bytes(), &creation); err != nil {
+			t.Fatal(err)
+		}
+
+		w, r = envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/register/finish", map[string]interface{}{
+			"name":     "Security key",
+			"response": authenticator.Register(t, origin, &creation),
+		})
+		harness.WithCommonMiddlewares(c.HandleFinishRegisterWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		// Sign in again with the security key.
+		ctx, session := newSession(t, user)
+
+		w, r = envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/begin", nil)
+		harness.WithCommonMiddlewares(c.HandleBeginMFAWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var request webauthn.RequestOptions
+		if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+			t.Fatal(err)
+		}
+		assertion := authenticator.Assert(t, origin, &request)
+
+		w, r = envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/finish", assertion)
+		harness.WithCommonMiddlewares(c.HandleFinishMFAWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if !mfaEnabled(t, ctx, session) {
+			t.Errorf("expected mfa to be verified")
+		}
+
+		// The challenge cannot be answered twice.
+		w, r = envstest.BuildJSONRequest(ctx, t, http.MethodPost, origin+"/login/mfa/webauthn/finish", assertion)
+		harness.WithCommonMiddlewares(c.HandleFinishMFAWebAuthn()).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 )
@@ -40,6 +41,13 @@ func (c *Controller) HandleRegisterPhone() http.Handler {
 			return
 		}
 
+		// Providers without their own second factor use factors stored by the
+		// server instead.
+		if auth.NativeMFA(ctx, c.authProvider, session) {
+			http.Redirect(w, r, "/login/mfa/settings", http.StatusSeeOther)
+			return
+		}
+
 		// Mark that the user was prompted.
 		controller.StoreSessionMFAPrompted(session, true)
 
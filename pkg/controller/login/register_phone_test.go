@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -50,4 +51,33 @@ func TestHandleRegisterPhone_ShowRegisterPhone(t *testing.T) {
 			t.Errorf("Expected %d to be %d: %s", got, want, w.Body.String())
 		}
 	})
+
+	t.Run("native_mfa", func(t *testing.T) {
+		t.Parallel()
+
+		session := &sessions.Session{}
+		if err := harness.AuthProvider.StoreSession(ctx, session, &auth.SessionInfo{
+			Data: map[string]interface{}{
+				"email":          "you@example.com",
+				"email_verified": true,
+				"mfa_enabled":    false,
+				"revoked":        false,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, session)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("Expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Header().Get("Location"), "/login/mfa/settings"; got != want {
+			t.Errorf("Expected %q to be %q", got, want)
+		}
+	})
 }
@@ -77,7 +77,7 @@ func (c *Controller) HandleSubmitResetPassword() http.Handler {
 			return
 		}
 
-		// nil composer falls back to firebase and no custom message.
+		// A nil composer falls back to firebase and no custom message.
 		var resetComposer auth.ResetPasswordEmailFunc
 
 		membership := controller.MembershipFromContext(ctx)
@@ -97,13 +97,16 @@ func (c *Controller) HandleSubmitResetPassword() http.Handler {
 			}
 		}
 
-		// Build the emailer.
+		// Build the emailer. Users without a membership, such as system admins,
+		// get the email from the system email configuration.
+		var realm *database.Realm
 		if membership != nil {
-			resetComposer, err = controller.SendPasswordResetEmailFunc(ctx, c.db, c.h, user.Email, membership.Realm)
-			if err != nil {
-				controller.InternalError(w, r, c.h, err)
-				return
-			}
+			realm = membership.Realm
+		}
+		resetComposer, err = controller.SendPasswordResetEmailFunc(ctx, c.db, c.h, user.Email, realm)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
 
 		// Reset the password.
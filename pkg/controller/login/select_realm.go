@@ -105,6 +105,12 @@ func (c *Controller) HandleSelectRealm() http.Handler {
 			return
 		}
 
+		if membership.IsExpired() {
+			flash.Error("Invalid realm selection.")
+			c.renderSelect(ctx, w, memberships)
+			return
+		}
+
 		controller.StoreSessionRealm(session, membership.Realm)
 		http.Redirect(w, r, "/login/post-authenticate", http.StatusSeeOther)
 	})
@@ -15,8 +15,10 @@
 package login
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -37,6 +39,13 @@ func (c *Controller) HandleCreateSession() http.Handler {
 		}
 		flash := controller.Flash(session)
 
+		// With password auth, the login form is posted directly instead of
+		// exchanging an ID token from the browser.
+		if c.config.Auth.PasswordAuth() {
+			c.createPasswordSession(w, r)
+			return
+		}
+
 		// Parse and decode form.
 		var form FormData
 		if err := controller.BindForm(w, r, &form); err != nil {
@@ -60,3 +69,52 @@ func (c *Controller) HandleCreateSession() http.Handler {
 		c.h.RenderJSON(w, http.StatusOK, nil)
 	})
 }
+
+// createPasswordSession verifies the email address and password from the login
+// form and creates the session.
+func (c *Controller) createPasswordSession(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Email    string `form:"email,required"`
+		Password string `form:"password,required"`
+		Redirect string `form:"redirect"`
+	}
+
+	ctx := r.Context()
+
+	logger := logging.FromContext(ctx).Named("login.createPasswordSession")
+
+	session := controller.SessionFromContext(ctx)
+	flash := controller.Flash(session)
+
+	var form FormData
+	if err := controller.BindForm(w, r, &form); err != nil {
+		flash.Error("Failed to process form: %v", err)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := c.authProvider.StoreSession(ctx, session, &auth.SessionInfo{
+		Data: map[string]interface{}{
+			"email":    form.Email,
+			"password": form.Password,
+		},
+		TTL: c.config.SessionDuration,
+	}); err != nil {
+		// Do not reveal whether the account exists or is locked.
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrAccountLocked) {
+			logger.Warnw("failed to sign in", "error", err)
+			flash.Error("Invalid email address or password.")
+		} else {
+			logger.Errorw("failed to sign in", "error", err)
+			flash.Error("Failed to sign in. Please try again.")
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if redirectAllowed(form.Redirect) {
+		http.Redirect(w, r, "/"+form.Redirect, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/login/select-realm", http.StatusSeeOther)
+}
@@ -17,13 +17,19 @@ package login_test
 import (
 	"net/http"
 	"net/url"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/gorilla/sessions"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHandleSession_HandleSubmit(t *testing.T) {
@@ -71,3 +77,142 @@ func TestHandleSession_HandleSubmit(t *testing.T) {
 		}
 	})
 }
+
+func TestHandleSession_HandleSubmitPassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	cfg := *harness.Config
+	cfg.Auth.Provider = config.AuthProviderPassword
+
+	authProvider, err := auth.NewPassword(ctx, harness.Database, &auth.PasswordConfig{
+		Endpoint:        "https://example.com",
+		HashCost:        bcrypt.MinCost,
+		MaxFailedLogins: 5,
+		LockoutDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &database.User{Email: "password@example.com", Name: "Password"}
+	if err := harness.Database.SaveUser(user, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authProvider.CreateUser(ctx, user.Name, user.Email, "Passw0rd!", false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock out a second user with too many failed attempts.
+	lockedUser := &database.User{Email: "password-locked@example.com", Name: "Locked"}
+	if err := harness.Database.SaveUser(lockedUser, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authProvider.CreateUser(ctx, lockedUser.Name, lockedUser.Email, "Passw0rd!", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := authProvider.StoreSession(ctx, &sessions.Session{}, &auth.SessionInfo{
+			Data: map[string]interface{}{
+				"email":    lockedUser.Email,
+				"password": "wrong",
+			},
+		}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	c := login.New(authProvider, harness.Cacher, &cfg, harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleCreateSession())
+
+	cases := []struct {
+		name     string
+		form     *url.Values
+		location string
+		flash    string
+	}{
+		{
+			name:     "missing_password",
+			form:     &url.Values{"email": []string{user.Email}},
+			location: "/",
+		},
+		{
+			name: "wrong_password",
+			form: &url.Values{
+				"email":    []string{user.Email},
+				"password": []string{"wrong"},
+			},
+			location: "/",
+			flash:    "Invalid email address or password.",
+		},
+		{
+			name: "unknown_user",
+			form: &url.Values{
+				"email":    []string{"password-unknown@example.com"},
+				"password": []string{"Passw0rd!"},
+			},
+			location: "/",
+			flash:    "Invalid email address or password.",
+		},
+		{
+			name: "locked",
+			form: &url.Values{
+				"email":    []string{lockedUser.Email},
+				"password": []string{"Passw0rd!"},
+			},
+			location: "/",
+			flash:    "Invalid email address or password.",
+		},
+		{
+			name: "success",
+			form: &url.Values{
+				"email":    []string{user.Email},
+				"password": []string{"Passw0rd!"},
+			},
+			location: "/login/select-realm",
+		},
+		{
+			name: "success_redirect",
+			form: &url.Values{
+				"email":    []string{user.Email},
+				"password": []string{"Passw0rd!"},
+				"redirect": []string{"login/register-phone"},
+			},
+			location: "/login/register-phone",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			session := &sessions.Session{}
+			ctx := controller.WithSession(ctx, session)
+
+			w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", tc.form)
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, http.StatusSeeOther; got != want {
+				t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+			}
+			if got, want := w.Header().Get("Location"), tc.location; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			email, _ := authProvider.EmailAddress(ctx, session)
+			if got, want := email != "", tc.location != "/"; got != want {
+				t.Errorf("expected session to be stored: %t", want)
+			}
+
+			if tc.flash != "" {
+				if got, want := controller.Flash(session).Errors(), []string{tc.flash}; !reflect.DeepEqual(got, want) {
+					t.Errorf("expected %q to be %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -70,6 +70,12 @@ func (c *Controller) HandleSignOut() http.Handler {
 		session.Values = make(map[interface{}]interface{})
 		flash.Clone(session.Values)
 
+		// With password auth, there is no browser session to sign out of.
+		if c.config.Auth.PasswordAuth() {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Logging out...")
 		m["firebase"] = c.config.Firebase
@@ -0,0 +1,249 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/oidc"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// SSOCallbackPath is the path to which identity providers redirect after
+	// sign-in. It must be registered as a redirect URL with the identity
+	// provider.
+	SSOCallbackPath = "/login/sso/callback"
+
+	// ssoCompletePath is the path which completes sign-in.
+	ssoCompletePath = "/login/sso/complete"
+)
+
+// HandleSSOStart begins signing in with the realm's identity provider by
+// redirecting to the identity provider.
+func (c *Controller) HandleSSOStart() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm, ssoConfig, err := c.findSSOConfig(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				flash.Error("Single sign-on is not available for this realm.")
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		client, err := oidc.NewClient(ctx, c.ssoClientConfig(r, ssoConfig))
+		if err != nil {
+			flash.Error("Failed to contact the identity provider for %s: %v", realm.Name, err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		state, err := oidc.NewState()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		nonce, err := oidc.NewState()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		controller.StoreSessionSSO(session, realm.ID, state, nonce)
+		http.Redirect(w, r, client.AuthCodeURL(state, nonce), http.StatusSeeOther)
+	})
+}
+
+// HandleSSOCallback receives the redirect from the identity provider. Session
+// cookies are strict same-site cookies, so they are not sent on this
+// cross-site redirect. This handler must not be behind the session middleware
+// (which would replace the user's session with an empty one); instead it
+// renders a page which navigates to HandleSSOComplete on the same site.
+func (c *Controller) HandleSSOCallback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		q := make(url.Values, 4)
+		for _, k := range []string{"code", "state", "error", "error_description"} {
+			if v := r.FormValue(k); v != "" {
+				q.Set(k, v)
+			}
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Signing in...")
+		m["completeURL"] = ssoCompletePath + "?" + q.Encode()
+		c.h.RenderHTML(w, "login/sso-callback", m)
+	})
+}
+
+// HandleSSOComplete completes signing in with the realm's identity provider.
+// Users are added to the realm based on their identity provider groups.
+func (c *Controller) HandleSSOComplete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		// The attempt can only be completed once.
+		realmID, state, nonce := controller.SSOFromSession(session)
+		controller.ClearSessionSSO(session)
+		if realmID == 0 {
+			flash.Error("Your sign-in attempt has expired. Please try again.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if msg := r.FormValue("error"); msg != "" {
+			if desc := r.FormValue("error_description"); desc != "" {
+				msg = desc
+			}
+			flash.Error("Failed to sign in: %s", msg)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(state)) != 1 {
+			flash.Error("Failed to sign in: invalid state. Please try again.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		realm, ssoConfig, err := c.findSSOConfig(realmID)
+		if err != nil {
+			if database.IsNotFound(err) {
+				flash.Error("Single sign-on is not available for this realm.")
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		client, err := oidc.NewClient(ctx, c.ssoClientConfig(r, ssoConfig))
+		if err != nil {
+			flash.Error("Failed to contact the identity provider for %s: %v", realm.Name, err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		claims, err := client.Exchange(ctx, r.FormValue("code"), nonce)
+		if err != nil {
+			flash.Error("Failed to sign in: %v", err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// Users are matched by email, so the identity provider must vouch for it.
+		if claims.Email == "" || !claims.EmailVerified {
+			flash.Error("Failed to sign in: the identity provider did not supply a verified email address.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if _, err := realm.ProvisionOIDCUser(c.db, ssoConfig, claims.Email, claims.Name, claims.Groups); err != nil {
+			switch {
+			case errors.Is(err, database.ErrNoSSOAccess):
+				flash.Error("You do not have access to %s. Contact your realm administrator.", realm.Name)
+			case errors.Is(err, database.ErrSSOUserRestricted):
+				flash.Error("Your account cannot use single sign-on. Sign in with your email address and password instead.")
+			default:
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if err := c.authProvider.StoreSession(ctx, session, &auth.SessionInfo{
+			Data: map[string]interface{}{
+				auth.OIDCIdentityKey: &auth.OIDCIdentity{
+					Issuer:        claims.Issuer,
+					Subject:       claims.Subject,
+					Email:         claims.Email,
+					EmailVerified: claims.EmailVerified,
+					MFAEnabled:    claims.MFA,
+				},
+			},
+			TTL: c.config.SessionDuration,
+		}); err != nil {
+			flash.Error("Failed to create session: %v", err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		controller.StoreSessionRealm(session, realm)
+		http.Redirect(w, r, "/login/post-authenticate", http.StatusSeeOther)
+	})
+}
+
+// findSSOConfig finds the realm and its identity provider. If either does not
+// exist, an error is returned that satisfies database.IsNotFound.
+func (c *Controller) findSSOConfig(realmID interface{}) (*database.Realm, *database.OIDCConfig, error) {
+	realm, err := c.db.FindRealm(realmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ssoConfig, err := realm.FindOIDCConfig(c.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return realm, ssoConfig, nil
+}
+
+// ssoClientConfig builds the OpenID Connect client configuration for the
+// identity provider.
+func (c *Controller) ssoClientConfig(r *http.Request, ssoConfig *database.OIDCConfig) *oidc.Config {
+	endpoint := strings.TrimSuffix(c.config.ServerEndpoint, "/")
+	if endpoint == "" {
+		endpoint = controller.RealHostFromRequest(r)
+	}
+
+	return &oidc.Config{
+		Issuer:       ssoConfig.Issuer,
+		ClientID:     ssoConfig.ClientID,
+		ClientSecret: ssoConfig.ClientSecret,
+		RedirectURL:  endpoint + SSOCallbackPath,
+		GroupsClaim:  ssoConfig.GroupsClaim,
+	}
+}
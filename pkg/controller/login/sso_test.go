@@ -0,0 +1,208 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/oidc/oidctest"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleSSO(t *testing.T) {
+	t.Parallel()
+
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	idp := oidctest.NewServer(t)
+	idp.SetClaims(map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "tracer@example.com",
+		"email_verified": true,
+		"name":           "Tracer",
+		"groups":         []string{"tracers"},
+	})
+
+	realm := database.NewRealmWithDefaults("SSO realm")
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	role := &database.Role{RealmID: realm.ID, Name: "Tracer", Permissions: rbac.CodeIssue | rbac.CodeRead}
+	if err := db.SaveRole(role, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveOIDCConfig(&database.OIDCConfig{
+		RealmID:      realm.ID,
+		Issuer:       idp.Issuer(),
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+
+		// The test identity provider is served over plain HTTP.
+		AllowInsecureIssuer: true,
+	}, []*database.OIDCGroupRole{
+		{Group: "tracers", RoleID: role.ID},
+	}, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := login.New(harness.AuthProvider, harness.Cacher, harness.Config, db, harness.Renderer)
+
+	// start begins a sign-in attempt and returns the identity provider's redirect
+	// back to the server.
+	start := func(tb testing.TB, session *sessions.Session) string {
+		tb.Helper()
+
+		ctx := project.TestContext(tb)
+		ctx = controller.WithSession(ctx, session)
+
+		w, r := envstest.BuildFormRequest(ctx, tb, http.MethodGet, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", realm.ID)})
+		harness.WithCommonMiddlewares(c.HandleSSOStart()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			tb.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		loc := w.Header().Get("Location")
+		if got, want := loc, idp.Issuer()+"/authorize"; !strings.HasPrefix(got, want) {
+			tb.Fatalf("expected %q to start with %q", got, want)
+		}
+		return idp.Authorize(tb, loc).RawQuery
+	}
+
+	t.Run("not_configured", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := project.TestContext(t)
+		ctx = controller.WithSession(ctx, &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "999999"})
+		harness.WithCommonMiddlewares(c.HandleSSOStart()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Header().Get("Location"), "/"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := project.TestContext(t)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, login.SSOCallbackPath+"?code=abc&state=xyz", nil)
+		harness.WithCommonMiddlewares(c.HandleSSOCallback()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "/login/sso/complete?code=abc&amp;state=xyz"; !strings.Contains(got, want) {
+			t.Errorf("expected %q to contain %q", got, want)
+		}
+	})
+
+	t.Run("invalid_state", func(t *testing.T) {
+		t.Parallel()
+
+		session := &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		}
+		query := start(t, session)
+		controller.StoreSessionSSO(session, realm.ID, "other-state", "nonce")
+
+		ctx := project.TestContext(t)
+		ctx = controller.WithSession(ctx, session)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/sso/complete?"+query, nil)
+		harness.WithCommonMiddlewares(c.HandleSSOComplete()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Header().Get("Location"), "/"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if _, err := harness.AuthProvider.EmailAddress(ctx, session); err == nil {
+			t.Errorf("expected no session")
+		}
+	})
+
+	t.Run("signs_in", func(t *testing.T) {
+		t.Parallel()
+
+		session := &sessions.Session{
+			Values: make(map[interface{}]interface{}),
+		}
+		query := start(t, session)
+
+		ctx := project.TestContext(t)
+		ctx = controller.WithSession(ctx, session)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/sso/complete?"+query, nil)
+		harness.WithCommonMiddlewares(c.HandleSSOComplete()).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if got, want := w.Header().Get("Location"), "/login/post-authenticate"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		email, err := harness.AuthProvider.EmailAddress(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := email, "tracer@example.com"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := controller.RealmIDFromSession(session), realm.ID; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		user, err := db.FindUserByEmail(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		membership, err := user.FindMembership(db, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !membership.HasRole() || *membership.RoleID != role.ID {
+			t.Errorf("expected membership role to be %d, got %v", role.ID, membership.RoleID)
+		}
+
+		// The attempt cannot be replayed.
+		w, r = envstest.BuildFormRequest(ctx, t, http.MethodGet, "/login/sso/complete?"+query, nil)
+		harness.WithCommonMiddlewares(c.HandleSSOComplete()).ServeHTTP(w, r)
+		if got, want := w.Header().Get("Location"), "/"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+}
@@ -16,8 +16,10 @@
 package login
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
@@ -25,9 +27,30 @@ func (c *Controller) HandleReceiveVerifyEmail() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		m := controller.TemplateMapFromContext(ctx)
-		m.Title("Verify email address")
-		m["firebase"] = c.config.Firebase
-		c.h.RenderHTML(w, "login/verify-email-check", m)
+		// Providers which verify email addresses on the server use the code
+		// directly. Otherwise, the page applies the code in the browser.
+		if verifier, ok := c.authProvider.(auth.EmailVerifier); ok && c.config.Auth.PasswordAuth() {
+			session := controller.SessionFromContext(ctx)
+			flash := controller.Flash(session)
+
+			if _, err := verifier.VerifyEmail(ctx, r.FormValue("oobCode")); err != nil {
+				flash.Error("Failed to verify email address: %v", err)
+				c.renderReceiveVerifyEmail(ctx, w)
+				return
+			}
+
+			flash.Alert("Successfully verified email address.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		c.renderReceiveVerifyEmail(ctx, w)
 	})
 }
+
+func (c *Controller) renderReceiveVerifyEmail(ctx context.Context, w http.ResponseWriter) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Verify email address")
+	m["firebase"] = c.config.Firebase
+	c.h.RenderHTML(w, "login/verify-email-check", m)
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -87,6 +88,29 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h *render.Rendere
 				return
 			}
 
+			// Verify the API key has not expired.
+			if authApp.IsExpired() {
+				logger.Debugw("api key is expired", "expires_at", authApp.ExpiresAt)
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
+			// Verify the API key was not replaced by a rotation whose grace period has
+			// since ended. The lookup only matches such keys within the grace period,
+			// but the cached entry may be older.
+			if authApp.UsingPreviousAPIKey && !authApp.HasPreviousAPIKey() {
+				logger.Debugw("api key was rotated and its grace period has ended")
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
+			// Verify the request comes from an IP the API key allows.
+			if !authApp.AllowsIP(remoteIP(r)) {
+				logger.Debugw("ip is not in an allowed cidr block for the api key")
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
 			// Lookup the realm.
 			var realm database.Realm
 			realmCacheKey := &cache.Key{
@@ -108,7 +132,7 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h *render.Rendere
 			}
 
 			// Mark API key as used.
-			if authApp.LastUsedAt == nil || time.Since(*authApp.LastUsedAt) > lastUsedTTL {
+			if lastUsedAt := authApp.SecretLastUsedAt(); lastUsedAt == nil || time.Since(*lastUsedAt) > lastUsedTTL {
 				if err := authApp.TouchLastUsedAt(db); err != nil {
 					// Log an error, but do not reject the request.
 					logger.Errorw("failed to update last_used_at", "error", err)
@@ -131,3 +155,49 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h *render.Rendere
 		})
 	}
 }
+
+// RequireAPIKeyScope verifies the API key can use the endpoints of the given
+// scope. It must come after RequireAPIKey.
+func RequireAPIKeyScope(h *render.Renderer, scope database.APIKeyScope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			logger := logging.FromContext(ctx).Named("middleware.RequireAPIKeyScope")
+
+			authApp := controller.AuthorizedAppFromContext(ctx)
+			if authApp == nil {
+				controller.MissingAuthorizedApp(w, r, h)
+				return
+			}
+
+			if !authApp.HasScope(scope) {
+				logger.Debugw("api key is missing scope", "scope", scope, "scopes", authApp.Scopes)
+				h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("API key is not permitted to use the %s API", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerAPIKey copies an API key sent as a bearer token in the Authorization
+// header to the X-API-Key header, for clients which only support bearer
+// authentication. It must be installed before RequireAPIKey. If the X-API-Key
+// header is already present, the Authorization header is ignored.
+func BearerAPIKey() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(APIKeyHeader) == "" {
+				auth := strings.TrimSpace(r.Header.Get("Authorization"))
+				if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+					r = r.Clone(r.Context())
+					r.Header.Set(APIKeyHeader, strings.TrimSpace(auth[7:]))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
@@ -25,6 +26,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
 )
 
 func TestRequireAPIKey(t *testing.T) {
@@ -62,6 +64,51 @@ func TestRequireAPIKey(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	expiresAt := time.Now().UTC().Add(-time.Hour)
+	expiredAuthApp := &database.AuthorizedApp{
+		Name:       "Expiry",
+		APIKeyType: database.APIKeyTypeAdmin,
+		ExpiresAt:  &expiresAt,
+	}
+	expiredAPIKey, err := realm.CreateAuthorizedApp(db, expiredAuthApp, database.SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firewalledAuthApp := &database.AuthorizedApp{
+		Name:         "Firewally",
+		APIKeyType:   database.APIKeyTypeAdmin,
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+	}
+	firewalledAPIKey, err := realm.CreateAuthorizedApp(db, firewalledAuthApp, database.SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotatedAuthApp := &database.AuthorizedApp{
+		Name:       "Rotaty",
+		APIKeyType: database.APIKeyTypeAdmin,
+	}
+	rotatedAPIKey, err := realm.CreateAuthorizedApp(db, rotatedAuthApp, database.SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.RotateAuthorizedApp(db, rotatedAuthApp, time.Hour, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	revokedAuthApp := &database.AuthorizedApp{
+		Name:       "Revoky",
+		APIKeyType: database.APIKeyTypeAdmin,
+	}
+	revokedAPIKey, err := realm.CreateAuthorizedApp(db, revokedAuthApp, database.SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.RotateAuthorizedApp(db, revokedAuthApp, 0, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
 	badDB := harness.BadDatabase
 
 	cases := []struct {
@@ -96,6 +143,30 @@ func TestRequireAPIKey(t *testing.T) {
 			code:   http.StatusUnauthorized,
 			db:     db,
 		},
+		{
+			name:   "expired",
+			apiKey: expiredAPIKey,
+			code:   http.StatusUnauthorized,
+			db:     db,
+		},
+		{
+			name:   "ip_not_allowed",
+			apiKey: firewalledAPIKey,
+			code:   http.StatusUnauthorized,
+			db:     db,
+		},
+		{
+			name:   "rotated_in_grace_period",
+			apiKey: rotatedAPIKey,
+			code:   http.StatusOK,
+			db:     db,
+		},
+		{
+			name:   "rotated_without_grace_period",
+			apiKey: revokedAPIKey,
+			code:   http.StatusUnauthorized,
+			db:     db,
+		},
 		{
 			name:   "valid",
 			apiKey: apiKey,
@@ -149,3 +220,133 @@ func TestRequireAPIKey(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireAPIKeyScope(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	h, err := render.New(ctx, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requireScope := middleware.RequireAPIKeyScope(h, database.APIKeyScopeCheckCodeStatus)
+
+	cases := []struct {
+		name    string
+		authApp *database.AuthorizedApp
+		code    int
+	}{
+		{
+			name:    "missing_authorized_app",
+			authApp: nil,
+			code:    http.StatusInternalServerError,
+		},
+		{
+			name:    "unscoped",
+			authApp: &database.AuthorizedApp{},
+			code:    http.StatusOK,
+		},
+		{
+			name: "in_scope",
+			authApp: &database.AuthorizedApp{
+				Scopes: []string{string(database.APIKeyScopeCheckCodeStatus)},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "out_of_scope",
+			authApp: &database.AuthorizedApp{
+				Scopes: []string{string(database.APIKeyScopeIssue)},
+			},
+			code: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := ctx
+			if tc.authApp != nil {
+				ctx = controller.WithAuthorizedApp(ctx, tc.authApp)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r = r.Clone(ctx)
+			r.Header.Set("Accept", "application/json")
+
+			w := httptest.NewRecorder()
+			requireScope(emptyHandler()).ServeHTTP(w, r)
+			w.Flush()
+
+			if got, want := w.Code, tc.code; got != want {
+				t.Errorf("Expected %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBearerAPIKey(t *testing.T) {
+	t.Parallel()
+
+	bearerAPIKey := middleware.BearerAPIKey()
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		exp     string
+	}{
+		{
+			name: "missing",
+			exp:  "",
+		},
+		{
+			name:    "bearer",
+			headers: map[string]string{"Authorization": "Bearer abc123"},
+			exp:     "abc123",
+		},
+		{
+			name:    "bearer_lowercase",
+			headers: map[string]string{"Authorization": "bearer abc123"},
+			exp:     "abc123",
+		},
+		{
+			name:    "basic",
+			headers: map[string]string{"Authorization": "Basic abc123"},
+			exp:     "",
+		},
+		{
+			name: "existing_api_key",
+			headers: map[string]string{
+				"Authorization":         "Bearer abc123",
+				middleware.APIKeyHeader: "def456",
+			},
+			exp: "def456",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			var got string
+			bearerAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(middleware.APIKeyHeader)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if want := tc.exp; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
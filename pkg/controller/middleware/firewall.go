@@ -68,21 +68,7 @@ func ProcessFirewall(h *render.Renderer, typ string) mux.MiddlewareFunc {
 
 			logger.Debugw("validating ip in cidr block", "type", typ)
 
-			// Get the remote address.
-			ipStr := realip.FromGoogleCloud(r)
-
-			// In some cases, the remote addr will include a port. However, Go doesn't
-			// make it easy to distinguish between an ip:port and an IPv6 address.
-			// Here we'll attempt to split the address into host:port, but if that
-			// fails, we'll attempt to process the original value as an IP directly.
-			host, _, err := net.SplitHostPort(ipStr)
-			if err == nil {
-				ipStr = host
-			}
-
-			// Parse as an IP.
-			ipStr = strings.TrimSpace(ipStr)
-			ip := net.ParseIP(ipStr)
+			ip := remoteIP(r)
 			if ip == nil {
 				logger.Errorw("provided ip could not be parsed")
 			}
@@ -106,3 +92,19 @@ func ProcessFirewall(h *render.Renderer, typ string) mux.MiddlewareFunc {
 		})
 	}
 }
+
+// remoteIP returns the IP of the client, or nil if it cannot be parsed.
+func remoteIP(r *http.Request) net.IP {
+	ipStr := realip.FromGoogleCloud(r)
+
+	// In some cases, the remote addr will include a port. However, Go doesn't
+	// make it easy to distinguish between an ip:port and an IPv6 address.
+	// Here we'll attempt to split the address into host:port, but if that
+	// fails, we'll attempt to process the original value as an IP directly.
+	host, _, err := net.SplitHostPort(ipStr)
+	if err == nil {
+		ipStr = host
+	}
+
+	return net.ParseIP(strings.TrimSpace(ipStr))
+}
@@ -28,7 +28,11 @@ import (
 // RequireMFA checks the realm's MFA requirements and enforces them.
 // Use requireRealm before requireMFA to ensure the currently selected realm is on context.
 // If no realm is selected, this assumes MFA is required.
-func RequireMFA(authProvider auth.Provider, h *render.Renderer) mux.MiddlewareFunc {
+//
+// If the auth provider does not have its own second factor and the user has
+// enrolled one with the server, the user must complete the challenge
+// regardless of the realm's requirements.
+func RequireMFA(authProvider auth.Provider, db *database.Database, h *render.Renderer) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -52,6 +56,18 @@ func RequireMFA(authProvider auth.Provider, h *render.Renderer) mux.MiddlewareFu
 				return
 			}
 
+			if !mfaEnabled && auth.NativeMFA(ctx, authProvider, session) {
+				hasFactors, err := membership.User.HasMFAFactors(db)
+				if err != nil {
+					controller.InternalError(w, r, h, err)
+					return
+				}
+				if hasFactors {
+					controller.RedirectToMFAChallenge(w, r, h)
+					return
+				}
+			}
+
 			prompted := controller.MFAPromptedFromSession(session)
 			if !mfaEnabled {
 				if mode := currentRealm.EffectiveMFAMode(membership.CreatedAt); mode == database.MFARequired ||
@@ -68,3 +84,52 @@ func RequireMFA(authProvider auth.Provider, h *render.Renderer) mux.MiddlewareFu
 		})
 	}
 }
+
+// RequireMFAChallenge requires users who enrolled a second factor with the
+// server to complete the challenge before continuing. It applies to routes
+// which do not require a realm, such as account settings. Sessions from auth
+// providers with their own second factor are not affected.
+func RequireMFAChallenge(authProvider auth.Provider, db *database.Database, h *render.Renderer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			session := controller.SessionFromContext(ctx)
+			if session == nil {
+				controller.MissingSession(w, r, h)
+				return
+			}
+
+			if !auth.NativeMFA(ctx, authProvider, session) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			currentUser := controller.UserFromContext(ctx)
+			if currentUser == nil {
+				controller.MissingUser(w, r, h)
+				return
+			}
+
+			mfaEnabled, err := authProvider.MFAEnabled(ctx, session)
+			if err != nil {
+				controller.InternalError(w, r, h, err)
+				return
+			}
+
+			if !mfaEnabled {
+				hasFactors, err := currentUser.HasMFAFactors(db)
+				if err != nil {
+					controller.InternalError(w, r, h, err)
+					return
+				}
+				if hasFactors {
+					controller.RedirectToMFAChallenge(w, r, h)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -42,7 +42,27 @@ func TestRequireMFA(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	requireMFA := middleware.RequireMFA(authProvider, h)
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &database.User{Email: "you@example.com", Name: "You"}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	enrolledUser := &database.User{Email: "enrolled@example.com", Name: "Enrolled"}
+	if err := db.SaveUser(enrolledUser, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveMFAFactor(&database.MFAFactor{
+		UserID: enrolledUser.ID,
+		Type:   database.MFAFactorTOTP,
+		Name:   "Phone",
+		Secret: "JBSWY3DPEHPK3PXP",
+	}, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	requireMFA := middleware.RequireMFA(authProvider, db, h)
 
 	cases := []struct {
 		name        string
@@ -50,6 +70,7 @@ func TestRequireMFA(t *testing.T) {
 		prompted    bool
 		membership  *database.Membership
 		code        int
+		location    string
 	}{
 		{
 			name:       "missing_membership",
@@ -153,6 +174,29 @@ func TestRequireMFA(t *testing.T) {
 			},
 			code: http.StatusSeeOther,
 		},
+		{
+			name:        "factor_enrolled_not_verified",
+			mfaVerified: false,
+			membership: &database.Membership{
+				User: enrolledUser,
+				Realm: &database.Realm{
+					MFAMode: database.MFAOptional,
+				},
+			},
+			code:     http.StatusSeeOther,
+			location: "/login/mfa",
+		},
+		{
+			name:        "factor_enrolled_verified",
+			mfaVerified: true,
+			membership: &database.Membership{
+				User: enrolledUser,
+				Realm: &database.Realm{
+					MFAMode: database.MFARequired,
+				},
+			},
+			code: http.StatusOK,
+		},
 	}
 
 	for _, tc := range cases {
@@ -176,6 +220,9 @@ func TestRequireMFA(t *testing.T) {
 			ctx := ctx
 			ctx = controller.WithSession(ctx, session)
 			if tc.membership != nil {
+				if tc.membership.User == nil {
+					tc.membership.User = user
+				}
 				ctx = controller.WithMembership(ctx, tc.membership)
 			}
 			if tc.prompted {
@@ -193,6 +240,11 @@ func TestRequireMFA(t *testing.T) {
 			if got, want := w.Code, tc.code; got != want {
 				t.Errorf("Expected %d to be %d", got, want)
 			}
+			if tc.location != "" {
+				if got, want := w.Header().Get("Location"), tc.location; got != want {
+					t.Errorf("Expected location %q to be %q", got, want)
+				}
+			}
 			if tc.code == http.StatusOK {
 				stored := controller.MFAPromptedFromSession(session)
 				if !stored {
@@ -202,3 +254,100 @@ func TestRequireMFA(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireMFAChallenge(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	h, err := render.New(ctx, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authProvider, err := auth.NewLocal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &database.User{Email: "you@example.com", Name: "You"}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	enrolledUser := &database.User{Email: "enrolled@example.com", Name: "Enrolled"}
+	if err := db.SaveUser(enrolledUser, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveMFAFactor(&database.MFAFactor{
+		UserID: enrolledUser.ID,
+		Type:   database.MFAFactorTOTP,
+		Name:   "Phone",
+		Secret: "JBSWY3DPEHPK3PXP",
+	}, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	requireMFAChallenge := middleware.RequireMFAChallenge(authProvider, db, h)
+
+	cases := []struct {
+		name        string
+		user        *database.User
+		mfaVerified bool
+		code        int
+	}{
+		{
+			name: "no_factors",
+			user: user,
+			code: http.StatusOK,
+		},
+		{
+			name: "factor_not_verified",
+			user: enrolledUser,
+			code: http.StatusSeeOther,
+		},
+		{
+			name:        "factor_verified",
+			user:        enrolledUser,
+			mfaVerified: true,
+			code:        http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			session := &sessions.Session{}
+			if err := authProvider.StoreSession(ctx, session, &auth.SessionInfo{
+				Data: map[string]interface{}{
+					"email":          tc.user.Email,
+					"email_verified": true,
+					"mfa_enabled":    tc.mfaVerified,
+					"revoked":        false,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := ctx
+			ctx = controller.WithSession(ctx, session)
+			ctx = controller.WithUser(ctx, tc.user)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.Clone(ctx)
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			requireMFAChallenge(emptyHandler()).ServeHTTP(w, r)
+			w.Flush()
+
+			if got, want := w.Code, tc.code; got != want {
+				t.Errorf("Expected %d to be %d", got, want)
+			}
+		})
+	}
+}
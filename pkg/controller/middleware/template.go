@@ -40,6 +40,7 @@ func PopulateTemplateVariables(cfg *config.ServerConfig) mux.MiddlewareFunc {
 			m["buildID"] = buildinfo.BuildID
 			m["buildTag"] = buildinfo.BuildTag
 			m["devMode"] = cfg.DevMode
+			m["passwordAuth"] = cfg.Auth.PasswordAuth()
 			m["systemNotice"] = cfg.ParsedSystemNotice()
 
 			// Add in any feature flags.
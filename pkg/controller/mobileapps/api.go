@@ -0,0 +1,241 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileapps
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleListAPI lists the mobile apps of the API key's realm, including
+// disabled mobile apps.
+func (c *Controller) HandleListAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("mobileapps.HandleListAPI")
+
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.MobileAppRead)
+		if !ok {
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		q := r.FormValue(QueryKeySearch)
+		apps, paginator, err := currentRealm.ListMobileApps(c.db, pageParams, database.WithMobileAppSearch(q))
+		if err != nil {
+			logger.Errorw("failed to list mobile apps", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		resp := &api.ListMobileAppsResponse{
+			MobileApps: make([]*api.MobileAppResponse, 0, len(apps)),
+		}
+		for _, app := range apps {
+			resp.MobileApps = append(resp.MobileApps, mobileAppResponse(app))
+		}
+		if paginator != nil && paginator.NextPage != nil {
+			resp.NextPage = paginator.NextPage.Number
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// HandleShowAPI shows a mobile app in the API key's realm.
+func (c *Controller) HandleShowAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.MobileAppRead)
+		if !ok {
+			return
+		}
+
+		app, ok := c.findAPIMobileApp(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, mobileAppResponse(app))
+	})
+}
+
+// HandleCreateAPI creates a mobile app in the API key's realm.
+func (c *Controller) HandleCreateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("mobileapps.HandleCreateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.MobileAppWrite)
+		if !ok {
+			return
+		}
+
+		var request api.CreateMobileAppRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		app := &database.MobileApp{
+			RealmID:         currentRealm.ID,
+			Name:            request.Name,
+			OS:              parseOSType(request.OS),
+			AppID:           request.AppID,
+			SHA:             request.SHA,
+			URL:             request.URL,
+			DisableRedirect: !request.EnableRedirect,
+		}
+		if err := c.db.SaveMobileApp(app, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(app.ErrorMessages(), ", ")))
+				return
+			}
+
+			logger.Errorw("failed to create mobile app", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, mobileAppResponse(app))
+	})
+}
+
+// HandleUpdateAPI updates a mobile app in the API key's realm.
+func (c *Controller) HandleUpdateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("mobileapps.HandleUpdateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.MobileAppWrite)
+		if !ok {
+			return
+		}
+
+		app, ok := c.findAPIMobileApp(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		var request api.UpdateMobileAppRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		if request.Name != nil {
+			app.Name = *request.Name
+		}
+		if request.OS != nil {
+			app.OS = parseOSType(*request.OS)
+		}
+		if request.AppID != nil {
+			app.AppID = *request.AppID
+		}
+		if request.SHA != nil {
+			app.SHA = *request.SHA
+		}
+		if request.URL != nil {
+			app.URL = *request.URL
+		}
+		if request.EnableRedirect != nil {
+			app.DisableRedirect = !*request.EnableRedirect
+		}
+		if request.Disabled != nil {
+			switch {
+			case *request.Disabled && app.DeletedAt == nil:
+				now := time.Now().UTC()
+				app.DeletedAt = &now
+			case !*request.Disabled:
+				app.DeletedAt = nil
+			}
+		}
+
+		if err := c.db.SaveMobileApp(app, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(app.ErrorMessages(), ", ")))
+				return
+			}
+
+			logger.Errorw("failed to update mobile app", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, mobileAppResponse(app))
+	})
+}
+
+// findAPIMobileApp finds the mobile app in the request path, rendering the
+// appropriate error and returning false if it does not exist in the realm.
+func (c *Controller) findAPIMobileApp(w http.ResponseWriter, r *http.Request, realm *database.Realm) (*database.MobileApp, bool) {
+	logger := logging.FromContext(r.Context()).Named("mobileapps.findAPIMobileApp")
+
+	app, err := realm.FindMobileApp(c.db, mux.Vars(r)["id"])
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("mobile app not found"))
+			return nil, false
+		}
+
+		logger.Errorw("failed to find mobile app", "error", err)
+		c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+		return nil, false
+	}
+	return app, true
+}
+
+// parseOSType parses "ios" or "android", returning OSTypeUnknown for anything
+// else.
+func parseOSType(s string) database.OSType {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "ios":
+		return database.OSTypeIOS
+	case "android":
+		return database.OSTypeAndroid
+	default:
+		return database.OSTypeUnknown
+	}
+}
+
+// mobileAppResponse builds the API representation of the mobile app.
+func mobileAppResponse(app *database.MobileApp) *api.MobileAppResponse {
+	return &api.MobileAppResponse{
+		ID:                 app.ID,
+		Name:               app.Name,
+		OS:                 strings.ToLower(app.OS.Display()),
+		AppID:              app.AppID,
+		SHA:                app.SHA,
+		URL:                app.URL,
+		EnableRedirect:     !app.DisableRedirect,
+		Disabled:           app.DeletedAt != nil,
+		CreatedAtTimestamp: app.CreatedAt.UTC().Unix(),
+	}
+}
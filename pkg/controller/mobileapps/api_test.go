@@ -0,0 +1,146 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileapps_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/mobileapps"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleMobileAppsAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	realm := database.NewRealmWithDefaults("Mobile apps API")
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := mobileapps.New(db, harness.Renderer)
+
+	// serve serves the request as an admin API key with the given permissions.
+	serve := func(tb testing.TB, permissions rbac.Permission, handler http.Handler, meth, id string, body interface{}) *httptest.ResponseRecorder {
+		tb.Helper()
+
+		ctx := ctx
+		ctx = controller.WithAuthorizedApp(ctx, &database.AuthorizedApp{
+			RealmID:     realm.ID,
+			Name:        "Terraform",
+			APIKeyType:  database.APIKeyTypeAdmin,
+			Permissions: permissions,
+		})
+		ctx = controller.WithRealm(ctx, realm)
+
+		w, r := envstest.BuildJSONRequest(ctx, tb, meth, "/", body)
+		if id != "" {
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+		}
+		harness.WithCommonMiddlewares(handler).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("permission_missing", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.MobileAppRead, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateMobileAppRequest{
+			Name:  "Forbidden",
+			OS:    "ios",
+			AppID: "com.example.forbidden",
+		})
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.MobileAppWrite|rbac.MobileAppRead, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateMobileAppRequest{
+			Name:  "No OS",
+			AppID: "com.example.noos",
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		permissions := rbac.MobileAppWrite | rbac.MobileAppRead
+
+		w := serve(t, permissions, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateMobileAppRequest{
+			Name:  "Example app",
+			OS:    "ios",
+			AppID: "ABCD1234.com.example.app",
+			URL:   "https://example.com/app",
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var created api.MobileAppResponse
+		decodeJSON(t, w, &created)
+		if got, want := created.OS, "ios"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		id := fmt.Sprint(created.ID)
+
+		name := "Renamed app"
+		w = serve(t, permissions, c.HandleUpdateAPI(), http.MethodPatch, id, &api.UpdateMobileAppRequest{
+			Name: &name,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w = serve(t, permissions, c.HandleShowAPI(), http.MethodGet, id, nil)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var shown api.MobileAppResponse
+		decodeJSON(t, w, &shown)
+		if got, want := shown.Name, name; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := shown.URL, "https://example.com/app"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+}
+
+func decodeJSON(tb testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	tb.Helper()
+
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		tb.Fatal(err)
+	}
+}
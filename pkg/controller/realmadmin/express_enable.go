@@ -60,6 +60,7 @@ func (c *Controller) HandleEnableExpress() http.Handler {
 		currentRealm.CodeDuration = enxSettings.CodeDuration
 		currentRealm.LongCodeLength = enxSettings.LongCodeLength
 		currentRealm.LongCodeDuration = enxSettings.LongCodeDuration
+		currentRealm.LongCodeAlphabet = enxSettings.LongCodeAlphabet
 		currentRealm.ResetSMSTextTemplates()
 
 		// Confirmed is the only allowed test type for EN Express.
@@ -33,16 +33,30 @@ var (
 	shortCodeLengths            = []int{6, 7, 8}
 	longCodeLengths             = []int{12, 13, 14, 15, 16}
 	longCodeHours               = []int{}
+	codeGroupSizes              = []uint{0, 3, 4, 5}
 	mfaGracePeriod              = []int64{0, 1, 7, 30}
 	passwordRotationPeriodDays  = []int{0, 30, 60, 90, 365}
 	passwordRotationWarningDays = []int{0, 1, 3, 5, 7, 30}
+
+	longCodeAlphabets = []*codeAlphabet{
+		{Name: "Letters and digits", Alphabet: database.DefaultLongCodeAlphabet},
+		{Name: "Digits only", Alphabet: database.ShortCodeAlphabet},
+		{Name: "Crockford base32 (no i, l, o, or u)", Alphabet: database.CrockfordLongCodeAlphabet},
+	}
 )
 
 const (
 	maxShortCodeMinutes = 60
 
+	// customCodeAlphabet is the form value for a long code alphabet which is not
+	// one of longCodeAlphabets.
+	customCodeAlphabet = "custom"
+
 	labelPrefix    = "sms_text_label_"
 	templatePrefix = "sms_text_template_"
+
+	letterLocalePrefix   = "letter_localized_locale_"
+	letterTemplatePrefix = "letter_localized_template_"
 )
 
 func init() {
@@ -61,40 +75,51 @@ type formData struct {
 	KeyServerURLOverride      string `form:"key_server_url"`
 	KeyServerAudienceOverride string `form:"key_server_audience"`
 
-	Codes                   bool              `form:"codes"`
-	AllowedTestTypes        database.TestType `form:"allowed_test_types"`
-	AllowUserReport         bool              `form:"allow_user_report"`
-	AllowUserReportWebView  bool              `form:"allow_user_report_web_view"`
-	AllowAdminUserReport    bool              `form:"allow_admin_user_report"`
-	UserReportWebhookURL    string            `form:"user_report_webhook_url"`
-	UserReportWebhookSecret string            `form:"user_report_webhook_secret"`
-	AllowBulkUpload         bool              `form:"allow_bulk"`
-	RequireDate             bool              `form:"require_date"`
-	CodeLength              uint              `form:"code_length"`
-	CodeDurationMinutes     int64             `form:"code_duration"`
-	LongCodeLength          uint              `form:"long_code_length"`
-	LongCodeDurationHours   int64             `form:"long_code_duration"`
+	Codes                    bool               `form:"codes"`
+	AllowedTestTypes         database.TestType  `form:"allowed_test_types"`
+	AllowUserReport          bool               `form:"allow_user_report"`
+	AllowUserReportWebView   bool               `form:"allow_user_report_web_view"`
+	AllowAdminUserReport     bool               `form:"allow_admin_user_report"`
+	UserReportWebhookURL     string             `form:"user_report_webhook_url"`
+	UserReportWebhookSecret  string             `form:"user_report_webhook_secret"`
+	AllowBulkUpload          bool               `form:"allow_bulk"`
+	RequireDate              bool               `form:"require_date"`
+	CodeLength               uint               `form:"code_length"`
+	CodeDurationMinutes      int64              `form:"code_duration"`
+	LongCodeLength           uint               `form:"long_code_length"`
+	LongCodeDurationHours    int64              `form:"long_code_duration"`
+	LongCodeAlphabet         string             `form:"long_code_alphabet"`
+	LongCodeAlphabetCustom   string             `form:"long_code_alphabet_custom"`
+	CodeGroupSize            uint               `form:"code_group_size"`
+	UseCheckDigits           bool               `form:"use_check_digits"`
+	LetterTemplate           string             `form:"letter_template"`
+	LetterLocalizedTemplates map[string]*string `form:"-"`
 
 	SMS                       bool               `form:"sms"`
 	UseSystemSMSConfig        bool               `form:"use_system_sms_config"`
 	SMSCountry                string             `form:"sms_country"`
 	SMSFromNumberID           uint               `form:"sms_from_number_id"`
-	TwilioAccountSid          string             `form:"twilio_account_sid"`
-	TwilioAuthToken           string             `form:"twilio_auth_token"`
-	TwilioFromNumber          string             `form:"twilio_from_number"`
 	SMSTextTemplate           string             `form:"-"`
 	SMSTextAlternateTemplates map[string]*string `form:"-"`
 	SMSTextUserReportAppend   string             `form:"sms_text_user_report_append"`
-
-	Email                      bool   `form:"email"`
-	UseSystemEmailConfig       bool   `form:"use_system_email_config"`
-	SMTPAccount                string `form:"smtp_account"`
-	SMTPPassword               string `form:"smtp_password"`
-	SMTPHost                   string `form:"smtp_host"`
-	SMTPPort                   string `form:"smtp_port"`
-	EmailInviteTemplate        string `form:"email_invite_template"`
-	EmailPasswordResetTemplate string `form:"password_reset_template"`
-	EmailVerifyTemplate        string `form:"email_verify_template"`
+	SMSReminderHours          uint               `form:"sms_reminder_hours"`
+	SMSReminderTemplateLabel  string             `form:"sms_reminder_template_label"`
+	smsProviderFormData
+
+	Email                      bool               `form:"email"`
+	UseSystemEmailConfig       bool               `form:"use_system_email_config"`
+	SMTPAccount                string             `form:"smtp_account"`
+	SMTPPassword               string             `form:"smtp_password"`
+	SMTPHost                   string             `form:"smtp_host"`
+	SMTPPort                   string             `form:"smtp_port"`
+	EmailProviderType          email.ProviderType `form:"email_provider_type"`
+	EmailHTTPEndpoint          string             `form:"email_http_endpoint"`
+	EmailHTTPAPIKey            string             `form:"email_http_api_key"`
+	EmailHTTPFromAddress       string             `form:"email_http_from_address"`
+	EmailInviteTemplate        string             `form:"email_invite_template"`
+	EmailPasswordResetTemplate string             `form:"password_reset_template"`
+	EmailVerifyTemplate        string             `form:"email_verify_template"`
+	EmailCodeTemplate          string             `form:"email_code_template"`
 
 	Security                    bool   `form:"security"`
 	MFAMode                     int16  `form:"mfa_mode"`
@@ -112,6 +137,58 @@ type formData struct {
 	AbusePreventionBurst       uint64  `form:"abuse_prevention_burst"`
 }
 
+// smsProviderFormData is the form data for an SMS provider's credentials. It is
+// shared between the primary SMS configuration and failover configurations.
+type smsProviderFormData struct {
+	SMSProviderType  sms.ProviderType `form:"sms_provider_type"`
+	TwilioAccountSid string           `form:"twilio_account_sid"`
+	TwilioAuthToken  string           `form:"twilio_auth_token"`
+	TwilioFromNumber string           `form:"twilio_from_number"`
+	VonageAPIKey     string           `form:"vonage_api_key"`
+	VonageAPISecret  string           `form:"vonage_api_secret"`
+	VonageFromNumber string           `form:"vonage_from_number"`
+	HTTPEndpoint     string           `form:"http_endpoint"`
+	HTTPAuthHeader   string           `form:"http_auth_header"`
+	HTTPAuthToken    string           `form:"http_auth_token"`
+	HTTPBodyTemplate string           `form:"http_body_template"`
+	HTTPFromNumber   string           `form:"http_from_number"`
+}
+
+// apply sets the provider type and credentials on the given SMS config. Secret
+// values that are the password sentinel are left unchanged.
+func (f *smsProviderFormData) apply(smsConfig *database.SMSConfig) error {
+	smsConfig.ProviderType = f.SMSProviderType
+	if smsConfig.ProviderType == "" {
+		smsConfig.ProviderType = sms.ProviderTypeTwilio
+	}
+
+	switch smsConfig.ProviderType {
+	case sms.ProviderTypeTwilio:
+		smsConfig.TwilioAccountSid = f.TwilioAccountSid
+		if f.TwilioAuthToken != project.PasswordSentinel {
+			smsConfig.TwilioAuthToken = f.TwilioAuthToken
+		}
+		smsConfig.TwilioFromNumber = f.TwilioFromNumber
+	case sms.ProviderTypeVonage:
+		smsConfig.VonageAPIKey = f.VonageAPIKey
+		if f.VonageAPISecret != project.PasswordSentinel {
+			smsConfig.VonageAPISecret = f.VonageAPISecret
+		}
+		smsConfig.VonageFromNumber = f.VonageFromNumber
+	case sms.ProviderTypeHTTP:
+		smsConfig.HTTPEndpoint = f.HTTPEndpoint
+		smsConfig.HTTPAuthHeader = f.HTTPAuthHeader
+		if f.HTTPAuthToken != project.PasswordSentinel {
+			smsConfig.HTTPAuthToken = f.HTTPAuthToken
+		}
+		smsConfig.HTTPBodyTemplate = f.HTTPBodyTemplate
+		smsConfig.HTTPFromNumber = f.HTTPFromNumber
+	default:
+		return fmt.Errorf("unsupported sms provider %q", smsConfig.ProviderType)
+	}
+	return nil
+}
+
 func (c *Controller) HandleSettings() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -244,6 +321,12 @@ func (c *Controller) HandleSettings() http.Handler {
 			// The enforcements of theses as at the data model layer.
 			currentRealm.AllowAdminUserReport = form.AllowAdminUserReport
 			currentRealm.AllowUserReportWebView = form.AllowUserReportWebView
+			currentRealm.UseCheckDigits = form.UseCheckDigits
+			currentRealm.CodeGroupSize = form.CodeGroupSize
+
+			parseLetterTemplates(r, &form)
+			currentRealm.LetterTemplate = strings.TrimSpace(form.LetterTemplate)
+			currentRealm.LetterLocalizedTemplates = postgres.Hstore(form.LetterLocalizedTemplates)
 
 			// These fields can only be set if ENX is disabled
 			if !currentRealm.EnableENExpress {
@@ -251,6 +334,15 @@ func (c *Controller) HandleSettings() http.Handler {
 				currentRealm.CodeDuration.Duration = time.Duration(form.CodeDurationMinutes) * time.Minute
 				currentRealm.LongCodeLength = form.LongCodeLength
 				currentRealm.LongCodeDuration.Duration = time.Duration(form.LongCodeDurationHours) * time.Hour
+
+				alphabet := form.LongCodeAlphabet
+				if alphabet == customCodeAlphabet {
+					alphabet = strings.TrimSpace(form.LongCodeAlphabetCustom)
+				}
+				if alphabet == database.DefaultLongCodeAlphabet {
+					alphabet = ""
+				}
+				currentRealm.LongCodeAlphabet = alphabet
 			} else {
 				// A system admin can allow an ENX realm to edit their code expiration.
 				if currentRealm.ENXCodeExpirationConfigurable {
@@ -267,6 +359,10 @@ func (c *Controller) HandleSettings() http.Handler {
 			currentRealm.SMSFromNumberID = form.SMSFromNumberID
 			currentRealm.SMSTextTemplate = form.SMSTextTemplate
 			currentRealm.SMSTextAlternateTemplates = postgres.Hstore(form.SMSTextAlternateTemplates)
+			if c.config.Features.EnableSMSOutbox {
+				currentRealm.SMSReminderHours = form.SMSReminderHours
+				currentRealm.SMSReminderTemplateLabel = form.SMSReminderTemplateLabel
+			}
 		}
 
 		// Email
@@ -275,6 +371,7 @@ func (c *Controller) HandleSettings() http.Handler {
 			currentRealm.EmailInviteTemplate = form.EmailInviteTemplate
 			currentRealm.EmailPasswordResetTemplate = form.EmailPasswordResetTemplate
 			currentRealm.EmailVerifyTemplate = form.EmailVerifyTemplate
+			currentRealm.EmailCodeTemplate = form.EmailCodeTemplate
 		}
 
 		// Security
@@ -359,27 +456,23 @@ func (c *Controller) HandleSettings() http.Handler {
 
 		// SMS
 		if form.SMS && !form.UseSystemSMSConfig {
-			if smsConfig != nil && !smsConfig.IsSystem {
-				// We have an existing record and the existing record is NOT the system
-				// record.
-				smsConfig.ProviderType = sms.ProviderTypeTwilio
-				smsConfig.TwilioAccountSid = form.TwilioAccountSid
-				if form.TwilioAuthToken != project.PasswordSentinel {
-					smsConfig.TwilioAuthToken = form.TwilioAuthToken
-				}
-				smsConfig.TwilioFromNumber = form.TwilioFromNumber
-			} else {
+			if smsConfig == nil || smsConfig.IsSystem {
 				// There's no record or the existing record was the system config so we
 				// want to create our own.
 				smsConfig = &database.SMSConfig{
-					RealmID:          currentRealm.ID,
-					ProviderType:     sms.ProviderTypeTwilio,
-					TwilioAccountSid: form.TwilioAccountSid,
-					TwilioAuthToken:  form.TwilioAuthToken,
-					TwilioFromNumber: form.TwilioFromNumber,
+					RealmID: currentRealm.ID,
 				}
 			}
 
+			// We have an existing record and the existing record is NOT the system
+			// record, or we just built a new record.
+			if err := form.apply(smsConfig); err != nil {
+				smsConfig.AddError("providerType", err.Error())
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderSettings(ctx, w, r, currentRealm, smsConfig, emailConfig, statsConfig, quotaLimit, quotaRemaining)
+				return
+			}
+
 			if !smsConfig.IsSystem {
 				if err := c.db.SaveSMSConfig(smsConfig); err != nil {
 					if database.IsValidationError(err) {
@@ -398,27 +491,38 @@ func (c *Controller) HandleSettings() http.Handler {
 
 		// Email
 		if form.Email && !form.UseSystemEmailConfig {
-			if emailConfig != nil && !emailConfig.IsSystem {
-				// We have an existing record and the existing record is NOT the system
-				// record.
+			if emailConfig == nil || emailConfig.IsSystem {
+				// There's no record or the existing record was the system config so we
+				// want to create our own.
+				emailConfig = &database.EmailConfig{
+					RealmID: currentRealm.ID,
+				}
+			}
+
+			emailConfig.ProviderType = form.EmailProviderType
+			if emailConfig.ProviderType == "" {
 				emailConfig.ProviderType = email.ProviderTypeSMTP
+			}
+
+			switch emailConfig.ProviderType {
+			case email.ProviderTypeSMTP:
 				emailConfig.SMTPAccount = form.SMTPAccount
 				if form.SMTPPassword != project.PasswordSentinel {
 					emailConfig.SMTPPassword = form.SMTPPassword
 				}
 				emailConfig.SMTPHost = form.SMTPHost
 				emailConfig.SMTPPort = form.SMTPPort
-			} else {
-				// There's no record or the existing record was the system config so we
-				// want to create our own.
-				emailConfig = &database.EmailConfig{
-					RealmID:      currentRealm.ID,
-					ProviderType: email.ProviderTypeSMTP,
-					SMTPAccount:  form.SMTPAccount,
-					SMTPPassword: form.SMTPPassword,
-					SMTPHost:     form.SMTPHost,
-					SMTPPort:     form.SMTPPort,
+			case email.ProviderTypeHTTP:
+				emailConfig.HTTPEndpoint = form.EmailHTTPEndpoint
+				if form.EmailHTTPAPIKey != project.PasswordSentinel {
+					emailConfig.HTTPAPIKey = form.EmailHTTPAPIKey
 				}
+				emailConfig.HTTPFromAddress = form.EmailHTTPFromAddress
+			default:
+				emailConfig.AddError("providerType", fmt.Sprintf("unsupported email provider %q", emailConfig.ProviderType))
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderSettings(ctx, w, r, currentRealm, smsConfig, emailConfig, statsConfig, quotaLimit, quotaRemaining)
+				return
 			}
 
 			if !emailConfig.IsSystem {
@@ -499,3 +603,28 @@ func parseSMSTextTemplates(r *http.Request, form *formData) {
 		}
 	}
 }
+
+// parseLetterTemplates pairs the localized letter template locales and texts by
+// index. Rows with neither a locale nor a template are dropped, so clearing a
+// row deletes its template.
+func parseLetterTemplates(r *http.Request, form *formData) {
+	locales := map[string]string{}
+	templates := map[string]string{}
+	for k, v := range r.PostForm {
+		if strings.HasPrefix(k, letterLocalePrefix) {
+			locales[k[len(letterLocalePrefix):]] = strings.ToLower(strings.TrimSpace(v[0]))
+		}
+		if strings.HasPrefix(k, letterTemplatePrefix) {
+			templates[k[len(letterTemplatePrefix):]] = strings.TrimSpace(v[0])
+		}
+	}
+
+	form.LetterLocalizedTemplates = map[string]*string{}
+	for i, locale := range locales {
+		t := templates[i]
+		if locale == "" && t == "" {
+			continue
+		}
+		form.LetterLocalizedTemplates[locale] = &t
+	}
+}
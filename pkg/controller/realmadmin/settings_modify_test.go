@@ -143,6 +143,12 @@ func TestHandleSettings(t *testing.T) {
 			"code_duration":      []string{"60"},
 			"long_code_length":   []string{"22"},
 			"long_code_duration": []string{"24"},
+
+			"letter_template":             []string{"Your code is below."},
+			"letter_localized_locale_0":   []string{"ES"},
+			"letter_localized_template_0": []string{"Su código está abajo."},
+			"letter_localized_locale_1":   []string{""},
+			"letter_localized_template_1": []string{""},
 		})
 		handler.ServeHTTP(w, r)
 
@@ -175,6 +181,15 @@ func TestHandleSettings(t *testing.T) {
 		if got, want := realm.LongCodeDuration.Duration, 24*time.Hour; got != want {
 			t.Errorf("Expected %q to be %q", got, want)
 		}
+		if got, want := realm.LetterTemplate, "Your code is below."; got != want {
+			t.Errorf("Expected %q to be %q", got, want)
+		}
+		if got, want := len(realm.LetterLocalizedTemplates), 1; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+		if got, want := realm.LetterTemplateFor("es"), "Su código está abajo."; got != want {
+			t.Errorf("Expected %q to be %q", got, want)
+		}
 	})
 
 	t.Run("security", func(t *testing.T) {
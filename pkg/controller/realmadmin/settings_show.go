@@ -17,13 +17,39 @@ package realmadmin
 import (
 	"context"
 	"net/http"
+	"sort"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
 )
 
 const defaultSMSTemplateLabel = "Default SMS template"
 
+// smsProviderTypes are the SMS providers which can be configured from the realm
+// settings page.
+var smsProviderTypes = map[sms.ProviderType]string{
+	sms.ProviderTypeTwilio: "Twilio",
+	sms.ProviderTypeVonage: "Vonage",
+	sms.ProviderTypeHTTP:   "Generic HTTP",
+}
+
+// smsProviderFields is the data passed to the SMS provider fields partial. The
+// partial is rendered for both the primary provider and failover providers, so
+// element IDs are prefixed to keep them unique on the page.
+type smsProviderFields struct {
+	IDPrefix      string
+	Config        *database.SMSConfig
+	ProviderTypes map[sms.ProviderType]string
+}
+
+// codeAlphabet is a preset long code alphabet offered in the code settings.
+type codeAlphabet struct {
+	Name     string
+	Alphabet string
+}
+
 type TemplateData struct {
 	Label string
 	Value string
@@ -69,6 +95,13 @@ func (c *Controller) renderSettings(
 		return
 	}
 
+	// Look up any failover sms providers.
+	smsFailoverConfigs, err := realm.SMSFailoverConfigs(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
 	// Don't pass through the system config to the template - we don't want to
 	// risk accidentally rendering its ID or values since the realm should never
 	// see these values. However, we have to go lookup the actual SMS config
@@ -106,6 +139,29 @@ func (c *Controller) renderSettings(
 		}
 	}
 
+	// Look up the single sign-on identity provider.
+	ssoConfig, err := realm.FindOIDCConfig(c.db)
+	if err != nil {
+		if !database.IsNotFound(err) {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		ssoConfig = new(database.OIDCConfig)
+	}
+	var ssoGroupRoles []*database.OIDCGroupRole
+	if ssoConfig.ID != 0 {
+		ssoGroupRoles, err = ssoConfig.ListOIDCGroupRoles(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+	}
+	roles, err := realm.ListRoles(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
 	templates := map[int]TemplateData{
 		0: {
 			Label: defaultSMSTemplateLabel,
@@ -123,13 +179,51 @@ func (c *Controller) renderSettings(
 		}
 	}
 
+	// Localized letter templates are listed by locale, followed by an empty row
+	// for adding a new locale.
+	locales := make([]string, 0, len(realm.LetterLocalizedTemplates))
+	for k := range realm.LetterLocalizedTemplates {
+		locales = append(locales, k)
+	}
+	sort.Strings(locales)
+
+	letterTemplates := make([]TemplateData, 0, len(locales)+1)
+	for i, k := range locales {
+		var v string
+		if t := realm.LetterLocalizedTemplates[k]; t != nil {
+			v = *t
+		}
+		letterTemplates = append(letterTemplates, TemplateData{Label: k, Value: v, Index: i})
+	}
+	letterTemplates = append(letterTemplates, TemplateData{Index: len(locales)})
+
 	m := c.config.Features.AddToTemplate(controller.TemplateMapFromContext(ctx))
 	m.Title("Realm settings")
 	m["realm"] = realm
 	m["smsConfig"] = smsConfig
 	m["smsFromNumbers"] = smsFromNumbers
+	m["smsProviderTypes"] = smsProviderTypes
+	m["smsProviderFields"] = &smsProviderFields{
+		Config:        smsConfig,
+		ProviderTypes: smsProviderTypes,
+	}
+	m["smsFailoverConfigs"] = smsFailoverConfigs
+	m["smsFailoverFields"] = &smsProviderFields{
+		IDPrefix:      "failover-",
+		Config:        new(database.SMSConfig),
+		ProviderTypes: smsProviderTypes,
+	}
 	m["smsTemplates"] = templates
+	m["letterTemplates"] = letterTemplates
 	m["emailConfig"] = emailConfig
+	m["ssoConfig"] = ssoConfig
+	m["ssoGroupRoles"] = formatGroupRoles(ssoGroupRoles)
+	m["ssoDefaultRoleID"] = uint(0)
+	if ssoConfig.DefaultRoleID != nil {
+		m["ssoDefaultRoleID"] = *ssoConfig.DefaultRoleID
+	}
+	m["ssoCallbackPath"] = login.SSOCallbackPath
+	m["roles"] = roles
 	m["statsConfig"] = keyServerStats
 	m["countries"] = database.Countries
 	// User report is handled special and isn't part of the previous test type hierarchy.
@@ -154,6 +248,15 @@ func (c *Controller) renderSettings(
 	m["shortCodeMinutes"] = realmShortCodeMinutes
 	m["longCodeLengths"] = longCodeLengths
 	m["longCodeHours"] = longCodeHours
+	m["longCodeAlphabets"] = longCodeAlphabets
+	m["longCodeAlphabetCustom"] = true
+	for _, a := range longCodeAlphabets {
+		if a.Alphabet == realm.GetLongCodeAlphabet() {
+			m["longCodeAlphabetCustom"] = false
+		}
+	}
+	m["codeGroupSizes"] = codeGroupSizes
+	m["minLongCodeEntropyBits"] = database.MinLongCodeEntropyBits
 	m["enxRedirectDomain"] = c.config.IssueConfig().ENExpressRedirectDomain
 
 	m["maxSMSTemplate"] = database.SMSTemplateMaxLength
@@ -0,0 +1,169 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateSMSFailover adds a new failover SMS provider to the realm. It is
+// tried after the primary provider and all existing failover providers.
+func (c *Controller) HandleCreateSMSFailover() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		// A failover provider only makes sense if there is a primary provider.
+		if has, err := currentRealm.HasSMSConfig(c.db); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		} else if !has {
+			flash.Error("Configure a primary SMS provider before adding failover providers.")
+			http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+			return
+		}
+
+		var form smsProviderFormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+			return
+		}
+
+		priority, err := currentRealm.NextSMSFailoverPriority(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		smsConfig := &database.SMSConfig{
+			RealmID:  currentRealm.ID,
+			Priority: priority,
+		}
+		if err := form.apply(smsConfig); err != nil {
+			flash.Error("Failed to add failover SMS provider: %v", err)
+			http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+			return
+		}
+
+		if smsConfig.IsBlank() {
+			flash.Error("Failed to add failover SMS provider: credentials cannot be blank")
+			http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+			return
+		}
+
+		if err := c.db.SaveSMSConfig(smsConfig); err != nil {
+			if database.IsValidationError(err) {
+				flash.Error("Failed to add failover SMS provider: %s", strings.Join(smsConfig.ErrorMessages(), ", "))
+				http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		audit := database.BuildAuditEntry(currentUser,
+			fmt.Sprintf("added failover sms provider %s (%d)", smsConfig.ProviderName(), smsConfig.ID),
+			currentRealm, currentRealm.ID)
+		if err := c.db.SaveAuditEntry(audit); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully added failover SMS provider")
+		flash.Warning("It can take up to 5 minutes for the new SMS configuration to be fully propagated.")
+		http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+	})
+}
+
+// HandleDeleteSMSFailover removes a failover SMS provider from the realm.
+func (c *Controller) HandleDeleteSMSFailover() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		smsConfig, err := currentRealm.FindSMSFailoverConfig(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteSMSConfig(smsConfig); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		audit := database.BuildAuditEntry(currentUser,
+			fmt.Sprintf("removed failover sms provider %s (%d)", smsConfig.ProviderName(), smsConfig.ID),
+			currentRealm, currentRealm.ID)
+		if err := c.db.SaveAuditEntry(audit); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully removed failover SMS provider")
+		http.Redirect(w, r, "/realm/settings#sms", http.StatusSeeOther)
+	})
+}
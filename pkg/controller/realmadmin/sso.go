@@ -0,0 +1,216 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+type ssoFormData struct {
+	Issuer        string `form:"issuer"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+	GroupsClaim   string `form:"groups_claim"`
+	DefaultRoleID uint   `form:"default_role_id"`
+	GroupRoles    string `form:"group_roles"`
+}
+
+// HandleSaveSSO creates or updates the realm's single sign-on identity
+// provider.
+func (c *Controller) HandleSaveSSO() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		var form ssoFormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+			return
+		}
+
+		ssoConfig, err := currentRealm.FindOIDCConfig(c.db)
+		if err != nil {
+			if !database.IsNotFound(err) {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			ssoConfig = &database.OIDCConfig{RealmID: currentRealm.ID}
+		}
+
+		roles, err := currentRealm.ListRoles(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		groupRoles, err := parseGroupRoles(form.GroupRoles, roles)
+		if err != nil {
+			flash.Error("Failed to update single sign-on: %v", err)
+			http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+			return
+		}
+
+		ssoConfig.Issuer = form.Issuer
+		ssoConfig.AllowInsecureIssuer = c.config.DevMode
+		ssoConfig.ClientID = form.ClientID
+		if form.ClientSecret != project.PasswordSentinel {
+			ssoConfig.ClientSecret = form.ClientSecret
+		}
+		ssoConfig.GroupsClaim = form.GroupsClaim
+		ssoConfig.DefaultRoleID = nil
+		if form.DefaultRoleID != 0 {
+			id := form.DefaultRoleID
+			ssoConfig.DefaultRoleID = &id
+		}
+
+		if err := c.db.SaveOIDCConfig(ssoConfig, groupRoles, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				flash.Error("Failed to update single sign-on: %s", strings.Join(ssoConfig.ErrorMessages(), ", "))
+				http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully updated single sign-on")
+		http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+	})
+}
+
+// HandleDeleteSSO removes the realm's single sign-on identity provider.
+// Existing members keep their access, but must sign in with a password.
+func (c *Controller) HandleDeleteSSO() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		ssoConfig, err := currentRealm.FindOIDCConfig(c.db)
+		if err != nil {
+			if database.IsNotFound(err) {
+				http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteOIDCConfig(ssoConfig, currentUser); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully removed single sign-on")
+		http.Redirect(w, r, "/realm/settings#sso", http.StatusSeeOther)
+	})
+}
+
+// parseGroupRoles parses group roles from lines of the form "group = role",
+// where role is the name of one of the given roles. Group names may contain
+// "=", so the line is split on the last "=".
+func parseGroupRoles(s string, roles []*database.Role) ([]*database.OIDCGroupRole, error) {
+	byName := make(map[string]*database.Role, len(roles))
+	for _, role := range roles {
+		byName[strings.ToLower(role.Name)] = role
+	}
+
+	var groupRoles []*database.OIDCGroupRole
+	for i, line := range strings.Split(s, "\n") {
+		line = project.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		idx := strings.LastIndex(line, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected \"group = role\"", i+1)
+		}
+
+		group := project.TrimSpace(line[:idx])
+		name := project.TrimSpace(line[idx+1:])
+		if group == "" || name == "" {
+			return nil, fmt.Errorf("line %d: expected \"group = role\"", i+1)
+		}
+
+		role, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown role %q", i+1, name)
+		}
+
+		groupRoles = append(groupRoles, &database.OIDCGroupRole{
+			Group:  group,
+			RoleID: role.ID,
+		})
+	}
+	return groupRoles, nil
+}
+
+// formatGroupRoles formats group roles for editing with parseGroupRoles.
+func formatGroupRoles(groupRoles []*database.OIDCGroupRole) string {
+	lines := make([]string, 0, len(groupRoles))
+	for _, gr := range groupRoles {
+		if gr.Role == nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s", gr.Group, gr.Role.Name))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roles
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// HandleCreate renders the new role form and creates the role.
+func (c *Controller) HandleCreate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.UserWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		// Requested form, stop processing.
+		var role database.Role
+		if r.Method == http.MethodGet {
+			c.renderNew(ctx, w, &role)
+			return
+		}
+
+		if err := bindForm(r, membership, &role); err != nil {
+			role.AddError("", err.Error())
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderNew(ctx, w, &role)
+			return
+		}
+
+		role.RealmID = currentRealm.ID
+		if err := c.db.SaveRole(&role, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderNew(ctx, w, &role)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully created role %q", role.Name)
+		http.Redirect(w, r, "/realm/roles", http.StatusSeeOther)
+	})
+}
+
+// bindForm binds the role form. The current membership must have all of the
+// permissions being granted to the role.
+func bindForm(r *http.Request, currentMembership *database.Membership, role *database.Role) error {
+	type FormData struct {
+		Name        string            `form:"name"`
+		Description string            `form:"description"`
+		Permissions []rbac.Permission `form:"permissions"`
+	}
+
+	var form FormData
+	formErr := controller.BindForm(nil, r, &form)
+	role.Name = form.Name
+	role.Description = form.Description
+
+	permissions, rbacErr := rbac.CompileAndAuthorize(currentMembership.Permissions, form.Permissions)
+	role.Permissions = permissions
+
+	if formErr != nil {
+		return formErr
+	}
+	return rbacErr
+}
+
+// renderNew renders the new page.
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, role *database.Role) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("New role")
+	m["role"] = role
+	m["permissions"] = rbac.NamePermissionMap
+	c.h.RenderHTML(w, "roles/new", m)
+}
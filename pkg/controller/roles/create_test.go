@@ -0,0 +1,137 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roles_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/roles"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := roles.New(harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleCreate())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.UserWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", &url.Values{})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnprocessableEntity; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "cannot be blank"; !strings.Contains(got, want) {
+			t.Errorf("Expected %q to contain %q", got, want)
+		}
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.UserWrite,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", &url.Values{
+			"name":        []string{"Escalated"},
+			"permissions": []string{fmt.Sprintf("%d", rbac.SettingsWrite)},
+		})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnprocessableEntity; got != want {
+			t.Errorf("Expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "actor does not have all scopes"; !strings.Contains(got, want) {
+			t.Errorf("Expected %q to contain %q", got, want)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		realm := database.NewRealmWithDefaults("roles")
+		if err := harness.Database.SaveRealm(realm, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.LegacyRealmAdmin,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPost, "/", &url.Values{
+			"name":        []string{"Contact tracer"},
+			"description": []string{"Issues codes to positive cases"},
+			"permissions": []string{fmt.Sprintf("%d", rbac.CodeBulkIssue)},
+		})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		list, err := realm.ListRoles(harness.Database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(list), 1; got != want {
+			t.Fatalf("expected %d to be %d", got, want)
+		}
+
+		// Implied permissions are granted.
+		if got, want := list[0].Permissions, rbac.CodeBulkIssue|rbac.CodeIssue; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+	})
+}
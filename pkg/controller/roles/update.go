@@ -0,0 +1,118 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roles
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleUpdate renders the edit role form and updates the role. Permission
+// changes are applied to all members of the role.
+func (c *Controller) HandleUpdate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.UserWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		role, err := currentRealm.FindRole(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		memberCounts, err := currentRealm.RoleMemberCounts(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		memberCount := memberCounts[role.ID]
+
+		// Requested form, stop processing.
+		if r.Method == http.MethodGet {
+			c.renderEdit(ctx, w, role, memberCount)
+			return
+		}
+
+		previous := role.Permissions
+		if err := bindForm(r, membership, role); err != nil {
+			role.AddError("", err.Error())
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderEdit(ctx, w, role, memberCount)
+			return
+		}
+
+		// Members of a role cannot change the role's permissions, since that would
+		// change their own permissions.
+		if membership.RoleID != nil && *membership.RoleID == role.ID && role.Permissions != previous {
+			role.AddError("permissions", "cannot be changed by members of the role")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderEdit(ctx, w, role, memberCount)
+			return
+		}
+
+		if err := c.db.SaveRole(role, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderEdit(ctx, w, role, memberCount)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully updated role %q", role.Name)
+		http.Redirect(w, r, "/realm/roles", http.StatusSeeOther)
+	})
+}
+
+// renderEdit renders the edit page.
+func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, role *database.Role, memberCount int) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Edit role: %s", role.Name)
+	m["role"] = role
+	m["memberCount"] = memberCount
+	m["permissions"] = rbac.NamePermissionMap
+	c.h.RenderHTML(w, "roles/edit", m)
+}
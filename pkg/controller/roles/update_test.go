@@ -0,0 +1,108 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roles_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/roles"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	c := roles.New(harness.Database, harness.Renderer)
+	handler := harness.WithCommonMiddlewares(c.HandleUpdate())
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+
+		envstest.ExerciseSessionMissing(t, handler)
+		envstest.ExerciseMembershipMissing(t, handler)
+		envstest.ExercisePermissionMissing(t, handler)
+		envstest.ExerciseIDNotFound(t, &database.Membership{
+			Realm:       &database.Realm{},
+			User:        &database.User{},
+			Permissions: rbac.UserWrite,
+		}, handler)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		realm := database.NewRealmWithDefaults("roles-update")
+		if err := harness.Database.SaveRealm(realm, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		role := &database.Role{
+			RealmID:     realm.ID,
+			Name:        "Lab tech",
+			Permissions: rbac.CodeIssue,
+		}
+		if err := harness.Database.SaveRole(role, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		member := &database.User{Email: "roles-update@example.com", Name: "Member"}
+		if err := harness.Database.SaveUser(member, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		if err := member.AddToRealmWithRole(harness.Database, realm, role, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        &database.User{},
+			Permissions: rbac.LegacyRealmAdmin,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPatch, "/", &url.Values{
+			"name":        []string{"Lab tech"},
+			"permissions": []string{fmt.Sprintf("%d", rbac.CodeIssue), fmt.Sprintf("%d", rbac.CodeRead)},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", role.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		// The change is applied to the role's members.
+		membership, err := member.FindMembership(harness.Database, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := membership.Permissions, rbac.CodeIssue|rbac.CodeRead; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,451 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleListGroups lists the realm's roles as groups. The displayName filter is
+// supported.
+func (c *Controller) HandleListGroups() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		attr, value, err := parseFilter(r.FormValue("filter"))
+		if err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidFilter, err.Error())
+			return
+		}
+		if attr != "" && attr != "displayname" {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidFilter, "filtering on %q is not supported", attr)
+			return
+		}
+
+		roles, err := realm.ListRoles(c.db)
+		if err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		if attr != "" {
+			filtered := make([]*database.Role, 0, 1)
+			for _, role := range roles {
+				if strings.EqualFold(role.Name, value) {
+					filtered = append(filtered, role)
+				}
+			}
+			roles = filtered
+		}
+
+		total := uint64(len(roles))
+		startIndex, count := parsePage(r)
+		if start := startIndex - 1; start < total {
+			roles = roles[start:]
+		} else {
+			roles = nil
+		}
+		if uint64(len(roles)) > count {
+			roles = roles[:count]
+		}
+
+		resources, err := c.groupResources(r, realm, roles)
+		if err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		c.renderSCIM(w, r, http.StatusOK, &ListResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	})
+}
+
+// HandleShowGroup shows a role as a group.
+func (c *Controller) HandleShowGroup() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		role, ok := c.findRole(w, r, realm)
+		if !ok {
+			return
+		}
+
+		c.renderGroup(w, r, realm, role)
+	})
+}
+
+// HandleReplaceGroup replaces the members of a group. Groups are managed in the
+// realm settings, so the displayName cannot be changed through SCIM and is
+// ignored.
+func (c *Controller) HandleReplaceGroup() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		role, ok := c.findRole(w, r, realm)
+		if !ok {
+			return
+		}
+
+		var request Group
+		if err := bindSCIM(w, r, &request); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		changes := &memberChanges{replace: true}
+		if err := changes.addRefs(request.Members); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidValue, err.Error())
+			return
+		}
+
+		if !c.applyMemberChanges(w, r, realm, role, changes) {
+			return
+		}
+		c.renderGroup(w, r, realm, role)
+	})
+}
+
+// HandlePatchGroup adds, removes, or replaces the members of a group. Changes
+// to other attributes are ignored.
+func (c *Controller) HandlePatchGroup() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		role, ok := c.findRole(w, r, realm)
+		if !ok {
+			return
+		}
+
+		var request PatchRequest
+		if err := bindSCIM(w, r, &request); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		changes := new(memberChanges)
+		for _, op := range request.Operations {
+			if err := changes.apply(op); err != nil {
+				c.renderError(w, r, http.StatusBadRequest, errInvalidPath, err.Error())
+				return
+			}
+		}
+
+		if !c.applyMemberChanges(w, r, realm, role, changes) {
+			return
+		}
+		c.renderGroup(w, r, realm, role)
+	})
+}
+
+// memberChanges are the changes to a group's members.
+type memberChanges struct {
+	// replace indicates that all members not in add are removed.
+	replace bool
+
+	add    []uint
+	remove []uint
+}
+
+// memberFilterRe matches a path which selects a single member.
+var memberFilterRe = regexp.MustCompile(`^(?i:members)\[\s*(?i:value)\s+(?i:eq)\s+"([^"]*)"\s*\]$`)
+
+// apply records the changes in the patch operation.
+func (m *memberChanges) apply(op *PatchOperation) error {
+	path := strings.TrimSpace(op.Path)
+
+	// Without a path, the value is an object of attributes to change.
+	if path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("value must be an object when path is omitted: %w", err)
+		}
+		for k, v := range attrs {
+			if err := m.apply(&PatchOperation{Op: op.Op, Path: k, Value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if matches := memberFilterRe.FindStringSubmatch(path); matches != nil {
+		if !strings.EqualFold(op.Op, "remove") {
+			return fmt.Errorf("only remove is supported for %q", path)
+		}
+		id, err := parseMemberID(matches[1])
+		if err != nil {
+			return err
+		}
+		m.remove = append(m.remove, id)
+		return nil
+	}
+
+	if !strings.EqualFold(path, "members") {
+		// Other attributes, like displayName, are managed by realm admins.
+		return nil
+	}
+
+	var refs []*Ref
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &refs); err != nil {
+			return fmt.Errorf("members must be a list: %w", err)
+		}
+	}
+
+	switch strings.ToLower(op.Op) {
+	case "add":
+		return m.addRefs(refs)
+	case "replace":
+		m.replace = true
+		m.add = nil
+		m.remove = nil
+		return m.addRefs(refs)
+	case "remove":
+		// Removing without a value removes all members.
+		if refs == nil {
+			m.replace = true
+			m.add = nil
+			m.remove = nil
+			return nil
+		}
+		for _, ref := range refs {
+			id, err := parseMemberID(ref.Value)
+			if err != nil {
+				return err
+			}
+			m.remove = append(m.remove, id)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// addRefs records the references as members to add.
+func (m *memberChanges) addRefs(refs []*Ref) error {
+	for _, ref := range refs {
+		id, err := parseMemberID(ref.Value)
+		if err != nil {
+			return err
+		}
+		m.add = append(m.add, id)
+	}
+	return nil
+}
+
+// applyMemberChanges saves the changes to the group's members, rendering an
+// error and returning false if they cannot be saved. Since a membership has at
+// most one role, adding a user to a group removes them from their previous
+// group. Removed users remain in the realm without permissions. As in the web
+// interface, the API key must have all of the role's permissions.
+func (c *Controller) applyMemberChanges(w http.ResponseWriter, r *http.Request, realm *database.Realm, role *database.Role, changes *memberChanges) bool {
+	authApp := controller.AuthorizedAppFromContext(r.Context())
+
+	if _, err := rbac.CompileAndAuthorize(authApp.Permissions, rbac.Permissions(role.Permissions)); err != nil {
+		c.renderError(w, r, http.StatusForbidden, "", "API key does not have all of the permissions of group %q", role.Name)
+		return false
+	}
+
+	members, err := realm.ListSCIMGroupMembers(c.db, []uint{role.ID})
+	if err != nil {
+		c.renderInternalError(w, r, err)
+		return false
+	}
+
+	current := make(map[uint]struct{}, len(members))
+	for _, member := range members {
+		current[member.UserID] = struct{}{}
+	}
+
+	adding := make(map[uint]struct{}, len(changes.add))
+	for _, id := range changes.add {
+		adding[id] = struct{}{}
+	}
+
+	removing := make(map[uint]struct{}, len(changes.remove))
+	for _, id := range changes.remove {
+		removing[id] = struct{}{}
+	}
+	if changes.replace {
+		for id := range current {
+			if _, ok := adding[id]; !ok {
+				removing[id] = struct{}{}
+			}
+		}
+	}
+
+	// Validate all additions before changing anything.
+	toAdd := make([]*database.SCIMUser, 0, len(adding))
+	for _, id := range changes.add {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if _, ok := removing[id]; ok {
+			continue
+		}
+
+		scimUser, err := realm.FindSCIMUser(c.db, id)
+		if err != nil {
+			if database.IsNotFound(err) {
+				c.renderError(w, r, http.StatusBadRequest, errInvalidValue, "user %d not found", id)
+				return false
+			}
+			c.renderInternalError(w, r, err)
+			return false
+		}
+		if !scimUser.IsActive() {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidValue, "user %d is not active", id)
+			return false
+		}
+		toAdd = append(toAdd, scimUser)
+		current[id] = struct{}{}
+	}
+
+	for _, scimUser := range toAdd {
+		if err := scimUser.User.AddToRealmWithRole(c.db, realm, role, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return false
+		}
+	}
+
+	for id := range removing {
+		if _, ok := current[id]; !ok {
+			continue
+		}
+
+		scimUser, err := realm.FindSCIMUser(c.db, id)
+		if err != nil {
+			if database.IsNotFound(err) {
+				continue
+			}
+			c.renderInternalError(w, r, err)
+			return false
+		}
+		if err := scimUser.User.AddToRealm(c.db, realm, 0, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return false
+		}
+	}
+	return true
+}
+
+// findRole finds the role in the request path, rendering a 404 and returning
+// false if it does not exist.
+func (c *Controller) findRole(w http.ResponseWriter, r *http.Request, realm *database.Realm) (*database.Role, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		c.renderError(w, r, http.StatusNotFound, "", "group %q not found", id)
+		return nil, false
+	}
+
+	role, err := realm.FindRole(c.db, id)
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.renderError(w, r, http.StatusNotFound, "", "group %q not found", id)
+			return nil, false
+		}
+		c.renderInternalError(w, r, err)
+		return nil, false
+	}
+	return role, true
+}
+
+// renderGroup renders the role as a group.
+func (c *Controller) renderGroup(w http.ResponseWriter, r *http.Request, realm *database.Realm, role *database.Role) {
+	resources, err := c.groupResources(r, realm, []*database.Role{role})
+	if err != nil {
+		c.renderInternalError(w, r, err)
+		return
+	}
+	c.renderSCIM(w, r, http.StatusOK, resources[0])
+}
+
+// groupResources builds the SCIM resources for the roles, including their
+// provisioned members.
+func (c *Controller) groupResources(r *http.Request, realm *database.Realm, roles []*database.Role) ([]interface{}, error) {
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	members, err := realm.ListSCIMGroupMembers(c.db, roleIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+
+	membersByRoleID := make(map[uint][]*Ref, len(roles))
+	for _, member := range members {
+		id := strconv.FormatUint(uint64(member.UserID), 10)
+		membersByRoleID[member.RoleID] = append(membersByRoleID[member.RoleID], &Ref{
+			Value:   id,
+			Ref:     baseURL(r) + "/Users/" + id,
+			Display: member.Email,
+		})
+	}
+
+	resources := make([]interface{}, 0, len(roles))
+	for _, role := range roles {
+		id := strconv.FormatUint(uint64(role.ID), 10)
+		resources = append(resources, &Group{
+			Schemas:     []string{SchemaGroup},
+			ID:          id,
+			DisplayName: role.Name,
+			Members:     membersByRoleID[role.ID],
+			Meta: &Meta{
+				ResourceType: "Group",
+				Created:      timePtr(role.CreatedAt),
+				LastModified: timePtr(role.UpdatedAt),
+				Location:     baseURL(r) + "/Groups/" + id,
+			},
+		})
+	}
+	return resources, nil
+}
+
+// parseMemberID parses the SCIM ID of a member.
+func parseMemberID(s string) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid member %q", s)
+	}
+	return uint(id), nil
+}
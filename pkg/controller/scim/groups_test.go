@@ -0,0 +1,174 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/scim"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func TestHandleGroups(t *testing.T) {
+	t.Parallel()
+
+	db, realm, c, serve := testSetup(t, "SCIM groups", rbac.LegacyRealmAdmin)
+
+	role := &database.Role{RealmID: realm.ID, Name: "Tracer", Permissions: rbac.CodeIssue | rbac.CodeRead}
+	if err := db.SaveRole(role, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	roleID := fmt.Sprintf("%d", role.ID)
+
+	provision := func(tb testing.TB, email string, active bool) *database.User {
+		tb.Helper()
+
+		user := &database.User{Email: email, Name: email}
+		if err := db.SaveUser(user, database.SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		if err := db.SaveSCIMUser(&database.SCIMUser{RealmID: realm.ID, UserID: user.ID}, database.SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		if active {
+			if err := user.AddToRealm(db, realm, 0, database.SystemTest); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		return user
+	}
+
+	user := provision(t, "scim-member@example.com", true)
+	userID := fmt.Sprintf("%d", user.ID)
+	inactiveUser := provision(t, "scim-inactive@example.com", false)
+
+	members := func(tb testing.TB) []*scim.Ref {
+		tb.Helper()
+
+		w := serve(c.HandleShowGroup(), http.MethodGet, roleID, "")
+		if got, want := w.Code, http.StatusOK; got != want {
+			tb.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var group scim.Group
+		decode(tb, w, &group)
+		return group.Members
+	}
+
+	t.Run("list_filter", func(t *testing.T) {
+		w := serve(c.HandleListGroups(), http.MethodGet, "", `filter=displayName+eq+"tracer"`)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var list scim.ListResponse
+		decode(t, w, &list)
+		if got, want := list.TotalResults, uint64(1); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("add_member", func(t *testing.T) {
+		w := serve(c.HandlePatchGroup(), http.MethodPatch, roleID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(fmt.Sprintf(`[{"value":%q}]`, userID))}},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		membership, err := user.FindMembership(db, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if membership.RoleID == nil || *membership.RoleID != role.ID {
+			t.Errorf("expected role %d, got %v", role.ID, membership.RoleID)
+		}
+		if got, want := membership.Permissions, role.Permissions; got != want {
+			t.Errorf("expected permissions %d to be %d", got, want)
+		}
+
+		got := members(t)
+		if len(got) != 1 || got[0].Value != userID {
+			t.Errorf("expected member %s, got %v", userID, got)
+		}
+	})
+
+	t.Run("add_inactive_member", func(t *testing.T) {
+		w := serve(c.HandlePatchGroup(), http.MethodPatch, roleID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(fmt.Sprintf(`[{"value":"%d"}]`, inactiveUser.ID))}},
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("remove_member", func(t *testing.T) {
+		w := serve(c.HandlePatchGroup(), http.MethodPatch, roleID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "remove", Path: fmt.Sprintf(`members[value eq %q]`, userID)}},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		membership, err := user.FindMembership(db, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if membership.RoleID != nil {
+			t.Errorf("expected no role, got %d", *membership.RoleID)
+		}
+		if got, want := membership.Permissions, rbac.Permission(0); got != want {
+			t.Errorf("expected permissions %d to be %d", got, want)
+		}
+
+		if got := members(t); len(got) != 0 {
+			t.Errorf("expected no members, got %v", got)
+		}
+	})
+
+	t.Run("replace_members", func(t *testing.T) {
+		w := serve(c.HandleReplaceGroup(), http.MethodPut, roleID, &scim.Group{
+			Schemas:     []string{scim.SchemaGroup},
+			DisplayName: "Ignored",
+			Members:     []*scim.Ref{{Value: userID}},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var group scim.Group
+		decode(t, w, &group)
+		if got, want := group.DisplayName, role.Name; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if len(group.Members) != 1 || group.Members[0].Value != userID {
+			t.Errorf("expected member %s, got %v", userID, group.Members)
+		}
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		w := serve(c.HandleShowGroup(), http.MethodGet, "0", "")
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,272 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scim implements a SCIM 2.0 (RFC 7643, RFC 7644) service provider on
+// the admin API, so a realm's identity management system can provision users.
+// SCIM users are realm members; SCIM groups are realm roles.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+const (
+	// ContentType is the SCIM media type.
+	ContentType = "application/scim+json"
+
+	// BasePath is the path of the SCIM service provider on the admin API.
+	BasePath = "/api/scim/v2"
+
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// maxCount is the maximum number of resources returned in a list.
+	maxCount = 100
+
+	// maxBodyBytes is the maximum size of a request body.
+	maxBodyBytes = 64_000
+)
+
+// SCIM error types, from RFC 7644 section 3.12.
+const (
+	errInvalidFilter = "invalidFilter"
+	errInvalidSyntax = "invalidSyntax"
+	errInvalidPath   = "invalidPath"
+	errInvalidValue  = "invalidValue"
+	errMutability    = "mutability"
+	errUniqueness    = "uniqueness"
+)
+
+type Controller struct {
+	db *database.Database
+	h  *render.Renderer
+}
+
+func New(db *database.Database, h *render.Renderer) *Controller {
+	return &Controller{
+		db: db,
+		h:  h,
+	}
+}
+
+// User is a SCIM user resource.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []*Email `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Groups      []*Ref   `json:"groups,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Name is a SCIM user's name.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is a SCIM user's email address.
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Group is a SCIM group resource.
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []*Ref   `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Ref is a reference to another resource, such as a group member.
+type Ref struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Meta is the metadata of a resource.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// ListResponse is a page of resources.
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults uint64        `json:"totalResults"`
+	StartIndex   uint64        `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// PatchRequest is a request to modify a resource.
+type PatchRequest struct {
+	Schemas    []string          `json:"schemas"`
+	Operations []*PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single modification of a resource.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is a SCIM error response.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// renderSCIM renders the resource as SCIM JSON.
+func (c *Controller) renderSCIM(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger := logging.FromContext(r.Context()).Named("scim")
+		logger.Errorw("failed to marshal response", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
+// renderError renders a SCIM error response.
+func (c *Controller) renderError(w http.ResponseWriter, r *http.Request, code int, scimType, detail string, args ...interface{}) {
+	if len(args) > 0 {
+		detail = fmt.Sprintf(detail, args...)
+	}
+
+	c.renderSCIM(w, r, code, &Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(code),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
+
+// renderInternalError logs the error and renders a generic SCIM error, so
+// internal details are not leaked to the client.
+func (c *Controller) renderInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := logging.FromContext(r.Context()).Named("scim")
+	logger.Errorw("internal error", "error", err)
+	c.renderError(w, r, http.StatusInternalServerError, "", "internal server error")
+}
+
+// bindSCIM decodes the SCIM request body. Unlike controller.BindJSON, unknown
+// attributes are allowed, since identity management systems send many
+// attributes this server does not store.
+func bindSCIM(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	t := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(t, ContentType) && !controller.IsJSONContentType(r) {
+		return fmt.Errorf("content-type is not %s or application/json", ContentType)
+	}
+
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("body must not be empty")
+		}
+		return fmt.Errorf("malformed json: %w", err)
+	}
+	return nil
+}
+
+// filterRe matches the only filters supported: a single equality comparison.
+var filterRe = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter parses a filter of the form `attribute eq "value"`. The
+// attribute is returned in lowercase, since SCIM attribute names are
+// case-insensitive.
+func parseFilter(s string) (string, string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", "", nil
+	}
+
+	matches := filterRe.FindStringSubmatch(s)
+	if matches == nil {
+		return "", "", fmt.Errorf(`unsupported filter %q, only 'attribute eq "value"' is supported`, s)
+	}
+
+	value, err := strconv.Unquote(`"` + matches[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value: %w", err)
+	}
+	return strings.ToLower(matches[1]), value, nil
+}
+
+// parsePage parses the 1-based startIndex and count query parameters. Invalid
+// values are replaced with defaults, as RFC 7644 requires.
+func parsePage(r *http.Request) (uint64, uint64) {
+	startIndex := uint64(1)
+	if v, err := strconv.ParseInt(r.FormValue("startIndex"), 10, 64); err == nil && v > 1 {
+		startIndex = uint64(v)
+	}
+
+	count := uint64(maxCount)
+	if v, err := strconv.ParseInt(r.FormValue("count"), 10, 64); err == nil {
+		switch {
+		case v < 0:
+			count = 0
+		case v < maxCount:
+			count = uint64(v)
+		}
+	}
+	return startIndex, count
+}
+
+// baseURL returns the URL of the SCIM service provider.
+func baseURL(r *http.Request) string {
+	return controller.RealHostFromRequest(r) + BasePath
+}
+
+// timePtr returns a pointer to the time in UTC.
+func timePtr(t time.Time) *time.Time {
+	t = t.UTC()
+	return &t
+}
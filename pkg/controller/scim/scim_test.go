@@ -0,0 +1,322 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		filter string
+		attr   string
+		value  string
+		err    bool
+	}{
+		{
+			name:   "empty",
+			filter: "",
+		},
+		{
+			name:   "user_name",
+			filter: `userName eq "jane@example.com"`,
+			attr:   "username",
+			value:  "jane@example.com",
+		},
+		{
+			name:   "case_insensitive_operator",
+			filter: `externalId EQ "abc"`,
+			attr:   "externalid",
+			value:  "abc",
+		},
+		{
+			name:   "escaped_quote",
+			filter: `displayName eq "Team \"A\""`,
+			attr:   "displayname",
+			value:  `Team "A"`,
+		},
+		{
+			name:   "unsupported_operator",
+			filter: `userName co "jane"`,
+			err:    true,
+		},
+		{
+			name:   "compound",
+			filter: `userName eq "a" and externalId eq "b"`,
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			attr, value, err := parseFilter(tc.filter)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if got, want := attr, tc.attr; got != want {
+				t.Errorf("expected attr %q to be %q", got, want)
+			}
+			if got, want := value, tc.value; got != want {
+				t.Errorf("expected value %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		query      string
+		startIndex uint64
+		count      uint64
+	}{
+		{
+			name:       "defaults",
+			query:      "",
+			startIndex: 1,
+			count:      maxCount,
+		},
+		{
+			name:       "values",
+			query:      "startIndex=11&count=10",
+			startIndex: 11,
+			count:      10,
+		},
+		{
+			name:       "invalid",
+			query:      "startIndex=-5&count=abc",
+			startIndex: 1,
+			count:      maxCount,
+		},
+		{
+			name:       "count_too_large",
+			query:      "count=1000",
+			startIndex: 1,
+			count:      maxCount,
+		},
+		{
+			name:       "count_negative",
+			query:      "count=-1",
+			startIndex: 1,
+			count:      0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("GET", "/Users?"+tc.query, nil)
+			startIndex, count := parsePage(r)
+			if got, want := startIndex, tc.startIndex; got != want {
+				t.Errorf("expected startIndex %d to be %d", got, want)
+			}
+			if got, want := count, tc.count; got != want {
+				t.Errorf("expected count %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUserChanges_Apply(t *testing.T) {
+	t.Parallel()
+
+	ptrString := func(s string) *string { return &s }
+	ptrBool := func(b bool) *bool { return &b }
+
+	cases := []struct {
+		name string
+		ops  []*PatchOperation
+		want *userChanges
+		err  bool
+	}{
+		{
+			name: "active_bool",
+			ops:  []*PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`false`)}},
+			want: &userChanges{active: ptrBool(false)},
+		},
+		{
+			name: "active_string",
+			ops:  []*PatchOperation{{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)}},
+			want: &userChanges{active: ptrBool(false)},
+		},
+		{
+			name: "no_path",
+			ops: []*PatchOperation{{Op: "replace", Value: json.RawMessage(`{
+				"active": true,
+				"externalId": "abc",
+				"name.givenName": "Jane",
+				"title": "ignored"
+			}`)}},
+			want: &userChanges{
+				active:     ptrBool(true),
+				externalID: ptrString("abc"),
+				givenName:  ptrString("Jane"),
+			},
+		},
+		{
+			name: "name_object",
+			ops:  []*PatchOperation{{Op: "add", Path: "name", Value: json.RawMessage(`{"givenName":"Jane","familyName":"Doe"}`)}},
+			want: &userChanges{name: ptrString("Jane Doe")},
+		},
+		{
+			name: "remove_external_id",
+			ops:  []*PatchOperation{{Op: "remove", Path: "externalId"}},
+			want: &userChanges{externalID: ptrString("")},
+		},
+		{
+			name: "remove_active",
+			ops:  []*PatchOperation{{Op: "remove", Path: "active"}},
+			err:  true,
+		},
+		{
+			name: "invalid_active",
+			ops:  []*PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`"maybe"`)}},
+			err:  true,
+		},
+		{
+			name: "unsupported_op",
+			ops:  []*PatchOperation{{Op: "move", Path: "active"}},
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := new(userChanges)
+			var err error
+			for _, op := range tc.ops {
+				if err = got.apply(op); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(userChanges{})); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemberChanges_Apply(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		ops  []*PatchOperation
+		want *memberChanges
+		err  bool
+	}{
+		{
+			name: "add",
+			ops:  []*PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"1"},{"value":"2"}]`)}},
+			want: &memberChanges{add: []uint{1, 2}},
+		},
+		{
+			name: "remove_filter",
+			ops:  []*PatchOperation{{Op: "remove", Path: `members[value eq "3"]`}},
+			want: &memberChanges{remove: []uint{3}},
+		},
+		{
+			name: "remove_values",
+			ops:  []*PatchOperation{{Op: "Remove", Path: "members", Value: json.RawMessage(`[{"value":"4"}]`)}},
+			want: &memberChanges{remove: []uint{4}},
+		},
+		{
+			name: "remove_all",
+			ops:  []*PatchOperation{{Op: "remove", Path: "members"}},
+			want: &memberChanges{replace: true},
+		},
+		{
+			name: "replace",
+			ops: []*PatchOperation{
+				{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"1"}]`)},
+				{Op: "replace", Path: "members", Value: json.RawMessage(`[{"value":"5"}]`)},
+			},
+			want: &memberChanges{replace: true, add: []uint{5}},
+		},
+		{
+			name: "no_path",
+			ops:  []*PatchOperation{{Op: "replace", Value: json.RawMessage(`{"displayName":"ignored","members":[{"value":"6"}]}`)}},
+			want: &memberChanges{replace: true, add: []uint{6}},
+		},
+		{
+			name: "display_name_ignored",
+			ops:  []*PatchOperation{{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Admins"`)}},
+			want: &memberChanges{},
+		},
+		{
+			name: "invalid_member",
+			ops:  []*PatchOperation{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"abc"}]`)}},
+			err:  true,
+		},
+		{
+			name: "add_filter",
+			ops:  []*PatchOperation{{Op: "add", Path: `members[value eq "3"]`}},
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := new(memberChanges)
+			var err error
+			for _, op := range tc.ops {
+				if err = got.apply(op); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(memberChanges{})); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
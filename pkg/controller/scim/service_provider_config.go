@@ -0,0 +1,82 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"net/http"
+)
+
+// supported is a SCIM service provider feature.
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+// HandleServiceProviderConfig describes the SCIM features supported by the
+// server.
+func (c *Controller) HandleServiceProviderConfig() http.Handler {
+	type filter struct {
+		Supported  bool `json:"supported"`
+		MaxResults int  `json:"maxResults"`
+	}
+
+	type bulk struct {
+		Supported      bool `json:"supported"`
+		MaxOperations  int  `json:"maxOperations"`
+		MaxPayloadSize int  `json:"maxPayloadSize"`
+	}
+
+	type authenticationScheme struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Primary     bool   `json:"primary"`
+	}
+
+	type serviceProviderConfig struct {
+		Schemas               []string                `json:"schemas"`
+		Patch                 supported               `json:"patch"`
+		Bulk                  bulk                    `json:"bulk"`
+		Filter                filter                  `json:"filter"`
+		ChangePassword        supported               `json:"changePassword"`
+		Sort                  supported               `json:"sort"`
+		ETag                  supported               `json:"etag"`
+		AuthenticationSchemes []*authenticationScheme `json:"authenticationSchemes"`
+		Meta                  *Meta                   `json:"meta"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := c.currentRealm(w, r); !ok {
+			return
+		}
+
+		c.renderSCIM(w, r, http.StatusOK, &serviceProviderConfig{
+			Schemas: []string{SchemaServiceProviderConfig},
+			Patch:   supported{Supported: true},
+			Filter:  filter{Supported: true, MaxResults: maxCount},
+			AuthenticationSchemes: []*authenticationScheme{
+				{
+					Type:        "oauthbearertoken",
+					Name:        "Admin API key",
+					Description: "An admin API key, sent as a bearer token or in the X-API-Key header.",
+					Primary:     true,
+				},
+			},
+			Meta: &Meta{
+				ResourceType: "ServiceProviderConfig",
+				Location:     baseURL(r) + "/ServiceProviderConfig",
+			},
+		})
+	})
+}
@@ -0,0 +1,628 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleListUsers lists the users provisioned in the realm. The userName and
+// externalId filters are supported.
+func (c *Controller) HandleListUsers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		attr, value, err := parseFilter(r.FormValue("filter"))
+		if err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidFilter, err.Error())
+			return
+		}
+
+		var scopes []database.Scope
+		switch attr {
+		case "":
+		case "username":
+			scopes = append(scopes, database.WithSCIMUserName(value))
+		case "externalid":
+			scopes = append(scopes, database.WithSCIMExternalID(value))
+		default:
+			c.renderError(w, r, http.StatusBadRequest, errInvalidFilter, "filtering on %q is not supported", attr)
+			return
+		}
+
+		startIndex, count := parsePage(r)
+		scimUsers, total, err := realm.ListSCIMUsers(c.db, startIndex-1, count, scopes...)
+		if err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		resources := make([]interface{}, 0, len(scimUsers))
+		for _, s := range scimUsers {
+			resources = append(resources, userResource(r, s))
+		}
+
+		c.renderSCIM(w, r, http.StatusOK, &ListResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	})
+}
+
+// HandleShowUser shows a provisioned user.
+func (c *Controller) HandleShowUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		scimUser, ok := c.findSCIMUser(w, r, realm)
+		if !ok {
+			return
+		}
+
+		c.renderSCIM(w, r, http.StatusOK, userResource(r, scimUser))
+	})
+}
+
+// HandleCreateUser provisions a user in the realm. If a user with the email
+// address already exists (for example, because they are a member of another
+// realm), that user is provisioned instead of creating a new one. Active users
+// are added to the realm without permissions; permissions are granted by adding
+// the user to a group.
+func (c *Controller) HandleCreateUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, authApp, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		var request User
+		if err := bindSCIM(w, r, &request); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		email := request.email()
+		if email == "" {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidValue, "userName is required")
+			return
+		}
+
+		user, err := c.db.FindUserByEmail(email)
+		if err != nil && !database.IsNotFound(err) {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		if user != nil && user.ID != 0 {
+			if _, err := realm.FindSCIMUser(c.db, user.ID); err == nil {
+				c.renderError(w, r, http.StatusConflict, errUniqueness, "user %q is already provisioned", email)
+				return
+			} else if !database.IsNotFound(err) {
+				c.renderInternalError(w, r, err)
+				return
+			}
+		} else {
+			user = &database.User{
+				Email: email,
+				Name:  request.name(),
+			}
+			if err := c.db.SaveUser(user, authApp); err != nil {
+				if database.IsValidationError(err) {
+					c.renderError(w, r, http.StatusBadRequest, errInvalidValue, strings.Join(user.ErrorMessages(), ", "))
+					return
+				}
+				c.renderInternalError(w, r, err)
+				return
+			}
+		}
+
+		scimUser := &database.SCIMUser{
+			RealmID:    realm.ID,
+			UserID:     user.ID,
+			User:       user,
+			ExternalID: request.ExternalID,
+		}
+		if err := c.db.SaveSCIMUser(scimUser, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.renderError(w, r, http.StatusConflict, errUniqueness, strings.Join(scimUser.ErrorMessages(), ", "))
+				return
+			}
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		active := request.Active == nil || *request.Active
+		if err := c.setActive(realm, user, active, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		scimUser, err = realm.FindSCIMUser(c.db, user.ID)
+		if err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		resource := userResource(r, scimUser)
+		w.Header().Set("Location", resource.Meta.Location)
+		c.renderSCIM(w, r, http.StatusCreated, resource)
+	})
+}
+
+// HandleReplaceUser replaces a provisioned user's attributes. The userName
+// cannot be changed.
+func (c *Controller) HandleReplaceUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		scimUser, ok := c.findSCIMUser(w, r, realm)
+		if !ok {
+			return
+		}
+
+		var request User
+		if err := bindSCIM(w, r, &request); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		active := request.Active == nil || *request.Active
+		changes := &userChanges{
+			externalID: &request.ExternalID,
+			active:     &active,
+		}
+		if email := request.email(); email != "" {
+			changes.userName = &email
+		}
+		if name := request.name(); name != "" && name != request.email() {
+			changes.name = &name
+		}
+
+		c.applyUserChanges(w, r, realm, scimUser, changes)
+	})
+}
+
+// HandlePatchUser modifies a provisioned user's attributes. Supported paths are
+// active, externalId, displayName, and the name attributes; other attributes
+// are ignored.
+func (c *Controller) HandlePatchUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, _, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		scimUser, ok := c.findSCIMUser(w, r, realm)
+		if !ok {
+			return
+		}
+
+		var request PatchRequest
+		if err := bindSCIM(w, r, &request); err != nil {
+			c.renderError(w, r, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		changes := new(userChanges)
+		for _, op := range request.Operations {
+			if err := changes.apply(op); err != nil {
+				c.renderError(w, r, http.StatusBadRequest, errInvalidValue, err.Error())
+				return
+			}
+		}
+
+		c.applyUserChanges(w, r, realm, scimUser, changes)
+	})
+}
+
+// HandleDeleteUser removes a provisioned user from the realm. The user itself
+// is not deleted, since they may be a member of other realms.
+func (c *Controller) HandleDeleteUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realm, authApp, ok := c.currentRealm(w, r)
+		if !ok {
+			return
+		}
+
+		scimUser, ok := c.findSCIMUser(w, r, realm)
+		if !ok {
+			return
+		}
+
+		if scimUser.Membership != nil {
+			if err := scimUser.User.DeleteFromRealm(c.db, realm, authApp); err != nil {
+				c.renderInternalError(w, r, err)
+				return
+			}
+		}
+
+		if err := c.db.DeleteSCIMUser(scimUser, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// userChanges are the changes to apply to a provisioned user. Nil fields are
+// unchanged.
+type userChanges struct {
+	userName   *string
+	name       *string
+	givenName  *string
+	familyName *string
+	externalID *string
+	active     *bool
+}
+
+// apply records the changes in the patch operation.
+func (u *userChanges) apply(op *PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		empty := ""
+		switch strings.ToLower(op.Path) {
+		case "externalid":
+			u.externalID = &empty
+		case "active":
+			return fmt.Errorf("active cannot be removed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+
+	// Without a path, the value is an object of attributes to change.
+	if op.Path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("value must be an object when path is omitted: %w", err)
+		}
+		for k, v := range attrs {
+			if err := u.apply(&PatchOperation{Op: op.Op, Path: k, Value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch strings.ToLower(op.Path) {
+	case "username":
+		u.userName, err = stringValue(op.Value)
+	case "externalid":
+		u.externalID, err = stringValue(op.Value)
+	case "displayname", "name.formatted":
+		u.name, err = stringValue(op.Value)
+	case "name.givenname":
+		u.givenName, err = stringValue(op.Value)
+	case "name.familyname":
+		u.familyName, err = stringValue(op.Value)
+	case "name":
+		var name Name
+		if err := json.Unmarshal(op.Value, &name); err != nil {
+			return fmt.Errorf("invalid name: %w", err)
+		}
+		if v := name.formatted(); v != "" {
+			u.name = &v
+		}
+	case "active":
+		u.active, err = boolValue(op.Value)
+	}
+	return err
+}
+
+// applyUserChanges saves the changes to the provisioned user and renders the
+// updated user.
+func (c *Controller) applyUserChanges(w http.ResponseWriter, r *http.Request, realm *database.Realm, scimUser *database.SCIMUser, changes *userChanges) {
+	authApp := controller.AuthorizedAppFromContext(r.Context())
+	user := scimUser.User
+
+	if v := changes.userName; v != nil && !strings.EqualFold(project.TrimSpace(*v), user.Email) {
+		c.renderError(w, r, http.StatusBadRequest, errMutability, "userName cannot be changed")
+		return
+	}
+
+	name := changes.name
+	if name == nil && (changes.givenName != nil || changes.familyName != nil) {
+		given, family := splitName(user.Name)
+		if v := changes.givenName; v != nil {
+			given = *v
+		}
+		if v := changes.familyName; v != nil {
+			family = *v
+		}
+		v := (&Name{GivenName: given, FamilyName: family}).formatted()
+		name = &v
+	}
+
+	if name != nil && *name != user.Name {
+		// Users are shared across realms, so only users who belong to no other
+		// realm can be renamed.
+		if user.SystemAdmin {
+			c.renderError(w, r, http.StatusConflict, errMutability, "name cannot be changed for system admins")
+			return
+		}
+		other, err := user.HasOtherMemberships(c.db, realm.ID)
+		if err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+		if other {
+			c.renderError(w, r, http.StatusConflict, errMutability, "name cannot be changed for members of other realms")
+			return
+		}
+
+		user.Name = *name
+		if err := c.db.SaveUser(user, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.renderError(w, r, http.StatusBadRequest, errInvalidValue, strings.Join(user.ErrorMessages(), ", "))
+				return
+			}
+			c.renderInternalError(w, r, err)
+			return
+		}
+	}
+
+	if v := changes.externalID; v != nil && *v != scimUser.ExternalID {
+		scimUser.ExternalID = *v
+		if err := c.db.SaveSCIMUser(scimUser, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+	}
+
+	if v := changes.active; v != nil && *v != scimUser.IsActive() {
+		if err := c.setActive(realm, user, *v, authApp); err != nil {
+			c.renderInternalError(w, r, err)
+			return
+		}
+	}
+
+	scimUser, err := realm.FindSCIMUser(c.db, user.ID)
+	if err != nil {
+		c.renderInternalError(w, r, err)
+		return
+	}
+	c.renderSCIM(w, r, http.StatusOK, userResource(r, scimUser))
+}
+
+// setActive activates or deactivates the user in the realm. Active users are
+// members of the realm. Activating an existing member leaves their permissions
+// unchanged, but clears the membership's expiry if it has expired. Deactivating
+// removes the membership.
+func (c *Controller) setActive(realm *database.Realm, user *database.User, active bool, actor database.Auditable) error {
+	membership, err := user.FindMembership(c.db, realm.ID)
+	if err != nil && !database.IsNotFound(err) {
+		return fmt.Errorf("failed to find membership: %w", err)
+	}
+	if database.IsNotFound(err) {
+		membership = nil
+	}
+
+	if !active {
+		if membership == nil {
+			return nil
+		}
+		if err := user.DeleteFromRealm(c.db, realm, actor); err != nil {
+			return fmt.Errorf("failed to remove user from realm: %w", err)
+		}
+		return nil
+	}
+
+	if membership == nil {
+		if err := user.AddToRealm(c.db, realm, 0, actor); err != nil {
+			return fmt.Errorf("failed to add user to realm: %w", err)
+		}
+		return nil
+	}
+
+	if membership.IsExpired() {
+		if err := user.UpdateMembershipExpiry(c.db, realm, nil, actor); err != nil {
+			return fmt.Errorf("failed to clear membership expiry: %w", err)
+		}
+	}
+	return nil
+}
+
+// currentRealm returns the realm and authorized app of the request, rendering
+// an error and returning false if they are missing or if the API key does not
+// have permission to read (for GET requests) or manage users.
+func (c *Controller) currentRealm(w http.ResponseWriter, r *http.Request) (*database.Realm, *database.AuthorizedApp, bool) {
+	ctx := r.Context()
+
+	authApp := controller.AuthorizedAppFromContext(ctx)
+	realm := controller.RealmFromContext(ctx)
+	if authApp == nil || realm == nil {
+		controller.MissingAuthorizedApp(w, r, c.h)
+		return nil, nil, false
+	}
+
+	permission := rbac.UserWrite
+	if r.Method == http.MethodGet {
+		permission = rbac.UserRead
+	}
+	if !authApp.Can(permission) {
+		c.renderError(w, r, http.StatusForbidden, "", "API key does not have the %s permission", permission)
+		return nil, nil, false
+	}
+	return realm, authApp, true
+}
+
+// findSCIMUser finds the provisioned user in the request path, rendering a 404
+// and returning false if they do not exist.
+func (c *Controller) findSCIMUser(w http.ResponseWriter, r *http.Request, realm *database.Realm) (*database.SCIMUser, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		c.renderError(w, r, http.StatusNotFound, "", "user %q not found", id)
+		return nil, false
+	}
+
+	scimUser, err := realm.FindSCIMUser(c.db, id)
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.renderError(w, r, http.StatusNotFound, "", "user %q not found", id)
+			return nil, false
+		}
+		c.renderInternalError(w, r, err)
+		return nil, false
+	}
+	return scimUser, true
+}
+
+// userResource builds the SCIM resource for the provisioned user.
+func userResource(r *http.Request, s *database.SCIMUser) *User {
+	id := strconv.FormatUint(uint64(s.UserID), 10)
+	active := s.IsActive()
+
+	u := &User{
+		Schemas:    []string{SchemaUser},
+		ID:         id,
+		ExternalID: s.ExternalID,
+		Active:     &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      timePtr(s.CreatedAt),
+			LastModified: timePtr(s.UpdatedAt),
+			Location:     baseURL(r) + "/Users/" + id,
+		},
+	}
+
+	if user := s.User; user != nil {
+		given, family := splitName(user.Name)
+		u.UserName = user.Email
+		u.DisplayName = user.Name
+		u.Name = &Name{
+			Formatted:  user.Name,
+			GivenName:  given,
+			FamilyName: family,
+		}
+		u.Emails = []*Email{{Value: user.Email, Type: "work", Primary: true}}
+		if user.UpdatedAt.After(s.UpdatedAt) {
+			u.Meta.LastModified = timePtr(user.UpdatedAt)
+		}
+	}
+
+	if active && s.Membership.Role != nil {
+		roleID := strconv.FormatUint(uint64(s.Membership.Role.ID), 10)
+		u.Groups = []*Ref{{
+			Value:   roleID,
+			Ref:     baseURL(r) + "/Groups/" + roleID,
+			Display: s.Membership.Role.Name,
+		}}
+	}
+	return u
+}
+
+// email returns the user's email address: the userName, or the primary email
+// if the userName is not an email address.
+func (u *User) email() string {
+	userName := project.TrimSpace(u.UserName)
+	if strings.Contains(userName, "@") {
+		return userName
+	}
+
+	for _, e := range u.Emails {
+		if e.Primary {
+			return project.TrimSpace(e.Value)
+		}
+	}
+	if len(u.Emails) > 0 {
+		return project.TrimSpace(u.Emails[0].Value)
+	}
+	return userName
+}
+
+// name returns the user's display name, falling back to the email address.
+func (u *User) name() string {
+	if u.Name != nil {
+		if v := u.Name.formatted(); v != "" {
+			return v
+		}
+	}
+	if v := project.TrimSpace(u.DisplayName); v != "" {
+		return v
+	}
+	return u.email()
+}
+
+// formatted returns the formatted name, or the given and family names.
+func (n *Name) formatted() string {
+	if v := project.TrimSpace(n.Formatted); v != "" {
+		return v
+	}
+	return project.TrimSpace(project.TrimSpace(n.GivenName) + " " + project.TrimSpace(n.FamilyName))
+}
+
+// splitName splits a name into given and family names at the last space.
+func splitName(name string) (string, string) {
+	name = project.TrimSpace(name)
+	if i := strings.LastIndex(name, " "); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// stringValue parses a JSON string.
+func stringValue(b json.RawMessage) (*string, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("value must be a string: %w", err)
+	}
+	return &s, nil
+}
+
+// boolValue parses a JSON boolean. Some identity management systems send
+// booleans as strings, so "true" and "false" are also accepted.
+func boolValue(b json.RawMessage) (*bool, error) {
+	var v bool
+	if err := json.Unmarshal(b, &v); err == nil {
+		return &v, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("value must be a boolean")
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, fmt.Errorf("value must be a boolean")
+	}
+	return &v, nil
+}
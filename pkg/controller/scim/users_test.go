@@ -0,0 +1,417 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/scim"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+
+	"github.com/gorilla/mux"
+)
+
+var testDatabaseInstance *database.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = database.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+// testSetup creates a realm with an admin API key with the given permissions
+// and returns a function which serves SCIM requests as that API key.
+func testSetup(tb testing.TB, name string, permissions rbac.Permission) (*database.Database, *database.Realm, *scim.Controller, func(http.Handler, string, string, interface{}) *httptest.ResponseRecorder) {
+	tb.Helper()
+
+	harness := envstest.NewServerConfig(tb, testDatabaseInstance)
+	db := harness.Database
+
+	realm := database.NewRealmWithDefaults(name)
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	authApp := &database.AuthorizedApp{
+		Name:        "Provisioner",
+		APIKeyType:  database.APIKeyTypeAdmin,
+		Permissions: permissions,
+	}
+	if _, err := realm.CreateAuthorizedApp(db, authApp, database.SystemTest); err != nil {
+		tb.Fatal(err)
+	}
+
+	serve := func(handler http.Handler, meth, id string, body interface{}) *httptest.ResponseRecorder {
+		ctx := project.TestContext(tb)
+		ctx = controller.WithAuthorizedApp(ctx, authApp)
+		ctx = controller.WithRealm(ctx, realm)
+
+		w, r := buildRequest(ctx, tb, meth, body)
+		if id != "" {
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+		}
+		harness.WithCommonMiddlewares(handler).ServeHTTP(w, r)
+		return w
+	}
+
+	return db, realm, scim.New(db, harness.Renderer), serve
+}
+
+// buildRequest builds a SCIM request. A string body is sent as the query.
+func buildRequest(ctx context.Context, tb testing.TB, meth string, body interface{}) (*httptest.ResponseRecorder, *http.Request) {
+	tb.Helper()
+
+	if query, ok := body.(string); ok {
+		r := httptest.NewRequest(meth, "/?"+query, nil).Clone(ctx)
+		r.Header.Set("Accept", scim.ContentType)
+		return httptest.NewRecorder(), r
+	}
+
+	w, r := envstest.BuildJSONRequest(ctx, tb, meth, "/", body)
+	r.Header.Set("Content-Type", scim.ContentType)
+	return w, r
+}
+
+// decode decodes the SCIM response body.
+func decode(tb testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	tb.Helper()
+
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		tb.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestHandleUsers(t *testing.T) {
+	t.Parallel()
+
+	db, realm, c, serve := testSetup(t, "SCIM users", rbac.LegacyRealmAdmin)
+
+	active := true
+	inactive := false
+
+	// Provision a user.
+	w := serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+		Schemas:    []string{scim.SchemaUser},
+		UserName:   "scim-user@example.com",
+		ExternalID: "ext-1",
+		Name:       &scim.Name{GivenName: "Scim", FamilyName: "User"},
+	})
+	if got, want := w.Code, http.StatusCreated; got != want {
+		t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Type"), scim.ContentType; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	var created scim.User
+	decode(t, w, &created)
+	if got, want := created.UserName, "scim-user@example.com"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := created.DisplayName, "Scim User"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if created.Active == nil || !*created.Active {
+		t.Errorf("expected user to be active")
+	}
+	if got, want := w.Header().Get("Location"), "/Users/"+created.ID; !strings.HasSuffix(got, want) {
+		t.Errorf("expected %q to end with %q", got, want)
+	}
+
+	user, err := db.FindUserByEmail("scim-user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	membership, err := user.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := membership.Permissions, rbac.Permission(0); got != want {
+		t.Errorf("expected permissions %d to be %d", got, want)
+	}
+
+	t.Run("create_duplicate", func(t *testing.T) {
+		w := serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+			Schemas:  []string{scim.SchemaUser},
+			UserName: "scim-user@example.com",
+		})
+		if got, want := w.Code, http.StatusConflict; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("create_missing_user_name", func(t *testing.T) {
+		w := serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+			Schemas: []string{scim.SchemaUser},
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("list_filter", func(t *testing.T) {
+		w := serve(c.HandleListUsers(), http.MethodGet, "", `filter=externalId+eq+"ext-1"`)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var list scim.ListResponse
+		decode(t, w, &list)
+		if got, want := list.TotalResults, uint64(1); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		w = serve(c.HandleListUsers(), http.MethodGet, "", `filter=userName+eq+"nobody@example.com"`)
+		decode(t, w, &list)
+		if got, want := list.TotalResults, uint64(0); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("list_invalid_filter", func(t *testing.T) {
+		w := serve(c.HandleListUsers(), http.MethodGet, "", `filter=title+eq+"boss"`)
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("show_not_found", func(t *testing.T) {
+		w := serve(c.HandleShowUser(), http.MethodGet, "0", "")
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("patch_active", func(t *testing.T) {
+		w := serve(c.HandlePatchUser(), http.MethodPatch, created.ID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`false`)}},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if _, err := user.FindMembership(db, realm.ID); !database.IsNotFound(err) {
+			t.Errorf("expected membership to be removed, got %v", err)
+		}
+
+		w = serve(c.HandlePatchUser(), http.MethodPatch, created.ID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`"True"`)}},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		if _, err := user.FindMembership(db, realm.ID); err != nil {
+			t.Errorf("expected membership to be restored, got %v", err)
+		}
+	})
+
+	t.Run("replace_user_name", func(t *testing.T) {
+		w := serve(c.HandleReplaceUser(), http.MethodPut, created.ID, &scim.User{
+			Schemas:  []string{scim.SchemaUser},
+			UserName: "someone-else@example.com",
+			Active:   &active,
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		w := serve(c.HandleReplaceUser(), http.MethodPut, created.ID, &scim.User{
+			Schemas:    []string{scim.SchemaUser},
+			UserName:   "scim-user@example.com",
+			ExternalID: "ext-2",
+			Name:       &scim.Name{Formatted: "Renamed User"},
+			Active:     &active,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var replaced scim.User
+		decode(t, w, &replaced)
+		if got, want := replaced.DisplayName, "Renamed User"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := replaced.ExternalID, "ext-2"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("create_inactive", func(t *testing.T) {
+		w := serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+			Schemas:  []string{scim.SchemaUser},
+			UserName: "inactive@example.com",
+			Active:   &inactive,
+		})
+		if got, want := w.Code, http.StatusCreated; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		inactiveUser, err := db.FindUserByEmail("inactive@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inactiveUser.FindMembership(db, realm.ID); !database.IsNotFound(err) {
+			t.Errorf("expected no membership, got %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := serve(c.HandleDeleteUser(), http.MethodDelete, created.ID, nil)
+		if got, want := w.Code, http.StatusNoContent; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		if _, err := realm.FindSCIMUser(db, user.ID); !database.IsNotFound(err) {
+			t.Errorf("expected scim user to be deleted, got %v", err)
+		}
+		if _, err := user.FindMembership(db, realm.ID); !database.IsNotFound(err) {
+			t.Errorf("expected membership to be removed, got %v", err)
+		}
+		if _, err := db.FindUser(user.ID); err != nil {
+			t.Errorf("expected user to remain, got %v", err)
+		}
+
+		w = serve(c.HandleShowUser(), http.MethodGet, created.ID, "")
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+}
+
+func TestHandleUsers_OtherRealmMember(t *testing.T) {
+	t.Parallel()
+
+	db, _, c, serve := testSetup(t, "SCIM shared users", rbac.LegacyRealmAdmin)
+
+	// The user is already a member of another realm.
+	otherRealm := database.NewRealmWithDefaults("SCIM other realm")
+	if err := db.SaveRealm(otherRealm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	user := &database.User{
+		Email: "scim-shared@example.com",
+		Name:  "Shared User",
+	}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.AddToRealm(db, otherRealm, rbac.CodeIssue, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		UserName: "scim-shared@example.com",
+		Name:     &scim.Name{Formatted: "Shared User"},
+	})
+	if got, want := w.Code, http.StatusCreated; got != want {
+		t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+	var created scim.User
+	decode(t, w, &created)
+
+	t.Run("rename", func(t *testing.T) {
+		w := serve(c.HandlePatchUser(), http.MethodPatch, created.ID, &scim.PatchRequest{
+			Schemas:    []string{scim.SchemaPatchOp},
+			Operations: []*scim.PatchOperation{{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Renamed User"`)}},
+		})
+		if got, want := w.Code, http.StatusConflict; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		found, err := db.FindUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := found.Name, "Shared User"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("replace_unchanged_name", func(t *testing.T) {
+		active := true
+		w := serve(c.HandleReplaceUser(), http.MethodPut, created.ID, &scim.User{
+			Schemas:    []string{scim.SchemaUser},
+			UserName:   "scim-shared@example.com",
+			ExternalID: "ext-shared",
+			Name:       &scim.Name{Formatted: "Shared User"},
+			Active:     &active,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var replaced scim.User
+		decode(t, w, &replaced)
+		if got, want := replaced.ExternalID, "ext-shared"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+}
+
+func TestHandleServiceProviderConfig(t *testing.T) {
+	t.Parallel()
+
+	_, _, c, serve := testSetup(t, "SCIM config", rbac.LegacyRealmAdmin)
+
+	w := serve(c.HandleServiceProviderConfig(), http.MethodGet, "", "")
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+
+	var config struct {
+		Schemas []string
+		Patch   struct{ Supported bool }
+	}
+	decode(t, w, &config)
+	if got, want := fmt.Sprint(config.Schemas), fmt.Sprint([]string{scim.SchemaServiceProviderConfig}); got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if !config.Patch.Supported {
+		t.Errorf("expected patch to be supported")
+	}
+}
+
+func TestHandleUsers_Permissions(t *testing.T) {
+	t.Parallel()
+
+	_, _, c, serve := testSetup(t, "SCIM permissions", rbac.UserRead)
+
+	w := serve(c.HandleListUsers(), http.MethodGet, "", "")
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+
+	w = serve(c.HandleCreateUser(), http.MethodPost, "", &scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		UserName: "reader@example.com",
+	})
+	if got, want := w.Code, http.StatusForbidden; got != want {
+		t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+	}
+}
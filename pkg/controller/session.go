@@ -31,8 +31,14 @@ const (
 	mfaPrompted                       = sessionKey("mfaPrompted")
 	passwordExpireWarned              = sessionKey("passwordExpireWarned")
 	sessionKeyCSRFToken               = sessionKey("csrfToken")
+	sessionKeyIssuedCodes             = sessionKey("issuedCodes")
 	sessionKeyLastActivity            = sessionKey("lastActivity")
+	sessionKeyMFAEnrollment           = sessionKey("mfaEnrollment")
+	sessionKeyMFAWebAuthnChallenge    = sessionKey("mfaWebAuthnChallenge")
 	sessionKeyRealmID                 = sessionKey("realmID")
+	sessionKeySSONonce                = sessionKey("ssoNonce")
+	sessionKeySSORealmID              = sessionKey("ssoRealmID")
+	sessionKeySSOState                = sessionKey("ssoState")
 	sessionKeyWelcomeMessageDisplayed = sessionKey("welcomeMessageDisplayed")
 	nonceKey                          = sessionKey("nonce")
 	regionKey                         = sessionKey("region")
@@ -147,6 +153,37 @@ func RealmIDFromSession(session *sessions.Session) uint {
 	return t
 }
 
+// StoreSessionSSO stores the state of a single sign-on attempt: the realm whose
+// identity provider the user is signing in with, and the state and nonce sent
+// to the identity provider.
+func StoreSessionSSO(session *sessions.Session, realmID uint, state, nonce string) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeySSORealmID] = realmID
+	session.Values[sessionKeySSOState] = state
+	session.Values[sessionKeySSONonce] = nonce
+}
+
+// ClearSessionSSO clears the single sign-on attempt from the session.
+func ClearSessionSSO(session *sessions.Session) {
+	sessionClear(session, sessionKeySSORealmID)
+	sessionClear(session, sessionKeySSOState)
+	sessionClear(session, sessionKeySSONonce)
+}
+
+// SSOFromSession extracts the single sign-on attempt from the session. The
+// realm ID is 0 if there is no attempt, or the values are malformed.
+func SSOFromSession(session *sessions.Session) (uint, string, string) {
+	realmID, _ := sessionGet(session, sessionKeySSORealmID).(uint)
+	state, _ := sessionGet(session, sessionKeySSOState).(string)
+	nonce, _ := sessionGet(session, sessionKeySSONonce).(string)
+	if realmID == 0 || state == "" || nonce == "" {
+		return 0, "", ""
+	}
+	return realmID, state, nonce
+}
+
 // StoreSessionMFAPrompted stores if the user was prompted for MFA.
 func StoreSessionMFAPrompted(session *sessions.Session, prompted bool) {
 	if session == nil {
@@ -176,6 +213,107 @@ func MFAPromptedFromSession(session *sessions.Session) bool {
 	return f
 }
 
+// StoreSessionMFAEnrollment stores the secret of the authenticator app the
+// user is enrolling. It is saved as a factor once the user enters a code.
+func StoreSessionMFAEnrollment(session *sessions.Session, secret string) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeyMFAEnrollment] = secret
+}
+
+// ClearSessionMFAEnrollment clears the pending authenticator app secret.
+func ClearSessionMFAEnrollment(session *sessions.Session) {
+	sessionClear(session, sessionKeyMFAEnrollment)
+}
+
+// MFAEnrollmentFromSession extracts the pending authenticator app secret. It
+// returns the empty string if there is no enrollment in progress.
+func MFAEnrollmentFromSession(session *sessions.Session) string {
+	v, _ := sessionGet(session, sessionKeyMFAEnrollment).(string)
+	return v
+}
+
+// StoreSessionMFAWebAuthnChallenge stores the challenge of an in-progress
+// security key registration or sign in.
+func StoreSessionMFAWebAuthnChallenge(session *sessions.Session, challenge []byte) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeyMFAWebAuthnChallenge] = challenge
+}
+
+// PopMFAWebAuthnChallenge returns and clears the security key challenge, so
+// each challenge can only be answered once. It returns nil if there is no
+// challenge.
+func PopMFAWebAuthnChallenge(session *sessions.Session) []byte {
+	v, _ := sessionGet(session, sessionKeyMFAWebAuthnChallenge).([]byte)
+	sessionClear(session, sessionKeyMFAWebAuthnChallenge)
+	return v
+}
+
+// maxSessionIssuedCodes is the maximum number of recently issued codes kept in
+// the session. Sessions are stored in a cookie, so this must stay small.
+const maxSessionIssuedCodes = 10
+
+// issuedCode is a recently issued long code and its expiration time in seconds
+// since the epoch.
+type issuedCode struct {
+	LongCode  string
+	ExpiresAt int64
+}
+
+// StoreSessionIssuedCode stores the long code for the verification code with
+// the given UUID, so its QR code can be rendered again on the code status page.
+// The database only stores an HMAC of the code, so this is the only place the
+// code can be recovered. Expired codes are pruned, and only the most recent
+// codes are kept.
+func StoreSessionIssuedCode(session *sessions.Session, uuid, longCode string, expiresAt time.Time) {
+	if session == nil || uuid == "" || longCode == "" {
+		return
+	}
+
+	codes, _ := sessionGet(session, sessionKeyIssuedCodes).(map[string]issuedCode)
+	if codes == nil {
+		codes = make(map[string]issuedCode, 1)
+	}
+
+	now := time.Now().Unix()
+	for k, v := range codes {
+		if v.ExpiresAt <= now {
+			delete(codes, k)
+		}
+	}
+
+	for len(codes) >= maxSessionIssuedCodes {
+		var oldest string
+		for k, v := range codes {
+			if oldest == "" || v.ExpiresAt < codes[oldest].ExpiresAt {
+				oldest = k
+			}
+		}
+		delete(codes, oldest)
+	}
+
+	codes[uuid] = issuedCode{
+		LongCode:  longCode,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	session.Values[sessionKeyIssuedCodes] = codes
+}
+
+// IssuedCodeFromSession returns the long code for the verification code with
+// the given UUID. It returns the empty string if the code was not issued in
+// this session or has expired.
+func IssuedCodeFromSession(session *sessions.Session, uuid string) string {
+	codes, _ := sessionGet(session, sessionKeyIssuedCodes).(map[string]issuedCode)
+	v, ok := codes[uuid]
+	if !ok || v.ExpiresAt <= time.Now().Unix() {
+		return ""
+	}
+	return v.LongCode
+}
+
 // StoreSessionLastActivity stores the last time the user did something. This is
 // used to track idle session timeouts.
 func StoreSessionLastActivity(session *sessions.Session, t time.Time) {
@@ -0,0 +1,62 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSessionIssuedCodes(t *testing.T) {
+	t.Parallel()
+
+	session := sessions.NewSession(nil, "test")
+
+	if got := IssuedCodeFromSession(session, "missing"); got != "" {
+		t.Errorf("expected empty long code, got %q", got)
+	}
+
+	StoreSessionIssuedCode(session, "expired", "aaaaaaaaaaaaaaaa", time.Now().Add(-time.Minute))
+	if got := IssuedCodeFromSession(session, "expired"); got != "" {
+		t.Errorf("expected expired code to be hidden, got %q", got)
+	}
+
+	StoreSessionIssuedCode(session, "uuid", "bbbbbbbbbbbbbbbb", time.Now().Add(time.Hour))
+	if got, want := IssuedCodeFromSession(session, "uuid"), "bbbbbbbbbbbbbbbb"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	codes := session.Values[sessionKeyIssuedCodes].(map[string]issuedCode)
+	if _, ok := codes["expired"]; ok {
+		t.Errorf("expected expired code to be pruned")
+	}
+
+	// Fill the session past capacity; the soonest expiring codes are dropped.
+	for i := 0; i < maxSessionIssuedCodes; i++ {
+		StoreSessionIssuedCode(session, fmt.Sprintf("uuid-%d", i), "cccccccccccccccc", time.Now().Add(2*time.Hour+time.Duration(i)*time.Second))
+	}
+	if got, want := len(session.Values[sessionKeyIssuedCodes].(map[string]issuedCode)), maxSessionIssuedCodes; got != want {
+		t.Errorf("expected %d codes to be %d", got, want)
+	}
+	if got := IssuedCodeFromSession(session, "uuid"); got != "" {
+		t.Errorf("expected oldest code to be evicted, got %q", got)
+	}
+	if got, want := IssuedCodeFromSession(session, fmt.Sprintf("uuid-%d", maxSessionIssuedCodes-1)), "cccccccccccccccc"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
+)
+
+// SendSMS sends the message using the realm's provider. If the provider fails
+// over to one of the realm's other providers, the provider that ultimately
+// delivered the message is recorded in the realm's SMS error stats.
+func SendSMS(ctx context.Context, db *database.Database, realmID uint, provider sms.Provider, to, message string) error {
+	failover, ok := provider.(*sms.Failover)
+	if !ok {
+		return provider.SendSMS(ctx, to, message)
+	}
+
+	result, err := failover.SendSMSWithResult(ctx, to, message)
+	if err != nil {
+		return err
+	}
+
+	if result.FailedOver() {
+		logger := logging.FromContext(ctx).Named("controller.SendSMS")
+		logger.Infow("sms delivered by failover provider",
+			"provider", result.Provider,
+			"attempts", result.Attempts)
+
+		if err := db.InsertSMSErrorStat(realmID, database.SMSFailoverErrorCode(result.Provider)); err != nil {
+			logger.Errorw("failed to record sms failover", "error", err)
+		}
+	}
+	return nil
+}
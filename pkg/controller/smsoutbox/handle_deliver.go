@@ -0,0 +1,207 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsoutbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/webhooks"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// HandleDeliver accepts an HTTP trigger and delivers the next batch of queued
+// messages.
+func (c *Controller) HandleDeliver() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("smsoutbox.HandleDeliver")
+		logger.Debugw("starting")
+		defer logger.Debugw("finishing")
+
+		ok, err := c.db.TryLock(ctx, smsOutboxLock, c.config.MinPeriod)
+		if err != nil {
+			logger.Errorw("failed to acquire lock", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			logger.Debugw("skipping (too early)")
+			c.h.RenderJSON(w, http.StatusOK, fmt.Errorf("too early"))
+			return
+		}
+
+		messages, err := c.db.ClaimSMSOutboxMessages(c.config.BatchSize, c.config.LeaseDuration)
+		if err != nil {
+			logger.Errorw("failed to claim messages", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Debugw("claimed messages", "count", len(messages))
+
+		// Look up the provider for each realm once per batch. If the lookup fails,
+		// the realm's messages are left claimed and are retried once their lease
+		// expires.
+		providers := make(map[uint]sms.Provider)
+		for _, m := range messages {
+			if _, ok := providers[m.RealmID]; ok {
+				continue
+			}
+
+			provider, err := c.smsProviderFor(m.RealmID)
+			if err != nil {
+				logger.Errorw("failed to get sms provider", "realm", m.RealmID, "error", err)
+				continue
+			}
+			providers[m.RealmID] = provider
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, c.config.Concurrency)
+		for _, m := range messages {
+			provider, ok := providers[m.RealmID]
+			if !ok {
+				continue
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(m *database.SMSOutboxMessage, provider sms.Provider) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				if err := c.deliver(ctx, m, provider); err != nil {
+					logger.Errorw("failed to update message", "id", m.ID, "error", err)
+				}
+			}(m, provider)
+		}
+		wg.Wait()
+
+		stats.Record(ctx, mSuccess.M(1))
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// deliver sends the message with the provider and records the outcome. If the
+// provider is nil, the message fails. Errors
+// which the provider reports as transient are retried with exponential backoff
+// until the maximum number of attempts is reached. The returned error is only
+// non-nil if the outcome could not be saved.
+func (c *Controller) deliver(ctx context.Context, m *database.SMSOutboxMessage, provider sms.Provider) error {
+	logger := logging.FromContext(ctx).Named("smsoutbox.deliver").
+		With("id", m.ID).
+		With("realm", m.RealmID)
+
+	var result tag.Mutator
+	defer func() {
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{result}, mMessages.M(1))
+	}()
+
+	if m.IsExpired() {
+		logger.Debugw("message expired before delivery")
+		result = enobs.ResultError("EXPIRED")
+		m.MarkFailed("code expired before the message could be sent")
+		return c.save(m)
+	}
+
+	// Reminders are only useful while the code is still waiting to be claimed.
+	if m.IsReminder() {
+		due, err := c.db.IsSMSReminderDue(m.VerificationCodeID)
+		if err != nil {
+			return fmt.Errorf("failed to check verification code: %w", err)
+		}
+		if !due {
+			logger.Debugw("code claimed or expired before reminder")
+			result = enobs.ResultError("CANCELED")
+			m.MarkCanceled("code was claimed or expired before the reminder was sent")
+			return c.save(m)
+		}
+	}
+
+	if provider == nil {
+		logger.Debugw("realm has no sms provider")
+		result = enobs.ResultError("NO_PROVIDER")
+		m.MarkFailed("realm does not have an sms provider")
+		return c.save(m)
+	}
+
+	// Ask the provider to report the delivery status, if supported. The code's
+	// delivery status tracks the original message, not the reminder.
+	if endpoint := c.config.SMSStatusCallbackEndpoint; endpoint != "" && !m.IsReminder() {
+		uuid, err := c.db.VerificationCodeUUID(m.VerificationCodeID)
+		if err != nil {
+			logger.Errorw("failed to lookup verification code uuid", "error", err)
+		} else {
+			ctx = sms.WithStatusCallback(ctx, webhooks.TwilioStatusCallbackURL(endpoint, m.RealmID, uuid))
+		}
+	}
+
+	if err := controller.SendSMS(ctx, c.db, m.RealmID, provider, m.PhoneNumber, m.Message); err != nil {
+		reason := issueapi.ScrubPhoneNumbers(err.Error())
+
+		if !sms.IsTransient(err) || m.Attempts >= c.config.MaxAttempts {
+			logger.Infow("failed to send sms", "attempts", m.Attempts, "error", reason)
+			result = enobs.ResultError("FAILED")
+			m.MarkFailed(reason)
+			return c.save(m)
+		}
+
+		delay := backoff(m.Attempts, c.config.RetryBaseDelay, c.config.RetryMaxDelay)
+		logger.Debugw("failed to send sms, retrying", "attempts", m.Attempts, "delay", delay, "error", reason)
+		result = enobs.ResultError("RETRY")
+		m.MarkRetry(reason, delay)
+		return c.save(m)
+	}
+
+	result = enobs.ResultOK
+	m.MarkSent()
+	return c.save(m)
+}
+
+// save records the outcome of a delivery attempt. Reminders also update the
+// verification code's reminder status and the realm's stats.
+func (c *Controller) save(m *database.SMSOutboxMessage) error {
+	if m.IsReminder() {
+		return c.db.SaveSMSReminder(m)
+	}
+	return c.db.SaveSMSOutboxMessage(m)
+}
+
+// smsProviderFor returns the sms provider for the realm. If the realm no longer
+// has an sms provider, it returns nil.
+func (c *Controller) smsProviderFor(realmID uint) (sms.Provider, error) {
+	realm, err := c.db.FindRealm(realmID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	provider, err := realm.SMSProvider(c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sms provider: %w", err)
+	}
+	return provider, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsoutbox
+
+import (
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+const metricPrefix = observability.MetricRoot + "/sms_outbox"
+
+var (
+	mSuccess  = stats.Int64(metricPrefix+"/success", "successful execution", stats.UnitDimensionless)
+	mMessages = stats.Int64(metricPrefix+"/messages", "The number of messages processed.", stats.UnitDimensionless)
+)
+
+func init() {
+	enobs.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/success",
+			Description: "Number of successes",
+			TagKeys:     observability.CommonTagKeys(),
+			Measure:     mSuccess,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/messages_count",
+			Description: "The count of processed messages, by result",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Measure:     mMessages,
+			Aggregation: view.Count(),
+		},
+	}...)
+}
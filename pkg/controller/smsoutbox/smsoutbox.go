@@ -0,0 +1,64 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smsoutbox implements delivery of queued SMS messages.
+package smsoutbox
+
+import (
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+const smsOutboxLock = "smsOutboxLock"
+
+// Controller is a controller for the sms outbox service.
+type Controller struct {
+	config *config.SMSOutboxConfig
+	db     *database.Database
+	h      *render.Renderer
+}
+
+// New creates a new sms outbox controller.
+func New(config *config.SMSOutboxConfig, db *database.Database, h *render.Renderer) *Controller {
+	return &Controller{
+		config: config,
+		db:     db,
+		h:      h,
+	}
+}
+
+// backoff returns the delay before the next delivery attempt, given the number
+// of attempts made so far. The delay doubles with each attempt, starting at
+// base, and is capped at max.
+func backoff(attempts uint, base, max time.Duration) time.Duration {
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	delay := base
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+	return delay
+}
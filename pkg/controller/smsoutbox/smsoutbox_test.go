@@ -0,0 +1,73 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsoutbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		attempts uint
+		exp      time.Duration
+	}{
+		{
+			name:     "zero",
+			attempts: 0,
+			exp:      30 * time.Second,
+		},
+		{
+			name:     "first",
+			attempts: 1,
+			exp:      30 * time.Second,
+		},
+		{
+			name:     "second",
+			attempts: 2,
+			exp:      time.Minute,
+		},
+		{
+			name:     "fourth",
+			attempts: 4,
+			exp:      4 * time.Minute,
+		},
+		{
+			name:     "capped",
+			attempts: 10,
+			exp:      30 * time.Minute,
+		},
+		{
+			name:     "overflow",
+			attempts: 1000,
+			exp:      30 * time.Minute,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := backoff(tc.attempts, 30*time.Second, 30*time.Minute), tc.exp; got != want {
+				t.Errorf("expected %s to be %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleListAPI lists the members of the API key's realm.
+func (c *Controller) HandleListAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("user.HandleListAPI")
+
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.UserRead)
+		if !ok {
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		q := r.FormValue(QueryKeySearch)
+		memberships, paginator, err := currentRealm.ListMemberships(c.db, pageParams, database.WithUserSearch(q))
+		if err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.TrimPrefix(err.Error(), "validation failed: ")))
+				return
+			}
+
+			logger.Errorw("failed to list memberships", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		resp := &api.ListUsersResponse{
+			Users: make([]*api.UserResponse, 0, len(memberships)),
+		}
+		for _, m := range memberships {
+			resp.Users = append(resp.Users, userResponse(m))
+		}
+		if paginator != nil && paginator.NextPage != nil {
+			resp.NextPage = paginator.NextPage.Number
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// HandleShowAPI shows a member of the API key's realm.
+func (c *Controller) HandleShowAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.UserRead)
+		if !ok {
+			return
+		}
+
+		_, membership, ok := c.findAPIUser(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, userResponse(membership))
+	})
+}
+
+// HandleCreateAPI adds a user to the API key's realm, creating the user if
+// they do not already exist. Unlike the web interface, it does not send an
+// invitation.
+func (c *Controller) HandleCreateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("user.HandleCreateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.UserWrite)
+		if !ok {
+			return
+		}
+
+		var request api.CreateUserRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		roles, err := currentRealm.ListRoles(c.db)
+		if err != nil {
+			logger.Errorw("failed to list roles", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		membership := &database.Membership{}
+		if err := bindAPIPermissions(authApp, roles, request.RoleID, request.Permissions, membership); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+		if err := bindExpiry(request.ExpiresOn, membership); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		// See if the user already exists by email - they may be a member of another
+		// realm.
+		user := &database.User{
+			Email: request.Email,
+			Name:  request.Name,
+		}
+		existing, err := c.db.FindUserByEmail(user.Email)
+		if err != nil && !database.IsNotFound(err) {
+			logger.Errorw("failed to find user", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+		if existing != nil && existing.ID != 0 {
+			if _, err := existing.FindMembership(c.db, currentRealm.ID); err == nil {
+				c.h.RenderJSON(w, http.StatusConflict, api.Errorf("user is already a member of the realm"))
+				return
+			} else if !database.IsNotFound(err) {
+				logger.Errorw("failed to find membership", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+			user = existing
+		}
+
+		if err := c.db.SaveUser(user, authApp); err != nil {
+			if database.IsValidationError(err) {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(user.ErrorMessages(), ", ")))
+				return
+			}
+
+			logger.Errorw("failed to save user", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		if err := saveMembership(c.db, user, currentRealm, membership, authApp); err != nil {
+			logger.Errorw("failed to save membership", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		created, err := user.FindMembership(c.db, currentRealm.ID)
+		if err != nil {
+			logger.Errorw("failed to find membership", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, userResponse(created))
+	})
+}
+
+// HandleUpdateAPI updates a member of the API key's realm.
+func (c *Controller) HandleUpdateAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("user.HandleUpdateAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.UserWrite)
+		if !ok {
+			return
+		}
+
+		user, membership, ok := c.findAPIUser(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		var request api.UpdateUserRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		if request.RoleID != nil || request.Permissions != nil {
+			roles, err := currentRealm.ListRoles(c.db)
+			if err != nil {
+				logger.Errorw("failed to list roles", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+
+			var roleID uint
+			if request.RoleID != nil {
+				roleID = *request.RoleID
+			}
+			if err := bindAPIPermissions(authApp, roles, roleID, request.Permissions, membership); err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+		}
+
+		if request.ExpiresOn != nil {
+			if err := bindExpiry(*request.ExpiresOn, membership); err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+				return
+			}
+		}
+
+		if request.Name != nil {
+			user.Name = *request.Name
+			if err := c.db.SaveUser(user, authApp); err != nil {
+				if database.IsValidationError(err) {
+					c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", strings.Join(user.ErrorMessages(), ", ")))
+					return
+				}
+
+				logger.Errorw("failed to save user", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+		}
+
+		if err := saveMembership(c.db, user, currentRealm, membership, authApp); err != nil {
+			logger.Errorw("failed to save membership", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		updated, err := user.FindMembership(c.db, currentRealm.ID)
+		if err != nil {
+			logger.Errorw("failed to find membership", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, userResponse(updated))
+	})
+}
+
+// HandleDeleteAPI removes a user from the API key's realm. The user is not
+// deleted, since they may be a member of other realms.
+func (c *Controller) HandleDeleteAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("user.HandleDeleteAPI")
+
+		authApp, currentRealm, ok := controller.AuthorizeAPIKey(w, r, c.h, rbac.UserWrite)
+		if !ok {
+			return
+		}
+
+		user, _, ok := c.findAPIUser(w, r, currentRealm)
+		if !ok {
+			return
+		}
+
+		if err := user.DeleteFromRealm(c.db, currentRealm, authApp); err != nil {
+			logger.Errorw("failed to remove user from realm", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// findAPIUser finds the member of the realm in the request path, rendering the
+// appropriate error and returning false if they are not a member.
+func (c *Controller) findAPIUser(w http.ResponseWriter, r *http.Request, realm *database.Realm) (*database.User, *database.Membership, bool) {
+	logger := logging.FromContext(r.Context()).Named("user.findAPIUser")
+
+	user, err := realm.FindUser(c.db, mux.Vars(r)["id"])
+	if err == nil {
+		var membership *database.Membership
+		membership, err = user.FindMembership(c.db, realm.ID)
+		if err == nil {
+			return user, membership, true
+		}
+	}
+
+	if database.IsNotFound(err) {
+		c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("user not found"))
+		return nil, nil, false
+	}
+
+	logger.Errorw("failed to find user", "error", err)
+	c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+	return nil, nil, false
+}
+
+// bindAPIPermissions sets the membership's role or permissions from an API
+// request. The API key must have all of the permissions being granted.
+func bindAPIPermissions(authApp *database.AuthorizedApp, roles []*database.Role, roleID uint, names []string, membership *database.Membership) error {
+	if roleID != 0 && len(names) > 0 {
+		return fmt.Errorf("cannot set both roleID and permissions")
+	}
+
+	permissions, err := rbac.PermissionsFromNames(names)
+	if err != nil {
+		return err
+	}
+	return bindPermissions(authApp.Permissions, roles, roleID, permissions, membership)
+}
+
+// userResponse builds the API representation of the membership.
+func userResponse(m *database.Membership) *api.UserResponse {
+	resp := &api.UserResponse{
+		ID:                 m.UserID,
+		Permissions:        rbac.PermissionNames(m.Permissions),
+		ExpiresOn:          m.ExpiresOn(),
+		CreatedAtTimestamp: m.CreatedAt.UTC().Unix(),
+	}
+	if m.User != nil {
+		resp.Email = m.User.Email
+		resp.Name = m.User.Name
+	}
+	if m.RoleID != nil {
+		resp.RoleID = *m.RoleID
+	}
+	return resp
+}
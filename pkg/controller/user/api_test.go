@@ -0,0 +1,170 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleUsersAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := harness.Database
+
+	realm := database.NewRealmWithDefaults("Users API")
+	if err := db.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := user.New(nil, harness.Cacher, db, harness.Renderer)
+
+	// serve serves the request as an admin API key with the given permissions.
+	serve := func(tb testing.TB, permissions rbac.Permission, handler http.Handler, meth, id string, body interface{}) *httptest.ResponseRecorder {
+		tb.Helper()
+
+		ctx := ctx
+		ctx = controller.WithAuthorizedApp(ctx, &database.AuthorizedApp{
+			RealmID:     realm.ID,
+			Name:        "Terraform",
+			APIKeyType:  database.APIKeyTypeAdmin,
+			Permissions: permissions,
+		})
+		ctx = controller.WithRealm(ctx, realm)
+
+		w, r := envstest.BuildJSONRequest(ctx, tb, meth, "/", body)
+		if id != "" {
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+		}
+		harness.WithCommonMiddlewares(handler).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("permission_missing", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.UserRead, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateUserRequest{
+			Email: "forbidden@example.com",
+			Name:  "Forbidden",
+		})
+		if got, want := w.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		t.Parallel()
+
+		w := serve(t, rbac.UserWrite|rbac.UserRead, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateUserRequest{
+			Email:       "escalation@example.com",
+			Name:        "Escalation",
+			Permissions: []string{"SettingsWrite"},
+		})
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		permissions := rbac.LegacyRealmAdmin
+
+		w := serve(t, permissions, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateUserRequest{
+			Email:       "lifecycle@example.com",
+			Name:        "Lifecycle",
+			Permissions: []string{"CodeIssue"},
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var created api.UserResponse
+		decodeJSON(t, w, &created)
+		if got, want := created.Permissions, []string{"CodeIssue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		id := fmt.Sprint(created.ID)
+
+		// Adding the same user again conflicts.
+		w = serve(t, permissions, c.HandleCreateAPI(), http.MethodPost, "", &api.CreateUserRequest{
+			Email: "lifecycle@example.com",
+			Name:  "Lifecycle",
+		})
+		if got, want := w.Code, http.StatusConflict; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w = serve(t, permissions, c.HandleListAPI(), http.MethodGet, "", nil)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var list api.ListUsersResponse
+		decodeJSON(t, w, &list)
+		if got, want := len(list.Users), 1; got != want {
+			t.Errorf("expected %d users, got %d", want, got)
+		}
+
+		expiresOn := "2999-01-31"
+		w = serve(t, permissions, c.HandleUpdateAPI(), http.MethodPatch, id, &api.UpdateUserRequest{
+			Permissions: []string{"CodeIssue", "CodeRead"},
+			ExpiresOn:   &expiresOn,
+		})
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+		var updated api.UserResponse
+		decodeJSON(t, w, &updated)
+		if got, want := updated.Permissions, []string{"CodeIssue", "CodeRead"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := updated.ExpiresOn, expiresOn; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		w = serve(t, permissions, c.HandleDeleteAPI(), http.MethodDelete, id, nil)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		w = serve(t, permissions, c.HandleShowAPI(), http.MethodGet, id, nil)
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+	})
+}
+
+func decodeJSON(tb testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	tb.Helper()
+
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		tb.Fatal(err)
+	}
+}
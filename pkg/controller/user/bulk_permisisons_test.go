@@ -103,12 +103,20 @@ func TestHandleBulkPermissions(t *testing.T) {
 			t.Errorf("expected %d to be %d", got, want)
 		}
 
-		record, err := testUser.FindMembership(harness.Database, realm.ID)
+		location := w.Header().Get("Location")
+		if !strings.HasPrefix(location, "/realm/jobs/") {
+			t.Fatalf("expected %q to redirect to the job", location)
+		}
+
+		job, err := realm.FindJob(harness.Database, strings.TrimPrefix(location, "/realm/jobs/"))
 		if err != nil {
 			t.Fatal(err)
 		}
-		if !record.Can(rbac.SettingsWrite) {
-			t.Errorf("expected %q to be able to %q", record.Permissions, 1)
+		if got, want := job.Kind, database.JobKindBulkPermissions; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := job.TotalItems, uint(1); got != want {
+			t.Errorf("expected %d to be %d", got, want)
 		}
 	})
 }
@@ -15,6 +15,7 @@
 package user
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -53,22 +54,26 @@ func (c *Controller) HandleBulkPermissions(action database.BulkPermissionAction)
 			controller.Back(w, r, c.h)
 			return
 		}
+		if len(bulkPermission.UserIDs) == 0 {
+			flash.Error("Failed to process bulk permissions: no users were selected")
+			controller.Back(w, r, c.h)
+			return
+		}
 
-		// Bulk add permissions.
-		if err := bulkPermission.Apply(c.db, currentUser); err != nil {
-			if database.IsValidationError(err) {
-				flash.Error("Failed to apply bulk permissions: %s", err.Error())
-				controller.Back(w, r, c.h)
-				return
-			}
-
+		// Large realms can have thousands of users, so the permissions are
+		// applied in the background.
+		job, err := bulkPermission.NewJob(currentUser.ID)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		if err := c.db.SaveJob(job); err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		flash.Alert("Successfully updated permissions")
-		controller.Back(w, r, c.h)
-		return
+		flash.Alert("Updating permissions for %d users. This page updates as the job progresses.", len(bulkPermission.UserIDs))
+		http.Redirect(w, r, fmt.Sprintf("/realm/jobs/%s", job.UUID), http.StatusSeeOther)
 	})
 }
 
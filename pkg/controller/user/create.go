@@ -47,18 +47,24 @@ func (c *Controller) HandleCreate() http.Handler {
 		currentRealm := currentMembership.Realm
 		currentUser := currentMembership.User
 
+		roles, err := currentRealm.ListRoles(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		user := &database.User{}
 		userMembership := &database.Membership{}
 
 		if r.Method == http.MethodGet {
-			c.renderNew(ctx, w, user, userMembership)
+			c.renderNew(ctx, w, user, userMembership, roles)
 			return
 		}
 
-		if err := bindCreateForm(r, currentMembership, user, userMembership); err != nil {
+		if err := bindCreateForm(r, currentMembership, roles, user, userMembership); err != nil {
 			user.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderNew(ctx, w, user, userMembership)
+			c.renderNew(ctx, w, user, userMembership, roles)
 			return
 		}
 
@@ -77,7 +83,7 @@ func (c *Controller) HandleCreate() http.Handler {
 		if err := c.db.SaveUser(user, currentUser); err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderNew(ctx, w, user, userMembership)
+				c.renderNew(ctx, w, user, userMembership, roles)
 				return
 			}
 
@@ -86,10 +92,10 @@ func (c *Controller) HandleCreate() http.Handler {
 		}
 
 		// Create or update membership properties.
-		if err := user.AddToRealm(c.db, currentRealm, userMembership.Permissions, currentUser); err != nil {
+		if err := saveMembership(c.db, user, currentRealm, userMembership, currentUser); err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderNew(ctx, w, user, userMembership)
+				c.renderNew(ctx, w, user, userMembership, roles)
 				return
 			}
 
@@ -107,7 +113,7 @@ func (c *Controller) HandleCreate() http.Handler {
 		if _, err := c.authProvider.CreateUser(ctx, user.Name, user.Email, "", true, inviteComposer); err != nil {
 			user.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderNew(ctx, w, user, userMembership)
+			c.renderNew(ctx, w, user, userMembership, roles)
 			return
 		}
 
@@ -116,11 +122,13 @@ func (c *Controller) HandleCreate() http.Handler {
 	})
 }
 
-func bindCreateForm(r *http.Request, currentMembership *database.Membership, user *database.User, membership *database.Membership) error {
+func bindCreateForm(r *http.Request, currentMembership *database.Membership, roles []*database.Role, user *database.User, membership *database.Membership) error {
 	type FormData struct {
 		Email       string            `form:"email"`
 		Name        string            `form:"name"`
+		RoleID      uint              `form:"role_id"`
 		Permissions []rbac.Permission `form:"permissions"`
+		ExpiresOn   string            `form:"expires_on"`
 	}
 
 	var form FormData
@@ -128,20 +136,24 @@ func bindCreateForm(r *http.Request, currentMembership *database.Membership, use
 	user.Email = form.Email
 	user.Name = form.Name
 
-	permissions, rbacErr := rbac.CompileAndAuthorize(currentMembership.Permissions, form.Permissions)
-	membership.Permissions = permissions
+	rbacErr := bindPermissions(currentMembership.Permissions, roles, form.RoleID, form.Permissions, membership)
+	expiryErr := bindExpiry(form.ExpiresOn, membership)
 
 	if formErr != nil {
 		return formErr
 	}
-	return rbacErr
+	if rbacErr != nil {
+		return rbacErr
+	}
+	return expiryErr
 }
 
-func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership) {
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership, roles []*database.Role) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("New user")
 	m["user"] = user
 	m["userMembership"] = membership
 	m["permissions"] = rbac.NamePermissionMap
+	m["roles"] = roles
 	c.h.RenderHTML(w, "users/new", m)
 }
@@ -15,18 +15,21 @@
 package user
 
 import (
-	"context"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
-	"github.com/hashicorp/go-multierror"
 )
 
+// maxImportBatchUsers is the most users which can be imported in one request.
+const maxImportBatchUsers = 10000
+
+// HandleImportBatch accepts a batch of users and creates a job which adds them
+// to the realm in the background. The response includes the ID of the job.
 func (c *Controller) HandleImportBatch() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -50,91 +53,54 @@ func (c *Controller) HandleImportBatch() http.Handler {
 			return
 		}
 
-		realmMemberships, err := membership.Realm.MembershipPermissionMap(c.db)
-		if err != nil {
-			controller.InternalError(w, r, c.h, err)
+		if len(request.Users) == 0 {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("no users to import"))
 			return
 		}
-
-		newUsers, batchErr := c.importUsers(ctx, membership.Realm, realmMemberships, membership.User, request.Users, request.SendInvites)
-
-		response := &api.UserBatchResponse{
-			NewUsers: newUsers,
+		if len(request.Users) > maxImportBatchUsers {
+			c.h.RenderJSON(w, http.StatusBadRequest,
+				api.Errorf("too many users to import: %d, maximum is %d", len(request.Users), maxImportBatchUsers))
+			return
 		}
 
-		if err := batchErr.ErrorOrNil(); err != nil {
-			response.Error = err.Error()
-			response.ErrorCode = fmt.Sprintf("%d", http.StatusInternalServerError)
+		// Users which cannot be added, such as those without an email address,
+		// are reported in the job's results.
+		rows := make([]*database.UserImportRow, 0, len(request.Users))
+		for i := range request.Users {
+			batchUser := &request.Users[i]
 
-			if len(newUsers) == 0 { // We return partial success if any succeeded.
-				c.h.RenderJSON(w, http.StatusInternalServerError, response)
+			expiresAt, err := database.ParseExpiresOn(batchUser.ExpiresOn)
+			if err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("user %d: %s", i+1, err))
 				return
 			}
-		}
-
-		c.h.RenderJSON(w, http.StatusOK, response)
-	})
-}
-
-func (c *Controller) importUsers(ctx context.Context,
-	realm *database.Realm, realmMemberships map[uint]rbac.Permission, actor database.Auditable,
-	users []api.BatchUser, sendInvites bool) ([]*api.BatchUser, *multierror.Error) {
-	logger := logging.FromContext(ctx).Named("user.importUsers")
-
-	addedUsers := make([]*api.BatchUser, 0, len(users))
-	var batchErr *multierror.Error
-
-	for i, batchUser := range users {
-		// See if the user already exists by email - they may be a member of another
-		// realm.
-		user, err := c.db.FindUserByEmail(batchUser.Email)
-		if err != nil {
-			if !database.IsNotFound(err) {
-				logger.Errorw("error finding user", "error", err)
-				batchErr = multierror.Append(batchErr, err)
-				continue
-			}
 
-			user = new(database.User)
-			user.Email = batchUser.Email
-			user.Name = batchUser.Name
-
-			if err := c.db.SaveUser(user, actor); err != nil {
-				logger.Errorw("error saving user", "error", err)
-				batchErr = multierror.Append(batchErr, err)
-				continue
-			}
-		}
-
-		// Create the user's membership in the realm.
-		var permission rbac.Permission
-		if existing, ok := realmMemberships[user.ID]; ok {
-			permission = existing
-		}
-		permission = permission | rbac.CodeIssue | rbac.CodeBulkIssue | rbac.CodeRead | rbac.CodeExpire
-		if err := user.AddToRealm(c.db, realm, permission, actor); err != nil {
-			logger.Errorw("failed to add user to realm",
-				"user_id", user.ID, "realm_id", realm.ID, "error", err)
-			batchErr = multierror.Append(batchErr, err)
-			continue
+			rows = append(rows, &database.UserImportRow{
+				Line:      uint(i + 1),
+				Email:     strings.TrimSpace(batchUser.Email),
+				Name:      strings.TrimSpace(batchUser.Name),
+				ExpiresAt: expiresAt,
+			})
 		}
 
-		// Create the invitation email composer.
-		inviteComposer, err := controller.SendInviteEmailFunc(ctx, c.db, c.h, user.Email, realm)
+		// Large imports can take longer than a request, so the users are added in
+		// the background.
+		job, err := database.NewUserImportJob(membership.Realm.ID, membership.User.ID, &database.UserImportParams{
+			SendInvites: request.SendInvites,
+		}, rows)
 		if err != nil {
-			batchErr = multierror.Append(batchErr, err)
-			continue
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
-
-		// Create the user in the auth provider. This could be a noop depending on
-		// the auth provider.
-		if _, err = c.authProvider.CreateUser(ctx, user.Name, user.Email, "", sendInvites, inviteComposer); err != nil {
-			logger.Errorw("failed to import user", "user", user.Email, "error", err)
-			batchErr = multierror.Append(batchErr, err)
-			continue
+		if err := c.db.SaveJob(job); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
 
-		addedUsers = append(addedUsers, &users[i])
-	}
-	return addedUsers, batchErr
+		c.h.RenderJSON(w, http.StatusOK, &api.UserBatchResponse{
+			NewUsers:    []*api.BatchUser{},
+			QueuedUsers: len(rows),
+			JobID:       job.UUID,
+		})
+	})
 }
@@ -15,8 +15,11 @@
 package user_test
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
@@ -44,6 +47,27 @@ func TestHandleImportBatch(t *testing.T) {
 		envstest.ExercisePermissionMissing(t, handler)
 	})
 
+	t.Run("no_users", func(t *testing.T) {
+		t.Parallel()
+
+		admin, _, realm := provisionUsers(t, harness.Database)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.UserWrite,
+		})
+
+		w, r := envstest.BuildJSONRequest(ctx, t, http.MethodPost, "/", &api.UserBatchRequest{})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
 	t.Run("invalid_user", func(t *testing.T) {
 		t.Parallel()
 
@@ -71,11 +95,44 @@ func TestHandleImportBatch(t *testing.T) {
 		})
 		handler.ServeHTTP(w, r)
 
+		// Invalid users are reported in the job's results.
 		if got, want := w.Code, http.StatusOK; got != want {
 			t.Errorf("expected %d to be %d", got, want)
 		}
 	})
 
+	t.Run("invalid_expiry", func(t *testing.T) {
+		t.Parallel()
+
+		admin, _, realm := provisionUsers(t, harness.Database)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.UserWrite,
+		})
+
+		w, r := envstest.BuildJSONRequest(ctx, t, http.MethodPost, "/", &api.UserBatchRequest{
+			Users: []api.BatchUser{
+				{
+					Email:     "thisisfine@example.com",
+					Name:      "valid tester",
+					ExpiresOn: "2020-01-01",
+				},
+			},
+		})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "user 1: expiry date 2020-01-01 is not in the future"; !strings.Contains(got, want) {
+			t.Errorf("expected %q to include %q", got, want)
+		}
+	})
+
 	t.Run("success", func(t *testing.T) {
 		t.Parallel()
 
@@ -95,13 +152,67 @@ func TestHandleImportBatch(t *testing.T) {
 					Email: "test@example.com",
 					Name:  "batch tester",
 				},
+				{
+					Email:     "other@example.com",
+					ExpiresOn: "2099-12-31",
+				},
 			},
 			SendInvites: true,
 		})
 		handler.ServeHTTP(w, r)
 
 		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+		}
+
+		var resp api.UserBatchResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.QueuedUsers, 2; got != want {
 			t.Errorf("expected %d to be %d", got, want)
 		}
+		if got, want := len(resp.NewUsers), 0; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		job, err := realm.FindJob(harness.Database, resp.JobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := job.Kind, database.JobKindUserImport; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := job.TotalItems, uint(2); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		params, err := job.UserImportParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !params.SendInvites {
+			t.Errorf("expected invites to be sent")
+		}
+
+		// The items are only loaded when the job is processed.
+		job, err = harness.Database.FindJob(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := job.PendingUserImportRows(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(rows), 2; got != want {
+			t.Fatalf("expected %d to be %d", got, want)
+		}
+		if rows[0].ExpiresAt != nil {
+			t.Errorf("expected no expiry, got %v", rows[0].ExpiresAt)
+		}
+		expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+		if got := rows[1].ExpiresAt; got == nil || !got.Equal(expiresAt) {
+			t.Errorf("expected %v to be %v", got, expiresAt)
+		}
 	})
 }
@@ -0,0 +1,133 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+// Importer adds users to a realm. It is used by the job worker to process user
+// import jobs.
+type Importer struct {
+	authProvider auth.Provider
+	db           *database.Database
+	h            *render.Renderer
+}
+
+// NewImporter creates a new importer. The renderer must include the server's
+// email templates to send invitations.
+func NewImporter(authProvider auth.Provider, db *database.Database, h *render.Renderer) *Importer {
+	return &Importer{
+		authProvider: authProvider,
+		db:           db,
+		h:            h,
+	}
+}
+
+// Import adds each user to the realm with permissions to issue and lookup
+// codes, creating the user if they do not already exist, and sets the
+// membership's expiry if the row has one. It returns the outcome for each row.
+// An error is returned, and no rows are processed, if the realm's memberships
+// cannot be loaded.
+func (i *Importer) Import(ctx context.Context, realm *database.Realm, actor database.Auditable,
+	rows []*database.UserImportRow, sendInvites bool) ([]*database.JobResult, error) {
+	realmMemberships, err := realm.MembershipPermissionMap(i.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load realm memberships: %w", err)
+	}
+
+	results := make([]*database.JobResult, 0, len(rows))
+	for _, row := range rows {
+		result := &database.JobResult{
+			Line:   row.Line,
+			ID:     row.Email,
+			Status: database.UserImportResultImported,
+		}
+		if err := i.importUser(ctx, realm, realmMemberships, actor, row, sendInvites); err != nil {
+			result.Status = database.JobResultFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (i *Importer) importUser(ctx context.Context,
+	realm *database.Realm, realmMemberships map[uint]rbac.Permission, actor database.Auditable,
+	row *database.UserImportRow, sendInvites bool) error {
+	logger := logging.FromContext(ctx).Named("user.importUser")
+
+	// See if the user already exists by email - they may be a member of another
+	// realm.
+	user, err := i.db.FindUserByEmail(row.Email)
+	if err != nil {
+		if !database.IsNotFound(err) {
+			logger.Errorw("error finding user", "error", err)
+			return err
+		}
+
+		user = new(database.User)
+		user.Email = row.Email
+		user.Name = row.Name
+
+		if err := i.db.SaveUser(user, actor); err != nil {
+			logger.Errorw("error saving user", "error", err)
+			return err
+		}
+	}
+
+	// Create the user's membership in the realm.
+	var permission rbac.Permission
+	if existing, ok := realmMemberships[user.ID]; ok {
+		permission = existing
+	}
+	permission = permission | rbac.CodeIssue | rbac.CodeBulkIssue | rbac.CodeRead | rbac.CodeExpire
+	if err := user.AddToRealm(i.db, realm, permission, actor); err != nil {
+		logger.Errorw("failed to add user to realm",
+			"user_id", user.ID, "realm_id", realm.ID, "error", err)
+		return err
+	}
+	realmMemberships[user.ID] = permission
+
+	if row.ExpiresAt != nil {
+		if err := user.UpdateMembershipExpiry(i.db, realm, row.ExpiresAt, actor); err != nil {
+			logger.Errorw("failed to set membership expiry",
+				"user_id", user.ID, "realm_id", realm.ID, "error", err)
+			return err
+		}
+	}
+
+	// Create the invitation email composer.
+	inviteComposer, err := controller.SendInviteEmailFunc(ctx, i.db, i.h, user.Email, realm)
+	if err != nil {
+		return err
+	}
+
+	// Create the user in the auth provider. This could be a noop depending on
+	// the auth provider.
+	if _, err := i.authProvider.CreateUser(ctx, user.Name, user.Email, "", sendInvites, inviteComposer); err != nil {
+		logger.Errorw("failed to import user", "user", user.Email, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestImporter_Import(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	_, _, realm := provisionUsers(t, harness.Database)
+
+	suffix, err := project.RandomHexString(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	importer := user.NewImporter(harness.AuthProvider, harness.Database, harness.Renderer)
+	results, err := importer.Import(ctx, realm, database.SystemTest, []*database.UserImportRow{
+		{Line: 1, Email: "permanent-" + suffix + "@example.com", Name: "Permanent"},
+		{Line: 2, Email: "temporary-" + suffix + "@example.com", Name: "Temporary", ExpiresAt: &expiresAt},
+		{Line: 3, Name: "Invalid"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(results), 3; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	for i, want := range []string{
+		database.UserImportResultImported,
+		database.UserImportResultImported,
+		database.JobResultFailed,
+	} {
+		if got := results[i].Status; got != want {
+			t.Errorf("line %d: expected %q to be %q (%s)", results[i].Line, got, want, results[i].Error)
+		}
+	}
+
+	cases := []struct {
+		email     string
+		expiresAt *time.Time
+	}{
+		{"permanent-" + suffix + "@example.com", nil},
+		{"temporary-" + suffix + "@example.com", &expiresAt},
+	}
+
+	for _, tc := range cases {
+		u, err := harness.Database.FindUserByEmail(tc.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		membership, err := u.FindMembership(harness.Database, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := membership.ExpiresAt
+		if tc.expiresAt == nil {
+			if got != nil {
+				t.Errorf("%s: expected no expiry, got %v", tc.email, got)
+			}
+			continue
+		}
+		if got == nil || !got.Equal(*tc.expiresAt) {
+			t.Errorf("%s: expected %v to be %v", tc.email, got, tc.expiresAt)
+		}
+	}
+}
@@ -61,16 +61,22 @@ func (c *Controller) HandleUpdate() http.Handler {
 			return
 		}
 
+		roles, err := currentRealm.ListRoles(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEdit(ctx, w, user, userMembership)
+			c.renderEdit(ctx, w, user, userMembership, roles)
 			return
 		}
 
-		if err := bindUpdateForm(r, currentMembership, user, userMembership); err != nil {
+		if err := bindUpdateForm(r, currentMembership, roles, user, userMembership); err != nil {
 			user.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderNew(ctx, w, user, userMembership)
+			c.renderNew(ctx, w, user, userMembership, roles)
 			return
 		}
 
@@ -78,7 +84,7 @@ func (c *Controller) HandleUpdate() http.Handler {
 		if err := c.db.SaveUser(user, currentUser); err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderNew(ctx, w, user, userMembership)
+				c.renderNew(ctx, w, user, userMembership, roles)
 				return
 			}
 
@@ -88,10 +94,10 @@ func (c *Controller) HandleUpdate() http.Handler {
 
 		// Update membership properties, iff the target user differs.
 		if currentUser.ID != user.ID {
-			if err := user.AddToRealm(c.db, currentRealm, userMembership.Permissions, currentUser); err != nil {
+			if err := saveMembership(c.db, user, currentRealm, userMembership, currentUser); err != nil {
 				if database.IsValidationError(err) {
 					w.WriteHeader(http.StatusUnprocessableEntity)
-					c.renderNew(ctx, w, user, userMembership)
+					c.renderNew(ctx, w, user, userMembership, roles)
 					return
 				}
 
@@ -105,30 +111,36 @@ func (c *Controller) HandleUpdate() http.Handler {
 	})
 }
 
-func bindUpdateForm(r *http.Request, currentMembership *database.Membership, user *database.User, membership *database.Membership) error {
+func bindUpdateForm(r *http.Request, currentMembership *database.Membership, roles []*database.Role, user *database.User, membership *database.Membership) error {
 	type FormData struct {
 		Name        string            `form:"name"`
+		RoleID      uint              `form:"role_id"`
 		Permissions []rbac.Permission `form:"permissions"`
+		ExpiresOn   string            `form:"expires_on"`
 	}
 
 	var form FormData
 	formErr := controller.BindForm(nil, r, &form)
 	user.Name = form.Name
 
-	permissions, rbacErr := rbac.CompileAndAuthorize(currentMembership.Permissions, form.Permissions)
-	membership.Permissions = permissions
+	rbacErr := bindPermissions(currentMembership.Permissions, roles, form.RoleID, form.Permissions, membership)
+	expiryErr := bindExpiry(form.ExpiresOn, membership)
 
 	if formErr != nil {
 		return formErr
 	}
-	return rbacErr
+	if rbacErr != nil {
+		return rbacErr
+	}
+	return expiryErr
 }
 
-func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership) {
+func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership, roles []*database.Role) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Edit user: %s", user.Name)
 	m["user"] = user
 	m["userMembership"] = membership
 	m["permissions"] = rbac.NamePermissionMap
+	m["roles"] = roles
 	c.h.RenderHTML(w, "users/edit", m)
 }
@@ -20,6 +20,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/envstest"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
@@ -149,4 +150,153 @@ func TestHandleUpdate(t *testing.T) {
 			t.Errorf("expected %q to not be able to %q", permission.Permissions, p)
 		}
 	})
+
+	t.Run("expiry", func(t *testing.T) {
+		t.Parallel()
+
+		admin, testUser, realm := provisionUsers(t, harness.Database)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.LegacyRealmAdmin,
+		})
+
+		expiresOn := time.Now().UTC().AddDate(0, 1, 0).Format(project.RFC3339Date)
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPut, "/", &url.Values{
+			"name":        []string{testUser.Name},
+			"permissions": []string{fmt.Sprintf("%d", rbac.CodeIssue)},
+			"expires_on":  []string{expiresOn},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", testUser.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		membership, err := testUser.FindMembership(harness.Database, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := membership.ExpiresOn(), expiresOn; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("expiry_in_past", func(t *testing.T) {
+		t.Parallel()
+
+		admin, testUser, realm := provisionUsers(t, harness.Database)
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.LegacyRealmAdmin,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPut, "/", &url.Values{
+			"name":        []string{testUser.Name},
+			"permissions": []string{fmt.Sprintf("%d", rbac.CodeIssue)},
+			"expires_on":  []string{"2020-01-01"},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", testUser.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnprocessableEntity; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "is not in the future"; !strings.Contains(got, want) {
+			t.Errorf("Expected %q to contain %q", got, want)
+		}
+	})
+
+	t.Run("role", func(t *testing.T) {
+		t.Parallel()
+
+		admin, testUser, realm := provisionUsers(t, harness.Database)
+
+		role := &database.Role{
+			RealmID:     realm.ID,
+			Name:        "Contact tracer",
+			Permissions: rbac.CodeIssue | rbac.CodeRead,
+		}
+		if err := harness.Database.SaveRole(role, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.LegacyRealmAdmin,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPut, "/", &url.Values{
+			"name":        []string{testUser.Name},
+			"role_id":     []string{fmt.Sprintf("%d", role.ID)},
+			"permissions": []string{fmt.Sprintf("%d", rbac.UserWrite)},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", testUser.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusSeeOther; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		// The role's permissions are used instead of the individual permissions.
+		membership, err := testUser.FindMembership(harness.Database, realm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := membership.Permissions, role.Permissions; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if !membership.HasRole() || *membership.RoleID != role.ID {
+			t.Errorf("expected membership to have role %d", role.ID)
+		}
+	})
+
+	t.Run("role_escalation", func(t *testing.T) {
+		t.Parallel()
+
+		admin, testUser, realm := provisionUsers(t, harness.Database)
+
+		role := &database.Role{
+			RealmID:     realm.ID,
+			Name:        "Settings admin",
+			Permissions: rbac.SettingsWrite | rbac.SettingsRead,
+		}
+		if err := harness.Database.SaveRole(role, database.SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := ctx
+		ctx = controller.WithSession(ctx, &sessions.Session{})
+		ctx = controller.WithMembership(ctx, &database.Membership{
+			Realm:       realm,
+			User:        admin,
+			Permissions: rbac.UserWrite | rbac.UserRead,
+		})
+
+		w, r := envstest.BuildFormRequest(ctx, t, http.MethodPut, "/", &url.Values{
+			"name":    []string{testUser.Name},
+			"role_id": []string{fmt.Sprintf("%d", role.ID)},
+		})
+		r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprintf("%d", testUser.ID)})
+		handler.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusUnprocessableEntity; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+		if got, want := w.Body.String(), "actor does not have all scopes"; !strings.Contains(got, want) {
+			t.Errorf("Expected %q to contain %q", got, want)
+		}
+	})
 }
@@ -16,9 +16,12 @@
 package user
 
 import (
+	"fmt"
+
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 )
 
@@ -59,3 +62,63 @@ func (c *Controller) findUser(currentUser *database.User, realm *database.Realm,
 
 	return user, membership, nil
 }
+
+// bindPermissions sets the membership's permissions from the role with the
+// given ID or, if roleID is 0, from the individual permissions. In both cases,
+// the grantor (the current membership or API key) must have all of the
+// permissions being granted.
+func bindPermissions(grantor rbac.Permission, roles []*database.Role, roleID uint, permissions []rbac.Permission, membership *database.Membership) error {
+	membership.RoleID = nil
+	membership.Role = nil
+
+	if roleID == 0 {
+		compiled, err := rbac.CompileAndAuthorize(grantor, permissions)
+		membership.Permissions = compiled
+		return err
+	}
+
+	for _, role := range roles {
+		if role.ID != roleID {
+			continue
+		}
+
+		if _, err := rbac.CompileAndAuthorize(grantor, rbac.Permissions(role.Permissions)); err != nil {
+			return err
+		}
+
+		id := role.ID
+		membership.RoleID = &id
+		membership.Role = role
+		membership.Permissions = role.Permissions
+		return nil
+	}
+	return fmt.Errorf("role %d does not exist", roleID)
+}
+
+// bindExpiry parses the membership's last day, formatted as YYYY-MM-DD, into
+// its expiry. An empty value means the membership does not expire. On error,
+// the membership's expiry is unchanged.
+func bindExpiry(expiresOn string, membership *database.Membership) error {
+	expiresAt, err := database.ParseExpiresOn(expiresOn)
+	if err != nil {
+		return err
+	}
+	membership.ExpiresAt = expiresAt
+	return nil
+}
+
+// saveMembership adds the user to the realm with the membership's role or, if
+// the membership has no role, with the membership's permissions, and then sets
+// the membership's expiry.
+func saveMembership(db *database.Database, user *database.User, realm *database.Realm, membership *database.Membership, actor database.Auditable) error {
+	if membership.Role != nil {
+		if err := user.AddToRealmWithRole(db, realm, membership.Role, actor); err != nil {
+			return err
+		}
+	} else {
+		if err := user.AddToRealm(db, realm, membership.Permissions, actor); err != nil {
+			return err
+		}
+	}
+	return user.UpdateMembershipExpiry(db, realm, membership.ExpiresAt, actor)
+}
@@ -73,6 +73,26 @@ func (c *Controller) HandleVerify() http.Handler {
 			return
 		}
 
+		// Remove any grouping from the code. Then reject codes whose check digit
+		// does not match before looking them up, so that typos do not count as
+		// invalid codes.
+		code := request.VerificationCode
+		if realm := controller.RealmFromContext(ctx); realm != nil {
+			code = realm.NormalizeCode(code)
+
+			if realm.IsCodeTypo(code, now) {
+				blame = enobs.BlameClient
+				result = enobs.ResultError("VERIFICATION_CODE_TYPO")
+
+				if err := realm.RecordCodeTypo(c.db, now); err != nil {
+					logger.Errorw("failed to record code typo", "error", err)
+				}
+
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code invalid, please check it was entered correctly").WithCode(api.ErrVerifyCodeTypo))
+				return
+			}
+		}
+
 		// Get the currently active key.
 		activeTokenSigningKey, err := c.db.ActiveTokenSigningKeyCached(ctx, c.cacher)
 		if err != nil {
@@ -122,7 +142,7 @@ func (c *Controller) HandleVerify() http.Handler {
 		tokenRequest := &database.IssueTokenRequest{
 			Time:        now,
 			AuthApp:     authApp,
-			VerCode:     request.VerificationCode,
+			VerCode:     code,
 			AcceptTypes: acceptTypes,
 			ExpireAfter: c.config.VerificationTokenDuration,
 			Nonce:       nonce,
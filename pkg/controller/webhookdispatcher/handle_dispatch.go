@@ -0,0 +1,189 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhookdispatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// maxErrorBodyBytes is the maximum number of bytes of an unsuccessful response
+// body recorded in the delivery log.
+const maxErrorBodyBytes = 256
+
+// HandleDispatch accepts an HTTP trigger, queues events for codes which have
+// expired unclaimed, and delivers the next batch of queued events.
+func (c *Controller) HandleDispatch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("webhookdispatcher.HandleDispatch")
+		logger.Debugw("starting")
+		defer logger.Debugw("finishing")
+
+		ok, err := c.db.TryLock(ctx, webhookDispatcherLock, c.config.MinPeriod)
+		if err != nil {
+			logger.Errorw("failed to acquire lock", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			logger.Debugw("skipping (too early)")
+			c.h.RenderJSON(w, http.StatusOK, fmt.Errorf("too early"))
+			return
+		}
+
+		expired, err := c.db.EnqueueExpiredCodeEvents(c.config.BatchSize)
+		if err != nil {
+			logger.Errorw("failed to queue expired code events", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		stats.Record(ctx, mExpired.M(int64(expired)))
+		logger.Debugw("queued expired code events", "count", expired)
+
+		deliveries, err := c.db.ClaimWebhookDeliveries(c.config.BatchSize, c.config.LeaseDuration)
+		if err != nil {
+			logger.Errorw("failed to claim deliveries", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Debugw("claimed deliveries", "count", len(deliveries))
+
+		// Look up each subscription once per batch. If the lookup fails, the
+		// subscription's deliveries are left claimed and are retried once their
+		// lease expires.
+		subscriptions := make(map[uint]*database.WebhookSubscription)
+		for _, d := range deliveries {
+			if _, ok := subscriptions[d.WebhookSubscriptionID]; ok {
+				continue
+			}
+
+			subscription, err := c.db.FindWebhookSubscription(d.WebhookSubscriptionID)
+			if err != nil {
+				if !database.IsNotFound(err) {
+					logger.Errorw("failed to find webhook subscription", "id", d.WebhookSubscriptionID, "error", err)
+				}
+				continue
+			}
+			subscriptions[d.WebhookSubscriptionID] = subscription
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, c.config.Concurrency)
+		for _, d := range deliveries {
+			subscription, ok := subscriptions[d.WebhookSubscriptionID]
+			if !ok {
+				continue
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(d *database.WebhookDelivery, subscription *database.WebhookSubscription) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				if err := c.deliver(ctx, d, subscription); err != nil {
+					logger.Errorw("failed to update delivery", "id", d.ID, "error", err)
+				}
+			}(d, subscription)
+		}
+		wg.Wait()
+
+		stats.Record(ctx, mSuccess.M(1))
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+// deliver sends the delivery's payload to the subscription and records the
+// outcome. Failed requests are retried with exponential backoff until the
+// maximum number of attempts is reached. The returned error is only non-nil if
+// the outcome could not be saved.
+func (c *Controller) deliver(ctx context.Context, d *database.WebhookDelivery, subscription *database.WebhookSubscription) error {
+	logger := logging.FromContext(ctx).Named("webhookdispatcher.deliver").
+		With("id", d.ID).
+		With("realm", d.RealmID).
+		With("subscription", subscription.ID)
+
+	var result tag.Mutator
+	defer func() {
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{result}, mDeliveries.M(1))
+	}()
+
+	statusCode, err := c.send(ctx, d, subscription)
+	if err != nil {
+		if d.Attempts >= c.config.MaxAttempts {
+			logger.Infow("failed to deliver webhook", "attempts", d.Attempts, "error", err)
+			result = enobs.ResultError("FAILED")
+			d.MarkFailed(statusCode, err.Error())
+			return c.db.SaveWebhookDelivery(d)
+		}
+
+		delay := backoff(d.Attempts, c.config.RetryBaseDelay, c.config.RetryMaxDelay)
+		logger.Debugw("failed to deliver webhook, retrying", "attempts", d.Attempts, "delay", delay, "error", err)
+		result = enobs.ResultError("RETRY")
+		d.MarkRetry(statusCode, err.Error(), delay)
+		return c.db.SaveWebhookDelivery(d)
+	}
+
+	result = enobs.ResultOK
+	d.MarkSucceeded(statusCode)
+	return c.db.SaveWebhookDelivery(d)
+}
+
+// send posts the signed payload to the subscription URL. It returns the
+// response status code, or 0 if no response was received. Any non-2xx
+// response is an error.
+func (c *Controller) send(ctx context.Context, d *database.WebhookDelivery, subscription *database.WebhookSubscription) (int, error) {
+	body := []byte(d.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, sign(subscription.Secret, body))
+	req.Header.Set(EventHeader, string(d.Event))
+	req.Header.Set(DeliveryIDHeader, strconv.FormatUint(uint64(d.ID), 10))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || code > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return code, fmt.Errorf("unsuccessful response (%d): %s", code, bytes.TrimSpace(b))
+	}
+
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhookdispatcher
+
+import (
+	enobs "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+const metricPrefix = observability.MetricRoot + "/webhook_dispatcher"
+
+var (
+	mSuccess    = stats.Int64(metricPrefix+"/success", "successful execution", stats.UnitDimensionless)
+	mDeliveries = stats.Int64(metricPrefix+"/deliveries", "The number of deliveries attempted.", stats.UnitDimensionless)
+	mExpired    = stats.Int64(metricPrefix+"/expired_codes", "The number of expired codes for which events were queued.", stats.UnitDimensionless)
+)
+
+func init() {
+	enobs.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/success",
+			Description: "Number of successes",
+			TagKeys:     observability.CommonTagKeys(),
+			Measure:     mSuccess,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/deliveries_count",
+			Description: "The count of attempted deliveries, by result",
+			TagKeys:     append(observability.CommonTagKeys(), enobs.ResultTagKey),
+			Measure:     mDeliveries,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/expired_codes",
+			Description: "The number of expired codes for which events were queued",
+			TagKeys:     observability.CommonTagKeys(),
+			Measure:     mExpired,
+			Aggregation: view.Sum(),
+		},
+	}...)
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhookdispatcher implements delivery of verification code events to
+// realm webhook subscriptions.
+package webhookdispatcher
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+const webhookDispatcherLock = "webhookDispatcherLock"
+
+const (
+	// SignatureHeader is the header containing the hex-encoded HMAC-SHA512 of
+	// the request body, keyed with the subscription secret.
+	SignatureHeader = "X-Signature"
+
+	// EventHeader is the header containing the event type.
+	EventHeader = "X-Event"
+
+	// DeliveryIDHeader is the header containing the unique ID of the delivery.
+	// It is the same for every attempt, so receivers can discard duplicates.
+	DeliveryIDHeader = "X-Delivery-ID"
+)
+
+// Controller is a controller for the webhook dispatcher service.
+type Controller struct {
+	config     *config.WebhookDispatcherConfig
+	db         *database.Database
+	h          *render.Renderer
+	httpClient *http.Client
+}
+
+// New creates a new webhook dispatcher controller.
+func New(config *config.WebhookDispatcherConfig, db *database.Database, h *render.Renderer) *Controller {
+	return &Controller{
+		config: config,
+		db:     db,
+		h:      h,
+		httpClient: &http.Client{
+			Timeout: config.RequestTimeout,
+		},
+	}
+}
+
+// sign returns the hex-encoded HMAC-SHA512 of the body using the secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay before the next delivery attempt, given the number
+// of attempts made so far. The delay doubles with each attempt, starting at
+// base, and is capped at max.
+func backoff(attempts uint, base, max time.Duration) time.Duration {
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	delay := base
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+	return delay
+}
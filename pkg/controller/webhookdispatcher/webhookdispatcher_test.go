@@ -0,0 +1,90 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhookdispatcher
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	secret := "my-super-secret"
+	body := []byte(`{"event":"code.claimed"}`)
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if got := sign(secret, body); got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if got := sign("other-secret", body); got == want {
+		t.Errorf("expected signatures with different secrets to differ")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		attempts uint
+		exp      time.Duration
+	}{
+		{
+			name:     "zero",
+			attempts: 0,
+			exp:      time.Minute,
+		},
+		{
+			name:     "first",
+			attempts: 1,
+			exp:      time.Minute,
+		},
+		{
+			name:     "third",
+			attempts: 3,
+			exp:      4 * time.Minute,
+		},
+		{
+			name:     "capped",
+			attempts: 10,
+			exp:      time.Hour,
+		},
+		{
+			name:     "overflow",
+			attempts: 1000,
+			exp:      time.Hour,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := backoff(tc.attempts, time.Minute, time.Hour), tc.exp; got != want {
+				t.Errorf("expected %s to be %s", got, want)
+			}
+		})
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
 	"github.com/gorilla/mux"
 	"go.opencensus.io/stats"
 )
@@ -96,75 +97,111 @@ func (c *Controller) HandleTwilio() http.Handler {
 		}
 
 		// If we got this far, this is a webhook request for which we should
-		// increment a metric. Find the realm based on the URL param.
+		// increment a metric. Find the realm based on the URL param and verify
+		// the request signature.
 		logger = logger.With("realm_id", vars["realm_id"])
-		realm, err := c.db.FindRealm(vars["realm_id"])
-		if err != nil {
-			logger.Warnw("failed to lookup realm", "error", err)
+		realm, ok := c.verifyTwilioRequest(w, r, vars["realm_id"], givenSignature)
+		if !ok {
+			return
+		}
 
-			if database.IsNotFound(err) {
-				controller.BadRequest(w, r, c.h)
-				return
-			}
+		// If we got this far, the message passed the signature check.
+		ctx = observability.WithRealmID(ctx, uint64(realm.ID))
+		ctx = observability.WithErrorCode(ctx, payload.ErrorCode)
+		defer stats.Record(ctx, mTwilioErrors.M(1))
 
+		if err := c.db.InsertSMSErrorStat(realm.ID, payload.ErrorCode); err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		// Look up the sms configuration for the realm. This is necessary because
-		// Twilio uses the auth token as the HMAC key.
-		smsConfig, err := realm.SMSConfig(c.db)
-		if err != nil {
-			logger.Warnw("failed to lookup realm sms config", "error", err)
+		c.h.RenderJSON(w, http.StatusOK, nil)
+		return
+	})
+}
 
-			if database.IsNotFound(err) {
-				controller.BadRequest(w, r, c.h)
-				return
-			}
+// verifyTwilioRequest finds the realm with the given ID and verifies that the
+// request was signed by one of the realm's Twilio accounts. The request form
+// must already be parsed. If verification fails, it renders an error and
+// returns false.
+func (c *Controller) verifyTwilioRequest(w http.ResponseWriter, r *http.Request, realmID, givenSignature string) (*database.Realm, bool) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx).Named("webhooks.verifyTwilioRequest").
+		With("realm_id", realmID)
 
-			controller.InternalError(w, r, c.h, err)
-			return
+	realm, err := c.db.FindRealm(realmID)
+	if err != nil {
+		logger.Warnw("failed to lookup realm", "error", err)
+
+		if database.IsNotFound(err) {
+			controller.BadRequest(w, r, c.h)
+			return nil, false
 		}
 
-		// Sanity check account sids.
-		if got, want := r.Form.Get("AccountSid"), smsConfig.TwilioAccountSid; got != want {
-			logger.Warnw("twilio account sid mismatch",
-				"got", got,
-				"want", want)
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+
+	// Look up the sms configuration for the realm. This is necessary because
+	// Twilio uses the auth token as the HMAC key.
+	smsConfig, err := realm.SMSConfig(c.db)
+	if err != nil {
+		logger.Warnw("failed to lookup realm sms config", "error", err)
+
+		if database.IsNotFound(err) {
 			controller.BadRequest(w, r, c.h)
-			return
+			return nil, false
 		}
 
-		// Calculate the expected signature.
-		expSignature, err := ComputeSignature(r, smsConfig.TwilioAuthToken)
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+
+	// The callback could be for one of the realm's failover configurations if
+	// the realm uses more than one Twilio account.
+	if accountSid := r.Form.Get("AccountSid"); accountSid != smsConfig.TwilioAccountSid {
+		failoverConfigs, err := realm.SMSFailoverConfigs(c.db)
 		if err != nil {
-			logger.Errorw("failed to compute twilio signature", "error", err)
+			logger.Warnw("failed to lookup realm failover sms configs", "error", err)
 			controller.InternalError(w, r, c.h, err)
-			return
+			return nil, false
 		}
 
-		// Compare the expected signature with the given signature.
-		if subtle.ConstantTimeCompare([]byte(givenSignature), []byte(expSignature)) != 1 {
-			logger.Debugw("signature mismatch",
-				"given", givenSignature,
-				"expected", expSignature)
-			controller.BadRequest(w, r, c.h)
-			return
+		for _, failoverConfig := range failoverConfigs {
+			if failoverConfig.ProviderType == sms.ProviderTypeTwilio && failoverConfig.TwilioAccountSid == accountSid {
+				smsConfig = failoverConfig
+				break
+			}
 		}
+	}
 
-		// If we got this far, the message passed the signature check.
-		ctx = observability.WithRealmID(ctx, uint64(realm.ID))
-		ctx = observability.WithErrorCode(ctx, payload.ErrorCode)
-		defer stats.Record(ctx, mTwilioErrors.M(1))
+	// Sanity check account sids.
+	if got, want := r.Form.Get("AccountSid"), smsConfig.TwilioAccountSid; got != want {
+		logger.Warnw("twilio account sid mismatch",
+			"got", got,
+			"want", want)
+		controller.BadRequest(w, r, c.h)
+		return nil, false
+	}
 
-		if err := c.db.InsertSMSErrorStat(realm.ID, payload.ErrorCode); err != nil {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
+	// Calculate the expected signature.
+	expSignature, err := ComputeSignature(r, smsConfig.TwilioAuthToken)
+	if err != nil {
+		logger.Errorw("failed to compute twilio signature", "error", err)
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
 
-		c.h.RenderJSON(w, http.StatusOK, nil)
-		return
-	})
+	// Compare the expected signature with the given signature.
+	if subtle.ConstantTimeCompare([]byte(givenSignature), []byte(expSignature)) != 1 {
+		logger.Debugw("signature mismatch",
+			"given", givenSignature,
+			"expected", expSignature)
+		controller.BadRequest(w, r, c.h)
+		return nil, false
+	}
+
+	return realm, true
 }
 
 // ComputeSignature builds the expected webhook signature from a Twilio request
@@ -0,0 +1,120 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/gorilla/mux"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// twilioMessageStatuses maps Twilio's message statuses to delivery statuses.
+// Statuses which are not listed (such as "receiving") do not apply to
+// outbound messages and are ignored.
+//
+// https://www.twilio.com/docs/sms/api/message-resource#message-status-values
+var twilioMessageStatuses = map[string]database.SMSDeliveryStatus{
+	"accepted":    database.SMSDeliveryStatusQueued,
+	"scheduled":   database.SMSDeliveryStatusQueued,
+	"queued":      database.SMSDeliveryStatusQueued,
+	"sending":     database.SMSDeliveryStatusQueued,
+	"sent":        database.SMSDeliveryStatusSent,
+	"delivered":   database.SMSDeliveryStatusDelivered,
+	"read":        database.SMSDeliveryStatusDelivered,
+	"undelivered": database.SMSDeliveryStatusUndelivered,
+	"failed":      database.SMSDeliveryStatusUndelivered,
+	"canceled":    database.SMSDeliveryStatusUndelivered,
+}
+
+// TwilioStatusCallbackURL returns the URL to which Twilio reports the delivery
+// status of the SMS containing the verification code with the given UUID. The
+// URL identifies the code by its UUID, so the phone number is never stored. It
+// returns the empty string if endpoint is empty.
+func TwilioStatusCallbackURL(endpoint string, realmID uint, uuid string) string {
+	if endpoint == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/webhooks/%d/twilio/status/%s",
+		strings.TrimSuffix(endpoint, "/"), realmID, uuid)
+}
+
+// HandleTwilioStatus handles Twilio message status callbacks, recording the
+// carrier's delivery status on the verification code.
+func (c *Controller) HandleTwilioStatus() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("webhooks.HandleTwilioStatus")
+		vars := mux.Vars(r)
+
+		// Ensure the header is present. It is validated after the realm lookup.
+		givenSignature := r.Header.Get("X-Twilio-Signature")
+		if givenSignature == "" {
+			logger.Debug("request is missing signature header")
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			logger.Errorw("failed to parse form", "error", err)
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		// Ignore statuses which do not correspond to a delivery status.
+		messageStatus := strings.ToLower(strings.TrimSpace(r.Form.Get("MessageStatus")))
+		status, ok := twilioMessageStatuses[messageStatus]
+		if !ok {
+			logger.Debugw("ignoring message status", "value", messageStatus)
+			c.h.RenderJSON(w, http.StatusOK, nil)
+			return
+		}
+
+		logger = logger.With("realm_id", vars["realm_id"])
+		realm, ok := c.verifyTwilioRequest(w, r, vars["realm_id"], givenSignature)
+		if !ok {
+			return
+		}
+
+		// If we got this far, the message passed the signature check.
+		ctx = observability.WithRealmID(ctx, uint64(realm.ID))
+		defer func() {
+			_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(statusTagKey, string(status))}, mTwilioStatuses.M(1))
+		}()
+
+		if err := c.db.UpdateSMSDeliveryStatus(realm.ID, vars["uuid"], status); err != nil {
+			// The code may have been deleted or purged before the carrier reported
+			// the final status. Twilio retries on errors, so accept the callback.
+			if database.IsNotFound(err) {
+				logger.Debugw("verification code not found")
+				c.h.RenderJSON(w, http.StatusOK, nil)
+				return
+			}
+
+			logger.Errorw("failed to update sms delivery status", "error", err)
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhooks_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/webhooks"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTwilioStatusCallbackURL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		endpoint string
+		exp      string
+	}{
+		{
+			name:     "empty",
+			endpoint: "",
+			exp:      "",
+		},
+		{
+			name:     "endpoint",
+			endpoint: "https://example.com",
+			exp:      "https://example.com/webhooks/12/twilio/status/abc",
+		},
+		{
+			name:     "trailing_slash",
+			endpoint: "https://example.com/",
+			exp:      "https://example.com/webhooks/12/twilio/status/abc",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := webhooks.TwilioStatusCallbackURL(tc.endpoint, 12, "abc"), tc.exp; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleTwilioStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+	harness := envstest.NewServerConfig(t, testDatabaseInstance)
+
+	realm := database.NewRealmWithDefaults("realm-with-sms")
+	if err := harness.Database.SaveRealm(realm, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	smsConfig := &database.SMSConfig{
+		RealmID:          realm.ID,
+		ProviderType:     sms.ProviderTypeTwilio,
+		TwilioAccountSid: "abc123",
+		TwilioFromNumber: "+15005550006",
+		TwilioAuthToken:  "abc123",
+	}
+	if err := harness.Database.SaveSMSConfig(smsConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	c := webhooks.New(harness.Cacher, harness.Database, harness.Renderer)
+
+	// newCode creates a verification code for the test to update.
+	newCode := func(tb testing.TB, code string) *database.VerificationCode {
+		tb.Helper()
+
+		vc := &database.VerificationCode{
+			RealmID:       realm.ID,
+			Code:          code,
+			LongCode:      code + "ABC",
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(time.Hour),
+		}
+		if err := harness.Database.SaveVerificationCode(vc, realm); err != nil {
+			tb.Fatal(err)
+		}
+		return vc
+	}
+
+	// sendStatus sends a signed status callback and returns the response.
+	sendStatus := func(tb testing.TB, uuid, body string, signed bool) (*httptest.ResponseRecorder, *observer.ObservedLogs) {
+		tb.Helper()
+
+		// Create custom logger which we can observe for log messages
+		logCore, logObserver := observer.New(zap.DebugLevel)
+		ctx := logging.WithLogger(ctx, zap.New(logCore).Sugar())
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r = r.Clone(ctx)
+		r = mux.SetURLVars(r, map[string]string{
+			"realm_id": fmt.Sprintf("%d", realm.ID),
+			"uuid":     uuid,
+		})
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		signature := "abc123"
+		if signed {
+			sig, err := webhooks.ComputeSignature(r, smsConfig.TwilioAuthToken)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			signature = sig
+		}
+		r.Header.Set("X-Twilio-Signature", signature)
+
+		w := httptest.NewRecorder()
+		c.HandleTwilioStatus().ServeHTTP(w, r)
+		return w, logObserver
+	}
+
+	t.Run("missing_signature", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("MessageStatus=delivered"))
+		r = r.Clone(ctx)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		c.HandleTwilioStatus().ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected response to be %d, got %d: %s", want, got, w.Body.String())
+		}
+	})
+
+	t.Run("ignored_status", func(t *testing.T) {
+		t.Parallel()
+
+		w, logs := sendStatus(t, "", "MessageStatus=receiving&AccountSid=abc123", false)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("expected response to be %d, got %d: %s", want, got, w.Body.String())
+		}
+		if got, want := logs.All()[0].Message, "ignoring message status"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("bad_signature", func(t *testing.T) {
+		t.Parallel()
+
+		vc := newCode(t, "10000001")
+
+		w, _ := sendStatus(t, vc.UUID, "MessageStatus=delivered&AccountSid=abc123", false)
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected response to be %d, got %d: %s", want, got, w.Body.String())
+		}
+	})
+
+	t.Run("code_not_found", func(t *testing.T) {
+		t.Parallel()
+
+		w, _ := sendStatus(t, "5148c75c-2bc5-4874-9d1c-f9185a0e1b8a", "MessageStatus=delivered&AccountSid=abc123", true)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("expected response to be %d, got %d: %s", want, got, w.Body.String())
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		vc := newCode(t, "10000002")
+
+		for _, status := range []string{"sent", "delivered", "sent"} {
+			w, _ := sendStatus(t, vc.UUID, "MessageStatus="+status+"&AccountSid=abc123", true)
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("expected response to be %d, got %d: %s", want, got, w.Body.String())
+			}
+		}
+
+		// The late "sent" must not move the code backwards.
+		record, err := realm.FindVerificationCodeByUUID(harness.Database, vc.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := record.SMSDeliveryStatus, database.SMSDeliveryStatusDelivered; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+}
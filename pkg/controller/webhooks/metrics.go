@@ -20,11 +20,17 @@ import (
 
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 )
 
 const metricPrefix = observability.MetricRoot + "/webhooks"
 
-var mTwilioErrors = stats.Int64(metricPrefix+"/twilio_errors", "The number of Twilio errors.", stats.UnitDimensionless)
+var (
+	mTwilioErrors   = stats.Int64(metricPrefix+"/twilio_errors", "The number of Twilio errors.", stats.UnitDimensionless)
+	mTwilioStatuses = stats.Int64(metricPrefix+"/twilio_statuses", "The number of Twilio message status callbacks.", stats.UnitDimensionless)
+
+	statusTagKey = tag.MustNewKey("status")
+)
 
 func init() {
 	enobs.CollectViews([]*view.View{
@@ -35,5 +41,12 @@ func init() {
 			TagKeys:     observability.CommonTagKeys(),
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        metricPrefix + "/twilio_statuses",
+			Measure:     mTwilioStatuses,
+			Description: "The count of Twilio message status callbacks, tagged by realm and status.",
+			TagKeys:     append(observability.CommonTagKeys(), statusTagKey),
+			Aggregation: view.Count(),
+		},
 	}...)
 }
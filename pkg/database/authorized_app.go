@@ -21,6 +21,8 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -29,11 +31,22 @@ import (
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/digest"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 const (
 	apiKeyBytes = 64 // 64 bytes is 86 chararacters in non-padded base64.
+
+	// MaxAPIKeyRotationGracePeriod is the longest time for which the previous
+	// API key continues to work after a rotation.
+	MaxAPIKeyRotationGracePeriod = 30 * 24 * time.Hour
+
+	// apiKeyMatchSQL matches an API key by its current HMAC, or by its previous
+	// HMAC during the rotation grace period.
+	apiKeyMatchSQL = "api_key IN (?) OR (previous_api_key IN (?) AND previous_api_key_expires_at > ?)"
 )
 
 type APIKeyType int
@@ -60,6 +73,59 @@ func (a APIKeyType) Display() string {
 	}
 }
 
+// APIKeyScope is an admin API endpoint to which an admin API key can be
+// restricted.
+type APIKeyScope string
+
+const (
+	// APIKeyScopeIssue permits issuing a single code via /api/issue.
+	APIKeyScopeIssue APIKeyScope = "issue"
+
+	// APIKeyScopeBatchIssue permits issuing codes in bulk via /api/batch-issue,
+	// including the batch issue jobs APIs.
+	APIKeyScopeBatchIssue APIKeyScope = "batch-issue"
+
+	// APIKeyScopeCheckCodeStatus permits checking the status of a code via
+	// /api/checkcodestatus.
+	APIKeyScopeCheckCodeStatus APIKeyScope = "checkcodestatus"
+
+	// APIKeyScopeExpireCode permits expiring a code via /api/expirecode.
+	APIKeyScopeExpireCode APIKeyScope = "expirecode"
+)
+
+// APIKeyScopes is the list of all API key scopes, in display order.
+var APIKeyScopes = []APIKeyScope{
+	APIKeyScopeIssue,
+	APIKeyScopeBatchIssue,
+	APIKeyScopeCheckCodeStatus,
+	APIKeyScopeExpireCode,
+}
+
+// Display returns a human-readable description of the scope.
+func (s APIKeyScope) Display() string {
+	switch s {
+	case APIKeyScopeIssue:
+		return "Issue codes"
+	case APIKeyScopeBatchIssue:
+		return "Bulk issue codes"
+	case APIKeyScopeCheckCodeStatus:
+		return "Check code status"
+	case APIKeyScopeExpireCode:
+		return "Expire codes"
+	default:
+		return string(s)
+	}
+}
+
+func isAPIKeyScope(s APIKeyScope) bool {
+	for _, v := range APIKeyScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 var _ Auditable = (*AuthorizedApp)(nil)
 
 // AuthorizedApp represents an application that is authorized to verify
@@ -93,6 +159,52 @@ type AuthorizedApp struct {
 	// performance reasons, this not incremented on each use but rather in short
 	// buckets to avoid a write on every read.
 	LastUsedAt *time.Time `gorm:"column:last_used_at; type:timestamp with time zone;"`
+
+	// Permissions are the permissions of an admin API key on the realm
+	// management endpoints of the admin API. Like a user, an API key can only
+	// grant permissions it has. Only admin API keys have permissions.
+	Permissions rbac.Permission `gorm:"column:permissions; type:bigint; not null; default:0;"`
+
+	// Scopes restricts an admin API key to the listed APIKeyScopes. If empty, the
+	// API key can use all of the code APIs.
+	Scopes pq.StringArray `gorm:"column:scopes; type:text[];"`
+
+	// AllowedTestTypes restricts the test types an admin API key can issue. If
+	// zero, the API key can issue all of the realm's allowed test types.
+	AllowedTestTypes TestType `gorm:"column:allowed_test_types; type:smallint; not null; default:0;"`
+
+	// AllowedCIDRs is the list of CIDR blocks from which the API key can be used.
+	// This is in addition to the realm's firewall. If empty, the API key can be
+	// used from any IP.
+	AllowedCIDRs pq.StringArray `gorm:"column:allowed_cidrs; type:varchar(50)[];"`
+
+	// ExpiresAt is the time at which the API key stops working. If nil, the API
+	// key does not expire.
+	ExpiresAt *time.Time `gorm:"column:expires_at; type:timestamp with time zone;"`
+
+	// RequestsPerMinute is the maximum number of requests per minute the API key
+	// can make. If 0, only the server's rate limit applies.
+	RequestsPerMinute uint `gorm:"column:requests_per_minute; type:integer; not null; default:0;"`
+
+	// DailyIssueLimit is the maximum number of codes an admin API key can issue
+	// per day. If 0, only the realm's quota applies.
+	DailyIssueLimit uint `gorm:"column:daily_issue_limit; type:integer; not null; default:0;"`
+
+	// PreviousAPIKey is the HMACed API key replaced by the most recent rotation.
+	// It continues to work until PreviousAPIKeyExpiresAt so that the API key can
+	// be rotated without downtime. PreviousAPIKeyLastUsedAt is tracked the same
+	// way as LastUsedAt.
+	PreviousAPIKey           string     `gorm:"column:previous_api_key; type:varchar(512);"`
+	PreviousAPIKeyPreview    string     `gorm:"column:previous_api_key_preview; type:varchar(32);"`
+	PreviousAPIKeyExpiresAt  *time.Time `gorm:"column:previous_api_key_expires_at; type:timestamp with time zone;"`
+	PreviousAPIKeyLastUsedAt *time.Time `gorm:"column:previous_api_key_last_used_at; type:timestamp with time zone;"`
+
+	// RotatedAt is the time at which the API key was last rotated.
+	RotatedAt *time.Time `gorm:"column:rotated_at; type:timestamp with time zone;"`
+
+	// UsingPreviousAPIKey is true if the authorized app was found by its
+	// previous API key. It is not stored in the database.
+	UsingPreviousAPIKey bool `gorm:"-"`
 }
 
 // BeforeSave runs validations. If there are errors, the save fails.
@@ -107,9 +219,151 @@ func (a *AuthorizedApp) BeforeSave(tx *gorm.DB) error {
 		a.AddError("type", "is invalid")
 	}
 
+	if a.Permissions != 0 && a.APIKeyType != APIKeyTypeAdmin {
+		a.AddError("permissions", "can only be granted to admin API keys")
+	}
+
+	if len(a.Scopes) > 0 && a.APIKeyType != APIKeyTypeAdmin {
+		a.AddError("scopes", "can only be set on admin API keys")
+	}
+	for _, v := range a.Scopes {
+		if !isAPIKeyScope(APIKeyScope(v)) {
+			a.AddError("scopes", fmt.Sprintf("unknown scope %q", v))
+		}
+	}
+
+	if a.AllowedTestTypes != 0 && a.APIKeyType != APIKeyTypeAdmin {
+		a.AddError("allowedTestTypes", "can only be set on admin API keys")
+	}
+
+	for _, v := range a.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			a.AddError("allowedCIDRs", fmt.Sprintf("%q is not a valid CIDR block", v))
+		}
+	}
+
+	if a.DailyIssueLimit != 0 && a.APIKeyType != APIKeyTypeAdmin {
+		a.AddError("dailyIssueLimit", "can only be set on admin API keys")
+	}
+
 	return a.ErrorOrNil()
 }
 
+// HasScope returns true if the API key can use the endpoints of the given
+// scope. An API key with no scopes can use all endpoints.
+func (a *AuthorizedApp) HasScope(s APIKeyScope) bool {
+	if a == nil {
+		return false
+	}
+	if len(a.Scopes) == 0 {
+		return true
+	}
+	for _, v := range a.Scopes {
+		if APIKeyScope(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRestrictedTo returns true if the API key's scopes explicitly include the
+// given scope. Unlike HasScope, it returns false for an API key with no scopes.
+func (a *AuthorizedApp) IsRestrictedTo(s APIKeyScope) bool {
+	return len(a.Scopes) > 0 && a.HasScope(s)
+}
+
+// HasAllowedTestType returns true if the API key's allowed test types
+// explicitly include the given test type.
+func (a *AuthorizedApp) HasAllowedTestType(t TestType) bool {
+	return a.AllowedTestTypes&t != 0
+}
+
+// ValidTestType returns true if the API key can issue codes of the given test
+// type. This does not check the realm's allowed test types.
+func (a *AuthorizedApp) ValidTestType(typ string) bool {
+	if a.AllowedTestTypes == 0 {
+		return true
+	}
+
+	switch project.TrimSpace(strings.ToLower(typ)) {
+	case "confirmed":
+		return a.AllowedTestTypes&TestTypeConfirmed != 0
+	case "likely":
+		return a.AllowedTestTypes&TestTypeLikely != 0
+	case "negative":
+		return a.AllowedTestTypes&TestTypeNegative != 0
+	case "user-report":
+		return a.AllowedTestTypes&TestTypeUserReport != 0
+	default:
+		return false
+	}
+}
+
+// AllowsIP returns true if the API key can be used from the given IP.
+func (a *AuthorizedApp) AllowsIP(ip net.IP) bool {
+	if len(a.AllowedCIDRs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range a.AllowedCIDRs {
+		_, cidr, err := net.ParseCIDR(v)
+		if err != nil {
+			continue
+		}
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPreviousAPIKey returns true if the API key was rotated and the previous
+// API key is still within its grace period.
+func (a *AuthorizedApp) HasPreviousAPIKey() bool {
+	return a != nil && a.PreviousAPIKey != "" &&
+		a.PreviousAPIKeyExpiresAt != nil && a.PreviousAPIKeyExpiresAt.After(time.Now())
+}
+
+// ClearPreviousAPIKey revokes the API key replaced by the most recent
+// rotation. The change must be saved with SaveAuthorizedApp.
+func (a *AuthorizedApp) ClearPreviousAPIKey() {
+	a.PreviousAPIKey = ""
+	a.PreviousAPIKeyPreview = ""
+	a.PreviousAPIKeyExpiresAt = nil
+	a.PreviousAPIKeyLastUsedAt = nil
+}
+
+// IsExpired returns true if the API key has an expiry which has passed.
+func (a *AuthorizedApp) IsExpired() bool {
+	return a != nil && a.ExpiresAt != nil && !a.ExpiresAt.After(time.Now())
+}
+
+// ExpiresOn returns the UTC date on which the API key expires, formatted as
+// YYYY-MM-DD, or the empty string if the API key does not expire. This is the
+// last day on which the API key works.
+func (a *AuthorizedApp) ExpiresOn() string {
+	if a == nil || a.ExpiresAt == nil {
+		return ""
+	}
+	return a.ExpiresAt.UTC().Add(-time.Nanosecond).Format(project.RFC3339Date)
+}
+
+// Can returns true if the API key has the given permission, false otherwise.
+func (a *AuthorizedApp) Can(p rbac.Permission) bool {
+	if a == nil {
+		return false
+	}
+	return rbac.Can(a.Permissions, p)
+}
+
+// PermissionNames returns the sorted names of the API key's permissions.
+func (a *AuthorizedApp) PermissionNames() []string {
+	return rbac.PermissionNames(a.Permissions)
+}
+
 func (a *AuthorizedApp) IsAdminType() bool {
 	return a.APIKeyType == APIKeyTypeAdmin
 }
@@ -173,12 +427,13 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 		// Find the API key that matches the constraints.
 		var app AuthorizedApp
 		if err := db.db.
-			Where("api_key IN (?)", hmacedKeys).
+			Where(apiKeyMatchSQL, hmacedKeys, hmacedKeys, time.Now().UTC()).
 			Where("realm_id = ?", realmID).
 			First(&app).
 			Error; err != nil {
 			return nil, err
 		}
+		app.UsingPreviousAPIKey = !containsString(hmacedKeys, app.APIKey)
 		return &app, nil
 	}
 
@@ -191,11 +446,12 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 
 	var app AuthorizedApp
 	if err := db.db.
-		Or("api_key IN (?)", hmacedKeys).
+		Where(apiKeyMatchSQL, hmacedKeys, hmacedKeys, time.Now().UTC()).
 		First(&app).
 		Error; err != nil {
 		return nil, err
 	}
+	app.UsingPreviousAPIKey = !containsString(hmacedKeys, app.APIKey)
 	return &app, nil
 }
 
@@ -221,7 +477,9 @@ func (a *AuthorizedApp) Stats(db *Database) (AuthorizedAppStats, error) {
 			COALESCE(s.codes_claimed, 0) AS codes_claimed,
 			COALESCE(s.codes_invalid, 0) AS codes_invalid,
 			COALESCE(s.tokens_claimed, 0) AS tokens_claimed,
-			COALESCE(s.tokens_invalid, 0) AS tokens_invalid
+			COALESCE(s.tokens_invalid, 0) AS tokens_invalid,
+			COALESCE(s.requests_rate_limited, 0) AS requests_rate_limited,
+			COALESCE(s.codes_quota_exceeded, 0) AS codes_quota_exceeded
 		FROM (
 			SELECT date::date FROM generate_series($4, $5, '1 day'::interval) date
 		) d
@@ -294,6 +552,16 @@ func (db *Database) SaveAuthorizedApp(a *AuthorizedApp, actor Auditable) error {
 			audit := BuildAuditEntry(actor, "created API key", a, a.RealmID)
 			audits = append(audits, audit)
 		} else {
+			if existing.APIKey != a.APIKey {
+				audit := BuildAuditEntry(actor, "rotated API key", a, a.RealmID)
+				audit.Diff = stringDiff(existing.APIKeyPreview, a.APIKeyPreview)
+				audits = append(audits, audit)
+			} else if existing.PreviousAPIKey != "" && a.PreviousAPIKey == "" {
+				audit := BuildAuditEntry(actor, "revoked previous API key", a, a.RealmID)
+				audit.Diff = stringDiff(existing.PreviousAPIKeyPreview, "")
+				audits = append(audits, audit)
+			}
+
 			if existing.Name != a.Name {
 				audit := BuildAuditEntry(actor, "updated API key name", a, a.RealmID)
 				audit.Diff = stringDiff(existing.Name, a.Name)
@@ -305,6 +573,48 @@ func (db *Database) SaveAuthorizedApp(a *AuthorizedApp, actor Auditable) error {
 				audit.Diff = boolDiff(existing.DeletedAt == nil, a.DeletedAt == nil)
 				audits = append(audits, audit)
 			}
+
+			if existing.Permissions != a.Permissions {
+				audit := BuildAuditEntry(actor, "updated API key permissions", a, a.RealmID)
+				audit.Diff = stringSliceDiff(rbac.PermissionNames(existing.Permissions), rbac.PermissionNames(a.Permissions))
+				audits = append(audits, audit)
+			}
+
+			if then, now := existing.Scopes, a.Scopes; !reflect.DeepEqual(then, now) {
+				audit := BuildAuditEntry(actor, "updated API key scopes", a, a.RealmID)
+				audit.Diff = stringSliceDiff(then, now)
+				audits = append(audits, audit)
+			}
+
+			if existing.AllowedTestTypes != a.AllowedTestTypes {
+				audit := BuildAuditEntry(actor, "updated API key allowed test types", a, a.RealmID)
+				audit.Diff = stringDiff(existing.AllowedTestTypes.Display(), a.AllowedTestTypes.Display())
+				audits = append(audits, audit)
+			}
+
+			if then, now := existing.AllowedCIDRs, a.AllowedCIDRs; !reflect.DeepEqual(then, now) {
+				audit := BuildAuditEntry(actor, "updated API key allowed cidrs", a, a.RealmID)
+				audit.Diff = stringSliceDiff(then, now)
+				audits = append(audits, audit)
+			}
+
+			if then, now := existing.ExpiresOn(), a.ExpiresOn(); then != now {
+				audit := BuildAuditEntry(actor, "updated API key expiry", a, a.RealmID)
+				audit.Diff = stringDiff(then, now)
+				audits = append(audits, audit)
+			}
+
+			if existing.RequestsPerMinute != a.RequestsPerMinute {
+				audit := BuildAuditEntry(actor, "updated API key rate limit", a, a.RealmID)
+				audit.Diff = uintDiff(existing.RequestsPerMinute, a.RequestsPerMinute)
+				audits = append(audits, audit)
+			}
+
+			if existing.DailyIssueLimit != a.DailyIssueLimit {
+				audit := BuildAuditEntry(actor, "updated API key daily issue limit", a, a.RealmID)
+				audit.Diff = uintDiff(existing.DailyIssueLimit, a.DailyIssueLimit)
+				audits = append(audits, audit)
+			}
 		}
 
 		// Save all audits
@@ -479,6 +789,16 @@ func (db *Database) VerifyAPIKeySignature(key string) (string, uint64, error) {
 	return apiKey, realmID, nil
 }
 
+// containsString returns true if the list contains the string.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *AuthorizedApp) AuditID() string {
 	return fmt.Sprintf("authorized_apps:%d", a.ID)
 }
@@ -487,16 +807,86 @@ func (a *AuthorizedApp) AuditDisplay() string {
 	return a.Name
 }
 
+// RateLimitKey returns the unique and consistent key to use for storing the
+// API key's rate limit data in the limiter.
+func (a *AuthorizedApp) RateLimitKey(hmacKey []byte) (string, error) {
+	dig, err := digest.HMACUint(a.ID, hmacKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create authorized app rate limit key: %w", err)
+	}
+	return fmt.Sprintf("authorized_app:ratelimit:%s", dig), nil
+}
+
+// QuotaKey returns the unique and consistent key to use for storing the API
+// key's daily issue quota data in the limiter.
+func (a *AuthorizedApp) QuotaKey(hmacKey []byte) (string, error) {
+	dig, err := digest.HMACUint(a.ID, hmacKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create authorized app quota key: %w", err)
+	}
+	return fmt.Sprintf("authorized_app:quota:%s", dig), nil
+}
+
+// RecordRateLimited records that a request from the API key was rejected by
+// its rate limit on the given date.
+func (a *AuthorizedApp) RecordRateLimited(db *Database, t time.Time) error {
+	return a.incrementStat(db, t, "requests_rate_limited")
+}
+
+// RecordQuotaExceeded records that a code issue request from the API key was
+// rejected by its daily issue limit on the given date.
+func (a *AuthorizedApp) RecordQuotaExceeded(db *Database, t time.Time) error {
+	return a.incrementStat(db, t, "codes_quota_exceeded")
+}
+
+// incrementStat increments the given column of the API key's stats for the
+// given date. The column must not be user input.
+func (a *AuthorizedApp) incrementStat(db *Database, t time.Time, column string) error {
+	sql := fmt.Sprintf(`
+		INSERT INTO authorized_app_stats(date, authorized_app_id, %[1]s)
+			VALUES ($1, $2, 1)
+		ON CONFLICT (date, authorized_app_id) DO UPDATE
+			SET %[1]s = authorized_app_stats.%[1]s + 1
+	`, column)
+
+	if err := db.db.Exec(sql, timeutils.UTCMidnight(t), a.ID).Error; err != nil {
+		return fmt.Errorf("failed to update authorized app stats %s: %w", column, err)
+	}
+	return nil
+}
+
+// SecretLastUsedAt returns the time at which the API key used in the request
+// was last used: the previous API key's if UsingPreviousAPIKey is set.
+func (a *AuthorizedApp) SecretLastUsedAt() *time.Time {
+	if a.UsingPreviousAPIKey {
+		return a.PreviousAPIKeyLastUsedAt
+	}
+	return a.LastUsedAt
+}
+
 // TouchLastUsedAt updates the timestamp at which the authorized app was last
-// used. It does not write an audit entry.
+// used. If the app was found by its previous API key, the previous API key's
+// timestamp is updated instead. It does not write an audit entry.
+//
+// Only the timestamp column is written, since the app may be a stale cached
+// copy.
 func (a *AuthorizedApp) TouchLastUsedAt(db *Database) error {
 	now := time.Now().UTC()
-	a.LastUsedAt = &now
+
+	column := "last_used_at"
+	if a.UsingPreviousAPIKey {
+		column = "previous_api_key_last_used_at"
+		a.PreviousAPIKeyLastUsedAt = &now
+	} else {
+		a.LastUsedAt = &now
+	}
+
 	if err := db.db.
 		Model(&AuthorizedApp{}).
-		Update(a).
+		Where("id = ?", a.ID).
+		UpdateColumn(column, now).
 		Error; err != nil {
-		return fmt.Errorf("failed to update last_used_at: %w", err)
+		return fmt.Errorf("failed to update %s: %w", column, err)
 	}
 	return nil
 }
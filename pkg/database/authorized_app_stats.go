@@ -51,6 +51,12 @@ type AuthorizedAppStat struct {
 	TokensClaimed uint `gorm:"column:tokens_claimed; type:integer; not null; default:0;"`
 	TokensInvalid uint `gorm:"column:tokens_invalid; type:integer; not null; default:0;"`
 
+	// RequestsRateLimited is the number of requests rejected by the API key's
+	// rate limit. CodesQuotaExceeded is the number of codes rejected by the API
+	// key's daily issue limit.
+	RequestsRateLimited uint `gorm:"column:requests_rate_limited; type:integer; not null; default:0;"`
+	CodesQuotaExceeded  uint `gorm:"column:codes_quota_exceeded; type:integer; not null; default:0;"`
+
 	// Non-database fields, these are added via the stats lookup using the join
 	// table.
 	AuthorizedAppName string `gorm:"-"`
@@ -71,6 +77,7 @@ func (s AuthorizedAppStats) MarshalCSV() ([]byte, error) {
 		"date", "authorized_app_id", "authorized_app_name", "authorized_app_type",
 		"codes_issued", "codes_claimed", "codes_invalid",
 		"tokens_claimed", "tokens_invalid",
+		"requests_rate_limited", "codes_quota_exceeded",
 	}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -86,6 +93,8 @@ func (s AuthorizedAppStats) MarshalCSV() ([]byte, error) {
 			strconv.FormatUint(uint64(stat.CodesInvalid), 10),
 			strconv.FormatUint(uint64(stat.TokensClaimed), 10),
 			strconv.FormatUint(uint64(stat.TokensInvalid), 10),
+			strconv.FormatUint(uint64(stat.RequestsRateLimited), 10),
+			strconv.FormatUint(uint64(stat.CodesQuotaExceeded), 10),
 		}); err != nil {
 			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
 		}
@@ -117,6 +126,9 @@ type jsonAuthorizedAppStatstatsData struct {
 	CodesInvalid  uint `json:"codes_invalid"`
 	TokensClaimed uint `json:"tokens_claimed"`
 	TokensInvalid uint `json:"tokens_invalid"`
+
+	RequestsRateLimited uint `json:"requests_rate_limited"`
+	CodesQuotaExceeded  uint `json:"codes_quota_exceeded"`
 }
 
 // MarshalJSON is a custom JSON marshaller.
@@ -136,6 +148,9 @@ func (s AuthorizedAppStats) MarshalJSON() ([]byte, error) {
 				CodesInvalid:  stat.CodesInvalid,
 				TokensClaimed: stat.TokensClaimed,
 				TokensInvalid: stat.TokensInvalid,
+
+				RequestsRateLimited: stat.RequestsRateLimited,
+				CodesQuotaExceeded:  stat.CodesQuotaExceeded,
 			},
 		})
 	}
@@ -179,6 +194,9 @@ func (s *AuthorizedAppStats) UnmarshalJSON(b []byte) error {
 			CodesInvalid:      stat.Data.CodesInvalid,
 			TokensClaimed:     stat.Data.TokensClaimed,
 			TokensInvalid:     stat.Data.TokensInvalid,
+
+			RequestsRateLimited: stat.Data.RequestsRateLimited,
+			CodesQuotaExceeded:  stat.Data.CodesQuotaExceeded,
 		})
 	}
 
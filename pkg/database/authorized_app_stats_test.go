@@ -41,21 +41,23 @@ func TestAuthorizedAppStats_MarshalCSV(t *testing.T) {
 			name: "single",
 			stats: []*AuthorizedAppStat{
 				{
-					Date:              time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
-					AuthorizedAppID:   1,
-					CodesIssued:       10,
-					CodesClaimed:      4,
-					CodesInvalid:      2,
-					TokensClaimed:     3,
-					TokensInvalid:     1,
-					AuthorizedAppName: "Appy",
-					AuthorizedAppType: "device",
+					Date:                time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+					AuthorizedAppID:     1,
+					CodesIssued:         10,
+					CodesClaimed:        4,
+					CodesInvalid:        2,
+					TokensClaimed:       3,
+					TokensInvalid:       1,
+					RequestsRateLimited: 5,
+					CodesQuotaExceeded:  6,
+					AuthorizedAppName:   "Appy",
+					AuthorizedAppType:   "device",
 				},
 			},
-			expCSV: `date,authorized_app_id,authorized_app_name,authorized_app_type,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid
-2020-02-03,1,Appy,device,10,4,2,3,1
+			expCSV: `date,authorized_app_id,authorized_app_name,authorized_app_type,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,requests_rate_limited,codes_quota_exceeded
+2020-02-03,1,Appy,device,10,4,2,3,1,5,6
 `,
-			expJSON: `{"authorized_app_id":1,"authorized_app_name":"Appy","authorized_app_type":"device","statistics":[{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":4,"codes_invalid":2,"tokens_claimed":3,"tokens_invalid":1}}]}`,
+			expJSON: `{"authorized_app_id":1,"authorized_app_name":"Appy","authorized_app_type":"device","statistics":[{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":4,"codes_invalid":2,"tokens_claimed":3,"tokens_invalid":1,"requests_rate_limited":5,"codes_quota_exceeded":6}}]}`,
 		},
 		{
 			name: "multi",
@@ -94,12 +96,12 @@ func TestAuthorizedAppStats_MarshalCSV(t *testing.T) {
 					AuthorizedAppType: "stats",
 				},
 			},
-			expCSV: `date,authorized_app_id,authorized_app_name,authorized_app_type,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid
-2020-02-03,1,Appy,device,10,10,2,4,2
-2020-02-04,1,Mc,admin,45,44,5,3,2
-2020-02-05,1,Apperson,stats,15,13,4,6,2
+			expCSV: `date,authorized_app_id,authorized_app_name,authorized_app_type,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,requests_rate_limited,codes_quota_exceeded
+2020-02-03,1,Appy,device,10,10,2,4,2,0,0
+2020-02-04,1,Mc,admin,45,44,5,3,2,0,0
+2020-02-05,1,Apperson,stats,15,13,4,6,2,0,0
 `,
-			expJSON: `{"authorized_app_id":1,"authorized_app_name":"Appy","authorized_app_type":"device","statistics":[{"date":"2020-02-05T00:00:00Z","data":{"codes_issued":15,"codes_claimed":13,"codes_invalid":4,"tokens_claimed":6,"tokens_invalid":2}},{"date":"2020-02-04T00:00:00Z","data":{"codes_issued":45,"codes_claimed":44,"codes_invalid":5,"tokens_claimed":3,"tokens_invalid":2}},{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":10,"codes_invalid":2,"tokens_claimed":4,"tokens_invalid":2}}]}`,
+			expJSON: `{"authorized_app_id":1,"authorized_app_name":"Appy","authorized_app_type":"device","statistics":[{"date":"2020-02-05T00:00:00Z","data":{"codes_issued":15,"codes_claimed":13,"codes_invalid":4,"tokens_claimed":6,"tokens_invalid":2,"requests_rate_limited":0,"codes_quota_exceeded":0}},{"date":"2020-02-04T00:00:00Z","data":{"codes_issued":45,"codes_claimed":44,"codes_invalid":5,"tokens_claimed":3,"tokens_invalid":2,"requests_rate_limited":0,"codes_quota_exceeded":0}},{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":10,"codes_invalid":2,"tokens_claimed":4,"tokens_invalid":2,"requests_rate_limited":0,"codes_quota_exceeded":0}}]}`,
 		},
 	}
 
@@ -16,11 +16,13 @@ package database
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/jinzhu/gorm"
 )
 
@@ -117,6 +119,299 @@ func TestAuthorizedApp_BeforeSave(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("permissions", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeDevice
+			m.Permissions = rbac.UserRead
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("permissions"); len(errs) < 1 {
+				t.Errorf("expected errors for permissions")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeAdmin
+			m.Permissions = rbac.UserRead
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("permissions"); len(errs) != 0 {
+				t.Errorf("expected no errors for permissions, got %v", errs)
+			}
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeDevice
+			m.Scopes = []string{string(APIKeyScopeIssue)}
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("scopes"); len(errs) < 1 {
+				t.Errorf("expected errors for scopes")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeAdmin
+			m.Scopes = []string{"verify"}
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("scopes"); len(errs) < 1 {
+				t.Errorf("expected errors for scopes")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeAdmin
+			m.Scopes = []string{string(APIKeyScopeCheckCodeStatus)}
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("scopes"); len(errs) != 0 {
+				t.Errorf("expected no errors for scopes, got %v", errs)
+			}
+		}
+	})
+
+	t.Run("allowed_test_types", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeStats
+			m.AllowedTestTypes = TestTypeLikely
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("allowedTestTypes"); len(errs) < 1 {
+				t.Errorf("expected errors for allowedTestTypes")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeAdmin
+			m.AllowedTestTypes = TestTypeLikely
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("allowedTestTypes"); len(errs) != 0 {
+				t.Errorf("expected no errors for allowedTestTypes, got %v", errs)
+			}
+		}
+	})
+
+	t.Run("allowed_cidrs", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			var m AuthorizedApp
+			m.AllowedCIDRs = []string{"1.2.3.4"}
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("allowedCIDRs"); len(errs) < 1 {
+				t.Errorf("expected errors for allowedCIDRs")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.AllowedCIDRs = []string{"1.2.3.0/24", "2001:db8::/32"}
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("allowedCIDRs"); len(errs) != 0 {
+				t.Errorf("expected no errors for allowedCIDRs, got %v", errs)
+			}
+		}
+	})
+
+	t.Run("daily_issue_limit", func(t *testing.T) {
+		t.Parallel()
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeDevice
+			m.DailyIssueLimit = 100
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("dailyIssueLimit"); len(errs) < 1 {
+				t.Errorf("expected errors for dailyIssueLimit")
+			}
+		}
+
+		{
+			var m AuthorizedApp
+			m.APIKeyType = APIKeyTypeAdmin
+			m.DailyIssueLimit = 100
+			_ = m.BeforeSave(&gorm.DB{})
+			if errs := m.ErrorsFor("dailyIssueLimit"); len(errs) != 0 {
+				t.Errorf("expected no errors for dailyIssueLimit, got %v", errs)
+			}
+		}
+	})
+}
+
+func TestAuthorizedApp_HasScope(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		scopes []string
+		scope  APIKeyScope
+		exp    bool
+	}{
+		{
+			name:  "unscoped",
+			scope: APIKeyScopeIssue,
+			exp:   true,
+		},
+		{
+			name:   "in_scope",
+			scopes: []string{string(APIKeyScopeIssue), string(APIKeyScopeCheckCodeStatus)},
+			scope:  APIKeyScopeCheckCodeStatus,
+			exp:    true,
+		},
+		{
+			name:   "out_of_scope",
+			scopes: []string{string(APIKeyScopeCheckCodeStatus)},
+			scope:  APIKeyScopeIssue,
+			exp:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := &AuthorizedApp{Scopes: tc.scopes}
+			if got, want := app.HasScope(tc.scope), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizedApp_ValidTestType(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		testTypes TestType
+		testType  string
+		exp       bool
+	}{
+		{
+			name:     "unrestricted",
+			testType: "negative",
+			exp:      true,
+		},
+		{
+			name:      "allowed",
+			testTypes: TestTypeLikely,
+			testType:  "LIKELY",
+			exp:       true,
+		},
+		{
+			name:      "not_allowed",
+			testTypes: TestTypeLikely,
+			testType:  "confirmed",
+			exp:       false,
+		},
+		{
+			name:      "unknown",
+			testTypes: TestTypeLikely,
+			testType:  "banana",
+			exp:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := &AuthorizedApp{AllowedTestTypes: tc.testTypes}
+			if got, want := app.ValidTestType(tc.testType), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizedApp_AllowsIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		cidrs []string
+		ip    string
+		exp   bool
+	}{
+		{
+			name: "unrestricted",
+			ip:   "1.2.3.4",
+			exp:  true,
+		},
+		{
+			name:  "allowed",
+			cidrs: []string{"10.0.0.0/8", "1.2.3.0/24"},
+			ip:    "1.2.3.4",
+			exp:   true,
+		},
+		{
+			name:  "allowed_ipv6",
+			cidrs: []string{"2001:db8::/32"},
+			ip:    "2001:db8::1",
+			exp:   true,
+		},
+		{
+			name:  "not_allowed",
+			cidrs: []string{"10.0.0.0/8"},
+			ip:    "1.2.3.4",
+			exp:   false,
+		},
+		{
+			name:  "unparsable_ip",
+			cidrs: []string{"10.0.0.0/8"},
+			ip:    "",
+			exp:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := &AuthorizedApp{AllowedCIDRs: tc.cidrs}
+			if got, want := app.AllowsIP(net.ParseIP(tc.ip)), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizedApp_ExpiresOn(t *testing.T) {
+	t.Parallel()
+
+	var app AuthorizedApp
+	if app.IsExpired() {
+		t.Errorf("expected api key without expiry to not be expired")
+	}
+	if got, want := app.ExpiresOn(), ""; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	expiresAt := time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)
+	app.ExpiresAt = &expiresAt
+	if !app.IsExpired() {
+		t.Errorf("expected api key to be expired")
+	}
+	if got, want := app.ExpiresOn(), "2021-03-01"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
 }
 
 func TestAuthorizedApp_Realm(t *testing.T) {
@@ -226,6 +521,128 @@ func TestDatabase_CreateFindAPIKey(t *testing.T) {
 	}
 }
 
+func TestRealm_RotateAuthorizedApp(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("foo")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	authApp := &AuthorizedApp{
+		Name:       "Rotated",
+		APIKeyType: APIKeyTypeDevice,
+	}
+	firstAPIKey, err := realm.CreateAuthorizedApp(db, authApp, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstPreview := authApp.APIKeyPreview
+
+	if _, err := realm.RotateAuthorizedApp(db, authApp, MaxAPIKeyRotationGracePeriod+time.Hour, SystemTest); err == nil {
+		t.Errorf("expected error for grace period")
+	}
+
+	secondAPIKey, err := realm.RotateAuthorizedApp(db, authApp, time.Hour, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := authApp.PreviousAPIKeyPreview, firstPreview; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if !authApp.HasPreviousAPIKey() {
+		t.Errorf("expected previous API key")
+	}
+	if authApp.RotatedAt == nil {
+		t.Errorf("expected rotated_at")
+	}
+
+	// Both API keys find the same app.
+	for _, tc := range []struct {
+		apiKey   string
+		previous bool
+	}{
+		{firstAPIKey, true},
+		{secondAPIKey, false},
+	} {
+		got, err := db.FindAuthorizedAppByAPIKey(tc.apiKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := got.ID, authApp.ID; got != want {
+			t.Errorf("expected %v to be %v", got, want)
+		}
+		if got, want := got.UsingPreviousAPIKey, tc.previous; got != want {
+			t.Errorf("expected %t to be %t", got, want)
+		}
+	}
+
+	// Last used is tracked per API key.
+	previousApp, err := db.FindAuthorizedAppByAPIKey(firstAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := previousApp.TouchLastUsedAt(db); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.FindAuthorizedApp(authApp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PreviousAPIKeyLastUsedAt == nil {
+		t.Errorf("expected previous_api_key_last_used_at")
+	}
+	if got.LastUsedAt != nil {
+		t.Errorf("expected last_used_at to be nil, got %v", got.LastUsedAt)
+	}
+
+	// The previous API key stops working when the grace period ends.
+	if err := db.db.
+		Model(&AuthorizedApp{}).
+		Where("id = ?", authApp.ID).
+		UpdateColumn("previous_api_key_expires_at", time.Now().Add(-time.Minute)).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindAuthorizedAppByAPIKey(firstAPIKey); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if _, err := db.FindAuthorizedAppByAPIKey(secondAPIKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotating without a grace period revokes the API key immediately.
+	thirdAPIKey, err := realm.RotateAuthorizedApp(db, authApp, 0, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authApp.HasPreviousAPIKey() {
+		t.Errorf("expected no previous API key")
+	}
+	if _, err := db.FindAuthorizedAppByAPIKey(secondAPIKey); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if _, err := db.FindAuthorizedAppByAPIKey(thirdAPIKey); err != nil {
+		t.Fatal(err)
+	}
+
+	audits, _, err := db.ListAudits(&pagination.PageParams{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotations := 0
+	for _, audit := range audits {
+		if audit.Action == "rotated API key" {
+			rotations++
+		}
+	}
+	if got, want := rotations, 2; got != want {
+		t.Errorf("expected %d rotation audits, got %d", want, got)
+	}
+}
+
 func TestDatabase_GenerateAPIKey(t *testing.T) {
 	t.Parallel()
 
@@ -331,13 +748,21 @@ func TestAuthorizedApp_Audits(t *testing.T) {
 	}
 
 	authorizedApp := &AuthorizedApp{
-		Name: "Appy",
+		Name:       "Appy",
+		APIKeyType: APIKeyTypeAdmin,
 	}
 	if _, err := realm.CreateAuthorizedApp(db, authorizedApp, SystemTest); err != nil {
 		t.Fatal(err)
 	}
 
+	expiresAt := time.Now().UTC().Add(48 * time.Hour)
+
 	authorizedApp.Name = "something else"
+	authorizedApp.Permissions = rbac.UserRead
+	authorizedApp.Scopes = []string{string(APIKeyScopeIssue)}
+	authorizedApp.AllowedTestTypes = TestTypeLikely
+	authorizedApp.AllowedCIDRs = []string{"1.2.3.0/24"}
+	authorizedApp.ExpiresAt = &expiresAt
 	if err := db.SaveAuthorizedApp(authorizedApp, SystemTest); err != nil {
 		t.Fatalf("%v, %v", err, authorizedApp.errors)
 	}
@@ -346,7 +771,7 @@ func TestAuthorizedApp_Audits(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if got, want := len(audits), 2; got != want {
+	if got, want := len(audits), 7; got != want {
 		t.Errorf("expected %d audits, got %d: %v", want, got, audits)
 	}
 }
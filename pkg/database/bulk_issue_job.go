@@ -0,0 +1,94 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+)
+
+// BulkIssueResultIssued is the result status of a row whose code was issued.
+const BulkIssueResultIssued = "issued"
+
+// BulkIssueRow is a single validated row from an uploaded bulk issue CSV.
+type BulkIssueRow struct {
+	// Line is the line number in the uploaded file, starting at 1.
+	Line        uint
+	Phone       string
+	TestDate    string
+	SymptomDate string
+	TestType    string
+	UUID        string
+}
+
+// BulkIssueParams are the options which apply to every row of a bulk issue
+// job.
+type BulkIssueParams struct {
+	SMSTemplateLabel string  `json:"smsTemplateLabel,omitempty"`
+	TZOffset         float32 `json:"tzOffset,omitempty"`
+}
+
+// NewBulkIssueJob creates a job which issues a code for each row. Bulk issue
+// jobs are created through the admin API, so the creator is an API key.
+func NewBulkIssueJob(realmID, authorizedAppID uint, params *BulkIssueParams, rows []*BulkIssueRow) (*Job, error) {
+	items := make([]*JobItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, &JobItem{
+			Line:   row.Line,
+			Fields: []string{row.Phone, row.TestDate, row.SymptomDate, row.TestType, row.UUID},
+		})
+	}
+
+	j, err := newJob(JobKindBulkIssue, realmID, params, items)
+	if err != nil {
+		return nil, err
+	}
+	j.AuthorizedAppID = &authorizedAppID
+	return j, nil
+}
+
+// BulkIssueParams returns the options of a bulk issue job.
+func (j *Job) BulkIssueParams() (*BulkIssueParams, error) {
+	var params BulkIssueParams
+	if err := j.parseParams(&params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// PendingBulkIssueRows returns up to limit rows of a bulk issue job which have
+// not yet been processed.
+func (j *Job) PendingBulkIssueRows(limit uint) ([]*BulkIssueRow, error) {
+	items, err := j.PendingItems(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*BulkIssueRow, 0, len(items))
+	for _, item := range items {
+		if l := len(item.Fields); l != 5 {
+			return nil, fmt.Errorf("failed to decode line %d: expected 5 fields, got %d", item.Line, l)
+		}
+
+		rows = append(rows, &BulkIssueRow{
+			Line:        item.Line,
+			Phone:       item.Fields[0],
+			TestDate:    item.Fields[1],
+			SymptomDate: item.Fields[2],
+			TestType:    item.Fields[3],
+			UUID:        item.Fields[4],
+		})
+	}
+	return rows, nil
+}
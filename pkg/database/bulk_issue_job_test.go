@@ -0,0 +1,263 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+func TestBulkIssueJob_Rows(t *testing.T) {
+	t.Parallel()
+
+	job, err := NewBulkIssueJob(1, 2, &BulkIssueParams{
+		SMSTemplateLabel: "Default SMS template",
+		TZOffset:         -420,
+	}, []*BulkIssueRow{
+		{Line: 2, Phone: "+12065551234", TestDate: "2021-10-01", TestType: "confirmed"},
+		{Line: 3, Phone: "+12065551235", TestDate: "2021-10-01", SymptomDate: "2021-09-30", TestType: "likely"},
+		{Line: 5, Phone: "+12065551236", TestDate: "2021-10-02", TestType: "negative", UUID: "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := job.TotalItems, uint(3); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if job.AuthorizedAppID == nil || *job.AuthorizedAppID != 2 {
+		t.Errorf("expected authorized app to be 2, got %v", job.AuthorizedAppID)
+	}
+
+	params, err := job.BulkIssueParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := params.TZOffset, float32(-420); got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	rows, err := job.PendingBulkIssueRows(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rows), 2; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[1].SymptomDate, "2021-09-30"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if err := job.RecordResults([]*JobResult{
+		{Line: 2, ID: "0cda7b62-2f5b-4b85-9d28-ce1e4b0ee5ef", Status: BulkIssueResultIssued},
+		{Line: 3, ID: "1cda7b62-2f5b-4b85-9d28-ce1e4b0ee5ef", Status: JobResultFailed, Error: "invalid_test_type"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := job.Status, JobStatusRunning; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if job.ProcessedItems != 2 || job.SucceededItems != 1 || job.FailedItems != 1 {
+		t.Errorf("unexpected counts: %#v", job)
+	}
+	if got, want := job.Progress(), uint(66); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Only the remaining row is pending.
+	rows, err = job.PendingBulkIssueRows(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rows), 1; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[0].Line, uint(5); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[0].UUID, "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	b, err := job.MarshalCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"line,uuid,status,error_code",
+		"2,0cda7b62-2f5b-4b85-9d28-ce1e4b0ee5ef,issued,",
+		"3,1cda7b62-2f5b-4b85-9d28-ce1e4b0ee5ef,failed,invalid_test_type",
+		"",
+	}, "\n")
+	if got := string(b); got != want {
+		t.Errorf("expected\n%s\nto be\n%s", got, want)
+	}
+
+	job.MarkSucceeded()
+	if job.Items != "" || job.CompletedAt == nil {
+		t.Errorf("expected items to be cleared and job completed: %#v", job)
+	}
+}
+
+func TestDatabase_ClaimBulkIssueJob(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authApp := &AuthorizedApp{
+		Name:       "Bulk issuer",
+		APIKeyType: APIKeyTypeAdmin,
+	}
+	if _, err := realm.CreateAuthorizedApp(db, authApp, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := NewBulkIssueJob(realm.ID, authApp.ID, &BulkIssueParams{}, []*BulkIssueRow{
+		{Line: 1, Phone: "+12065551234", TestDate: "2021-10-01", TestType: "confirmed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// First claim gets the job, with its rows decrypted.
+	claimed, err := db.ClaimJob(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := claimed.ID, job.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := claimed.Attempts, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	rows, err := claimed.PendingBulkIssueRows(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rows), 1; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[0].Phone, "+12065551234"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Second claim is empty, since the job is leased.
+	if _, err := db.ClaimJob(5 * time.Minute); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	claimed.MarkSucceeded()
+	completedAt := time.Now().UTC().Add(-2 * time.Hour)
+	claimed.CompletedAt = &completedAt
+	if err := db.SaveJob(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs are only visible in their realm, and without their rows.
+	found, err := realm.FindJob(db, job.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found.Status, JobStatusSucceeded; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := found.Kind, JobKindBulkIssue; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	otherRealm := &Realm{}
+	otherRealm.ID = realm.ID + 1000
+	if _, err := otherRealm.FindJob(db, job.UUID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// Finished jobs are purged.
+	count, err := db.PurgeJobs(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
+func TestDatabase_SaveBulkIssueJob_Large(t *testing.T) {
+	t.Parallel()
+
+	// Cloud KMS rejects plaintext over 64 KiB, so the rows of a large job must
+	// not be encrypted directly by the key manager.
+	keyManager := newLimitedKeyManager(t)
+	db, _ := testDatabaseInstance.NewDatabase(t, nil, WithKeyManager(&keys.Config{}, keyManager))
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authApp := &AuthorizedApp{
+		Name:       "Bulk issuer",
+		APIKeyType: APIKeyTypeAdmin,
+	}
+	if _, err := realm.CreateAuthorizedApp(db, authApp, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// The maximum number of rows in an uploaded CSV.
+	rows := make([]*BulkIssueRow, 25000)
+	for i := range rows {
+		rows[i] = &BulkIssueRow{
+			Line:     uint(i + 1),
+			Phone:    fmt.Sprintf("+1206%07d", i),
+			TestDate: "2021-10-01",
+			TestType: "confirmed",
+		}
+	}
+
+	job, err := NewBulkIssueJob(realm.ID, authApp.ID, &BulkIssueParams{}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Items) <= maxKMSPlaintextBytes {
+		t.Fatalf("expected items to be larger than %d bytes, got %d", maxKMSPlaintextBytes, len(job.Items))
+	}
+	if err := db.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := db.FindJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := found.PendingBulkIssueRows(uint(len(rows)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(pending), len(rows); got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := pending[len(pending)-1].Phone, rows[len(rows)-1].Phone; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
@@ -16,6 +16,7 @@ package database
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
@@ -42,6 +43,76 @@ type BulkPermission struct {
 	Action      BulkPermissionAction
 }
 
+// BulkPermissionResultApplied is the result status of a user whose permissions
+// were converged.
+const BulkPermissionResultApplied = "applied"
+
+// BulkPermissionParams are the options of a bulk permissions job.
+type BulkPermissionParams struct {
+	Permissions rbac.Permission      `json:"permissions"`
+	Action      BulkPermissionAction `json:"action"`
+}
+
+// NewJob creates a job which applies the bulk operation in batches. Each user
+// is a separate item in the job.
+func (b *BulkPermission) NewJob(userID uint) (*Job, error) {
+	items := make([]*JobItem, 0, len(b.UserIDs))
+	for i, id := range b.UserIDs {
+		items = append(items, &JobItem{
+			Line:   uint(i + 1),
+			Fields: []string{strconv.FormatUint(uint64(id), 10)},
+		})
+	}
+
+	params := &BulkPermissionParams{
+		Permissions: b.Permissions,
+		Action:      b.Action,
+	}
+
+	j, err := newJob(JobKindBulkPermissions, b.RealmID, params, items)
+	if err != nil {
+		return nil, err
+	}
+	j.UserID = &userID
+	return j, nil
+}
+
+// PendingBulkPermission returns the bulk operation for up to limit users of a
+// bulk permissions job which have not yet been processed, along with each
+// user's line in the job.
+func (j *Job) PendingBulkPermission(limit uint) (*BulkPermission, []uint, error) {
+	var params BulkPermissionParams
+	if err := j.parseParams(&params); err != nil {
+		return nil, nil, err
+	}
+
+	items, err := j.PendingItems(limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &BulkPermission{
+		RealmID:     j.RealmID,
+		UserIDs:     make([]uint, 0, len(items)),
+		Permissions: params.Permissions,
+		Action:      params.Action,
+	}
+	lines := make([]uint, 0, len(items))
+	for _, item := range items {
+		if l := len(item.Fields); l != 1 {
+			return nil, nil, fmt.Errorf("failed to decode line %d: expected 1 field, got %d", item.Line, l)
+		}
+
+		id, err := strconv.ParseUint(item.Fields[0], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode line %d: invalid user id: %w", item.Line, err)
+		}
+		b.UserIDs = append(b.UserIDs, uint(id))
+		lines = append(lines, item.Line)
+	}
+	return b, lines, nil
+}
+
 // Apply converges the bulk operation. If a user isn't in the realm, no action
 // is taken.
 //
@@ -123,12 +194,16 @@ func (b *BulkPermission) Apply(db *Database, actor Auditable) error {
 					return fmt.Errorf("failed to save audit: %w", err)
 				}
 			} else {
-				// Save the membership.
+				// Save the membership. The permissions no longer match the role, so
+				// the membership is removed from its role, if any.
 				if err := tx.
 					Model(&Membership{}).
 					Where("realm_id = ?", membership.RealmID).
 					Where("user_id = ?", membership.UserID).
-					Update("permissions", newPerms).
+					Updates(map[string]interface{}{
+						"permissions": newPerms,
+						"role_id":     gorm.Expr("NULL"),
+					}).
 					Error; err != nil {
 					return fmt.Errorf("failed to save membership: %w", err)
 				}
@@ -100,6 +100,11 @@ func (c CompositeStats) MarshalJSON() ([]byte, error) {
 			data.UserReportTokensClaimed = stat.RealmStats.UserReportTokensClaimed
 			data.CodeClaimMeanAge = uint(stat.RealmStats.CodeClaimMeanAge.Duration.Seconds())
 			data.CodeClaimDistribution = stat.RealmStats.CodeClaimAgeDistribution
+			data.CodesDelivered = stat.RealmStats.CodesDelivered
+			data.CodesUndelivered = stat.RealmStats.CodesUndelivered
+			data.SMSRemindersSent = stat.RealmStats.SMSRemindersSent
+			data.CodesClaimedAfterReminder = stat.RealmStats.CodesClaimedAfterReminder
+			data.CodesTypo = stat.RealmStats.CodesTypo
 		}
 		if stat.KeyServerStats != nil {
 			hasKeyServerStats = true
@@ -161,6 +166,9 @@ func (c CompositeStats) MarshalCSV() ([]byte, error) {
 		"total_teks_published", "requests_with_revisions", "requests_missing_onset_date", "tek_age_distribution", "onset_to_upload_distribution",
 		"user_reports_issued", "user_reports_claimed", "user_report_tokens_claimed",
 		"codes_invalid_unknown_os", "codes_invalid_ios", "codes_invalid_android",
+		"codes_delivered", "codes_undelivered",
+		"sms_reminders_sent", "codes_claimed_after_reminder",
+		"codes_typo",
 	}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -221,6 +229,29 @@ func (c CompositeStats) MarshalCSV() ([]byte, error) {
 			}
 		}
 
+		// SMS delivery status
+		if stat.RealmStats == nil {
+			row = append(row, "", "")
+		} else {
+			row = append(row, strconv.FormatUint(uint64(stat.RealmStats.CodesDelivered), 10))
+			row = append(row, strconv.FormatUint(uint64(stat.RealmStats.CodesUndelivered), 10))
+		}
+
+		// SMS reminders
+		if stat.RealmStats == nil {
+			row = append(row, "", "")
+		} else {
+			row = append(row, strconv.FormatUint(uint64(stat.RealmStats.SMSRemindersSent), 10))
+			row = append(row, strconv.FormatUint(uint64(stat.RealmStats.CodesClaimedAfterReminder), 10))
+		}
+
+		// Check digit typos
+		if stat.RealmStats == nil {
+			row = append(row, "")
+		} else {
+			row = append(row, strconv.FormatUint(uint64(stat.RealmStats.CodesTypo), 10))
+		}
+
 		// New stats should always be added to the end to preserve existing external user applications.
 
 		if err := w.Write(row); err != nil {
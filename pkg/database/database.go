@@ -308,6 +308,22 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 
 	rawDB.Callback().Query().After("gorm:after_query").Register("sms_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
 
+	rawDB.Callback().Create().Before("gorm:create").Register("sms_configs:encrypt_vonage", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "VonageAPISecret"))
+	rawDB.Callback().Create().After("gorm:create").Register("sms_configs:decrypt_vonage", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "VonageAPISecret"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("sms_configs:encrypt_vonage", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "VonageAPISecret"))
+	rawDB.Callback().Update().After("gorm:update").Register("sms_configs:decrypt_vonage", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "VonageAPISecret"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("sms_configs:decrypt_vonage", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "VonageAPISecret"))
+
+	rawDB.Callback().Create().Before("gorm:create").Register("sms_configs:encrypt_http", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "HTTPAuthToken"))
+	rawDB.Callback().Create().After("gorm:create").Register("sms_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "HTTPAuthToken"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("sms_configs:encrypt_http", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "HTTPAuthToken"))
+	rawDB.Callback().Update().After("gorm:update").Register("sms_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "HTTPAuthToken"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("sms_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "HTTPAuthToken"))
+
 	// Email configs
 	rawDB.Callback().Create().Before("gorm:create").Register("email_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
 	rawDB.Callback().Create().After("gorm:create").Register("email_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
@@ -317,6 +333,32 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 
 	rawDB.Callback().Query().After("gorm:after_query").Register("email_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
 
+	rawDB.Callback().Create().Before("gorm:create").Register("email_configs:encrypt_http", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "HTTPAPIKey"))
+	rawDB.Callback().Create().After("gorm:create").Register("email_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "HTTPAPIKey"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("email_configs:encrypt_http", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "HTTPAPIKey"))
+	rawDB.Callback().Update().After("gorm:update").Register("email_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "HTTPAPIKey"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("email_configs:decrypt_http", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "HTTPAPIKey"))
+
+	// OIDC configs
+	rawDB.Callback().Create().Before("gorm:create").Register("oidc_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "oidc_configs", "ClientSecret"))
+	rawDB.Callback().Create().After("gorm:create").Register("oidc_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "oidc_configs", "ClientSecret"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("oidc_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "oidc_configs", "ClientSecret"))
+	rawDB.Callback().Update().After("gorm:update").Register("oidc_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "oidc_configs", "ClientSecret"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("oidc_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "oidc_configs", "ClientSecret"))
+
+	// MFA factors
+	rawDB.Callback().Create().Before("gorm:create").Register("mfa_factors:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "mfa_factors", "Secret"))
+	rawDB.Callback().Create().After("gorm:create").Register("mfa_factors:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "mfa_factors", "Secret"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("mfa_factors:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "mfa_factors", "Secret"))
+	rawDB.Callback().Update().After("gorm:update").Register("mfa_factors:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "mfa_factors", "Secret"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("mfa_factors:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "mfa_factors", "Secret"))
+
 	// Realms
 	rawDB.Callback().Create().Before("gorm:create").Register("realms:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "realms", "UserReportWebhookSecret"))
 	rawDB.Callback().Create().After("gorm:create").Register("realms:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "realms", "UserReportWebhookSecret"))
@@ -326,6 +368,42 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 
 	rawDB.Callback().Query().After("gorm:after_query").Register("realms:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "realms", "UserReportWebhookSecret"))
 
+	// SMS outbox
+	rawDB.Callback().Create().Before("gorm:create").Register("sms_outbox_messages:encrypt_phone_number", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "PhoneNumber"))
+	rawDB.Callback().Create().After("gorm:create").Register("sms_outbox_messages:decrypt_phone_number", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "PhoneNumber"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("sms_outbox_messages:encrypt_phone_number", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "PhoneNumber"))
+	rawDB.Callback().Update().After("gorm:update").Register("sms_outbox_messages:decrypt_phone_number", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "PhoneNumber"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("sms_outbox_messages:decrypt_phone_number", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "PhoneNumber"))
+
+	rawDB.Callback().Create().Before("gorm:create").Register("sms_outbox_messages:encrypt_message", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "Message"))
+	rawDB.Callback().Create().After("gorm:create").Register("sms_outbox_messages:decrypt_message", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "Message"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("sms_outbox_messages:encrypt_message", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "Message"))
+	rawDB.Callback().Update().After("gorm:update").Register("sms_outbox_messages:decrypt_message", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "Message"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("sms_outbox_messages:decrypt_message", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_outbox_messages", "Message"))
+
+	// Webhook subscriptions
+	rawDB.Callback().Create().Before("gorm:create").Register("webhook_subscriptions:encrypt_secret", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "webhook_subscriptions", "Secret"))
+	rawDB.Callback().Create().After("gorm:create").Register("webhook_subscriptions:decrypt_secret", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "webhook_subscriptions", "Secret"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("webhook_subscriptions:encrypt_secret", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "webhook_subscriptions", "Secret"))
+	rawDB.Callback().Update().After("gorm:update").Register("webhook_subscriptions:decrypt_secret", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "webhook_subscriptions", "Secret"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("webhook_subscriptions:decrypt_secret", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "webhook_subscriptions", "Secret"))
+
+	// Jobs. Items can be much larger than the key manager allows, so they use
+	// envelope encryption.
+	rawDB.Callback().Create().Before("gorm:create").Register("jobs:encrypt_items", callbackEnvelopeEncrypt(ctx, db.keyManager, c.EncryptionKey, "jobs", "Items"))
+	rawDB.Callback().Create().After("gorm:create").Register("jobs:decrypt_items", callbackEnvelopeDecrypt(ctx, db.keyManager, c.EncryptionKey, "jobs", "Items"))
+
+	rawDB.Callback().Update().Before("gorm:update").Register("jobs:encrypt_items", callbackEnvelopeEncrypt(ctx, db.keyManager, c.EncryptionKey, "jobs", "Items"))
+	rawDB.Callback().Update().After("gorm:update").Register("jobs:decrypt_items", callbackEnvelopeDecrypt(ctx, db.keyManager, c.EncryptionKey, "jobs", "Items"))
+
+	rawDB.Callback().Query().After("gorm:after_query").Register("jobs:decrypt_items", callbackEnvelopeDecrypt(ctx, db.keyManager, c.EncryptionKey, "jobs", "Items"))
+
 	// Verification codes
 	rawDB.Callback().Create().Before("gorm:create").Register("verification_codes:hmac_code", callbackHMAC(ctx, db.GenerateVerificationCodeHMAC, "verification_codes", "code"))
 	rawDB.Callback().Create().Before("gorm:create").Register("verification_codes:hmac_long_code", callbackHMAC(ctx, db.GenerateVerificationCodeHMAC, "verification_codes", "long_code"))
@@ -523,6 +601,22 @@ func callbackPurgeCache(ctx context.Context, cacher cache.Cacher, namespace, tab
 // callbackKMSDecrypt decrypts the given column in the table using the key
 // manager and key id.
 func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+	return callbackDecrypt(table, column, func(ciphertext []byte) ([]byte, error) {
+		return keyManager.Decrypt(ctx, keyID, ciphertext, nil)
+	})
+}
+
+// callbackEnvelopeDecrypt decrypts the given column in the table, which was
+// encrypted by callbackEnvelopeEncrypt.
+func callbackEnvelopeDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+	return callbackDecrypt(table, column, func(ciphertext []byte) ([]byte, error) {
+		return envelopeDecrypt(ctx, keyManager, keyID, ciphertext)
+	})
+}
+
+// callbackDecrypt decrypts the given column in the table using the decrypt
+// function.
+func callbackDecrypt(table, column string, decrypt func([]byte) ([]byte, error)) func(scope *gorm.Scope) {
 	return func(scope *gorm.Scope) {
 		// Do nothing if not the target table
 		if scope.TableName() != table {
@@ -563,7 +657,7 @@ func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 			return
 		}
 
-		plaintextBytes, err := keyManager.Decrypt(ctx, keyID, ciphertextBytes, nil)
+		plaintextBytes, err := decrypt(ciphertextBytes)
 		if err != nil {
 			_ = scope.Err(fmt.Errorf("failed to decrypt %s: %w", column, err))
 			return
@@ -603,6 +697,24 @@ func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 // callbackKMSEncrypt encrypts the given column in the table using the key
 // manager and key id before saving in the database.
 func callbackKMSEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+	return callbackEncrypt(table, column, func(plaintext []byte) ([]byte, error) {
+		return keyManager.Encrypt(ctx, keyID, plaintext, nil)
+	})
+}
+
+// callbackEnvelopeEncrypt encrypts the given column in the table with envelope
+// encryption before saving in the database. Use it instead of
+// callbackKMSEncrypt for values which can exceed the key manager's plaintext
+// size limit.
+func callbackEnvelopeEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+	return callbackEncrypt(table, column, func(plaintext []byte) ([]byte, error) {
+		return envelopeEncrypt(ctx, keyManager, keyID, plaintext)
+	})
+}
+
+// callbackEncrypt encrypts the given column in the table using the encrypt
+// function before saving in the database.
+func callbackEncrypt(table, column string, encrypt func([]byte) ([]byte, error)) func(scope *gorm.Scope) {
 	return func(scope *gorm.Scope) {
 		// Do nothing if not the target table
 		if scope.TableName() != table {
@@ -637,7 +749,7 @@ func callbackKMSEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 			}
 		}
 
-		b, err := keyManager.Encrypt(ctx, keyID, []byte(plaintext), nil)
+		b, err := encrypt([]byte(plaintext))
 		if err != nil {
 			_ = scope.Err(fmt.Errorf("failed to encrypt %s: %w", column, err))
 			return
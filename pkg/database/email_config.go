@@ -16,6 +16,8 @@ package database
 
 import (
 	"context"
+	"net/mail"
+	"net/url"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/jinzhu/gorm"
@@ -43,12 +45,34 @@ type EmailConfig struct {
 	SMTPPasswordPlaintextCache  string `gorm:"-"`
 	SMTPPasswordCiphertextCache string `gorm:"-"`
 
+	// HTTP configuration options.
+	HTTPEndpoint    string `gorm:"type:text"`
+	HTTPFromAddress string `gorm:"type:varchar(250)"`
+
+	// HTTPAPIKey is encrypted/decrypted automatically by callbacks. The cache
+	// fields exist as optimizations.
+	HTTPAPIKey                string `gorm:"column:http_api_key; type:text" json:"-"` // ignored by zap's JSON formatter
+	HTTPAPIKeyPlaintextCache  string `gorm:"-"`
+	HTTPAPIKeyCiphertextCache string `gorm:"-"`
+
 	// IsSystem determines if this is a system-level email configuration. There can
 	// only be one system-level email configuration.
 	IsSystem bool `gorm:"type:bool; not null; default:false;"`
 }
 
 func (e *EmailConfig) BeforeSave(tx *gorm.DB) error {
+	switch e.ProviderType {
+	case email.ProviderTypeHTTP:
+		e.validateHTTP()
+	default:
+		e.validateSMTP()
+	}
+
+	return e.ErrorOrNil()
+}
+
+// validateSMTP validates the SMTP configuration options.
+func (e *EmailConfig) validateSMTP() {
 	// Email config is all or nothing
 	if (e.SMTPAccount != "" || e.SMTPPassword != "" || e.SMTPHost != "") &&
 		(e.SMTPAccount == "" || e.SMTPPassword == "" || e.SMTPHost == "") {
@@ -56,18 +80,56 @@ func (e *EmailConfig) BeforeSave(tx *gorm.DB) error {
 		e.AddError("SMTPPassword", "all must be specified or all must be blank")
 		e.AddError("SMTPHost", "all must be specified or all must be blank")
 	}
+}
 
-	return e.ErrorOrNil()
+// validateHTTP validates the HTTP configuration options.
+func (e *EmailConfig) validateHTTP() {
+	// Email config is all or nothing
+	if (e.HTTPEndpoint != "" || e.HTTPAPIKey != "" || e.HTTPFromAddress != "") &&
+		(e.HTTPEndpoint == "" || e.HTTPAPIKey == "" || e.HTTPFromAddress == "") {
+		e.AddError("httpEndpoint", "all must be specified or all must be blank")
+		e.AddError("httpAPIKey", "all must be specified or all must be blank")
+		e.AddError("httpFromAddress", "all must be specified or all must be blank")
+	}
+
+	if e.HTTPEndpoint != "" {
+		u, err := url.Parse(e.HTTPEndpoint)
+		if err != nil {
+			e.AddError("httpEndpoint", err.Error())
+		} else if u.Scheme != "https" {
+			e.AddError("httpEndpoint", "must be an https URL")
+		}
+	}
+
+	if e.HTTPFromAddress != "" {
+		if _, err := mail.ParseAddress(e.HTTPFromAddress); err != nil {
+			e.AddError("httpFromAddress", "must be a valid email address")
+		}
+	}
+}
+
+// IsBlank returns true if none of the fields for the configured provider are
+// set.
+func (e *EmailConfig) IsBlank() bool {
+	switch e.ProviderType {
+	case email.ProviderTypeHTTP:
+		return e.HTTPEndpoint == "" && e.HTTPAPIKey == "" && e.HTTPFromAddress == ""
+	default:
+		return e.SMTPAccount == "" && e.SMTPPassword == "" && e.SMTPHost == ""
+	}
 }
 
 func (e *EmailConfig) Provider() (email.Provider, error) {
 	ctx := context.Background()
 	provider, err := email.ProviderFor(ctx, &email.Config{
-		ProviderType: e.ProviderType,
-		User:         e.SMTPAccount,
-		Password:     e.SMTPPassword,
-		SMTPHost:     e.SMTPHost,
-		SMTPPort:     e.SMTPPort,
+		ProviderType:    e.ProviderType,
+		User:            e.SMTPAccount,
+		Password:        e.SMTPPassword,
+		SMTPHost:        e.SMTPHost,
+		SMTPPort:        e.SMTPPort,
+		HTTPEndpoint:    e.HTTPEndpoint,
+		HTTPAPIKey:      e.HTTPAPIKey,
+		HTTPFromAddress: e.HTTPFromAddress,
 	})
 	if err != nil {
 		return nil, err
@@ -90,7 +152,7 @@ func (db *Database) SystemEmailConfig() (*EmailConfig, error) {
 
 // SaveEmailConfig creates or updates an email configuration record.
 func (db *Database) SaveEmailConfig(s *EmailConfig) error {
-	if s.SMTPAccount == "" && s.SMTPPassword == "" && s.SMTPHost == "" {
+	if s.IsBlank() {
 		if db.db.NewRecord(s) {
 			// The fields are all blank, do not create the record.
 			return nil
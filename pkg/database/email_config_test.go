@@ -45,6 +45,27 @@ func TestEmailConfig_Validate(t *testing.T) {
 			},
 			err: "validation failed",
 		},
+		{
+			name: "http missing api key",
+			emailConfig: &EmailConfig{
+				RealmID:         realm.ID,
+				ProviderType:    email.ProviderTypeHTTP,
+				HTTPEndpoint:    "https://api.example.com/v1/send",
+				HTTPFromAddress: "noreply@example.com",
+			},
+			err: "validation failed",
+		},
+		{
+			name: "http insecure endpoint",
+			emailConfig: &EmailConfig{
+				RealmID:         realm.ID,
+				ProviderType:    email.ProviderTypeHTTP,
+				HTTPEndpoint:    "http://api.example.com/v1/send",
+				HTTPAPIKey:      "key",
+				HTTPFromAddress: "noreply@example.com",
+			},
+			err: "validation failed",
+		},
 	}
 
 	for _, tc := range cases {
@@ -0,0 +1,115 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+// envelopeKeyBytes is the length of the data key used for envelope encryption.
+const envelopeKeyBytes = 32
+
+// envelopeEncrypt encrypts the plaintext with a random AES-256-GCM data key,
+// and encrypts only the data key with the key manager. Key managers such as
+// Cloud KMS limit the size of the plaintext they accept, so large values must
+// not be sent to them directly.
+//
+// The result is the length of the encrypted data key as a big-endian uint16,
+// the encrypted data key, the nonce, and the ciphertext.
+func envelopeEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID string, plaintext []byte) ([]byte, error) {
+	dek := make([]byte, envelopeKeyBytes)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := keyManager.Encrypt(ctx, keyID, dek, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key: %w", err)
+	}
+	if len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("encrypted data key is too long")
+	}
+
+	aead, err := envelopeAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 2, 2+len(wrapped)+len(nonce)+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+// envelopeDecrypt decrypts a value encrypted by envelopeEncrypt.
+func envelopeDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID string, b []byte) ([]byte, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < wrappedLen {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	dek, err := keyManager.Decrypt(ctx, keyID, b[:wrappedLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	b = b[wrappedLen:]
+
+	aead, err := envelopeAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	plaintext, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// envelopeAEAD returns the AES-GCM cipher for the data key.
+func envelopeAEAD(dek []byte) (cipher.AEAD, error) {
+	if len(dek) != envelopeKeyBytes {
+		return nil, fmt.Errorf("invalid data key length %d", len(dek))
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+// maxKMSPlaintextBytes is the largest plaintext Cloud KMS will encrypt.
+const maxKMSPlaintextBytes = 64 * 1024
+
+// limitedKeyManager is a key manager which, like Cloud KMS, rejects plaintext
+// larger than maxKMSPlaintextBytes.
+type limitedKeyManager struct {
+	keys.KeyManager
+	keys.EncryptionKeyManager
+}
+
+func (k *limitedKeyManager) Encrypt(ctx context.Context, keyID string, plaintext, aad []byte) ([]byte, error) {
+	if len(plaintext) > maxKMSPlaintextBytes {
+		return nil, fmt.Errorf("plaintext is %d bytes, larger than %d", len(plaintext), maxKMSPlaintextBytes)
+	}
+	return k.KeyManager.Encrypt(ctx, keyID, plaintext, aad)
+}
+
+// newLimitedKeyManager returns a limitedKeyManager backed by a test key
+// manager.
+func newLimitedKeyManager(tb testing.TB) *limitedKeyManager {
+	tb.Helper()
+
+	km := keys.TestKeyManager(tb)
+	ekm, ok := km.(keys.EncryptionKeyManager)
+	if !ok {
+		tb.Fatalf("%T is not an EncryptionKeyManager", km)
+	}
+	return &limitedKeyManager{KeyManager: km, EncryptionKeyManager: ekm}
+}
+
+func TestEnvelopeEncrypt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keyManager := newLimitedKeyManager(t)
+	keyID := keys.TestEncryptionKey(t, keyManager)
+
+	// Larger than any job's items.
+	plaintext := make([]byte, 8<<20)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keyManager.Encrypt(ctx, keyID, plaintext, nil); err == nil {
+		t.Fatal("expected the key manager to reject large plaintext")
+	}
+
+	ciphertext, err := envelopeEncrypt(ctx, keyManager, keyID, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := envelopeDecrypt(ctx, keyManager, keyID, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("expected decrypted value to match plaintext")
+	}
+
+	// Tampered or truncated ciphertext fails.
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := envelopeDecrypt(ctx, keyManager, keyID, tampered); err == nil {
+		t.Errorf("expected tampered ciphertext to fail")
+	}
+	for _, n := range []int{0, 1, 10} {
+		if _, err := envelopeDecrypt(ctx, keyManager, keyID, ciphertext[:n]); err == nil {
+			t.Errorf("expected %d bytes of ciphertext to fail", n)
+		}
+	}
+}
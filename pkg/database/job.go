@@ -0,0 +1,550 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// JobKind is the type of operation a job performs.
+type JobKind string
+
+const (
+	// JobKindBulkIssue issues a verification code for each row of an uploaded
+	// CSV.
+	JobKindBulkIssue JobKind = "bulk_issue"
+
+	// JobKindUserImport adds each user in an uploaded CSV to the realm.
+	JobKindUserImport JobKind = "user_import"
+
+	// JobKindBulkPermissions adds or removes permissions from a set of the
+	// realm's users.
+	JobKindBulkPermissions JobKind = "bulk_permissions"
+)
+
+// JobKinds is the list of all job kinds.
+var JobKinds = []JobKind{
+	JobKindBulkIssue,
+	JobKindUserImport,
+	JobKindBulkPermissions,
+}
+
+// jobResultsHeaders is the header of the results CSV of each job kind. Results
+// always have four columns: the item's line, the item's identifier, the result
+// status, and the error.
+var jobResultsHeaders = map[JobKind][]string{
+	JobKindBulkIssue:       {"line", "uuid", "status", "error_code"},
+	JobKindUserImport:      {"line", "email", "status", "error"},
+	JobKindBulkPermissions: {"line", "user_id", "status", "error"},
+}
+
+// Display returns a human-readable name for the kind.
+func (k JobKind) Display() string {
+	switch k {
+	case JobKindBulkIssue:
+		return "Bulk issue codes"
+	case JobKindUserImport:
+		return "Import users"
+	case JobKindBulkPermissions:
+		return "Bulk update permissions"
+	default:
+		return string(k)
+	}
+}
+
+// Permission returns the permission required to view jobs of this kind.
+func (k JobKind) Permission() rbac.Permission {
+	switch k {
+	case JobKindBulkIssue:
+		return rbac.CodeBulkIssue
+	default:
+		return rbac.UserRead
+	}
+}
+
+// JobStatus is the processing state of a job.
+type JobStatus string
+
+const (
+	// JobStatusPending indicates the job has not yet been picked up by a worker.
+	JobStatusPending JobStatus = "pending"
+
+	// JobStatusRunning indicates some, but not all, of the items have been
+	// processed.
+	JobStatusRunning JobStatus = "running"
+
+	// JobStatusSucceeded indicates every item has been processed. It does not
+	// mean every item succeeded, see the per-item results.
+	JobStatusSucceeded JobStatus = "succeeded"
+
+	// JobStatusFailed indicates the job stopped before every item was
+	// processed.
+	JobStatusFailed JobStatus = "failed"
+)
+
+// IsDone returns true if the job will not be processed any further.
+func (s JobStatus) IsDone() bool {
+	return s == JobStatusSucceeded || s == JobStatusFailed
+}
+
+// JobResultFailed is the result status of an item which failed. Each job kind
+// chooses its own status for items which succeeded.
+const JobResultFailed = "failed"
+
+// JobItem is a single unit of work in a job, such as one row of an uploaded
+// CSV.
+type JobItem struct {
+	// Line is the position of the item in the input, starting at 1.
+	Line   uint
+	Fields []string
+}
+
+// JobResult is the outcome of processing a single item.
+type JobResult struct {
+	Line   uint
+	ID     string
+	Status string
+	Error  string
+}
+
+// Job is a long-running operation which is processed asynchronously by the
+// job-worker service. Items are processed in order and progress is saved after
+// each batch, so a job that is interrupted resumes where it left off. Items can
+// contain PII such as phone numbers, so they are encrypted at rest and cleared
+// once the job is done.
+type Job struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// UUID is the public identifier of the job.
+	UUID string `gorm:"column:uuid; type:uuid;"`
+
+	// RealmID is the realm in which the job runs.
+	RealmID uint `gorm:"column:realm_id; type:integer;"`
+
+	// Kind is the operation the job performs.
+	Kind JobKind `gorm:"column:kind; type:text;"`
+
+	// UserID is the user who created the job, if it was created in the UI.
+	// AuthorizedAppID is the API key which created the job, if it was created
+	// through the admin API.
+	UserID          *uint `gorm:"column:user_id; type:integer;"`
+	AuthorizedAppID *uint `gorm:"column:authorized_app_id; type:integer;"`
+
+	// Params are the job-wide options, JSON encoded. The structure depends on
+	// the kind.
+	Params string `gorm:"column:params; type:text;"`
+
+	// Items are the CSV-encoded items to process. The first column is the
+	// item's line.
+	Items                string `gorm:"column:items; type:text;" json:"-"` // ignored by zap's JSON formatter
+	ItemsPlaintextCache  string `gorm:"-" json:"-"`
+	ItemsCiphertextCache string `gorm:"-" json:"-"`
+
+	// Results are the CSV-encoded results of the processed items, without a
+	// header.
+	Results string `gorm:"column:results; type:text;"`
+
+	// Status is the current processing state.
+	Status JobStatus `gorm:"column:status; type:text;"`
+
+	// TotalItems is the number of items in the job. ProcessedItems is the number
+	// of items which have been processed, and is also the position of the next
+	// item to process.
+	TotalItems     uint `gorm:"column:total_items; type:integer;"`
+	ProcessedItems uint `gorm:"column:processed_items; type:integer;"`
+	SucceededItems uint `gorm:"column:succeeded_items; type:integer;"`
+	FailedItems    uint `gorm:"column:failed_items; type:integer;"`
+
+	// Attempts is the number of times the job has been claimed since it last
+	// made progress.
+	Attempts uint `gorm:"column:attempts; type:integer;"`
+
+	// NextAttemptAt is the earliest time a worker may claim the job.
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at; type:timestamp with time zone;"`
+
+	// LastError is why the job failed.
+	LastError string `gorm:"column:last_error; type:text;"`
+
+	// CompletedAt is when the job finished, successfully or not.
+	CompletedAt *time.Time `gorm:"column:completed_at; type:timestamp with time zone;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (j *Job) BeforeSave(tx *gorm.DB) error {
+	if j.UUID == "" {
+		j.AddError("uuid", "cannot be blank")
+	}
+	if j.RealmID == 0 {
+		j.AddError("realmID", "cannot be blank")
+	}
+	if _, ok := jobResultsHeaders[j.Kind]; !ok {
+		j.AddError("kind", fmt.Sprintf("unknown kind %q", j.Kind))
+	}
+
+	if j.Status == "" {
+		j.Status = JobStatusPending
+	}
+
+	switch j.Status {
+	case JobStatusPending, JobStatusRunning:
+		if j.Items == "" {
+			j.AddError("items", "cannot be blank")
+		}
+	case JobStatusSucceeded, JobStatusFailed:
+	default:
+		j.AddError("status", fmt.Sprintf("unknown status %q", j.Status))
+	}
+
+	if j.ProcessedItems > j.TotalItems {
+		j.AddError("processedItems", "cannot be more than the total items")
+	}
+
+	return j.ErrorOrNil()
+}
+
+// newJob creates a pending job of the given kind in the realm.
+func newJob(kind JobKind, realmID uint, params interface{}, items []*JobItem) (*Job, error) {
+	j := &Job{
+		UUID:    uuid.New().String(),
+		RealmID: realmID,
+		Kind:    kind,
+		Status:  JobStatusPending,
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode params: %w", err)
+	}
+	j.Params = string(b)
+
+	if err := j.setItems(items); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// parseParams decodes the job's params into i.
+func (j *Job) parseParams(i interface{}) error {
+	if err := json.Unmarshal([]byte(j.Params), i); err != nil {
+		return fmt.Errorf("failed to decode params: %w", err)
+	}
+	return nil
+}
+
+// setItems encodes the items into the job.
+func (j *Job) setItems(items []*JobItem) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	for i, item := range items {
+		record := append([]string{strconv.FormatUint(uint64(item.Line), 10)}, item.Fields...)
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("failed to write item %d: %w", i, err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to encode items: %w", err)
+	}
+
+	j.Items = b.String()
+	j.TotalItems = uint(len(items))
+	return nil
+}
+
+// PendingItems returns up to limit items which have not yet been processed.
+func (j *Job) PendingItems(limit uint) ([]*JobItem, error) {
+	r := csv.NewReader(strings.NewReader(j.Items))
+	r.FieldsPerRecord = -1
+
+	items := make([]*JobItem, 0, limit)
+	for i := uint(0); uint(len(items)) < limit; i++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode item %d: %w", i, err)
+		}
+		if i < j.ProcessedItems {
+			continue
+		}
+
+		line, err := strconv.ParseUint(record[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode item %d: invalid line number: %w", i, err)
+		}
+
+		items = append(items, &JobItem{
+			Line:   uint(line),
+			Fields: record[1:],
+		})
+	}
+	return items, nil
+}
+
+// RecordResults appends the results of a processed batch and advances the
+// job's position. Since progress was made, the attempt count is reset.
+func (j *Job) RecordResults(results []*JobResult) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	for i, result := range results {
+		if err := w.Write([]string{
+			strconv.FormatUint(uint64(result.Line), 10),
+			result.ID,
+			result.Status,
+			result.Error,
+		}); err != nil {
+			return fmt.Errorf("failed to write result %d: %w", i, err)
+		}
+
+		if result.Status == JobResultFailed {
+			j.FailedItems++
+		} else {
+			j.SucceededItems++
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to encode results: %w", err)
+	}
+
+	j.Results += b.String()
+	j.ProcessedItems += uint(len(results))
+	j.Status = JobStatusRunning
+	j.Attempts = 0
+	return nil
+}
+
+// MarshalCSV returns the results of the processed items as a CSV, including a
+// header.
+func (j *Job) MarshalCSV() ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(jobResultsHeaders[j.Kind]); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	b.WriteString(j.Results)
+	return b.Bytes(), nil
+}
+
+// Progress returns the percentage of items which have been processed.
+func (j *Job) Progress() uint {
+	if j.TotalItems == 0 {
+		return 100
+	}
+	return j.ProcessedItems * 100 / j.TotalItems
+}
+
+// JobResponse converts the job to the external api response.
+func (j *Job) JobResponse() *api.JobResponse {
+	resp := &api.JobResponse{
+		JobID:              j.UUID,
+		Kind:               string(j.Kind),
+		Status:             string(j.Status),
+		TotalItems:         j.TotalItems,
+		ProcessedItems:     j.ProcessedItems,
+		SucceededItems:     j.SucceededItems,
+		FailedItems:        j.FailedItems,
+		CreatedAtTimestamp: j.CreatedAt.UTC().Unix(),
+		Error:              j.LastError,
+	}
+	if j.CompletedAt != nil {
+		resp.CompletedAtTimestamp = j.CompletedAt.UTC().Unix()
+	}
+	return resp
+}
+
+// MarkSucceeded records that every item has been processed. The items are no
+// longer needed and are cleared.
+func (j *Job) MarkSucceeded() {
+	now := time.Now().UTC()
+	j.Status = JobStatusSucceeded
+	j.CompletedAt = &now
+	j.LastError = ""
+	j.clearItems()
+}
+
+// MarkFailed records that the job will not be processed any further. The
+// items are no longer needed and are cleared.
+func (j *Job) MarkFailed(reason string) {
+	now := time.Now().UTC()
+	j.Status = JobStatusFailed
+	j.CompletedAt = &now
+	j.LastError = reason
+	j.clearItems()
+}
+
+func (j *Job) clearItems() {
+	j.Items = ""
+	j.ItemsPlaintextCache = ""
+	j.ItemsCiphertextCache = ""
+}
+
+// SaveJob creates or updates the job.
+func (db *Database) SaveJob(j *Job) error {
+	if j.NextAttemptAt.IsZero() {
+		j.NextAttemptAt = time.Now().UTC()
+	}
+	return db.db.Save(j).Error
+}
+
+// FindJob finds the job by its ID.
+func (db *Database) FindJob(id interface{}) (*Job, error) {
+	var j Job
+	if err := db.db.
+		Model(&Job{}).
+		Where("id = ?", id).
+		First(&j).
+		Error; err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// jobColumns are the columns loaded when a job is displayed. The items are
+// only needed to process the job.
+const jobColumns = "id, uuid, realm_id, kind, user_id, authorized_app_id, params, status, " +
+	"total_items, processed_items, succeeded_items, failed_items, last_error, completed_at, created_at, updated_at"
+
+// FindJob finds the job in the realm by its UUID. It does not load the items.
+func (r *Realm) FindJob(db *Database, uuidStr string) (*Job, error) {
+	// Postgres returns an error if the provided input is not a valid UUID.
+	parsed, err := uuid.Parse(uuidStr)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var j Job
+	if err := db.db.
+		Model(&Job{}).
+		Select(jobColumns+", results").
+		Where("uuid = ? AND realm_id = ?", parsed.String(), r.ID).
+		First(&j).
+		Error; err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ListJobs lists the realm's jobs of the given kinds, newest first. It does
+// not load the items or results.
+func (r *Realm) ListJobs(db *Database, kinds []JobKind, p *pagination.PageParams) ([]*Job, *pagination.Paginator, error) {
+	var jobs []*Job
+	query := db.db.
+		Model(&Job{}).
+		Select(jobColumns).
+		Where("realm_id = ?", r.ID).
+		Where("kind IN (?)", kinds).
+		Order("created_at DESC, id DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &jobs, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return jobs, nil, nil
+		}
+		return nil, nil, err
+	}
+	return jobs, paginator, nil
+}
+
+// ClaimJob claims the oldest job which is due for processing. Claiming
+// increments the job's attempt count and pushes its next attempt time out by
+// the lease duration, so concurrent workers never claim the same job, and a
+// job held by a worker that crashes is resumed once the lease expires. It
+// returns NotFound if there are no jobs to process.
+func (db *Database) ClaimJob(lease time.Duration) (*Job, error) {
+	now := time.Now().UTC()
+
+	sql := `
+		UPDATE jobs
+		SET
+			attempts = attempts + 1,
+			next_attempt_at = $1,
+			updated_at = $2
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status IN ($3, $4) AND next_attempt_at <= $2
+			ORDER BY created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`
+
+	rows, err := db.db.Raw(sql, now.Add(lease), now, JobStatusPending, JobStatusRunning).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to claim job: %w", err)
+		}
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var id uint
+	if err := rows.Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to scan job id: %w", err)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	// Load the job individually, since the encrypted columns are only
+	// decrypted when querying a single record.
+	return db.FindJob(id)
+}
+
+// PurgeJobs deletes jobs which completed before the given max age.
+func (db *Database) PurgeJobs(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	completedBefore := time.Now().UTC().Add(maxAge)
+
+	result := db.db.
+		Where("completed_at IS NOT NULL AND completed_at < ?", completedBefore).
+		Delete(&Job{})
+	return result.RowsAffected, result.Error
+}
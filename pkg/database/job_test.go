@@ -0,0 +1,355 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func TestJob_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		job     *Job
+		errKeys []string
+	}{
+		{
+			name: "valid",
+			job: &Job{
+				UUID:    "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				RealmID: 1,
+				Kind:    JobKindUserImport,
+				Items:   "2,user@example.com,User\n",
+			},
+		},
+		{
+			name:    "missing_fields",
+			job:     &Job{},
+			errKeys: []string{"uuid", "realmID", "kind", "items"},
+		},
+		{
+			name: "unknown_kind",
+			job: &Job{
+				UUID:    "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				RealmID: 1,
+				Kind:    "bananas",
+				Items:   "1,1\n",
+			},
+			errKeys: []string{"kind"},
+		},
+		{
+			name: "succeeded_without_items",
+			job: &Job{
+				UUID:    "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				RealmID: 1,
+				Kind:    JobKindBulkIssue,
+				Status:  JobStatusSucceeded,
+			},
+		},
+		{
+			name: "unknown_status",
+			job: &Job{
+				UUID:    "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				RealmID: 1,
+				Kind:    JobKindBulkIssue,
+				Status:  "bananas",
+			},
+			errKeys: []string{"status"},
+		},
+		{
+			name: "processed_more_than_total",
+			job: &Job{
+				UUID:           "6cf5c1e8-96ee-45bb-ae7e-c6cf52b5c9f4",
+				RealmID:        1,
+				Kind:           JobKindBulkIssue,
+				Status:         JobStatusFailed,
+				TotalItems:     1,
+				ProcessedItems: 2,
+			},
+			errKeys: []string{"processedItems"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.job.BeforeSave(nil)
+			for _, k := range tc.errKeys {
+				if len(tc.job.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+			if len(tc.errKeys) == 0 {
+				if msgs := tc.job.ErrorMessages(); len(msgs) > 0 {
+					t.Errorf("expected no errors, got %q", msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestJobKind_Permission(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		kind JobKind
+		want rbac.Permission
+	}{
+		{JobKindBulkIssue, rbac.CodeBulkIssue},
+		{JobKindUserImport, rbac.UserRead},
+		{JobKindBulkPermissions, rbac.UserRead},
+	}
+
+	for _, tc := range cases {
+		if got := tc.kind.Permission(); got != tc.want {
+			t.Errorf("%s: expected %v to be %v", tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestJob_UserImport(t *testing.T) {
+	t.Parallel()
+
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	job, err := NewUserImportJob(1, 3, &UserImportParams{SendInvites: true}, []*UserImportRow{
+		{Line: 1, Email: "one@example.com", Name: "One, Jr."},
+		{Line: 2, Email: "two@example.com", ExpiresAt: &expiresAt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.UserID == nil || *job.UserID != 3 {
+		t.Errorf("expected user to be 3, got %v", job.UserID)
+	}
+
+	rows, err := job.PendingUserImportRows(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rows), 2; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[0].Name, "One, Jr."; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := rows[1].Email, "two@example.com"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if rows[0].ExpiresAt != nil {
+		t.Errorf("expected no expiry, got %v", rows[0].ExpiresAt)
+	}
+	if got := rows[1].ExpiresAt; got == nil || !got.Equal(expiresAt) {
+		t.Errorf("expected %v to be %v", got, expiresAt)
+	}
+}
+
+func TestBulkPermission_NewJob(t *testing.T) {
+	t.Parallel()
+
+	b := &BulkPermission{
+		RealmID:     1,
+		UserIDs:     []uint{10, 11, 12},
+		Permissions: rbac.SettingsRead,
+		Action:      BulkPermissionActionRemove,
+	}
+	job, err := b.NewJob(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, lines, err := job.PendingBulkPermission(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pending.UserIDs, []uint{10, 11}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if got, want := lines, []uint{1, 2}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if pending.Permissions != rbac.SettingsRead || pending.Action != BulkPermissionActionRemove {
+		t.Errorf("unexpected operation: %#v", pending)
+	}
+}
+
+func TestDatabase_ClaimJob(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{
+		Email: "job-creator@example.com",
+		Name:  "Job creator",
+	}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := NewUserImportJob(realm.ID, user.ID, &UserImportParams{}, []*UserImportRow{
+		{Line: 1, Email: "imported@example.com", Name: "Imported"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// First claim gets the job, with its items decrypted.
+	claimed, err := db.ClaimJob(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := claimed.ID, job.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := claimed.Attempts, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	rows, err := claimed.PendingUserImportRows(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rows), 1; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := rows[0].Email, "imported@example.com"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Second claim is empty, since the job is leased.
+	if _, err := db.ClaimJob(5 * time.Minute); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	claimed.MarkSucceeded()
+	completedAt := time.Now().UTC().Add(-2 * time.Hour)
+	claimed.CompletedAt = &completedAt
+	if err := db.SaveJob(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs are only visible in their realm, and only to those who can view
+	// their kind.
+	found, err := realm.FindJob(db, job.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found.Status, JobStatusSucceeded; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	otherRealm := &Realm{}
+	otherRealm.ID = realm.ID + 1000
+	if _, err := otherRealm.FindJob(db, job.UUID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	jobs, _, err := realm.ListJobs(db, []JobKind{JobKindUserImport}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(jobs), 1; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	jobs, _, err = realm.ListJobs(db, []JobKind{JobKindBulkIssue}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(jobs), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Finished jobs are purged.
+	count, err := db.PurgeJobs(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
+func TestDatabase_SaveUserImportJob_Large(t *testing.T) {
+	t.Parallel()
+
+	// Items are encrypted with envelope encryption, so a large import fits
+	// under the key manager's plaintext limit.
+	keyManager := newLimitedKeyManager(t)
+	db, _ := testDatabaseInstance.NewDatabase(t, nil, WithKeyManager(&keys.Config{}, keyManager))
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{
+		Email: "job-creator@example.com",
+		Name:  "Job creator",
+	}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// The maximum number of users in an import batch.
+	rows := make([]*UserImportRow, 10000)
+	for i := range rows {
+		rows[i] = &UserImportRow{
+			Line:  uint(i + 1),
+			Email: fmt.Sprintf("imported-%05d@example.com", i),
+			Name:  fmt.Sprintf("Imported user %05d", i),
+		}
+	}
+
+	job, err := NewUserImportJob(realm.ID, user.ID, &UserImportParams{}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Items) <= maxKMSPlaintextBytes {
+		t.Fatalf("expected items to be larger than %d bytes, got %d", maxKMSPlaintextBytes, len(job.Items))
+	}
+	if err := db.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := db.ClaimJob(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := claimed.PendingUserImportRows(uint(len(rows)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(pending), len(rows); got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := pending[len(pending)-1].Email, rows[len(rows)-1].Email; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
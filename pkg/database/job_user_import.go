@@ -0,0 +1,100 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserImportResultImported is the result status of a user who was added to
+// the realm.
+const UserImportResultImported = "imported"
+
+// UserImportRow is a single user from an uploaded user import CSV.
+type UserImportRow struct {
+	// Line is the line number in the uploaded file, starting at 1.
+	Line  uint
+	Email string
+	Name  string
+
+	// ExpiresAt is when the user's membership in the realm expires, if any.
+	ExpiresAt *time.Time
+}
+
+// UserImportParams are the options which apply to every user in a user import
+// job.
+type UserImportParams struct {
+	SendInvites bool `json:"sendInvites,omitempty"`
+}
+
+// NewUserImportJob creates a job which adds each user to the realm.
+func NewUserImportJob(realmID, userID uint, params *UserImportParams, rows []*UserImportRow) (*Job, error) {
+	items := make([]*JobItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, &JobItem{
+			Line:   row.Line,
+			Fields: []string{row.Email, row.Name, formatExpiry(row.ExpiresAt)},
+		})
+	}
+
+	j, err := newJob(JobKindUserImport, realmID, params, items)
+	if err != nil {
+		return nil, err
+	}
+	j.UserID = &userID
+	return j, nil
+}
+
+// UserImportParams returns the options of a user import job.
+func (j *Job) UserImportParams() (*UserImportParams, error) {
+	var params UserImportParams
+	if err := j.parseParams(&params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// PendingUserImportRows returns up to limit users of a user import job which
+// have not yet been processed.
+func (j *Job) PendingUserImportRows(limit uint) ([]*UserImportRow, error) {
+	items, err := j.PendingItems(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*UserImportRow, 0, len(items))
+	for _, item := range items {
+		// Jobs created before membership expiry was supported have 2 fields.
+		if l := len(item.Fields); l != 2 && l != 3 {
+			return nil, fmt.Errorf("failed to decode line %d: expected 3 fields, got %d", item.Line, l)
+		}
+
+		row := &UserImportRow{
+			Line:  item.Line,
+			Email: item.Fields[0],
+			Name:  item.Fields[1],
+		}
+		if len(item.Fields) == 3 && item.Fields[2] != "" {
+			expiresAt, err := time.Parse(time.RFC3339, item.Fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode line %d: invalid expiry: %w", item.Line, err)
+			}
+			row.ExpiresAt = &expiresAt
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
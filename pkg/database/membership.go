@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/jinzhu/gorm"
 )
@@ -39,6 +40,22 @@ type Membership struct {
 
 	Permissions rbac.Permission
 
+	// RoleID is the realm role assigned to the membership, if any. When set,
+	// Permissions mirrors the role's permissions and is updated whenever the
+	// role is updated.
+	RoleID *uint `gorm:"column:role_id; type:integer;"`
+	Role   *Role
+
+	// ExpiresAt is the time at which the membership is revoked, if any. Expired
+	// memberships are ignored when loading a user's realms, and are deleted by
+	// the cleanup service.
+	ExpiresAt *time.Time `gorm:"column:expires_at;"`
+
+	// ExpiryNotifiedAt is the time at which the user and realm admins were
+	// warned that the membership expires soon. It is cleared when ExpiresAt
+	// changes.
+	ExpiryNotifiedAt *time.Time `gorm:"column:expiry_notified_at;"`
+
 	// CreatedAt is when the user was added to the realm. UpdatedAt is when the
 	// user's permissions were last updated. Note that UpdatedAt only applies to
 	// the membership's fields, not the user fields (e.g. email, name).
@@ -131,7 +148,223 @@ func (m *Membership) Can(p rbac.Permission) bool {
 	return rbac.Can(m.Permissions, p)
 }
 
+// IsExpired returns true if the membership has an expiry which has passed.
+func (m *Membership) IsExpired() bool {
+	return m != nil && m.ExpiresAt != nil && !m.ExpiresAt.After(time.Now())
+}
+
+// ExpiresOn returns the UTC date on which the membership expires, formatted as
+// YYYY-MM-DD, or the empty string if the membership does not expire. Since
+// expiry dates are entered as whole days, this is the last day of access.
+func (m *Membership) ExpiresOn() string {
+	if m == nil || m.ExpiresAt == nil {
+		return ""
+	}
+	return m.ExpiresAt.UTC().Add(-time.Nanosecond).Format(project.RFC3339Date)
+}
+
+// HasRole returns true if the membership is assigned to a realm role.
+func (m *Membership) HasRole() bool {
+	return m != nil && m.RoleID != nil
+}
+
 // Cannot returns the opposite of Can
 func (m *Membership) Cannot(p rbac.Permission) bool {
 	return !m.Can(p)
 }
+
+// ParseExpiresOn parses a YYYY-MM-DD date as the last day of access (of a
+// membership or API key), returning the time at which access expires: the
+// start of the following day, in UTC. It returns nil if s is empty, and an
+// error if the date is not in the future.
+func ParseExpiresOn(s string) (*time.Time, error) {
+	s = project.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	day, err := time.Parse(project.RFC3339Date, s)
+	if err != nil {
+		return nil, fmt.Errorf("expiry date %q is not a valid YYYY-MM-DD date", s)
+	}
+
+	expiresAt := day.UTC().AddDate(0, 0, 1)
+	if !expiresAt.After(time.Now().UTC()) {
+		return nil, fmt.Errorf("expiry date %s is not in the future", s)
+	}
+	return &expiresAt, nil
+}
+
+// UpdateMembershipExpiry sets the time at which the user's membership in the
+// realm expires. If expiresAt is nil, the membership does not expire. Changing
+// the expiry clears any previous expiry warning, so the user and realm admins
+// are warned again before the new expiry.
+func (u *User) UpdateMembershipExpiry(db *Database, r *Realm, expiresAt *time.Time, actor Auditable) error {
+	if actor == nil {
+		return fmt.Errorf("auditable actor cannot be nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var existing struct {
+			ExpiresAt *time.Time
+		}
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Table("memberships").
+			Select("expires_at").
+			Where("user_id = ? AND realm_id = ?", u.ID, r.ID).
+			Scan(&existing).
+			Error; err != nil {
+			return err
+		}
+
+		if formatExpiry(existing.ExpiresAt) == formatExpiry(expiresAt) {
+			return nil
+		}
+
+		if err := tx.
+			Model(&Membership{}).
+			Where("user_id = ? AND realm_id = ?", u.ID, r.ID).
+			UpdateColumns(map[string]interface{}{
+				"expires_at":         expiresAt,
+				"expiry_notified_at": gorm.Expr("NULL"),
+				"updated_at":         time.Now().UTC(),
+			}).
+			Error; err != nil {
+			return fmt.Errorf("failed to update membership expiry: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "updated user membership expiry", u, r.ID)
+		audit.Diff = stringDiff(formatExpiry(existing.ExpiresAt), formatExpiry(expiresAt))
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audit: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListExpiringMemberships lists the memberships which expire within the given
+// duration and whose user and realm admins have not yet been warned.
+func (db *Database) ListExpiringMemberships(within time.Duration) ([]*Membership, error) {
+	now := time.Now().UTC()
+
+	var memberships []*Membership
+	if err := db.db.
+		Preload("Realm").
+		Preload("User").
+		Model(&Membership{}).
+		Where("expires_at > ? AND expires_at <= ?", now, now.Add(within)).
+		Where("expiry_notified_at IS NULL").
+		Order("realm_id, expires_at").
+		Find(&memberships).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return memberships, nil
+		}
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// MarkMembershipExpiryNotified records that the user and realm admins were
+// warned that the membership expires soon.
+func (db *Database) MarkMembershipExpiryNotified(m *Membership) error {
+	now := time.Now().UTC()
+	if err := db.db.
+		Model(&Membership{}).
+		Where("user_id = ? AND realm_id = ?", m.UserID, m.RealmID).
+		UpdateColumn("expiry_notified_at", now).
+		Error; err != nil {
+		return err
+	}
+	m.ExpiryNotifiedAt = &now
+	return nil
+}
+
+// RevokeExpiredMemberships deletes all memberships whose expiry has passed,
+// creating an audit entry for each, and returns the number of memberships
+// revoked.
+func (db *Database) RevokeExpiredMemberships() (int64, error) {
+	var count int64
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		var memberships []*Membership
+		if err := tx.
+			Preload("Realm").
+			Preload("User").
+			Model(&Membership{}).
+			Where("expires_at <= ?", now).
+			Find(&memberships).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to list expired memberships: %w", err)
+		}
+
+		for _, membership := range memberships {
+			result := tx.
+				Unscoped().
+				Where("user_id = ? AND realm_id = ?", membership.UserID, membership.RealmID).
+				Where("expires_at <= ?", now).
+				Delete(&Membership{})
+			if err := result.Error; err != nil {
+				return fmt.Errorf("failed to delete membership: %w", err)
+			}
+
+			// The expiry was changed after the memberships were listed.
+			if result.RowsAffected == 0 {
+				continue
+			}
+			count++
+
+			audit := BuildAuditEntry(System, "removed expired user from realm", membership.User, membership.RealmID)
+			audit.Diff = stringDiff(formatExpiry(membership.ExpiresAt), "")
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audit: %w", err)
+			}
+
+			// Cascade updated_at on user
+			if err := tx.
+				Model(&User{}).
+				Where("id = ?", membership.UserID).
+				UpdateColumn("updated_at", now).
+				Error; err != nil {
+				return fmt.Errorf("failed to update user updated_at: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ListMemberEmails lists the email addresses of the realm's current members
+// who have the given permission.
+func (r *Realm) ListMemberEmails(db *Database, p rbac.Permission) ([]string, error) {
+	var emails []string
+	if err := db.db.
+		Model(&Membership{}).
+		Scopes(WithPermissionSearch(p)).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.realm_id = ?", r.ID).
+		Where("memberships.expires_at IS NULL OR memberships.expires_at > ?", time.Now().UTC()).
+		Where("users.deleted_at IS NULL").
+		Order("users.email").
+		Pluck("users.email", &emails).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return emails, nil
+		}
+		return nil, err
+	}
+	return emails, nil
+}
+
+// formatExpiry formats the membership expiry for audit entries.
+func formatExpiry(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
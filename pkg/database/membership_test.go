@@ -16,7 +16,9 @@ package database
 
 import (
 	"testing"
+	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
 
@@ -108,3 +110,179 @@ func TestMembership_SaveMembership(t *testing.T) {
 		t.Fatalf("expected to find the same membership. got %v, want %v", m.RealmID, found.RealmID)
 	}
 }
+
+func TestParseExpiresOn(t *testing.T) {
+	t.Parallel()
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+
+	cases := []struct {
+		name  string
+		input string
+		want  string
+		err   bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "future",
+			input: tomorrow.Format(project.RFC3339Date),
+			want:  tomorrow.AddDate(0, 0, 1).Format(project.RFC3339Date) + "T00:00:00Z",
+		},
+		{
+			name:  "past",
+			input: "2020-01-01",
+			err:   true,
+		},
+		{
+			name:  "invalid",
+			input: "tomorrow",
+			err:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseExpiresOn(tc.input)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if gotStr := formatExpiry(got); gotStr != tc.want {
+				t.Errorf("expected %q to be %q", gotStr, tc.want)
+			}
+
+			if got != nil {
+				m := &Membership{ExpiresAt: got}
+				if m.IsExpired() {
+					t.Errorf("expected membership to not be expired")
+				}
+				if got, want := m.ExpiresOn(), tc.input; got != want {
+					t.Errorf("expected %q to be %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMembership_Expiry(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("test")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &User{Email: "admin@example.com", Name: "Admin"}
+	if err := db.SaveUser(admin, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.AddToRealm(db, realm, rbac.LegacyRealmAdmin, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	expiring := &User{Email: "expiring@example.com", Name: "Expiring"}
+	if err := db.SaveUser(expiring, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := expiring.AddToRealm(db, realm, rbac.CodeIssue, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := &User{Email: "expired@example.com", Name: "Expired"}
+	if err := db.SaveUser(expired, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := expired.AddToRealm(db, realm, rbac.LegacyRealmAdmin, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	soon := time.Now().UTC().Add(24 * time.Hour)
+	if err := expiring.UpdateMembershipExpiry(db, realm, &soon, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().UTC().Add(-1 * time.Hour)
+	if err := expired.UpdateMembershipExpiry(db, realm, &past, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired memberships do not grant access.
+	memberships, err := expired.ListMemberships(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(memberships), 0; got != want {
+		t.Errorf("expected %d memberships to be %d", got, want)
+	}
+	if _, err := expired.SelectFirstMembership(db); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// Only current admins are listed.
+	emails, err := realm.ListMemberEmails(db, rbac.UserWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emails, []string{"admin@example.com"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	// Only the expiring membership needs a warning.
+	warnings, err := db.ListExpiringMemberships(72 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(warnings), 1; got != want {
+		t.Fatalf("expected %d warnings to be %d", got, want)
+	}
+	if got, want := warnings[0].UserID, expiring.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	if err := db.MarkMembershipExpiryNotified(warnings[0]); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err = db.ListExpiringMemberships(72 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(warnings), 0; got != want {
+		t.Errorf("expected %d warnings to be %d", got, want)
+	}
+
+	// Only the expired membership is revoked.
+	count, err := db.RevokeExpiredMemberships()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	if _, err := expired.FindMembership(db, realm.ID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if _, err := expiring.FindMembership(db, realm.ID); err != nil {
+		t.Errorf("expected membership, got %v", err)
+	}
+
+	// Clearing the expiry removes it.
+	if err := expiring.UpdateMembershipExpiry(db, realm, nil, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	membership, err := expiring.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.ExpiresAt != nil {
+		t.Errorf("expected no expiry, got %v", membership.ExpiresAt)
+	}
+}
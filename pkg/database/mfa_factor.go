@@ -0,0 +1,464 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/totp"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrInvalidMFACode is returned when a one-time code or recovery code is
+// invalid or was already used.
+var ErrInvalidMFACode = errors.New("invalid or already used code")
+
+const (
+	// mfaRecoveryCodeCount is the number of recovery codes generated at once.
+	mfaRecoveryCodeCount = 10
+
+	// mfaRecoveryCodeBytes is the entropy of each recovery code (80 bits).
+	mfaRecoveryCodeBytes = 10
+)
+
+// MFAFactorType is the kind of second factor.
+type MFAFactorType string
+
+const (
+	// MFAFactorTOTP is an authenticator app which generates time-based codes.
+	MFAFactorTOTP MFAFactorType = "totp"
+
+	// MFAFactorWebAuthn is a security key or platform authenticator.
+	MFAFactorWebAuthn MFAFactorType = "webauthn"
+)
+
+// Display returns the human-readable name of the factor type.
+func (t MFAFactorType) Display() string {
+	switch t {
+	case MFAFactorTOTP:
+		return "Authenticator app"
+	case MFAFactorWebAuthn:
+		return "Security key"
+	default:
+		return string(t)
+	}
+}
+
+// MFAFactor is a second factor enrolled by a user. Factors are only used with
+// auth providers which do not have their own second factor.
+type MFAFactor struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// UserID is the user who enrolled the factor.
+	UserID uint
+
+	// Type is the kind of factor.
+	Type MFAFactorType `gorm:"column:type; type:text;"`
+
+	// Name is the user-provided name of the factor, such as "Work phone".
+	Name string `gorm:"column:name; type:text;"`
+
+	// Secret is the TOTP secret. It is encrypted/decrypted automatically by
+	// callbacks. The cache fields exist as optimizations.
+	Secret                string `gorm:"column:secret; type:text;" json:"-"` // ignored by zap's JSON formatter
+	SecretPlaintextCache  string `gorm:"-"`
+	SecretCiphertextCache string `gorm:"-"`
+
+	// LastStep is the time step of the last accepted TOTP code. Codes at or
+	// before this step are rejected, so a code cannot be used twice.
+	LastStep int64 `gorm:"column:last_step; type:bigint;"`
+
+	// CredentialID and PublicKey identify a WebAuthn credential. PublicKey is
+	// the CBOR-encoded COSE key.
+	CredentialID []byte `gorm:"column:credential_id; type:bytea;"`
+	PublicKey    []byte `gorm:"column:public_key; type:bytea;"`
+
+	// SignCount is the WebAuthn authenticator's last signature counter.
+	SignCount int64 `gorm:"column:sign_count; type:bigint;"`
+
+	// LastUsedAt is the last time the factor was used to sign in.
+	LastUsedAt *time.Time `gorm:"column:last_used_at;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (f *MFAFactor) BeforeSave(tx *gorm.DB) error {
+	if f.UserID == 0 {
+		f.AddError("userID", "cannot be blank")
+	}
+
+	f.Name = project.TrimSpace(f.Name)
+	if f.Name == "" {
+		f.AddError("name", "cannot be blank")
+	}
+	if len(f.Name) > 100 {
+		f.AddError("name", "must be 100 characters or fewer")
+	}
+
+	switch f.Type {
+	case MFAFactorTOTP:
+		if f.Secret == "" {
+			f.AddError("secret", "cannot be blank")
+		}
+	case MFAFactorWebAuthn:
+		if len(f.CredentialID) == 0 {
+			f.AddError("credentialID", "cannot be blank")
+		}
+		if len(f.PublicKey) == 0 {
+			f.AddError("publicKey", "cannot be blank")
+		}
+	default:
+		f.AddError("type", "is invalid")
+	}
+	return f.ErrorOrNil()
+}
+
+func (f *MFAFactor) AuditID() string {
+	return fmt.Sprintf("mfa_factors:%d", f.ID)
+}
+
+func (f *MFAFactor) AuditDisplay() string {
+	return fmt.Sprintf("%s (%s)", f.Name, f.Type.Display())
+}
+
+// MFARecoveryCode is a single-use code which a user can sign in with if they
+// lose their second factors. Only a hash of the code is stored.
+type MFARecoveryCode struct {
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// UserID is the user who owns the code.
+	UserID uint
+
+	// CodeHash is the hex-encoded SHA-256 hash of the normalized code. Codes
+	// are random, so a fast hash is sufficient.
+	CodeHash string `gorm:"column:code_hash; type:text;"`
+
+	// UsedAt is the time the code was used, if it was used.
+	UsedAt *time.Time `gorm:"column:used_at;"`
+
+	CreatedAt time.Time
+}
+
+// ListMFAFactors lists the user's enrolled factors, oldest first.
+func (u *User) ListMFAFactors(db *Database) ([]*MFAFactor, error) {
+	var factors []*MFAFactor
+	if err := db.db.
+		Model(&MFAFactor{}).
+		Where("user_id = ?", u.ID).
+		Order("created_at ASC, id ASC").
+		Find(&factors).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	return factors, nil
+}
+
+// HasMFAFactors returns true if the user has enrolled at least one factor.
+func (u *User) HasMFAFactors(db *Database) (bool, error) {
+	var count int64
+	if err := db.db.
+		Model(&MFAFactor{}).
+		Where("user_id = ?", u.ID).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindMFAFactor finds the user's factor by ID.
+func (u *User) FindMFAFactor(db *Database, id interface{}) (*MFAFactor, error) {
+	var factor MFAFactor
+	if err := db.db.
+		Model(&MFAFactor{}).
+		Where("user_id = ? AND id = ?", u.ID, id).
+		First(&factor).
+		Error; err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+// FindMFAFactorByCredentialID finds the user's WebAuthn factor by its
+// credential ID.
+func (u *User) FindMFAFactorByCredentialID(db *Database, credentialID []byte) (*MFAFactor, error) {
+	var factor MFAFactor
+	if err := db.db.
+		Model(&MFAFactor{}).
+		Where("user_id = ? AND type = ? AND credential_id = ?", u.ID, MFAFactorWebAuthn, credentialID).
+		First(&factor).
+		Error; err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+// SaveMFAFactor creates or updates the factor.
+func (db *Database) SaveMFAFactor(f *MFAFactor, actor Auditable) error {
+	if f == nil {
+		return fmt.Errorf("provided mfa factor is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing MFAFactor
+		if err := tx.
+			Model(&MFAFactor{}).
+			Where("id = ?", f.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing mfa factor: %w", err)
+		}
+
+		if err := tx.Save(f).Error; err != nil {
+			if IsUniqueViolation(err, "uix_mfa_factors_credential_id") {
+				f.AddError("credentialID", "is already registered")
+				return ErrValidationFailed
+			}
+			return err
+		}
+
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "added mfa factor", f, 0)
+			audits = append(audits, audit)
+		} else if existing.Name != f.Name {
+			audit := BuildAuditEntry(actor, "updated mfa factor name", f, 0)
+			audit.Diff = stringDiff(existing.Name, f.Name)
+			audits = append(audits, audit)
+		}
+
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMFAFactor deletes the factor.
+func (db *Database) DeleteMFAFactor(f *MFAFactor, actor Auditable) error {
+	if f == nil {
+		return fmt.Errorf("provided mfa factor is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(f).Error; err != nil {
+			return fmt.Errorf("failed to delete mfa factor: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "removed mfa factor", f, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// UseTOTPCode checks the code against the user's authenticator apps and
+// returns the matching factor. The factor's last step is updated in the same
+// transaction, so each code can only be used once. If no factor matches, it
+// returns ErrInvalidMFACode.
+func (db *Database) UseTOTPCode(u *User, code string, now time.Time) (*MFAFactor, error) {
+	var matched *MFAFactor
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		var factors []*MFAFactor
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&MFAFactor{}).
+			Where("user_id = ? AND type = ?", u.ID, MFAFactorTOTP).
+			Order("id ASC").
+			Find(&factors).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to list mfa factors: %w", err)
+		}
+
+		for _, f := range factors {
+			step, ok, err := totp.Validate(f.Secret, code, now, f.LastStep)
+			if err != nil {
+				return fmt.Errorf("failed to validate code for mfa factor %d: %w", f.ID, err)
+			}
+			if !ok {
+				continue
+			}
+
+			usedAt := now.UTC()
+			if err := tx.
+				Model(&MFAFactor{}).
+				Where("id = ?", f.ID).
+				UpdateColumns(map[string]interface{}{
+					"last_step":    step,
+					"last_used_at": usedAt,
+				}).
+				Error; err != nil {
+				return fmt.Errorf("failed to update mfa factor: %w", err)
+			}
+
+			f.LastStep = step
+			f.LastUsedAt = &usedAt
+			matched = f
+			return nil
+		}
+		return ErrInvalidMFACode
+	}); err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// RecordWebAuthnUse saves the new signature counter of the WebAuthn factor
+// after a successful assertion.
+func (db *Database) RecordWebAuthnUse(f *MFAFactor, signCount uint32) error {
+	now := time.Now().UTC()
+	if err := db.db.
+		Model(&MFAFactor{}).
+		Where("id = ?", f.ID).
+		UpdateColumns(map[string]interface{}{
+			"sign_count":   int64(signCount),
+			"last_used_at": now,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("failed to update mfa factor: %w", err)
+	}
+
+	f.SignCount = int64(signCount)
+	f.LastUsedAt = &now
+	return nil
+}
+
+// CountMFARecoveryCodes returns the number of unused recovery codes the user
+// has.
+func (u *User) CountMFARecoveryCodes(db *Database) (int64, error) {
+	var count int64
+	if err := db.db.
+		Model(&MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", u.ID).
+		Count(&count).
+		Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RegenerateMFARecoveryCodes replaces the user's recovery codes with new ones
+// and returns them. The codes cannot be retrieved again.
+func (db *Database) RegenerateMFARecoveryCodes(u *User, actor Auditable) ([]string, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	codes := make([]string, 0, mfaRecoveryCodeCount)
+	for i := 0; i < mfaRecoveryCodeCount; i++ {
+		code, err := generateMFARecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("user_id = ?", u.ID).
+			Delete(&MFARecoveryCode{}).
+			Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		for _, code := range codes {
+			if err := tx.Create(&MFARecoveryCode{
+				UserID:   u.ID,
+				CodeHash: hashMFARecoveryCode(code),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to save recovery code: %w", err)
+			}
+		}
+
+		audit := BuildAuditEntry(actor, "regenerated mfa recovery codes", u, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseMFARecoveryCode marks the user's recovery code as used. If the code does
+// not exist or was already used, it returns ErrInvalidMFACode.
+func (db *Database) UseMFARecoveryCode(u *User, code string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Model(&MFARecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, hashMFARecoveryCode(code)).
+			UpdateColumn("used_at", time.Now().UTC())
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to use recovery code: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+
+		audit := BuildAuditEntry(u, "used mfa recovery code", u, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// generateMFARecoveryCode generates a random recovery code formatted as four
+// groups of four characters.
+func generateMFARecoveryCode() (string, error) {
+	b := make([]byte, mfaRecoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// hashMFARecoveryCode hashes the recovery code, ignoring case, spaces, and
+// dashes.
+func hashMFARecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
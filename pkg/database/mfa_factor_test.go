@@ -0,0 +1,245 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/totp"
+)
+
+func TestMFAFactor_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		factor *MFAFactor
+		errs   []string
+	}{
+		{
+			name:   "empty",
+			factor: &MFAFactor{},
+			errs:   []string{"userID", "name", "type"},
+		},
+		{
+			name:   "totp_missing_secret",
+			factor: &MFAFactor{UserID: 1, Name: "Phone", Type: MFAFactorTOTP},
+			errs:   []string{"secret"},
+		},
+		{
+			name:   "webauthn_missing_key",
+			factor: &MFAFactor{UserID: 1, Name: "Key", Type: MFAFactorWebAuthn},
+			errs:   []string{"credentialID", "publicKey"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.factor.BeforeSave(nil)
+			for _, k := range tc.errs {
+				if len(tc.factor.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+		})
+	}
+}
+
+func TestHashMFARecoveryCode(t *testing.T) {
+	t.Parallel()
+
+	want := hashMFARecoveryCode("abcd-efgh-ijkl-mnop")
+	for _, code := range []string{"ABCD-EFGH-IJKL-MNOP", "abcdefghijklmnop", " abcd efgh ijkl mnop "} {
+		if got := hashMFARecoveryCode(code); got != want {
+			t.Errorf("expected %q to hash to %q, got %q", code, want, got)
+		}
+	}
+}
+
+func TestDatabase_MFAFactors(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "mfa@example.com", Name: "MFA"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	has, err := user.HasMFAFactors(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Errorf("expected user to have no factors")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	factor := &MFAFactor{
+		UserID: user.ID,
+		Type:   MFAFactorTOTP,
+		Name:   "Phone",
+		Secret: secret,
+	}
+	if err := db.SaveMFAFactor(factor, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("secret_encrypted", func(t *testing.T) {
+		var raw string
+		if err := db.RawDB().
+			Table("mfa_factors").
+			Where("id = ?", factor.ID).
+			Select("secret").
+			Row().
+			Scan(&raw); err != nil {
+			t.Fatal(err)
+		}
+		if raw == secret {
+			t.Errorf("expected secret to be encrypted")
+		}
+
+		got, err := user.FindMFAFactor(db, factor.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Secret != secret {
+			t.Errorf("expected secret to be decrypted")
+		}
+	})
+
+	t.Run("use_totp_code", func(t *testing.T) {
+		now := time.Now()
+		code, err := totp.Code(secret, totp.Step(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stale, err := totp.Code(secret, totp.Step(now)-10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stale != code {
+			if _, err := db.UseTOTPCode(user, stale, now); !errors.Is(err, ErrInvalidMFACode) {
+				t.Errorf("expected %v, got %v", ErrInvalidMFACode, err)
+			}
+		}
+
+		got, err := db.UseTOTPCode(user, code, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != factor.ID {
+			t.Errorf("expected factor %d, got %d", factor.ID, got.ID)
+		}
+
+		// Replaying the same code fails.
+		if _, err := db.UseTOTPCode(user, code, now); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("expected %v, got %v", ErrInvalidMFACode, err)
+		}
+	})
+
+	t.Run("credential_id_unique", func(t *testing.T) {
+		key := &MFAFactor{
+			UserID:       user.ID,
+			Type:         MFAFactorWebAuthn,
+			Name:         "Key",
+			CredentialID: []byte("credential"),
+			PublicKey:    []byte("public-key"),
+		}
+		if err := db.SaveMFAFactor(key, SystemTest); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := user.FindMFAFactorByCredentialID(db, []byte("credential"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != key.ID {
+			t.Errorf("expected factor %d, got %d", key.ID, got.ID)
+		}
+
+		dup := &MFAFactor{
+			UserID:       user.ID,
+			Type:         MFAFactorWebAuthn,
+			Name:         "Duplicate",
+			CredentialID: []byte("credential"),
+			PublicKey:    []byte("public-key"),
+		}
+		if err := db.SaveMFAFactor(dup, SystemTest); !IsValidationError(err) {
+			t.Errorf("expected validation error, got %v", err)
+		}
+
+		if err := db.RecordWebAuthnUse(key, 5); err != nil {
+			t.Fatal(err)
+		}
+		got, err = user.FindMFAFactor(db, key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := got.SignCount, int64(5); got != want {
+			t.Errorf("expected sign count %d to be %d", got, want)
+		}
+
+		if err := db.DeleteMFAFactor(key, SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := user.FindMFAFactor(db, key.ID); !IsNotFound(err) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("recovery_codes", func(t *testing.T) {
+		codes, err := db.RegenerateMFARecoveryCodes(user, SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(codes), mfaRecoveryCodeCount; got != want {
+			t.Fatalf("expected %d codes, got %d", want, got)
+		}
+
+		if err := db.UseMFARecoveryCode(user, codes[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UseMFARecoveryCode(user, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("expected %v, got %v", ErrInvalidMFACode, err)
+		}
+
+		count, err := user.CountMFARecoveryCodes(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := count, int64(mfaRecoveryCodeCount-1); got != want {
+			t.Errorf("expected %d unused codes, got %d", want, got)
+		}
+
+		// Regenerating invalidates the old codes.
+		if _, err := db.RegenerateMFARecoveryCodes(user, SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UseMFARecoveryCode(user, codes[1]); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("expected %v, got %v", ErrInvalidMFACode, err)
+		}
+	})
+}
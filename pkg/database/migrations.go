@@ -2452,6 +2452,608 @@ func (db *Database) Migrations(ctx context.Context) []*gormigrate.Migration {
 				)
 			},
 		},
+		{
+			ID: "00115-AddSMSConfigProviders",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE sms_configs
+						ADD COLUMN IF NOT EXISTS vonage_api_key VARCHAR(250),
+						ADD COLUMN IF NOT EXISTS vonage_api_secret VARCHAR(250),
+						ADD COLUMN IF NOT EXISTS vonage_from_number VARCHAR(255),
+						ADD COLUMN IF NOT EXISTS http_endpoint TEXT,
+						ADD COLUMN IF NOT EXISTS http_auth_header VARCHAR(250),
+						ADD COLUMN IF NOT EXISTS http_auth_token TEXT,
+						ADD COLUMN IF NOT EXISTS http_body_template TEXT,
+						ADD COLUMN IF NOT EXISTS http_from_number VARCHAR(255)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE sms_configs
+						DROP COLUMN IF EXISTS vonage_api_key,
+						DROP COLUMN IF EXISTS vonage_api_secret,
+						DROP COLUMN IF EXISTS vonage_from_number,
+						DROP COLUMN IF EXISTS http_endpoint,
+						DROP COLUMN IF EXISTS http_auth_header,
+						DROP COLUMN IF EXISTS http_auth_token,
+						DROP COLUMN IF EXISTS http_body_template,
+						DROP COLUMN IF EXISTS http_from_number`,
+				)
+			},
+		},
+		{
+			ID: "00116-AddSMSConfigPriority",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE sms_configs
+						ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0`,
+					`CREATE INDEX IF NOT EXISTS idx_sms_configs_realm_id_priority ON sms_configs(realm_id, priority)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_sms_configs_realm_id_priority`,
+					`DELETE FROM sms_configs WHERE priority > 0`,
+					`ALTER TABLE sms_configs
+						DROP COLUMN IF EXISTS priority`,
+				)
+			},
+		},
+		{
+			ID: "00117-CreateSMSOutboxMessages",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE sms_outbox_messages (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						verification_code_id INTEGER NOT NULL REFERENCES verification_codes(id) ON DELETE CASCADE,
+						phone_number TEXT,
+						message TEXT,
+						status TEXT NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						expires_at TIMESTAMP WITH TIME ZONE,
+						last_error TEXT,
+						sent_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE UNIQUE INDEX uix_sms_outbox_messages_verification_code_id ON sms_outbox_messages(verification_code_id)`,
+					`CREATE INDEX idx_sms_outbox_messages_status_next_attempt_at ON sms_outbox_messages(status, next_attempt_at)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS sms_outbox_messages`,
+				)
+			},
+		},
+		{
+			ID: "00118-AddRealmEmailCodeTemplate",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS email_code_template TEXT`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS email_code_template`,
+				)
+			},
+		},
+		{
+			ID: "00119-AddEmailConfigHTTPProvider",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE email_configs
+						ADD COLUMN IF NOT EXISTS http_endpoint TEXT,
+						ADD COLUMN IF NOT EXISTS http_from_address VARCHAR(250),
+						ADD COLUMN IF NOT EXISTS http_api_key TEXT`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE email_configs
+						DROP COLUMN IF EXISTS http_endpoint,
+						DROP COLUMN IF EXISTS http_from_address,
+						DROP COLUMN IF EXISTS http_api_key`,
+				)
+			},
+		},
+		{
+			ID: "00120-AddSMSDeliveryStatus",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS sms_delivery_status TEXT`,
+					`ALTER TABLE realm_stats
+						ADD COLUMN IF NOT EXISTS codes_delivered INTEGER DEFAULT 0,
+						ADD COLUMN IF NOT EXISTS codes_undelivered INTEGER DEFAULT 0`,
+					`ALTER TABLE realm_stats
+						ALTER COLUMN codes_delivered SET NOT NULL,
+						ALTER COLUMN codes_undelivered SET NOT NULL`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realm_stats
+						DROP COLUMN IF EXISTS codes_delivered,
+						DROP COLUMN IF EXISTS codes_undelivered`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS sms_delivery_status`,
+				)
+			},
+		},
+		{
+			ID: "00121-CreateWebhooks",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE webhook_subscriptions (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						authorized_app_id INTEGER REFERENCES authorized_apps(id) ON DELETE CASCADE,
+						url TEXT NOT NULL,
+						secret TEXT NOT NULL,
+						events TEXT[] NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE INDEX idx_webhook_subscriptions_realm_id ON webhook_subscriptions(realm_id)`,
+					`CREATE TABLE webhook_deliveries (
+						id BIGSERIAL PRIMARY KEY,
+						webhook_subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						event TEXT NOT NULL,
+						verification_code_uuid UUID NOT NULL,
+						payload TEXT NOT NULL,
+						status TEXT NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						last_status_code INTEGER NOT NULL DEFAULT 0,
+						last_error TEXT,
+						delivered_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE INDEX idx_webhook_deliveries_status_next_attempt_at ON webhook_deliveries(status, next_attempt_at)`,
+					`CREATE INDEX idx_webhook_deliveries_webhook_subscription_id_created_at ON webhook_deliveries(webhook_subscription_id, created_at)`,
+					`CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries(created_at)`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS expired_event_queued BOOLEAN NOT NULL DEFAULT false`,
+					`CREATE INDEX IF NOT EXISTS idx_vercode_expired_event_pending ON verification_codes(long_expires_at) WHERE claimed = false AND expired_event_queued = false`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_vercode_expired_event_pending`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS expired_event_queued`,
+					`DROP TABLE IF EXISTS webhook_deliveries`,
+					`DROP TABLE IF EXISTS webhook_subscriptions`,
+				)
+			},
+		},
+		{
+			ID: "00122-AddSMSReminders",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						ADD COLUMN IF NOT EXISTS sms_reminder_hours SMALLINT NOT NULL DEFAULT 0,
+						ADD COLUMN IF NOT EXISTS sms_reminder_template_label TEXT NOT NULL DEFAULT ''`,
+					`ALTER TABLE sms_outbox_messages ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'code'`,
+					`DROP INDEX IF EXISTS uix_sms_outbox_messages_verification_code_id`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_sms_outbox_messages_verification_code_id_kind ON sms_outbox_messages(verification_code_id, kind)`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS sms_reminder_status TEXT`,
+					`ALTER TABLE realm_stats
+						ADD COLUMN IF NOT EXISTS sms_reminders_sent INTEGER DEFAULT 0,
+						ADD COLUMN IF NOT EXISTS codes_claimed_after_reminder INTEGER DEFAULT 0`,
+					`ALTER TABLE realm_stats
+						ALTER COLUMN sms_reminders_sent SET NOT NULL,
+						ALTER COLUMN codes_claimed_after_reminder SET NOT NULL`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realm_stats
+						DROP COLUMN IF EXISTS sms_reminders_sent,
+						DROP COLUMN IF EXISTS codes_claimed_after_reminder`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS sms_reminder_status`,
+					`DELETE FROM sms_outbox_messages WHERE kind != 'code'`,
+					`DROP INDEX IF EXISTS uix_sms_outbox_messages_verification_code_id_kind`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_sms_outbox_messages_verification_code_id ON sms_outbox_messages(verification_code_id)`,
+					`ALTER TABLE sms_outbox_messages DROP COLUMN IF EXISTS kind`,
+					`ALTER TABLE realms
+						DROP COLUMN IF EXISTS sms_reminder_hours,
+						DROP COLUMN IF EXISTS sms_reminder_template_label`,
+				)
+			},
+		},
+		{
+			ID: "00123-CreateBulkIssueJobs",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE bulk_issue_jobs (
+						id BIGSERIAL PRIMARY KEY,
+						uuid UUID NOT NULL,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						authorized_app_id INTEGER NOT NULL REFERENCES authorized_apps(id) ON DELETE CASCADE,
+						params TEXT,
+						items TEXT,
+						results TEXT,
+						status TEXT NOT NULL,
+						total_items INTEGER NOT NULL DEFAULT 0,
+						processed_items INTEGER NOT NULL DEFAULT 0,
+						succeeded_items INTEGER NOT NULL DEFAULT 0,
+						failed_items INTEGER NOT NULL DEFAULT 0,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						last_error TEXT,
+						completed_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE UNIQUE INDEX uix_bulk_issue_jobs_uuid ON bulk_issue_jobs(uuid)`,
+					`CREATE INDEX idx_bulk_issue_jobs_status_next_attempt_at ON bulk_issue_jobs(status, next_attempt_at)`,
+					`CREATE INDEX idx_bulk_issue_jobs_completed_at ON bulk_issue_jobs(completed_at)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS bulk_issue_jobs`,
+				)
+			},
+		},
+		{
+			ID: "00124-CreateJobs",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					// Bulk issue jobs become the first kind of background job.
+					`ALTER TABLE bulk_issue_jobs RENAME TO jobs`,
+					`ALTER SEQUENCE bulk_issue_jobs_id_seq RENAME TO jobs_id_seq`,
+					`ALTER INDEX bulk_issue_jobs_pkey RENAME TO jobs_pkey`,
+					`ALTER INDEX uix_bulk_issue_jobs_uuid RENAME TO uix_jobs_uuid`,
+					`ALTER INDEX idx_bulk_issue_jobs_status_next_attempt_at RENAME TO idx_jobs_status_next_attempt_at`,
+					`ALTER INDEX idx_bulk_issue_jobs_completed_at RENAME TO idx_jobs_completed_at`,
+					`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'bulk_issue'`,
+					`ALTER TABLE jobs ALTER COLUMN kind DROP DEFAULT`,
+					`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE SET NULL`,
+
+					// Jobs outlive the API key or user which created them.
+					`ALTER TABLE jobs ALTER COLUMN authorized_app_id DROP NOT NULL`,
+					`ALTER TABLE jobs DROP CONSTRAINT IF EXISTS bulk_issue_jobs_authorized_app_id_fkey`,
+					`ALTER TABLE jobs ADD CONSTRAINT jobs_authorized_app_id_fkey
+						FOREIGN KEY (authorized_app_id) REFERENCES authorized_apps(id) ON DELETE SET NULL`,
+					`ALTER TABLE jobs RENAME CONSTRAINT bulk_issue_jobs_realm_id_fkey TO jobs_realm_id_fkey`,
+					`CREATE INDEX IF NOT EXISTS idx_jobs_realm_id_created_at ON jobs(realm_id, created_at)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DELETE FROM jobs WHERE kind != 'bulk_issue' OR authorized_app_id IS NULL`,
+					`DROP INDEX IF EXISTS idx_jobs_realm_id_created_at`,
+					`ALTER TABLE jobs RENAME CONSTRAINT jobs_realm_id_fkey TO bulk_issue_jobs_realm_id_fkey`,
+					`ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_authorized_app_id_fkey`,
+					`ALTER TABLE jobs ADD CONSTRAINT bulk_issue_jobs_authorized_app_id_fkey
+						FOREIGN KEY (authorized_app_id) REFERENCES authorized_apps(id) ON DELETE CASCADE`,
+					`ALTER TABLE jobs ALTER COLUMN authorized_app_id SET NOT NULL`,
+					`ALTER TABLE jobs DROP COLUMN IF EXISTS user_id`,
+					`ALTER TABLE jobs DROP COLUMN IF EXISTS kind`,
+					`ALTER INDEX idx_jobs_completed_at RENAME TO idx_bulk_issue_jobs_completed_at`,
+					`ALTER INDEX idx_jobs_status_next_attempt_at RENAME TO idx_bulk_issue_jobs_status_next_attempt_at`,
+					`ALTER INDEX uix_jobs_uuid RENAME TO uix_bulk_issue_jobs_uuid`,
+					`ALTER INDEX jobs_pkey RENAME TO bulk_issue_jobs_pkey`,
+					`ALTER SEQUENCE jobs_id_seq RENAME TO bulk_issue_jobs_id_seq`,
+					`ALTER TABLE jobs RENAME TO bulk_issue_jobs`,
+				)
+			},
+		},
+		{
+			ID: "00125-CreateRoles",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE roles (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						name TEXT NOT NULL,
+						description TEXT,
+						permissions BIGINT NOT NULL DEFAULT 0,
+						created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE UNIQUE INDEX uix_roles_realm_id_name ON roles(realm_id, LOWER(name))`,
+					`ALTER TABLE memberships ADD COLUMN IF NOT EXISTS role_id INTEGER REFERENCES roles(id) ON DELETE SET NULL`,
+					`CREATE INDEX idx_memberships_role_id ON memberships(role_id)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_memberships_role_id`,
+					`ALTER TABLE memberships DROP COLUMN IF EXISTS role_id`,
+					`DROP TABLE IF EXISTS roles`,
+				)
+			},
+		},
+		{
+			ID: "00126-AddMembershipExpiry",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE memberships ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE memberships ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP WITH TIME ZONE`,
+					`CREATE INDEX IF NOT EXISTS idx_memberships_expires_at ON memberships(expires_at)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_memberships_expires_at`,
+					`ALTER TABLE memberships DROP COLUMN IF EXISTS expiry_notified_at`,
+					`ALTER TABLE memberships DROP COLUMN IF EXISTS expires_at`,
+				)
+			},
+		},
+		{
+			ID: "00127-CreateOIDCConfigs",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE IF NOT EXISTS oidc_configs (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						issuer TEXT NOT NULL,
+						client_id TEXT NOT NULL,
+						client_secret TEXT NOT NULL,
+						groups_claim TEXT,
+						default_role_id INTEGER REFERENCES roles(id) ON DELETE SET NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_oidc_configs_realm_id ON oidc_configs(realm_id)`,
+					`CREATE TABLE IF NOT EXISTS oidc_group_roles (
+						id BIGSERIAL PRIMARY KEY,
+						oidc_config_id INTEGER NOT NULL REFERENCES oidc_configs(id) ON DELETE CASCADE,
+						group_name TEXT NOT NULL,
+						role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_oidc_group_roles_oidc_config_id ON oidc_group_roles(oidc_config_id)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS oidc_group_roles`,
+					`DROP TABLE IF EXISTS oidc_configs`,
+				)
+			},
+		},
+		{
+			ID: "00128-CreateSCIMUsers",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE IF NOT EXISTS scim_users (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+						external_id TEXT,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_scim_users_realm_id_user_id ON scim_users(realm_id, user_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_scim_users_external_id ON scim_users(external_id)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS scim_users`,
+				)
+			},
+		},
+		{
+			ID: "00129-CreateMFAFactors",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE TABLE IF NOT EXISTS mfa_factors (
+						id BIGSERIAL PRIMARY KEY,
+						user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+						type TEXT NOT NULL,
+						name TEXT NOT NULL,
+						secret TEXT,
+						last_step BIGINT NOT NULL DEFAULT 0,
+						credential_id BYTEA,
+						public_key BYTEA,
+						sign_count BIGINT NOT NULL DEFAULT 0,
+						last_used_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_mfa_factors_user_id ON mfa_factors(user_id)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_mfa_factors_credential_id ON mfa_factors(credential_id) WHERE credential_id IS NOT NULL`,
+					`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+						id BIGSERIAL PRIMARY KEY,
+						user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+						code_hash TEXT NOT NULL,
+						used_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id_code_hash ON mfa_recovery_codes(user_id, code_hash)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS mfa_recovery_codes`,
+					`DROP TABLE IF EXISTS mfa_factors`,
+				)
+			},
+		},
+		{
+			ID: "00130-AddUserPasswords",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT`,
+					`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+					`ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMP WITH TIME ZONE`,
+					`CREATE TABLE IF NOT EXISTS user_tokens (
+						id BIGSERIAL PRIMARY KEY,
+						user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+						purpose TEXT NOT NULL,
+						token_hash TEXT NOT NULL,
+						expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						used_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_user_tokens_token_hash ON user_tokens(token_hash)`,
+					`CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_user_tokens_expires_at ON user_tokens(expires_at)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP TABLE IF EXISTS user_tokens`,
+					`ALTER TABLE users DROP COLUMN IF EXISTS sessions_revoked_at`,
+					`ALTER TABLE users DROP COLUMN IF EXISTS locked_until`,
+					`ALTER TABLE users DROP COLUMN IF EXISTS failed_login_attempts`,
+					`ALTER TABLE users DROP COLUMN IF EXISTS email_verified`,
+					`ALTER TABLE users DROP COLUMN IF EXISTS password_hash`,
+				)
+			},
+		},
+		{
+			ID: "00131-AddAuthorizedAppPermissions",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS permissions BIGINT NOT NULL DEFAULT 0`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS permissions`,
+				)
+			},
+		},
+		{
+			ID: "00132-AddAuthorizedAppRestrictions",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS scopes TEXT[]`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS allowed_test_types SMALLINT NOT NULL DEFAULT 0`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS allowed_cidrs VARCHAR(50)[]`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS scopes`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS allowed_test_types`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS allowed_cidrs`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS expires_at`,
+				)
+			},
+		},
+		{
+			ID: "00133-AddAuthorizedAppPreviousAPIKey",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key VARCHAR(512)`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key_preview VARCHAR(32)`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key_expires_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key_last_used_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP WITH TIME ZONE`,
+					`CREATE INDEX IF NOT EXISTS idx_authorized_apps_previous_api_key ON authorized_apps (previous_api_key)`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_authorized_apps_previous_api_key`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key_preview`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key_expires_at`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key_last_used_at`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS rotated_at`,
+				)
+			},
+		},
+		{
+			ID: "00134-AddAuthorizedAppLimits",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS requests_per_minute INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS daily_issue_limit INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE authorized_app_stats ADD COLUMN IF NOT EXISTS requests_rate_limited INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE authorized_app_stats ADD COLUMN IF NOT EXISTS codes_quota_exceeded INTEGER NOT NULL DEFAULT 0`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS requests_per_minute`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS daily_issue_limit`,
+					`ALTER TABLE authorized_app_stats DROP COLUMN IF EXISTS requests_rate_limited`,
+					`ALTER TABLE authorized_app_stats DROP COLUMN IF EXISTS codes_quota_exceeded`,
+				)
+			},
+		},
+		{
+			ID: "00135-AddRealmCheckDigits",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						ADD COLUMN IF NOT EXISTS use_check_digits BOOLEAN NOT NULL DEFAULT false,
+						ADD COLUMN IF NOT EXISTS check_digits_enabled_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS codes_typo INTEGER DEFAULT 0`,
+					`ALTER TABLE realm_stats ALTER COLUMN codes_typo SET NOT NULL`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS codes_typo`,
+					`ALTER TABLE realms
+						DROP COLUMN IF EXISTS use_check_digits,
+						DROP COLUMN IF EXISTS check_digits_enabled_at`,
+				)
+			},
+		},
+		{
+			ID: "00136-AddRealmCodeAlphabet",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						ADD COLUMN IF NOT EXISTS long_code_alphabet TEXT NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS code_group_size SMALLINT NOT NULL DEFAULT 0`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						DROP COLUMN IF EXISTS long_code_alphabet,
+						DROP COLUMN IF EXISTS code_group_size`,
+				)
+			},
+		},
+		{
+			ID: "00137-AddRealmLetterTemplates",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						ADD COLUMN IF NOT EXISTS letter_template TEXT NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS letter_localized_templates HSTORE`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`ALTER TABLE realms
+						DROP COLUMN IF EXISTS letter_template,
+						DROP COLUMN IF EXISTS letter_localized_templates`,
+				)
+			},
+		},
+		{
+			ID: "00138-AddVerificationCodeSearchIndexes",
+			Migrate: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`CREATE INDEX IF NOT EXISTS idx_vercode_realm_created_at ON verification_codes(realm_id, created_at)`,
+					`CREATE INDEX IF NOT EXISTS idx_vercode_realm_external_id ON verification_codes(realm_id, issuing_external_id) WHERE issuing_external_id != ''`,
+				)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return multiExec(tx,
+					`DROP INDEX IF EXISTS idx_vercode_realm_created_at`,
+					`DROP INDEX IF EXISTS idx_vercode_realm_external_id`,
+				)
+			},
+		},
 	}
 }
 
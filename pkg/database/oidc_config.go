@@ -0,0 +1,480 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrNoSSOAccess is the error returned when a user signs in with the realm's
+// identity provider, but is not a member of the realm and none of their groups
+// grant membership.
+var ErrNoSSOAccess = errors.New("identity provider groups do not grant access to this realm")
+
+// ErrSSOUserRestricted is the error returned when a user who is a system admin,
+// or a member of another realm, signs in with a realm's identity provider. The
+// identity provider is only trusted to vouch for users of its own realm, so
+// these users must sign in with their password.
+var ErrSSOUserRestricted = errors.New("user must sign in with their password")
+
+// OIDCConfig is a realm's OpenID Connect identity provider. Users sign in to the
+// realm with the identity provider, and users who are not yet members are
+// added to the realm with a role based on their identity provider groups.
+type OIDCConfig struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// RealmID is the realm which signs in with the identity provider. Each realm
+	// has at most one identity provider.
+	RealmID uint
+
+	// Issuer is the identity provider's issuer URL.
+	Issuer string `gorm:"column:issuer; type:text;"`
+
+	// ClientID is the ID of the application registered with the identity
+	// provider.
+	ClientID string `gorm:"column:client_id; type:text;"`
+
+	// ClientSecret is the application's secret. It is encrypted/decrypted
+	// automatically by callbacks. The cache fields exist as optimizations.
+	ClientSecret                string `gorm:"column:client_secret; type:text;" json:"-"` // ignored by zap's JSON formatter
+	ClientSecretPlaintextCache  string `gorm:"-"`
+	ClientSecretCiphertextCache string `gorm:"-"`
+
+	// GroupsClaim is the ID token claim which lists the user's groups. If
+	// blank, the "groups" claim is used.
+	GroupsClaim string `gorm:"column:groups_claim; type:text;"`
+
+	// DefaultRoleID is the role given to new members whose groups do not match
+	// any group role. If nil, those users are not added to the realm.
+	DefaultRoleID *uint `gorm:"column:default_role_id; type:integer;"`
+
+	// AllowInsecureIssuer allows a plain HTTP issuer on localhost or a loopback
+	// address. It is only set in dev mode, for local identity providers.
+	AllowInsecureIssuer bool `gorm:"-"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OIDCGroupRole maps an identity provider group to the realm role its members
+// receive.
+type OIDCGroupRole struct {
+	// ID is the auto-incrementing primary key. Group roles are matched in ID
+	// order, so the first matching group determines the user's role.
+	ID uint
+
+	// OIDCConfigID is the identity provider which reports the group.
+	OIDCConfigID uint `gorm:"column:oidc_config_id; type:integer;"`
+
+	// Group is the group name or ID, as it appears in the groups claim.
+	Group string `gorm:"column:group_name; type:text;"`
+
+	// RoleID is the realm role given to members of the group.
+	RoleID uint `gorm:"column:role_id; type:integer;"`
+	Role   *Role
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (c *OIDCConfig) BeforeSave(tx *gorm.DB) error {
+	if c.RealmID == 0 {
+		c.AddError("realmID", "cannot be blank")
+	}
+
+	c.Issuer = strings.TrimSuffix(project.TrimSpace(c.Issuer), "/")
+	if c.Issuer == "" {
+		c.AddError("issuer", "cannot be blank")
+	} else if u, err := url.Parse(c.Issuer); err != nil || u.Host == "" {
+		c.AddError("issuer", "is not a valid URL")
+	} else if u.Scheme != "https" && !(c.AllowInsecureIssuer && u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		// Plain HTTP is only allowed for local development.
+		c.AddError("issuer", "must begin with https://")
+	}
+
+	c.ClientID = project.TrimSpace(c.ClientID)
+	if c.ClientID == "" {
+		c.AddError("clientID", "cannot be blank")
+	}
+
+	c.ClientSecret = project.TrimSpace(c.ClientSecret)
+	if c.ClientSecret == "" {
+		c.AddError("clientSecret", "cannot be blank")
+	}
+
+	c.GroupsClaim = project.TrimSpace(c.GroupsClaim)
+
+	return c.ErrorOrNil()
+}
+
+func (c *OIDCConfig) AuditID() string {
+	return fmt.Sprintf("oidc_configs:%d", c.ID)
+}
+
+func (c *OIDCConfig) AuditDisplay() string {
+	return c.Issuer
+}
+
+// RoleIDForGroups returns the ID of the role for a user in the given groups:
+// the role of the first group role which matches one of the groups or, if none
+// match, the default role. It returns nil if the user should not be given a
+// role.
+func (c *OIDCConfig) RoleIDForGroups(groupRoles []*OIDCGroupRole, groups []string) *uint {
+	member := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		member[g] = struct{}{}
+	}
+
+	for _, gr := range groupRoles {
+		if _, ok := member[gr.Group]; ok {
+			id := gr.RoleID
+			return &id
+		}
+	}
+	return c.DefaultRoleID
+}
+
+// FindOIDCConfig finds the realm's identity provider. If the realm does not
+// have one, an error is returned that satisfies IsNotFound.
+func (r *Realm) FindOIDCConfig(db *Database) (*OIDCConfig, error) {
+	var config OIDCConfig
+	if err := db.db.
+		Model(&OIDCConfig{}).
+		Where("realm_id = ?", r.ID).
+		First(&config).
+		Error; err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ListOIDCGroupRoles lists the group roles of the identity provider, in the
+// order in which they are matched.
+func (c *OIDCConfig) ListOIDCGroupRoles(db *Database) ([]*OIDCGroupRole, error) {
+	var groupRoles []*OIDCGroupRole
+	if err := db.db.
+		Model(&OIDCGroupRole{}).
+		Preload("Role").
+		Where("oidc_config_id = ?", c.ID).
+		Order("id ASC").
+		Find(&groupRoles).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return groupRoles, nil
+		}
+		return nil, err
+	}
+	return groupRoles, nil
+}
+
+// SaveOIDCConfig creates or updates the realm's identity provider, replacing
+// its group roles with the given group roles.
+func (db *Database) SaveOIDCConfig(c *OIDCConfig, groupRoles []*OIDCGroupRole, actor Auditable) error {
+	if c == nil {
+		return fmt.Errorf("provided oidc config is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing OIDCConfig
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&OIDCConfig{}).
+			Where("id = ?", c.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing oidc config: %w", err)
+		}
+
+		var existingGroupRoles []*OIDCGroupRole
+		if existing.ID != 0 {
+			if err := tx.
+				Model(&OIDCGroupRole{}).
+				Preload("Role").
+				Where("oidc_config_id = ?", existing.ID).
+				Order("id ASC").
+				Find(&existingGroupRoles).
+				Error; err != nil && !IsNotFound(err) {
+				return fmt.Errorf("failed to get existing group roles: %w", err)
+			}
+		}
+
+		// Validate the roles belong to the realm.
+		roleIDs := make([]uint, 0, len(groupRoles)+1)
+		for _, gr := range groupRoles {
+			roleIDs = append(roleIDs, gr.RoleID)
+		}
+		if c.DefaultRoleID != nil {
+			roleIDs = append(roleIDs, *c.DefaultRoleID)
+		}
+		if len(roleIDs) > 0 {
+			var count int
+			if err := tx.
+				Model(&Role{}).
+				Where("id IN (?) AND realm_id = ?", uniqueUints(roleIDs), c.RealmID).
+				Count(&count).
+				Error; err != nil {
+				return fmt.Errorf("failed to check roles: %w", err)
+			}
+			if count != len(uniqueUints(roleIDs)) {
+				c.AddError("groupRoles", "must only use roles in this realm")
+				return ErrValidationFailed
+			}
+		}
+
+		if err := tx.Save(c).Error; err != nil {
+			if IsUniqueViolation(err, "uix_oidc_configs_realm_id") {
+				c.AddError("realmID", "already has an identity provider")
+				return ErrValidationFailed
+			}
+			return err
+		}
+
+		if err := tx.
+			Where("oidc_config_id = ?", c.ID).
+			Delete(&OIDCGroupRole{}).
+			Error; err != nil {
+			return fmt.Errorf("failed to delete group roles: %w", err)
+		}
+		for _, gr := range groupRoles {
+			gr.ID = 0
+			gr.OIDCConfigID = c.ID
+			if err := tx.Omit("Role").Create(gr).Error; err != nil {
+				return fmt.Errorf("failed to save group role: %w", err)
+			}
+		}
+
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "created single sign-on", c, c.RealmID)
+			audit.Diff = stringDiff("", c.Issuer)
+			audits = append(audits, audit)
+		} else {
+			if existing.Issuer != c.Issuer {
+				audit := BuildAuditEntry(actor, "updated single sign-on issuer", c, c.RealmID)
+				audit.Diff = stringDiff(existing.Issuer, c.Issuer)
+				audits = append(audits, audit)
+			}
+
+			if existing.ClientID != c.ClientID {
+				audit := BuildAuditEntry(actor, "updated single sign-on client id", c, c.RealmID)
+				audit.Diff = stringDiff(existing.ClientID, c.ClientID)
+				audits = append(audits, audit)
+			}
+
+			if existing.ClientSecret != c.ClientSecret {
+				audit := BuildAuditEntry(actor, "updated single sign-on client secret", c, c.RealmID)
+				audits = append(audits, audit)
+			}
+
+			if existing.GroupsClaim != c.GroupsClaim {
+				audit := BuildAuditEntry(actor, "updated single sign-on groups claim", c, c.RealmID)
+				audit.Diff = stringDiff(existing.GroupsClaim, c.GroupsClaim)
+				audits = append(audits, audit)
+			}
+
+			if then, now := uintValue(existing.DefaultRoleID), uintValue(c.DefaultRoleID); then != now {
+				audit := BuildAuditEntry(actor, "updated single sign-on default role", c, c.RealmID)
+				audit.Diff = uintDiff(then, now)
+				audits = append(audits, audit)
+			}
+		}
+
+		thenGroups := make([]string, 0, len(existingGroupRoles))
+		for _, gr := range existingGroupRoles {
+			thenGroups = append(thenGroups, fmt.Sprintf("%s=%d", gr.Group, gr.RoleID))
+		}
+		nowGroups := make([]string, 0, len(groupRoles))
+		for _, gr := range groupRoles {
+			nowGroups = append(nowGroups, fmt.Sprintf("%s=%d", gr.Group, gr.RoleID))
+		}
+		if strings.Join(thenGroups, ",") != strings.Join(nowGroups, ",") {
+			audit := BuildAuditEntry(actor, "updated single sign-on group roles", c, c.RealmID)
+			audit.Diff = stringSliceDiff(thenGroups, nowGroups)
+			audits = append(audits, audit)
+		}
+
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteOIDCConfig deletes the realm's identity provider and its group roles.
+// Existing members are not removed from the realm.
+func (db *Database) DeleteOIDCConfig(c *OIDCConfig, actor Auditable) error {
+	if c == nil {
+		return fmt.Errorf("provided oidc config is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("oidc_config_id = ?", c.ID).
+			Delete(&OIDCGroupRole{}).
+			Error; err != nil {
+			return fmt.Errorf("failed to delete group roles: %w", err)
+		}
+
+		if err := tx.Delete(c).Error; err != nil {
+			return fmt.Errorf("failed to delete oidc config: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "deleted single sign-on", c, c.RealmID)
+		audit.Diff = stringDiff(c.Issuer, "")
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// ProvisionOIDCUser finds or creates the user who signed in with the realm's
+// identity provider, and ensures they are a member of the realm:
+//
+//   - Users who are not members are added with the role for their groups. If
+//     their groups do not map to a role, ErrNoSSOAccess is returned.
+//   - Members whose role was assigned from identity provider groups are moved
+//     to the role for their current groups, so group changes at the identity
+//     provider are reflected in the realm.
+//   - Other members, such as those with custom permissions, are unchanged.
+//
+// Expired memberships are not renewed; ErrNoSSOAccess is returned instead.
+// System admins and members of other realms cannot sign in with the identity
+// provider; ErrSSOUserRestricted is returned instead.
+func (r *Realm) ProvisionOIDCUser(db *Database, c *OIDCConfig, email, name string, groups []string) (*User, error) {
+	groupRoles, err := c.ListOIDCGroupRoles(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group roles: %w", err)
+	}
+	roleID := c.RoleIDForGroups(groupRoles, groups)
+
+	user, err := db.FindUserByEmail(email)
+	if err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if user != nil {
+		if user.SystemAdmin {
+			return nil, ErrSSOUserRestricted
+		}
+
+		other, err := user.HasOtherMemberships(db, r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count memberships: %w", err)
+		}
+		if other {
+			return nil, ErrSSOUserRestricted
+		}
+	}
+
+	membership := new(Membership)
+	if user != nil {
+		membership, err = user.FindMembership(db, r.ID)
+		if err != nil {
+			if !IsNotFound(err) {
+				return nil, fmt.Errorf("failed to find membership: %w", err)
+			}
+			membership = new(Membership)
+		}
+	}
+
+	if membership.IsExpired() {
+		return nil, ErrNoSSOAccess
+	}
+
+	// Existing member.
+	if membership.UserID != 0 {
+		if roleID == nil || !membership.HasRole() || *membership.RoleID == *roleID {
+			return user, nil
+		}
+
+		managed := uintValue(c.DefaultRoleID) == *membership.RoleID
+		for _, gr := range groupRoles {
+			if gr.RoleID == *membership.RoleID {
+				managed = true
+			}
+		}
+		if !managed {
+			return user, nil
+		}
+	}
+
+	if roleID == nil {
+		return nil, ErrNoSSOAccess
+	}
+
+	role, err := r.FindRole(db, *roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find role: %w", err)
+	}
+
+	if user == nil {
+		if name = project.TrimSpace(name); name == "" {
+			name = email
+		}
+		user = &User{Email: email, Name: name}
+		if err := db.SaveUser(user, System); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	if err := user.AddToRealmWithRole(db, r, role, System); err != nil {
+		return nil, fmt.Errorf("failed to add user to realm: %w", err)
+	}
+	return user, nil
+}
+
+// isLoopbackHost returns true if the host is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// uniqueUints returns the unique values, in their original order.
+func uniqueUints(l []uint) []uint {
+	seen := make(map[uint]struct{}, len(l))
+	result := make([]uint, 0, len(l))
+	for _, v := range l {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func TestOIDCConfig_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		config  *OIDCConfig
+		errKeys []string
+	}{
+		{
+			name: "valid",
+			config: &OIDCConfig{
+				RealmID:      1,
+				Issuer:       "https://login.example.com/",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+		},
+		{
+			name:    "missing_fields",
+			config:  &OIDCConfig{Issuer: "  "},
+			errKeys: []string{"realmID", "issuer", "clientID", "clientSecret"},
+		},
+		{
+			name: "insecure_issuer",
+			config: &OIDCConfig{
+				RealmID:      1,
+				Issuer:       "http://login.example.com",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+			errKeys: []string{"issuer"},
+		},
+		{
+			name: "loopback_issuer",
+			config: &OIDCConfig{
+				RealmID:      1,
+				Issuer:       "http://127.0.0.1:8080",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+			errKeys: []string{"issuer"},
+		},
+		{
+			name: "localhost_issuer",
+			config: &OIDCConfig{
+				RealmID:      1,
+				Issuer:       "http://localhost:8080",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+			errKeys: []string{"issuer"},
+		},
+		{
+			name: "loopback_issuer_allowed",
+			config: &OIDCConfig{
+				RealmID:             1,
+				Issuer:              "http://127.0.0.1:8080",
+				ClientID:            "client",
+				ClientSecret:        "secret",
+				AllowInsecureIssuer: true,
+			},
+		},
+		{
+			name: "insecure_issuer_allowed",
+			config: &OIDCConfig{
+				RealmID:             1,
+				Issuer:              "http://login.example.com",
+				ClientID:            "client",
+				ClientSecret:        "secret",
+				AllowInsecureIssuer: true,
+			},
+			errKeys: []string{"issuer"},
+		},
+		{
+			name: "invalid_issuer",
+			config: &OIDCConfig{
+				RealmID:      1,
+				Issuer:       "login",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+			errKeys: []string{"issuer"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.config.BeforeSave(nil)
+			for _, k := range tc.errKeys {
+				if len(tc.config.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+			if len(tc.errKeys) == 0 {
+				if msgs := tc.config.ErrorMessages(); len(msgs) > 0 {
+					t.Errorf("expected no errors, got %q", msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCConfig_RoleIDForGroups(t *testing.T) {
+	t.Parallel()
+
+	defaultRoleID := uint(9)
+	groupRoles := []*OIDCGroupRole{
+		{Group: "admins", RoleID: 1},
+		{Group: "tracers", RoleID: 2},
+	}
+
+	cases := []struct {
+		name          string
+		defaultRoleID *uint
+		groups        []string
+		exp           uint
+	}{
+		{
+			name:   "first_match",
+			groups: []string{"tracers", "admins"},
+			exp:    1,
+		},
+		{
+			name:   "match",
+			groups: []string{"other", "tracers"},
+			exp:    2,
+		},
+		{
+			name:          "default",
+			defaultRoleID: &defaultRoleID,
+			groups:        []string{"other"},
+			exp:           9,
+		},
+		{
+			name:   "none",
+			groups: []string{"other"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &OIDCConfig{DefaultRoleID: tc.defaultRoleID}
+			if got, want := uintValue(c.RoleIDForGroups(groupRoles, tc.groups)), tc.exp; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRealm_ProvisionOIDCUser(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("Test Realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &Role{RealmID: realm.ID, Name: "Admin", Permissions: rbac.LegacyRealmAdmin}
+	if err := db.SaveRole(admin, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	tracer := &Role{RealmID: realm.ID, Name: "Tracer", Permissions: rbac.CodeIssue | rbac.CodeRead}
+	if err := db.SaveRole(tracer, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &OIDCConfig{
+		RealmID:      realm.ID,
+		Issuer:       "https://login.example.com",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}
+	if err := db.SaveOIDCConfig(config, []*OIDCGroupRole{
+		{Group: "admins", RoleID: admin.ID},
+		{Group: "tracers", RoleID: tracer.ID},
+	}, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Users outside the mapped groups are not added.
+	if _, err := realm.ProvisionOIDCUser(db, config, "stranger@example.com", "Stranger", []string{"other"}); !errors.Is(err, ErrNoSSOAccess) {
+		t.Errorf("expected %v, got %v", ErrNoSSOAccess, err)
+	}
+	if _, err := db.FindUserByEmail("stranger@example.com"); !IsNotFound(err) {
+		t.Errorf("expected user to not exist, got %v", err)
+	}
+
+	// New users are added with their group's role.
+	user, err := realm.ProvisionOIDCUser(db, config, "tracer@example.com", "Tracer", []string{"tracers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	membership, err := user.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uintValue(membership.RoleID), tracer.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Group changes move the user to the new role.
+	if _, err := realm.ProvisionOIDCUser(db, config, "tracer@example.com", "Tracer", []string{"admins"}); err != nil {
+		t.Fatal(err)
+	}
+	membership, err = user.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uintValue(membership.RoleID), admin.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Memberships with custom permissions are unchanged.
+	if err := user.AddToRealm(db, realm, rbac.CodeIssue, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.ProvisionOIDCUser(db, config, "tracer@example.com", "Tracer", []string{"admins"}); err != nil {
+		t.Fatal(err)
+	}
+	membership, err = user.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.HasRole() {
+		t.Errorf("expected membership to have no role")
+	}
+	if got, want := membership.Permissions, rbac.CodeIssue; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	// Members of other realms must sign in with their password.
+	otherRealm := NewRealmWithDefaults("Other Realm")
+	if err := db.SaveRealm(otherRealm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	multi := &User{Email: "multi@example.com", Name: "Multi"}
+	if err := db.SaveUser(multi, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := multi.AddToRealm(db, otherRealm, rbac.CodeIssue, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.ProvisionOIDCUser(db, config, "multi@example.com", "Multi", []string{"tracers"}); !errors.Is(err, ErrSSOUserRestricted) {
+		t.Errorf("expected %v, got %v", ErrSSOUserRestricted, err)
+	}
+
+	// Group roles are replaced on save.
+	if err := db.SaveOIDCConfig(config, nil, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	groupRoles, err := config.ListOIDCGroupRoles(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(groupRoles), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Roles must belong to the realm.
+	otherRole := &Role{RealmID: otherRealm.ID, Name: "Other", Permissions: rbac.CodeIssue}
+	if err := db.SaveRole(otherRole, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveOIDCConfig(config, []*OIDCGroupRole{
+		{Group: "others", RoleID: otherRole.ID},
+	}, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+
+	found, err := realm.FindOIDCConfig(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found.ClientSecret, "secret"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if err := db.DeleteOIDCConfig(found, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.FindOIDCConfig(db); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package database
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"math"
@@ -28,10 +29,12 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/checkdigit"
 	"github.com/google/exposure-notifications-verification-server/pkg/digest"
 	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
@@ -57,7 +60,13 @@ const (
 	TestTypeUserReport
 )
 
+// Display returns the comma-separated names of the test types.
 func (t TestType) Display() string {
+	return strings.Join(t.Names(), ", ")
+}
+
+// Names returns the names of the test types.
+func (t TestType) Names() []string {
 	var types []string
 
 	if t&TestTypeConfirmed != 0 {
@@ -76,7 +85,7 @@ func (t TestType) Display() string {
 		types = append(types, "user-report")
 	}
 
-	return strings.Join(types, ", ")
+	return types
 }
 
 // AuthRequirement represents authentication requirements for the realm
@@ -139,6 +148,17 @@ const (
 	UserReportDefaultText     = "Your requested Exposure Notifications code: [code] expires in [expires] minutes. If you did not request this code, please ignore this message."
 	UserReportDefaultENXText  = "Your requested Exposure Notifications link: [enslink] expires in [expires] minutes. If you did not request this code, please ignore this message."
 
+	DefaultEmailCodeTemplate    = "Your [realmname] Exposure Notifications verification code is: [longcode]\n\nThis code expires in [longexpires] hours."
+	DefaultENXEmailCodeTemplate = "Your [realmname] Exposure Notifications verification link is: [enslink]\n\nOpen this link on the mobile device where Exposure Notifications is enabled. The link expires in [longexpires] hours."
+
+	DefaultLetterTemplate    = "Your [realmname] Exposure Notifications verification code is below. Enter this code in the Exposure Notifications settings on your mobile phone.\n\nThe code expires on [expiresat]."
+	DefaultENXLetterTemplate = "Your [realmname] Exposure Notifications verification code is below. Scan the QR code with the camera on the mobile phone where Exposure Notifications is enabled, or enter the code in the Exposure Notifications settings.\n\nThe code expires on [expiresat]."
+
+	// LetterExpiresAt is replaced with the date and time the code in a printable
+	// letter expires.
+	LetterExpiresAt         = "[expiresat]"
+	LetterTemplateMaxLength = 2000
+
 	EmailInviteLink        = "[invitelink]"
 	EmailPasswordResetLink = "[passwordresetlink]"
 	EmailVerifyLink        = "[verifylink]"
@@ -201,6 +221,23 @@ type Realm struct {
 	LongCodeLength   uint            `gorm:"type:smallint; not null; default: 16;"`
 	LongCodeDuration DurationSeconds `gorm:"type:bigint; not null; default: 86400;"` // default 24h
 
+	// LongCodeAlphabet is the set of characters from which long codes are
+	// generated. If empty, DefaultLongCodeAlphabet is used.
+	LongCodeAlphabet string `gorm:"column:long_code_alphabet; type:text; not null; default:'';"`
+
+	// CodeGroupSize, if non-zero, splits codes into hyphen separated groups of
+	// this many characters when they are sent or displayed. Separators are
+	// removed when the code is verified.
+	CodeGroupSize uint `gorm:"column:code_group_size; type:smallint; not null; default:0;"`
+
+	// UseCheckDigits makes the last character of newly issued codes a check
+	// digit, so that typos can be rejected before the code is looked up.
+	// CheckDigitsEnabledAt is when check digits were last enabled or the long
+	// code alphabet last changed; codes issued before then may not have a
+	// matching check digit and may not have expired yet.
+	UseCheckDigits       bool       `gorm:"column:use_check_digits; type:boolean; not null; default:false;"`
+	CheckDigitsEnabledAt *time.Time `gorm:"column:check_digits_enabled_at; type:timestamp with time zone;"`
+
 	// ShortCodeMaxMinutes can only be set by system admins and allows for a
 	// realm to have a higher max short code duration
 	ShortCodeMaxMinutes uint `gorm:"column:short_code_max_minutes; type:smallint; not null; default: 60;"`
@@ -212,6 +249,14 @@ type Realm struct {
 	SMSTextTemplate           string          `gorm:"type:text; not null; default: 'This is your Exposure Notifications Verification code: [longcode] Expires in [longexpires] hours';"`
 	SMSTextAlternateTemplates postgres.Hstore `gorm:"column:alternate_sms_templates; type:hstore;"`
 
+	// SMSReminderHours is the number of hours before a code's long expiration at
+	// which a reminder SMS is sent, if the code has not yet been claimed. Zero
+	// disables reminders. Reminders are delivered by the SMS outbox.
+	SMSReminderHours uint `gorm:"column:sms_reminder_hours; type:smallint; not null; default:0;"`
+	// SMSReminderTemplateLabel is the label of the alternate SMS template that is
+	// used for reminders.
+	SMSReminderTemplateLabel string `gorm:"column:sms_reminder_template_label; type:text; not null; default:'';"`
+
 	// SMSCountry is an optional field to hint the default phone picker country
 	// code.
 	SMSCountry    string  `gorm:"-"`
@@ -253,6 +298,16 @@ type Realm struct {
 	// EmailVerifyTemplate is the template used for email verification.
 	EmailVerifyTemplate string `gorm:"type:text;"`
 
+	// EmailCodeTemplate is the template used when sending verification codes by
+	// email. If empty, a default template is used.
+	EmailCodeTemplate string `gorm:"column:email_code_template; type:text;"`
+
+	// LetterTemplate is the template used for printable patient code letters. If
+	// empty, a default template is used. LetterLocalizedTemplates are
+	// translations of the letter template, keyed by locale (e.g. "es").
+	LetterTemplate           string          `gorm:"column:letter_template; type:text;"`
+	LetterLocalizedTemplates postgres.Hstore `gorm:"column:letter_localized_templates; type:hstore;"`
+
 	// CanUseSystemEmailConfig is configured by system administrators to share the
 	// system email config with this realm. Note that the system email config could be
 	// empty and a local email config is preferred over the system value.
@@ -543,6 +598,10 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 	if r.CodeLength < 6 {
 		r.AddError("codeLength", "must be at least 6")
 	}
+	if r.UseCheckDigits && r.CodeLength < MinCodeLength+1 {
+		r.AddError("codeLength", fmt.Sprintf("must be at least %d when check digits are enabled", MinCodeLength+1))
+		r.AddError("useCheckDigits", fmt.Sprintf("requires a code length of at least %d", MinCodeLength+1))
+	}
 
 	// Validation of the max code duration is dependent on overrides.
 	realmMaxCodeDuration := time.Minute * time.Duration(r.ShortCodeMaxMinutes)
@@ -550,8 +609,22 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		r.AddError("codeDuration", fmt.Sprintf("must be no more than %v minutes", r.ShortCodeMaxMinutes))
 	}
 
+	if r.LongCodeAlphabet != "" {
+		if err := validateCodeAlphabet(r.LongCodeAlphabet); err != nil {
+			r.AddError("longCodeAlphabet", err.Error())
+		}
+	}
+
 	if r.LongCodeLength < 12 {
 		r.AddError("longCodeLength", "must be at least 12")
+	} else if bits := CodeEntropyBits(r.LongCodeLength, r.GetLongCodeAlphabet(), r.UseCheckDigits); bits < MinLongCodeEntropyBits {
+		msg := fmt.Sprintf("is too weak, codes would have %.1f bits of entropy but at least %d are required", bits, MinLongCodeEntropyBits)
+		r.AddError("longCodeLength", msg)
+		r.AddError("longCodeAlphabet", msg)
+	}
+
+	if r.CodeGroupSize != 0 && (r.CodeGroupSize < 2 || r.CodeGroupSize > 8) {
+		r.AddError("codeGroupSize", "must be between 2 and 8")
 	}
 	if r.LongCodeDuration.Duration > maxLongCodeDuration {
 		r.AddError("longCodeDuration", "must be no more than 24 hours")
@@ -600,6 +673,10 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		}
 	}
 
+	if r.SMSReminderHours > 0 {
+		r.validateSMSReminder()
+	}
+
 	if r.AllowsUserReport() {
 		if r.SMSCountry == "" {
 			r.AddError("smsCountry", "A default SMS Country must be set when user report is enabled")
@@ -628,6 +705,24 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		}
 	}
 
+	if r.EmailCodeTemplate != "" {
+		r.validateEmailCodeTemplate(r.EmailCodeTemplate)
+	}
+
+	if r.LetterTemplate != "" {
+		r.validateLetterTemplate("letterTemplate", r.LetterTemplate)
+	}
+	for locale, t := range r.LetterLocalizedTemplates {
+		if !letterLocaleRegexp.MatchString(locale) {
+			r.AddError("letterLocalizedTemplates", fmt.Sprintf("%q is not a valid locale", locale))
+		}
+		if t == nil || *t == "" {
+			r.AddError("letterLocalizedTemplates", fmt.Sprintf("no template for locale %s", locale))
+			continue
+		}
+		r.validateLetterTemplate("letterLocalizedTemplates", *t)
+	}
+
 	r.CertificateIssuer = project.TrimSpaceAndNonPrintable(r.CertificateIssuer)
 	r.CertificateAudience = project.TrimSpaceAndNonPrintable(r.CertificateAudience)
 	if r.UseRealmCertificateKey {
@@ -650,6 +745,34 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 
 // validateSMSTemplate is a helper method to validate a single SMSTemplate.
 // Errors are returned by appending them to the realm's Errorable fields.
+// validateSMSReminder validates the SMS reminder settings. The reminder is sent
+// after the short code has expired, so the template must contain the long code.
+func (r *Realm) validateSMSReminder() {
+	if longHours := uint(r.LongCodeDuration.Duration.Hours()); r.SMSReminderHours >= longHours {
+		r.AddError("smsReminderHours", fmt.Sprintf("must be less than the long code duration (%d hours)", longHours))
+	}
+
+	label := r.SMSReminderTemplateLabel
+	switch label {
+	case "":
+		r.AddError("smsReminderTemplateLabel", "is required when reminders are enabled")
+		return
+	case DefaultTemplateLabel, UserReportTemplateLabel:
+		r.AddError("smsReminderTemplateLabel", fmt.Sprintf("cannot be %q", label))
+		return
+	}
+
+	t, ok := r.SMSTextAlternateTemplates[label]
+	if !ok || t == nil {
+		r.AddError("smsReminderTemplateLabel", fmt.Sprintf("no template with label %q", label))
+		return
+	}
+
+	if !r.EnableENExpress && !strings.Contains(*t, SMSLongCode) {
+		r.AddError("smsReminderTemplateLabel", fmt.Sprintf("template must contain %q", SMSLongCode))
+	}
+}
+
 func (r *Realm) validateSMSTemplate(label, t string) {
 	if !r.EnableENExpress {
 		// Check that we have exactly one of [code] or [longcode] as template substitutions.
@@ -697,6 +820,66 @@ func (r *Realm) validateSMSTemplate(label, t string) {
 	}
 }
 
+// validateEmailCodeTemplate validates the email code template. Unlike SMS
+// templates, email templates have no length restrictions and may contain both
+// the short and long codes.
+func (r *Realm) validateEmailCodeTemplate(t string) {
+	if !r.EnableENExpress {
+		if !strings.Contains(t, SMSCode) && !strings.Contains(t, SMSLongCode) {
+			r.AddError("emailCodeTemplate", fmt.Sprintf("must contain %q or %q", SMSCode, SMSLongCode))
+		}
+		if strings.Contains(t, SMSENExpressLink) {
+			r.AddError("emailCodeTemplate", fmt.Sprintf("cannot contain %q because Exposure Notifications Express is not enabled", SMSENExpressLink))
+		}
+	} else {
+		if !strings.Contains(t, SMSENExpressLink) {
+			r.AddError("emailCodeTemplate", fmt.Sprintf("must contain %q", SMSENExpressLink))
+		}
+		if strings.Contains(t, SMSRegion) {
+			r.AddError("emailCodeTemplate", fmt.Sprintf("cannot contain %q - this is automatically included in %q", SMSRegion, SMSENExpressLink))
+		}
+	}
+}
+
+// hstoreString renders the hstore as sorted "key: value" lines for diffing.
+func hstoreString(h postgres.Hstore) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		var v string
+		if h[k] != nil {
+			v = *h[k]
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", k, v))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// letterLocaleRegexp matches the locales of localized letter templates, such as
+// "es" or "zh-hant".
+var letterLocaleRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// validateLetterTemplate validates a printable letter template, adding any
+// errors to field. The code is always printed below the text, so the template
+// does not need to contain it.
+func (r *Realm) validateLetterTemplate(field, t string) {
+	if l := len(t); l > LetterTemplateMaxLength {
+		r.AddError(field, fmt.Sprintf("must be %d characters or less, current message is %v characters long", LetterTemplateMaxLength, l))
+	}
+	if !r.EnableENExpress {
+		if strings.Contains(t, SMSENExpressLink) {
+			r.AddError(field, fmt.Sprintf("cannot contain %q because Exposure Notifications Express is not enabled", SMSENExpressLink))
+		}
+	} else if strings.Contains(t, SMSRegion) {
+		r.AddError(field, fmt.Sprintf("cannot contain %q - this is automatically included in %q", SMSRegion, SMSENExpressLink))
+	}
+}
+
 // enxRedirectDomain returns the configured ENX redirect domain for this realm.
 func (r *Realm) enxRedirectDomain() string {
 	if v := r.enxRedirectDomainOverride; v != "" {
@@ -705,6 +888,91 @@ func (r *Realm) enxRedirectDomain() string {
 	return ENXRedirectDomain
 }
 
+// GetLongCodeAlphabet returns the set of characters from which long codes are
+// generated.
+func (r *Realm) GetLongCodeAlphabet() string {
+	if r.LongCodeAlphabet == "" {
+		return DefaultLongCodeAlphabet
+	}
+	return r.LongCodeAlphabet
+}
+
+// FormatCode splits the code into hyphen separated groups of CodeGroupSize
+// characters for display. It returns the code unchanged if grouping is
+// disabled.
+func (r *Realm) FormatCode(code string) string {
+	size := int(r.CodeGroupSize)
+	if size == 0 || len(code) <= size {
+		return code
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(code); i += size {
+		if i > 0 {
+			sb.WriteByte('-')
+		}
+		end := i + size
+		if end > len(code) {
+			end = len(code)
+		}
+		sb.WriteString(code[i:end])
+	}
+	return sb.String()
+}
+
+// NormalizeCode removes group separators and whitespace from a code entered by
+// a user. If the realm's long code alphabet has no uppercase letters, the code
+// is also lowercased. For Crockford's base32, the letters o, i, and l are
+// decoded as the digits they are confused with.
+func (r *Realm) NormalizeCode(code string) string {
+	code = strings.Map(func(c rune) rune {
+		if c == '-' || unicode.IsSpace(c) {
+			return -1
+		}
+		return c
+	}, code)
+
+	alphabet := r.GetLongCodeAlphabet()
+	if strings.ToLower(alphabet) == alphabet {
+		code = strings.ToLower(code)
+	}
+	if alphabet == CrockfordLongCodeAlphabet {
+		code = crockfordReplacer.Replace(code)
+	}
+	return code
+}
+
+// crockfordReplacer maps the letters omitted from Crockford's base32 to the
+// digits they are read as.
+var crockfordReplacer = strings.NewReplacer("o", "0", "i", "1", "l", "1")
+
+// IsCodeTypo returns true if the given code has the length of a code issued
+// with a check digit, but the check digit does not match. It returns false if
+// the realm does not use check digits, or if codes issued before check digits
+// were enabled may still be valid.
+func (r *Realm) IsCodeTypo(code string, now time.Time) bool {
+	if !r.UseCheckDigits || r.CheckDigitsEnabledAt == nil {
+		return false
+	}
+
+	maxAge := r.CodeDuration.Duration
+	if r.LongCodeDuration.Duration > maxAge {
+		maxAge = r.LongCodeDuration.Duration
+	}
+	if now.Before(r.CheckDigitsEnabledAt.Add(maxAge)) {
+		return false
+	}
+
+	switch uint(len(code)) {
+	case r.CodeLength:
+		return !checkdigit.ValidDamm(code)
+	case r.LongCodeLength:
+		return !checkdigit.ValidLuhnModN(code, r.GetLongCodeAlphabet())
+	default:
+		return false
+	}
+}
+
 // GetCodeDurationMinutes is a helper for the HTML rendering to get a round
 // minutes value.
 func (r *Realm) GetCodeDurationMinutes() int {
@@ -755,6 +1023,57 @@ func (r *Realm) FindVerificationCodeByUUID(db *Database, uuidStr string) (*Verif
 	return &vc, nil
 }
 
+// FindVerificationCodeByLongCode finds the verification code with the given
+// UUID in the realm and verifies that longCode is its long code. It returns a
+// not found error if the long code does not match.
+func (r *Realm) FindVerificationCodeByLongCode(db *Database, uuidStr, longCode string) (*VerificationCode, error) {
+	vc, err := r.FindVerificationCodeByUUID(db, uuidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	hmacedCodes, err := db.generateVerificationCodeHMACs(longCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hmac: %w", err)
+	}
+	for _, h := range hmacedCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(vc.LongCode)) == 1 {
+			return vc, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListVerificationCodes returns the realm's verification codes which match the
+// given scopes, most recently issued first. The codes themselves are never
+// returned, only their metadata.
+func (r *Realm) ListVerificationCodes(db *Database, p *pagination.PageParams, scopes ...Scope) ([]*VerificationCode, *pagination.Paginator, error) {
+	var codes []*VerificationCode
+	query := db.db.
+		Model(&VerificationCode{}).
+		Scopes(scopes...).
+		Where("verification_codes.realm_id = ?", r.ID).
+		Order("verification_codes.created_at DESC, verification_codes.id DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &codes, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return codes, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	for _, v := range codes {
+		v.Code = ""
+		v.LongCode = ""
+	}
+	return codes, paginator, nil
+}
+
 // BuildSMSText replaces certain strings with the right values.
 func (r *Realm) BuildSMSText(code, longCode string, enxDomain, templateLabel string) (string, error) {
 	text := r.SMSTextTemplate
@@ -766,23 +1085,126 @@ func (r *Realm) BuildSMSText(code, longCode string, enxDomain, templateLabel str
 		}
 	}
 
+	return r.expandCodeTemplate(text, code, longCode, enxDomain), nil
+}
+
+// SMSRemindersEnabled returns true if the realm sends reminders for unclaimed
+// codes.
+func (r *Realm) SMSRemindersEnabled() bool {
+	return r.SMSReminderHours > 0 && r.SMSReminderTemplateLabel != ""
+}
+
+// SMSReminderTime returns the time at which a reminder should be sent for the
+// verification code.
+func (r *Realm) SMSReminderTime(vc *VerificationCode) time.Time {
+	return vc.LongExpiresAt.Add(-time.Duration(r.SMSReminderHours) * time.Hour)
+}
+
+// BuildSMSReminderText builds the reminder message from the realm's reminder
+// template. The long code expiration is the time remaining when the reminder is
+// sent, not the time from issuance.
+func (r *Realm) BuildSMSReminderText(code, longCode, enxDomain string) (string, error) {
+	t, ok := r.SMSTextAlternateTemplates[r.SMSReminderTemplateLabel]
+	if !ok || t == nil || *t == "" {
+		return "", fmt.Errorf("no template found for label %s", r.SMSReminderTemplateLabel)
+	}
+
+	text := strings.ReplaceAll(*t, SMSLongExpires, fmt.Sprintf("%d", r.SMSReminderHours))
+	return r.expandCodeTemplate(text, code, longCode, enxDomain), nil
+}
+
+// DefaultEmailCodeTemplate returns the correct default email code template for
+// the realm.
+func (r *Realm) DefaultEmailCodeTemplate() string {
+	if r.EnableENExpress {
+		return DefaultENXEmailCodeTemplate
+	}
+	return DefaultEmailCodeTemplate
+}
+
+// BuildEmailCodeText replaces certain strings in the realm's email code
+// template with the right values. If the realm has no email code template, the
+// default template is used.
+func (r *Realm) BuildEmailCodeText(code, longCode, enxDomain string) string {
+	text := r.EmailCodeTemplate
+	if text == "" {
+		text = r.DefaultEmailCodeTemplate()
+	}
+
+	text = r.expandCodeTemplate(text, code, longCode, enxDomain)
+	text = strings.ReplaceAll(text, RealmName, r.Name)
+	return text
+}
+
+// BuildENXLink returns the EN Express link for the given long code. If
+// enxDomain is empty, it returns the ens:// deep link, otherwise it returns the
+// app link on the regional redirect domain. Links always contain the ungrouped
+// long code.
+func (r *Realm) BuildENXLink(longCode, enxDomain string) string {
 	if enxDomain == "" {
-		// preserves legacy behavior.
-		text = strings.ReplaceAll(text, SMSENExpressLink, fmt.Sprintf("ens://v?r=%s&c=%s", SMSRegion, SMSLongCode))
-	} else {
-		text = strings.ReplaceAll(text, SMSENExpressLink,
-			fmt.Sprintf("https://%s.%s/v?c=%s",
-				strings.ToLower(r.RegionCode),
-				enxDomain,
-				SMSLongCode))
+		return fmt.Sprintf("ens://v?r=%s&c=%s", r.RegionCode, longCode)
+	}
+	return fmt.Sprintf("https://%s.%s/v?c=%s",
+		strings.ToLower(r.RegionCode),
+		enxDomain,
+		longCode)
+}
+
+// DefaultLetterTemplate returns the correct default printable letter template
+// for the realm.
+func (r *Realm) DefaultLetterTemplate() string {
+	if r.EnableENExpress {
+		return DefaultENXLetterTemplate
+	}
+	return DefaultLetterTemplate
+}
+
+// LetterTemplateFor returns the printable letter template for the locale. It
+// falls back to the template for the base language (e.g. "es" for "es-MX"),
+// then to the realm's letter template, then to the default template.
+func (r *Realm) LetterTemplateFor(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	for locale != "" {
+		if t, ok := r.LetterLocalizedTemplates[locale]; ok && t != nil && *t != "" {
+			return *t
+		}
+
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
 	}
+
+	if r.LetterTemplate != "" {
+		return r.LetterTemplate
+	}
+	return r.DefaultLetterTemplate()
+}
+
+// BuildLetterText replaces certain strings in the realm's printable letter
+// template for the locale with the right values. Letters only ever contain the
+// long code, so both [code] and [longcode] are replaced with it. The expiration
+// time is formatted in its location.
+func (r *Realm) BuildLetterText(locale, longCode, enxDomain string, expiresAt time.Time) string {
+	text := r.LetterTemplateFor(locale)
+	text = r.expandCodeTemplate(text, longCode, longCode, enxDomain)
+	text = strings.ReplaceAll(text, LetterExpiresAt, expiresAt.Format("2006-01-02 15:04 MST"))
+	text = strings.ReplaceAll(text, RealmName, r.Name)
+	return text
+}
+
+// expandCodeTemplate replaces the code, link, and expiration substitutions in
+// the given template text.
+func (r *Realm) expandCodeTemplate(text, code, longCode, enxDomain string) string {
+	text = strings.ReplaceAll(text, SMSENExpressLink, r.BuildENXLink(longCode, enxDomain))
 	text = strings.ReplaceAll(text, SMSRegion, r.RegionCode)
-	text = strings.ReplaceAll(text, SMSCode, code)
+	text = strings.ReplaceAll(text, SMSCode, r.FormatCode(code))
 	text = strings.ReplaceAll(text, SMSExpires, fmt.Sprintf("%d", r.GetCodeDurationMinutes()))
-	text = strings.ReplaceAll(text, SMSLongCode, longCode)
+	text = strings.ReplaceAll(text, SMSLongCode, r.FormatCode(longCode))
 	text = strings.ReplaceAll(text, SMSLongExpires, fmt.Sprintf("%d", r.GetLongCodeDurationHours()))
 
-	return text, nil
+	return text
 }
 
 // BuildInviteEmail replaces certain strings with the right values for invitations.
@@ -816,7 +1238,7 @@ func (r *Realm) SMSConfig(db *Database) (*SMSConfig, error) {
 	q := db.db.
 		Model(&SMSConfig{}).
 		Order("is_system DESC").
-		Where("realm_id = ?", r.ID)
+		Where("realm_id = ? AND priority = 0", r.ID)
 
 	if r.UseSystemSMSConfig {
 		q = q.Or("is_system IS TRUE")
@@ -833,12 +1255,63 @@ func (r *Realm) SMSConfig(db *Database) (*SMSConfig, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to lookup sms from number: %w", err)
 		}
-		smsConfig.TwilioFromNumber = smsFromNumber.Value
+		smsConfig.SetFromNumber(smsFromNumber.Value)
 	}
 
 	return &smsConfig, nil
 }
 
+// SMSFailoverConfigs returns the failover SMS configurations for this realm,
+// in the order in which they should be tried. It does not include the primary
+// configuration returned by SMSConfig.
+func (r *Realm) SMSFailoverConfigs(db *Database) ([]*SMSConfig, error) {
+	var smsConfigs []*SMSConfig
+	if err := db.db.
+		Model(&SMSConfig{}).
+		Where("realm_id = ? AND priority > 0", r.ID).
+		Where("is_system IS FALSE").
+		Order("priority ASC, id ASC").
+		Find(&smsConfigs).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return smsConfigs, nil
+		}
+		return nil, err
+	}
+	return smsConfigs, nil
+}
+
+// FindSMSFailoverConfig finds the failover SMS configuration with the given ID
+// belonging to this realm.
+func (r *Realm) FindSMSFailoverConfig(db *Database, id interface{}) (*SMSConfig, error) {
+	var smsConfig SMSConfig
+	if err := db.db.
+		Model(&SMSConfig{}).
+		Where("id = ?", id).
+		Where("realm_id = ? AND priority > 0", r.ID).
+		Where("is_system IS FALSE").
+		First(&smsConfig).
+		Error; err != nil {
+		return nil, err
+	}
+	return &smsConfig, nil
+}
+
+// NextSMSFailoverPriority returns the priority to assign to a new failover SMS
+// configuration so that it is tried after all existing configurations.
+func (r *Realm) NextSMSFailoverPriority(db *Database) (uint, error) {
+	var priority uint
+	if err := db.db.
+		Model(&SMSConfig{}).
+		Where("realm_id = ?", r.ID).
+		Select("COALESCE(MAX(priority), 0) + 1").
+		Row().
+		Scan(&priority); err != nil {
+		return 0, err
+	}
+	return priority, nil
+}
+
 // HasSMSConfig returns true if the realm has an SMS config, false otherwise.
 // This does not perform the KMS encryption/decryption, so it's more efficient
 // that loading the full SMS config.
@@ -864,8 +1337,9 @@ func (r *Realm) HasSMSConfig(db *Database) (bool, error) {
 }
 
 // SMSProvider returns the SMS provider for the realm. If no sms configuration
-// exists, it returns nil. If any errors occur creating the provider, they are
-// returned.
+// exists, it returns nil. If the realm has failover configurations, the
+// returned provider is an *sms.Failover which tries each configuration in
+// order. If any errors occur creating the provider, they are returned.
 func (r *Realm) SMSProvider(db *Database) (sms.Provider, error) {
 	smsConfig, err := r.SMSConfig(db)
 	if err != nil {
@@ -876,16 +1350,37 @@ func (r *Realm) SMSProvider(db *Database) (sms.Provider, error) {
 	}
 
 	ctx := context.Background()
-	provider, err := sms.ProviderFor(ctx, &sms.Config{
-		ProviderType:     smsConfig.ProviderType,
-		TwilioAccountSid: smsConfig.TwilioAccountSid,
-		TwilioAuthToken:  smsConfig.TwilioAuthToken,
-		TwilioFromNumber: smsConfig.TwilioFromNumber,
-	})
+	provider, err := smsConfig.Provider(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return provider, nil
+
+	failoverConfigs, err := r.SMSFailoverConfigs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup failover sms configs: %w", err)
+	}
+	if len(failoverConfigs) == 0 {
+		return provider, nil
+	}
+
+	targets := make([]*sms.FailoverTarget, 0, len(failoverConfigs)+1)
+	targets = append(targets, &sms.FailoverTarget{
+		Name:     smsConfig.ProviderName(),
+		Provider: provider,
+	})
+	for _, failoverConfig := range failoverConfigs {
+		failoverProvider, err := failoverConfig.Provider(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build failover sms provider %d: %w", failoverConfig.ID, err)
+		}
+
+		targets = append(targets, &sms.FailoverTarget{
+			Name:     failoverConfig.ProviderName(),
+			Provider: failoverProvider,
+		})
+	}
+
+	return sms.NewFailover(targets)
 }
 
 // EmailConfig returns the email configuration for this realm, if one exists. If the
@@ -908,6 +1403,29 @@ func (r *Realm) EmailConfig(db *Database) (*EmailConfig, error) {
 	return &emailConfig, nil
 }
 
+// HasEmailConfig returns true if the realm has an email config, false
+// otherwise. This does not perform the KMS encryption/decryption, so it's more
+// efficient that loading the full email config.
+func (r *Realm) HasEmailConfig(db *Database) (bool, error) {
+	q := db.db.
+		Model(&EmailConfig{}).
+		Select("id").
+		Where("realm_id = ?", r.ID)
+
+	if r.UseSystemEmailConfig {
+		q = q.Or("is_system IS TRUE")
+	}
+
+	var id []uint64
+	if err := q.Pluck("id", &id).Error; err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(id) > 0, nil
+}
+
 // EmailProvider returns the email provider for the realm. If no email configuration
 // exists, it returns nil. If any errors occur creating the provider, they are
 // returned.
@@ -1141,6 +1659,7 @@ func (r *Realm) ListMemberships(db *Database, p *pagination.PageParams, scopes .
 	var memberships []*Membership
 	query := db.db.
 		Preload("Realm").
+		Preload("Role").
 		Preload("User").
 		Model(&Membership{}).
 		Scopes(scopes...).
@@ -1307,6 +1826,15 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 			return fmt.Errorf("failed to get existing realm: %w", err)
 		}
 
+		// Record when check digits were enabled, or when the alphabet they are
+		// computed over changed, so that codes issued before then are not
+		// rejected as typos.
+		if r.UseCheckDigits && (!existing.UseCheckDigits || r.CheckDigitsEnabledAt == nil ||
+			existing.GetLongCodeAlphabet() != r.GetLongCodeAlphabet()) {
+			now := time.Now().UTC()
+			r.CheckDigitsEnabledAt = &now
+		}
+
 		// Save the realm
 		if err := tx.Save(r).Error; err != nil {
 			switch {
@@ -1367,6 +1895,24 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.LongCodeAlphabet != r.LongCodeAlphabet {
+				audit := BuildAuditEntry(actor, "updated long code alphabet", r, r.ID)
+				audit.Diff = stringDiff(existing.GetLongCodeAlphabet(), r.GetLongCodeAlphabet())
+				audits = append(audits, audit)
+			}
+
+			if existing.CodeGroupSize != r.CodeGroupSize {
+				audit := BuildAuditEntry(actor, "updated code group size", r, r.ID)
+				audit.Diff = uintDiff(existing.CodeGroupSize, r.CodeGroupSize)
+				audits = append(audits, audit)
+			}
+
+			if existing.UseCheckDigits != r.UseCheckDigits {
+				audit := BuildAuditEntry(actor, "updated use check digits", r, r.ID)
+				audit.Diff = boolDiff(existing.UseCheckDigits, r.UseCheckDigits)
+				audits = append(audits, audit)
+			}
+
 			if existing.SMSTextTemplate != r.SMSTextTemplate {
 				audit := BuildAuditEntry(actor, "updated SMS template", r, r.ID)
 				audit.Diff = stringDiff(existing.SMSTextTemplate, r.SMSTextTemplate)
@@ -1379,6 +1925,18 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.SMSReminderHours != r.SMSReminderHours {
+				audit := BuildAuditEntry(actor, "updated SMS reminder hours", r, r.ID)
+				audit.Diff = uintDiff(existing.SMSReminderHours, r.SMSReminderHours)
+				audits = append(audits, audit)
+			}
+
+			if existing.SMSReminderTemplateLabel != r.SMSReminderTemplateLabel {
+				audit := BuildAuditEntry(actor, "updated SMS reminder template", r, r.ID)
+				audit.Diff = stringDiff(existing.SMSReminderTemplateLabel, r.SMSReminderTemplateLabel)
+				audits = append(audits, audit)
+			}
+
 			if existing.CanUseSystemSMSConfig != r.CanUseSystemSMSConfig {
 				audit := BuildAuditEntry(actor, "updated ability to use system SMS config", r, r.ID)
 				audit.Diff = boolDiff(existing.CanUseSystemSMSConfig, r.CanUseSystemSMSConfig)
@@ -1415,6 +1973,24 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.EmailCodeTemplate != r.EmailCodeTemplate {
+				audit := BuildAuditEntry(actor, "updated email code template", r, r.ID)
+				audit.Diff = stringDiff(existing.EmailCodeTemplate, r.EmailCodeTemplate)
+				audits = append(audits, audit)
+			}
+
+			if existing.LetterTemplate != r.LetterTemplate {
+				audit := BuildAuditEntry(actor, "updated letter template", r, r.ID)
+				audit.Diff = stringDiff(existing.LetterTemplate, r.LetterTemplate)
+				audits = append(audits, audit)
+			}
+
+			if then, now := hstoreString(existing.LetterLocalizedTemplates), hstoreString(r.LetterLocalizedTemplates); then != now {
+				audit := BuildAuditEntry(actor, "updated localized letter templates", r, r.ID)
+				audit.Diff = stringDiff(then, now)
+				audits = append(audits, audit)
+			}
+
 			if existing.CanUseSystemEmailConfig != r.CanUseSystemEmailConfig {
 				audit := BuildAuditEntry(actor, "updated ability to use system email config", r, r.ID)
 				audit.Diff = boolDiff(existing.CanUseSystemEmailConfig, r.CanUseSystemEmailConfig)
@@ -1558,25 +2134,55 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 // only time the API key is available is as the string return parameter from
 // invoking this function.
 func (r *Realm) CreateAuthorizedApp(db *Database, app *AuthorizedApp, actor Auditable) (string, error) {
-	fullAPIKey, err := db.GenerateAPIKey(r.ID)
+	fullAPIKey, hmacedKey, preview, err := r.generateAuthorizedAppKey(db)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate API key: %w", err)
+		return "", err
 	}
 
-	parts := strings.SplitN(fullAPIKey, ".", 3)
-	if len(parts) != 3 {
-		return "", fmt.Errorf("internal error, key is invalid")
+	app.RealmID = r.ID
+	app.APIKey = hmacedKey
+	app.APIKeyPreview = preview
+
+	if err := db.SaveAuthorizedApp(app, actor); err != nil {
+		return "", err
 	}
-	apiKey := parts[0]
+	return fullAPIKey, nil
+}
 
-	hmacedKey, err := db.GenerateAPIKeyHMAC(apiKey)
+// RotateAuthorizedApp generates a new API key for the existing app, keeping its
+// ID, name, and statistics. The replaced API key continues to work for the
+// grace period, after which only the new API key works. If the app is still
+// within the grace period of an earlier rotation, the API key replaced by that
+// rotation stops working immediately. Like CreateAuthorizedApp, the new API key
+// is only available as the string return parameter.
+func (r *Realm) RotateAuthorizedApp(db *Database, app *AuthorizedApp, gracePeriod time.Duration, actor Auditable) (string, error) {
+	if app.RealmID != r.ID {
+		return "", fmt.Errorf("API key does not belong to realm")
+	}
+	if gracePeriod < 0 || gracePeriod > MaxAPIKeyRotationGracePeriod {
+		return "", fmt.Errorf("grace period must be between 0 and %s", MaxAPIKeyRotationGracePeriod)
+	}
+
+	fullAPIKey, hmacedKey, preview, err := r.generateAuthorizedAppKey(db)
 	if err != nil {
-		return "", fmt.Errorf("failed to create hmac: %w", err)
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	app.ClearPreviousAPIKey()
+	if gracePeriod > 0 {
+		previousExpiresAt := now.Add(gracePeriod)
+		app.PreviousAPIKey = app.APIKey
+		app.PreviousAPIKeyPreview = app.APIKeyPreview
+		app.PreviousAPIKeyExpiresAt = &previousExpiresAt
+		app.PreviousAPIKeyLastUsedAt = app.LastUsedAt
 	}
 
-	app.RealmID = r.ID
 	app.APIKey = hmacedKey
-	app.APIKeyPreview = apiKey[:6]
+	app.APIKeyPreview = preview
+	app.LastUsedAt = nil
+	app.RotatedAt = &now
 
 	if err := db.SaveAuthorizedApp(app, actor); err != nil {
 		return "", err
@@ -1584,6 +2190,27 @@ func (r *Realm) CreateAuthorizedApp(db *Database, app *AuthorizedApp, actor Audi
 	return fullAPIKey, nil
 }
 
+// generateAuthorizedAppKey generates a new API key for the realm, returning
+// the full API key, the HMAC to store in the database, and the preview.
+func (r *Realm) generateAuthorizedAppKey(db *Database) (string, string, string, error) {
+	fullAPIKey, err := db.GenerateAPIKey(r.ID)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	parts := strings.SplitN(fullAPIKey, ".", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("internal error, key is invalid")
+	}
+	apiKey := parts[0]
+
+	hmacedKey, err := db.GenerateAPIKeyHMAC(apiKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create hmac: %w", err)
+	}
+	return fullAPIKey, hmacedKey, apiKey[:6], nil
+}
+
 func (r *Realm) CanUpgradeToRealmSigningKeys() bool {
 	return r.CertificateIssuer != "" && r.CertificateAudience != ""
 }
@@ -1795,7 +2422,12 @@ func (r *Realm) Stats(db *Database) (RealmStats, error) {
 			COALESCE(s.user_report_tokens_claimed, 0) AS user_report_tokens_claimed,
 			COALESCE(s.code_claim_age_distribution, array[]::integer[]) AS code_claim_age_distribution,
 			COALESCE(s.code_claim_mean_age, 0) AS code_claim_mean_age,
-			COALESCE(s.codes_invalid_by_os, array[0,0,0]::bigint[]) AS codes_invalid_by_os
+			COALESCE(s.codes_invalid_by_os, array[0,0,0]::bigint[]) AS codes_invalid_by_os,
+			COALESCE(s.codes_delivered, 0) AS codes_delivered,
+			COALESCE(s.codes_undelivered, 0) AS codes_undelivered,
+			COALESCE(s.sms_reminders_sent, 0) AS sms_reminders_sent,
+			COALESCE(s.codes_claimed_after_reminder, 0) AS codes_claimed_after_reminder,
+			COALESCE(s.codes_typo, 0) AS codes_typo
 		FROM (
 			SELECT date::date FROM generate_series($2, $3, '1 day'::interval) date
 		) d
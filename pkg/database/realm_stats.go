@@ -24,6 +24,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/icsv"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/jinzhu/gorm"
@@ -78,6 +79,24 @@ type RealmStat struct {
 
 	// CodeClaimMeanAge tracks the average age to claim a code.
 	CodeClaimMeanAge DurationSeconds `gorm:"column:code_claim_mean_age; type:bigint; not null; default: 0;"`
+
+	// CodesDelivered and CodesUndelivered are the number of codes whose SMS the
+	// carrier reported as delivered or undelivered. They are only populated for
+	// realms whose SMS provider sends delivery status callbacks.
+	CodesDelivered   uint `gorm:"column:codes_delivered; type:integer; not null; default:0;"`
+	CodesUndelivered uint `gorm:"column:codes_undelivered; type:integer; not null; default:0;"`
+
+	// SMSRemindersSent is the number of reminder SMS messages sent for codes
+	// which were still unclaimed. CodesClaimedAfterReminder is the number of
+	// those codes which were later claimed. They are only populated for realms
+	// with SMS reminders enabled.
+	SMSRemindersSent          uint `gorm:"column:sms_reminders_sent; type:integer; not null; default:0;"`
+	CodesClaimedAfterReminder uint `gorm:"column:codes_claimed_after_reminder; type:integer; not null; default:0;"`
+
+	// CodesTypo is the number of codes which were rejected because their check
+	// digit did not match. These codes are not looked up and are not included in
+	// CodesInvalid. It is only populated for realms which use check digits.
+	CodesTypo uint `gorm:"column:codes_typo; type:integer; not null; default:0;"`
 }
 
 func (s *RealmStat) IsEmpty() bool {
@@ -109,6 +128,21 @@ func (s *RealmStat) IsEmpty() bool {
 	if s.UserReportTokensClaimed > 0 {
 		return false
 	}
+	if s.CodesDelivered > 0 {
+		return false
+	}
+	if s.CodesUndelivered > 0 {
+		return false
+	}
+	if s.SMSRemindersSent > 0 {
+		return false
+	}
+	if s.CodesClaimedAfterReminder > 0 {
+		return false
+	}
+	if s.CodesTypo > 0 {
+		return false
+	}
 
 	for _, v := range s.CodeClaimAgeDistribution {
 		if v > 0 {
@@ -152,6 +186,9 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 		"tokens_claimed", "tokens_invalid", "code_claim_mean_age_seconds", "code_claim_age_distribution",
 		"user_reports_issued", "user_reports_claimed", "user_report_tokens_claimed",
 		"codes_invalid_unknown_os", "codes_invalid_ios", "codes_invalid_android",
+		"codes_delivered", "codes_undelivered",
+		"sms_reminders_sent", "codes_claimed_after_reminder",
+		"codes_typo",
 	}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -172,6 +209,11 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 			strconv.FormatUint(uint64(stat.CodesInvalidByOS[OSTypeUnknown]), 10),
 			strconv.FormatUint(uint64(stat.CodesInvalidByOS[OSTypeIOS]), 10),
 			strconv.FormatUint(uint64(stat.CodesInvalidByOS[OSTypeAndroid]), 10),
+			strconv.FormatUint(uint64(stat.CodesDelivered), 10),
+			strconv.FormatUint(uint64(stat.CodesUndelivered), 10),
+			strconv.FormatUint(uint64(stat.SMSRemindersSent), 10),
+			strconv.FormatUint(uint64(stat.CodesClaimedAfterReminder), 10),
+			strconv.FormatUint(uint64(stat.CodesTypo), 10),
 		}); err != nil {
 			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
 		}
@@ -213,17 +255,22 @@ type CodesInvalidByOSData struct {
 }
 
 type JSONRealmStatStatsData struct {
-	CodesIssued             uint                 `json:"codes_issued"`
-	CodesClaimed            uint                 `json:"codes_claimed"`
-	CodesInvalid            uint                 `json:"codes_invalid"`
-	CodesInvalidByOS        CodesInvalidByOSData `json:"codes_invalid_by_os"`
-	UserReportsIssued       uint                 `json:"user_reports_issued"`
-	UserReportsClaimed      uint                 `json:"user_reports_claimed"`
-	TokensClaimed           uint                 `json:"tokens_claimed"`
-	TokensInvalid           uint                 `json:"tokens_invalid"`
-	UserReportTokensClaimed uint                 `json:"user_report_tokens_claimed"`
-	CodeClaimMeanAge        uint                 `json:"code_claim_mean_age_seconds"`
-	CodeClaimDistribution   []int32              `json:"code_claim_age_distribution"`
+	CodesIssued               uint                 `json:"codes_issued"`
+	CodesClaimed              uint                 `json:"codes_claimed"`
+	CodesInvalid              uint                 `json:"codes_invalid"`
+	CodesInvalidByOS          CodesInvalidByOSData `json:"codes_invalid_by_os"`
+	UserReportsIssued         uint                 `json:"user_reports_issued"`
+	UserReportsClaimed        uint                 `json:"user_reports_claimed"`
+	TokensClaimed             uint                 `json:"tokens_claimed"`
+	TokensInvalid             uint                 `json:"tokens_invalid"`
+	UserReportTokensClaimed   uint                 `json:"user_report_tokens_claimed"`
+	CodeClaimMeanAge          uint                 `json:"code_claim_mean_age_seconds"`
+	CodeClaimDistribution     []int32              `json:"code_claim_age_distribution"`
+	CodesDelivered            uint                 `json:"codes_delivered"`
+	CodesUndelivered          uint                 `json:"codes_undelivered"`
+	SMSRemindersSent          uint                 `json:"sms_reminders_sent"`
+	CodesClaimedAfterReminder uint                 `json:"codes_claimed_after_reminder"`
+	CodesTypo                 uint                 `json:"codes_typo"`
 }
 
 // MarshalJSON is a custom JSON marshaller.
@@ -246,13 +293,18 @@ func (s RealmStats) MarshalJSON() ([]byte, error) {
 					IOS:       stat.CodesInvalidByOS[OSTypeIOS],
 					Android:   stat.CodesInvalidByOS[OSTypeAndroid],
 				},
-				UserReportsIssued:       stat.UserReportsIssued,
-				UserReportsClaimed:      stat.UserReportsClaimed,
-				TokensClaimed:           stat.TokensClaimed,
-				TokensInvalid:           stat.TokensInvalid,
-				UserReportTokensClaimed: stat.UserReportTokensClaimed,
-				CodeClaimMeanAge:        uint(stat.CodeClaimMeanAge.Duration.Seconds()),
-				CodeClaimDistribution:   stat.CodeClaimAgeDistribution,
+				UserReportsIssued:         stat.UserReportsIssued,
+				UserReportsClaimed:        stat.UserReportsClaimed,
+				TokensClaimed:             stat.TokensClaimed,
+				TokensInvalid:             stat.TokensInvalid,
+				UserReportTokensClaimed:   stat.UserReportTokensClaimed,
+				CodeClaimMeanAge:          uint(stat.CodeClaimMeanAge.Duration.Seconds()),
+				CodeClaimDistribution:     stat.CodeClaimAgeDistribution,
+				CodesDelivered:            stat.CodesDelivered,
+				CodesUndelivered:          stat.CodesUndelivered,
+				SMSRemindersSent:          stat.SMSRemindersSent,
+				CodesClaimedAfterReminder: stat.CodesClaimedAfterReminder,
+				CodesTypo:                 stat.CodesTypo,
 			},
 		})
 	}
@@ -295,19 +347,38 @@ func (s *RealmStats) UnmarshalJSON(b []byte) error {
 				stat.Data.CodesInvalidByOS.IOS,
 				stat.Data.CodesInvalidByOS.Android,
 			},
-			UserReportsIssued:        stat.Data.UserReportsIssued,
-			UserReportsClaimed:       stat.Data.UserReportsClaimed,
-			TokensClaimed:            stat.Data.TokensClaimed,
-			TokensInvalid:            stat.Data.TokensInvalid,
-			UserReportTokensClaimed:  stat.Data.UserReportTokensClaimed,
-			CodeClaimMeanAge:         FromDuration(time.Duration(stat.Data.CodeClaimMeanAge) * time.Second),
-			CodeClaimAgeDistribution: stat.Data.CodeClaimDistribution,
+			UserReportsIssued:         stat.Data.UserReportsIssued,
+			UserReportsClaimed:        stat.Data.UserReportsClaimed,
+			TokensClaimed:             stat.Data.TokensClaimed,
+			TokensInvalid:             stat.Data.TokensInvalid,
+			UserReportTokensClaimed:   stat.Data.UserReportTokensClaimed,
+			CodeClaimMeanAge:          FromDuration(time.Duration(stat.Data.CodeClaimMeanAge) * time.Second),
+			CodeClaimAgeDistribution:  stat.Data.CodeClaimDistribution,
+			CodesDelivered:            stat.Data.CodesDelivered,
+			CodesUndelivered:          stat.Data.CodesUndelivered,
+			SMSRemindersSent:          stat.Data.SMSRemindersSent,
+			CodesClaimedAfterReminder: stat.Data.CodesClaimedAfterReminder,
+			CodesTypo:                 stat.Data.CodesTypo,
 		})
 	}
 
 	return nil
 }
 
+// RecordCodeTypo increments the number of codes rejected because their check
+// digit did not match for the day containing t.
+func (r *Realm) RecordCodeTypo(db *Database, t time.Time) error {
+	sql := `
+		INSERT INTO realm_stats(date, realm_id, codes_typo)
+			VALUES ($1, $2, 1)
+		ON CONFLICT (date, realm_id) DO UPDATE
+			SET codes_typo = realm_stats.codes_typo + 1`
+	if err := db.db.Exec(sql, timeutils.UTCMidnight(t), r.ID).Error; err != nil {
+		return fmt.Errorf("failed to record code typo: %w", err)
+	}
+	return nil
+}
+
 // HistoricalCodesIssued returns a slice of the historical codes issued for
 // this realm by date descending.
 func (r *Realm) HistoricalCodesIssued(db *Database, limit uint64) ([]uint64, error) {
@@ -53,10 +53,10 @@ func TestRealmStats_MarshalCSV(t *testing.T) {
 					CodeClaimAgeDistribution: []int32{1, 3, 4},
 				},
 			},
-			expCSV: `date,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,code_claim_mean_age_seconds,code_claim_age_distribution,user_reports_issued,user_reports_claimed,user_report_tokens_claimed,codes_invalid_unknown_os,codes_invalid_ios,codes_invalid_android
-2020-02-03,10,9,1,7,2,60,1|3|4,0,0,0,0,0,0
+			expCSV: `date,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,code_claim_mean_age_seconds,code_claim_age_distribution,user_reports_issued,user_reports_claimed,user_report_tokens_claimed,codes_invalid_unknown_os,codes_invalid_ios,codes_invalid_android,codes_delivered,codes_undelivered,sms_reminders_sent,codes_claimed_after_reminder,codes_typo
+2020-02-03,10,9,1,7,2,60,1|3|4,0,0,0,0,0,0,0,0,0,0,0
 `,
-			expJSON: `{"realm_id":1,"statistics":[{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":9,"codes_invalid":1,"codes_invalid_by_os":{"unknown_os":0,"ios":0,"android":0},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":7,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":60,"code_claim_age_distribution":[1,3,4]}}]}`,
+			expJSON: `{"realm_id":1,"statistics":[{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":9,"codes_invalid":1,"codes_invalid_by_os":{"unknown_os":0,"ios":0,"android":0},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":7,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":60,"code_claim_age_distribution":[1,3,4],"codes_delivered":0,"codes_undelivered":0,"sms_reminders_sent":0,"codes_claimed_after_reminder":0,"codes_typo":0}}]}`,
 		},
 		{
 			name: "multi",
@@ -101,12 +101,12 @@ func TestRealmStats_MarshalCSV(t *testing.T) {
 					CodeClaimAgeDistribution: []int32{7, 8, 9},
 				},
 			},
-			expCSV: `date,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,code_claim_mean_age_seconds,code_claim_age_distribution,user_reports_issued,user_reports_claimed,user_report_tokens_claimed,codes_invalid_unknown_os,codes_invalid_ios,codes_invalid_android
-2020-02-03,10,9,1,7,2,60,1|2|3,0,0,0,1,2,3
-2020-02-04,45,30,29,27,2,3600,4|5|6,0,0,0,0,20,9
-2020-02-05,15,2,0,2,0,0,7|8|9,2,1,1,0,0,0
+			expCSV: `date,codes_issued,codes_claimed,codes_invalid,tokens_claimed,tokens_invalid,code_claim_mean_age_seconds,code_claim_age_distribution,user_reports_issued,user_reports_claimed,user_report_tokens_claimed,codes_invalid_unknown_os,codes_invalid_ios,codes_invalid_android,codes_delivered,codes_undelivered,sms_reminders_sent,codes_claimed_after_reminder,codes_typo
+2020-02-03,10,9,1,7,2,60,1|2|3,0,0,0,1,2,3,0,0,0,0,0
+2020-02-04,45,30,29,27,2,3600,4|5|6,0,0,0,0,20,9,0,0,0,0,0
+2020-02-05,15,2,0,2,0,0,7|8|9,2,1,1,0,0,0,0,0,0,0,0
 `,
-			expJSON: `{"realm_id":1,"statistics":[{"date":"2020-02-05T00:00:00Z","data":{"codes_issued":15,"codes_claimed":2,"codes_invalid":0,"codes_invalid_by_os":{"unknown_os":0,"ios":0,"android":0},"user_reports_issued":2,"user_reports_claimed":1,"tokens_claimed":2,"tokens_invalid":0,"user_report_tokens_claimed":1,"code_claim_mean_age_seconds":0,"code_claim_age_distribution":[7,8,9]}},{"date":"2020-02-04T00:00:00Z","data":{"codes_issued":45,"codes_claimed":30,"codes_invalid":29,"codes_invalid_by_os":{"unknown_os":0,"ios":20,"android":9},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":27,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":3600,"code_claim_age_distribution":[4,5,6]}},{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":9,"codes_invalid":1,"codes_invalid_by_os":{"unknown_os":1,"ios":2,"android":3},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":7,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":60,"code_claim_age_distribution":[1,2,3]}}]}`,
+			expJSON: `{"realm_id":1,"statistics":[{"date":"2020-02-05T00:00:00Z","data":{"codes_issued":15,"codes_claimed":2,"codes_invalid":0,"codes_invalid_by_os":{"unknown_os":0,"ios":0,"android":0},"user_reports_issued":2,"user_reports_claimed":1,"tokens_claimed":2,"tokens_invalid":0,"user_report_tokens_claimed":1,"code_claim_mean_age_seconds":0,"code_claim_age_distribution":[7,8,9],"codes_delivered":0,"codes_undelivered":0,"sms_reminders_sent":0,"codes_claimed_after_reminder":0,"codes_typo":0}},{"date":"2020-02-04T00:00:00Z","data":{"codes_issued":45,"codes_claimed":30,"codes_invalid":29,"codes_invalid_by_os":{"unknown_os":0,"ios":20,"android":9},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":27,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":3600,"code_claim_age_distribution":[4,5,6],"codes_delivered":0,"codes_undelivered":0,"sms_reminders_sent":0,"codes_claimed_after_reminder":0,"codes_typo":0}},{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":10,"codes_claimed":9,"codes_invalid":1,"codes_invalid_by_os":{"unknown_os":1,"ios":2,"android":3},"user_reports_issued":0,"user_reports_claimed":0,"tokens_claimed":7,"tokens_invalid":2,"user_report_tokens_claimed":0,"code_claim_mean_age_seconds":60,"code_claim_age_distribution":[1,2,3],"codes_delivered":0,"codes_undelivered":0,"sms_reminders_sent":0,"codes_claimed_after_reminder":0,"codes_typo":0}}]}`,
 		},
 	}
 
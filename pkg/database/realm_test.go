@@ -209,6 +209,15 @@ func TestRealm_BeforeSave(t *testing.T) {
 			},
 			Error: "codeLength must be at least 6",
 		},
+		{
+			Name: "check_digits_code_length_too_short",
+			Input: &Realm{
+				Name:           "a",
+				CodeLength:     6,
+				UseCheckDigits: true,
+			},
+			Error: "codeLength must be at least 7 when check digits are enabled",
+		},
 		{
 			Name: "code_duration_too_long",
 			Input: &Realm{
@@ -228,6 +237,56 @@ func TestRealm_BeforeSave(t *testing.T) {
 			},
 			Error: "longCodeLength must be at least 12",
 		},
+		{
+			Name: "long_code_alphabet_too_short",
+			Input: &Realm{
+				Name:             "a",
+				CodeLength:       6,
+				LongCodeLength:   16,
+				LongCodeAlphabet: "abc",
+			},
+			Error: "longCodeAlphabet must have at least 10 characters",
+		},
+		{
+			Name: "long_code_alphabet_invalid_character",
+			Input: &Realm{
+				Name:             "a",
+				CodeLength:       6,
+				LongCodeLength:   16,
+				LongCodeAlphabet: "0123456789-",
+			},
+			Error: `longCodeAlphabet may only contain letters and digits, got '-'`,
+		},
+		{
+			Name: "long_code_alphabet_duplicate",
+			Input: &Realm{
+				Name:             "a",
+				CodeLength:       6,
+				LongCodeLength:   16,
+				LongCodeAlphabet: "01234567890",
+			},
+			Error: `longCodeAlphabet contains '0' more than once`,
+		},
+		{
+			Name: "long_code_entropy_too_low",
+			Input: &Realm{
+				Name:             "a",
+				CodeLength:       6,
+				LongCodeLength:   14,
+				LongCodeAlphabet: ShortCodeAlphabet,
+			},
+			Error: "longCodeLength is too weak, codes would have 46.5 bits of entropy but at least 48 are required",
+		},
+		{
+			Name: "code_group_size_too_large",
+			Input: &Realm{
+				Name:           "a",
+				CodeLength:     6,
+				LongCodeLength: 16,
+				CodeGroupSize:  9,
+			},
+			Error: "codeGroupSize must be between 2 and 8",
+		},
 		{
 			Name: "long_code_duration_too_long",
 			Input: &Realm{
@@ -366,6 +425,21 @@ func TestRealm_BeforeSave(t *testing.T) {
 			},
 			Error: "emailVerifyTemplate must contain \"[verifylink]\"",
 		},
+		{
+			Name: "email_code_template_missing_code",
+			Input: &Realm{
+				EmailCodeTemplate: "banana",
+			},
+			Error: "emailCodeTemplate must contain \"[code]\" or \"[longcode]\"",
+		},
+		{
+			Name: "email_code_template_enx_missing_link",
+			Input: &Realm{
+				EnableENExpress:   true,
+				EmailCodeTemplate: "Your code is [longcode]",
+			},
+			Error: "emailCodeTemplate must contain \"[enslink]\"",
+		},
 		{
 			Name: "certificate_issuer_blank",
 			Input: &Realm{
@@ -404,6 +478,76 @@ func TestRealm_BeforeSave(t *testing.T) {
 			},
 			Error: "userReportWebhookSecret must be at least 12 characters",
 		},
+		{
+			Name: "sms_reminder_missing_label",
+			Input: &Realm{
+				LongCodeDuration: FromDuration(24 * time.Hour),
+				SMSReminderHours: 4,
+			},
+			Error: "smsReminderTemplateLabel is required when reminders are enabled",
+		},
+		{
+			Name: "sms_reminder_unknown_label",
+			Input: &Realm{
+				LongCodeDuration:         FromDuration(24 * time.Hour),
+				SMSReminderHours:         4,
+				SMSReminderTemplateLabel: "Reminder",
+			},
+			Error: "smsReminderTemplateLabel no template with label \"Reminder\"",
+		},
+		{
+			Name: "sms_reminder_short_code",
+			Input: &Realm{
+				LongCodeDuration: FromDuration(24 * time.Hour),
+				SMSTextAlternateTemplates: map[string]*string{
+					"Reminder": stringPtr("Reminder: your code is [code]"),
+				},
+				SMSReminderHours:         4,
+				SMSReminderTemplateLabel: "Reminder",
+			},
+			Error: "smsReminderTemplateLabel template must contain \"[longcode]\"",
+		},
+		{
+			Name: "sms_reminder_too_late",
+			Input: &Realm{
+				LongCodeDuration:         FromDuration(4 * time.Hour),
+				SMSReminderHours:         4,
+				SMSReminderTemplateLabel: "Reminder",
+			},
+			Error: "smsReminderHours must be less than the long code duration (4 hours)",
+		},
+		{
+			Name: "letter_template_enx_link_not_enx",
+			Input: &Realm{
+				LetterTemplate: "Open [enslink]",
+			},
+			Error: "letterTemplate cannot contain \"[enslink]\" because Exposure Notifications Express is not enabled",
+		},
+		{
+			Name: "letter_template_too_long",
+			Input: &Realm{
+				LetterTemplate: strings.Repeat("a", LetterTemplateMaxLength+1),
+			},
+			Error: fmt.Sprintf("letterTemplate must be %d characters or less, current message is %d characters long", LetterTemplateMaxLength, LetterTemplateMaxLength+1),
+		},
+		{
+			Name: "letter_localized_template_bad_locale",
+			Input: &Realm{
+				LetterLocalizedTemplates: map[string]*string{
+					"Spanish": stringPtr("Su código es [code]"),
+				},
+			},
+			Error: "letterLocalizedTemplates \"Spanish\" is not a valid locale",
+		},
+		{
+			Name: "letter_localized_template_empty",
+			Input: &Realm{
+				LetterLocalizedTemplates: map[string]*string{
+					"es": stringPtr(""),
+				},
+			},
+			Error: "letterLocalizedTemplates no template for locale es",
+		},
 	}
 
 	for _, tc := range cases {
@@ -526,6 +670,157 @@ func TestRealm_BuildSMSText(t *testing.T) {
 	}
 }
 
+func TestRealm_BuildSMSText_CodeGroupSize(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.RegionCode = "US-WA"
+	realm.CodeGroupSize = 4
+	realm.SMSTextTemplate = "Your code is [code] or [longcode]: [enslink]"
+
+	got, err := realm.BuildSMSText("12345678", "abcdefgh12345678", "en.express", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Your code is 1234-5678 or abcd-efgh-1234-5678: https://us-wa.en.express/v?c=abcdefgh12345678"
+	if got != want {
+		t.Errorf("SMS text wrong, want: %q got %q", want, got)
+	}
+}
+
+func TestRealm_BuildENXLink(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.RegionCode = "US-WA"
+
+	if got, want := realm.BuildENXLink("abcdefgh12345678", ""), "ens://v?r=US-WA&c=abcdefgh12345678"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := realm.BuildENXLink("abcdefgh12345678", "en.express"), "https://us-wa.en.express/v?c=abcdefgh12345678"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestRealm_FormatCode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		size uint
+		code string
+		exp  string
+	}{
+		{0, "12345678", "12345678"},
+		{4, "12345678", "1234-5678"},
+		{3, "12345678", "123-456-78"},
+		{4, "1234", "1234"},
+	}
+
+	for _, tc := range cases {
+		realm := &Realm{CodeGroupSize: tc.size}
+		if got := realm.FormatCode(tc.code); got != tc.exp {
+			t.Errorf("expected %q with group size %d to be %q, got %q", tc.code, tc.size, tc.exp, got)
+		}
+	}
+}
+
+func TestRealm_NormalizeCode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		alphabet string
+		code     string
+		exp      string
+	}{
+		{"", "ABCD-efgh 1234\t5678", "abcdefgh12345678"},
+		{CrockfordLongCodeAlphabet, "0123-ABCD", "0123abcd"},
+		{CrockfordLongCodeAlphabet, "O0o0-IiLl", "00001111"},
+		{CrockfordLongCodeAlphabet, "hello-1234", "he1101234"},
+		{"", "hello-1234", "hello1234"},
+		{"ABCDEFGHJKMNPQRSTVWXYZ", "ABCD-EFGH", "ABCDEFGH"},
+	}
+
+	for _, tc := range cases {
+		realm := &Realm{LongCodeAlphabet: tc.alphabet}
+		if got := realm.NormalizeCode(tc.code); got != tc.exp {
+			t.Errorf("expected %q to normalize to %q, got %q", tc.code, tc.exp, got)
+		}
+	}
+}
+
+func TestRealm_IsCodeTypo(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	enabledAt := now.Add(-48 * time.Hour)
+	recentlyEnabledAt := now.Add(-time.Hour)
+
+	realm := NewRealmWithDefaults("test")
+	realm.CodeLength = 8
+	realm.LongCodeLength = 16
+
+	shortCode := "12345671"        // Damm check digit 1
+	longCode := "abcdefghijklmnot" // Luhn mod 36 check character t
+
+	cases := []struct {
+		name      string
+		enabled   bool
+		enabledAt *time.Time
+		code      string
+		exp       bool
+	}{
+		{name: "disabled", enabled: false, enabledAt: &enabledAt, code: "12345678", exp: false},
+		{name: "valid_short", enabled: true, enabledAt: &enabledAt, code: shortCode, exp: false},
+		{name: "typo_short", enabled: true, enabledAt: &enabledAt, code: "12345672", exp: true},
+		{name: "transposed_short", enabled: true, enabledAt: &enabledAt, code: "21345671", exp: true},
+		{name: "valid_long", enabled: true, enabledAt: &enabledAt, code: longCode, exp: false},
+		{name: "typo_long", enabled: true, enabledAt: &enabledAt, code: "abcdefghijklmnou", exp: true},
+		{name: "other_length", enabled: true, enabledAt: &enabledAt, code: "123456", exp: false},
+		{name: "recently_enabled", enabled: true, enabledAt: &recentlyEnabledAt, code: "12345672", exp: false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := *realm
+			r.UseCheckDigits = tc.enabled
+			r.CheckDigitsEnabledAt = tc.enabledAt
+
+			if got := r.IsCodeTypo(tc.code, now); got != tc.exp {
+				t.Errorf("expected %q typo to be %t, got %t", tc.code, tc.exp, got)
+			}
+		})
+	}
+}
+
+func TestRealm_BuildSMSReminderText(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.SMSTextAlternateTemplates = map[string]*string{
+		"Reminder": stringPtr("Reminder: your code [longcode] expires in [longexpires] hours"),
+	}
+	realm.SMSReminderHours = 6
+	realm.SMSReminderTemplateLabel = "Reminder"
+
+	got, err := realm.BuildSMSReminderText("12345678", "abcdefgh12345678", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Reminder: your code abcdefgh12345678 expires in 6 hours"
+	if got != want {
+		t.Errorf("SMS text wrong, want: %q got %q", want, got)
+	}
+
+	realm.SMSReminderTemplateLabel = "Missing"
+	if _, err := realm.BuildSMSReminderText("12345678", "abcdefgh12345678", ""); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
 func TestRealm_BuildInviteEmail(t *testing.T) {
 	t.Parallel()
 
@@ -559,6 +854,88 @@ func TestRealm_BuildVerifyEmail(t *testing.T) {
 	}
 }
 
+func TestRealm_BuildEmailCodeText(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.RegionCode = "US-WA"
+
+	if got, want := realm.BuildEmailCodeText("12345678", "abcdefgh12345678", ""),
+		"Your test Exposure Notifications verification code is: abcdefgh12345678\n\nThis code expires in 24 hours."; got != want {
+		t.Errorf("Expected %q to be %q", got, want)
+	}
+
+	realm.EnableENExpress = true
+	realm.EmailCodeTemplate = "[realmname] link [enslink] or use [code] within [expires] minutes."
+	if got, want := realm.BuildEmailCodeText("12345678", "abcdefgh12345678", "en.express"),
+		"test link https://us-wa.en.express/v?c=abcdefgh12345678 or use 12345678 within 15 minutes."; got != want {
+		t.Errorf("Expected %q to be %q", got, want)
+	}
+}
+
+func TestRealm_LetterTemplateFor(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.LetterTemplateFor("es"), DefaultLetterTemplate; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.EnableENExpress = true
+	if got, want := realm.LetterTemplateFor(""), DefaultENXLetterTemplate; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.LetterTemplate = "default"
+	realm.LetterLocalizedTemplates = map[string]*string{
+		"es":      stringPtr("spanish"),
+		"zh-hant": stringPtr("traditional chinese"),
+	}
+
+	cases := []struct {
+		locale string
+		want   string
+	}{
+		{"", "default"},
+		{"fr", "default"},
+		{"es", "spanish"},
+		{"es-MX", "spanish"},
+		{"es_mx", "spanish"},
+		{"zh", "default"},
+		{"zh-Hant-TW", "traditional chinese"},
+	}
+
+	for _, tc := range cases {
+		if got := realm.LetterTemplateFor(tc.locale); got != tc.want {
+			t.Errorf("%q: expected %q to be %q", tc.locale, got, tc.want)
+		}
+	}
+}
+
+func TestRealm_BuildLetterText(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.RegionCode = "US-WA"
+	realm.CodeGroupSize = 4
+
+	expiresAt := time.Date(2021, 3, 4, 17, 30, 0, 0, time.FixedZone("UTC-08:00", -8*60*60))
+
+	if got, want := realm.BuildLetterText("", "abcdefgh12345678", "", expiresAt),
+		"Your test Exposure Notifications verification code is below. Enter this code in the Exposure Notifications settings on your mobile phone.\n\nThe code expires on 2021-03-04 17:30 UTC-08:00."; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.EnableENExpress = true
+	realm.LetterLocalizedTemplates = map[string]*string{
+		"es": stringPtr("[realmname]: [enslink] o [code] antes de [expiresat]"),
+	}
+	if got, want := realm.BuildLetterText("es", "abcdefgh12345678", "en.express", expiresAt.UTC()),
+		"test: https://us-wa.en.express/v?c=abcdefgh12345678 o abcd-efgh-1234-5678 antes de 2021-03-05 01:30 UTC"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
 func TestRealm_UserStats(t *testing.T) {
 	t.Parallel()
 
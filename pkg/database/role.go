@@ -0,0 +1,320 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/jinzhu/gorm"
+)
+
+// Role is a named set of permissions defined by a realm. Memberships assigned
+// to a role receive the role's permissions, and changes to the role's
+// permissions are applied to all of its members.
+type Role struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// RealmID is the realm which owns the role.
+	RealmID uint
+
+	// Name is the unique (within the realm) name of the role.
+	Name string `gorm:"column:name; type:text;"`
+
+	// Description is an optional description of the role's job function.
+	Description string `gorm:"column:description; type:text;"`
+
+	// Permissions are the permissions granted to members of the role.
+	Permissions rbac.Permission `gorm:"column:permissions; type:bigint;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (r *Role) BeforeSave(tx *gorm.DB) error {
+	if r.RealmID == 0 {
+		r.AddError("realmID", "cannot be blank")
+	}
+
+	r.Name = project.TrimSpace(r.Name)
+	if r.Name == "" {
+		r.AddError("name", "cannot be blank")
+	}
+	if max := 100; len(r.Name) > max {
+		r.AddError("name", fmt.Sprintf("must be %d characters or fewer", max))
+	}
+
+	r.Description = project.TrimSpace(r.Description)
+
+	if r.Permissions == 0 {
+		r.AddError("permissions", "must include at least one permission")
+	}
+
+	return r.ErrorOrNil()
+}
+
+// Can returns true if the role grants the permission, false otherwise.
+func (r *Role) Can(p rbac.Permission) bool {
+	if r == nil {
+		return false
+	}
+	return rbac.Can(r.Permissions, p)
+}
+
+// PermissionNames returns the sorted names of the role's permissions.
+func (r *Role) PermissionNames() []string {
+	return rbac.PermissionNames(r.Permissions)
+}
+
+func (r *Role) AuditID() string {
+	return fmt.Sprintf("roles:%d", r.ID)
+}
+
+func (r *Role) AuditDisplay() string {
+	return r.Name
+}
+
+// SaveRole creates or updates the role. If the role's permissions changed, the
+// new permissions are applied to every membership assigned to the role in the
+// same transaction, and each affected member is audited.
+func (db *Database) SaveRole(r *Role, actor Auditable) error {
+	if r == nil {
+		return fmt.Errorf("provided role is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing Role
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&Role{}).
+			Where("id = ?", r.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing role: %w", err)
+		}
+
+		// Save the role
+		if err := tx.Save(r).Error; err != nil {
+			if IsUniqueViolation(err, "uix_roles_realm_id_name") {
+				r.AddError("name", "must be unique")
+				return ErrValidationFailed
+			}
+			return err
+		}
+
+		// Brand new role?
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "created role", r, r.RealmID)
+			audit.Diff = stringSliceDiff(nil, rbac.PermissionNames(r.Permissions))
+			audits = append(audits, audit)
+		} else {
+			if existing.Name != r.Name {
+				audit := BuildAuditEntry(actor, "updated role name", r, r.RealmID)
+				audit.Diff = stringDiff(existing.Name, r.Name)
+				audits = append(audits, audit)
+			}
+
+			if existing.Description != r.Description {
+				audit := BuildAuditEntry(actor, "updated role description", r, r.RealmID)
+				audit.Diff = stringDiff(existing.Description, r.Description)
+				audits = append(audits, audit)
+			}
+
+			if then, now := existing.Permissions, r.Permissions; then != now {
+				audit := BuildAuditEntry(actor, "updated role permissions", r, r.RealmID)
+				audit.Diff = stringSliceDiff(rbac.PermissionNames(then), rbac.PermissionNames(now))
+				audits = append(audits, audit)
+
+				memberAudits, err := applyRolePermissions(tx, r, actor)
+				if err != nil {
+					return err
+				}
+				audits = append(audits, memberAudits...)
+			}
+		}
+
+		// Save all audits
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// applyRolePermissions updates the permissions of all memberships assigned to
+// the role to match the role, returning an audit entry for each changed
+// membership.
+func applyRolePermissions(tx *gorm.DB, r *Role, actor Auditable) ([]*AuditEntry, error) {
+	var memberships []*Membership
+	if err := tx.
+		Preload("Realm").
+		Preload("User").
+		Model(&Membership{}).
+		Where("realm_id = ?", r.RealmID).
+		Where("role_id = ?", r.ID).
+		Find(&memberships).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list role memberships: %w", err)
+	}
+
+	now := time.Now().UTC()
+	audits := make([]*AuditEntry, 0, len(memberships))
+	userIDs := make([]uint, 0, len(memberships))
+	for _, membership := range memberships {
+		if membership.Permissions == r.Permissions {
+			continue
+		}
+
+		audit := BuildAuditEntry(actor, "updated user permissions", membership.User, r.RealmID)
+		audit.Diff = stringSliceDiff(rbac.PermissionNames(membership.Permissions), rbac.PermissionNames(r.Permissions))
+		audits = append(audits, audit)
+		userIDs = append(userIDs, membership.UserID)
+	}
+
+	if len(userIDs) == 0 {
+		return audits, nil
+	}
+
+	if err := tx.
+		Model(&Membership{}).
+		Where("realm_id = ?", r.RealmID).
+		Where("role_id = ?", r.ID).
+		Where("user_id IN (?)", userIDs).
+		UpdateColumns(map[string]interface{}{
+			"permissions": r.Permissions,
+			"updated_at":  now,
+		}).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to update role memberships: %w", err)
+	}
+
+	// Cascade updated_at on users
+	if err := tx.
+		Model(&User{}).
+		Where("id IN (?)", userIDs).
+		UpdateColumn("updated_at", now).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to update user updated_at: %w", err)
+	}
+
+	return audits, nil
+}
+
+// DeleteRole deletes the role. Members of the role keep their current
+// permissions, but are no longer assigned to a role.
+func (db *Database) DeleteRole(r *Role, actor Auditable) error {
+	if r == nil {
+		return fmt.Errorf("provided role is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&Membership{}).
+			Where("realm_id = ?", r.RealmID).
+			Where("role_id = ?", r.ID).
+			UpdateColumn("role_id", gorm.Expr("NULL")).
+			Error; err != nil {
+			return fmt.Errorf("failed to detach role memberships: %w", err)
+		}
+
+		if err := tx.
+			Where("id = ?", r.ID).
+			Delete(&Role{}).
+			Error; err != nil {
+			return err
+		}
+
+		audit := BuildAuditEntry(actor, "deleted role", r, r.RealmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// FindRole finds the role by the given id associated with the realm.
+func (r *Realm) FindRole(db *Database, id interface{}) (*Role, error) {
+	var role Role
+	if err := db.db.
+		Model(&Role{}).
+		Where("id = ?", id).
+		Where("realm_id = ?", r.ID).
+		First(&role).
+		Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoles lists the realm's roles, ordered by name.
+func (r *Realm) ListRoles(db *Database) ([]*Role, error) {
+	var roles []*Role
+	if err := db.db.
+		Model(&Role{}).
+		Where("realm_id = ?", r.ID).
+		Order("LOWER(name) ASC").
+		Find(&roles).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return roles, nil
+		}
+		return nil, err
+	}
+	return roles, nil
+}
+
+// RoleMemberCounts returns a map where the key is the ID of a role in the realm
+// and the value is the number of memberships assigned to that role.
+func (r *Realm) RoleMemberCounts(db *Database) (map[uint]int, error) {
+	var rows []*struct {
+		RoleID uint
+		Count  int
+	}
+	if err := db.db.
+		Model(&Membership{}).
+		Select("role_id, COUNT(*) AS count").
+		Where("realm_id = ?", r.ID).
+		Where("role_id IS NOT NULL").
+		Group("role_id").
+		Scan(&rows).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.RoleID] = row.Count
+	}
+	return counts, nil
+}
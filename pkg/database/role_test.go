@@ -0,0 +1,191 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func TestRole_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		role    *Role
+		errKeys []string
+	}{
+		{
+			name: "valid",
+			role: &Role{
+				RealmID:     1,
+				Name:        "Contact tracer",
+				Permissions: rbac.CodeIssue,
+			},
+		},
+		{
+			name:    "missing_fields",
+			role:    &Role{Name: "   "},
+			errKeys: []string{"realmID", "name", "permissions"},
+		},
+		{
+			name: "long_name",
+			role: &Role{
+				RealmID:     1,
+				Name:        string(make([]byte, 101)),
+				Permissions: rbac.CodeIssue,
+			},
+			errKeys: []string{"name"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.role.BeforeSave(nil)
+			for _, k := range tc.errKeys {
+				if len(tc.role.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+			if len(tc.errKeys) == 0 {
+				if msgs := tc.role.ErrorMessages(); len(msgs) > 0 {
+					t.Errorf("expected no errors, got %q", msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabase_SaveRole(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("Test Realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	role := &Role{
+		RealmID:     realm.ID,
+		Name:        "Lab tech",
+		Permissions: rbac.CodeIssue | rbac.CodeRead,
+	}
+	if err := db.SaveRole(role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names are unique within the realm.
+	duplicate := &Role{
+		RealmID:     realm.ID,
+		Name:        "lab tech",
+		Permissions: rbac.CodeIssue,
+	}
+	if err := db.SaveRole(duplicate, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+
+	member := &User{Email: "member@example.com", Name: "Member"}
+	if err := db.SaveUser(member, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := member.AddToRealmWithRole(db, realm, role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &User{Email: "other@example.com", Name: "Other"}
+	if err := db.SaveUser(other, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.AddToRealm(db, realm, rbac.CodeIssue|rbac.CodeRead, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updating the role updates its members, but not other memberships.
+	role.Permissions = rbac.CodeIssue | rbac.CodeRead | rbac.CodeExpire
+	if err := db.SaveRole(role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	membership, err := member.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := membership.Permissions, role.Permissions; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if membership.Role == nil || membership.Role.ID != role.ID {
+		t.Errorf("expected membership role to be %d, got %#v", role.ID, membership.Role)
+	}
+
+	otherMembership, err := other.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := otherMembership.Permissions, rbac.CodeIssue|rbac.CodeRead; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	counts, err := realm.RoleMemberCounts(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := counts[role.ID], 1; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Setting explicit permissions removes the role.
+	if err := member.AddToRealm(db, realm, rbac.CodeIssue, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	membership, err = member.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.HasRole() {
+		t.Errorf("expected membership to have no role")
+	}
+
+	// Deleting the role keeps members' permissions.
+	if err := member.AddToRealmWithRole(db, realm, role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRole(role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	membership, err = member.FindMembership(db, realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.HasRole() {
+		t.Errorf("expected membership to have no role")
+	}
+	if got, want := membership.Permissions, role.Permissions; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	roles, err := realm.ListRoles(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(roles), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
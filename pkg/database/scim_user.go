@@ -0,0 +1,277 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+)
+
+// SCIMUser is a user who was provisioned in a realm by the realm's identity
+// management system through SCIM. The user is active while they are a member
+// of the realm; deactivating the user removes their membership, but keeps the
+// SCIMUser so the identity management system can reactivate them later.
+type SCIMUser struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// RealmID is the realm which provisioned the user.
+	RealmID uint
+
+	// UserID is the provisioned user. It is also the user's SCIM ID.
+	UserID uint
+	User   *User
+
+	// ExternalID is the identifier of the user in the identity management
+	// system, if it provided one.
+	ExternalID string `gorm:"column:external_id; type:text;"`
+
+	// Membership is the user's membership in the realm, or nil if the user is
+	// inactive. It is loaded by ListSCIMUsers and FindSCIMUser.
+	Membership *Membership `gorm:"-"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (s *SCIMUser) BeforeSave(tx *gorm.DB) error {
+	if s.RealmID == 0 {
+		s.AddError("realmID", "cannot be blank")
+	}
+	if s.UserID == 0 {
+		s.AddError("userID", "cannot be blank")
+	}
+	s.ExternalID = project.TrimSpace(s.ExternalID)
+	return s.ErrorOrNil()
+}
+
+// IsActive returns true if the user is a member of the realm and their
+// membership has not expired.
+func (s *SCIMUser) IsActive() bool {
+	return s.Membership != nil && !s.Membership.IsExpired()
+}
+
+func (s *SCIMUser) AuditID() string {
+	return fmt.Sprintf("scim_users:%d", s.ID)
+}
+
+func (s *SCIMUser) AuditDisplay() string {
+	if s.User != nil {
+		return s.User.Email
+	}
+	return fmt.Sprintf("scim user %d", s.UserID)
+}
+
+// ListSCIMUsers lists the users provisioned by the realm, ordered by the time
+// they were provisioned, along with the total number of matching users.
+func (r *Realm) ListSCIMUsers(db *Database, offset, limit uint64, scopes ...Scope) ([]*SCIMUser, uint64, error) {
+	query := db.db.
+		Model(&SCIMUser{}).
+		Preload("User").
+		Joins("JOIN users ON users.id = scim_users.user_id").
+		Where("scim_users.realm_id = ?", r.ID).
+		Where("users.deleted_at IS NULL").
+		Scopes(scopes...)
+
+	var total uint64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var scimUsers []*SCIMUser
+	if err := query.
+		Select("scim_users.*").
+		Order("scim_users.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&scimUsers).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, 0, err
+	}
+
+	if err := r.loadSCIMMemberships(db, scimUsers); err != nil {
+		return nil, 0, err
+	}
+	return scimUsers, total, nil
+}
+
+// FindSCIMUser finds the user provisioned by the realm with the given user ID.
+// If the user was not provisioned by the realm, an error is returned that
+// satisfies IsNotFound.
+func (r *Realm) FindSCIMUser(db *Database, userID interface{}) (*SCIMUser, error) {
+	var scimUser SCIMUser
+	if err := db.db.
+		Model(&SCIMUser{}).
+		Select("scim_users.*").
+		Preload("User").
+		Joins("JOIN users ON users.id = scim_users.user_id").
+		Where("scim_users.realm_id = ? AND scim_users.user_id = ?", r.ID, userID).
+		Where("users.deleted_at IS NULL").
+		First(&scimUser).
+		Error; err != nil {
+		return nil, err
+	}
+
+	if err := r.loadSCIMMemberships(db, []*SCIMUser{&scimUser}); err != nil {
+		return nil, err
+	}
+	return &scimUser, nil
+}
+
+// loadSCIMMemberships populates the realm membership of each of the users.
+func (r *Realm) loadSCIMMemberships(db *Database, scimUsers []*SCIMUser) error {
+	if len(scimUsers) == 0 {
+		return nil
+	}
+
+	userIDs := make([]uint, 0, len(scimUsers))
+	for _, s := range scimUsers {
+		userIDs = append(userIDs, s.UserID)
+	}
+
+	var memberships []*Membership
+	if err := db.db.
+		Model(&Membership{}).
+		Preload("Realm").
+		Preload("Role").
+		Preload("User").
+		Where("realm_id = ? AND user_id IN (?)", r.ID, userIDs).
+		Find(&memberships).
+		Error; err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to load memberships: %w", err)
+	}
+
+	byUserID := make(map[uint]*Membership, len(memberships))
+	for _, m := range memberships {
+		byUserID[m.UserID] = m
+	}
+	for _, s := range scimUsers {
+		s.Membership = byUserID[s.UserID]
+	}
+	return nil
+}
+
+// SCIMGroupMember is an active SCIM user with a role. Roles are SCIM groups.
+type SCIMGroupMember struct {
+	RoleID uint
+	UserID uint
+	Email  string
+}
+
+// ListSCIMGroupMembers lists the active SCIM users with any of the given roles,
+// ordered by email.
+func (r *Realm) ListSCIMGroupMembers(db *Database, roleIDs []uint) ([]*SCIMGroupMember, error) {
+	var members []*SCIMGroupMember
+	if len(roleIDs) == 0 {
+		return members, nil
+	}
+
+	if err := db.db.
+		Table("scim_users").
+		Select("memberships.role_id, scim_users.user_id, users.email").
+		Joins("JOIN memberships ON memberships.user_id = scim_users.user_id AND memberships.realm_id = scim_users.realm_id").
+		Joins("JOIN users ON users.id = scim_users.user_id").
+		Where("scim_users.realm_id = ?", r.ID).
+		Where("memberships.role_id IN (?)", roleIDs).
+		Where("memberships.expires_at IS NULL OR memberships.expires_at > ?", time.Now().UTC()).
+		Where("users.deleted_at IS NULL").
+		Order("LOWER(users.email) ASC").
+		Scan(&members).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SaveSCIMUser creates or updates the SCIM user. Changes to the user and their
+// membership are saved separately with SaveUser, AddToRealm, and
+// DeleteFromRealm.
+func (db *Database) SaveSCIMUser(s *SCIMUser, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided scim user is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing SCIMUser
+		if err := tx.
+			Model(&SCIMUser{}).
+			Where("id = ?", s.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing scim user: %w", err)
+		}
+
+		if err := tx.Omit("User").Save(s).Error; err != nil {
+			if IsUniqueViolation(err, "uix_scim_users_realm_id_user_id") {
+				s.AddError("userID", "is already provisioned")
+				return ErrValidationFailed
+			}
+			return err
+		}
+
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "provisioned scim user", s, s.RealmID)
+			audit.Diff = stringDiff("", s.ExternalID)
+			audits = append(audits, audit)
+		} else if existing.ExternalID != s.ExternalID {
+			audit := BuildAuditEntry(actor, "updated scim user external id", s, s.RealmID)
+			audit.Diff = stringDiff(existing.ExternalID, s.ExternalID)
+			audits = append(audits, audit)
+		}
+
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteSCIMUser deletes the SCIM user. The user's membership is removed
+// separately with DeleteFromRealm.
+func (db *Database) DeleteSCIMUser(s *SCIMUser, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided scim user is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(s).Error; err != nil {
+			return fmt.Errorf("failed to delete scim user: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "deleted scim user", s, s.RealmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func TestSCIMUser_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	s := &SCIMUser{ExternalID: "  "}
+	_ = s.BeforeSave(nil)
+	for _, k := range []string{"realmID", "userID"} {
+		if len(s.ErrorsFor(k)) == 0 {
+			t.Errorf("expected errors for %q", k)
+		}
+	}
+}
+
+func TestRealm_SCIMUsers(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("Test Realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	role := &Role{RealmID: realm.ID, Name: "Tracer", Permissions: rbac.CodeIssue | rbac.CodeRead}
+	if err := db.SaveRole(role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	provision := func(tb testing.TB, email, externalID string) (*User, *SCIMUser) {
+		tb.Helper()
+
+		user := &User{Email: email, Name: email}
+		if err := db.SaveUser(user, SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		scimUser := &SCIMUser{RealmID: realm.ID, UserID: user.ID, ExternalID: externalID}
+		if err := db.SaveSCIMUser(scimUser, SystemTest); err != nil {
+			tb.Fatal(err)
+		}
+		return user, scimUser
+	}
+
+	alice, aliceSCIM := provision(t, "alice@example.com", "ext-alice")
+	bob, _ := provision(t, "bob@example.com", "ext-bob")
+
+	if err := alice.AddToRealmWithRole(db, realm, role, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// A user can only be provisioned once per realm.
+	if err := db.SaveSCIMUser(&SCIMUser{RealmID: realm.ID, UserID: alice.ID}, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+
+	scimUsers, total, err := realm.ListSCIMUsers(db, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := total, uint64(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := len(scimUsers), 2; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if !scimUsers[0].IsActive() {
+		t.Errorf("expected alice to be active")
+	}
+	if scimUsers[1].IsActive() {
+		t.Errorf("expected bob to be inactive")
+	}
+
+	scimUsers, total, err = realm.ListSCIMUsers(db, 0, 10, WithSCIMUserName("BOB@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := total, uint64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if len(scimUsers) != 1 || scimUsers[0].UserID != bob.ID {
+		t.Errorf("expected bob, got %v", scimUsers)
+	}
+
+	scimUsers, _, err = realm.ListSCIMUsers(db, 0, 10, WithSCIMExternalID("ext-alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scimUsers) != 1 || scimUsers[0].UserID != alice.ID {
+		t.Errorf("expected alice, got %v", scimUsers)
+	}
+
+	members, err := realm.ListSCIMGroupMembers(db, []uint{role.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UserID != alice.ID || members[0].Email != alice.Email {
+		t.Errorf("expected alice, got %v", members)
+	}
+
+	if err := db.DeleteSCIMUser(aliceSCIM, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.FindSCIMUser(db, alice.ID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
@@ -17,6 +17,7 @@ package database
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
@@ -181,6 +182,22 @@ func WithAuditRealmID(id uint) Scope {
 	}
 }
 
+// WithSCIMUserName returns a scope that filters SCIM users by email,
+// case-insensitive. It's only applicable to functions that query SCIMUser.
+func WithSCIMUserName(email string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER(users.email) = LOWER(?)", project.TrimSpace(email))
+	}
+}
+
+// WithSCIMExternalID returns a scope that filters SCIM users by their external
+// ID. It's only applicable to functions that query SCIMUser.
+func WithSCIMExternalID(id string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("scim_users.external_id = ?", id)
+	}
+}
+
 // WithRealmSearch returns a scope that adds querying for realms by name. It's
 // only applicable to functions that query Realm.
 func WithRealmSearch(q string) Scope {
@@ -251,3 +268,88 @@ func WithMobileAppSearch(q string) Scope {
 		return db
 	}
 }
+
+// WithVerificationCodeExternalID returns a scope that filters verification
+// codes by the external issuer ID given when the code was issued. It's only
+// applicable to functions that query VerificationCode.
+func WithVerificationCodeExternalID(id string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		id = project.TrimSpace(id)
+		if id != "" {
+			return db.Where("verification_codes.issuing_external_id = ?", id)
+		}
+		return db
+	}
+}
+
+// WithVerificationCodeIssuingUserID returns a scope that filters verification
+// codes by the user who issued them. It's only applicable to functions that
+// query VerificationCode.
+func WithVerificationCodeIssuingUserID(id uint) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("verification_codes.issuing_user_id = ?", id)
+	}
+}
+
+// WithVerificationCodeIssuingAppID returns a scope that filters verification
+// codes by the API key which issued them. It's only applicable to functions
+// that query VerificationCode.
+func WithVerificationCodeIssuingAppID(id uint) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("verification_codes.issuing_app_id = ?", id)
+	}
+}
+
+// WithVerificationCodeTestType returns a scope that filters verification codes
+// by test type. It's only applicable to functions that query VerificationCode.
+func WithVerificationCodeTestType(testType string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		testType = strings.ToLower(project.TrimSpace(testType))
+		if testType == "" {
+			return db
+		}
+		if _, ok := ValidTestTypes[testType]; !ok {
+			_ = db.AddError(fmt.Errorf("%w: unknown test type %q", ErrValidationFailed, testType))
+			return db
+		}
+		return db.Where("verification_codes.test_type = ?", testType)
+	}
+}
+
+// WithVerificationCodeCreatedAt returns a scope that filters verification codes
+// issued at or after from and before to. Zero times are ignored. It's only
+// applicable to functions that query VerificationCode.
+func WithVerificationCodeCreatedAt(from, to time.Time) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		if !from.IsZero() {
+			db = db.Where("verification_codes.created_at >= ?", from)
+		}
+		if !to.IsZero() {
+			db = db.Where("verification_codes.created_at < ?", to)
+		}
+		return db
+	}
+}
+
+// WithVerificationCodeStatus returns a scope that filters verification codes by
+// their current status. It's only applicable to functions that query
+// VerificationCode.
+func WithVerificationCodeStatus(status VerificationCodeStatus) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		now := time.Now().UTC()
+
+		switch status {
+		case "":
+			return db
+		case VerificationCodeStatusActive:
+			return db.Where("verification_codes.claimed = ? AND (verification_codes.expires_at >= ? OR verification_codes.long_expires_at >= ?)", false, now, now)
+		case VerificationCodeStatusClaimed:
+			return db.Where("verification_codes.claimed = ?", true)
+		case VerificationCodeStatusExpired:
+			return db.Where("verification_codes.claimed = ? AND verification_codes.expires_at < ? AND verification_codes.long_expires_at < ?", false, now, now)
+		default:
+			_ = db.AddError(fmt.Errorf("%w: unknown status %q", ErrValidationFailed, status))
+			return db
+		}
+	}
+}
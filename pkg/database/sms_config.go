@@ -15,6 +15,9 @@
 package database
 
 import (
+	"context"
+	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/google/exposure-notifications-verification-server/internal/project"
@@ -46,12 +49,60 @@ type SMSConfig struct {
 	TwilioAuthTokenPlaintextCache  string `gorm:"-"`
 	TwilioAuthTokenCiphertextCache string `gorm:"-"`
 
+	// Vonage configuration options.
+	VonageAPIKey     string `gorm:"type:varchar(250)"`
+	VonageFromNumber string `gorm:"type:varchar(255)"`
+
+	// VonageAPISecret is encrypted/decrypted automatically by callbacks. The
+	// cache fields exist as optimizations.
+	VonageAPISecret                string `gorm:"type:varchar(250)" json:"-"` // ignored by zap's JSON formatter
+	VonageAPISecretPlaintextCache  string `gorm:"-"`
+	VonageAPISecretCiphertextCache string `gorm:"-"`
+
+	// Generic HTTP configuration options.
+	HTTPEndpoint     string `gorm:"type:text"`
+	HTTPAuthHeader   string `gorm:"type:varchar(250)"`
+	HTTPBodyTemplate string `gorm:"type:text"`
+	HTTPFromNumber   string `gorm:"type:varchar(255)"`
+
+	// HTTPAuthToken is encrypted/decrypted automatically by callbacks. The
+	// cache fields exist as optimizations.
+	HTTPAuthToken                string `gorm:"type:text" json:"-"` // ignored by zap's JSON formatter
+	HTTPAuthTokenPlaintextCache  string `gorm:"-"`
+	HTTPAuthTokenCiphertextCache string `gorm:"-"`
+
 	// IsSystem determines if this is a system-level SMS configuration. There can
 	// only be one system-level SMS configuration.
 	IsSystem bool `gorm:"type:bool; not null; default:false;"`
+
+	// Priority is the order in which this configuration is tried when sending
+	// messages. The primary configuration has a priority of 0, failover
+	// configurations have increasing priorities.
+	Priority uint `gorm:"type:integer; not null; default:0;"`
 }
 
 func (s *SMSConfig) BeforeSave(tx *gorm.DB) error {
+	switch s.ProviderType {
+	case sms.ProviderTypeVonage:
+		s.validateVonage()
+	case sms.ProviderTypeHTTP:
+		s.validateHTTP()
+	default:
+		s.validateTwilio()
+	}
+
+	if s.IsSystem {
+		// Do not persist from numbers for system configs
+		s.TwilioFromNumber = ""
+		s.VonageFromNumber = ""
+		s.HTTPFromNumber = ""
+	}
+
+	return s.ErrorOrNil()
+}
+
+// validateTwilio validates the Twilio configuration options.
+func (s *SMSConfig) validateTwilio() {
 	// Twilio config is all or nothing
 	if (s.TwilioAccountSid == "") != (s.TwilioAuthToken == "") {
 		s.AddError("twilioAccountSid", "all must be specified or all must be blank")
@@ -78,13 +129,106 @@ func (s *SMSConfig) BeforeSave(tx *gorm.DB) error {
 			}
 		}
 	}
+}
 
-	if s.IsSystem {
-		// Do not persist from numbers for system configs
-		s.TwilioFromNumber = ""
+// validateVonage validates the Vonage configuration options.
+func (s *SMSConfig) validateVonage() {
+	// Vonage config is all or nothing
+	if (s.VonageAPIKey == "") != (s.VonageAPISecret == "") {
+		s.AddError("vonageAPIKey", "all must be specified or all must be blank")
+		s.AddError("vonageAPISecret", "all must be specified or all must be blank")
 	}
 
-	return s.ErrorOrNil()
+	if s.VonageAPIKey != "" && s.VonageFromNumber == "" && !s.IsSystem {
+		s.AddError("vonageFromNumber", "cannot be blank")
+	}
+}
+
+// validateHTTP validates the generic HTTP configuration options.
+func (s *SMSConfig) validateHTTP() {
+	if s.HTTPEndpoint == "" {
+		if s.HTTPAuthToken != "" || s.HTTPAuthHeader != "" || s.HTTPBodyTemplate != "" {
+			s.AddError("httpEndpoint", "cannot be blank")
+		}
+		return
+	}
+
+	u, err := url.Parse(s.HTTPEndpoint)
+	if err != nil {
+		s.AddError("httpEndpoint", err.Error())
+	} else if u.Scheme != "https" {
+		s.AddError("httpEndpoint", "must be an https URL")
+	}
+
+	if _, err := sms.ParseHTTPBodyTemplate(s.HTTPBodyTemplate); err != nil {
+		s.AddError("httpBodyTemplate", err.Error())
+	}
+}
+
+// IsBlank returns true if none of the fields for the configured provider are
+// set.
+func (s *SMSConfig) IsBlank() bool {
+	switch s.ProviderType {
+	case sms.ProviderTypeVonage:
+		return s.VonageAPIKey == "" && s.VonageAPISecret == "" && s.VonageFromNumber == ""
+	case sms.ProviderTypeHTTP:
+		return s.HTTPEndpoint == "" && s.HTTPAuthToken == "" && s.HTTPFromNumber == ""
+	case sms.ProviderTypeTwilio:
+		return s.TwilioAccountSid == "" && s.TwilioAuthToken == "" && s.TwilioFromNumber == ""
+	default:
+		return false
+	}
+}
+
+// FromNumber returns the sender for the configured provider.
+func (s *SMSConfig) FromNumber() string {
+	switch s.ProviderType {
+	case sms.ProviderTypeVonage:
+		return s.VonageFromNumber
+	case sms.ProviderTypeHTTP:
+		return s.HTTPFromNumber
+	default:
+		return s.TwilioFromNumber
+	}
+}
+
+// SetFromNumber sets the sender for the configured provider.
+func (s *SMSConfig) SetFromNumber(from string) {
+	switch s.ProviderType {
+	case sms.ProviderTypeVonage:
+		s.VonageFromNumber = from
+	case sms.ProviderTypeHTTP:
+		s.HTTPFromNumber = from
+	default:
+		s.TwilioFromNumber = from
+	}
+}
+
+// Provider builds the SMS provider for this configuration.
+func (s *SMSConfig) Provider(ctx context.Context) (sms.Provider, error) {
+	return sms.ProviderFor(ctx, &sms.Config{
+		ProviderType:     s.ProviderType,
+		TwilioAccountSid: s.TwilioAccountSid,
+		TwilioAuthToken:  s.TwilioAuthToken,
+		TwilioFromNumber: s.TwilioFromNumber,
+		VonageAPIKey:     s.VonageAPIKey,
+		VonageAPISecret:  s.VonageAPISecret,
+		VonageFromNumber: s.VonageFromNumber,
+		HTTPEndpoint:     s.HTTPEndpoint,
+		HTTPAuthHeader:   s.HTTPAuthHeader,
+		HTTPAuthToken:    s.HTTPAuthToken,
+		HTTPBodyTemplate: s.HTTPBodyTemplate,
+		HTTPFromNumber:   s.HTTPFromNumber,
+	})
+}
+
+// ProviderName returns the name used to identify this configuration's provider
+// in statistics.
+func (s *SMSConfig) ProviderName() string {
+	if s.IsSystem {
+		return "system"
+	}
+	return strings.ToLower(string(s.ProviderType))
 }
 
 // SystemSMSConfig returns the system SMS config, if one exists
@@ -102,8 +246,7 @@ func (db *Database) SystemSMSConfig() (*SMSConfig, error) {
 
 // SaveSMSConfig creates or updates an SMS configuration record.
 func (db *Database) SaveSMSConfig(s *SMSConfig) error {
-	if s.ProviderType == sms.ProviderTypeTwilio &&
-		s.TwilioAccountSid == "" && s.TwilioAuthToken == "" && s.TwilioFromNumber == "" {
+	if s.IsBlank() {
 		if db.db.NewRecord(s) {
 			// The fields are all blank, do not create the record.
 			return nil
@@ -132,3 +275,12 @@ func (db *Database) SaveSMSConfig(s *SMSConfig) error {
 	}
 	return db.db.Save(s).Error
 }
+
+// DeleteSMSConfig permanently deletes the given SMS configuration. It cannot
+// be used to delete the system configuration.
+func (db *Database) DeleteSMSConfig(s *SMSConfig) error {
+	if s.IsSystem {
+		return fmt.Errorf("cannot delete the system sms config")
+	}
+	return db.db.Unscoped().Delete(s).Error
+}
@@ -89,6 +89,55 @@ func TestSMSConfig_Validate(t *testing.T) {
 			},
 			err: "validation failed",
 		},
+		{
+			name: "vonage missing secret",
+			smsConfig: &SMSConfig{
+				RealmID:          realm.ID,
+				ProviderType:     sms.ProviderTypeVonage,
+				VonageAPIKey:     "abc123",
+				VonageFromNumber: "+11234567890",
+			},
+			err: "validation failed",
+		},
+		{
+			name: "vonage missing from",
+			smsConfig: &SMSConfig{
+				RealmID:         realm.ID,
+				ProviderType:    sms.ProviderTypeVonage,
+				VonageAPIKey:    "abc123",
+				VonageAPISecret: "def123",
+			},
+			err: "validation failed",
+		},
+		{
+			name: "vonage valid",
+			smsConfig: &SMSConfig{
+				RealmID:          realm.ID,
+				ProviderType:     sms.ProviderTypeVonage,
+				VonageAPIKey:     "abc123",
+				VonageAPISecret:  "def123",
+				VonageFromNumber: "+11234567890",
+			},
+		},
+		{
+			name: "http insecure endpoint",
+			smsConfig: &SMSConfig{
+				RealmID:      realm.ID,
+				ProviderType: sms.ProviderTypeHTTP,
+				HTTPEndpoint: "http://example.com/send",
+			},
+			err: "validation failed",
+		},
+		{
+			name: "http invalid template",
+			smsConfig: &SMSConfig{
+				RealmID:          realm.ID,
+				ProviderType:     sms.ProviderTypeHTTP,
+				HTTPEndpoint:     "https://example.com/send",
+				HTTPBodyTemplate: "{{",
+			},
+			err: "validation failed",
+		},
 	}
 
 	for _, tc := range cases {
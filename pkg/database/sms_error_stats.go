@@ -41,6 +41,17 @@ type SMSErrorStat struct {
 	Quantity  uint      `gorm:"column:quantity; type:int;"`
 }
 
+// SMSFailoverErrorCodePrefix is the prefix for error codes which record that a
+// message was delivered by a failover provider after the primary provider
+// failed.
+const SMSFailoverErrorCodePrefix = "failover:"
+
+// SMSFailoverErrorCode returns the error code used to record that a message
+// was delivered by the named failover provider.
+func SMSFailoverErrorCode(provider string) string {
+	return SMSFailoverErrorCodePrefix + provider
+}
+
 // InsertSMSErrorStat inserts a new SMS error stat for the given realm and error
 // code.
 func (db *Database) InsertSMSErrorStat(realmID uint, errorCode string) error {
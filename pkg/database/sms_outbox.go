@@ -0,0 +1,450 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/jinzhu/gorm"
+)
+
+// SMSOutboxKind is the purpose of a message in the SMS outbox.
+type SMSOutboxKind string
+
+const (
+	// SMSOutboxKindCode is the message which delivers a newly-issued code.
+	SMSOutboxKindCode SMSOutboxKind = "code"
+
+	// SMSOutboxKindReminder is a reminder which is sent if the code is still
+	// unclaimed shortly before it expires.
+	SMSOutboxKindReminder SMSOutboxKind = "reminder"
+)
+
+// SMSDeliveryStatus is the delivery state of a message in the SMS outbox.
+type SMSDeliveryStatus string
+
+const (
+	// SMSDeliveryStatusQueued indicates the message is waiting to be sent, or is
+	// waiting to be retried after a transient failure.
+	SMSDeliveryStatusQueued SMSDeliveryStatus = "queued"
+
+	// SMSDeliveryStatusSent indicates the message was accepted by the SMS
+	// provider.
+	SMSDeliveryStatusSent SMSDeliveryStatus = "sent"
+
+	// SMSDeliveryStatusFailed indicates the message could not be sent and will
+	// not be retried.
+	SMSDeliveryStatusFailed SMSDeliveryStatus = "failed"
+
+	// SMSDeliveryStatusDelivered indicates the carrier reported that the
+	// message was delivered to the handset. It is only set by delivery status
+	// callbacks.
+	SMSDeliveryStatusDelivered SMSDeliveryStatus = "delivered"
+
+	// SMSDeliveryStatusUndelivered indicates the carrier reported that the
+	// message could not be delivered to the handset. It is only set by delivery
+	// status callbacks.
+	SMSDeliveryStatusUndelivered SMSDeliveryStatus = "undelivered"
+
+	// SMSDeliveryStatusCanceled indicates the message was not sent because it
+	// was no longer needed. It is only used for reminders, which are canceled
+	// when the code is claimed or expired.
+	SMSDeliveryStatusCanceled SMSDeliveryStatus = "canceled"
+)
+
+// IsFinal returns true if the carrier will not report any further changes to
+// the delivery status.
+func (s SMSDeliveryStatus) IsFinal() bool {
+	return s == SMSDeliveryStatusDelivered || s == SMSDeliveryStatusUndelivered
+}
+
+// progress orders carrier statuses so that delivery status callbacks, which
+// may arrive out of order, never move a code's status backwards.
+func (s SMSDeliveryStatus) progress() int {
+	switch s {
+	case SMSDeliveryStatusQueued:
+		return 1
+	case SMSDeliveryStatusSent:
+		return 2
+	case SMSDeliveryStatusDelivered, SMSDeliveryStatusUndelivered:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// SMSOutboxMessage is an SMS message that is waiting to be delivered by the
+// outbox worker. The phone number and message body are encrypted at rest and
+// are cleared once the message reaches a terminal state.
+type SMSOutboxMessage struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// RealmID is the realm whose SMS provider sends the message.
+	RealmID uint
+
+	// VerificationCodeID is the verification code contained in the message. The
+	// outbox message is deleted when the verification code is deleted.
+	VerificationCodeID uint
+
+	// Kind is the purpose of the message. Each verification code has at most one
+	// message of each kind.
+	Kind SMSOutboxKind `gorm:"column:kind; type:text;"`
+
+	// PhoneNumber is the recipient. It is encrypted/decrypted automatically by
+	// callbacks. The cache fields exist as optimizations.
+	PhoneNumber                string `gorm:"column:phone_number; type:text;" json:"-"` // ignored by zap's JSON formatter
+	PhoneNumberPlaintextCache  string `gorm:"-"`
+	PhoneNumberCiphertextCache string `gorm:"-"`
+
+	// Message is the compiled (and possibly signed) message body. It is
+	// encrypted/decrypted automatically by callbacks. The cache fields exist as
+	// optimizations.
+	Message                string `gorm:"column:message; type:text;" json:"-"` // ignored by zap's JSON formatter
+	MessagePlaintextCache  string `gorm:"-"`
+	MessageCiphertextCache string `gorm:"-"`
+
+	// Status is the current delivery state.
+	Status SMSDeliveryStatus `gorm:"column:status; type:text;"`
+
+	// Attempts is the number of times delivery has been attempted.
+	Attempts uint `gorm:"column:attempts; type:integer;"`
+
+	// NextAttemptAt is the earliest time at which the worker will attempt
+	// delivery. While a worker holds the message, this is pushed into the future
+	// so other workers do not claim it.
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at;"`
+
+	// ExpiresAt is the time after which the message is no longer useful,
+	// because the code it contains has expired.
+	ExpiresAt time.Time `gorm:"column:expires_at;"`
+
+	// LastError is the error from the most recent failed attempt. It is scrubbed
+	// of phone numbers before being saved.
+	LastError string `gorm:"column:last_error; type:text;"`
+
+	// SentAt is the time the provider accepted the message.
+	SentAt *time.Time `gorm:"column:sent_at;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (m *SMSOutboxMessage) BeforeSave(tx *gorm.DB) error {
+	if m.RealmID == 0 {
+		m.AddError("realmID", "cannot be blank")
+	}
+	if m.VerificationCodeID == 0 {
+		m.AddError("verificationCodeID", "cannot be blank")
+	}
+
+	if m.Kind == "" {
+		m.Kind = SMSOutboxKindCode
+	}
+	switch m.Kind {
+	case SMSOutboxKindCode, SMSOutboxKindReminder:
+	default:
+		m.AddError("kind", fmt.Sprintf("unknown kind %q", m.Kind))
+	}
+
+	if m.Status == "" {
+		m.Status = SMSDeliveryStatusQueued
+	}
+
+	switch m.Status {
+	case SMSDeliveryStatusQueued:
+		if m.PhoneNumber == "" {
+			m.AddError("phoneNumber", "cannot be blank")
+		}
+		if m.Message == "" {
+			m.AddError("message", "cannot be blank")
+		}
+	case SMSDeliveryStatusSent, SMSDeliveryStatusFailed:
+	case SMSDeliveryStatusCanceled:
+		if m.Kind != SMSOutboxKindReminder {
+			m.AddError("status", "only reminders can be canceled")
+		}
+	default:
+		m.AddError("status", fmt.Sprintf("unknown status %q", m.Status))
+	}
+
+	return m.ErrorOrNil()
+}
+
+// IsExpired returns true if the message is past its expiration time.
+func (m *SMSOutboxMessage) IsExpired() bool {
+	return !m.ExpiresAt.IsZero() && m.ExpiresAt.Before(time.Now())
+}
+
+// MarkSent records that the message was accepted by the provider. The phone
+// number and message body are no longer needed and are cleared.
+func (m *SMSOutboxMessage) MarkSent() {
+	now := time.Now().UTC()
+	m.Status = SMSDeliveryStatusSent
+	m.SentAt = &now
+	m.LastError = ""
+	m.clearContents()
+}
+
+// MarkFailed records that the message will not be delivered. The phone number
+// and message body are no longer needed and are cleared.
+func (m *SMSOutboxMessage) MarkFailed(reason string) {
+	m.Status = SMSDeliveryStatusFailed
+	m.LastError = reason
+	m.clearContents()
+}
+
+// IsReminder returns true if the message is a reminder for an unclaimed code.
+func (m *SMSOutboxMessage) IsReminder() bool {
+	return m.Kind == SMSOutboxKindReminder
+}
+
+// MarkCanceled records that the message is no longer needed. The phone number
+// and message body are cleared.
+func (m *SMSOutboxMessage) MarkCanceled(reason string) {
+	m.Status = SMSDeliveryStatusCanceled
+	m.LastError = reason
+	m.clearContents()
+}
+
+// MarkRetry schedules the message for another delivery attempt after the
+// given delay.
+func (m *SMSOutboxMessage) MarkRetry(reason string, delay time.Duration) {
+	m.Status = SMSDeliveryStatusQueued
+	m.LastError = reason
+	m.NextAttemptAt = time.Now().UTC().Add(delay)
+}
+
+func (m *SMSOutboxMessage) clearContents() {
+	m.PhoneNumber = ""
+	m.PhoneNumberPlaintextCache = ""
+	m.PhoneNumberCiphertextCache = ""
+	m.Message = ""
+	m.MessagePlaintextCache = ""
+	m.MessageCiphertextCache = ""
+}
+
+// SaveSMSOutboxMessage creates or updates the outbox message.
+func (db *Database) SaveSMSOutboxMessage(m *SMSOutboxMessage) error {
+	if m.NextAttemptAt.IsZero() {
+		m.NextAttemptAt = time.Now().UTC()
+	}
+	return db.db.Save(m).Error
+}
+
+// SMSDeliveryStatusForCode returns the delivery status of the outbox message
+// for the given verification code. It does not load the encrypted columns.
+func (db *Database) SMSDeliveryStatusForCode(verificationCodeID uint) (SMSDeliveryStatus, error) {
+	var m SMSOutboxMessage
+	if err := db.db.
+		Model(&SMSOutboxMessage{}).
+		Select("id, status").
+		Where("verification_code_id = ? AND kind = ?", verificationCodeID, SMSOutboxKindCode).
+		First(&m).
+		Error; err != nil {
+		return "", err
+	}
+	return m.Status, nil
+}
+
+// FindSMSOutboxMessage finds the outbox message by its ID.
+func (db *Database) FindSMSOutboxMessage(id interface{}) (*SMSOutboxMessage, error) {
+	var m SMSOutboxMessage
+	if err := db.db.
+		Model(&SMSOutboxMessage{}).
+		Where("id = ?", id).
+		First(&m).
+		Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ClaimSMSOutboxMessages claims up to limit queued messages which are due for
+// delivery. Claiming increments each message's attempt count and pushes its
+// next attempt time out by the lease duration, so concurrent workers never
+// claim the same message, and a message held by a worker that crashes is
+// retried once the lease expires.
+func (db *Database) ClaimSMSOutboxMessages(limit uint, lease time.Duration) ([]*SMSOutboxMessage, error) {
+	now := time.Now().UTC()
+
+	sql := `
+		UPDATE sms_outbox_messages
+		SET
+			attempts = attempts + 1,
+			next_attempt_at = $1,
+			updated_at = $2
+		WHERE id IN (
+			SELECT id FROM sms_outbox_messages
+			WHERE status = $3 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`
+
+	rows, err := db.db.Raw(sql, now.Add(lease), now, SMSDeliveryStatusQueued, limit).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim sms outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]uint, 0, limit)
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan sms outbox message id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim sms outbox messages: %w", err)
+	}
+
+	// Load each message individually, since the encrypted columns are only
+	// decrypted when querying a single record.
+	messages := make([]*SMSOutboxMessage, 0, len(ids))
+	for _, id := range ids {
+		m, err := db.FindSMSOutboxMessage(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sms outbox message %d: %w", id, err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// QueueSMSReminder saves the reminder to the outbox and records on the
+// verification code that a reminder is queued.
+func (db *Database) QueueSMSReminder(m *SMSOutboxMessage) error {
+	if m.Kind != SMSOutboxKindReminder {
+		return fmt.Errorf("message is not a reminder")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(m).Error; err != nil {
+			return err
+		}
+
+		if err := tx.
+			Model(&VerificationCode{}).
+			Where("id = ?", m.VerificationCodeID).
+			UpdateColumn("sms_reminder_status", SMSDeliveryStatusQueued).
+			Error; err != nil {
+			return fmt.Errorf("failed to update sms reminder status: %w", err)
+		}
+		return nil
+	})
+}
+
+// SaveSMSReminder saves the reminder and copies its status onto the
+// verification code. The first time a reminder is sent, the realm's reminder
+// stats are incremented.
+func (db *Database) SaveSMSReminder(m *SMSOutboxMessage) error {
+	if m.Kind != SMSOutboxKindReminder {
+		return fmt.Errorf("message is not a reminder")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(m).Error; err != nil {
+			return err
+		}
+
+		result := tx.
+			Model(&VerificationCode{}).
+			Where("id = ? AND sms_reminder_status = ?", m.VerificationCodeID, SMSDeliveryStatusQueued).
+			UpdateColumn("sms_reminder_status", m.Status)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to update sms reminder status: %w", err)
+		}
+
+		if m.Status != SMSDeliveryStatusSent || result.RowsAffected == 0 {
+			return nil
+		}
+
+		sql := `
+			INSERT INTO realm_stats(date, realm_id, sms_reminders_sent)
+				VALUES ($1, $2, 1)
+			ON CONFLICT (date, realm_id) DO UPDATE
+				SET sms_reminders_sent = realm_stats.sms_reminders_sent + 1`
+		t := timeutils.UTCMidnight(time.Now())
+		if err := tx.Exec(sql, t, m.RealmID).Error; err != nil {
+			return fmt.Errorf("failed to update realm stats: %w", err)
+		}
+		return nil
+	})
+}
+
+// IsSMSReminderDue returns true if the verification code still exists, is not
+// claimed, and has not expired, meaning a reminder is still useful.
+func (db *Database) IsSMSReminderDue(verificationCodeID uint) (bool, error) {
+	var count int
+	if err := db.db.
+		Model(&VerificationCode{}).
+		Where("id = ? AND claimed = ? AND long_expires_at > ?", verificationCodeID, false, time.Now().UTC()).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// settleSMSReminder is called inside the transaction which claims or expires
+// the verification code. A queued reminder is canceled and its phone number
+// and message are cleared. If a reminder was already sent and the code is
+// being claimed, the realm's stats are incremented.
+func settleSMSReminder(tx *gorm.DB, vc *VerificationCode, claimed bool) error {
+	switch vc.SMSReminderStatus {
+	case SMSDeliveryStatusQueued:
+		if err := tx.Exec(`
+			UPDATE sms_outbox_messages
+			SET status = $1, phone_number = '', message = '', last_error = $2, updated_at = $3
+			WHERE verification_code_id = $4 AND kind = $5 AND status = $6`,
+			SMSDeliveryStatusCanceled, "code was claimed or expired before the reminder was sent", time.Now().UTC(),
+			vc.ID, SMSOutboxKindReminder, SMSDeliveryStatusQueued).
+			Error; err != nil {
+			return fmt.Errorf("failed to cancel sms reminder: %w", err)
+		}
+
+		vc.SMSReminderStatus = SMSDeliveryStatusCanceled
+		if err := tx.
+			Model(&VerificationCode{}).
+			Where("id = ?", vc.ID).
+			UpdateColumn("sms_reminder_status", vc.SMSReminderStatus).
+			Error; err != nil {
+			return fmt.Errorf("failed to update sms reminder status: %w", err)
+		}
+	case SMSDeliveryStatusSent:
+		if !claimed {
+			return nil
+		}
+
+		sql := `
+			INSERT INTO realm_stats(date, realm_id, codes_claimed_after_reminder)
+				VALUES ($1, $2, 1)
+			ON CONFLICT (date, realm_id) DO UPDATE
+				SET codes_claimed_after_reminder = realm_stats.codes_claimed_after_reminder + 1`
+		t := timeutils.UTCMidnight(time.Now())
+		if err := tx.Exec(sql, t, vc.RealmID).Error; err != nil {
+			return fmt.Errorf("failed to update realm stats: %w", err)
+		}
+	}
+	return nil
+}
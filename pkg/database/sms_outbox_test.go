@@ -0,0 +1,341 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSMSOutboxMessage_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		message *SMSOutboxMessage
+		errKeys []string
+	}{
+		{
+			name: "valid",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				PhoneNumber:        "+12065551234",
+				Message:            "your code is 123456",
+			},
+		},
+		{
+			name:    "missing_fields",
+			message: &SMSOutboxMessage{},
+			errKeys: []string{"realmID", "verificationCodeID", "phoneNumber", "message"},
+		},
+		{
+			name: "sent_without_contents",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				Status:             SMSDeliveryStatusSent,
+			},
+		},
+		{
+			name: "unknown_status",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				Status:             "bananas",
+			},
+			errKeys: []string{"status"},
+		},
+		{
+			name: "unknown_kind",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				Kind:               "bananas",
+				Status:             SMSDeliveryStatusSent,
+			},
+			errKeys: []string{"kind"},
+		},
+		{
+			name: "canceled_reminder",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				Kind:               SMSOutboxKindReminder,
+				Status:             SMSDeliveryStatusCanceled,
+			},
+		},
+		{
+			name: "canceled_code",
+			message: &SMSOutboxMessage{
+				RealmID:            1,
+				VerificationCodeID: 1,
+				Status:             SMSDeliveryStatusCanceled,
+			},
+			errKeys: []string{"status"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.message.BeforeSave(nil)
+			for _, k := range tc.errKeys {
+				if len(tc.message.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+			if len(tc.errKeys) == 0 {
+				if msgs := tc.message.ErrorMessages(); len(msgs) > 0 {
+					t.Errorf("expected no errors, got %q", msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestSMSOutboxMessage_MarkSent(t *testing.T) {
+	t.Parallel()
+
+	m := &SMSOutboxMessage{
+		PhoneNumber:               "+12065551234",
+		PhoneNumberPlaintextCache: "+12065551234",
+		Message:                   "your code is 123456",
+		MessagePlaintextCache:     "your code is 123456",
+		LastError:                 "oops",
+	}
+	m.MarkSent()
+
+	if got, want := m.Status, SMSDeliveryStatusSent; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if m.SentAt == nil {
+		t.Errorf("expected sent at to be set")
+	}
+	if m.LastError != "" {
+		t.Errorf("expected last error to be cleared")
+	}
+	if m.PhoneNumber != "" || m.PhoneNumberPlaintextCache != "" || m.Message != "" || m.MessagePlaintextCache != "" {
+		t.Errorf("expected contents to be cleared: %#v", m)
+	}
+}
+
+func TestDatabase_ClaimSMSOutboxMessages(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vc := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "12345678",
+		LongCode:      "abcdefgh12345678",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(2 * time.Hour),
+	}
+	if err := db.SaveVerificationCode(vc, realm); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &SMSOutboxMessage{
+		RealmID:            realm.ID,
+		VerificationCodeID: vc.ID,
+		PhoneNumber:        "+12065551234",
+		Message:            "your code is 12345678",
+		ExpiresAt:          vc.LongExpiresAt,
+	}
+	if err := db.SaveSMSOutboxMessage(m); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := db.SMSDeliveryStatusForCode(vc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := status, SMSDeliveryStatusQueued; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// First claim gets the message, decrypted.
+	claimed, err := db.ClaimSMSOutboxMessages(10, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(claimed), 1; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := claimed[0].PhoneNumber, "+12065551234"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := claimed[0].Message, "your code is 12345678"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := claimed[0].Attempts, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Second claim is empty, since the message is leased.
+	claimed2, err := db.ClaimSMSOutboxMessages(10, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(claimed2), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Once sent, the contents are cleared.
+	claimed[0].MarkSent()
+	if err := db.SaveSMSOutboxMessage(claimed[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindSMSOutboxMessage(claimed[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PhoneNumber != "" || got.Message != "" {
+		t.Errorf("expected contents to be cleared")
+	}
+
+	status, err = db.SMSDeliveryStatusForCode(vc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := status, SMSDeliveryStatusSent; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestDatabase_SMSReminders(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCode := func(t *testing.T, code string) *VerificationCode {
+		t.Helper()
+
+		vc := &VerificationCode{
+			RealmID:       realm.ID,
+			Code:          code,
+			LongCode:      code + "abcdefgh",
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+		if err := db.SaveVerificationCode(vc, realm); err != nil {
+			t.Fatal(err)
+		}
+
+		m := &SMSOutboxMessage{
+			RealmID:            realm.ID,
+			VerificationCodeID: vc.ID,
+			Kind:               SMSOutboxKindReminder,
+			PhoneNumber:        "+12065551234",
+			Message:            "reminder: " + code,
+			NextAttemptAt:      time.Now().Add(-time.Minute),
+			ExpiresAt:          vc.LongExpiresAt,
+		}
+		if err := db.QueueSMSReminder(m); err != nil {
+			t.Fatal(err)
+		}
+		return vc
+	}
+
+	t.Run("sent", func(t *testing.T) {
+		t.Parallel()
+
+		vc := newCode(t, "11111111")
+
+		due, err := db.IsSMSReminderDue(vc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !due {
+			t.Errorf("expected reminder to be due")
+		}
+
+		var m SMSOutboxMessage
+		if err := db.db.Where("verification_code_id = ? AND kind = ?", vc.ID, SMSOutboxKindReminder).First(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+		m.MarkSent()
+		if err := db.SaveSMSReminder(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := realm.FindVerificationCodeByUUID(db, vc.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := got.SMSReminderStatus, SMSDeliveryStatusSent; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		// The original message is unaffected.
+		if _, err := db.SMSDeliveryStatusForCode(vc.ID); !IsNotFound(err) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		vc := newCode(t, "22222222")
+
+		if _, err := db.ExpireCode(vc.UUID); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := realm.FindVerificationCodeByUUID(db, vc.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := got.SMSReminderStatus, SMSDeliveryStatusCanceled; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+
+		var m SMSOutboxMessage
+		if err := db.db.Where("verification_code_id = ? AND kind = ?", vc.ID, SMSOutboxKindReminder).First(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got, want := m.Status, SMSDeliveryStatusCanceled; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if m.PhoneNumber != "" || m.Message != "" {
+			t.Errorf("expected contents to be cleared")
+		}
+
+		due, err := db.IsSMSReminderDue(vc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if due {
+			t.Errorf("expected reminder to not be due")
+		}
+	})
+}
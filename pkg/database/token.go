@@ -289,6 +289,14 @@ func (db *Database) VerifyCodeAndIssueToken(request *IssueTokenRequest) (*Token,
 			return fmt.Errorf("failed to claim verification code: %w", err)
 		}
 
+		if err := enqueueCodeEvent(tx, &vc, CodeEventClaimed, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		if err := settleSMSReminder(tx, &vc, true); err != nil {
+			return err
+		}
+
 		buffer := make([]byte, tokenBytes)
 		if _, err := rand.Read(buffer); err != nil {
 			return fmt.Errorf("failed to create token: %w", err)
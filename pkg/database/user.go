@@ -130,6 +130,7 @@ func (u *User) ListMemberships(db *Database) ([]*Membership, error) {
 		Preload("User").
 		Model(&Membership{}).
 		Where("user_id = ?", u.ID).
+		Where("memberships.expires_at IS NULL OR memberships.expires_at > ?", time.Now().UTC()).
 		Joins("JOIN realms ON realms.id = memberships.realm_id").
 		Order("realms.name").
 		Find(&memberships).
@@ -143,6 +144,7 @@ func (u *User) ListMemberships(db *Database) ([]*Membership, error) {
 }
 
 // SelectFirstMembership selects the first memberships for this user.
+// Expired memberships are ignored.
 func (u *User) SelectFirstMembership(db *Database) (*Membership, error) {
 	var membership Membership
 	if err := db.db.
@@ -150,6 +152,7 @@ func (u *User) SelectFirstMembership(db *Database) (*Membership, error) {
 		Preload("User").
 		Model(&Membership{}).
 		Where("user_id = ?", u.ID).
+		Where("memberships.expires_at IS NULL OR memberships.expires_at > ?", time.Now().UTC()).
 		First(&membership).
 		Error; err != nil {
 		return nil, err
@@ -165,6 +168,7 @@ func (u *User) FindMembership(db *Database, realmID interface{}) (*Membership, e
 	if err := db.db.
 		Model(&Membership{}).
 		Preload("Realm").
+		Preload("Role").
 		Preload("User").
 		Where("user_id = ? AND realm_id = ?", u.ID, realmID).
 		First(&membership).
@@ -174,14 +178,52 @@ func (u *User) FindMembership(db *Database, realmID interface{}) (*Membership, e
 	return &membership, nil
 }
 
+// HasOtherMemberships returns true if the user is a member of any realm other
+// than the given realm, including through an expired membership.
+func (u *User) HasOtherMemberships(db *Database, realmID uint) (bool, error) {
+	var count int
+	if err := db.db.
+		Table("memberships").
+		Where("user_id = ? AND realm_id != ?", u.ID, realmID).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // AddToRealm adds the current user to the realm with the given permissions. If
 // a record already exists, the permissions are overwritten with the new
-// permissions.
+// permissions and the membership is removed from its role, if any.
 func (u *User) AddToRealm(db *Database, r *Realm, permissions rbac.Permission, actor Auditable) error {
+	return u.addToRealm(db, r, permissions, nil, actor)
+}
+
+// AddToRealmWithRole adds the current user to the realm with the given role.
+// The membership's permissions are the role's permissions, and they are
+// updated whenever the role is updated. If a record already exists, it is
+// overwritten.
+func (u *User) AddToRealmWithRole(db *Database, r *Realm, role *Role, actor Auditable) error {
+	if role == nil {
+		return fmt.Errorf("role cannot be nil")
+	}
+	if role.RealmID != r.ID {
+		return fmt.Errorf("role %d does not belong to realm %d", role.ID, r.ID)
+	}
+	return u.addToRealm(db, r, role.Permissions, role, actor)
+}
+
+func (u *User) addToRealm(db *Database, r *Realm, permissions rbac.Permission, role *Role, actor Auditable) error {
 	if actor == nil {
 		return fmt.Errorf("auditable actor cannot be nil")
 	}
 
+	var roleID *uint
+	if role != nil {
+		id := role.ID
+		roleID = &id
+	}
+
 	return db.db.Transaction(func(tx *gorm.DB) error {
 		var existing Membership
 		if err := tx.
@@ -196,6 +238,7 @@ func (u *User) AddToRealm(db *Database, r *Realm, permissions rbac.Permission, a
 
 		conflict := `ON CONFLICT (user_id, realm_id) DO UPDATE SET
 			permissions = EXCLUDED.permissions,
+			role_id = EXCLUDED.role_id,
 			created_at = EXCLUDED.created_at,
 			updated_at = EXCLUDED.updated_at`
 		if err := tx.
@@ -205,6 +248,7 @@ func (u *User) AddToRealm(db *Database, r *Realm, permissions rbac.Permission, a
 				UserID:      u.ID,
 				RealmID:     r.ID,
 				Permissions: permissions,
+				RoleID:      roleID,
 			}).
 			Error; err != nil {
 			return err
@@ -227,6 +271,31 @@ func (u *User) AddToRealm(db *Database, r *Realm, permissions rbac.Permission, a
 			}
 		}
 
+		// Audit if the role was changed.
+		if then, now := existing.RoleID, roleID; uintValue(then) != uintValue(now) {
+			var thenName, nowName string
+			if then != nil {
+				var previous Role
+				if err := tx.
+					Model(&Role{}).
+					Where("id = ?", *then).
+					First(&previous).
+					Error; err != nil && !IsNotFound(err) {
+					return fmt.Errorf("failed to get previous role: %w", err)
+				}
+				thenName = previous.Name
+			}
+			if role != nil {
+				nowName = role.Name
+			}
+
+			audit := BuildAuditEntry(actor, "updated user role", u, r.ID)
+			audit.Diff = stringDiff(thenName, nowName)
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audit: %w", err)
+			}
+		}
+
 		// Cascade updated_at on user
 		if err := tx.
 			Model(&User{}).
@@ -0,0 +1,343 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrInvalidUserToken is returned when an account token does not exist, has
+// expired, or was already used.
+var ErrInvalidUserToken = errors.New("invalid, expired, or already used token")
+
+// userTokenBytes is the entropy of each account token (256 bits).
+const userTokenBytes = 32
+
+// UserTokenPurpose is the action an account token authorizes.
+type UserTokenPurpose string
+
+const (
+	UserTokenPurposePasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenPurposeEmailVerification UserTokenPurpose = "email_verification"
+)
+
+// UserCredential is the password credential and sign-in state of a user. The
+// columns live on the users table, but they are deliberately not part of User
+// so that saving or caching a user never exposes or overwrites them.
+type UserCredential struct {
+	UserID uint
+	Email  string
+
+	// PasswordHash is the encoded password hash. It is empty if the user never
+	// selected a password.
+	PasswordHash string
+
+	// EmailVerified is true once the user proved ownership of the email address.
+	EmailVerified bool
+
+	// FailedLoginAttempts is the number of consecutive failed sign-in attempts
+	// since the last successful sign-in or lockout.
+	FailedLoginAttempts uint
+
+	// LockedUntil is the time until which sign-in is refused.
+	LockedUntil *time.Time
+
+	// SessionsRevokedAt is the time at which all existing sessions were revoked.
+	// Sessions created before this time are no longer valid.
+	SessionsRevokedAt *time.Time
+}
+
+// Locked returns true if sign-in is refused at the given time.
+func (c *UserCredential) Locked(now time.Time) bool {
+	return c.LockedUntil != nil && now.Before(*c.LockedUntil)
+}
+
+// SessionRevoked returns true if a session created at the given time was
+// revoked.
+func (c *UserCredential) SessionRevoked(createdAt time.Time) bool {
+	return c.SessionsRevokedAt != nil && createdAt.Before(*c.SessionsRevokedAt)
+}
+
+// FindUserCredential finds the credential of the user with the given id. It
+// returns an error if the user does not exist.
+func (db *Database) FindUserCredential(id interface{}) (*UserCredential, error) {
+	return db.findUserCredential("id = ?", id)
+}
+
+// FindUserCredentialByEmail finds the credential of the user with the given
+// email address. It returns an error if the user does not exist.
+func (db *Database) FindUserCredentialByEmail(email string) (*UserCredential, error) {
+	return db.findUserCredential("email = ?", project.TrimSpace(email))
+}
+
+func (db *Database) findUserCredential(query string, args ...interface{}) (*UserCredential, error) {
+	var credential UserCredential
+	if err := db.db.
+		Table("users").
+		Select("id AS user_id, email, password_hash, email_verified, failed_login_attempts, locked_until, sessions_revoked_at").
+		Where("deleted_at IS NULL").
+		Where(query, args...).
+		Scan(&credential).
+		Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// SetUserPassword saves the password hash for the user. It also clears any
+// lockout and revokes all existing sessions as of now, so now should be used
+// as the creation time of any session issued afterwards.
+func (db *Database) SetUserPassword(u *User, hash string, now time.Time) error {
+	if hash == "" {
+		return fmt.Errorf("password hash cannot be blank")
+	}
+
+	now = now.UTC()
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&User{}).
+			Where("id = ?", u.ID).
+			UpdateColumns(map[string]interface{}{
+				"password_hash":         hash,
+				"last_password_change":  now,
+				"failed_login_attempts": 0,
+				"locked_until":          nil,
+				"sessions_revoked_at":   now,
+			}).
+			Error; err != nil {
+			return fmt.Errorf("failed to save password: %w", err)
+		}
+
+		audit := BuildAuditEntry(u, "changed password", u, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// RecordFailedLogin counts a failed sign-in attempt for the user. Once
+// maxAttempts consecutive attempts failed, the account is locked for the
+// lockout duration and the count starts over. If maxAttempts is 0, accounts
+// are never locked. It returns the time until which the account is locked, if
+// it is locked.
+func (db *Database) RecordFailedLogin(userID uint, maxAttempts uint, lockout time.Duration, now time.Time) (*time.Time, error) {
+	if maxAttempts == 0 {
+		return nil, nil
+	}
+
+	var result struct {
+		LockedUntil *time.Time
+	}
+	if err := db.db.
+		Raw(`UPDATE users SET
+			failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= ? THEN 0 ELSE failed_login_attempts + 1 END,
+			locked_until = CASE WHEN failed_login_attempts + 1 >= ? THEN ? ELSE locked_until END
+			WHERE id = ?
+			RETURNING locked_until`,
+			maxAttempts, maxAttempts, now.Add(lockout).UTC(), userID).
+		Scan(&result).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	if result.LockedUntil == nil || !now.Before(*result.LockedUntil) {
+		return nil, nil
+	}
+	return result.LockedUntil, nil
+}
+
+// RecordSuccessfulLogin resets the failed sign-in attempts of the user.
+func (db *Database) RecordSuccessfulLogin(userID uint) error {
+	if err := db.db.
+		Model(&User{}).
+		Where("id = ? AND failed_login_attempts > 0", userID).
+		UpdateColumn("failed_login_attempts", 0).
+		Error; err != nil {
+		return fmt.Errorf("failed to record successful login: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all sessions of the user which were created
+// before now.
+func (db *Database) RevokeUserSessions(userID uint, now time.Time) error {
+	if err := db.db.
+		Model(&User{}).
+		Where("id = ?", userID).
+		UpdateColumn("sessions_revoked_at", now.UTC()).
+		Error; err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// MarkUserEmailVerified records that the user proved ownership of their email
+// address.
+func (db *Database) MarkUserEmailVerified(u *User) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&User{}).
+			Where("id = ?", u.ID).
+			UpdateColumn("email_verified", true).
+			Error; err != nil {
+			return fmt.Errorf("failed to mark email verified: %w", err)
+		}
+
+		audit := BuildAuditEntry(u, "verified email address", u, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// UserToken is a single-use token which authorizes an account action, such as
+// a password reset, for a user who is not signed in. Only a hash of the token
+// is stored.
+type UserToken struct {
+	ID     uint
+	UserID uint
+	User   *User
+
+	Purpose UserTokenPurpose `gorm:"column:purpose; type:text;"`
+
+	// TokenHash is the hex-encoded SHA-256 hash of the token. Tokens are random,
+	// so a fast hash is sufficient.
+	TokenHash string `gorm:"column:token_hash; type:text;"`
+
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// CreateUserToken creates a new token for the given purpose which expires
+// after ttl, and returns it. The token cannot be retrieved again.
+func (db *Database) CreateUserToken(u *User, purpose UserTokenPurpose, ttl time.Duration) (string, error) {
+	b := make([]byte, userTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := db.db.Create(&UserToken{
+		UserID:    u.ID,
+		Purpose:   purpose,
+		TokenHash: hashUserToken(token),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}).Error; err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+	return token, nil
+}
+
+// FindUserByToken returns the user to which the unused, unexpired token
+// belongs, without using the token. If the token is not valid for the purpose,
+// it returns ErrInvalidUserToken.
+func (db *Database) FindUserByToken(purpose UserTokenPurpose, token string) (*User, error) {
+	var userToken UserToken
+	if err := db.db.
+		Preload("User").
+		Where("purpose = ? AND token_hash = ?", purpose, hashUserToken(token)).
+		Where("used_at IS NULL AND expires_at > ?", time.Now().UTC()).
+		First(&userToken).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, fmt.Errorf("failed to find token: %w", err)
+	}
+
+	if userToken.User == nil || userToken.User.DeletedAt != nil {
+		return nil, ErrInvalidUserToken
+	}
+	return userToken.User, nil
+}
+
+// UseUserToken marks the token as used and returns the user to which it
+// belongs. All other outstanding tokens of the user for the same purpose are
+// invalidated too. If the token is not valid for the purpose, it returns
+// ErrInvalidUserToken.
+func (db *Database) UseUserToken(purpose UserTokenPurpose, token string) (*User, error) {
+	var user *User
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		var userToken UserToken
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("purpose = ? AND token_hash = ?", purpose, hashUserToken(token)).
+			Where("used_at IS NULL AND expires_at > ?", now).
+			First(&userToken).
+			Error; err != nil {
+			if IsNotFound(err) {
+				return ErrInvalidUserToken
+			}
+			return fmt.Errorf("failed to find token: %w", err)
+		}
+
+		if err := tx.
+			Model(&UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userToken.UserID, purpose).
+			UpdateColumn("used_at", now).
+			Error; err != nil {
+			return fmt.Errorf("failed to use token: %w", err)
+		}
+
+		var u User
+		if err := tx.
+			Where("id = ?", userToken.UserID).
+			First(&u).
+			Error; err != nil {
+			if IsNotFound(err) {
+				return ErrInvalidUserToken
+			}
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+		user = &u
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeUserTokens deletes account tokens which expired more than maxAge ago.
+func (db *Database) PurgeUserTokens(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	expiredBefore := time.Now().UTC().Add(maxAge)
+
+	result := db.db.
+		Where("expires_at < ?", expiredBefore).
+		Delete(&UserToken{})
+	return result.RowsAffected, result.Error
+}
+
+// hashUserToken hashes the account token.
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserCredential_Locked(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	future := now.Add(time.Minute)
+	past := now.Add(-time.Minute)
+
+	cases := []struct {
+		name       string
+		credential *UserCredential
+		exp        bool
+	}{
+		{"never_locked", &UserCredential{}, false},
+		{"locked", &UserCredential{LockedUntil: &future}, true},
+		{"lock_expired", &UserCredential{LockedUntil: &past}, false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := tc.credential.Locked(now), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestDatabase_UserCredential(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "password@example.com", Name: "Password"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := db.FindUserCredentialByEmail(user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := credential.UserID, user.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if credential.PasswordHash != "" {
+		t.Errorf("expected no password hash")
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if err := db.SetUserPassword(user, "hash", now); err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err = db.FindUserCredential(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := credential.PasswordHash, "hash"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if !credential.SessionRevoked(now.Add(-time.Second)) {
+		t.Errorf("expected older sessions to be revoked")
+	}
+	if credential.SessionRevoked(now) {
+		t.Errorf("expected new sessions to be valid")
+	}
+
+	// Saving the user must not clear the password.
+	user.Name = "Updated"
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	credential, err = db.FindUserCredential(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := credential.PasswordHash, "hash"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	t.Run("lockout", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			lockedUntil, err := db.RecordFailedLogin(user.ID, 3, time.Minute, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lockedUntil != nil {
+				t.Fatalf("expected account to be unlocked after %d attempts", i+1)
+			}
+		}
+
+		lockedUntil, err := db.RecordFailedLogin(user.ID, 3, time.Minute, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lockedUntil == nil {
+			t.Fatal("expected account to be locked")
+		}
+
+		credential, err := db.FindUserCredential(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !credential.Locked(now) {
+			t.Errorf("expected account to be locked")
+		}
+		if credential.Locked(now.Add(2 * time.Minute)) {
+			t.Errorf("expected lock to expire")
+		}
+		if got, want := credential.FailedLoginAttempts, uint(0); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+
+	t.Run("email_verified", func(t *testing.T) {
+		if err := db.MarkUserEmailVerified(user); err != nil {
+			t.Fatal(err)
+		}
+
+		credential, err := db.FindUserCredential(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !credential.EmailVerified {
+			t.Errorf("expected email to be verified")
+		}
+	})
+}
+
+func TestDatabase_UserTokens(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "tokens@example.com", Name: "Tokens"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := db.CreateUserToken(user, UserTokenPurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUserToken(user, UserTokenPurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are bound to their purpose.
+	if _, err := db.FindUserByToken(UserTokenPurposeEmailVerification, token); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected %v to be %v", err, ErrInvalidUserToken)
+	}
+
+	found, err := db.FindUserByToken(UserTokenPurposePasswordReset, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found.ID, user.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	used, err := db.UseUserToken(UserTokenPurposePasswordReset, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := used.ID, user.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Tokens are single use, and using one invalidates the others.
+	for _, tok := range []string{token, other} {
+		if _, err := db.UseUserToken(UserTokenPurposePasswordReset, tok); !errors.Is(err, ErrInvalidUserToken) {
+			t.Errorf("expected %v to be %v", err, ErrInvalidUserToken)
+		}
+	}
+
+	expired, err := db.CreateUserToken(user, UserTokenPurposeEmailVerification, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UseUserToken(UserTokenPurposeEmailVerification, expired); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected %v to be %v", err, ErrInvalidUserToken)
+	}
+
+	count, err := db.PurgeUserTokens(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
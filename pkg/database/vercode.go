@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
@@ -35,8 +37,54 @@ const (
 
 	// MinCodeLength defines the minimum number of digits in a code.
 	MinCodeLength = 6
+
+	// ShortCodeAlphabet is the set of characters from which short codes are
+	// generated. DefaultLongCodeAlphabet is the set of characters from which
+	// long codes are generated, unless the realm configures another alphabet.
+	ShortCodeAlphabet       = "0123456789"
+	DefaultLongCodeAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	// CrockfordLongCodeAlphabet is Crockford's base32 alphabet. It omits the
+	// letters i, l, o, and u, which are easily confused when codes are read
+	// aloud.
+	CrockfordLongCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+	// MinLongCodeEntropyBits is the minimum number of random bits in a long
+	// code, given the realm's long code length and alphabet.
+	MinLongCodeEntropyBits = 48
 )
 
+// CodeEntropyBits returns the number of random bits in a code of the given
+// length whose characters are drawn from the alphabet. If checkDigit is true,
+// the last character of the code is a check digit and is not random.
+func CodeEntropyBits(length uint, alphabet string, checkDigit bool) float64 {
+	if checkDigit && length > 0 {
+		length--
+	}
+	return float64(length) * math.Log2(float64(len(alphabet)))
+}
+
+// validateCodeAlphabet returns an error if the alphabet cannot be used to
+// generate codes. Alphabets may only contain unique ASCII letters and digits,
+// so that codes are safe to put in links and separators can be removed.
+func validateCodeAlphabet(alphabet string) error {
+	if len(alphabet) < 10 {
+		return fmt.Errorf("must have at least 10 characters")
+	}
+
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') {
+			return fmt.Errorf("may only contain letters and digits, got %q", c)
+		}
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("contains %q more than once", c)
+		}
+		seen[c] = struct{}{}
+	}
+	return nil
+}
+
 type CodeType int
 
 const (
@@ -62,6 +110,29 @@ var (
 	ErrRequiresPhoneNumber = errors.New("phone number is required for user report requests")
 )
 
+// VerificationCodeStatus is the state of an issued verification code.
+type VerificationCodeStatus string
+
+const (
+	// VerificationCodeStatusActive is a code which has not been claimed and has
+	// not expired.
+	VerificationCodeStatusActive VerificationCodeStatus = "active"
+
+	// VerificationCodeStatusClaimed is a code which has been claimed.
+	VerificationCodeStatusClaimed VerificationCodeStatus = "claimed"
+
+	// VerificationCodeStatusExpired is a code which expired without being
+	// claimed, or which was expired by an issuer.
+	VerificationCodeStatusExpired VerificationCodeStatus = "expired"
+)
+
+// ValidVerificationCodeStatuses are the statuses codes can be searched by.
+var ValidVerificationCodeStatuses = []VerificationCodeStatus{
+	VerificationCodeStatusActive,
+	VerificationCodeStatusClaimed,
+	VerificationCodeStatusExpired,
+}
+
 // VerificationCode represents a verification code in the database.
 type VerificationCode struct {
 	gorm.Model
@@ -99,6 +170,20 @@ type VerificationCode struct {
 	// API AND the API caller supplied it in the request. This ID has no meaning
 	// in this system. It can be up to 255 characters in length.
 	IssuingExternalID string `gorm:"column:issuing_external_id; type:varchar(255);"`
+
+	// SMSDeliveryStatus is the most recent delivery status the carrier reported
+	// for the SMS containing this code. It is only populated if the realm's SMS
+	// provider sends delivery status callbacks.
+	SMSDeliveryStatus SMSDeliveryStatus `gorm:"column:sms_delivery_status; type:text;"`
+
+	// ExpiredEventQueued indicates that an expiration event has already been
+	// queued for the realm's webhook subscriptions, so it is not sent twice.
+	ExpiredEventQueued bool `gorm:"column:expired_event_queued; default:false;"`
+
+	// SMSReminderStatus is the status of the reminder SMS for this code. It is
+	// only populated if the realm had SMS reminders enabled when the code was
+	// issued.
+	SMSReminderStatus SMSDeliveryStatus `gorm:"column:sms_reminder_status; type:text;"`
 }
 
 // BeforeSave is used by callbacks.
@@ -163,6 +248,18 @@ func (v *VerificationCode) IsExpired() bool {
 	return v.ExpiresAt.Before(now) && v.LongExpiresAt.Before(now)
 }
 
+// Status returns the current status of the code.
+func (v *VerificationCode) Status() VerificationCodeStatus {
+	switch {
+	case v.Claimed:
+		return VerificationCodeStatusClaimed
+	case v.IsExpired():
+		return VerificationCodeStatusExpired
+	default:
+		return VerificationCodeStatusActive
+	}
+}
+
 func (v *VerificationCode) HasLongExpiration() bool {
 	return v.LongExpiresAt.After(v.ExpiresAt)
 }
@@ -256,7 +353,16 @@ func (db *Database) ExpireCode(uuid string) (*VerificationCode, error) {
 
 		vc.ExpiresAt = time.Now()
 		vc.LongExpiresAt = vc.ExpiresAt
-		return tx.Save(&vc).Error
+		vc.ExpiredEventQueued = true
+		if err := tx.Save(&vc).Error; err != nil {
+			return err
+		}
+
+		if err := settleSMSReminder(tx, &vc, false); err != nil {
+			return err
+		}
+
+		return enqueueCodeEvent(tx, &vc, CodeEventManuallyExpired, vc.ExpiresAt)
 	})
 	if err != nil {
 		return nil, err
@@ -264,6 +370,71 @@ func (db *Database) ExpireCode(uuid string) (*VerificationCode, error) {
 	return &vc, nil
 }
 
+// UpdateSMSDeliveryStatus records the carrier-reported delivery status for the
+// SMS containing the verification code with the given UUID in the realm.
+// Statuses that would move the code backwards (for example "sent" after
+// "delivered") are ignored, since carriers do not guarantee ordering. The
+// first time a code reaches a final status, the realm's delivered or
+// undelivered stats are incremented. It returns NotFound if the code does not
+// exist, which is common once codes are purged.
+func (db *Database) UpdateSMSDeliveryStatus(realmID uint, uuidStr string, status SMSDeliveryStatus) error {
+	if status.progress() == 0 {
+		return fmt.Errorf("unknown sms delivery status %q", status)
+	}
+
+	// Postgres returns an error if the provided input is not a valid UUID.
+	parsed, err := uuid.Parse(uuidStr)
+	if err != nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var vc VerificationCode
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Select("id, sms_delivery_status").
+			Where("uuid = ? AND realm_id = ?", parsed.String(), realmID).
+			First(&vc).Error; err != nil {
+			return err
+		}
+
+		if status.progress() <= vc.SMSDeliveryStatus.progress() {
+			return nil
+		}
+
+		if err := tx.
+			Model(&VerificationCode{}).
+			Where("id = ?", vc.ID).
+			UpdateColumn("sms_delivery_status", status).
+			Error; err != nil {
+			return fmt.Errorf("failed to update sms delivery status: %w", err)
+		}
+
+		if !status.IsFinal() {
+			return nil
+		}
+
+		delivered, undelivered := 0, 0
+		if status == SMSDeliveryStatusDelivered {
+			delivered = 1
+		} else {
+			undelivered = 1
+		}
+
+		sql := `
+			INSERT INTO realm_stats(date, realm_id, codes_delivered, codes_undelivered)
+				VALUES ($1, $2, $3, $4)
+			ON CONFLICT (date, realm_id) DO UPDATE
+				SET codes_delivered = realm_stats.codes_delivered + $3,
+				    codes_undelivered = realm_stats.codes_undelivered + $4`
+		t := timeutils.UTCMidnight(time.Now())
+		if err := tx.Exec(sql, t, realmID, delivered, undelivered).Error; err != nil {
+			return fmt.Errorf("failed to update realm stats: %w", err)
+		}
+		return nil
+	})
+}
+
 // SaveVerificationCode created or updates a verification code in the database.
 // Max age represents the maximum age of the test date [optional] in the record.
 func (db *Database) SaveVerificationCode(vc *VerificationCode, realm *Realm) error {
@@ -307,6 +478,20 @@ func (db *Database) SaveVerificationCode(vc *VerificationCode, realm *Realm) err
 	})
 }
 
+// VerificationCodeUUID returns the UUID of the verification code with the
+// given ID.
+func (db *Database) VerificationCodeUUID(id uint) (string, error) {
+	var vc VerificationCode
+	if err := db.db.
+		Select("id, uuid").
+		Where("id = ?", id).
+		First(&vc).
+		Error; err != nil {
+		return "", err
+	}
+	return vc.UUID, nil
+}
+
 // DeleteVerificationCode deletes the code by ID, this is a hard delete.
 func (db *Database) DeleteVerificationCode(id uint) error {
 	return db.db.Unscoped().
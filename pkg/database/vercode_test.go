@@ -17,6 +17,7 @@ package database
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -55,6 +56,35 @@ func TestCodeType(t *testing.T) {
 	}
 }
 
+func TestCodeEntropyBits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		length     uint
+		alphabet   string
+		checkDigit bool
+		exp        float64
+	}{
+		{"digits", 16, ShortCodeAlphabet, false, 16 * math.Log2(10)},
+		{"digits_check_digit", 16, ShortCodeAlphabet, true, 15 * math.Log2(10)},
+		{"crockford", 12, CrockfordLongCodeAlphabet, false, 60},
+		{"default", 16, DefaultLongCodeAlphabet, false, 16 * math.Log2(36)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := CodeEntropyBits(tc.length, tc.alphabet, tc.checkDigit), tc.exp; math.Abs(got-want) > 1e-9 {
+				t.Errorf("Expected %f to be %f", got, want)
+			}
+		})
+	}
+}
+
 func TestVerificationCode_BeforeSave(t *testing.T) {
 	t.Parallel()
 
@@ -224,6 +254,159 @@ func TestVerificationCode_ListRecentCodes(t *testing.T) {
 	}
 }
 
+func TestVerificationCode_ListVerificationCodes(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	realm := NewRealmWithDefaults("Test Realm")
+
+	codes := []*VerificationCode{
+		{
+			RealmID:           realm.ID,
+			IssuingUserID:     1,
+			IssuingExternalID: "case-1",
+			Code:              "11111111",
+			LongCode:          "11111111abcdef",
+			TestType:          "confirmed",
+			Claimed:           true,
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(2 * time.Hour),
+		},
+		{
+			RealmID:       realm.ID,
+			IssuingAppID:  2,
+			Code:          "22222222",
+			LongCode:      "22222222abcdef",
+			TestType:      "likely",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(2 * time.Hour),
+		},
+	}
+	for _, vc := range codes {
+		if err := db.SaveVerificationCode(vc, realm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The third code expired without being claimed. Expiry is set after saving,
+	// since codes cannot be saved already expired.
+	expired := &VerificationCode{
+		RealmID:       realm.ID,
+		IssuingUserID: 1,
+		Code:          "33333333",
+		LongCode:      "33333333abcdef",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(2 * time.Hour),
+	}
+	if err := db.SaveVerificationCode(expired, realm); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RawDB().
+		Model(&VerificationCode{}).
+		Where("id = ?", expired.ID).
+		UpdateColumns(map[string]interface{}{
+			"expires_at":      time.Now().Add(-2 * time.Hour),
+			"long_expires_at": time.Now().Add(-time.Hour),
+		}).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		scopes []Scope
+		want   []uint
+		err    bool
+	}{
+		{
+			name: "all",
+			want: []uint{expired.ID, codes[1].ID, codes[0].ID},
+		},
+		{
+			name:   "external_id",
+			scopes: []Scope{WithVerificationCodeExternalID("case-1")},
+			want:   []uint{codes[0].ID},
+		},
+		{
+			name:   "issuing_user",
+			scopes: []Scope{WithVerificationCodeIssuingUserID(1)},
+			want:   []uint{expired.ID, codes[0].ID},
+		},
+		{
+			name:   "issuing_app",
+			scopes: []Scope{WithVerificationCodeIssuingAppID(2)},
+			want:   []uint{codes[1].ID},
+		},
+		{
+			name:   "test_type",
+			scopes: []Scope{WithVerificationCodeTestType("likely")},
+			want:   []uint{codes[1].ID},
+		},
+		{
+			name:   "invalid_test_type",
+			scopes: []Scope{WithVerificationCodeTestType("banana")},
+			err:    true,
+		},
+		{
+			name:   "status_active",
+			scopes: []Scope{WithVerificationCodeStatus(VerificationCodeStatusActive)},
+			want:   []uint{codes[1].ID},
+		},
+		{
+			name:   "status_claimed",
+			scopes: []Scope{WithVerificationCodeStatus(VerificationCodeStatusClaimed)},
+			want:   []uint{codes[0].ID},
+		},
+		{
+			name:   "status_expired",
+			scopes: []Scope{WithVerificationCodeStatus(VerificationCodeStatusExpired)},
+			want:   []uint{expired.ID},
+		},
+		{
+			name:   "invalid_status",
+			scopes: []Scope{WithVerificationCodeStatus("pending")},
+			err:    true,
+		},
+		{
+			name:   "created_at",
+			scopes: []Scope{WithVerificationCodeCreatedAt(time.Now().Add(time.Hour), time.Time{})},
+			want:   []uint{},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, _, err := realm.ListVerificationCodes(db, nil, tc.scopes...)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				if !IsValidationError(err) {
+					t.Errorf("expected %v to be a validation error", err)
+				}
+				return
+			}
+
+			ids := make([]uint, 0, len(got))
+			for _, vc := range got {
+				ids = append(ids, vc.ID)
+
+				if vc.Code != "" || vc.LongCode != "" {
+					t.Errorf("expected code %d to not include the code", vc.ID)
+				}
+			}
+			if diff := cmp.Diff(tc.want, ids); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestVerificationCode_ExpireVerificationCode(t *testing.T) {
 	t.Parallel()
 
@@ -265,6 +448,71 @@ func TestVerificationCode_ExpireVerificationCode(t *testing.T) {
 	}
 }
 
+func TestVerificationCode_UpdateSMSDeliveryStatus(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("Test Realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "123456",
+		LongCode:      "defghijk329024",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(2 * time.Hour),
+	}
+	if err := db.SaveVerificationCode(vc, realm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateSMSDeliveryStatus(realm.ID, vc.UUID, "nope"); err == nil {
+		t.Errorf("expected error for unknown status")
+	}
+	if err := db.UpdateSMSDeliveryStatus(realm.ID, "not-a-uuid", SMSDeliveryStatusSent); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := db.UpdateSMSDeliveryStatus(realm.ID+1, vc.UUID, SMSDeliveryStatusSent); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// Out of order callbacks must not move the status backwards, and the final
+	// status must only be counted once.
+	for _, status := range []SMSDeliveryStatus{
+		SMSDeliveryStatusSent,
+		SMSDeliveryStatusDelivered,
+		SMSDeliveryStatusQueued,
+		SMSDeliveryStatusUndelivered,
+	} {
+		if err := db.UpdateSMSDeliveryStatus(realm.ID, vc.UUID, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := realm.FindVerificationCodeByUUID(db, vc.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.SMSDeliveryStatus, SMSDeliveryStatusDelivered; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	stats, err := realm.Stats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats[0].CodesDelivered, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := stats[0].CodesUndelivered, uint(0); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
 func TestSaveUserReport(t *testing.T) {
 	t.Parallel()
 
@@ -370,6 +618,62 @@ func TestVerCodeIsExpired(t *testing.T) {
 	}
 }
 
+func TestVerCodeStatus(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		code *VerificationCode
+		want VerificationCodeStatus
+	}{
+		{
+			name: "active",
+			code: &VerificationCode{
+				ExpiresAt:     time.Now().Add(time.Hour),
+				LongExpiresAt: time.Now().Add(time.Hour),
+			},
+			want: VerificationCodeStatusActive,
+		},
+		{
+			name: "long_code_active",
+			code: &VerificationCode{
+				ExpiresAt:     time.Now().Add(-time.Hour),
+				LongExpiresAt: time.Now().Add(time.Hour),
+			},
+			want: VerificationCodeStatusActive,
+		},
+		{
+			name: "claimed",
+			code: &VerificationCode{
+				Claimed:       true,
+				ExpiresAt:     time.Now().Add(-time.Hour),
+				LongExpiresAt: time.Now().Add(-time.Hour),
+			},
+			want: VerificationCodeStatusClaimed,
+		},
+		{
+			name: "expired",
+			code: &VerificationCode{
+				ExpiresAt:     time.Now().Add(-time.Hour),
+				LongExpiresAt: time.Now().Add(-time.Hour),
+			},
+			want: VerificationCodeStatusExpired,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := tc.code.Status(), tc.want; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
 func TestDeleteVerificationCode(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,527 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// CodeEvent is a verification code lifecycle event to which a webhook
+// subscription can subscribe.
+type CodeEvent string
+
+const (
+	// CodeEventClaimed is sent when a code is exchanged for a token.
+	CodeEventClaimed CodeEvent = "code.claimed"
+
+	// CodeEventExpired is sent when both the short and long code expire without
+	// being claimed.
+	CodeEventExpired CodeEvent = "code.expired"
+
+	// CodeEventManuallyExpired is sent when a code is expired by a user or via
+	// the expire code API.
+	CodeEventManuallyExpired CodeEvent = "code.manually_expired"
+)
+
+// CodeEvents is the list of all code events, in display order.
+var CodeEvents = []CodeEvent{
+	CodeEventClaimed,
+	CodeEventExpired,
+	CodeEventManuallyExpired,
+}
+
+// Display returns a human-readable description of the event.
+func (e CodeEvent) Display() string {
+	switch e {
+	case CodeEventClaimed:
+		return "Code claimed"
+	case CodeEventExpired:
+		return "Code expired unclaimed"
+	case CodeEventManuallyExpired:
+		return "Code manually expired"
+	default:
+		return string(e)
+	}
+}
+
+// WebhookDeliveryStatus is the delivery state of a webhook request.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryStatusPending indicates the request is waiting to be sent,
+	// or is waiting to be retried after a failure.
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = "pending"
+
+	// WebhookDeliveryStatusSucceeded indicates the endpoint accepted the request.
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+
+	// WebhookDeliveryStatusFailed indicates the request was not accepted after
+	// the maximum number of attempts.
+	WebhookDeliveryStatusFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookSubscription is a realm's subscription to verification code events.
+// The events are delivered to the URL as JSON, signed with the secret.
+type WebhookSubscription struct {
+	Errorable
+
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// RealmID is the realm whose codes generate events.
+	RealmID uint
+
+	// AuthorizedAppID optionally restricts the subscription to codes issued by
+	// a single API key. If nil, events are sent for all codes in the realm.
+	AuthorizedAppID *uint `gorm:"column:authorized_app_id; type:integer;"`
+
+	// URL is the endpoint to which events are sent.
+	URL string `gorm:"column:url; type:text;"`
+
+	// Secret is the HMAC key used to sign requests. It is encrypted/decrypted
+	// automatically by callbacks. The cache fields exist as optimizations.
+	Secret                string `gorm:"column:secret; type:text;" json:"-"` // ignored by zap's JSON formatter
+	SecretPlaintextCache  string `gorm:"-"`
+	SecretCiphertextCache string `gorm:"-"`
+
+	// Events is the list of CodeEvents to send.
+	Events pq.StringArray `gorm:"column:events; type:text[];"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (s *WebhookSubscription) BeforeSave(tx *gorm.DB) error {
+	if s.RealmID == 0 {
+		s.AddError("realmID", "cannot be blank")
+	}
+
+	s.URL = project.TrimSpace(s.URL)
+	if s.URL == "" {
+		s.AddError("url", "cannot be blank")
+	} else if u, err := url.Parse(s.URL); err != nil || u.Host == "" {
+		s.AddError("url", "is not a valid URL")
+	} else if u.Scheme != "https" {
+		s.AddError("url", "must begin with https://")
+	}
+
+	s.Secret = project.TrimSpace(s.Secret)
+	if want := 12; len(s.Secret) < want {
+		s.AddError("secret", fmt.Sprintf("must be at least %d characters", want))
+	}
+
+	if len(s.Events) == 0 {
+		s.AddError("events", "must include at least one event")
+	}
+	for _, e := range s.Events {
+		if !isCodeEvent(CodeEvent(e)) {
+			s.AddError("events", fmt.Sprintf("unknown event %q", e))
+		}
+	}
+
+	return s.ErrorOrNil()
+}
+
+// HasEvent returns true if the subscription includes the event.
+func (s *WebhookSubscription) HasEvent(e CodeEvent) bool {
+	for _, v := range s.Events {
+		if CodeEvent(v) == e {
+			return true
+		}
+	}
+	return false
+}
+
+// IsForApp returns true if the subscription is restricted to codes issued by
+// the API key with the given ID.
+func (s *WebhookSubscription) IsForApp(id uint) bool {
+	return s.AuthorizedAppID != nil && *s.AuthorizedAppID == id
+}
+
+func (s *WebhookSubscription) AuditID() string {
+	return fmt.Sprintf("webhook_subscriptions:%d", s.ID)
+}
+
+func (s *WebhookSubscription) AuditDisplay() string {
+	return s.URL
+}
+
+func isCodeEvent(e CodeEvent) bool {
+	for _, v := range CodeEvents {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is a single event sent to a webhook subscription. It is both
+// the queue from which the webhook-dispatcher service delivers events and the
+// delivery log shown to realm admins.
+type WebhookDelivery struct {
+	// ID is the auto-incrementing primary key.
+	ID uint
+
+	// WebhookSubscriptionID is the subscription to which the event is sent. The
+	// delivery is deleted when the subscription is deleted.
+	WebhookSubscriptionID uint
+
+	// RealmID is the realm which owns the subscription.
+	RealmID uint
+
+	// Event is the type of event.
+	Event CodeEvent `gorm:"column:event; type:text;"`
+
+	// VerificationCodeUUID is the UUID of the code which generated the event.
+	VerificationCodeUUID string `gorm:"column:verification_code_uuid; type:uuid;"`
+
+	// Payload is the JSON request body.
+	Payload string `gorm:"column:payload; type:text;"`
+
+	// Status is the current delivery state.
+	Status WebhookDeliveryStatus `gorm:"column:status; type:text;"`
+
+	// Attempts is the number of times delivery has been attempted.
+	Attempts uint `gorm:"column:attempts; type:integer;"`
+
+	// NextAttemptAt is the earliest time at which the dispatcher will attempt
+	// delivery. While a dispatcher holds the delivery, this is pushed into the
+	// future so other dispatchers do not claim it.
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at;"`
+
+	// LastStatusCode is the HTTP status code of the most recent attempt, or 0 if
+	// no response was received.
+	LastStatusCode int `gorm:"column:last_status_code; type:integer;"`
+
+	// LastError is the error from the most recent failed attempt.
+	LastError string `gorm:"column:last_error; type:text;"`
+
+	// DeliveredAt is the time the endpoint accepted the request.
+	DeliveredAt *time.Time `gorm:"column:delivered_at;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MarkSucceeded records that the endpoint accepted the request.
+func (d *WebhookDelivery) MarkSucceeded(statusCode int) {
+	now := time.Now().UTC()
+	d.Status = WebhookDeliveryStatusSucceeded
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	d.DeliveredAt = &now
+}
+
+// MarkFailed records that the request will not be retried.
+func (d *WebhookDelivery) MarkFailed(statusCode int, reason string) {
+	d.Status = WebhookDeliveryStatusFailed
+	d.LastStatusCode = statusCode
+	d.LastError = reason
+}
+
+// MarkRetry schedules the request for another attempt after the given delay.
+func (d *WebhookDelivery) MarkRetry(statusCode int, reason string, delay time.Duration) {
+	d.Status = WebhookDeliveryStatusPending
+	d.LastStatusCode = statusCode
+	d.LastError = reason
+	d.NextAttemptAt = time.Now().UTC().Add(delay)
+}
+
+// SaveWebhookSubscription creates or updates the webhook subscription.
+func (db *Database) SaveWebhookSubscription(s *WebhookSubscription, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided webhook subscription is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		isNew := s.ID == 0
+
+		if err := tx.Save(s).Error; err != nil {
+			return err
+		}
+
+		if isNew {
+			audit := BuildAuditEntry(actor, "created webhook subscription", s, s.RealmID)
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteWebhookSubscription deletes the webhook subscription and its delivery
+// log.
+func (db *Database) DeleteWebhookSubscription(s *WebhookSubscription, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided webhook subscription is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("id = ?", s.ID).
+			Delete(&WebhookSubscription{}).
+			Error; err != nil {
+			return err
+		}
+
+		audit := BuildAuditEntry(actor, "deleted webhook subscription", s, s.RealmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// FindWebhookSubscription finds the webhook subscription by its ID.
+func (db *Database) FindWebhookSubscription(id interface{}) (*WebhookSubscription, error) {
+	var s WebhookSubscription
+	if err := db.db.
+		Model(&WebhookSubscription{}).
+		Where("id = ?", id).
+		First(&s).
+		Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FindWebhookSubscription finds the webhook subscription by the given id
+// associated with the realm.
+func (r *Realm) FindWebhookSubscription(db *Database, id interface{}) (*WebhookSubscription, error) {
+	var s WebhookSubscription
+	if err := db.db.
+		Model(&WebhookSubscription{}).
+		Where("id = ?", id).
+		Where("realm_id = ?", r.ID).
+		First(&s).
+		Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListWebhookSubscriptions lists the realm's webhook subscriptions. The secrets
+// are not decrypted.
+func (r *Realm) ListWebhookSubscriptions(db *Database) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+	if err := db.db.
+		Model(&WebhookSubscription{}).
+		Where("realm_id = ?", r.ID).
+		Order("created_at ASC").
+		Find(&subscriptions).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return subscriptions, nil
+		}
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// ListWebhookDeliveries lists the delivery log for the subscription, newest
+// first.
+func (s *WebhookSubscription) ListWebhookDeliveries(db *Database, p *pagination.PageParams) ([]*WebhookDelivery, *pagination.Paginator, error) {
+	var deliveries []*WebhookDelivery
+	query := db.db.
+		Model(&WebhookDelivery{}).
+		Where("webhook_subscription_id = ?", s.ID).
+		Order("created_at DESC, id DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &deliveries, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return deliveries, nil, nil
+		}
+		return nil, nil, err
+	}
+	return deliveries, paginator, nil
+}
+
+// SaveWebhookDelivery updates the webhook delivery.
+func (db *Database) SaveWebhookDelivery(d *WebhookDelivery) error {
+	return db.db.Save(d).Error
+}
+
+// ClaimWebhookDeliveries claims up to limit pending deliveries which are due.
+// Claiming increments each delivery's attempt count and pushes its next
+// attempt time out by the lease duration, so concurrent dispatchers never
+// claim the same delivery, and a delivery held by a dispatcher that crashes is
+// retried once the lease expires.
+func (db *Database) ClaimWebhookDeliveries(limit uint, lease time.Duration) ([]*WebhookDelivery, error) {
+	now := time.Now().UTC()
+
+	sql := `
+		UPDATE webhook_deliveries
+		SET
+			attempts = attempts + 1,
+			next_attempt_at = $1,
+			updated_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $3 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+
+	var deliveries []*WebhookDelivery
+	if err := db.db.Raw(sql, now.Add(lease), now, WebhookDeliveryStatusPending, limit).Scan(&deliveries).Error; err != nil {
+		if IsNotFound(err) {
+			return deliveries, nil
+		}
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// EnqueueExpiredCodeEvents queues a CodeEventExpired delivery for up to limit
+// codes which have expired unclaimed and belong to a realm with a matching
+// subscription. Each code is only queued once. It returns the number of codes
+// processed.
+func (db *Database) EnqueueExpiredCodeEvents(limit uint) (int, error) {
+	now := time.Now().UTC()
+
+	var count int
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		sql := `
+			SELECT vc.* FROM verification_codes vc
+			WHERE vc.deleted_at IS NULL
+				AND vc.claimed = false
+				AND vc.expired_event_queued = false
+				AND vc.long_expires_at < $1
+				AND vc.expires_at < $1
+				AND EXISTS (
+					SELECT 1 FROM webhook_subscriptions s
+					WHERE s.realm_id = vc.realm_id
+						AND $2 = ANY(s.events)
+						AND (s.authorized_app_id IS NULL OR s.authorized_app_id = vc.issuing_app_id)
+						AND s.created_at <= GREATEST(vc.expires_at, vc.long_expires_at)
+				)
+			ORDER BY vc.long_expires_at ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED`
+
+		var codes []*VerificationCode
+		if err := tx.Raw(sql, now, CodeEventExpired, limit).Scan(&codes).Error; err != nil {
+			if IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to find expired codes: %w", err)
+		}
+
+		ids := make([]uint, 0, len(codes))
+		for _, vc := range codes {
+			occurredAt := vc.LongExpiresAt
+			if vc.ExpiresAt.After(occurredAt) {
+				occurredAt = vc.ExpiresAt
+			}
+
+			if err := enqueueCodeEvent(tx, vc, CodeEventExpired, occurredAt); err != nil {
+				return err
+			}
+			ids = append(ids, vc.ID)
+		}
+
+		if len(ids) > 0 {
+			if err := tx.
+				Model(&VerificationCode{}).
+				Where("id IN (?)", ids).
+				UpdateColumn("expired_event_queued", true).
+				Error; err != nil {
+				return fmt.Errorf("failed to mark expired codes: %w", err)
+			}
+		}
+
+		count = len(ids)
+		return nil
+	})
+	return count, err
+}
+
+// enqueueCodeEvent queues a delivery of the event for the code to each of the
+// realm's matching subscriptions. Subscriptions only receive events which
+// occur after they were created. It must be called inside the transaction
+// which causes the event, so the event is queued if and only if the change is
+// committed.
+func enqueueCodeEvent(tx *gorm.DB, vc *VerificationCode, event CodeEvent, occurredAt time.Time) error {
+	b, err := json.Marshal(&api.CodeEventWebhook{
+		Event:               string(event),
+		UUID:                vc.UUID,
+		ExternalIssuerID:    vc.IssuingExternalID,
+		TestType:            vc.TestType,
+		IssuedAtTimestamp:   vc.CreatedAt.UTC().Unix(),
+		OccurredAtTimestamp: occurredAt.UTC().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal code event: %w", err)
+	}
+
+	now := time.Now().UTC()
+	sql := `
+		INSERT INTO webhook_deliveries (
+			webhook_subscription_id, realm_id, event, verification_code_uuid,
+			payload, status, attempts, next_attempt_at, created_at, updated_at
+		)
+		SELECT id, realm_id, $1, $2, $3, $4, 0, $5, $5, $5
+		FROM webhook_subscriptions
+		WHERE realm_id = $6
+			AND $1 = ANY(events)
+			AND (authorized_app_id IS NULL OR authorized_app_id = $7)
+			AND created_at <= $8`
+
+	if err := tx.Exec(sql, event, vc.UUID, string(b), WebhookDeliveryStatusPending,
+		now, vc.RealmID, vc.IssuingAppID, occurredAt).Error; err != nil {
+		return fmt.Errorf("failed to queue %s event: %w", event, err)
+	}
+	return nil
+}
+
+// PurgeWebhookDeliveries will delete webhook deliveries that were created
+// longer than maxAge ago.
+func (db *Database) PurgeWebhookDeliveries(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	createdBefore := time.Now().UTC().Add(maxAge)
+
+	result := db.db.
+		Where("created_at < ?", createdBefore).
+		Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/lib/pq"
+)
+
+func TestWebhookSubscription_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		subscription *WebhookSubscription
+		errKeys      []string
+	}{
+		{
+			name: "valid",
+			subscription: &WebhookSubscription{
+				RealmID: 1,
+				URL:     "https://example.com/webhook",
+				Secret:  "my-super-secret",
+				Events:  pq.StringArray{string(CodeEventClaimed)},
+			},
+		},
+		{
+			name:         "missing_fields",
+			subscription: &WebhookSubscription{},
+			errKeys:      []string{"realmID", "url", "secret", "events"},
+		},
+		{
+			name: "http_url",
+			subscription: &WebhookSubscription{
+				RealmID: 1,
+				URL:     "http://example.com/webhook",
+				Secret:  "my-super-secret",
+				Events:  pq.StringArray{string(CodeEventClaimed)},
+			},
+			errKeys: []string{"url"},
+		},
+		{
+			name: "short_secret",
+			subscription: &WebhookSubscription{
+				RealmID: 1,
+				URL:     "https://example.com/webhook",
+				Secret:  "short",
+				Events:  pq.StringArray{string(CodeEventClaimed)},
+			},
+			errKeys: []string{"secret"},
+		},
+		{
+			name: "unknown_event",
+			subscription: &WebhookSubscription{
+				RealmID: 1,
+				URL:     "https://example.com/webhook",
+				Secret:  "my-super-secret",
+				Events:  pq.StringArray{"code.bananas"},
+			},
+			errKeys: []string{"events"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.subscription.BeforeSave(nil)
+			for _, k := range tc.errKeys {
+				if len(tc.subscription.ErrorsFor(k)) == 0 {
+					t.Errorf("expected errors for %q", k)
+				}
+			}
+			if len(tc.errKeys) == 0 {
+				if msgs := tc.subscription.ErrorMessages(); len(msgs) > 0 {
+					t.Errorf("expected no errors, got %q", msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabase_CodeEventWebhooks(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("Test Realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	subscription := &WebhookSubscription{
+		RealmID: realm.ID,
+		URL:     "https://example.com/webhook",
+		Secret:  "my-super-secret",
+		Events:  pq.StringArray{string(CodeEventExpired), string(CodeEventManuallyExpired)},
+	}
+	if err := db.SaveWebhookSubscription(subscription, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backdate the subscription so it receives events for codes which expired
+	// in the past.
+	if err := db.db.
+		Model(subscription).
+		UpdateColumn("created_at", time.Now().Add(-24*time.Hour)).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret is decrypted on lookup.
+	found, err := realm.FindWebhookSubscription(db, subscription.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found.Secret, "my-super-secret"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	newCode := func(code string) *VerificationCode {
+		t.Helper()
+
+		vc := &VerificationCode{
+			RealmID:           realm.ID,
+			Code:              code,
+			LongCode:          code + "abcdefgh",
+			TestType:          "confirmed",
+			IssuingExternalID: "external-" + code,
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(2 * time.Hour),
+		}
+		if err := db.SaveVerificationCode(vc, realm); err != nil {
+			t.Fatal(err)
+		}
+		return vc
+	}
+
+	// Manually expiring a code queues an event immediately.
+	manual := newCode("11111111")
+	if _, err := db.ExpireCode(manual.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Codes which expire unclaimed are queued by the dispatcher, exactly once.
+	expired := newCode("22222222")
+	if err := db.db.
+		Model(expired).
+		UpdateColumns(map[string]interface{}{
+			"expires_at":      time.Now().Add(-2 * time.Hour),
+			"long_expires_at": time.Now().Add(-time.Hour),
+		}).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Codes which have not expired are not queued.
+	_ = newCode("33333333")
+
+	for i, want := range []int{1, 0} {
+		count, err := db.EnqueueExpiredCodeEvents(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := count; got != want {
+			t.Errorf("run %d: expected %d to be %d", i, got, want)
+		}
+	}
+
+	deliveries, err := db.ClaimWebhookDeliveries(10, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(deliveries), 2; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+
+	events := make(map[string]CodeEvent)
+	for _, d := range deliveries {
+		if got, want := d.Attempts, uint(1); got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+
+		var payload api.CodeEventWebhook
+		if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := payload.Event, string(d.Event); got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := payload.UUID, d.VerificationCodeUUID; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		events[d.VerificationCodeUUID] = d.Event
+	}
+	if got, want := events[manual.UUID], CodeEventManuallyExpired; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := events[expired.UUID], CodeEventExpired; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Leased deliveries are not claimed again.
+	deliveries2, err := db.ClaimWebhookDeliveries(10, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(deliveries2), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Deleting the subscription deletes the delivery log.
+	if err := db.DeleteWebhookSubscription(subscription, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	list, _, err := subscription.ListWebhookDeliveries(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(list), 0; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
@@ -30,6 +30,10 @@ const (
 
 	// ProviderTypeSMTP composes emails and sends them via an external SMTP server.
 	ProviderTypeSMTP ProviderType = "SIMPLE_SMTP"
+
+	// ProviderTypeHTTP sends emails via an HTTP API, for environments where
+	// outbound SMTP is blocked.
+	ProviderTypeHTTP ProviderType = "HTTP"
 )
 
 // Config represents the env var based configuration for email SMTP server connection.
@@ -50,6 +54,11 @@ type Config struct {
 	// Note: legacy email port 25 is blocked on GCP and many other systems.
 	SMTPPort string `env:"EMAIL_SMTP_PORT, default=587"`
 
+	// HTTP options.
+	HTTPEndpoint    string `env:"EMAIL_HTTP_ENDPOINT"`
+	HTTPAPIKey      string `env:"EMAIL_HTTP_API_KEY" json:"-"` // ignored by zap's JSON formatter
+	HTTPFromAddress string `env:"EMAIL_HTTP_FROM_ADDRESS"`
+
 	// Secrets is the secret configuration. This is used to resolve values that
 	// are actually pointers to secrets before returning them to the caller. The
 	// table implementation is the source of truth for which values are secrets
@@ -78,6 +87,12 @@ func ProviderFor(ctx context.Context, c *Config) (Provider, error) {
 		return NewNoop(), nil
 	case ProviderTypeSMTP:
 		return NewSMTP(ctx, c.User, c.Password, c.SMTPHost, c.SMTPPort), nil
+	case ProviderTypeHTTP:
+		return NewHTTP(ctx, &HTTPConfig{
+			Endpoint: c.HTTPEndpoint,
+			APIKey:   c.HTTPAPIKey,
+			From:     c.HTTPFromAddress,
+		})
 	default:
 		return nil, fmt.Errorf("unknown email provider type: %v", typ)
 	}
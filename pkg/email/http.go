@@ -0,0 +1,154 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+var _ Provider = (*HTTPProvider)(nil)
+
+// HTTPConfig is the configuration for the HTTP email provider.
+type HTTPConfig struct {
+	// Endpoint is the full URL to which messages are POSTed.
+	Endpoint string
+
+	// APIKey is sent as a bearer token to authenticate to the endpoint.
+	APIKey string
+
+	// From is the sender address.
+	From string
+}
+
+// HTTPProvider sends messages by POSTing a JSON payload to an HTTP API, in the
+// style of SendGrid or SES. It exists for environments where outbound SMTP is
+// blocked. The request body is:
+//
+//	{
+//	  "from": "sender@example.com",
+//	  "to": ["recipient@example.com"],
+//	  "subject": "...",
+//	  "text": "...",
+//	  "html": "..."
+//	}
+//
+// Any 2xx response is considered a success.
+type HTTPProvider struct {
+	client *http.Client
+	config *HTTPConfig
+}
+
+// httpMessage is the JSON request body sent to the HTTP endpoint.
+type httpMessage struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text,omitempty"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// NewHTTP creates a new HTTP email sender.
+func NewHTTP(ctx context.Context, c *HTTPConfig) (Provider, error) {
+	if c == nil {
+		return nil, fmt.Errorf("missing http configuration")
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint: scheme must be http or https")
+	}
+
+	return &HTTPProvider{
+		client: &http.Client{Timeout: 10 * time.Second},
+		config: c,
+	}, nil
+}
+
+// SendEmail parses the message and sends it to the configured HTTP endpoint.
+// Unlike the SMTP provider, delivery is synchronous so errors are returned to
+// the caller.
+func (p *HTTPProvider) SendEmail(ctx context.Context, toEmail string, message []byte) error {
+	m, err := ParseMessage(message)
+	if err != nil {
+		return fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	body, err := json.Marshal(&httpMessage{
+		From:    p.config.From,
+		To:      []string{toEmail},
+		Subject: m.Subject,
+		Text:    m.Text,
+		HTML:    m.HTML,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	b, err := retry.NewFibonacci(250 * time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("failed to create backoff: %w", err)
+	}
+	b = retry.WithMaxRetries(4, b)
+
+	return retry.Do(ctx, b, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to build request: %w", err)
+		}
+		req.Close = true
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		if key := p.config.APIKey; key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to make request: %w", err))
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if code := resp.StatusCode; code < http.StatusOK || code >= http.StatusMultipleChoices {
+			err := fmt.Errorf("http error %d: %s", code, respBody)
+			if code >= http.StatusInternalServerError || code == http.StatusTooManyRequests {
+				return retry.RetryableError(err)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// From returns who shown as the sender of the email.
+func (p *HTTPProvider) From() string {
+	return p.config.From
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPProvider_SendEmail(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+		},
+		{
+			name:   "accepted",
+			status: http.StatusAccepted,
+		},
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := project.TestContext(t)
+
+			var mu sync.Mutex
+			var gotAuth string
+			var gotBody httpMessage
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				gotAuth = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			t.Cleanup(srv.Close)
+
+			provider, err := NewHTTP(ctx, &HTTPConfig{
+				Endpoint: srv.URL,
+				APIKey:   "secret",
+				From:     "noreply@example.com",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := &Message{
+				From:    provider.From(),
+				To:      "user@example.com",
+				Subject: "Hello",
+				Text:    "plain",
+				HTML:    "<p>html</p>",
+			}
+			raw, err := msg.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = provider.SendEmail(ctx, "user@example.com", raw)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if got, want := gotAuth, "Bearer secret"; got != want {
+				t.Errorf("expected authorization %q to be %q", got, want)
+			}
+
+			want := httpMessage{
+				From:    "noreply@example.com",
+				To:      []string{"user@example.com"},
+				Subject: "Hello",
+				Text:    "plain",
+				HTML:    "<p>html</p>",
+			}
+			if diff := cmp.Diff(want, gotBody); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewHTTP(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	if _, err := NewHTTP(ctx, &HTTPConfig{Endpoint: "ftp://example.com"}); err == nil {
+		t.Errorf("expected error for invalid scheme")
+	}
+	if _, err := NewHTTP(ctx, nil); err == nil {
+		t.Errorf("expected error for missing config")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Message is an email message. If HTML is provided, the message is composed as
+// multipart/alternative with both the plain text and HTML bodies. Otherwise
+// only the plain text body is sent.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+
+	// Text is the plain text body. It is required.
+	Text string
+
+	// HTML is the optional HTML body.
+	HTML string
+}
+
+// Bytes returns the RFC 5322 formatted message, including headers.
+func (m *Message) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.TrimSpace(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		fmt.Fprintf(&b, "Content-Type: text/plain; charset=\"utf-8\"\r\n")
+		fmt.Fprintf(&b, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, m.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+
+	// Per RFC 2046, the last part is the preferred representation, so the plain
+	// text part comes first.
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	}
+	for _, part := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + `; charset="utf-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s part: %w", part.contentType, err)
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// writeQuotedPrintable writes the quoted-printable encoding of s to w.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+	return nil
+}
+
+// ParseMessage parses a raw message, as produced by Message.Bytes, into its
+// parts. It is used by providers that accept structured messages instead of
+// raw MIME.
+func ParseMessage(raw []byte) (*Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	var dec mime.WordDecoder
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode subject: %w", err)
+	}
+
+	m := &Message{
+		From:    msg.Header.Get("From"),
+		To:      msg.Header.Get("To"),
+		Subject: subject,
+	}
+
+	contentType := msg.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse content type: %w", err)
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := readBody(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+		if mediaType == "text/html" {
+			m.HTML = body
+		} else {
+			m.Text = body
+		}
+		return m, nil
+	}
+
+	// The multipart reader transparently decodes quoted-printable parts.
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part: %w", err)
+		}
+
+		partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse part content type: %w", err)
+		}
+
+		body, err := readBody(part, part.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+
+		switch partType {
+		case "text/plain":
+			m.Text = body
+		case "text/html":
+			m.HTML = body
+		}
+	}
+
+	return m, nil
+}
+
+// readBody reads r, decoding quoted-printable content if needed. Line endings
+// are normalized to "\n".
+func readBody(r io.Reader, encoding string) (string, error) {
+	if strings.EqualFold(encoding, "quoted-printable") {
+		r = quotedprintable.NewReader(r)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read body: %w", err)
+	}
+	return strings.ReplaceAll(string(b), "\r\n", "\n"), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		msg       *Message
+		multipart bool
+	}{
+		{
+			name: "text_only",
+			msg: &Message{
+				From:    "noreply@example.com",
+				To:      "user@example.com",
+				Subject: "Hello",
+				Text:    "Click the link: https://example.com/?a=b&c=d",
+			},
+		},
+		{
+			name: "text_and_html",
+			msg: &Message{
+				From:    "noreply@example.com",
+				To:      "user@example.com",
+				Subject: "Héllo wörld",
+				Text:    "Click the link: https://example.com/?a=b&c=d",
+				HTML:    `<p>Click the <a href="https://example.com/?a=b&amp;c=d">link</a>.</p>`,
+			},
+			multipart: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := tc.msg.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := strings.Contains(string(b), "multipart/alternative"), tc.multipart; got != want {
+				t.Errorf("expected multipart to be %t in %s", want, b)
+			}
+
+			parsed, err := ParseMessage(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.msg, parsed); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMessage_legacy(t *testing.T) {
+	t.Parallel()
+
+	raw := "Subject: Your account\nTo: user@example.com\nFrom: noreply@example.com\n" +
+		"MIME-Version: 1.0\nContent-Type: text/plain; charset=\"utf-8\"\n\nWelcome!\n"
+
+	m, err := ParseMessage([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.Subject, "Your account"; got != want {
+		t.Errorf("expected subject %q to be %q", got, want)
+	}
+	if got, want := m.Text, "Welcome!\n"; got != want {
+		t.Errorf("expected text %q to be %q", got, want)
+	}
+	if m.HTML != "" {
+		t.Errorf("expected no html, got %q", m.HTML)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package letter renders printable patient letters containing verification
+// codes as a single PDF document, one letter per page.
+package letter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/qrcode"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	// PageSizeLetter and PageSizeA4 are the supported paper sizes.
+	PageSizeLetter = "Letter"
+	PageSizeA4     = "A4"
+
+	// margin is the page margin, in millimeters.
+	margin = 20
+
+	// logoHeight is the height of the realm logo, in millimeters. The width is
+	// scaled to preserve the aspect ratio.
+	logoHeight = 18
+
+	// qrCodeWidth is the width and height of the printed QR code, in
+	// millimeters.
+	qrCodeWidth = 50
+
+	// utf8Family is the font family name of the optional TrueType font.
+	utf8Family = "letter"
+)
+
+// Letter is a single patient letter.
+type Letter struct {
+	// Text is the expanded body of the letter.
+	Text string
+
+	// Code is the verification code, printed in large type below the text.
+	Code string
+
+	// Link is the optional EN Express link. If present, it is printed below the
+	// code along with a QR code.
+	Link string
+}
+
+// Options are the settings shared by all letters in a document.
+type Options struct {
+	// Title is printed at the top of each letter, usually the realm name.
+	Title string
+
+	// Logo is an optional PNG image printed above the title. Use FetchLogo to
+	// download and convert a realm's logo.
+	Logo []byte
+
+	// PageSize is the paper size, PageSizeLetter or PageSizeA4. The default is
+	// PageSizeLetter.
+	PageSize string
+
+	// FontPath is an optional path to a TrueType font for the title and text.
+	// The built-in font only covers Western European characters.
+	FontPath string
+}
+
+// Render writes a PDF document with one page per letter to w.
+func Render(w io.Writer, letters []*Letter, opts *Options) error {
+	if len(letters) == 0 {
+		return fmt.Errorf("no letters to render")
+	}
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	pageSize := opts.PageSize
+	if pageSize == "" {
+		pageSize = PageSizeLetter
+	}
+	if pageSize != PageSizeLetter && pageSize != PageSizeA4 {
+		return fmt.Errorf("unsupported page size %q", pageSize)
+	}
+
+	pdf := gofpdf.New("P", "mm", pageSize, "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin)
+	pdf.SetTitle(opts.Title, true)
+	pdf.SetCreator("Exposure Notifications Verification Server", true)
+
+	// Text is translated to the built-in font's encoding unless a TrueType font
+	// with UTF-8 support was provided.
+	family := "Helvetica"
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	if opts.FontPath != "" {
+		pdf.AddUTF8Font(utf8Family, "", opts.FontPath)
+		family = utf8Family
+		tr = func(s string) string { return s }
+	}
+
+	if len(opts.Logo) > 0 {
+		pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(opts.Logo))
+	}
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to build letters: %w", err)
+	}
+
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 2*margin
+
+	for i, l := range letters {
+		pdf.AddPage()
+
+		if len(opts.Logo) > 0 {
+			pdf.ImageOptions("logo", margin, margin, 0, logoHeight, true, gofpdf.ImageOptions{}, 0, "")
+			pdf.Ln(6)
+		}
+
+		if opts.Title != "" {
+			pdf.SetFont(family, "", 16)
+			pdf.MultiCell(0, 8, tr(opts.Title), "", "L", false)
+			pdf.Ln(6)
+		}
+
+		pdf.SetFont(family, "", 12)
+		pdf.MultiCell(0, 6, tr(strings.TrimSpace(l.Text)), "", "L", false)
+		pdf.Ln(8)
+
+		pdf.SetFont("Courier", "B", 24)
+		pdf.CellFormat(0, 16, l.Code, "1", 1, "C", false, 0, "")
+
+		if l.Link != "" {
+			png, err := qrcode.PNG(l.Link, qrcode.DefaultSize)
+			if err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("qr-%d", i)
+			pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+			pdf.Ln(8)
+			pdf.ImageOptions(name, margin+(contentWidth-qrCodeWidth)/2, pdf.GetY(), qrCodeWidth, qrCodeWidth, true, gofpdf.ImageOptions{}, 0, "")
+			pdf.Ln(4)
+
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.MultiCell(0, 5, l.Link, "", "C", false)
+		}
+
+		if err := pdf.Error(); err != nil {
+			return fmt.Errorf("failed to build letter %d: %w", i+1, err)
+		}
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to render letters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package letter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	letters := []*Letter{
+		{
+			Text: "Your verification code is abcd-efgh. It expires on 2021-06-01 15:04 UTC.",
+			Code: "abcd-efgh",
+		},
+		{
+			Text: "Scan the QR code or open the link. Código válido.",
+			Code: "ijkl-mnop",
+			Link: "https://us-aa.en.express/v?c=ijklmnop",
+		},
+	}
+
+	cases := []struct {
+		name string
+		opts *Options
+		err  string
+	}{
+		{
+			name: "defaults",
+			opts: nil,
+		},
+		{
+			name: "a4_with_logo",
+			opts: &Options{
+				Title:    "State of Wonder",
+				Logo:     testLogo(t),
+				PageSize: PageSizeA4,
+			},
+		},
+		{
+			name: "bad_page_size",
+			opts: &Options{PageSize: "Legal"},
+			err:  "unsupported page size",
+		},
+		{
+			name: "missing_font",
+			opts: &Options{FontPath: "/does/not/exist.ttf"},
+			err:  "failed to build letters",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			err := Render(&b, letters, tc.opts)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pdf := b.String()
+			if !strings.HasPrefix(pdf, "%PDF-") {
+				t.Errorf("expected pdf, got %q", pdf[:10])
+			}
+			if got, want := strings.Count(pdf, "/Type /Page\n"), len(letters); got != want {
+				t.Errorf("expected %d pages to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRender_NoLetters(t *testing.T) {
+	t.Parallel()
+
+	if err := Render(new(bytes.Buffer), nil, nil); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestFetchLogo(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logo.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jpg.Bytes())
+	})
+	mux.HandleFunc("/logo.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not an image"))
+	})
+	mux.HandleFunc("/huge.png", func(w http.ResponseWriter, r *http.Request) {
+		png.Encode(w, image.NewGray(image.Rect(0, 0, 1, maxLogoDimension+1)))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	b, err := FetchLogo(ctx, srv.URL+"/logo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := http.DetectContentType(b), "image/png"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err := FetchLogo(ctx, srv.URL+"/logo.txt"); err == nil {
+		t.Errorf("expected error for non-image")
+	}
+	if _, err := FetchLogo(ctx, srv.URL+"/huge.png"); err == nil || !strings.Contains(err.Error(), "pixels") {
+		t.Errorf("expected error for oversized logo, got %v", err)
+	}
+	if _, err := FetchLogo(ctx, srv.URL+"/missing.png"); err == nil {
+		t.Errorf("expected error for missing logo")
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.RGBA{R: 0x1a, G: 0x73, B: 0xe8, A: 0xff})
+		}
+	}
+	return img
+}
+
+func testLogo(tb testing.TB) []byte {
+	tb.Helper()
+
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, testImage(), nil); err != nil {
+		tb.Fatal(err)
+	}
+	b, err := convertLogo(jpg.Bytes())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package letter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"  // Register the GIF decoder for logos.
+	_ "image/jpeg" // Register the JPEG decoder for logos.
+	"image/png"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxLogoBytes is the maximum size of a downloaded logo.
+	maxLogoBytes = 1 << 20
+
+	// maxLogoDimension is the maximum width and height of a logo in pixels. It
+	// bounds the memory needed to decode a small, highly compressed image.
+	maxLogoDimension = 4096
+
+	// logoFetchTimeout is the maximum time to wait for a logo to download.
+	logoFetchTimeout = 5 * time.Second
+)
+
+// logoClient is the HTTP client used to download logos.
+var logoClient = &http.Client{Timeout: logoFetchTimeout}
+
+// FetchLogo downloads the image at the URL and returns it as a PNG suitable
+// for Options.Logo. GIF, JPEG, and PNG images are supported.
+func FetchLogo(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build logo request: %w", err)
+	}
+
+	resp, err := logoClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch logo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch logo: status %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+	if len(b) > maxLogoBytes {
+		return nil, fmt.Errorf("logo is larger than %d bytes", maxLogoBytes)
+	}
+	return convertLogo(b)
+}
+
+// convertLogo decodes the image and re-encodes it as an 8-bit PNG, which
+// normalizes image formats and PNG variants the PDF renderer does not support.
+// The dimensions are checked before the image is decoded.
+func convertLogo(b []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo: %w", err)
+	}
+	if cfg.Width > maxLogoDimension || cfg.Height > maxLogoDimension {
+		return nil, fmt.Errorf("logo is larger than %dx%d pixels", maxLogoDimension, maxLogoDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo: %w", err)
+	}
+
+	// Draw onto an 8-bit image, since the PDF renderer does not support 16-bit
+	// PNGs, which is how other image types would be encoded.
+	rgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, rgba); err != nil {
+		return nil, fmt.Errorf("failed to encode logo: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/rakutentech/jwk-go/jwk"
+)
+
+// keySet is the provider's signing keys, by key ID.
+type keySet struct {
+	keys map[string]interface{}
+}
+
+// fetchKeySet fetches and parses the provider's signing keys. Keys which are
+// not for signatures, or are not RSA or ECDSA public keys, are ignored.
+func fetchKeySet(ctx context.Context, client *http.Client, u string) (*keySet, error) {
+	var specs jwk.KeySpecSet
+	if err := getJSON(ctx, client, u, &specs); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	set := &keySet{keys: make(map[string]interface{}, len(specs.Keys))}
+	for _, spec := range specs.Keys {
+		if spec.Use != "" && spec.Use != "sig" {
+			continue
+		}
+
+		switch spec.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			set.keys[spec.KeyID] = spec.Key
+		}
+	}
+
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("provider has no supported signing keys")
+	}
+	return set, nil
+}
+
+// keyFunc returns the key which signed the token. Only RSA and ECDSA
+// signatures are accepted.
+func (s *keySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	// Tokens may omit the key ID if the provider has a single key.
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
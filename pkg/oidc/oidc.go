@@ -0,0 +1,314 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc implements the OpenID Connect authorization code flow for
+// signing in with a third-party identity provider, such as Azure AD or Okta.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultGroupsClaim is the ID token claim which lists the user's groups,
+	// if a claim is not configured.
+	DefaultGroupsClaim = "groups"
+
+	// discoveryPath is the path, relative to the issuer, of the provider's
+	// configuration document.
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// maxResponseBytes is the largest response read from the provider.
+	maxResponseBytes = 1 << 20
+)
+
+// mfaMethods are the authentication method references (RFC 8176) which
+// indicate the user signed in with a second factor.
+var mfaMethods = map[string]struct{}{
+	"mfa":  {},
+	"otp":  {},
+	"hwk":  {},
+	"swk":  {},
+	"sms":  {},
+	"fpt":  {},
+	"face": {},
+	"iris": {},
+}
+
+// Config is the configuration for signing in with an identity provider.
+type Config struct {
+	// Issuer is the identity provider's issuer URL. The provider's endpoints
+	// are discovered from it.
+	Issuer string
+
+	// ClientID and ClientSecret are the credentials of the application
+	// registered with the identity provider.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the callback URL registered with the identity provider.
+	RedirectURL string
+
+	// GroupsClaim is the ID token claim which lists the user's groups. It
+	// defaults to DefaultGroupsClaim.
+	GroupsClaim string
+
+	// HTTPClient is used for requests to the identity provider. It defaults to
+	// a client with a timeout.
+	HTTPClient *http.Client
+}
+
+// metadata is the subset of the provider's configuration document which is
+// used.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client signs users in with a single identity provider.
+type Client struct {
+	config   *Config
+	metadata *metadata
+	oauth2   *oauth2.Config
+	client   *http.Client
+}
+
+// Claims are the verified claims about the user from the identity provider.
+type Claims struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+
+	// EmailVerified is true unless the provider explicitly reported that the
+	// email address is unverified. Providers such as Azure AD omit the claim
+	// for addresses managed by the organization.
+	EmailVerified bool
+
+	// MFA is true if the provider reported that the user signed in with a
+	// second factor.
+	MFA bool
+
+	// Groups are the user's groups, from the configured groups claim.
+	Groups []string
+}
+
+// NewClient creates a client for the identity provider, discovering its
+// endpoints from the issuer.
+func NewClient(ctx context.Context, config *Config) (*Client, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("missing issuer")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("missing client id")
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+
+	var md metadata
+	if err := getJSON(ctx, client, issuer+discoveryPath, &md); err != nil {
+		return nil, fmt.Errorf("failed to discover provider configuration: %w", err)
+	}
+	if got, want := strings.TrimSuffix(md.Issuer, "/"), issuer; got != want {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", got, want)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("provider configuration is missing endpoints")
+	}
+
+	return &Client{
+		config:   config,
+		metadata: &md,
+		oauth2: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  md.AuthorizationEndpoint,
+				TokenURL: md.TokenEndpoint,
+			},
+			Scopes: []string{"openid", "email", "profile"},
+		},
+		client: client,
+	}, nil
+}
+
+// NewState returns a random value for use as the state or nonce of an
+// authorization request.
+func NewState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL of the provider's sign-in page. The state and
+// nonce must be stored and compared when the provider redirects back.
+func (c *Client) AuthCodeURL(state, nonce string) string {
+	return c.oauth2.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// Exchange exchanges the authorization code from the provider's redirect for
+// an ID token, and returns the token's verified claims.
+func (c *Client) Exchange(ctx context.Context, code, nonce string) (*Claims, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.client)
+
+	token, err := c.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("token response is missing id_token")
+	}
+	return c.Verify(ctx, rawIDToken, nonce)
+}
+
+// Verify verifies the ID token's signature, issuer, audience, expiry, and
+// nonce, and returns its claims.
+func (c *Client) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	keys, err := fetchKeySet(ctx, c.client, c.metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.MapClaims
+	if _, err := jwt.ParseWithClaims(rawIDToken, &claims, keys.keyFunc); err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(c.metadata.Issuer, true) {
+		return nil, fmt.Errorf("invalid id token: unexpected issuer")
+	}
+	if !claims.VerifyAudience(c.config.ClientID, true) {
+		return nil, fmt.Errorf("invalid id token: unexpected audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("invalid id token: expired")
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("invalid id token: nonce mismatch")
+	}
+
+	result := &Claims{
+		Issuer:        stringClaim(claims, "iss"),
+		Subject:       stringClaim(claims, "sub"),
+		Email:         stringClaim(claims, "email"),
+		Name:          stringClaim(claims, "name"),
+		EmailVerified: true,
+	}
+	if result.Subject == "" {
+		return nil, fmt.Errorf("invalid id token: missing subject")
+	}
+	if result.Email == "" {
+		// Azure AD puts the user's email address in preferred_username when the
+		// email claim is not configured.
+		if v := stringClaim(claims, "preferred_username"); strings.Contains(v, "@") {
+			result.Email = v
+		}
+	}
+	if result.Email == "" {
+		return nil, fmt.Errorf("invalid id token: missing email")
+	}
+	if v, ok := claims["email_verified"].(bool); ok {
+		result.EmailVerified = v
+	}
+
+	for _, m := range stringsClaim(claims, "amr") {
+		if _, ok := mfaMethods[m]; ok {
+			result.MFA = true
+			break
+		}
+	}
+
+	groupsClaim := c.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = DefaultGroupsClaim
+	}
+	result.Groups = stringsClaim(claims, groupsClaim)
+
+	return result, nil
+}
+
+// stringClaim returns the claim if it is a string, or the empty string.
+func stringClaim(claims jwt.MapClaims, name string) string {
+	v, _ := claims[name].(string)
+	return v
+}
+
+// stringsClaim returns the claim if it is a string or a list of strings.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch t := claims[name].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		result := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// getJSON fetches the URL and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s: %d", u, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/oidc"
+	"github.com/google/exposure-notifications-verification-server/pkg/oidc/oidctest"
+)
+
+func TestClient_Exchange(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	idp := oidctest.NewServer(t)
+	idp.SetClaims(map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+		"amr":            []string{"pwd", "mfa"},
+		"roles":          []string{"tracers", "admins"},
+	})
+
+	client, err := oidc.NewClient(ctx, &oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "https://verification.example.com/login/sso/callback",
+		GroupsClaim:  "roles",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redirect := idp.Authorize(t, client.AuthCodeURL("state-1", "nonce-1"))
+	if got, want := redirect.Query().Get("state"), "state-1"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	claims, err := client.Exchange(ctx, redirect.Query().Get("code"), "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &oidc.Claims{
+		Issuer:        idp.Issuer(),
+		Subject:       "user-1",
+		Email:         "user@example.com",
+		Name:          "Test User",
+		EmailVerified: true,
+		MFA:           true,
+		Groups:        []string{"tracers", "admins"},
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("expected %#v to be %#v", claims, want)
+	}
+
+	// Codes can only be used once.
+	if _, err := client.Exchange(ctx, redirect.Query().Get("code"), "nonce-1"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestClient_Verify(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	idp := oidctest.NewServer(t)
+	other := oidctest.NewServer(t)
+
+	client, err := oidc.NewClient(ctx, &oidc.Config{
+		Issuer:   idp.Issuer(),
+		ClientID: oidctest.ClientID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		token  string
+		err    string
+		claims *oidc.Claims
+	}{
+		{
+			name: "valid",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub":                "user-1",
+				"preferred_username": "user@example.com",
+				"amr":                []string{"pwd"},
+			}, "nonce"),
+			claims: &oidc.Claims{
+				Issuer:        idp.Issuer(),
+				Subject:       "user-1",
+				Email:         "user@example.com",
+				EmailVerified: true,
+			},
+		},
+		{
+			name: "unverified_email",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub":            "user-1",
+				"email":          "user@example.com",
+				"email_verified": false,
+				"groups":         "tracers",
+			}, "nonce"),
+			claims: &oidc.Claims{
+				Issuer:  idp.Issuer(),
+				Subject: "user-1",
+				Email:   "user@example.com",
+				Groups:  []string{"tracers"},
+			},
+		},
+		{
+			name: "wrong_nonce",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub":   "user-1",
+				"email": "user@example.com",
+			}, "other"),
+			err: "nonce mismatch",
+		},
+		{
+			name: "wrong_audience",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub":   "user-1",
+				"email": "user@example.com",
+				"aud":   "other-client",
+			}, "nonce"),
+			err: "unexpected audience",
+		},
+		{
+			name: "expired",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub":   "user-1",
+				"email": "user@example.com",
+				"exp":   time.Now().Add(-1 * time.Hour).Unix(),
+			}, "nonce"),
+			err: "expired",
+		},
+		{
+			name: "missing_email",
+			token: idp.SignIDToken(t, map[string]interface{}{
+				"sub": "user-1",
+			}, "nonce"),
+			err: "missing email",
+		},
+		{
+			name: "wrong_key",
+			token: other.SignIDToken(t, map[string]interface{}{
+				"iss":   idp.Issuer(),
+				"sub":   "user-1",
+				"email": "user@example.com",
+			}, "nonce"),
+			err: "verification error",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := client.Verify(ctx, tc.token, "nonce")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %v to contain %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(claims, tc.claims) {
+				t.Errorf("expected %#v to be %#v", claims, tc.claims)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	idp := oidctest.NewServer(t)
+
+	if _, err := oidc.NewClient(ctx, &oidc.Config{ClientID: oidctest.ClientID}); err == nil {
+		t.Errorf("expected error for missing issuer")
+	}
+
+	if _, err := oidc.NewClient(ctx, &oidc.Config{Issuer: idp.Issuer()}); err == nil {
+		t.Errorf("expected error for missing client id")
+	}
+
+	if _, err := oidc.NewClient(ctx, &oidc.Config{Issuer: idp.Issuer() + "/other", ClientID: oidctest.ClientID}); err == nil {
+		t.Errorf("expected error for unknown issuer")
+	}
+}
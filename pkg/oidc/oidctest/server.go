@@ -0,0 +1,277 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidctest provides a mock OpenID Connect identity provider for
+// testing.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/rakutentech/jwk-go/jwk"
+)
+
+const (
+	// ClientID and ClientSecret are the credentials the mock provider accepts.
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+
+	keyID = "test-key"
+)
+
+// Server is a mock identity provider. Users sign in as the subject whose
+// claims were last set with SetClaims.
+type Server struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	codes  map[string]jwt.MapClaims
+}
+
+// NewServer starts a mock identity provider. It is closed when the test
+// finishes.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := &Server{
+		key: key,
+		claims: jwt.MapClaims{
+			"sub":   "user-1",
+			"email": "user@example.com",
+			"name":  "Test User",
+		},
+		codes: make(map[string]jwt.MapClaims),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	s.Server = httptest.NewServer(mux)
+	tb.Cleanup(s.Server.Close)
+
+	return s
+}
+
+// Issuer returns the issuer URL of the provider.
+func (s *Server) Issuer() string {
+	return s.Server.URL
+}
+
+// SetClaims sets the claims of the user who signs in next. The issuer,
+// audience, expiry, and nonce are added automatically.
+func (s *Server) SetClaims(claims map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = jwt.MapClaims(claims)
+}
+
+// SignIDToken signs an ID token with the given claims, as issued to the
+// client with the nonce.
+func (s *Server) SignIDToken(tb testing.TB, claims map[string]interface{}, nonce string) string {
+	tb.Helper()
+
+	token, err := s.signIDToken(jwt.MapClaims(claims), nonce)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return token
+}
+
+// Authorize simulates the user signing in at the provider's sign-in page for
+// the given authorization URL. It returns the URL to which the provider
+// redirects the user.
+func (s *Server) Authorize(tb testing.TB, authURL string) *url.URL {
+	tb.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, http.StatusFound; got != want {
+		tb.Fatalf("expected %d to be %d", got, want)
+	}
+
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return u
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.Issuer() + "/authorize",
+		"token_endpoint":         s.Issuer() + "/token",
+		"jwks_uri":               s.Issuer() + "/jwks",
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	claims := make(jwt.MapClaims, len(s.claims)+1)
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+	claims["nonce"] = q.Get("nonce")
+	s.codes[code] = claims
+	s.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	claims, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	idToken, err := s.signIDToken(claims, nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "test-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	spec := jwk.NewSpecWithID(keyID, &s.key.PublicKey)
+	spec.Algorithm = "RS256"
+	spec.Use = "sig"
+
+	key, err := spec.ToJWK()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []*jwk.JWK{key},
+	})
+}
+
+// signIDToken signs the claims, adding the standard claims which are not
+// already set.
+func (s *Server) signIDToken(claims jwt.MapClaims, nonce string) (string, error) {
+	now := time.Now()
+
+	all := jwt.MapClaims{
+		"iss":   s.Issuer(),
+		"aud":   ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = keyID
+
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign id token: %w", err)
+	}
+	return signed, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
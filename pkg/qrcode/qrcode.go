@@ -0,0 +1,112 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qrcode renders QR codes server-side so that the encoded content is
+// never shared with a third-party service.
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+)
+
+// DefaultSize is the default width and height, in pixels, of QR code PNGs.
+const DefaultSize = 300
+
+// quietZone is the number of blank modules rendered around the SVG symbol, as
+// required by the QR code specification.
+const quietZone = 4
+
+// encode encodes the content as an unscaled QR code, where each pixel is one
+// module.
+func encode(content string) (barcode.Barcode, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+	return code, nil
+}
+
+// PNG renders the content as a QR code PNG image that is size pixels wide and
+// tall.
+func PNG(content string, size int) ([]byte, error) {
+	code, err := encode(content)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scale qr code: %w", err)
+	}
+
+	// The scaled barcode is 16-bit grayscale; an 8-bit image is half the size
+	// and is supported by more consumers, such as PDF renderers.
+	img := image.NewGray(code.Bounds())
+	draw.Draw(img, img.Bounds(), code, code.Bounds().Min, draw.Src)
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, fmt.Errorf("failed to render qr code: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// PNGDataURL renders the content as a QR code PNG image and returns it as a
+// base64-encoded data URL suitable for use in an img tag.
+func PNGDataURL(content string, size int) (template.URL, error) {
+	b, err := PNG(content, size)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// SVG renders the content as a QR code SVG document. The image is scalable, so
+// there is no size; each module is one unit of the view box.
+func SVG(content string) ([]byte, error) {
+	code, err := encode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := code.Bounds()
+	dim := bounds.Dx() + 2*quietZone
+
+	var path strings.Builder
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := code.At(x, y).RGBA(); r != 0 {
+				continue
+			}
+			fmt.Fprintf(&path, "M%d %dh1v1h-1z",
+				x-bounds.Min.X+quietZone, y-bounds.Min.Y+quietZone)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, dim, dim)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, dim, dim)
+	fmt.Fprintf(&b, `<path fill="#000" d="%s"/>`, path.String())
+	b.WriteString(`</svg>`)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const testContent = "https://us-aa.en.express/v?c=abcdefghijklmnop"
+
+func TestPNG(t *testing.T) {
+	t.Parallel()
+
+	b, err := PNG(testContent, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.Bounds().Dx(), 200; got != want {
+		t.Errorf("expected width %d to be %d", got, want)
+	}
+	if got, want := img.Bounds().Dy(), 200; got != want {
+		t.Errorf("expected height %d to be %d", got, want)
+	}
+}
+
+func TestPNGDataURL(t *testing.T) {
+	t.Parallel()
+
+	u, err := PNGDataURL(testContent, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(u), "data:image/png;base64,"; !strings.HasPrefix(got, want) {
+		t.Errorf("expected %q to start with %q", got, want)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	t.Parallel()
+
+	b, err := SVG(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := string(b)
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") {
+		t.Errorf("expected svg document, got %q", svg)
+	}
+	if !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Errorf("expected finder pattern module after the quiet zone, got %q", svg)
+	}
+}
+
+func TestEncode_TooLong(t *testing.T) {
+	t.Parallel()
+
+	if _, err := PNG(strings.Repeat("a", 8000), 200); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := SVG(strings.Repeat("a", 8000)); err == nil {
+		t.Errorf("expected error")
+	}
+}
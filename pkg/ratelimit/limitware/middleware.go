@@ -42,9 +42,16 @@ type Middleware struct {
 	store   limiter.Store
 	keyFunc httplimit.KeyFunc
 
+	limitFunc   LimitFunc
+	limitedFunc func(r *http.Request)
+
 	allowOnError bool
 }
 
+// LimitFunc returns the number of tokens per interval for the request. If ok
+// is false, the request is not rate limited.
+type LimitFunc func(r *http.Request) (tokens uint64, interval time.Duration, ok bool)
+
 // Option is an option to the middleware.
 type Option func(m *Middleware) *Middleware
 
@@ -57,6 +64,24 @@ func AllowOnError(v bool) Option {
 	}
 }
 
+// WithLimitFunc configures the limit for each request, instead of using the
+// store's defaults. The bucket is reconfigured when the limit changes.
+func WithLimitFunc(f LimitFunc) Option {
+	return func(m *Middleware) *Middleware {
+		m.limitFunc = f
+		return m
+	}
+}
+
+// OnRateLimited calls f for each request which is rejected because there are
+// no tokens remaining.
+func OnRateLimited(f func(r *http.Request)) Option {
+	return func(m *Middleware) *Middleware {
+		m.limitedFunc = f
+		return m
+	}
+}
+
 // NewMiddleware creates a new middleware suitable for use as an HTTP handler.
 // This function returns an error if either the Store or KeyFunc are nil.
 func NewMiddleware(ctx context.Context, s limiter.Store, f httplimit.KeyFunc, opts ...Option) (*Middleware, error) {
@@ -105,6 +130,18 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 			stats.Record(ctx, mRequest.M(1))
 		}(&result)
 
+		// Lookup the limit for the request, if it is configured per-request.
+		var tokens uint64
+		var interval time.Duration
+		if m.limitFunc != nil {
+			var ok bool
+			tokens, interval, ok = m.limitFunc(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
 		// Call the key function - if this fails, it's an internal server error.
 		key, err := m.keyFunc(r)
 		if err != nil {
@@ -114,6 +151,19 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 			return
 		}
 
+		// Configure the bucket if this is the first request or the limit changed.
+		if m.limitFunc != nil {
+			if err := ConfigureLimit(ctx, m.store, key, tokens, interval); err != nil {
+				logger.Errorw("failed to configure limit", "error", err)
+
+				if !m.allowOnError {
+					result = enobs.ResultError("FAILED_TO_CONFIGURE_LIMIT")
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
 		// Take from the store.
 		limit, remaining, reset, ok, err := m.store.Take(ctx, key)
 		if err != nil {
@@ -137,6 +187,9 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 		if !ok {
 			logger.Infow("rate limited", "key", key)
 			result = enobs.ResultError("RATE_LIMITED")
+			if m.limitedFunc != nil {
+				m.limitedFunc(r)
+			}
 			w.Header().Set(httplimit.HeaderRetryAfter, resetTime)
 			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 			return
@@ -172,6 +225,72 @@ func APIKeyFunc(ctx context.Context, db *database.Database, scope string, hmacKe
 	}
 }
 
+// AuthorizedAppKeyFunc rate limits on the authorized app in the request
+// context. It must come after RequireAPIKey.
+func AuthorizedAppKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplimit.KeyFunc {
+	return func(r *http.Request) (string, error) {
+		authApp := controller.AuthorizedAppFromContext(r.Context())
+		if authApp == nil {
+			return "", fmt.Errorf("missing authorized app")
+		}
+
+		key, err := authApp.RateLimitKey(hmacKey)
+		if err != nil {
+			return "", err
+		}
+		return scope + key, nil
+	}
+}
+
+// AuthorizedAppLimit limits each authorized app in the request context to its
+// configured requests per minute, and records rejected requests in the
+// authorized app's stats. Authorized apps without a configured limit are not
+// limited. It must come after RequireAPIKey.
+func AuthorizedAppLimit(db *database.Database) Option {
+	limitFunc := WithLimitFunc(func(r *http.Request) (uint64, time.Duration, bool) {
+		authApp := controller.AuthorizedAppFromContext(r.Context())
+		if authApp == nil || authApp.RequestsPerMinute == 0 {
+			return 0, 0, false
+		}
+		return uint64(authApp.RequestsPerMinute), time.Minute, true
+	})
+
+	limitedFunc := OnRateLimited(func(r *http.Request) {
+		authApp := controller.AuthorizedAppFromContext(r.Context())
+		if authApp == nil {
+			return
+		}
+
+		if err := authApp.RecordRateLimited(db, time.Now()); err != nil {
+			logger := logging.FromContext(r.Context()).Named("ratelimit.AuthorizedAppLimit")
+			logger.Errorw("failed to record rate limited request", "error", err)
+		}
+	})
+
+	return func(m *Middleware) *Middleware {
+		return limitedFunc(limitFunc(m))
+	}
+}
+
+// ConfigureLimit sets the limit for the key in the store, unless the key is
+// already configured with the given number of tokens. Setting the limit
+// refills the bucket, so it is only done when the limit changes or the bucket
+// has expired.
+func ConfigureLimit(ctx context.Context, s limiter.Store, key string, tokens uint64, interval time.Duration) error {
+	current, _, err := s.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get limit: %w", err)
+	}
+	if current == tokens {
+		return nil
+	}
+
+	if err := s.Set(ctx, key, tokens, interval); err != nil {
+		return fmt.Errorf("failed to set limit: %w", err)
+	}
+	return nil
+}
+
 // UserIDKeyFunc pulls the user out of the request context and uses that to
 // ratelimit. It falls back to rate limiting by the client ip.
 func UserIDKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplimit.KeyFunc {
@@ -0,0 +1,97 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limitware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/sethvargo/go-limiter/memorystore"
+)
+
+func TestMiddleware_WithLimitFunc(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	store, err := memorystore.New(&memorystore.Config{
+		Tokens:   100,
+		Interval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var limited int
+	m, err := NewMiddleware(ctx, store,
+		AuthorizedAppKeyFunc(ctx, "test:", []byte("hmac")),
+		WithLimitFunc(func(r *http.Request) (uint64, time.Duration, bool) {
+			authApp := controller.AuthorizedAppFromContext(r.Context())
+			if authApp.RequestsPerMinute == 0 {
+				return 0, 0, false
+			}
+			return uint64(authApp.RequestsPerMinute), time.Minute, true
+		}),
+		OnRateLimited(func(r *http.Request) {
+			limited++
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(authApp *database.AuthorizedApp) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.Clone(controller.WithAuthorizedApp(ctx, authApp))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Unlimited API keys are not limited.
+	unlimited := &database.AuthorizedApp{}
+	unlimited.ID = 1
+	for i := 0; i < 5; i++ {
+		if got, want := serve(unlimited), http.StatusOK; got != want {
+			t.Fatalf("expected %d to be %d", got, want)
+		}
+	}
+
+	// Limited API keys use their own limit instead of the store's.
+	limitedApp := &database.AuthorizedApp{RequestsPerMinute: 2}
+	limitedApp.ID = 2
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := serve(limitedApp); got != want {
+			t.Errorf("request %d: expected %d to be %d", i, got, want)
+		}
+	}
+	if got, want := limited, 1; got != want {
+		t.Errorf("expected %d rate limited requests, got %d", want, got)
+	}
+
+	// Raising the limit takes effect immediately.
+	limitedApp.RequestsPerMinute = 3
+	if got, want := serve(limitedApp), http.StatusOK; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
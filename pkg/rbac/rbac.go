@@ -121,6 +121,37 @@ func PermissionNames(p Permission) []string {
 	return names
 }
 
+// Permissions returns the list of known permissions included in the given
+// permission, ordered by value. The result can be passed to
+// CompileAndAuthorize.
+func Permissions(p Permission) []Permission {
+	perms := make([]Permission, 0, len(PermissionMap))
+	for v := range PermissionMap {
+		if Can(p, v) {
+			perms = append(perms, v)
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i] < perms[j]
+	})
+	return perms
+}
+
+// PermissionsFromNames returns the permissions with the given names, as
+// returned by PermissionNames. The result can be passed to
+// CompileAndAuthorize. It returns an error if any name is unknown.
+func PermissionsFromNames(names []string) ([]Permission, error) {
+	perms := make([]Permission, 0, len(names))
+	for _, name := range names {
+		p, ok := NamePermissionMap[name]
+		if !ok {
+			return nil, fmt.Errorf("provided permission %q is unknown", name)
+		}
+		perms = append(perms, p)
+	}
+	return perms, nil
+}
+
 // Permission is a granular permission. It is an integer instead of a uint
 // because most database systems lack unsigned integer types.
 type Permission int64
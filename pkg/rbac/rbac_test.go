@@ -128,6 +128,64 @@ func TestPermissionNames(t *testing.T) {
 	}
 }
 
+func TestPermissions(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		p    Permission
+		exp  []Permission
+	}{
+		{"none", 0, []Permission{}},
+		{"single", APIKeyWrite, []Permission{APIKeyWrite}},
+		{"legacy_user", LegacyRealmUser, []Permission{CodeIssue, CodeBulkIssue, CodeRead, CodeExpire}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := Permissions(tc.p), tc.exp; !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %v to be %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPermissionsFromNames(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		names []string
+		exp   []Permission
+		err   bool
+	}{
+		{"none", nil, []Permission{}, false},
+		{"single", []string{"APIKeyWrite"}, []Permission{APIKeyWrite}, false},
+		{"multiple", []string{"CodeRead", "CodeIssue"}, []Permission{CodeRead, CodeIssue}, false},
+		{"unknown", []string{"CodeIssue", "NotAPermission"}, nil, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := PermissionsFromNames(tc.names)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if got, want := got, tc.exp; !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %v to be %v", got, want)
+			}
+		})
+	}
+}
+
 func TestPermission_String(t *testing.T) {
 	t.Parallel()
 
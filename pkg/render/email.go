@@ -46,3 +46,29 @@ func (r *Renderer) RenderEmail(tmpl string, data interface{}) ([]byte, error) {
 	}
 	return bluemonday.UGCPolicy().SanitizeBytes(b.Bytes()), nil
 }
+
+// RenderEmailHTML renders the given email HTML template by name. Unlike
+// RenderEmail, the template is executed as an HTML template, so values are
+// contextually escaped and no additional sanitization is performed.
+func (r *Renderer) RenderEmailHTML(tmpl string, data interface{}) ([]byte, error) {
+	if r.debug {
+		if err := r.loadTemplates(); err != nil {
+			return nil, fmt.Errorf("error loading templates: %w", err)
+		}
+	}
+
+	// Acquire a renderer
+	b := r.rendererPool.Get().(*bytes.Buffer)
+	b.Reset()
+	defer r.rendererPool.Put(b)
+
+	// Render into the renderer
+	if err := r.executeHTMLTemplate(b, tmpl, data); err != nil {
+		return nil, fmt.Errorf("error executing email html template: %w", err)
+	}
+
+	// Copy the bytes, since the buffer is returned to the pool.
+	out := make([]byte, b.Len())
+	copy(out, b.Bytes())
+	return out, nil
+}
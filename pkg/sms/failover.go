@@ -0,0 +1,154 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var _ Provider = (*Failover)(nil)
+
+// FailoverTarget is a single provider in a Failover chain.
+type FailoverTarget struct {
+	// Name is a human-readable name for the provider, used for reporting which
+	// provider ultimately delivered the message.
+	Name     string
+	Provider Provider
+}
+
+// FailoverResult is the result of sending a message through a Failover
+// provider.
+type FailoverResult struct {
+	// Provider is the name of the provider that delivered the message.
+	Provider string
+
+	// Attempts is the number of providers that were tried, including the one
+	// that delivered the message.
+	Attempts int
+}
+
+// FailedOver returns true if the message was delivered by a provider other
+// than the primary.
+func (r *FailoverResult) FailedOver() bool {
+	return r != nil && r.Attempts > 1
+}
+
+// Failover sends messages through an ordered list of providers. If a provider
+// returns a transient error, the next provider is tried. Permanent errors (such
+// as an invalid phone number) are returned immediately since they would fail
+// on every provider.
+type Failover struct {
+	targets []*FailoverTarget
+}
+
+// NewFailover creates a new provider which fails over between the given
+// targets, in order.
+func NewFailover(targets []*FailoverTarget) (*Failover, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("failover requires at least one provider")
+	}
+	for i, t := range targets {
+		if t == nil || t.Provider == nil {
+			return nil, fmt.Errorf("failover provider %d is nil", i)
+		}
+	}
+	return &Failover{targets: targets}, nil
+}
+
+// SendSMS sends the message, failing over to the next provider on transient
+// errors.
+func (p *Failover) SendSMS(ctx context.Context, to, message string) error {
+	_, err := p.SendSMSWithResult(ctx, to, message)
+	return err
+}
+
+// SendSMSWithResult is like SendSMS, but also returns which provider delivered
+// the message.
+func (p *Failover) SendSMSWithResult(ctx context.Context, to, message string) (*FailoverResult, error) {
+	var merr error
+	for i, t := range p.targets {
+		err := t.Provider.SendSMS(ctx, to, message)
+		if err == nil {
+			return &FailoverResult{
+				Provider: t.Name,
+				Attempts: i + 1,
+			}, nil
+		}
+
+		if merr == nil {
+			merr = err
+		}
+
+		if !IsTransient(err) {
+			return nil, err
+		}
+
+		// Do not try any more providers if the caller has gone away.
+		if ctx.Err() != nil {
+			return nil, merr
+		}
+	}
+
+	// Return the error from the primary since it is the most meaningful to the
+	// caller.
+	return nil, merr
+}
+
+// IsTransient returns true if the error is likely specific to the provider
+// that returned it, such as a full queue, throttling, or an outage. Errors that
+// cannot be attributed to a provider's API (such as network failures) are also
+// considered transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if IsSMSQueueFull(err) {
+		return true
+	}
+
+	var tErr *TwilioError
+	if errors.As(err, &tErr) {
+		// https://www.twilio.com/docs/api/errors - 20xxx are API and service
+		// errors rather than problems with the message or recipient.
+		switch tErr.Code {
+		case 20003, 20005, 20429, 20500, 20503:
+			return true
+		}
+		return false
+	}
+
+	var vErr *VonageError
+	if errors.As(err, &vErr) {
+		// https://developer.vonage.com/messaging/sms/guides/troubleshooting-sms
+		switch vErr.Status {
+		case "5", "8", "9":
+			return true
+		}
+		return false
+	}
+
+	var hErr *HTTPError
+	if errors.As(err, &hErr) {
+		return hErr.StatusCode >= http.StatusInternalServerError ||
+			hErr.StatusCode == http.StatusUnauthorized ||
+			hErr.StatusCode == http.StatusForbidden
+	}
+
+	return !errors.Is(err, context.Canceled)
+}
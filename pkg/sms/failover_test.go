@@ -0,0 +1,146 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+type testProvider struct {
+	err   error
+	calls int
+}
+
+func (p *testProvider) SendSMS(_ context.Context, _, _ string) error {
+	p.calls++
+	return p.err
+}
+
+func TestFailover_SendSMSWithResult(t *testing.T) {
+	t.Parallel()
+
+	queueFull := &TwilioError{Code: 21611, Message: "queue full"}
+	invalidNumber := &TwilioError{Code: 21211, Message: "invalid number"}
+
+	cases := []struct {
+		name         string
+		errs         []error
+		expProvider  string
+		expAttempts  int
+		expCalls     []int
+		expErr       error
+		expFailedOut bool
+	}{
+		{
+			name:        "primary_succeeds",
+			errs:        []error{nil, nil},
+			expProvider: "p0",
+			expAttempts: 1,
+			expCalls:    []int{1, 0},
+		},
+		{
+			name:         "fails_over_on_queue_full",
+			errs:         []error{queueFull, nil},
+			expProvider:  "p1",
+			expAttempts:  2,
+			expCalls:     []int{1, 1},
+			expFailedOut: true,
+		},
+		{
+			name:         "fails_over_on_server_error",
+			errs:         []error{&HTTPError{StatusCode: http.StatusBadGateway}, queueFull, nil},
+			expProvider:  "p2",
+			expAttempts:  3,
+			expCalls:     []int{1, 1, 1},
+			expFailedOut: true,
+		},
+		{
+			name:     "permanent_error_stops",
+			errs:     []error{invalidNumber, nil},
+			expCalls: []int{1, 0},
+			expErr:   invalidNumber,
+		},
+		{
+			name:     "all_fail_returns_primary",
+			errs:     []error{queueFull, ErrNoop},
+			expCalls: []int{1, 1},
+			expErr:   queueFull,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := project.TestContext(t)
+
+			providers := make([]*testProvider, 0, len(tc.errs))
+			targets := make([]*FailoverTarget, 0, len(tc.errs))
+			for i, err := range tc.errs {
+				p := &testProvider{err: err}
+				providers = append(providers, p)
+				targets = append(targets, &FailoverTarget{Name: fmt.Sprintf("p%d", i), Provider: p})
+			}
+
+			failover, err := NewFailover(targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := failover.SendSMSWithResult(ctx, "+12068675309", "hello")
+			if !errors.Is(err, tc.expErr) {
+				t.Fatalf("expected error %v to be %v", err, tc.expErr)
+			}
+
+			for i, p := range providers {
+				if got, want := p.calls, tc.expCalls[i]; got != want {
+					t.Errorf("expected provider %d to be called %d times, got %d", i, want, got)
+				}
+			}
+
+			if tc.expErr != nil {
+				return
+			}
+			if got, want := result.Provider, tc.expProvider; got != want {
+				t.Errorf("expected provider %q to be %q", got, want)
+			}
+			if got, want := result.Attempts, tc.expAttempts; got != want {
+				t.Errorf("expected attempts %d to be %d", got, want)
+			}
+			if got, want := result.FailedOver(), tc.expFailedOut; got != want {
+				t.Errorf("expected failed over %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestNewFailover(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewFailover(nil); err == nil {
+		t.Errorf("expected error for no providers")
+	}
+	if _, err := NewFailover([]*FailoverTarget{{Name: "nil"}}); err == nil {
+		t.Errorf("expected error for nil provider")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+// DefaultHTTPBodyTemplate is the request body used by the generic HTTP
+// provider when no template is configured.
+const DefaultHTTPBodyTemplate = `{"from":{{json .From}},"to":{{json .To}},"message":{{json .Message}}}`
+
+var _ Provider = (*HTTP)(nil)
+
+// HTTPConfig is the configuration for the generic HTTP provider.
+type HTTPConfig struct {
+	// Endpoint is the full URL to which messages are POSTed.
+	Endpoint string
+
+	// AuthHeader and AuthToken are the optional header name and value used to
+	// authenticate to the endpoint. If AuthHeader is blank but AuthToken is
+	// given, the token is sent as a bearer token.
+	AuthHeader string
+	AuthToken  string
+
+	// BodyTemplate is a text/template that renders the JSON request body. It
+	// has access to .From, .To, and .Message, and a "json" function which
+	// encodes a value as JSON.
+	BodyTemplate string
+
+	// From is the sender to include in the request.
+	From string
+}
+
+// HTTP sends messages by POSTing a templated JSON body to an arbitrary HTTP
+// endpoint. It exists for carriers that do not have a dedicated provider.
+type HTTP struct {
+	client *http.Client
+	config *HTTPConfig
+	tmpl   *template.Template
+}
+
+// NewHTTP creates a new generic HTTP SMS sender.
+func NewHTTP(ctx context.Context, c *HTTPConfig) (Provider, error) {
+	if c == nil {
+		return nil, fmt.Errorf("missing http configuration")
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint: scheme must be http or https")
+	}
+
+	tmpl, err := ParseHTTPBodyTemplate(c.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTP{
+		client: &http.Client{Timeout: 5 * time.Second},
+		config: c,
+		tmpl:   tmpl,
+	}, nil
+}
+
+// ParseHTTPBodyTemplate parses the given body template. If the template is
+// blank, DefaultHTTPBodyTemplate is used.
+func ParseHTTPBodyTemplate(s string) (*template.Template, error) {
+	if s == "" {
+		s = DefaultHTTPBodyTemplate
+	}
+
+	tmpl, err := template.New("body").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				if err != nil {
+					return "", err
+				}
+				return string(b), nil
+			},
+		}).
+		Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// SendSMS sends a message to the configured HTTP endpoint.
+func (p *HTTP) SendSMS(ctx context.Context, to, message string) error {
+	var body bytes.Buffer
+	if err := p.tmpl.Execute(&body, map[string]string{
+		"From":    p.config.From,
+		"To":      to,
+		"Message": message,
+	}); err != nil {
+		return fmt.Errorf("failed to render body: %w", err)
+	}
+
+	b, err := retry.NewFibonacci(250 * time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("failed to create backoff: %w", err)
+	}
+	b = retry.WithMaxRetries(4, b)
+
+	return retry.Do(ctx, b, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return fmt.Errorf("failed to build request: %w", err)
+		}
+		req.Close = true
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+
+		if token := p.config.AuthToken; token != "" {
+			if header := p.config.AuthHeader; header != "" {
+				req.Header.Set(header, token)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to make request: %w", err))
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if code := resp.StatusCode; code < http.StatusOK || code >= http.StatusMultipleChoices {
+			herr := &HTTPError{StatusCode: code, Body: string(respBody)}
+			if code >= http.StatusInternalServerError {
+				return retry.RetryableError(herr)
+			}
+			return herr
+		}
+		return nil
+	})
+}
+
+// HTTPError represents a non-successful response from a generic HTTP
+// provider.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http error %d: %s", e.StatusCode, e.Body)
+}
+
+// IsHTTPStatus returns if the given error is an HTTPError with the given
+// status code.
+func IsHTTPStatus(err error, code int) bool {
+	var hErr *HTTPError
+	if errors.As(err, &hErr) {
+		return hErr.StatusCode == code
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestHTTP_SendSMS(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		bodyTemplate string
+		status       int
+		err          bool
+		queueFull    bool
+		expBody      map[string]string
+	}{
+		{
+			name:    "default_template",
+			status:  http.StatusOK,
+			expBody: map[string]string{"from": "+15005550006", "to": "+12068675309", "message": `hello "world"`},
+		},
+		{
+			name:         "custom_template",
+			bodyTemplate: `{"recipient":{{json .To}},"text":{{json .Message}}}`,
+			status:       http.StatusAccepted,
+			expBody:      map[string]string{"recipient": "+12068675309", "text": `hello "world"`},
+		},
+		{
+			name:   "bad_request",
+			status: http.StatusBadRequest,
+			err:    true,
+		},
+		{
+			name:      "too_many_requests",
+			status:    http.StatusTooManyRequests,
+			err:       true,
+			queueFull: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := project.TestContext(t)
+
+			var lock sync.Mutex
+			var gotBody map[string]string
+			var gotAuth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				gotAuth = r.Header.Get("X-API-Key")
+
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				if err := json.Unmarshal(b, &gotBody); err != nil {
+					t.Errorf("invalid json body %q: %s", b, err)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			t.Cleanup(srv.Close)
+
+			provider, err := ProviderFor(ctx, &Config{
+				ProviderType:     ProviderTypeHTTP,
+				HTTPEndpoint:     srv.URL,
+				HTTPAuthHeader:   "X-API-Key",
+				HTTPAuthToken:    "s3cr3t",
+				HTTPBodyTemplate: tc.bodyTemplate,
+				HTTPFromNumber:   "+15005550006",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = provider.SendSMS(ctx, "+12068675309", `hello "world"`)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if got, want := IsSMSQueueFull(err), tc.queueFull; got != want {
+				t.Errorf("expected queue full %t to be %t", got, want)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if got, want := gotAuth, "s3cr3t"; got != want {
+				t.Errorf("expected auth header %q to be %q", got, want)
+			}
+			for k, v := range tc.expBody {
+				if got, want := gotBody[k], v; got != want {
+					t.Errorf("expected body %q to be %q, got %q", k, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTP(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	if _, err := NewHTTP(ctx, &HTTPConfig{Endpoint: "ftp://example.com"}); err == nil {
+		t.Errorf("expected error for invalid scheme")
+	}
+
+	if _, err := NewHTTP(ctx, &HTTPConfig{Endpoint: "https://example.com", BodyTemplate: "{{"}); err == nil {
+		t.Errorf("expected error for invalid template")
+	}
+}
@@ -22,6 +22,8 @@ package sms
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 )
 
 // ProviderType represents a type of SMS provider.
@@ -31,6 +33,8 @@ const (
 	ProviderTypeNoop     ProviderType = "NOOP"
 	ProviderTypeNoopFail ProviderType = "NOOP_FAIL"
 	ProviderTypeTwilio   ProviderType = "TWILIO"
+	ProviderTypeVonage   ProviderType = "VONAGE"
+	ProviderTypeHTTP     ProviderType = "HTTP"
 )
 
 // Config represents configuration for an SMS provider.
@@ -41,6 +45,18 @@ type Config struct {
 	TwilioAccountSid string
 	TwilioAuthToken  string
 	TwilioFromNumber string
+
+	// Vonage options
+	VonageAPIKey     string
+	VonageAPISecret  string
+	VonageFromNumber string
+
+	// HTTP options
+	HTTPEndpoint     string
+	HTTPAuthHeader   string
+	HTTPAuthToken    string
+	HTTPBodyTemplate string
+	HTTPFromNumber   string
 }
 
 type Provider interface {
@@ -49,15 +65,72 @@ type Provider interface {
 	SendSMS(ctx context.Context, to, message string) error
 }
 
+// ProviderFunc builds a new provider from the given configuration.
+type ProviderFunc func(ctx context.Context, c *Config) (Provider, error)
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[ProviderType]ProviderFunc{
+		ProviderTypeNoop: func(ctx context.Context, _ *Config) (Provider, error) {
+			return NewNoop(ctx)
+		},
+		ProviderTypeNoopFail: func(ctx context.Context, _ *Config) (Provider, error) {
+			return NewNoopFail(ctx)
+		},
+		ProviderTypeTwilio: func(ctx context.Context, c *Config) (Provider, error) {
+			return NewTwilio(ctx, c.TwilioAccountSid, c.TwilioAuthToken, c.TwilioFromNumber)
+		},
+		ProviderTypeVonage: func(ctx context.Context, c *Config) (Provider, error) {
+			return NewVonage(ctx, c.VonageAPIKey, c.VonageAPISecret, c.VonageFromNumber)
+		},
+		ProviderTypeHTTP: func(ctx context.Context, c *Config) (Provider, error) {
+			return NewHTTP(ctx, &HTTPConfig{
+				Endpoint:     c.HTTPEndpoint,
+				AuthHeader:   c.HTTPAuthHeader,
+				AuthToken:    c.HTTPAuthToken,
+				BodyTemplate: c.HTTPBodyTemplate,
+				From:         c.HTTPFromNumber,
+			})
+		},
+	}
+)
+
+// RegisterProvider registers a new provider type. It returns an error if a
+// provider with the same type is already registered.
+func RegisterProvider(typ ProviderType, fn ProviderFunc) error {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	if _, ok := providers[typ]; ok {
+		return fmt.Errorf("sms provider %q is already registered", typ)
+	}
+	providers[typ] = fn
+	return nil
+}
+
+// ProviderTypes returns the sorted list of all registered provider types.
+func ProviderTypes() []ProviderType {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	types := make([]ProviderType, 0, len(providers))
+	for typ := range providers {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// ProviderFor builds the provider for the given configuration.
 func ProviderFor(ctx context.Context, c *Config) (Provider, error) {
-	switch typ := c.ProviderType; typ {
-	case ProviderTypeNoop:
-		return NewNoop(ctx)
-	case ProviderTypeNoopFail:
-		return NewNoopFail(ctx)
-	case ProviderTypeTwilio:
-		return NewTwilio(ctx, c.TwilioAccountSid, c.TwilioAuthToken, c.TwilioFromNumber)
-	default:
-		return nil, fmt.Errorf("unknown sms provider type: %v", typ)
+	providersLock.RLock()
+	fn, ok := providers[c.ProviderType]
+	providersLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown sms provider type: %v", c.ProviderType)
 	}
+	return fn(ctx, c)
 }
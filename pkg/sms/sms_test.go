@@ -0,0 +1,57 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestRegisterProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	typ := ProviderType("TEST_REGISTER_PROVIDER")
+	if err := RegisterProvider(typ, func(ctx context.Context, _ *Config) (Provider, error) {
+		return NewNoop(ctx)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterProvider(typ, nil); err == nil {
+		t.Errorf("expected error registering duplicate provider")
+	}
+
+	var found bool
+	for _, v := range ProviderTypes() {
+		if v == typ {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected %q to be in %v", typ, ProviderTypes())
+	}
+
+	if _, err := ProviderFor(ctx, &Config{ProviderType: typ}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ProviderFor(ctx, &Config{ProviderType: "NOPE"}); err == nil {
+		t.Errorf("expected error for unknown provider")
+	}
+}
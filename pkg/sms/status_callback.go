@@ -0,0 +1,43 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+)
+
+// contextKey is a unique type to avoid clashing with other packages that use
+// context's to pass data.
+type contextKey string
+
+const contextKeyStatusCallback = contextKey("statusCallback")
+
+// WithStatusCallback returns a context that asks providers which support
+// delivery status callbacks to report the status of messages sent with the
+// context to the given URL. Providers which do not support callbacks ignore
+// the value.
+func WithStatusCallback(ctx context.Context, u string) context.Context {
+	return context.WithValue(ctx, contextKeyStatusCallback, u)
+}
+
+// StatusCallbackFromContext returns the delivery status callback URL from the
+// context, or the empty string if none was set.
+func StatusCallbackFromContext(ctx context.Context) string {
+	v, ok := ctx.Value(contextKeyStatusCallback).(string)
+	if !ok {
+		return ""
+	}
+	return v
+}
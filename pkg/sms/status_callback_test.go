@@ -0,0 +1,43 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestStatusCallbackFromContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := project.TestContext(t)
+
+	if got, want := StatusCallbackFromContext(ctx), ""; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	ctx = WithStatusCallback(ctx, "https://example.com/webhooks/1/twilio/status/abc")
+	if got, want := StatusCallbackFromContext(ctx), "https://example.com/webhooks/1/twilio/status/abc"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Values of other types are ignored.
+	ctx = context.WithValue(ctx, contextKeyStatusCallback, 1)
+	if got, want := StatusCallbackFromContext(ctx), ""; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
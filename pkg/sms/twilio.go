@@ -52,7 +52,9 @@ func NewTwilio(ctx context.Context, accountSid, authToken, from string) (Provide
 	}, nil
 }
 
-// SendSMS sends a message using the Twilio API.
+// SendSMS sends a message using the Twilio API. If the context has a status
+// callback (see WithStatusCallback), Twilio reports the message's delivery
+// status to it.
 func (p *Twilio) SendSMS(ctx context.Context, to, message string) error {
 	b, err := retry.NewFibonacci(250 * time.Millisecond)
 	if err != nil {
@@ -70,6 +72,9 @@ func (p *Twilio) SendSMS(ctx context.Context, to, message string) error {
 		}
 
 		params.Set("Body", message)
+		if cb := StatusCallbackFromContext(ctx); cb != "" {
+			params.Set("StatusCallback", cb)
+		}
 		body := strings.NewReader(params.Encode())
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/Messages.json", body)
@@ -132,9 +137,12 @@ func (e *TwilioError) Error() string {
 	return e.Message
 }
 
-// IsSMSQueueFull returns if the given error is Twilio's message queue full error.
+// IsSMSQueueFull returns if the given error is a provider's message queue full
+// or throttling error.
 func IsSMSQueueFull(err error) bool {
-	return IsTwilioCode(err, 21611) // https://www.twilio.com/docs/api/errors/21611
+	return IsTwilioCode(err, 21611) || // https://www.twilio.com/docs/api/errors/21611
+		IsVonageStatus(err, VonageStatusThrottled) ||
+		IsHTTPStatus(err, http.StatusTooManyRequests)
 }
 
 // IsTwilioCode returns if the given error matches a Twilio error code.
@@ -0,0 +1,141 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+// VonageEndpoint is the default endpoint for the Vonage SMS API.
+const VonageEndpoint = "https://rest.nexmo.com/sms/json"
+
+// VonageStatusThrottled is the status Vonage returns when the account is
+// sending messages faster than the allowed throughput.
+const VonageStatusThrottled = "1"
+
+var _ Provider = (*Vonage)(nil)
+
+// Vonage sends messages via the Vonage (formerly Nexmo) SMS API.
+type Vonage struct {
+	client    *http.Client
+	endpoint  string
+	apiKey    string
+	apiSecret string
+	from      string
+}
+
+// NewVonage creates a new Vonage SMS sender with the given auth.
+func NewVonage(ctx context.Context, apiKey, apiSecret, from string) (Provider, error) {
+	return &Vonage{
+		client:    &http.Client{Timeout: 5 * time.Second},
+		endpoint:  VonageEndpoint,
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		from:      from,
+	}, nil
+}
+
+// vonageResponse is the response from the Vonage SMS API.
+type vonageResponse struct {
+	Messages []*struct {
+		Status    string `json:"status"`
+		ErrorText string `json:"error-text"`
+	} `json:"messages"`
+}
+
+// SendSMS sends a message using the Vonage API.
+func (p *Vonage) SendSMS(ctx context.Context, to, message string) error {
+	b, err := retry.NewFibonacci(250 * time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("failed to create backoff: %w", err)
+	}
+	b = retry.WithMaxRetries(4, b)
+
+	return retry.Do(ctx, b, func(ctx context.Context) error {
+		params := url.Values{}
+		params.Set("api_key", p.apiKey)
+		params.Set("api_secret", p.apiSecret)
+		params.Set("from", strings.TrimPrefix(p.from, "+"))
+		params.Set("to", strings.TrimPrefix(to, "+"))
+		params.Set("text", message)
+		params.Set("type", "unicode")
+		body := strings.NewReader(params.Encode())
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, body)
+		if err != nil {
+			return fmt.Errorf("failed to build request: %w", err)
+		}
+		req.Close = true
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to make request: %w", err))
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if code := resp.StatusCode; code < http.StatusOK || code >= http.StatusMultipleChoices {
+			return fmt.Errorf("vonage error %d: %s", code, respBody)
+		}
+
+		// Vonage returns a 200 even when delivery fails, the actual status is in
+		// the response body, one per message part.
+		var vresp vonageResponse
+		if err := json.Unmarshal(respBody, &vresp); err != nil {
+			return fmt.Errorf("failed to parse vonage response: %w", err)
+		}
+		for _, m := range vresp.Messages {
+			if m.Status != "0" {
+				return &VonageError{Status: m.Status, Message: m.ErrorText}
+			}
+		}
+		return nil
+	})
+}
+
+// VonageError represents an error returned from the Vonage API.
+type VonageError struct {
+	Status  string
+	Message string
+}
+
+func (e *VonageError) Error() string {
+	return fmt.Sprintf("vonage error %s: %s", e.Status, e.Message)
+}
+
+// IsVonageStatus returns if the given error matches a Vonage status code.
+func IsVonageStatus(err error, status string) bool {
+	var vErr *VonageError
+	if errors.As(err, &vErr) {
+		return vErr.Status == status
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestVonage_SendSMS(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		status    string
+		err       bool
+		queueFull bool
+	}{
+		{
+			name:   "sends",
+			status: "0",
+		},
+		{
+			name:      "throttled",
+			status:    VonageStatusThrottled,
+			err:       true,
+			queueFull: true,
+		},
+		{
+			name:   "invalid_credentials",
+			status: "4",
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := project.TestContext(t)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				if got, want := r.PostForm.Get("to"), "12068675309"; got != want {
+					t.Errorf("expected to %q to be %q", got, want)
+				}
+				if got, want := r.PostForm.Get("api_key"), "key"; got != want {
+					t.Errorf("expected api_key %q to be %q", got, want)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"message-count":"1","messages":[{"status":%q,"error-text":"nope"}]}`, tc.status)
+			}))
+			t.Cleanup(srv.Close)
+
+			provider, err := NewVonage(ctx, "key", "secret", "+15005550006")
+			if err != nil {
+				t.Fatal(err)
+			}
+			provider.(*Vonage).endpoint = srv.URL
+
+			err = provider.SendSMS(ctx, "+12068675309", "testing 123")
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if got, want := IsSMSQueueFull(err), tc.queueFull; got != want {
+				t.Errorf("expected queue full %t to be %t", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package totp implements time-based one-time passwords (RFC 6238) as used by
+// authenticator apps. The codes are computed and checked by
+// github.com/pquerna/otp; this package adds replay protection by reporting
+// the time step of each accepted code.
+package totp
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	pqtotp "github.com/pquerna/otp/totp"
+)
+
+const (
+	// Digits is the number of digits in a code.
+	Digits = 6
+
+	// Period is how long each code is valid.
+	Period = 30 * time.Second
+
+	// Skew is the number of periods before and after the current period for
+	// which codes are accepted, to allow for clock drift.
+	Skew = 1
+
+	// secretBytes is the length of generated secrets. RFC 4226 recommends 160
+	// bits.
+	secretBytes = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// opts are the code options shared by authenticator apps.
+var opts = hotp.ValidateOpts{
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// GenerateSecret generates a random base32-encoded secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth URI for the secret, which authenticator apps import
+// from a QR code.
+func URI(issuer, account, secret string) (string, error) {
+	b, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := pqtotp.Generate(pqtotp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      uint(Period / time.Second),
+		Secret:      b,
+		Digits:      opts.Digits,
+		Algorithm:   opts.Algorithm,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to build uri: %w", err)
+	}
+	return key.URL(), nil
+}
+
+// Step returns the time step at the given time.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the secret at the given time step.
+func Code(secret string, step int64) (string, error) {
+	code, err := hotp.GenerateCodeCustom(normalizeSecret(secret), uint64(step), opts)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+	return code, nil
+}
+
+// Validate checks the code against the secret at the given time, allowing for
+// Skew. It returns the matching time step, so callers can reject a code which
+// was already used. Codes at or before lastStep are rejected.
+func Validate(secret, input string, t time.Time, lastStep int64) (int64, bool, error) {
+	secret = normalizeSecret(secret)
+	if _, err := decodeSecret(secret); err != nil {
+		return 0, false, err
+	}
+
+	input = strings.ReplaceAll(strings.TrimSpace(input), " ", "")
+	if len(input) != Digits {
+		return 0, false, nil
+	}
+
+	current := Step(t)
+	for i := -Skew; i <= Skew; i++ {
+		step := current + int64(i)
+		if step <= lastStep {
+			continue
+		}
+		ok, err := hotp.ValidateCustom(input, uint64(step), secret, opts)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to validate code: %w", err)
+		}
+		if ok {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// normalizeSecret removes spaces and padding from a base32 secret, and upper
+// cases it.
+func normalizeSecret(secret string) string {
+	s := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return strings.TrimRight(s, "=")
+}
+
+// decodeSecret decodes a base32 secret, ignoring case, spaces, and padding.
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(normalizeSecret(secret))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+)
+
+// rfcSecret is the SHA-1 secret from RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+
+	// RFC 6238 appendix B, truncated to 6 digits.
+	cases := []struct {
+		unix int64
+		exp  string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range cases {
+		got, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.exp {
+			t.Errorf("at %d: expected %q to be %q", tc.unix, got, tc.exp)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	previous, err := Code(rfcSecret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooOld, err := Code(rfcSecret, step-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		input    string
+		lastStep int64
+		ok       bool
+		step     int64
+	}{
+		{name: "current", input: "050471", ok: true, step: step},
+		{name: "spaces", input: " 050 471 ", ok: true, step: step},
+		{name: "previous_period", input: previous, ok: true, step: step - 1},
+		{name: "too_old", input: tooOld},
+		{name: "wrong", input: "123456"},
+		{name: "short", input: "12345"},
+		{name: "replayed", input: "050471", lastStep: step},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok, err := Validate(rfcSecret, tc.input, now, tc.lastStep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.ok {
+				t.Fatalf("expected %t to be %t", ok, tc.ok)
+			}
+			if got != tc.step {
+				t.Errorf("expected step %d to be %d", got, tc.step)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	t.Parallel()
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(strings.ToLower(secret), 1); err != nil {
+		t.Errorf("expected generated secret to be valid: %v", err)
+	}
+
+	uri, err := URI("Example Realm", "user@example.com", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/Example%20Realm:user@example.com?") {
+		t.Errorf("unexpected uri %q", uri)
+	}
+
+	// The URI round trips through the library's parser.
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := key.Secret(), secret; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := key.Period(), uint64(30); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth limits the nesting of decoded CBOR items.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR (RFC 8949) item in b and returns it along
+// with the remaining bytes. Only the subset of CBOR used by WebAuthn is
+// supported: definite-length integers, byte and text strings, arrays, maps,
+// booleans, and null. Integers decode as int64, byte strings as []byte, text
+// strings as string, arrays as []interface{}, and maps as
+// map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("cbor: nesting too deep")
+	}
+	if len(b) < 1 {
+		return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	// Simple values.
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22, 23:
+			return nil, b, nil
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		if len(b) < 1 {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		arg, b = uint64(b[0]), b[1:]
+	case info == 25:
+		if len(b) < 2 {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		arg, b = uint64(binary.BigEndian.Uint16(b)), b[2:]
+	case info == 26:
+		if len(b) < 4 {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		arg, b = uint64(binary.BigEndian.Uint32(b)), b[4:]
+	case info == 27:
+		if len(b) < 8 {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		arg, b = binary.BigEndian.Uint64(b), b[8:]
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return int64(arg), b, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return -1 - int64(arg), b, nil
+	case 2, 3:
+		if arg > uint64(len(b)) {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		v := make([]byte, arg)
+		copy(v, b[:arg])
+		if major == 3 {
+			return string(v), b[arg:], nil
+		}
+		return v, b[arg:], nil
+	case 4:
+		if arg > uint64(len(b)) {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			var err error
+			if item, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if arg > uint64(len(b)) {
+			return nil, nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var k, v interface{}
+			var err error
+			if k, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+			}
+			if v, b, err = decodeCBORItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, b, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		hex  string
+		exp  interface{}
+		rest int
+		err  bool
+	}{
+		// Examples from RFC 8949 appendix A.
+		{name: "zero", hex: "00", exp: int64(0)},
+		{name: "uint8", hex: "1864", exp: int64(100)},
+		{name: "uint32", hex: "1a000f4240", exp: int64(1000000)},
+		{name: "negative", hex: "3903e7", exp: int64(-1000)},
+		{name: "bytes", hex: "4401020304", exp: []byte{1, 2, 3, 4}},
+		{name: "text", hex: "6449455446", exp: "IETF"},
+		{name: "array", hex: "83010203", exp: []interface{}{int64(1), int64(2), int64(3)}},
+		{name: "map", hex: "a26161016162820203", exp: map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{name: "true", hex: "f5", exp: true},
+		{name: "null", hex: "f6", exp: nil},
+		{name: "trailing", hex: "0102", exp: int64(1), rest: 1},
+		{name: "truncated_bytes", hex: "4401", err: true},
+		{name: "indefinite", hex: "9f01ff", err: true},
+		{name: "float", hex: "f93c00", err: true},
+		{name: "huge_array", hex: "9bffffffffffffffff", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := hex.DecodeString(tc.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, rest, err := decodeCBOR(b)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+
+			if diff := cmp.Diff(tc.exp, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+			if got, want := len(rest), tc.rest; got != want {
+				t.Errorf("expected %d remaining bytes to be %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn/webauthntest"
+)
+
+func TestVerifyAssertion_EdDSA(t *testing.T) {
+	t.Parallel()
+
+	rp := &webauthn.RelyingParty{ID: "example.com", Origin: "https://example.com"}
+	enc := base64.RawURLEncoding
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred := &webauthn.Credential{
+		ID: []byte("ed25519"),
+		PublicKey: webauthntest.EncodeCBOR(t, map[interface{}]interface{}{
+			1:  1,  // kty: OKP
+			3:  -8, // alg: EdDSA
+			-1: 6,  // crv: Ed25519
+			-2: []byte(pub),
+		}),
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientData, err := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": enc.EncodeToString(challenge),
+		"origin":    rp.Origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	authData := append(rpIDHash[:], 0x01, 0, 0, 0, 0)
+	clientDataHash := sha256.Sum256(clientData)
+	sig := ed25519.Sign(priv, append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	resp := &webauthn.AssertionResponse{
+		ID:                enc.EncodeToString(cred.ID),
+		ClientDataJSON:    enc.EncodeToString(clientData),
+		AuthenticatorData: enc.EncodeToString(authData),
+		Signature:         enc.EncodeToString(sig),
+	}
+
+	// Authenticators without a counter always report zero.
+	for i := 0; i < 2; i++ {
+		if _, err := rp.VerifyAssertion(challenge, cred, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unsupported keys are rejected.
+	cred.PublicKey = webauthntest.EncodeCBOR(t, map[interface{}]interface{}{1: 2, 3: -36})
+	if _, err := rp.VerifyAssertion(challenge, cred, resp); err == nil {
+		t.Errorf("expected unsupported key to fail")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+
+package webauthn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, s := range []string{
+		"00", "1864", "3903e7", "4401020304", "6449455446", "83010203",
+		"a26161016162820203", "f5", "f6", "0102", "4401", "9f01ff",
+		"9bffffffffffffffff", "8181818181818181818181818181818181818100",
+	} {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, rest, err := decodeCBOR(b)
+		if err != nil {
+			return
+		}
+
+		// The remaining bytes are always a suffix of the input.
+		if len(rest) >= len(b) || !bytes.HasSuffix(b, rest) {
+			t.Errorf("remaining %x is not a proper suffix of %x", rest, b)
+		}
+	})
+}
+
+func FuzzParsePublicKey(f *testing.F) {
+	for _, s := range []string{
+		// ES256, RS256, and EdDSA keys from the specification test vectors.
+		"a5010203262001215820afefa16f97ca9b2d23eb86ccb64098d20db90856062eb249c33a9b672f26df61225820930a56b87a2fca66334b03458abf879717c12cc68ed73290af2e2664796b9220",
+		"a4010303390100205901b403fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff800000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000012143010001",
+		"a401010327200621582044e06ddd331c36a8dc667bab52bcae63486c916aa5e339e6acebaa84934bf832",
+		"a20102033823", // Unsupported ES512 key.
+	} {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b, []byte("message"), []byte("signature"))
+	}
+
+	f.Fuzz(func(t *testing.T, b, message, sig []byte) {
+		key, err := parsePublicKey(b)
+		if err != nil {
+			return
+		}
+
+		// Verification with arbitrary keys and signatures must not panic.
+		_ = key.verify(message, sig)
+	})
+}
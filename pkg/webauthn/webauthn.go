@@ -0,0 +1,362 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webauthn implements the relying party side of Web Authentication
+// (https://www.w3.org/TR/webauthn-2/) for security keys used as a second
+// factor. Attestation is not requested or verified, since the server accepts
+// any authenticator the user chooses to register.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// challengeBytes is the length of generated challenges.
+	challengeBytes = 32
+
+	// Timeout is how long the browser waits for the user to use their
+	// security key.
+	Timeout = 2 * time.Minute
+
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+// encoding is the base64url encoding used for binary values in JSON.
+var encoding = base64.RawURLEncoding
+
+// RelyingParty is the server's WebAuthn identity.
+type RelyingParty struct {
+	// ID is the relying party ID, which is the server's hostname.
+	ID string
+
+	// Name is the human-readable name shown by the browser.
+	Name string
+
+	// Origin is the expected origin of requests, such as
+	// "https://example.com".
+	Origin string
+}
+
+// Credential is a registered security key.
+type Credential struct {
+	// ID is the credential ID assigned by the authenticator.
+	ID []byte
+
+	// PublicKey is the CBOR-encoded COSE public key.
+	PublicKey []byte
+
+	// SignCount is the authenticator's signature counter, used to detect
+	// cloned authenticators. Authenticators which do not implement a counter
+	// always report zero.
+	SignCount uint32
+}
+
+// NewChallenge generates a random challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, challengeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return b, nil
+}
+
+// CreationOptions are the options passed to navigator.credentials.create.
+// Binary values are base64url-encoded.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []*CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout          int64                   `json:"timeout"`
+	Attestation      string                  `json:"attestation"`
+	ExcludeCreds     []*CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSel struct {
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions are the options passed to navigator.credentials.get. Binary
+// values are base64url-encoded.
+type RequestOptions struct {
+	Challenge        string                  `json:"challenge"`
+	RPID             string                  `json:"rpId"`
+	Timeout          int64                   `json:"timeout"`
+	AllowCredentials []*CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                  `json:"userVerification"`
+}
+
+// CredentialParameter is an acceptable credential algorithm.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a registered credential.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// AttestationResponse is the result of navigator.credentials.create. Binary
+// values are base64url-encoded.
+type AttestationResponse struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+// AssertionResponse is the result of navigator.credentials.get. Binary values
+// are base64url-encoded.
+type AssertionResponse struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+}
+
+// CreationOptions returns the options to register a new credential for the
+// user. Existing credentials are excluded, so a security key cannot be
+// registered twice.
+func (rp *RelyingParty) CreationOptions(challenge, userID []byte, userName, displayName string, existing [][]byte) *CreationOptions {
+	opts := &CreationOptions{
+		Challenge: encoding.EncodeToString(challenge),
+		PubKeyCredParams: []*CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:      Timeout.Milliseconds(),
+		Attestation:  "none",
+		ExcludeCreds: descriptors(existing),
+	}
+	opts.RP.ID = rp.ID
+	opts.RP.Name = rp.Name
+	opts.User.ID = encoding.EncodeToString(userID)
+	opts.User.Name = userName
+	opts.User.DisplayName = displayName
+	opts.AuthenticatorSel.UserVerification = "discouraged"
+	return opts
+}
+
+// RequestOptions returns the options to authenticate with one of the
+// registered credentials.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allowed [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        encoding.EncodeToString(challenge),
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: descriptors(allowed),
+		UserVerification: "discouraged",
+	}
+}
+
+// VerifyRegistration verifies the response to a registration ceremony with
+// the given challenge, and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *AttestationResponse) (*Credential, error) {
+	if resp == nil {
+		return nil, fmt.Errorf("missing response")
+	}
+
+	if _, err := rp.verifyClientData(resp.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := encoding.DecodeString(resp.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object encoding: %w", err)
+	}
+	v, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attestation object: %w", err)
+	}
+	attestation, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("attestation object is not a map")
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation object is missing authData")
+	}
+
+	flags, signCount, rest, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("authenticator data is missing the credential")
+	}
+
+	// Attested credential data: AAGUID (16), credential ID length (2),
+	// credential ID, and the COSE public key.
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("authenticator data is too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || len(rest) < idLen {
+		return nil, fmt.Errorf("invalid credential ID")
+	}
+	credentialID := append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	// The public key is followed by extensions, if any.
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	rawKey := append([]byte(nil), rest[:len(rest)-len(extensions)]...)
+	if _, err := parsePublicKey(rawKey); err != nil {
+		return nil, err
+	}
+
+	if id, err := encoding.DecodeString(resp.ID); err != nil || !bytes.Equal(id, credentialID) {
+		return nil, fmt.Errorf("credential ID does not match authenticator data")
+	}
+
+	return &Credential{
+		ID:        credentialID,
+		PublicKey: rawKey,
+		SignCount: signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response to an authentication ceremony with the
+// given challenge using the registered credential. It returns the
+// authenticator's new signature counter, which should be saved.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, resp *AssertionResponse) (uint32, error) {
+	if resp == nil || cred == nil {
+		return 0, fmt.Errorf("missing response")
+	}
+
+	if id, err := encoding.DecodeString(resp.ID); err != nil || !bytes.Equal(id, cred.ID) {
+		return 0, fmt.Errorf("credential ID does not match")
+	}
+
+	clientData, err := rp.verifyClientData(resp.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := encoding.DecodeString(resp.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("invalid authenticator data encoding: %w", err)
+	}
+	_, signCount, _, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+
+	sig, err := encoding.DecodeString(resp.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	message := append(append([]byte(nil), authData...), clientDataHash[:]...)
+	if err := key.verify(message, sig); err != nil {
+		return 0, err
+	}
+
+	// A counter which did not increase indicates a cloned authenticator.
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return 0, fmt.Errorf("signature counter did not increase")
+	}
+	return signCount, nil
+}
+
+// verifyClientData verifies the client data's type, challenge, and origin, and
+// returns the raw client data.
+func (rp *RelyingParty) verifyClientData(s, typ string, challenge []byte) ([]byte, error) {
+	raw, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client data encoding: %w", err)
+	}
+
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("failed to decode client data: %w", err)
+	}
+
+	if clientData.Type != typ {
+		return nil, fmt.Errorf("client data type %q is not %q", clientData.Type, typ)
+	}
+
+	got, err := encoding.DecodeString(clientData.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return nil, fmt.Errorf("challenge does not match")
+	}
+
+	if clientData.Origin != rp.Origin {
+		return nil, fmt.Errorf("origin %q is not %q", clientData.Origin, rp.Origin)
+	}
+	return raw, nil
+}
+
+// parseAuthenticatorData verifies the relying party ID hash and user presence
+// flag, and returns the flags, signature counter, and remaining data.
+func (rp *RelyingParty) parseAuthenticatorData(b []byte) (byte, uint32, []byte, error) {
+	if len(b) < 37 {
+		return 0, 0, nil, fmt.Errorf("authenticator data is too short")
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(b[:32], rpIDHash[:]) != 1 {
+		return 0, 0, nil, fmt.Errorf("relying party ID does not match")
+	}
+
+	flags := b[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, nil, fmt.Errorf("user was not present")
+	}
+
+	return flags, binary.BigEndian.Uint32(b[33:37]), b[37:], nil
+}
+
+// descriptors builds the credential descriptors for the IDs.
+func descriptors(ids [][]byte) []*CredentialDescriptor {
+	list := make([]*CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, &CredentialDescriptor{
+			Type: "public-key",
+			ID:   encoding.EncodeToString(id),
+		})
+	}
+	return list
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn/webauthntest"
+)
+
+func TestRelyingParty(t *testing.T) {
+	t.Parallel()
+
+	rp := &webauthn.RelyingParty{
+		ID:     "example.com",
+		Name:   "Example",
+		Origin: "https://example.com",
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := webauthntest.NewAuthenticator(t)
+	opts := rp.CreationOptions(challenge, []byte("1"), "user@example.com", "User", nil)
+	attestation := authenticator.Register(t, rp.Origin, opts)
+
+	t.Run("register_wrong_challenge", func(t *testing.T) {
+		t.Parallel()
+
+		other, err := webauthn.NewChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rp.VerifyRegistration(other, attestation); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("register_wrong_origin", func(t *testing.T) {
+		t.Parallel()
+
+		resp := authenticator.Register(t, "https://evil.example", opts)
+		if _, err := rp.VerifyRegistration(challenge, resp); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("register_wrong_rp_id", func(t *testing.T) {
+		t.Parallel()
+
+		other := *opts
+		other.RP.ID = "evil.example"
+		resp := authenticator.Register(t, rp.Origin, &other)
+		if _, err := rp.VerifyRegistration(challenge, resp); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	cred, err := rp.VerifyRegistration(challenge, attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cred.ID, authenticator.CredentialID) {
+		t.Errorf("expected credential ID %x to be %x", cred.ID, authenticator.CredentialID)
+	}
+
+	// Authenticate.
+	challenge, err = webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestOpts := rp.RequestOptions(challenge, [][]byte{cred.ID})
+	if got, want := len(requestOpts.AllowCredentials), 1; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+
+	assertion := authenticator.Assert(t, rp.Origin, requestOpts)
+	signCount, err := rp.VerifyAssertion(challenge, cred, assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := signCount, authenticator.SignCount; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Replaying the assertion fails once the counter is saved.
+	cred.SignCount = signCount
+	if _, err := rp.VerifyAssertion(challenge, cred, assertion); err == nil {
+		t.Errorf("expected replayed assertion to fail")
+	}
+
+	// Tampered signatures fail.
+	assertion = authenticator.Assert(t, rp.Origin, requestOpts)
+	tampered := *assertion
+	tampered.Signature = assertion.AuthenticatorData
+	if _, err := rp.VerifyAssertion(challenge, cred, &tampered); err == nil {
+		t.Errorf("expected tampered assertion to fail")
+	}
+
+	// Assertions from another authenticator fail.
+	other := webauthntest.NewAuthenticator(t)
+	other.CredentialID = cred.ID
+	if _, err := rp.VerifyAssertion(challenge, cred, other.Assert(t, rp.Origin, requestOpts)); err == nil {
+		t.Errorf("expected assertion from another key to fail")
+	}
+
+	if _, err := rp.VerifyAssertion(challenge, cred, assertion); err != nil {
+		t.Errorf("expected valid assertion, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webauthntest provides a software security key for testing WebAuthn
+// ceremonies.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/webauthn"
+)
+
+var encoding = base64.RawURLEncoding
+
+// Authenticator is a software security key with a single ES256 credential.
+type Authenticator struct {
+	// CredentialID is the ID of the authenticator's credential.
+	CredentialID []byte
+
+	// SignCount is the signature counter, incremented on each assertion.
+	SignCount uint32
+
+	key *ecdsa.PrivateKey
+}
+
+// NewAuthenticator creates a new authenticator.
+func NewAuthenticator(tb testing.TB) *Authenticator {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		tb.Fatal(err)
+	}
+
+	return &Authenticator{
+		CredentialID: id,
+		key:          key,
+	}
+}
+
+// Register responds to the registration options as a browser would.
+func (a *Authenticator) Register(tb testing.TB, origin string, opts *webauthn.CreationOptions) *webauthn.AttestationResponse {
+	tb.Helper()
+
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	publicKey := EncodeCBOR(tb, map[interface{}]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: x,
+		-3: y,
+	})
+
+	var idLen [2]byte
+	binary.BigEndian.PutUint16(idLen[:], uint16(len(a.CredentialID)))
+
+	authData := a.authData(opts.RP.ID, 0x41, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = append(authData, idLen[:]...)
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation := EncodeCBOR(tb, map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+
+	return &webauthn.AttestationResponse{
+		ID:                encoding.EncodeToString(a.CredentialID),
+		ClientDataJSON:    clientData(tb, "webauthn.create", opts.Challenge, origin),
+		AttestationObject: encoding.EncodeToString(attestation),
+	}
+}
+
+// Assert responds to the authentication options as a browser would.
+func (a *Authenticator) Assert(tb testing.TB, origin string, opts *webauthn.RequestOptions) *webauthn.AssertionResponse {
+	tb.Helper()
+
+	a.SignCount++
+	authData := a.authData(opts.RPID, 0x01, a.SignCount)
+
+	clientDataJSON := clientData(tb, "webauthn.get", opts.Challenge, origin)
+	rawClientData, err := encoding.DecodeString(clientDataJSON)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return &webauthn.AssertionResponse{
+		ID:                encoding.EncodeToString(a.CredentialID),
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: encoding.EncodeToString(authData),
+		Signature:         encoding.EncodeToString(sig),
+	}
+}
+
+// authData builds the authenticator data header.
+func (a *Authenticator) authData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	b := append([]byte(nil), rpIDHash[:]...)
+	b = append(b, flags)
+
+	var counter [4]byte
+	binary.BigEndian.PutUint32(counter[:], signCount)
+	return append(b, counter[:]...)
+}
+
+// clientData builds the base64url-encoded client data JSON.
+func clientData(tb testing.TB, typ, challenge, origin string) string {
+	tb.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return encoding.EncodeToString(b)
+}
+
+// EncodeCBOR encodes ints, byte strings, text strings, booleans, nil, arrays,
+// and maps as CBOR. Map keys are sorted so the output is deterministic.
+func EncodeCBOR(tb testing.TB, v interface{}) []byte {
+	tb.Helper()
+
+	header := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		default:
+			b := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[1:], uint32(n))
+			return b
+		}
+	}
+
+	switch t := v.(type) {
+	case int:
+		if t < 0 {
+			return header(1, uint64(-1-t))
+		}
+		return header(0, uint64(t))
+	case []byte:
+		return append(header(2, uint64(len(t))), t...)
+	case string:
+		return append(header(3, uint64(len(t))), t...)
+	case bool:
+		if t {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []interface{}:
+		b := header(4, uint64(len(t)))
+		for _, item := range t {
+			b = append(b, EncodeCBOR(tb, item)...)
+		}
+		return b
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+
+		b := header(5, uint64(len(t)))
+		for _, k := range keys {
+			b = append(b, EncodeCBOR(tb, k)...)
+			b = append(b, EncodeCBOR(tb, t[k])...)
+		}
+		return b
+	default:
+		tb.Fatalf("unsupported type %T", v)
+		return nil
+	}
+}
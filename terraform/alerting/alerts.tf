@@ -57,6 +57,9 @@ locals {
     # e2e-redirect runs every 5 minutes, alert after 2 failures
     "e2e-redirect" = { metric = "e2e/redirect/success", window = 10 * local.minute + 1 * local.minute },
 
+    # job-worker runs every 1m, alert after 5 failures
+    "job-worker" = { metric = "job_worker/success", window = 5 * local.minute + 1 * local.minute },
+
     # modeler runs every 4h, alert after 2 failures
     "modeler" = { metric = "modeler/success", window = 8 * local.hour + 10 * local.minute },
 
@@ -69,8 +72,14 @@ locals {
     # rotation-realm-key runs every 15m, alert after 2 failures
     "rotation-realm-key" = { metric = "rotation/verification/success", window = 30 * local.minute + 5 * local.minute }
 
+    # sms-outbox runs every 1m, alert after 5 failures
+    "sms-outbox" = { metric = "sms_outbox/success", window = 5 * local.minute + 1 * local.minute }
+
     # stats-puller runs every 15m, alert after 2 failures
     "stats-puller" = { metric = "statspuller/success", window = 30 * local.minute + 5 * local.minute }
+
+    # webhook-dispatcher runs every 1m, alert after 5 failures
+    "webhook-dispatcher" = { metric = "webhook_dispatcher/success", window = 5 * local.minute + 1 * local.minute }
   }, var.forward_progress_indicators)
 }
 
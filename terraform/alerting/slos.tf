@@ -29,16 +29,19 @@ locals {
     apiserver = merge(local.default_per_service_slo,
       { enable_availability_slo = true,
     enable_fast_burn_alert = true })
-    appsync      = local.default_per_service_slo
-    cleanup      = local.default_per_service_slo
-    e2e-runner   = local.default_per_service_slo
-    enx-redirect = local.default_per_service_slo
-    modeler      = local.default_per_service_slo
-    rotation     = local.default_per_service_slo
+    appsync           = local.default_per_service_slo
+    cleanup           = local.default_per_service_slo
+    e2e-runner        = local.default_per_service_slo
+    enx-redirect      = local.default_per_service_slo
+    job-worker        = local.default_per_service_slo
+    modeler           = local.default_per_service_slo
+    rotation          = local.default_per_service_slo
     server = merge(local.default_per_service_slo,
       { enable_latency_alert = true,
     latency_threshold = 2000 })
-    stats-puller = local.default_per_service_slo
+    sms-outbox         = local.default_per_service_slo
+    stats-puller       = local.default_per_service_slo
+    webhook-dispatcher = local.default_per_service_slo
   }
 }
 
@@ -93,6 +93,7 @@ resource "google_cloud_run_service" "apiserver" {
             local.firebase_config,
             local.gcp_config,
             local.issue_config,
+            local.sms_status_callback_config,
             local.rate_limit_config,
             local.signing_config,
             local.observability_config,
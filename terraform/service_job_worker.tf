@@ -0,0 +1,205 @@
+# Copyright 2021 the Exposure Notifications Verification Server authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+resource "google_service_account" "job-worker" {
+  project      = var.project
+  account_id   = "en-ver-job-worker-sa"
+  display_name = "Verification job worker"
+}
+
+resource "google_service_account_iam_member" "cloudbuild-deploy-job-worker" {
+  service_account_id = google_service_account.job-worker.id
+  role               = "roles/iam.serviceAccountUser"
+  member             = "serviceAccount:${local.cloudbuild_email}"
+}
+
+resource "google_project_iam_member" "job-worker-observability" {
+  for_each = local.observability_iam_roles
+  project  = var.project
+  role     = each.key
+  member   = "serviceAccount:${google_service_account.job-worker.email}"
+}
+
+# The job worker creates users when processing user imports.
+resource "google_project_iam_member" "job-worker-firebase-admin" {
+  project = var.project
+  role    = "roles/firebaseauth.admin"
+  member  = "serviceAccount:${google_service_account.job-worker.email}"
+}
+
+resource "google_kms_key_ring_iam_member" "job-worker-verification-signer-verifier" {
+  key_ring_id = google_kms_key_ring.verification.self_link
+  role        = "roles/cloudkms.signerVerifier"
+  member      = "serviceAccount:${google_service_account.job-worker.email}"
+}
+
+resource "google_kms_crypto_key_iam_member" "job-worker-database-encrypter" {
+  crypto_key_id = google_kms_crypto_key.database-encrypter.self_link
+  role          = "roles/cloudkms.cryptoKeyEncrypterDecrypter"
+  member        = "serviceAccount:${google_service_account.job-worker.email}"
+}
+
+locals {
+  job_worker_secrets = flatten([
+    local.database_secrets,
+    local.redis_secrets,
+  ])
+}
+
+resource "google_secret_manager_secret_iam_member" "job-worker-secrets" {
+  count     = length(local.job_worker_secrets)
+  secret_id = element(local.job_worker_secrets, count.index)
+  role      = "roles/secretmanager.secretAccessor"
+  member    = "serviceAccount:${google_service_account.job-worker.email}"
+}
+
+resource "google_cloud_run_service" "job-worker" {
+  name     = "job-worker"
+  location = var.region
+
+  autogenerate_revision_name = true
+
+  metadata {
+    annotations = merge(
+      local.default_service_annotations,
+      var.default_service_annotations_overrides,
+      lookup(var.service_annotations, "job-worker", {})
+    )
+  }
+
+  template {
+    spec {
+      service_account_name = google_service_account.job-worker.email
+      timeout_seconds      = 300
+
+      containers {
+        image = "gcr.io/${var.project}/github.com/google/exposure-notifications-verification-server/job-worker:initial"
+
+        resources {
+          limits = {
+            cpu    = "1"
+            memory = "512Mi"
+          }
+        }
+
+        dynamic "env" {
+          for_each = merge(
+            local.database_config,
+            local.firebase_config,
+            local.gcp_config,
+            local.rate_limit_config,
+            local.issue_config,
+            local.sms_status_callback_config,
+            local.signing_config,
+            local.observability_config,
+
+            // This MUST come last to allow overrides!
+            lookup(var.service_environment, "_all", {}),
+            lookup(var.service_environment, "job-worker", {}),
+          )
+
+          content {
+            name  = env.key
+            value = env.value
+          }
+        }
+      }
+    }
+
+    metadata {
+      annotations = merge(
+        local.default_revision_annotations,
+        var.default_revision_annotations_overrides,
+        lookup(var.revision_annotations, "job-worker", {})
+      )
+    }
+  }
+
+  depends_on = [
+    google_project_service.services["run.googleapis.com"],
+
+    google_kms_crypto_key_iam_member.job-worker-database-encrypter,
+    google_kms_key_ring_iam_member.job-worker-verification-signer-verifier,
+    google_project_iam_member.job-worker-firebase-admin,
+    google_project_iam_member.job-worker-observability,
+    google_secret_manager_secret_iam_member.job-worker-secrets,
+    google_service_account_iam_member.cloudbuild-deploy-job-worker,
+
+    null_resource.build,
+    null_resource.migrate,
+  ]
+
+  lifecycle {
+    ignore_changes = [
+      metadata[0].annotations["client.knative.dev/user-image"],
+      metadata[0].annotations["run.googleapis.com/client-name"],
+      metadata[0].annotations["run.googleapis.com/client-version"],
+      metadata[0].annotations["run.googleapis.com/ingress-status"],
+      metadata[0].annotations["serving.knative.dev/creator"],
+      metadata[0].annotations["serving.knative.dev/lastModifier"],
+      metadata[0].labels["cloud.googleapis.com/location"],
+      template[0].metadata[0].annotations["client.knative.dev/user-image"],
+      template[0].metadata[0].annotations["run.googleapis.com/client-name"],
+      template[0].metadata[0].annotations["run.googleapis.com/client-version"],
+      template[0].metadata[0].annotations["serving.knative.dev/creator"],
+      template[0].metadata[0].annotations["serving.knative.dev/lastModifier"],
+      template[0].spec[0].containers[0].image,
+    ]
+  }
+}
+
+#
+# Create scheduler job to invoke the service on a fixed interval.
+#
+
+resource "google_service_account" "job-worker-invoker" {
+  project      = data.google_project.project.project_id
+  account_id   = "en-job-worker-invk-sa"
+  display_name = "Verification job worker invoker"
+}
+
+resource "google_cloud_run_service_iam_member" "job-worker-invoker" {
+  project  = google_cloud_run_service.job-worker.project
+  location = google_cloud_run_service.job-worker.location
+  service  = google_cloud_run_service.job-worker.name
+  role     = "roles/run.invoker"
+  member   = "serviceAccount:${google_service_account.job-worker-invoker.email}"
+}
+
+resource "google_cloud_scheduler_job" "job-worker" {
+  name             = "job-worker"
+  region           = var.cloudscheduler_location
+  schedule         = "* * * * *"
+  time_zone        = "America/Los_Angeles"
+  attempt_deadline = "${google_cloud_run_service.job-worker.template[0].spec[0].timeout_seconds + 60}s"
+
+  retry_config {
+    retry_count = 0
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.job-worker.status.0.url}/"
+    oidc_token {
+      audience              = google_cloud_run_service.job-worker.status.0.url
+      service_account_email = google_service_account.job-worker-invoker.email
+    }
+  }
+
+  depends_on = [
+    google_app_engine_application.app,
+    google_cloud_run_service_iam_member.job-worker-invoker,
+    google_project_service.services["cloudscheduler.googleapis.com"],
+  ]
+}
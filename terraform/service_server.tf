@@ -110,6 +110,7 @@ resource "google_cloud_run_service" "server" {
             local.session_config,
             local.signing_config,
             local.issue_config,
+            local.sms_status_callback_config,
             local.observability_config,
 
             // This MUST come last to allow overrides!
@@ -0,0 +1,184 @@
+# Copyright 2021 the Exposure Notifications Verification Server authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+resource "google_service_account" "webhook-dispatcher" {
+  project      = var.project
+  account_id   = "en-ver-webhook-dispatcher-sa"
+  display_name = "Verification webhook dispatcher"
+}
+
+resource "google_service_account_iam_member" "cloudbuild-deploy-webhook-dispatcher" {
+  service_account_id = google_service_account.webhook-dispatcher.id
+  role               = "roles/iam.serviceAccountUser"
+  member             = "serviceAccount:${local.cloudbuild_email}"
+}
+
+resource "google_project_iam_member" "webhook-dispatcher-observability" {
+  for_each = local.observability_iam_roles
+  project  = var.project
+  role     = each.key
+  member   = "serviceAccount:${google_service_account.webhook-dispatcher.email}"
+}
+
+resource "google_kms_crypto_key_iam_member" "webhook-dispatcher-database-encrypter" {
+  crypto_key_id = google_kms_crypto_key.database-encrypter.self_link
+  role          = "roles/cloudkms.cryptoKeyEncrypterDecrypter"
+  member        = "serviceAccount:${google_service_account.webhook-dispatcher.email}"
+}
+
+locals {
+  webhook_dispatcher_secrets = flatten([
+    local.database_secrets,
+  ])
+}
+
+resource "google_secret_manager_secret_iam_member" "webhook-dispatcher-secrets" {
+  count     = length(local.webhook_dispatcher_secrets)
+  secret_id = element(local.webhook_dispatcher_secrets, count.index)
+  role      = "roles/secretmanager.secretAccessor"
+  member    = "serviceAccount:${google_service_account.webhook-dispatcher.email}"
+}
+
+resource "google_cloud_run_service" "webhook-dispatcher" {
+  name     = "webhook-dispatcher"
+  location = var.region
+
+  autogenerate_revision_name = true
+
+  metadata {
+    annotations = merge(
+      local.default_service_annotations,
+      var.default_service_annotations_overrides,
+      lookup(var.service_annotations, "webhook-dispatcher", {})
+    )
+  }
+
+  template {
+    spec {
+      service_account_name = google_service_account.webhook-dispatcher.email
+      timeout_seconds      = 300
+
+      containers {
+        image = "gcr.io/${var.project}/github.com/google/exposure-notifications-verification-server/webhook-dispatcher:initial"
+
+        resources {
+          limits = {
+            cpu    = "1"
+            memory = "512Mi"
+          }
+        }
+
+        dynamic "env" {
+          for_each = merge(
+            local.database_config,
+            local.gcp_config,
+            local.observability_config,
+
+            // This MUST come last to allow overrides!
+            lookup(var.service_environment, "_all", {}),
+            lookup(var.service_environment, "webhook-dispatcher", {}),
+          )
+
+          content {
+            name  = env.key
+            value = env.value
+          }
+        }
+      }
+    }
+
+    metadata {
+      annotations = merge(
+        local.default_revision_annotations,
+        var.default_revision_annotations_overrides,
+        lookup(var.revision_annotations, "webhook-dispatcher", {})
+      )
+    }
+  }
+
+  depends_on = [
+    google_project_service.services["run.googleapis.com"],
+
+    google_kms_crypto_key_iam_member.webhook-dispatcher-database-encrypter,
+    google_project_iam_member.webhook-dispatcher-observability,
+    google_secret_manager_secret_iam_member.webhook-dispatcher-secrets,
+    google_service_account_iam_member.cloudbuild-deploy-webhook-dispatcher,
+
+    null_resource.build,
+    null_resource.migrate,
+  ]
+
+  lifecycle {
+    ignore_changes = [
+      metadata[0].annotations["client.knative.dev/user-image"],
+      metadata[0].annotations["run.googleapis.com/client-name"],
+      metadata[0].annotations["run.googleapis.com/client-version"],
+      metadata[0].annotations["run.googleapis.com/ingress-status"],
+      metadata[0].annotations["serving.knative.dev/creator"],
+      metadata[0].annotations["serving.knative.dev/lastModifier"],
+      metadata[0].labels["cloud.googleapis.com/location"],
+      template[0].metadata[0].annotations["client.knative.dev/user-image"],
+      template[0].metadata[0].annotations["run.googleapis.com/client-name"],
+      template[0].metadata[0].annotations["run.googleapis.com/client-version"],
+      template[0].metadata[0].annotations["serving.knative.dev/creator"],
+      template[0].metadata[0].annotations["serving.knative.dev/lastModifier"],
+      template[0].spec[0].containers[0].image,
+    ]
+  }
+}
+
+#
+# Create scheduler job to invoke the service on a fixed interval.
+#
+
+resource "google_service_account" "webhook-dispatcher-invoker" {
+  project      = data.google_project.project.project_id
+  account_id   = "en-webhook-dispatcher-invk-sa"
+  display_name = "Verification webhook dispatcher invoker"
+}
+
+resource "google_cloud_run_service_iam_member" "webhook-dispatcher-invoker" {
+  project  = google_cloud_run_service.webhook-dispatcher.project
+  location = google_cloud_run_service.webhook-dispatcher.location
+  service  = google_cloud_run_service.webhook-dispatcher.name
+  role     = "roles/run.invoker"
+  member   = "serviceAccount:${google_service_account.webhook-dispatcher-invoker.email}"
+}
+
+resource "google_cloud_scheduler_job" "webhook-dispatcher-worker" {
+  name             = "webhook-dispatcher-worker"
+  region           = var.cloudscheduler_location
+  schedule         = "* * * * *"
+  time_zone        = "America/Los_Angeles"
+  attempt_deadline = "${google_cloud_run_service.webhook-dispatcher.template[0].spec[0].timeout_seconds + 60}s"
+
+  retry_config {
+    retry_count = 0
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.webhook-dispatcher.status.0.url}/"
+    oidc_token {
+      audience              = google_cloud_run_service.webhook-dispatcher.status.0.url
+      service_account_email = google_service_account.webhook-dispatcher-invoker.email
+    }
+  }
+
+  depends_on = [
+    google_app_engine_application.app,
+    google_cloud_run_service_iam_member.webhook-dispatcher-invoker,
+    google_project_service.services["cloudscheduler.googleapis.com"],
+  ]
+}
@@ -115,5 +115,9 @@ locals {
     "SERVER_ENDPOINT" = local.enable_lb ? "https://${var.server_hosts[0]}" : "" // Note: we can't ask Terraform for this value because otherwise it's a circular reference
   }
 
+  sms_status_callback_config = {
+    SMS_STATUS_CALLBACK_ENDPOINT = local.server_config["SERVER_ENDPOINT"]
+  }
+
   observability_config = {}
 }
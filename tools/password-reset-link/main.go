@@ -0,0 +1,90 @@
+// Copyright 2021 the Exposure Notifications Verification Server authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Generates a password reset link for a user when the server is configured for
+// password authentication (AUTH_PROVIDER=password). This is primarily used to
+// set the password of the first system administrator, before an email provider
+// has been configured.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/sethvargo/go-envconfig"
+)
+
+var emailFlag = flag.String("email", "super@example.com", "email address of the user")
+
+// passwordResetLinkConfig is the configuration required to generate a link.
+type passwordResetLinkConfig struct {
+	Database       database.Config
+	Auth           config.AuthConfig
+	ServerEndpoint string `env:"SERVER_ENDPOINT"`
+}
+
+func main() {
+	flag.Parse()
+
+	ctx, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	logger := logging.NewLoggerFromEnv().Named("password-reset-link")
+	ctx = logging.WithLogger(ctx, logger)
+
+	err := realMain(ctx)
+	done()
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func realMain(ctx context.Context) error {
+	var cfg passwordResetLinkConfig
+	if err := config.ProcessWith(ctx, &cfg, envconfig.OsLookuper()); err != nil {
+		return fmt.Errorf("failed to process config: %w", err)
+	}
+	cfg.Auth.Provider = config.AuthProviderPassword
+	if err := cfg.Auth.Validate(cfg.ServerEndpoint); err != nil {
+		return err
+	}
+
+	db, err := cfg.Database.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load database config: %w", err)
+	}
+	if err := db.Open(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	authProvider, err := auth.NewPassword(ctx, db, cfg.Auth.PasswordConfig(cfg.ServerEndpoint))
+	if err != nil {
+		return fmt.Errorf("failed to setup password auth: %w", err)
+	}
+
+	return authProvider.SendResetPasswordEmail(ctx, *emailFlag, func(ctx context.Context, resetLink string) error {
+		fmt.Fprintln(os.Stdout, resetLink)
+		return nil
+	})
+}